@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/visualdiff"
+	"github.com/BRO3886/go-docpdf/pkg/client"
+)
+
+// exitChanged is returned by diff when any page rendered differently.
+const exitChanged = 5
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	a := fs.String("a", "libreoffice", "baseline converter: libreoffice[:path] or a docpdf server URL")
+	b := fs.String("b", "", "candidate converter: libreoffice[:path] or a docpdf server URL")
+	reportDir := fs.String("report", "docpdf-diff", "directory to write the report to")
+	threshold := fs.Float64("threshold", 0.98, "SSIM below which a page, or part of one, counts as changed")
+	dpi := fs.Int("dpi", 72, "resolution pages are compared at")
+	pdftoppm := fs.String("pdftoppm", "pdftoppm", "pdftoppm executable (poppler-utils) used to render pages")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 || *b == "" || *threshold <= 0 || *threshold > 1 {
+		usage(stderr)
+		return exitUsage
+	}
+	convA, err := backend(*a)
+	if err != nil {
+		fmt.Fprintf(stderr, "docpdf: %v\n", err)
+		return exitUsage
+	}
+	convB, err := backend(*b)
+	if err != nil {
+		fmt.Fprintf(stderr, "docpdf: %v\n", err)
+		return exitUsage
+	}
+	inputs, code := expand(fs.Args(), stderr)
+	if code != exitOK {
+		return code
+	}
+
+	d := differ{
+		a: convA, b: convB, labelA: *a, labelB: *b,
+		raster: visualdiff.Pdftoppm{Path: *pdftoppm, DPI: *dpi},
+		opts:   visualdiff.Options{Threshold: *threshold},
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return d.run(ctx, inputs, *reportDir, stdout, stderr)
+}
+
+// backend returns the converter named by spec: "libreoffice" for the local
+// LibreOffice, "libreoffice:<path>" for another LibreOffice binary, or the
+// URL of a docpdf server.
+func backend(spec string) (convertFunc, error) {
+	switch {
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return remoteConvert(client.New(spec, client.WithAPIKey(os.Getenv("DOCPDF_API_KEY")))), nil
+	case spec == "libreoffice", strings.HasPrefix(spec, "libreoffice:"):
+		lo := converter.New()
+		if path, ok := strings.CutPrefix(spec, "libreoffice:"); ok {
+			lo.BinaryPath = path
+		}
+		lo.Profile, _ = lo.Profile.WithFontSubstitutions(converter.DefaultFontSubstitutions)
+		return localConvert(lo), nil
+	}
+	return nil, fmt.Errorf("unknown converter %q: want libreoffice, libreoffice:<path> or a server URL", spec)
+}
+
+// differ renders documents with two converters and compares the results.
+type differ struct {
+	a, b           convertFunc
+	labelA, labelB string
+	raster         visualdiff.Rasterizer
+	opts           visualdiff.Options
+}
+
+// run compares each input, writing one report per input under reportDir,
+// and returns the exit code: like convert's when a conversion failed, else
+// exitChanged when any page differs.
+func (d differ) run(ctx context.Context, inputs []string, reportDir string, stdout, stderr io.Writer) int {
+	var failed, changed int
+	var unavailable bool
+	used := make(map[string]bool)
+	for _, in := range inputs {
+		dir := reportDir
+		if len(inputs) > 1 {
+			base := strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+			name := base
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s-%d", base, i)
+			}
+			used[name] = true
+			dir = filepath.Join(reportDir, name)
+		}
+
+		report, err := d.compare(ctx, in)
+		if err == nil {
+			err = report.Write(dir)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "docpdf: %s: %s\n", in, strings.TrimPrefix(err.Error(), "docpdf: "))
+			failed++
+			unavailable = unavailable || isUnavailable(err)
+			continue
+		}
+		if report.Changed > 0 {
+			changed++
+		}
+		fmt.Fprintf(stdout, "%s: %d of %d pages changed (lowest SSIM %.4f) -> %s\n",
+			in, report.Changed, len(report.Pages), report.MinSSIM, filepath.Join(dir, "index.html"))
+	}
+	switch {
+	case unavailable:
+		return exitUnavailable
+	case failed > 0:
+		return exitFailed
+	case changed > 0:
+		return exitChanged
+	}
+	return exitOK
+}
+
+// compare converts in to PDF with both converters, renders the pages and
+// compares them.
+func (d differ) compare(ctx context.Context, in string) (*visualdiff.Report, error) {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return nil, fmt.Errorf("read input: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp("", "docpdf-diff-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var pages [2][]image.Image
+	for i, side := range []struct {
+		label   string
+		convert convertFunc
+	}{{d.labelA, d.a}, {d.labelB, d.b}} {
+		pdf, err := side.convert(ctx, data, filepath.Base(in), converter.FormatPDF)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", side.label, err)
+		}
+		path := filepath.Join(tmpDir, fmt.Sprintf("%d.pdf", i))
+		if err := os.WriteFile(path, pdf, 0600); err != nil {
+			return nil, err
+		}
+		if pages[i], err = d.raster.Rasterize(ctx, path); err != nil {
+			return nil, fmt.Errorf("%s: %w", side.label, err)
+		}
+	}
+	return visualdiff.NewReport(filepath.Base(in), d.labelA, d.labelB, visualdiff.Compare(pages[0], pages[1], d.opts), d.opts), nil
+}
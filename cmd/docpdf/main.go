@@ -0,0 +1,387 @@
+// Command docpdf converts documents to PDF from the command line, either
+// locally with the same converter as the server or by sending them to a
+// docpdf server.
+//
+// Usage:
+//
+//	docpdf convert [-format pdf] [-o output | -out-dir dir] [-server url]
+//	               [-concurrency n] <input|glob|->...
+//
+// An input of "-" reads the document from stdin; the result is then written
+// to stdout unless -o is given. Globs are expanded by docpdf as well as the
+// shell, so they can be quoted.
+//
+//	docpdf diff -b <converter> [-a <converter>] [-report dir]
+//	            [-threshold 0.98] [-dpi 72] <input|glob>...
+//
+// diff renders each input with two converters, a LibreOffice binary or a
+// docpdf server each, and writes a report of the pages that changed, so a
+// LibreOffice upgrade or a canary server can be checked before it takes
+// traffic.
+//
+//	docpdf preflight [-convert] [-fc-list path] [-timeout 1m]
+//
+// preflight checks that this machine can run conversions: the LibreOffice
+// binary starts, fonts are installed, the temp directory is writable and the
+// resource limits are sane, and with -convert that a document converts. It
+// prints a JSON report and exits 1 when a check failed, so it can run as a
+// Kubernetes init container or from an install script.
+//
+// Exit codes: 0 when every input converted, 1 when any conversion failed, 2
+// for a usage error, 3 when a pattern matched no files, and 4 when a remote
+// server could not be reached or kept failing, so CI can retry those. diff
+// exits 5 when any page rendered differently.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/pkg/client"
+)
+
+// Exit codes.
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitNoInput     = 3
+	exitUnavailable = 4
+	stdioMarker     = "-"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "convert":
+		return runConvert(args[1:], stdin, stdout, stderr)
+	case "diff":
+		return runDiff(args[1:], stdout, stderr)
+	case "preflight":
+		return runPreflight(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		usage(stdout)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "docpdf: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `usage: docpdf convert [-format pdf] [-o output | -out-dir dir] [-server url]
+                      [-concurrency n] <input|glob|->...
+
+Converts documents with LibreOffice (LIBREOFFICE_PATH overrides the binary),
+or with the docpdf server at -server (or DOCPDF_SERVER), authenticating with
+DOCPDF_API_KEY. -format is one of pdf, png, html, txt, docx. Each result is
+written next to its input, or into -out-dir. An input of "-" reads from stdin
+and writes the result to stdout unless -o is given.
+
+       docpdf diff -b <converter> [-a <converter>] [-report dir]
+                   [-threshold 0.98] [-dpi 72] [-pdftoppm path] <input|glob>...
+
+Renders each input to PDF with converters A (default: libreoffice) and B,
+rasterizes the pages with pdftoppm and compares them with SSIM. A converter
+is libreoffice, libreoffice:<path to another binary>, or a docpdf server URL.
+Writes index.html, report.json and thumbnails of the changed regions to
+-report (one subdirectory per input when there are several).
+
+       docpdf preflight [-convert] [-fc-list path] [-timeout 1m]
+
+Checks the LibreOffice binary (LIBREOFFICE_PATH), installed fonts, the temp
+directory and resource limits, and with -convert converts a test document.
+Prints a JSON report of every check (ok, warn, fail or skip); any failure
+exits 1.
+
+Exit codes: 0 all converted (diff: no page changed), 1 a conversion failed,
+2 usage error, 3 no input matched, 4 server unavailable, 5 diff found changed
+pages.
+`)
+}
+
+// convertFunc converts data, uploaded as name, to format.
+type convertFunc func(ctx context.Context, data []byte, name, format string) ([]byte, error)
+
+// job is one input and where its result goes; dst "" is stdout.
+type job struct {
+	src, dst string
+}
+
+func runConvert(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	out := fs.String("o", "", "output file for a single input (default: <input>.<format>, or stdout when reading stdin)")
+	outDir := fs.String("out-dir", "", "directory to write results to (default: next to each input)")
+	format := fs.String("format", converter.FormatPDF, "output format: pdf, png, html, txt or docx")
+	server := fs.String("server", os.Getenv("DOCPDF_SERVER"), "docpdf server URL to convert with instead of local LibreOffice")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "conversions to run at once")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 || *concurrency < 1 || (*out != "" && *outDir != "") {
+		usage(stderr)
+		return exitUsage
+	}
+	if converter.ContentType(*format) == "" {
+		fmt.Fprintf(stderr, "docpdf: unsupported output format %q\n", *format)
+		return exitUsage
+	}
+
+	inputs, code := expand(fs.Args(), stderr)
+	if code != exitOK {
+		return code
+	}
+	jobs, code := plan(inputs, *out, *outDir, *format, stderr)
+	if code != exitOK {
+		return code
+	}
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintf(stderr, "docpdf: %v\n", err)
+			return exitFailed
+		}
+	}
+
+	lo := converter.New()
+	// Render like the server does with its default settings.
+	lo.Profile, _ = lo.Profile.WithFontSubstitutions(converter.DefaultFontSubstitutions)
+	convert := localConvert(lo)
+	if *server != "" {
+		convert = remoteConvert(client.New(*server, client.WithAPIKey(os.Getenv("DOCPDF_API_KEY"))))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return convertAll(ctx, convert, jobs, *format, min(*concurrency, len(jobs)), stdin, stdout, stderr)
+}
+
+// expand resolves glob patterns among args. "-" must be the only input.
+func expand(args []string, stderr io.Writer) ([]string, int) {
+	if len(args) == 1 && args[0] == stdioMarker {
+		return args, exitOK
+	}
+	var inputs []string
+	for _, arg := range args {
+		if arg == stdioMarker {
+			fmt.Fprintln(stderr, "docpdf: - cannot be combined with other inputs")
+			return nil, exitUsage
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "docpdf: bad pattern %q: %v\n", arg, err)
+			return nil, exitUsage
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(stderr, "docpdf: no such file: %s\n", arg)
+			return nil, exitNoInput
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, exitOK
+}
+
+// plan decides each input's output path, refusing to overwrite an input or
+// to write two results to the same file.
+func plan(inputs []string, out, outDir, format string, stderr io.Writer) ([]job, int) {
+	if out != "" && len(inputs) > 1 {
+		fmt.Fprintln(stderr, "docpdf: -o takes a single input; use -out-dir")
+		return nil, exitUsage
+	}
+	srcs := make(map[string]bool, len(inputs))
+	for _, in := range inputs {
+		srcs[filepath.Clean(in)] = true
+	}
+	taken := make(map[string]string, len(inputs))
+	jobs := make([]job, 0, len(inputs))
+	for _, in := range inputs {
+		dst := out
+		switch {
+		case dst == stdioMarker:
+			dst = ""
+		case dst != "":
+		case in == stdioMarker:
+		case outDir != "":
+			base := filepath.Base(in)
+			dst = filepath.Join(outDir, strings.TrimSuffix(base, filepath.Ext(base))+"."+format)
+		default:
+			dst = strings.TrimSuffix(in, filepath.Ext(in)) + "." + format
+		}
+		if dst != "" {
+			clean := filepath.Clean(dst)
+			if srcs[clean] {
+				fmt.Fprintf(stderr, "docpdf: refusing to overwrite input %s; pass -o or -out-dir\n", dst)
+				return nil, exitUsage
+			}
+			if prev, ok := taken[clean]; ok {
+				fmt.Fprintf(stderr, "docpdf: %s and %s would both be written to %s\n", prev, in, dst)
+				return nil, exitUsage
+			}
+			taken[clean] = in
+		}
+		jobs = append(jobs, job{src: in, dst: dst})
+	}
+	return jobs, exitOK
+}
+
+// convertAll runs jobs with up to concurrency at once and returns the exit
+// code for the run.
+func convertAll(ctx context.Context, convert convertFunc, jobs []job, format string, concurrency int, stdin io.Reader, stdout, stderr io.Writer) int {
+	var (
+		mu          sync.Mutex
+		failed      int
+		unavailable bool
+		wg          sync.WaitGroup
+	)
+	queue := make(chan job)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				err := convertOne(ctx, convert, j, format, stdin, stdout)
+				if err == nil {
+					if j.dst != "" && len(jobs) > 1 {
+						mu.Lock()
+						fmt.Fprintf(stderr, "%s -> %s\n", j.src, j.dst)
+						mu.Unlock()
+					}
+					continue
+				}
+				mu.Lock()
+				fmt.Fprintf(stderr, "docpdf: %s: %s\n", j.src, strings.TrimPrefix(err.Error(), "docpdf: "))
+				failed++
+				unavailable = unavailable || isUnavailable(err)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(jobs) > 1 {
+		fmt.Fprintf(stderr, "docpdf: %d converted, %d failed\n", len(jobs)-failed, failed)
+	}
+	switch {
+	case unavailable:
+		return exitUnavailable
+	case failed > 0:
+		return exitFailed
+	}
+	return exitOK
+}
+
+// convertOne reads j.src, converts it and writes the result to j.dst.
+func convertOne(ctx context.Context, convert convertFunc, j job, format string, stdin io.Reader, stdout io.Writer) error {
+	var data []byte
+	var err error
+	if j.src == stdioMarker {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(j.src)
+	}
+	if err != nil {
+		return fmt.Errorf("read input: %w", err)
+	}
+
+	result, err := convert(ctx, data, filepath.Base(j.src), format)
+	if err != nil {
+		return err
+	}
+
+	if j.dst == "" {
+		if _, err := io.Copy(stdout, bytes.NewReader(result)); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(j.dst, result, 0644); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+	return nil
+}
+
+// isUnavailable reports whether err means the server, rather than the
+// document, was the problem.
+func isUnavailable(err error) bool {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// localConvert converts with conv on this machine.
+func localConvert(conv converter.Converter) convertFunc {
+	return func(ctx context.Context, data []byte, _, format string) ([]byte, error) {
+		return convertBytes(ctx, conv, data, format)
+	}
+}
+
+// remoteConvert converts on the server c talks to.
+func remoteConvert(c *client.Client) convertFunc {
+	return func(ctx context.Context, data []byte, name, format string) ([]byte, error) {
+		if name == stdioMarker {
+			name = ""
+		}
+		rc, err := c.Convert(ctx, bytes.NewReader(data), client.ConvertOptions{Filename: name, Output: format})
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+}
+
+// errUnsupported is returned when the input is not a recognised document.
+var errUnsupported = errors.New("unsupported file type")
+
+// convertBytes stages data in a temp dir under the extension matching its
+// detected type, converts it to format, and returns the result.
+func convertBytes(ctx context.Context, conv converter.Converter, data []byte, format string) ([]byte, error) {
+	ft, ok := filetype.Default.Detect(bytes.NewReader(data), int64(len(data)))
+	if !ok {
+		return nil, errUnsupported
+	}
+
+	tmpDir, err := os.MkdirTemp("", "docpdf-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inputPath := filepath.Join(tmpDir, "input"+ft.Ext)
+	if err := os.WriteFile(inputPath, data, 0600); err != nil {
+		return nil, err
+	}
+	outPath, err := conv.Convert(ctx, inputPath, tmpDir, converter.Options{Format: format})
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(outPath)
+}
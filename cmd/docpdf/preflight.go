@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// Check statuses. Only a failed check fails preflight; a warning points at
+// something that degrades conversions without breaking them.
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "fail"
+	statusSkip = "skip"
+)
+
+// check is the outcome of one preflight check.
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// preflightReport is what preflight prints.
+type preflightReport struct {
+	OK     bool    `json:"ok"`
+	Checks []check `json:"checks"`
+}
+
+func runPreflight(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("preflight", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	testConvert := fs.Bool("convert", false, "also convert a small document to PDF")
+	fcList := fs.String("fc-list", "fc-list", "fc-list executable (fontconfig) used to list installed fonts")
+	timeout := fs.Duration("timeout", time.Minute, "time allowed for the whole preflight")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	lo := converter.New()
+	lo.Profile, _ = lo.Profile.WithFontSubstitutions(converter.DefaultFontSubstitutions)
+
+	binary := checkBinary(ctx, lo)
+	checks := []check{binary, checkFonts(ctx, *fcList), checkTempDir()}
+	checks = append(checks, checkLimits()...)
+	switch {
+	case !*testConvert:
+	case binary.Status == statusFail:
+		checks = append(checks, check{Name: "conversion", Status: statusSkip, Detail: "no usable LibreOffice binary"})
+	default:
+		checks = append(checks, checkConversion(ctx, lo))
+	}
+
+	report := preflightReport{OK: true, Checks: checks}
+	for _, c := range checks {
+		if c.Status == statusFail {
+			report.OK = false
+		}
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Fprintf(stdout, "%s\n", out)
+	if !report.OK {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// checkBinary runs the LibreOffice binary to make sure it is there and
+// starts.
+func checkBinary(ctx context.Context, lo *converter.LibreOffice) check {
+	c := check{Name: "libreoffice"}
+	if _, err := exec.LookPath(lo.BinaryPath); err != nil {
+		c.Status, c.Detail = statusFail, fmt.Sprintf("%s not found (set LIBREOFFICE_PATH)", lo.BinaryPath)
+		return c
+	}
+	v, err := lo.Version(ctx)
+	if err != nil {
+		c.Status, c.Detail = statusFail, err.Error()
+		return c
+	}
+	c.Status, c.Detail = statusOK, v
+	return c
+}
+
+// checkFonts lists the installed font families with fontconfig. Without any
+// fonts LibreOffice renders no text; without the replacements in
+// converter.DefaultFontSubstitutions, documents set in Microsoft fonts
+// reflow.
+func checkFonts(ctx context.Context, fcList string) check {
+	c := check{Name: "fonts"}
+	fonts, err := converter.ScanFonts(ctx, fcList)
+	if err != nil {
+		c.Status, c.Detail = statusFail, err.Error()
+		return c
+	}
+	families := fonts.Families()
+	if len(families) == 0 {
+		c.Status, c.Detail = statusFail, "no fonts installed"
+		return c
+	}
+	var missing []string
+	for _, s := range converter.DefaultFontSubstitutions {
+		if !fonts.Has(s.Replacement) && !slices.Contains(missing, s.Replacement) {
+			missing = append(missing, s.Replacement)
+		}
+	}
+	c.Status, c.Detail = statusOK, fmt.Sprintf("%d font families", len(families))
+	if len(missing) > 0 {
+		c.Status = statusWarn
+		c.Detail += "; missing substitutes " + strings.Join(missing, ", ")
+	}
+	return c
+}
+
+// checkTempDir makes sure conversions can stage files in the temp directory.
+func checkTempDir() check {
+	c := check{Name: "temp_dir"}
+	dir, err := os.MkdirTemp("", "docpdf-preflight-*")
+	if err != nil {
+		c.Status, c.Detail = statusFail, err.Error()
+		return c
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "probe"), make([]byte, 64<<10), 0600); err != nil {
+		c.Status, c.Detail = statusFail, err.Error()
+		return c
+	}
+	c.Status, c.Detail = statusOK, os.TempDir()
+	return c
+}
+
+// checkConversion converts a small text document to PDF.
+func checkConversion(ctx context.Context, lo *converter.LibreOffice) check {
+	c := check{Name: "conversion"}
+	start := time.Now()
+	pdf, err := convertBytes(ctx, lo, []byte("docpdf preflight\n"), converter.FormatPDF)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = statusFail, err.Error()
+	case !bytes.HasPrefix(pdf, []byte("%PDF-")):
+		c.Status, c.Detail = statusFail, "output is not a PDF"
+	default:
+		c.Status, c.Detail = statusOK, fmt.Sprintf("txt to pdf in %s", time.Since(start).Round(time.Millisecond))
+	}
+	return c
+}
@@ -0,0 +1,55 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Resource limits below which LibreOffice fails to start or to open a
+// document's parts (minimum), or may fail under concurrent conversions
+// (recommended).
+const (
+	minOpenFiles         = 256
+	recommendedOpenFiles = 1024
+	minAddressSpace      = 1 << 30
+)
+
+// checkLimits checks the open-file and address-space limits soffice runs
+// under.
+func checkLimits() []check {
+	files := check{Name: "ulimit_nofile"}
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		files.Status, files.Detail = statusWarn, err.Error()
+	} else {
+		files.Status, files.Detail = statusOK, fmt.Sprintf("soft limit %s", limitString(lim.Cur))
+		switch {
+		case lim.Cur < minOpenFiles:
+			files.Status, files.Detail = statusFail, files.Detail+fmt.Sprintf(", need at least %d", minOpenFiles)
+		case lim.Cur < recommendedOpenFiles:
+			files.Status, files.Detail = statusWarn, files.Detail+fmt.Sprintf(", %d recommended", recommendedOpenFiles)
+		}
+	}
+
+	mem := check{Name: "ulimit_as"}
+	if err := syscall.Getrlimit(syscall.RLIMIT_AS, &lim); err != nil {
+		mem.Status, mem.Detail = statusWarn, err.Error()
+	} else {
+		mem.Status, mem.Detail = statusOK, fmt.Sprintf("soft limit %s", limitString(lim.Cur))
+		if lim.Cur < minAddressSpace {
+			mem.Status, mem.Detail = statusFail, mem.Detail+", need at least 1 GiB of address space"
+		}
+	}
+	return []check{files, mem}
+}
+
+// limitString formats a limit; RLIM_INFINITY is all ones on Linux and
+// 1<<63-1 on macOS.
+func limitString(v uint64) string {
+	if v >= 1<<63-1 {
+		return "unlimited"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// checkLimits has no resource limits to check on this platform.
+func checkLimits() []check {
+	return []check{{Name: "ulimits", Status: statusSkip, Detail: "not supported on this platform"}}
+}
@@ -1,51 +1,1076 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/billing"
+	"github.com/BRO3886/go-docpdf/internal/buildinfo"
+	"github.com/BRO3886/go-docpdf/internal/cache"
+	"github.com/BRO3886/go-docpdf/internal/capture"
+	"github.com/BRO3886/go-docpdf/internal/config"
 	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/egress"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
 	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/logging"
 	"github.com/BRO3886/go-docpdf/internal/metrics"
 	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/outbox"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/preview"
+	"github.com/BRO3886/go-docpdf/internal/redis"
+	"github.com/BRO3886/go-docpdf/internal/schedule"
+	"github.com/BRO3886/go-docpdf/internal/scratch"
+	"github.com/BRO3886/go-docpdf/internal/sink"
+	"github.com/BRO3886/go-docpdf/internal/stats"
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+	"github.com/BRO3886/go-docpdf/internal/templates"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+	"github.com/BRO3886/go-docpdf/internal/webhook"
 )
 
 func main() {
-	conv := converter.New()
+	// Until the configuration is loaded, log JSON at info level.
+	slog.SetDefault(logging.New(logging.Config{}))
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal("loading configuration", err)
+	}
+	// LOG_LEVEL and LOG_FORMAT configure every log line, the per-request
+	// ones included.
+	level, _ := logging.ParseLevel(cfg.LogLevel) // validated by Load
+	slog.SetDefault(logging.New(logging.Config{Level: level, Format: cfg.LogFormat}))
+
+	lo := &converter.LibreOffice{
+		BinaryPath: cfg.LibreOfficePath,
+		Timeout:    config.ConverterTimeout,
+		Priority: converter.Priority{
+			Nice:    cfg.ConvertNice,
+			IOClass: cfg.ConvertIoniceClass,
+			IOLevel: cfg.ConvertIoniceLevel,
+			CPUSet:  cfg.ConvertCPUSet,
+		},
+		// CONVERT_CPU_SECONDS, CONVERT_MAX_RSS_MB and CONVERT_MAX_OUTPUT_MB
+		// fail a runaway conversion with resource_limit.
+		Limits: converter.Limits{
+			CPUSeconds:  cfg.ConvertCPUSeconds,
+			MaxRSSMB:    cfg.ConvertMaxRSSMB,
+			MaxOutputMB: cfg.ConvertMaxOutputMB,
+		},
+	}
 	reg := metrics.New()
-	convertHandler := handler.NewConvert(conv)
+	if cfg.RuntimeMetrics {
+		reg.RegisterRuntime()
+	}
+	workers := cfg.MaxConcurrentConversions
+
+	lo.Profile = loadProfile(cfg)
+
+	// SANDBOX runs each soffice, which parses untrusted documents, under
+	// bwrap, nsjail or unshare: no network and, but for unshare, a read-only
+	// system with only the conversion's directory writable.
+	if cfg.Sandbox != "" {
+		lo = converter.Sandboxed(lo, converter.Sandbox{
+			Tool:       cfg.Sandbox,
+			Path:       cfg.SandboxPath,
+			ReadOnly:   cfg.SandboxReadOnly,
+			UID:        cfg.SandboxUID,
+			GID:        cfg.SandboxGID,
+			CPUSeconds: cfg.SandboxCPUSeconds,
+			MemoryMB:   cfg.SandboxMemoryMB,
+		})
+	}
+
+	// Maintenance tasks are added below as their subjects are set up, and
+	// run by one scheduler; GET /status reports their last runs.
+	var tasks []schedule.Task
+
+	// CONVERTER_BACKEND=unoserver keeps one warm soffice per worker instead
+	// of spawning soffice for every conversion.
+	var conv converter.Converter = lo
+	var uno *converter.UnoServer
+	if slices.Contains(cfg.Backends(), "unoserver") {
+		var err error
+		uno, err = converter.StartUnoServer(converter.UnoConfig{
+			ServerPath:  cfg.UnoserverPath,
+			ConvertPath: cfg.UnoconvertPath,
+			SofficePath: lo.BinaryPath,
+			Instances:   workers,
+			BasePort:    cfg.UnoserverBasePort,
+			Timeout:     lo.Timeout,
+			Priority:    lo.Priority,
+			Profile:     lo.Profile,
+		})
+		if err != nil {
+			fatal("starting unoserver", err)
+		}
+		conv = uno
+		// UNOSERVER_RECYCLE_INTERVAL restarts one idle instance with a
+		// fresh profile at a time; 0 disables recycling.
+		tasks = append(tasks, schedule.Task{
+			Name:     "profile_recycle",
+			Interval: cfg.UnoserverRecycleInterval,
+			Run: func(context.Context) error {
+				if !uno.Recycle() {
+					slog.Debug("no idle unoserver instance to recycle")
+				}
+				return nil
+			},
+		})
+	}
+	// CONVERTER_BACKENDS routes conversions over several backends, falling
+	// back from one that fails to the next.
+	if len(cfg.ConverterBackends) > 0 {
+		conv = newRouter(cfg, lo, uno, reg)
+	}
+	// CONVERT_RETRIES runs a conversion again, after CONVERT_RETRY_BACKOFF,
+	// when LibreOffice fails in a way CONVERT_RETRY_ON says may be transient.
+	if cfg.ConvertRetries > 0 {
+		var err error
+		conv, err = converter.Retrying(conv, converter.RetryConfig{
+			Attempts: cfg.ConvertRetries + 1,
+			Backoff:  cfg.ConvertRetryBackoff,
+			On:       cfg.ConvertRetryOn,
+			OnRetry: func(ctx context.Context, attempt int, err error) {
+				logging.FromContext(ctx).Warn("retrying conversion", "attempt", attempt, "error", err)
+				reg.IncConversionRetry()
+			},
+		})
+		if err != nil {
+			fatal("configuring conversion retries", err)
+		}
+	}
+	queueDepth := cfg.MaxQueueDepth
+	convPool := pool.New(workers, queueDepth)
+	convPool.SetObserver(reg)
+	reg.SetWorkers(workers)
+
+	// /readyz runs a real conversion (cached for READY_CHECK_INTERVAL) and
+	// fails past the READY_* thresholds; /livez fails when the worker pool
+	// has leaked its slots. The probe converts with the bare converter;
+	// every other conversion feeds READY_MAX_FAILURE_RATE.
+	probes := handler.NewProbes(conv, convPool, handler.ProbeConfig{
+		ReadyTTL:       cfg.ReadyCheckInterval,
+		ReadyTimeout:   lo.Timeout,
+		StallAfter:     cfg.LiveStallTimeout,
+		MaxQueueDepth:  cfg.ReadyMaxQueueDepth,
+		MaxFailureRate: cfg.ReadyMaxFailureRate,
+		FailureWindow:  cfg.ReadyFailureWindow,
+		// An instance refusing conversions for want of disk is not ready
+		// either, whatever READY_MIN_FREE_DISK_MB says.
+		MinFreeDisk: int64(max(cfg.ReadyMinFreeDiskMB, cfg.ConvertMinFreeDiskMB)) << 20,
+	})
+	conv = probes.Track(conv)
+	// SELF_TEST_INTERVAL refreshes the /readyz conversion in the background.
+	tasks = append(tasks, schedule.Task{Name: "self_test", Interval: cfg.SelfTestInterval, Run: probes.Refresh})
+	convOpts := []handler.Option{handler.WithPool(convPool)}
+	var asyncOpts []handler.Option
+
+	// STATS_FILE persists duration statistics across restarts, saved every
+	// STATS_FLUSH_INTERVAL; unset keeps them in memory only.
+	statsRec, err := stats.New(stats.Config{Path: cfg.StatsFile})
+	if err != nil {
+		slog.Warn("could not load stats file, starting empty", "error", err)
+	}
+	if cfg.StatsFile != "" {
+		tasks = append(tasks, schedule.Task{
+			Name:     "stats_save",
+			Interval: cfg.StatsFlushInterval,
+			Run:      func(context.Context) error { return statsRec.Save() },
+		})
+	}
+	convOpts = append(convOpts, handler.WithStats(statsRec))
+	asyncOpts = append(asyncOpts, handler.WithStats(statsRec))
+
+	// BILLING_EXPORT periodically exports per-tenant usage to a CSV file or
+	// an HTTP endpoint; unset disables billing.
+	meter := loadBilling(cfg)
+	if meter != nil {
+		convOpts = append(convOpts, handler.WithBilling(meter))
+		asyncOpts = append(asyncOpts, handler.WithBilling(meter))
+	}
+
+	// OTEL_EXPORTER_OTLP_ENDPOINT exports a trace per request, with a span
+	// for each LibreOffice run, to an OpenTelemetry collector; unset
+	// disables tracing.
+	tracer := loadTracer(cfg)
+	if tracer != nil {
+		// Latency histograms carry the trace of an example request in each
+		// bucket, which only the OpenMetrics exposition can show.
+		reg.EnableOpenMetrics()
+	}
+
+	// MEMORY_WATCHDOG_THRESHOLD is a percentage of the memory limit; 0
+	// disables the watchdog.
+	if cfg.MemoryWatchdogThreshold > 0 {
+		wd := watchdog.New(watchdog.Config{
+			Threshold: float64(cfg.MemoryWatchdogThreshold) / 100,
+			Interval:  cfg.MemoryWatchdogInterval,
+			OnKill:    reg.IncWatchdogKill,
+		})
+		convOpts = append(convOpts, handler.WithWatchdog(wd))
+		asyncOpts = append(asyncOpts, handler.WithWatchdog(wd))
+	}
+
+	// POSTPROCESS_WORKERS bounds the pages of one result watermarked at once.
+	convOpts = append(convOpts, handler.WithPostProcessWorkers(cfg.PostProcessWorkers))
+	asyncOpts = append(asyncOpts, handler.WithPostProcessWorkers(cfg.PostProcessWorkers))
+
+	// SCRATCH_DIR, a tmpfs mount, stages synchronous conversions in memory:
+	// each reserves SCRATCH_CONVERSION_MB of SCRATCH_MAX_MB, and goes to disk
+	// when none is left or it needs more.
+	if cfg.ScratchDir != "" {
+		space, err := scratch.New(scratch.Config{
+			Dir:        cfg.ScratchDir,
+			Capacity:   int64(cfg.ScratchMaxMB) << 20,
+			Limit:      int64(cfg.ScratchConversionMB) << 20,
+			OnFallback: reg.IncScratchFallback,
+		})
+		if err != nil {
+			fatal("preparing scratch directory", err)
+		}
+		convOpts = append(convOpts, handler.WithScratch(space))
+	}
+
+	// ALLOWED_INPUT_TYPES restricts accepted input types for everyone;
+	// TENANT_ALLOWED_INPUT_TYPES narrows it per X-Tenant-ID.
+	policy, err := filetype.ParsePolicy(cfg.AllowedInputTypes, cfg.TenantAllowedInputTypes)
+	if err != nil {
+		fatal("parsing input type policy", err)
+	}
+	convOpts = append(convOpts, handler.WithPolicy(policy))
+	asyncOpts = append(asyncOpts, handler.WithPolicy(policy))
+
+	// PDF_VERSION is the PDF version produced when a request names none;
+	// TENANT_PDF_VERSIONS overrides it per X-Tenant-ID.
+	pdfVersions, err := converter.ParsePDFVersions(cfg.TenantPDFVersions)
+	if err != nil {
+		fatal("parsing tenant pdf versions", err)
+	}
+	var pdfVersion string
+	if cfg.PDFVersion != "" {
+		if pdfVersion, err = converter.ParsePDFVersion(cfg.PDFVersion); err != nil {
+			fatal("parsing pdf version", err)
+		}
+	}
+	convOpts = append(convOpts, handler.WithPDFVersions(pdfVersion, pdfVersions))
+	asyncOpts = append(asyncOpts, handler.WithPDFVersions(pdfVersion, pdfVersions))
+
+	// IMAGE_DPI downsamples images in PDF results when a request names no
+	// image_dpi; TENANT_IMAGE_DPI overrides it per X-Tenant-ID.
+	imageDPI, err := converter.ParseImageDPIs(cfg.TenantImageDPI)
+	if err != nil {
+		fatal("parsing tenant image dpi", err)
+	}
+	convOpts = append(convOpts, handler.WithImageDPI(cfg.ImageDPI, imageDPI))
+	asyncOpts = append(asyncOpts, handler.WithImageDPI(cfg.ImageDPI, imageDPI))
+
+	// MACRO_POLICY is reject (default), strip or allow.
+	macros, err := filetype.ParseMacroPolicy(cfg.MacroPolicy)
+	if err != nil {
+		fatal("parsing macro policy", err)
+	}
+	convOpts = append(convOpts, handler.WithMacroPolicy(macros, reg.IncMacroDocument))
+	asyncOpts = append(asyncOpts, handler.WithMacroPolicy(macros, reg.IncMacroDocument))
+
+	// PROTECTION_POLICY is honor, ignore or warn (default).
+	protection, err := filetype.ParseProtectionPolicy(cfg.ProtectionPolicy)
+	if err != nil {
+		fatal("parsing protection policy", err)
+	}
+	convOpts = append(convOpts, handler.WithProtectionPolicy(protection, reg.IncProtectedUpload))
+	asyncOpts = append(asyncOpts, handler.WithProtectionPolicy(protection, reg.IncProtectedUpload))
+	packageLimits := filetype.PackageLimits{
+		MaxEntries:      cfg.PackageMaxEntries,
+		MaxUncompressed: int64(cfg.PackageMaxUncompressedMB) << 20,
+	}
+	convOpts = append(convOpts, handler.WithPackageLimits(packageLimits))
+	asyncOpts = append(asyncOpts, handler.WithPackageLimits(packageLimits))
+	convOpts = append(convOpts, handler.WithUploadObserver(reg.IncBadUploadReason))
+	asyncOpts = append(asyncOpts, handler.WithUploadObserver(reg.IncBadUploadReason))
+	convOpts = append(convOpts, handler.WithTemplateObserver(reg.IncTemplateStripped))
+	asyncOpts = append(asyncOpts, handler.WithTemplateObserver(reg.IncTemplateStripped))
+	// FC_LIST_PATH lists the installed fonts once at startup, for GET
+	// /fonts and the X-Missing-Fonts header.
+	fonts := scanFonts(cfg)
+	if fonts != nil {
+		convOpts = append(convOpts, handler.WithFonts(fonts, fontSubstitutions(cfg), reg.IncMissingFonts))
+		asyncOpts = append(asyncOpts, handler.WithFonts(fonts, fontSubstitutions(cfg), reg.IncMissingFonts))
+	}
+	convOpts = append(convOpts, handler.WithSizeObserver(reg.ObserveSizes))
+	asyncOpts = append(asyncOpts, handler.WithSizeObserver(reg.ObserveSizes))
+	convOpts = append(convOpts, handler.WithLimitObserver(reg.IncResourceLimit))
+	asyncOpts = append(asyncOpts, handler.WithLimitObserver(reg.IncResourceLimit))
+	convOpts = append(convOpts, handler.WithBackend(strings.Join(cfg.Backends(), ",")))
+	asyncOpts = append(asyncOpts, handler.WithBackend(strings.Join(cfg.Backends(), ",")))
+	// CONVERT_MIN_FREE_DISK_MB refuses new conversions with 507 before a
+	// full temp directory fails them halfway through.
+	convOpts = append(convOpts, handler.WithMinFreeDisk(int64(cfg.ConvertMinFreeDiskMB)<<20))
+	asyncOpts = append(asyncOpts, handler.WithMinFreeDisk(int64(cfg.ConvertMinFreeDiskMB)<<20))
+
+	// PARSE_TIMEOUT, QUEUE_TIMEOUT and CONVERT_TIMEOUT bound individual stages
+	// of a synchronous conversion; 0 leaves them to REQUEST_TIMEOUT.
+	convOpts = append(convOpts,
+		handler.WithStageTimeouts(handler.StageTimeouts{
+			Parse:   cfg.ParseTimeout,
+			Queue:   cfg.QueueTimeout,
+			Convert: cfg.ConvertTimeout,
+		}),
+		handler.WithStageObserver(reg.ObserveStage),
+	)
+
+	// CACHE_MAX_MB keeps up to that many megabytes of recent results in
+	// memory, keyed by document and options; 0 disables the cache.
+	// CACHE_TTL also drops results older than that, checked at least every
+	// minute.
+	if cfg.CacheMaxMB > 0 {
+		results := cache.New(int64(cfg.CacheMaxMB) << 20)
+		convOpts = append(convOpts, handler.WithCache(results, reg.IncCacheLookup))
+		if cfg.CacheTTL > 0 {
+			tasks = append(tasks, schedule.Task{
+				Name:     "cache_expire",
+				Interval: min(cfg.CacheTTL, time.Minute),
+				Run: func(context.Context) error {
+					if n := results.Expire(cfg.CacheTTL); n > 0 {
+						slog.Debug("expired cached results", "count", n)
+					}
+					return nil
+				},
+			})
+		}
+	}
+
+	// AFFINITY exposes each document's affinity key for load balancers to
+	// hash on, so a document's results are cached on one replica instead of
+	// converted once per replica.
+	if cfg.Affinity {
+		convOpts = append(convOpts, handler.WithAffinity(cfg.AffinityCookie))
+	}
+
+	// OUTPUT_SINK lets clients send store=true to have results written to a
+	// bucket or directory instead of returned.
+	out := loadSink(cfg)
+	if out != nil {
+		convOpts = append(convOpts, handler.WithSink(out))
+	}
+
+	// Each job records the LibreOffice version it was converted with, so
+	// POST /jobs/{id}/feedback ratings can be compared across upgrades.
+	build, loVersion := buildinfo.Get(), detectLibreOffice(lo)
+	jobCfg := jobs.Config{
+		Workers:     cfg.JobWorkers,
+		QueueSize:   cfg.JobQueueDepth,
+		TTL:         cfg.JobTTL,
+		Observer:    reg,
+		LibreOffice: loVersion,
+		OnFeedback:  reg.ObserveFeedback,
+		// Each job continues the trace of the request that submitted it.
+		Tracer: tracer,
+	}
+	// JOB_RESULT_DIR stores identical async results once; each is removed
+	// when the last job referencing it expires.
+	if cfg.JobResultDir != "" {
+		kept, err := jobs.NewResults(cfg.JobResultDir)
+		if err != nil {
+			fatal("preparing job result directory", err)
+		}
+		jobCfg.Results = kept
+		jobCfg.OnDedup = reg.AddResultDedup
+	}
+
+	// WEBHOOK_SECRET enables callback_url on /convert/async; every payload is
+	// signed with it.
+	var (
+		hooks  *webhook.Dispatcher
+		events *outbox.Outbox
+	)
+	if cfg.WebhookSecret != "" {
+		hooks = webhook.New(webhook.Config{
+			Secret:       []byte(cfg.WebhookSecret),
+			AllowedHosts: cfg.WebhookAllowedHosts,
+			Tracer:       tracer,
+		})
+
+		// Completion events go through the outbox so they survive a receiver
+		// outage; OUTBOX_DIR also makes them survive a restart.
+		var store outbox.Store = outbox.NewMemoryStore()
+		if cfg.OutboxDir != "" {
+			fileStore, err := outbox.NewFileStore(cfg.OutboxDir)
+			if err != nil {
+				fatal("opening outbox", err)
+			}
+			store = fileStore
+		}
+		events = outbox.New(outbox.Config{
+			Store:     store,
+			Publisher: hooks,
+			Observer:  reg,
+			OnDrop:    func(e outbox.Event) { hooks.MarkFailed(e.ID) },
+		})
+		jobCfg.OnFinish = handler.JobEvents(events)
+		asyncOpts = append(asyncOpts, handler.WithWebhooks(hooks))
+	}
+
+	jobMgr := jobs.NewManager(jobCfg)
+	jobsHandler := handler.NewJobs(jobMgr)
+
+	// PREVIEW_TIMEOUT enables fast=true on /convert and /convert/raw; a
+	// preview that does not make it in time becomes a job on the async queue.
+	fastOpts := convOpts
+	if cfg.PreviewTimeout > 0 {
+		fastOpts = slices.Concat(convOpts, []handler.Option{handler.WithPreview(jobMgr, cfg.PreviewTimeout)})
+	}
+	convertHandler := handler.NewConvert(conv, fastOpts...)
+	rawHandler := handler.NewConvertRaw(conv, fastOpts...)
+	batchHandler := handler.NewBatch(conv, cfg.BatchParallelism, convOpts...)
+	splitHandler := handler.NewSplit(conv, convOpts...)
+	thumbnailHandler := handler.NewThumbnail(conv, preview.Pdftoppm{Path: cfg.PdftoppmPath}, convOpts...)
+	extractHandler := handler.NewExtract(conv, convOpts...)
+
+	// CAPTURE_RETAIN keeps the raw requests of the clients an admin arms a
+	// capture for, for reproducing integration problems; it needs
+	// ADMIN_TOKEN, and 0 disables it.
+	var captures *capture.Recorder
+	if cfg.AdminToken != "" && cfg.CaptureRetain > 0 {
+		captures = newCaptures(cfg)
+		tasks = append(tasks, schedule.Task{
+			Name:     "capture_expire",
+			Interval: min(cfg.CaptureTTL, time.Minute),
+			Run: func(context.Context) error {
+				if n := captures.Expire(time.Now()); n > 0 {
+					slog.Debug("expired captured requests", "count", n)
+				}
+				return nil
+			},
+		})
+	}
+
+	// TEMP_MAX_AGE removes the working directories of requests a crash cut
+	// short, at startup and then periodically; 0 disables it.
+	if cfg.TempMaxAge > 0 {
+		tasks = append(tasks, sweepTemp(cfg, jobMgr, uno, captures, reg))
+	}
+
+	// REQUEST_TIMEOUT bounds a synchronous conversion request end to end,
+	// including time queued for a worker.
+	reqTimeout := cfg.RequestTimeout
+
+	// API_KEYS and API_KEYS_FILE enable API-key authentication on the
+	// conversion and job endpoints; the file is re-read on SIGHUP.
+	// Captures are taken inside authentication, which names the client.
+	captured := func(h http.Handler) http.Handler { return h }
+	if captures != nil {
+		captured = func(h http.Handler) http.Handler { return middleware.Capture(captures, h) }
+	}
+	protect := captured
+	if keys := loadKeystore(cfg); keys != nil {
+		protect = func(h http.Handler) http.Handler { return auth.Middleware(keys, captured(h)) }
+	}
+
+	// RATE_LIMIT_PER_MINUTE caps conversion requests per API key (or IP when
+	// unauthenticated); 0 disables it.
+	limit := func(h http.Handler) http.Handler { return h }
+	var limiter *middleware.RateLimiter
+	if cfg.RateLimitPerMinute > 0 {
+		limiter = middleware.NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+		// RATE_LIMIT_REDIS_URL shares the buckets across replicas.
+		if cfg.RateLimitRedisURL != "" {
+			shareRateLimit(limiter, cfg.RateLimitRedisURL, reg)
+		}
+		limit = func(h http.Handler) http.Handler { return middleware.RateLimit(limiter, reg, h) }
+	}
+
+	// MIN_TRANSFER_KBPS cuts off uploads and downloads slower than that over
+	// MIN_TRANSFER_WINDOW, so stalled clients can't hold workers and memory;
+	// 0 disables it.
+	slow := func(h http.Handler) http.Handler { return h }
+	if cfg.MinTransferKBps > 0 {
+		slow = func(h http.Handler) http.Handler {
+			return middleware.MinThroughput(cfg.MinTransferKBps<<10, cfg.MinTransferWindow, reg, h)
+		}
+	}
+
+	// EGRESS_CAP_GB and TENANT_EGRESS_CAPS cap the result bytes each tenant
+	// downloads per month; EGRESS_FILE keeps the month's usage across
+	// restarts, saved every EGRESS_FLUSH_INTERVAL.
+	capped := func(h http.Handler) http.Handler { return h }
+	egressMeter := loadEgress(cfg)
+	if egressMeter != nil {
+		capped = func(h http.Handler) http.Handler { return handler.EgressCap(egressMeter, h) }
+		if cfg.EgressFile != "" {
+			tasks = append(tasks, schedule.Task{
+				Name:     "egress_save",
+				Interval: cfg.EgressFlushInterval,
+				Run:      func(context.Context) error { return egressMeter.Save() },
+			})
+		}
+	}
+
+	// API_V1_DEPRECATED (a date, e.g. 2026-01-31) marks API v1 responses
+	// deprecated from that date, with API_V1_SUNSET as the removal date and
+	// API_V1_DEPRECATION_LINK pointing at the migration notes.
+	deprecate := func(h http.Handler) http.Handler { return h }
+	if !cfg.APIV1Deprecated.IsZero() {
+		d := handler.Deprecation{
+			Feature: "v1",
+			Since:   cfg.APIV1Deprecated,
+			Sunset:  cfg.APIV1Sunset,
+			Link:    cfg.APIV1DeprecationLink,
+		}
+		deprecate = func(h http.Handler) http.Handler {
+			return handler.DeprecatedVersion(handler.V1, d, reg.IncDeprecated, h)
+		}
+	}
+
+	sched := schedule.New(schedule.Config{Tasks: tasks, Observer: reg})
 
 	mux := http.NewServeMux()
-	mux.Handle("/convert", middleware.Metrics(reg, convertHandler))
+	mux.Handle("/convert", deprecate(protect(middleware.Metrics(reg, limit(capped(middleware.Timeout(reqTimeout, slow(convertHandler))))))))
+	mux.Handle("/convert/raw", deprecate(protect(middleware.Metrics(reg, limit(capped(middleware.Timeout(reqTimeout, slow(rawHandler))))))))
+	mux.Handle("/convert/batch", deprecate(protect(middleware.Metrics(reg, limit(capped(middleware.Timeout(reqTimeout, slow(batchHandler))))))))
+	mux.Handle("/split", deprecate(protect(middleware.Metrics(reg, limit(capped(middleware.Timeout(reqTimeout, slow(splitHandler))))))))
+	mux.Handle("/thumbnail", deprecate(protect(middleware.Metrics(reg, limit(capped(middleware.Timeout(reqTimeout, slow(thumbnailHandler))))))))
+	mux.Handle("/extract-text", deprecate(protect(middleware.Metrics(reg, limit(capped(middleware.Timeout(reqTimeout, slow(extractHandler))))))))
+	mux.Handle("/convert/async", deprecate(protect(limit(slow(handler.NewConvertAsync(conv, jobMgr, asyncOpts...))))))
+	mux.Handle("GET /jobs", deprecate(protect(http.HandlerFunc(jobsHandler.List))))
+	mux.Handle("GET /jobs/{id}", deprecate(protect(http.HandlerFunc(jobsHandler.Status))))
+	mux.Handle("GET /jobs/{id}/result", deprecate(protect(capped(slow(http.HandlerFunc(jobsHandler.Result))))))
+	mux.Handle("GET /jobs/{id}/results", deprecate(protect(http.HandlerFunc(jobsHandler.Results))))
+	mux.Handle("GET /jobs/{id}/results/{index}", deprecate(protect(capped(slow(http.HandlerFunc(jobsHandler.ResultEntry))))))
+	mux.Handle("POST /jobs/{id}/feedback", deprecate(protect(http.HandlerFunc(jobsHandler.Feedback))))
+	// GET /limits is authenticated like the conversion endpoints but not
+	// rate limited, so checking the limits never uses them up.
+	mux.Handle("GET /limits", deprecate(protect(handler.NewLimits(policy, limiter, egressMeter))))
+	if fonts != nil {
+		mux.Handle("GET /fonts", deprecate(protect(handler.NewFonts(fonts, fontSubstitutions(cfg)))))
+	}
+	// Admin and debug endpoints exist only when ADMIN_TOKEN is set.
+	if token := cfg.AdminToken; token != "" {
+		mux.Handle("GET /debug/config", middleware.AdminToken(token, cfg))
+	}
+	// DENIAL_AUDIT_SIZE keeps the latest requests refused by the API keys,
+	// admin token, rate limit or type policy, and why, for GET
+	// /admin/denials.
+	audited := func(h http.Handler) http.Handler { return h }
+	if cfg.DenialAuditSize > 0 {
+		denials := audit.NewLog(cfg.DenialAuditSize)
+		audited = func(h http.Handler) http.Handler { return middleware.Audit(denials, reg, h) }
+		if token := cfg.AdminToken; token != "" {
+			mux.Handle("GET /admin/denials", middleware.AdminToken(token, http.HandlerFunc(handler.NewDenials(denials).List)))
+		}
+	}
+	if token := cfg.AdminToken; token != "" && egressMeter != nil {
+		mux.Handle("GET /admin/egress", middleware.AdminToken(token, egressMeter))
+	}
+	if token := cfg.AdminToken; token != "" && captures != nil {
+		capturesHandler := handler.NewCaptures(captures)
+		mux.Handle("POST /admin/captures", middleware.AdminToken(token, http.HandlerFunc(capturesHandler.Arm)))
+		mux.Handle("GET /admin/captures", middleware.AdminToken(token, http.HandlerFunc(capturesHandler.List)))
+		mux.Handle("GET /admin/captures/{id}/body", middleware.AdminToken(token, http.HandlerFunc(capturesHandler.Body)))
+		mux.Handle("DELETE /admin/captures/{id}", middleware.AdminToken(token, http.HandlerFunc(capturesHandler.Delete)))
+	}
+	// PPROF_ENABLED serves CPU, heap, goroutine and other profiles for
+	// diagnosing a live instance.
+	if token := cfg.AdminToken; token != "" && cfg.PprofEnabled {
+		mux.Handle("GET /debug/pprof/", middleware.AdminToken(token, http.HandlerFunc(pprof.Index)))
+		mux.Handle("GET /debug/pprof/cmdline", middleware.AdminToken(token, http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("GET /debug/pprof/profile", middleware.AdminToken(token, http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", middleware.AdminToken(token, http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("GET /debug/pprof/trace", middleware.AdminToken(token, http.HandlerFunc(pprof.Trace)))
+	}
+	if token := cfg.AdminToken; token != "" && hooks != nil {
+		hooksHandler := handler.NewWebhooks(hooks)
+		mux.Handle("GET /admin/webhooks", middleware.AdminToken(token, http.HandlerFunc(hooksHandler.List)))
+		mux.Handle("POST /admin/webhooks/{delivery_id}/redeliver", middleware.AdminToken(token, http.HandlerFunc(hooksHandler.Redeliver)))
+		outboxHandler := handler.NewOutbox(events)
+		mux.Handle("POST /admin/outbox/flush", middleware.AdminToken(token, http.HandlerFunc(outboxHandler.Flush)))
+	}
+	// The unoserver backend's warm LibreOffice processes can be inspected
+	// and, when one is wedged, recycled individually.
+	if token := cfg.AdminToken; token != "" && uno != nil {
+		workersHandler := handler.NewWorkers(uno)
+		mux.Handle("GET /admin/workers", middleware.AdminToken(token, http.HandlerFunc(workersHandler.List)))
+		mux.Handle("POST /admin/workers/{id}/recycle", middleware.AdminToken(token, http.HandlerFunc(workersHandler.Recycle)))
+	}
+	// TEMPLATE_DIR keeps DOCX templates, managed through the admin API at
+	// /templates, that POST /render/bulk fills with each row of a dataset.
+	if cfg.TemplateDir != "" {
+		lib, err := templates.Open(cfg.TemplateDir)
+		if err != nil {
+			fatal("opening template library", err)
+		}
+		bulkOpts := append([]handler.Option(nil), asyncOpts...)
+		if out != nil {
+			bulkOpts = append(bulkOpts, handler.WithSink(out))
+		}
+		bulkHandler := handler.NewBulk(conv, jobMgr, lib, cfg.BatchParallelism, bulkOpts...)
+		mux.Handle("POST /render/bulk", deprecate(protect(middleware.Metrics(reg, limit(slow(bulkHandler))))))
+		mux.Handle("GET /render/bulk/{id}", deprecate(protect(http.HandlerFunc(bulkHandler.Status))))
+
+		token := cfg.AdminToken
+		tmpl := handler.NewTemplates(lib)
+		mux.Handle("GET /templates", middleware.AdminToken(token, http.HandlerFunc(tmpl.List)))
+		mux.Handle("POST /templates", middleware.AdminToken(token, http.HandlerFunc(tmpl.Create)))
+		mux.Handle("GET /templates/{id}", middleware.AdminToken(token, http.HandlerFunc(tmpl.Get)))
+		mux.Handle("PUT /templates/{id}", middleware.AdminToken(token, http.HandlerFunc(tmpl.Update)))
+		mux.Handle("DELETE /templates/{id}", middleware.AdminToken(token, http.HandlerFunc(tmpl.Delete)))
+		mux.Handle("GET /templates/{id}/file", middleware.AdminToken(token, http.HandlerFunc(tmpl.Download)))
+	}
 	mux.HandleFunc("/health", handler.Health)
+	// GET /version and docpdf_build_info report the build and the
+	// LibreOffice it drives, so dashboards can line behavior up with
+	// deployments.
+	reg.SetBuildInfo(build, loVersion)
+	mux.HandleFunc("GET /version", handler.BuildInfo(build, loVersion))
+	mux.HandleFunc("GET /readyz", probes.Ready)
+	mux.HandleFunc("GET /livez", probes.Live)
 	mux.Handle("/metrics", reg)
+	mux.Handle("GET /stats", statsRec)
+	mux.Handle("GET /status", sched)
 
-	addr := ":8080"
-	if p := os.Getenv("PORT"); p != "" {
-		addr = ":" + p
+	addr := ":" + strconv.Itoa(cfg.Port)
+
+	slog.Info("starting server",
+		"version", build.Version,
+		"commit", build.Commit,
+		"libreoffice", loVersion,
+		"addr", addr,
+		"config_file", cfg.File,
+		"log_level", cfg.LogLevel,
+		"soffice", lo.BinaryPath,
+		"backend", cfg.ConverterBackend,
+		"workers", workers,
+		"queue", queueDepth,
+		"request_timeout", reqTimeout.String(),
+		"write_timeout", cfg.WriteTimeout.String(),
+		"rate_per_min", cfg.RateLimitPerMinute,
+		"min_transfer_kbps", cfg.MinTransferKBps,
+		"mem_threshold_pct", cfg.MemoryWatchdogThreshold,
+		"macro_policy", macros,
+		"cache_max_mb", cfg.CacheMaxMB,
+		"output_sink", cfg.OutputSink,
+		"profile_template", cfg.LibreOfficeProfileTemplate,
+		"billing_export", meter != nil,
+		"egress_cap", egressMeter != nil,
+		"tracing", tracer != nil,
+	)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           middleware.RequestID(middleware.HTTPMetrics(reg, middleware.Logging(audited(tracing.Middleware(tracer, handler.Versions(middleware.Route(mux))))))),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		// net/http's own errors, such as TLS handshake failures.
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+	}
+
+	// On SIGINT or SIGTERM, stop accepting connections and give in-flight
+	// requests SHUTDOWN_TIMEOUT to finish, then save stats, export the last
+	// billing period so a deploy loses no usage, and flush queued spans.
+	shutdownTimeout := cfg.ShutdownTimeout
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-term
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("server error", err)
+	}
+	<-drained
+	_ = sched.Close()
+	_ = statsRec.Close()
+	if egressMeter != nil {
+		_ = egressMeter.Save()
 	}
+	if meter != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := meter.Close(ctx); err != nil {
+			logBillingError(err)
+		}
+		cancel()
+	}
+	if tracer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := tracer.Close(ctx); err != nil {
+			logTracingError(err)
+		}
+		cancel()
+	}
+}
+
+// fatal logs err with msg and exits.
+func fatal(msg string, err error) {
+	slog.Log(context.Background(), logging.LevelFatal, msg, "error", err)
+	os.Exit(1)
+}
 
-	startMsg, _ := json.Marshal(map[string]any{
-		"time":    time.Now().UTC().Format(time.RFC3339),
-		"level":   "info",
-		"msg":     "starting server",
-		"addr":    addr,
-		"soffice": conv.BinaryPath,
+// detectLibreOffice returns the version string of lo's binary, or
+// buildinfo.Unknown (logging why) when it cannot be run.
+func detectLibreOffice(lo *converter.LibreOffice) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	v, err := lo.Version(ctx)
+	if err != nil {
+		slog.Warn("could not detect LibreOffice version", "error", err)
+		return buildinfo.Unknown
+	}
+	return v
+}
+
+// scanFonts returns the font families installed for conversions, or nil
+// (logging why) when fc_list_path is empty or fc-list cannot be run.
+func scanFonts(cfg *config.Config) *converter.FontInventory {
+	if cfg.FcListPath == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fonts, err := converter.ScanFonts(ctx, cfg.FcListPath)
+	if err != nil {
+		slog.Warn("could not list installed fonts, missing fonts will not be reported", "error", err)
+		return nil
+	}
+	return fonts
+}
+
+// loadEgress returns the monthly egress meter, or nil when no egress cap
+// or file is configured.
+func loadEgress(cfg *config.Config) *egress.Meter {
+	if cfg.EgressCapGB == 0 && cfg.TenantEgressCaps == "" && cfg.EgressFile == "" {
+		return nil
+	}
+	caps, err := egress.ParseCaps(cfg.TenantEgressCaps)
+	if err != nil {
+		fatal("parsing tenant egress caps", err)
+	}
+	m, err := egress.New(egress.Config{Path: cfg.EgressFile, Cap: int64(cfg.EgressCapGB) << 30, Tenants: caps})
+	if err != nil {
+		slog.Warn("could not load egress file, starting the month empty", "error", err)
+	}
+	return m
+}
+
+// loadBilling returns a meter exporting per-tenant usage every billing
+// interval to the billing export: an http(s) URL is pushed to as JSON (with
+// the billing token as a bearer token), anything else is a CSV file to
+// append to. It returns nil when no export is configured.
+func loadBilling(cfg *config.Config) *billing.Meter {
+	target := cfg.BillingExport
+	if target == "" {
+		return nil
+	}
+	var exp billing.Exporter = billing.CSV{Path: target}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		exp = billing.HTTPPush{
+			URL:    target,
+			Token:  cfg.BillingToken,
+			Client: &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+	return billing.New(billing.Config{
+		Exporter: exp,
+		Interval: cfg.BillingInterval,
+		Pricing: billing.Pricing{
+			PerSecond:     cfg.BillingUnitsPerSecond,
+			PerPage:       cfg.BillingUnitsPerPage,
+			PerConversion: cfg.BillingUnitsPerConversion,
+		},
+		OnError: logBillingError,
 	})
-	fmt.Fprintf(os.Stderr, "%s\n", startMsg)
+}
 
-	chain := middleware.RequestID(middleware.Logging(mux))
-	if err := http.ListenAndServe(addr, chain); err != nil {
-		errMsg, _ := json.Marshal(map[string]any{
-			"time":  time.Now().UTC().Format(time.RFC3339),
-			"level": "fatal",
-			"msg":   "server error",
-			"error": err.Error(),
-		})
-		fmt.Fprintf(os.Stderr, "%s\n", errMsg)
-		os.Exit(1)
+// logBillingError logs a failed usage export; the usage is retried with the
+// next one.
+func logBillingError(err error) {
+	slog.Warn("billing export failed, will retry with the next period", "error", err)
+}
+
+// loadTracer returns a tracer exporting to the OTLP endpoint, or nil when
+// none is configured.
+func loadTracer(cfg *config.Config) *tracing.Tracer {
+	if cfg.OTelExporterOTLPEndpoint == "" {
+		return nil
+	}
+	headers, err := tracing.ParseHeaders(cfg.OTelExporterOTLPHeaders)
+	if err != nil {
+		fatal("parsing OTLP headers", err)
+	}
+	return tracing.New(tracing.Config{
+		Exporter: tracing.OTLP{
+			Endpoint: cfg.OTelExporterOTLPEndpoint,
+			Headers:  headers,
+			Resource: []tracing.Attribute{
+				tracing.String("service.name", cfg.OTelServiceName),
+				tracing.String("service.version", buildinfo.Get().Version),
+			},
+			Client: &http.Client{Timeout: 10 * time.Second},
+		},
+		OnError: logTracingError,
+	})
+}
+
+// logTracingError logs a failed span export; tracing is best effort, so the
+// spans are not retried.
+func logTracingError(err error) {
+	slog.Warn("trace export failed, spans dropped", "error", err)
+}
+
+// loadKeystore builds the API keystore from the api_keys setting
+// ("name:secret,...") and the api_keys_file, and reloads the file on SIGHUP.
+// It returns nil when neither is set, leaving the API open.
+func loadKeystore(cfg *config.Config) *auth.Keystore {
+	path := cfg.APIKeysFile
+	static, err := auth.ParseKeys(cfg.APIKeys)
+	if err == nil && len(static) == 0 && path == "" {
+		return nil
+	}
+	var keys *auth.Keystore
+	if err == nil {
+		keys, err = auth.NewKeystore(static, path)
+	}
+	if err != nil {
+		fatal("loading api keys", err)
+	}
+
+	if path != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := keys.Reload(); err != nil {
+					slog.Warn("could not reload api keys, keeping current set", "error", err)
+					continue
+				}
+				slog.Info("reloaded api keys", "keys", keys.Len())
+			}
+		}()
+	}
+	return keys
+}
+
+// loadProfile builds the LibreOffice profile template from the
+// libreoffice_profile_template setting, a registrymodifications.xcu or
+// profile directory, and font_substitutions ("Calibri=Carlito,..."), a font
+// replacement table added to it. An unset font_substitutions uses
+// converter.DefaultFontSubstitutions; "none" disables it.
+func loadProfile(cfg *config.Config) *converter.ProfileTemplate {
+	var (
+		tmpl *converter.ProfileTemplate
+		err  error
+	)
+	if path := cfg.LibreOfficeProfileTemplate; path != "" {
+		tmpl, err = converter.LoadProfileTemplate(path)
+	}
+	if err == nil {
+		tmpl, err = tmpl.WithFontSubstitutions(fontSubstitutions(cfg))
+	}
+	if err != nil {
+		fatal("loading profile template", err)
+	}
+	return tmpl
+}
+
+// fontSubstitutions returns the font replacement table of the
+// font_substitutions setting.
+func fontSubstitutions(cfg *config.Config) []converter.FontSubstitution {
+	switch v := cfg.FontSubstitutions; v {
+	case "":
+		return converter.DefaultFontSubstitutions
+	case "none":
+		return nil
+	default:
+		fonts, err := converter.ParseFontSubstitutions(v)
+		if err != nil {
+			fatal("parsing font substitutions", err)
+		}
+		return fonts
+	}
+}
+
+// shareRateLimit keeps limiter's buckets in the Redis at redisURL. While
+// Redis fails each replica falls back to its own buckets; that is counted,
+// and logged at most once a minute.
+func shareRateLimit(limiter *middleware.RateLimiter, redisURL string, reg *metrics.Registry) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		fatal("configuring rate limit redis", err)
+	}
+	var lastWarn atomic.Int64
+	limiter.Share(redis.NewBuckets(redis.New(opts), "docpdf:ratelimit:"), func(err error) {
+		reg.IncRateLimitStoreError()
+		now := time.Now().Unix()
+		if last := lastWarn.Load(); now-last >= 60 && lastWarn.CompareAndSwap(last, now) {
+			slog.Warn("rate limit redis failed, limiting per replica", "error", err)
+		}
+	})
+}
+
+// loadSink builds the result sink named by output_sink: "s3" or "gcs" (an
+// S3-compatible bucket configured by the sink_* settings), "dir" (sink_dir),
+// or "" for none.
+func loadSink(cfg *config.Config) sink.Sink {
+	var out sink.Sink
+	var err error
+	switch kind := cfg.OutputSink; kind {
+	case "":
+		return nil
+	case "s3", "gcs":
+		s3 := sink.S3Config{
+			Endpoint:  cfg.SinkEndpoint,
+			Region:    cfg.SinkRegion,
+			Bucket:    cfg.SinkBucket,
+			AccessKey: cfg.SinkAccessKey,
+			SecretKey: cfg.SinkSecretKey,
+			Prefix:    cfg.SinkPrefix,
+			PathStyle: cfg.SinkPathStyle,
+			URLExpiry: cfg.SinkURLTTL,
+		}
+		// GCS takes S3 requests signed with an HMAC key on its XML API.
+		if kind == "gcs" && s3.Endpoint == "" {
+			s3.Endpoint = "https://storage.googleapis.com"
+		}
+		if kind == "gcs" && s3.Region == "" {
+			s3.Region = "auto"
+		}
+		out, err = sink.NewS3(s3)
+	case "dir":
+		out = sink.NewDir(cfg.SinkDir, cfg.SinkBaseURL)
+	}
+	if err != nil {
+		fatal("configuring output sink", err)
+	}
+	return out
+}
+
+// newRouter returns the router over the CONVERTER_BACKENDS, in order. An
+// unoserver backend takes as many conversions at once as it has instances.
+func newRouter(cfg *config.Config, lo *converter.LibreOffice, uno *converter.UnoServer, reg *metrics.Registry) *converter.Router {
+	var routes []converter.Route
+	for _, b := range cfg.ConverterBackends {
+		name, types, _ := strings.Cut(b, ":")
+		rt := converter.Route{Name: name}
+		if types != "" {
+			rt.Types = strings.Split(types, "+")
+		}
+		switch name {
+		case "libreoffice":
+			rt.Conv = lo
+		case "unoserver":
+			rt.Conv, rt.MaxInFlight = uno, cfg.MaxConcurrentConversions
+		case "gotenberg":
+			rt.Conv = &converter.Gotenberg{URL: cfg.GotenbergURL, Timeout: lo.Timeout}
+		case "pandoc":
+			rt.Conv = &converter.Pandoc{BinaryPath: cfg.PandocPath, Engine: cfg.PandocPDFEngine, Timeout: lo.Timeout, Priority: lo.Priority}
+		case "msgraph":
+			rt.Conv = &converter.MSGraph{
+				TenantID:     cfg.MSGraphTenantID,
+				ClientID:     cfg.MSGraphClientID,
+				ClientSecret: cfg.MSGraphClientSecret,
+				DriveID:      cfg.MSGraphDriveID,
+				Folder:       cfg.MSGraphFolder,
+				Timeout:      lo.Timeout,
+			}
+		}
+		routes = append(routes, rt)
+	}
+	router, err := converter.NewRouter(converter.RouterConfig{
+		Routes:           routes,
+		FailureThreshold: cfg.BackendFailureThreshold,
+		Cooldown:         cfg.BackendCooldown,
+		Observer:         reg,
+	})
+	if err != nil {
+		fatal("configuring converter backends", err)
+	}
+	return router
+}
+
+// newCaptures returns the request capture recorder, keeping bodies in
+// CAPTURE_DIR or else a temp directory.
+func newCaptures(cfg *config.Config) *capture.Recorder {
+	dir := cfg.CaptureDir
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", tempclean.Pattern("capture", "")); err != nil {
+			fatal("creating capture directory", err)
+		}
+	}
+	rec, err := capture.New(capture.Config{
+		Dir:      dir,
+		MaxBytes: int64(cfg.CaptureMaxMB) << 20,
+		TTL:      cfg.CaptureTTL,
+		Retain:   cfg.CaptureRetain,
+	})
+	if err != nil {
+		fatal("starting request capture", err)
+	}
+	return rec
+}
+
+// sweepTemp removes orphaned working directories from the temp directory and
+// SCRATCH_DIR once, before any request can make one, and returns the task
+// that keeps doing so. The directories of async jobs and of unoserver
+// instances are in use however old they are. Directories of processes no
+// longer running, such as those of an earlier run that crashed, go once
+// idle for TEMP_ORPHAN_AGE.
+func sweepTemp(cfg *config.Config, jobMgr *jobs.Manager, uno *converter.UnoServer, captures *capture.Recorder, reg *metrics.Registry) schedule.Task {
+	dirs := []string{os.TempDir()}
+	if cfg.ScratchDir != "" {
+		dirs = append(dirs, cfg.ScratchDir)
+	}
+	janitor := tempclean.New(tempclean.Config{
+		Dirs:      dirs,
+		MaxAge:    cfg.TempMaxAge,
+		OrphanAge: cfg.TempOrphanAge,
+		InUse: func() ([]string, error) {
+			inUse, err := jobMgr.Dirs()
+			if uno != nil {
+				inUse = append(inUse, uno.Dirs()...)
+			}
+			if captures != nil {
+				inUse = append(inUse, captures.Dir())
+			}
+			return inUse, err
+		},
+	})
+	run := func(context.Context) error {
+		res, err := janitor.Sweep(time.Now())
+		reg.SetTempReclaimed(res.Bytes)
+		reg.AddTempOrphans(res.Orphans)
+		if res.Dirs > 0 {
+			slog.Info("removed orphaned temp directories", "count", res.Dirs, "of_dead_processes", res.Orphans, "bytes", res.Bytes)
+		}
+		return err
+	}
+	if err := run(context.Background()); err != nil {
+		slog.Warn("sweeping temp directories", "error", err)
 	}
+	return schedule.Task{Name: "temp_sweep", Interval: min(cfg.TempMaxAge/4, 10*time.Minute), Run: run}
 }
@@ -0,0 +1,141 @@
+// Package audit keeps a bounded, queryable log of access decisions that
+// denied a request: which client was refused, by which policy, why, and how
+// much of its quota was left, so support can answer "why did I get a 429"
+// without digging through logs.
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// Policies a request can be denied by.
+const (
+	PolicyAPIKey     = "api_key"
+	PolicyAdminToken = "admin_token"
+	PolicyRateLimit  = "rate_limit"
+	PolicyTypes      = "type_policy"
+	PolicyEgressCap  = "egress_cap"
+)
+
+// Reasons a request is denied.
+const (
+	ReasonMissingKey        = "missing_api_key"
+	ReasonInvalidKey        = "invalid_api_key"
+	ReasonKeyDisabled       = "api_key_disabled"
+	ReasonKeyExpired        = "api_key_expired"
+	ReasonKeyRequired       = "api_key_required"
+	ReasonInvalidAdminToken = "invalid_admin_token"
+	ReasonRateLimited       = "rate_limited"
+	ReasonTypeNotAllowed    = "type_not_allowed"
+	ReasonEgressCapped      = "egress_cap_exceeded"
+)
+
+// Denial is what the policy that refused a request knows about it.
+type Denial struct {
+	// Status is the HTTP status the request was refused with.
+	Status int    `json:"status"`
+	Policy string `json:"policy"`
+	Reason string `json:"reason"`
+	// Detail adds what was refused, such as the document type or when the
+	// key expired.
+	Detail string `json:"detail,omitempty"`
+	// Quota is set for rate limit denials.
+	Quota *Quota `json:"quota,omitempty"`
+}
+
+// Quota is the rate limit a request was counted against, as it stood when
+// the request was refused.
+type Quota struct {
+	// PerMinute and Burst are the client's limit.
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+	// Remaining is the requests the client could still make.
+	Remaining int `json:"remaining"`
+	// RetryAfter is the wait, in seconds, sent in Retry-After.
+	RetryAfter int `json:"retry_after_seconds"`
+	// By is how the client was identified: "key" or "ip".
+	By string `json:"by"`
+}
+
+// Record is one denied request.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Client is the API key name, when the request had a known key.
+	Client string `json:"client,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	IP     string `json:"ip"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Denial
+}
+
+// Filter selects records. Empty fields match every record.
+type Filter struct {
+	Client string
+	Tenant string
+	IP     string
+	Policy string
+	Reason string
+	// Since excludes records made before it.
+	Since time.Time
+	// Limit caps the records returned; 0 returns all that match.
+	Limit int
+}
+
+func (f Filter) match(rec Record) bool {
+	return (f.Client == "" || rec.Client == f.Client) &&
+		(f.Tenant == "" || rec.Tenant == f.Tenant) &&
+		(f.IP == "" || rec.IP == f.IP) &&
+		(f.Policy == "" || rec.Policy == f.Policy) &&
+		(f.Reason == "" || rec.Reason == f.Reason) &&
+		!rec.Time.Before(f.Since)
+}
+
+// Log holds the latest denials, up to a fixed number; the oldest are dropped
+// first. It is safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	recs []Record // ring buffer
+	next int      // index the next record goes to
+	full bool
+}
+
+// NewLog returns a Log keeping the last size records (min 1).
+func NewLog(size int) *Log {
+	return &Log{recs: make([]Record, max(size, 1))}
+}
+
+// Add records a denial.
+func (l *Log) Add(rec Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recs[l.next] = rec
+	l.next++
+	if l.next == len(l.recs) {
+		l.next, l.full = 0, true
+	}
+}
+
+// List returns the records matching f, newest first.
+func (l *Log) List(f Filter) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.recs)
+	}
+	var out []Record
+	for i := range n {
+		rec := l.recs[(l.next-1-i+len(l.recs))%len(l.recs)]
+		if !f.match(rec) {
+			continue
+		}
+		out = append(out, rec)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package audit_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+)
+
+func TestLog_KeepsNewest(t *testing.T) {
+	l := audit.NewLog(3)
+	for i := range 5 {
+		l.Add(audit.Record{RequestID: fmt.Sprint(i)})
+	}
+	got := l.List(audit.Filter{})
+	if len(got) != 3 || got[0].RequestID != "4" || got[2].RequestID != "2" {
+		t.Fatalf("List = %+v, want 4, 3, 2", got)
+	}
+}
+
+func TestLog_Filter(t *testing.T) {
+	l := audit.NewLog(10)
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	l.Add(audit.Record{Time: start, Client: "acme", IP: "10.0.0.1",
+		Denial: audit.Denial{Policy: audit.PolicyRateLimit, Reason: audit.ReasonRateLimited}})
+	l.Add(audit.Record{Time: start.Add(time.Minute), IP: "10.0.0.2",
+		Denial: audit.Denial{Policy: audit.PolicyAPIKey, Reason: audit.ReasonInvalidKey}})
+	l.Add(audit.Record{Time: start.Add(2 * time.Minute), Client: "acme", Tenant: "t1", IP: "10.0.0.1",
+		Denial: audit.Denial{Policy: audit.PolicyTypes, Reason: audit.ReasonTypeNotAllowed}})
+
+	for _, tc := range []struct {
+		name   string
+		filter audit.Filter
+		want   int
+	}{
+		{"all", audit.Filter{}, 3},
+		{"client", audit.Filter{Client: "acme"}, 2},
+		{"tenant", audit.Filter{Tenant: "t1"}, 1},
+		{"ip", audit.Filter{IP: "10.0.0.2"}, 1},
+		{"policy", audit.Filter{Policy: audit.PolicyRateLimit}, 1},
+		{"reason", audit.Filter{Reason: audit.ReasonInvalidKey}, 1},
+		{"since", audit.Filter{Since: start.Add(time.Minute)}, 2},
+		{"limit", audit.Filter{Client: "acme", Limit: 1}, 1},
+	} {
+		if got := l.List(tc.filter); len(got) != tc.want {
+			t.Errorf("%s: %d records, want %d", tc.name, len(got), tc.want)
+		}
+	}
+	if got := l.List(audit.Filter{Limit: 1}); got[0].Reason != audit.ReasonTypeNotAllowed {
+		t.Errorf("newest record %+v", got[0])
+	}
+}
@@ -0,0 +1,240 @@
+// Package auth authenticates API clients by key. Keys come from the
+// environment, a JSON file, or both, and the file can be reloaded without a
+// restart.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// Key is an API key and the client it identifies.
+type Key struct {
+	// Name identifies the client in logs and metrics. It is never the secret.
+	Name string `json:"name"`
+	// Secret is the value clients send.
+	Secret string `json:"key"`
+	// Tenant, when set, is the tenant the client's requests are made for,
+	// overriding any X-Tenant-ID header.
+	Tenant string `json:"tenant,omitempty"`
+	// Disabled keys are recognised but refused with 403, so a revoked client
+	// still shows up by name in logs.
+	Disabled bool `json:"disabled,omitempty"`
+	// ExpiresAt, when non-zero, is when the key stops being accepted (403).
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Watermark, when set, is stamped on the client's PDFs unless a request
+	// brings its own.
+	Watermark *Watermark `json:"watermark,omitempty"`
+}
+
+// Watermark is a key's default watermark. Text may use the placeholders
+// {client}, {tenant}, {date} and {time}.
+type Watermark struct {
+	Text string `json:"text,omitempty"`
+	// Image is the path of a PNG or JPEG, relative to the key file.
+	Image    string  `json:"image,omitempty"`
+	Position string  `json:"position,omitempty"`
+	Opacity  float64 `json:"opacity,omitempty"`
+
+	// ImageData is Image's content, read when the keys are loaded.
+	ImageData []byte `json:"-"`
+}
+
+// load checks the watermark and reads its image, resolving the path
+// against dir.
+func (wm *Watermark) load(dir string) error {
+	if wm.Text == "" && wm.Image == "" {
+		return errors.New("needs text or an image")
+	}
+	if _, err := pdfpost.ParsePosition(wm.Position); err != nil {
+		return err
+	}
+	if wm.Opacity < 0 || wm.Opacity > 1 {
+		return fmt.Errorf("opacity %v not between 0 and 1", wm.Opacity)
+	}
+	if wm.Image == "" {
+		return nil
+	}
+	path := wm.Image
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := pdfpost.CheckImage(data); err != nil {
+		return fmt.Errorf("%s: %w", wm.Image, err)
+	}
+	wm.ImageData = data
+	return nil
+}
+
+// Keystore holds the accepted keys. It is safe for concurrent use; Reload
+// swaps the whole set atomically.
+type Keystore struct {
+	static []Key
+	path   string
+	keys   atomic.Pointer[map[[sha256.Size]byte]Key]
+}
+
+// NewKeystore returns a Keystore with static keys plus those in the JSON file
+// at path (an array of Key objects), if path is non-empty.
+func NewKeystore(static []Key, path string) (*Keystore, error) {
+	ks := &Keystore{static: static, path: path}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload re-reads the key file. On error the current keys stay in effect.
+func (ks *Keystore) Reload() error {
+	keys := append([]Key(nil), ks.static...)
+	if ks.path != "" {
+		data, err := os.ReadFile(ks.path)
+		if err != nil {
+			return fmt.Errorf("auth: reading key file: %w", err)
+		}
+		var fromFile []Key
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return fmt.Errorf("auth: parsing key file: %w", err)
+		}
+		keys = append(keys, fromFile...)
+	}
+
+	set := make(map[[sha256.Size]byte]Key, len(keys))
+	names := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.Name == "" || k.Secret == "" {
+			return fmt.Errorf("auth: key %q needs a name and a secret", k.Name)
+		}
+		if k.Watermark != nil {
+			if err := k.Watermark.load(filepath.Dir(ks.path)); err != nil {
+				return fmt.Errorf("auth: key %q watermark: %w", k.Name, err)
+			}
+		}
+		if names[k.Name] {
+			return fmt.Errorf("auth: duplicate key name %q", k.Name)
+		}
+		sum := sha256.Sum256([]byte(k.Secret))
+		if _, dup := set[sum]; dup {
+			return fmt.Errorf("auth: key %q reuses another key's secret", k.Name)
+		}
+		names[k.Name] = true
+		set[sum] = k
+	}
+	ks.keys.Store(&set)
+	return nil
+}
+
+// Len returns the number of keys loaded.
+func (ks *Keystore) Len() int { return len(*ks.keys.Load()) }
+
+// Lookup returns the key with the given secret. Secrets are compared by
+// SHA-256 digest, so lookup time doesn't depend on how much of a guess
+// matches.
+func (ks *Keystore) Lookup(secret string) (Key, bool) {
+	k, ok := (*ks.keys.Load())[sha256.Sum256([]byte(secret))]
+	return k, ok
+}
+
+// ParseKeys parses comma-separated "name:secret" pairs, as in the API_KEYS
+// environment variable. A malformed pair is reported by its position, never
+// its text, which may be a bare secret.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for i, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, secret, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || secret == "" {
+			return nil, fmt.Errorf("auth: malformed key at entry %d, want name:secret", i+1)
+		}
+		keys = append(keys, Key{Name: name, Secret: secret})
+	}
+	return keys, nil
+}
+
+type contextKey struct{}
+
+// FromContext returns the key a request authenticated with.
+func FromContext(ctx context.Context) (Key, bool) {
+	k, ok := ctx.Value(contextKey{}).(Key)
+	return k, ok
+}
+
+// Middleware requires a valid key in "Authorization: Bearer <key>" or
+// "X-API-Key: <key>". A missing or unknown key gets 401, a disabled or
+// expired one 403. The key's name labels the request's log line and metrics.
+func Middleware(ks *Keystore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := credential(r)
+		if secret == "" {
+			middleware.SetLogError(r.Context(), "missing api key")
+			middleware.Deny(r.Context(), audit.Denial{Status: http.StatusUnauthorized, Policy: audit.PolicyAPIKey, Reason: audit.ReasonMissingKey})
+			reject(w, r, http.StatusUnauthorized, "missing api key")
+			return
+		}
+		k, ok := ks.Lookup(secret)
+		if !ok {
+			middleware.SetLogError(r.Context(), "invalid api key")
+			middleware.Deny(r.Context(), audit.Denial{Status: http.StatusUnauthorized, Policy: audit.PolicyAPIKey, Reason: audit.ReasonInvalidKey})
+			reject(w, r, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		middleware.SetClient(r.Context(), k.Name)
+		middleware.SetTenant(r.Context(), k.Tenant)
+		switch {
+		case k.Disabled:
+			middleware.SetLogError(r.Context(), "api key disabled")
+			middleware.Deny(r.Context(), audit.Denial{Status: http.StatusForbidden, Policy: audit.PolicyAPIKey, Reason: audit.ReasonKeyDisabled})
+			reject(w, r, http.StatusForbidden, "api key disabled")
+			return
+		case !k.ExpiresAt.IsZero() && !time.Now().Before(k.ExpiresAt):
+			middleware.SetLogError(r.Context(), "api key expired")
+			middleware.Deny(r.Context(), audit.Denial{Status: http.StatusForbidden, Policy: audit.PolicyAPIKey, Reason: audit.ReasonKeyExpired,
+				Detail: "expired " + k.ExpiresAt.UTC().Format(time.RFC3339)})
+			reject(w, r, http.StatusForbidden, "api key expired")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, k)))
+	})
+}
+
+// credential returns the key sent with r, or "".
+func credential(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func reject(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	msg = i18n.Localize(w, r, msg)
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
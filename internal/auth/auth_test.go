@@ -0,0 +1,225 @@
+package auth_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func newKeystore(t *testing.T, keys ...auth.Key) *auth.Keystore {
+	t.Helper()
+	ks, err := auth.NewKeystore(keys, "")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	return ks
+}
+
+func TestMiddleware(t *testing.T) {
+	ks := newKeystore(t,
+		auth.Key{Name: "team-a", Secret: "s3cret-a", Tenant: "acme"},
+		auth.Key{Name: "revoked", Secret: "s3cret-r", Disabled: true},
+		auth.Key{Name: "old", Secret: "s3cret-o", ExpiresAt: time.Now().Add(-time.Hour)},
+	)
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"bearer", "Authorization", "Bearer s3cret-a", http.StatusOK},
+		{"x-api-key", "X-API-Key", "s3cret-a", http.StatusOK},
+		{"missing", "", "", http.StatusUnauthorized},
+		{"unknown", "X-API-Key", "guess", http.StatusUnauthorized},
+		{"wrong scheme", "Authorization", "Basic s3cret-a", http.StatusUnauthorized},
+		{"disabled", "X-API-Key", "s3cret-r", http.StatusForbidden},
+		{"expired", "X-API-Key", "s3cret-o", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got auth.Key
+			h := auth.Middleware(ks, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = auth.FromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+			if tc.want == http.StatusOK {
+				if got.Name != "team-a" || got.Tenant != "acme" {
+					t.Errorf("unexpected key in context: %+v", got)
+				}
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["error"] == "" {
+				t.Errorf("expected JSON error body, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_AuditsDenials(t *testing.T) {
+	ks := newKeystore(t,
+		auth.Key{Name: "revoked", Secret: "s3cret-r", Tenant: "acme", Disabled: true},
+		auth.Key{Name: "old", Secret: "s3cret-o", ExpiresAt: time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+	)
+	log := audit.NewLog(10)
+	h := middleware.RequestID(middleware.Audit(log, metrics.New(),
+		auth.Middleware(ks, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	for _, secret := range []string{"", "guess", "s3cret-r", "s3cret-o"} {
+		req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+		req.Header.Set("X-API-Key", secret)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recs := log.List(audit.Filter{Policy: audit.PolicyAPIKey})
+	if len(recs) != 4 {
+		t.Fatalf("expected 4 denials, got %+v", recs)
+	}
+	// Newest first.
+	want := []struct{ client, tenant, reason string }{
+		{"old", "", audit.ReasonKeyExpired},
+		{"revoked", "acme", audit.ReasonKeyDisabled},
+		{"", "", audit.ReasonInvalidKey},
+		{"", "", audit.ReasonMissingKey},
+	}
+	for i, w := range want {
+		if recs[i].Client != w.client || recs[i].Tenant != w.tenant || recs[i].Reason != w.reason {
+			t.Errorf("record %d = %+v, want %+v", i, recs[i], w)
+		}
+	}
+	if recs[0].Detail != "expired 2026-01-31T00:00:00Z" {
+		t.Errorf("expiry detail %q", recs[0].Detail)
+	}
+}
+
+func TestKeystore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"name":"team-b","key":"file-secret"}]`)
+	ks, err := auth.NewKeystore([]auth.Key{{Name: "env", Secret: "env-secret"}}, path)
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if _, ok := ks.Lookup("file-secret"); !ok {
+		t.Fatal("expected key from file")
+	}
+
+	write(`[{"name":"team-b","key":"rotated"}]`)
+	if err := ks.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, ok := ks.Lookup("file-secret"); ok {
+		t.Error("old secret still accepted after reload")
+	}
+	if k, ok := ks.Lookup("rotated"); !ok || k.Name != "team-b" {
+		t.Error("rotated secret not accepted after reload")
+	}
+	if _, ok := ks.Lookup("env-secret"); !ok {
+		t.Error("static key lost on reload")
+	}
+
+	// A broken file keeps the current keys.
+	write(`not json`)
+	if err := ks.Reload(); err == nil {
+		t.Fatal("expected error for malformed file")
+	}
+	if _, ok := ks.Lookup("rotated"); !ok {
+		t.Error("keys dropped after failed reload")
+	}
+}
+
+func TestKeystore_RejectsDuplicates(t *testing.T) {
+	cases := map[string][]auth.Key{
+		"duplicate name":   {{Name: "a", Secret: "x"}, {Name: "a", Secret: "y"}},
+		"duplicate secret": {{Name: "a", Secret: "x"}, {Name: "b", Secret: "x"}},
+		"empty secret":     {{Name: "a"}},
+	}
+	for name, keys := range cases {
+		if _, err := auth.NewKeystore(keys, ""); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := auth.ParseKeys("team-a:one, team-b:two:with-colon")
+	if err != nil {
+		t.Fatalf("ParseKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Name != "team-a" || keys[1].Secret != "two:with-colon" {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+	if _, err := auth.ParseKeys("no-secret"); err == nil {
+		t.Error("expected error for missing secret")
+	}
+	// An entry without a colon may be a bare secret; it must not be echoed.
+	_, err = auth.ParseKeys("team-a:one, sk-live-0123456789")
+	if err == nil || strings.Contains(err.Error(), "sk-live") || !strings.Contains(err.Error(), "entry 2") {
+		t.Errorf("got %v, want the position without the secret", err)
+	}
+}
+
+func TestKeystore_Watermark(t *testing.T) {
+	dir := t.TempDir()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stamp.png"), img.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "keys.json")
+	load := func(watermark string) (*auth.Keystore, error) {
+		keys := `[{"name":"team-b","key":"secret","watermark":` + watermark + `}]`
+		if err := os.WriteFile(path, []byte(keys), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return auth.NewKeystore(nil, path)
+	}
+
+	ks, err := load(`{"text":"{client} only","image":"stamp.png","position":"top"}`)
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	k, _ := ks.Lookup("secret")
+	if wm := k.Watermark; wm == nil || wm.Text != "{client} only" || !bytes.Equal(wm.ImageData, img.Bytes()) {
+		t.Errorf("watermark not loaded with its image: %+v", k.Watermark)
+	}
+
+	for _, bad := range []string{
+		`{}`,
+		`{"text":"x","position":"sideways"}`,
+		`{"text":"x","opacity":1.5}`,
+		`{"image":"missing.png"}`,
+		`{"image":"keys.json"}`,
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected an error for watermark %s", bad)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package billing meters conversions per tenant and periodically exports the
+// usage, so finance integrations get billable totals without scraping
+// Prometheus. Usage is priced by conversion time, with optional per-page and
+// per-conversion components.
+package billing
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTenant is the tenant usage is billed to when a request has none.
+const DefaultTenant = "default"
+
+// Usage is one tenant's metered usage over an export period.
+type Usage struct {
+	Tenant      string    `json:"tenant"`
+	Start       time.Time `json:"period_start"`
+	End         time.Time `json:"period_end"`
+	Conversions int64     `json:"conversions"`
+	Pages       int64     `json:"pages"`
+	InputBytes  int64     `json:"input_bytes"`
+	OutputBytes int64     `json:"output_bytes"`
+	Seconds     float64   `json:"conversion_seconds"`
+	CostUnits   float64   `json:"cost_units"`
+}
+
+// Event is one successful conversion.
+type Event struct {
+	Tenant      string
+	Duration    time.Duration
+	Pages       int
+	InputBytes  int64
+	OutputBytes int64
+}
+
+// Pricing turns usage into cost units.
+type Pricing struct {
+	PerSecond     float64 // per second of conversion time
+	PerPage       float64 // per output page
+	PerConversion float64 // per conversion
+}
+
+// cost returns the cost units of u.
+func (p Pricing) cost(u Usage) float64 {
+	return p.PerSecond*u.Seconds + p.PerPage*float64(u.Pages) + p.PerConversion*float64(u.Conversions)
+}
+
+// Exporter delivers a period's usage somewhere finance can pick it up.
+type Exporter interface {
+	Export(ctx context.Context, usage []Usage) error
+}
+
+// Config configures a Meter.
+type Config struct {
+	Exporter Exporter
+	// Interval is how often usage is exported. Zero disables periodic
+	// exports; Close still exports.
+	Interval time.Duration
+	Pricing  Pricing
+	// OnError, if set, is told about failed exports. The usage is kept and
+	// included in the next export.
+	OnError func(error)
+}
+
+// Meter accumulates usage per tenant between exports.
+type Meter struct {
+	cfg Config
+
+	mu      sync.Mutex
+	start   time.Time
+	tenants map[string]*Usage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a Meter exporting to cfg.Exporter. Call Close to stop periodic
+// exports and export what is left.
+func New(cfg Config) *Meter {
+	m := &Meter{
+		cfg:     cfg,
+		start:   time.Now(),
+		tenants: make(map[string]*Usage),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cfg.Interval > 0 {
+		go m.exportLoop()
+	} else {
+		close(m.done)
+	}
+	return m
+}
+
+// Estimate returns the cost units of one conversion taking d, before its
+// pages, which are only known once it is done, are priced.
+func (m *Meter) Estimate(d time.Duration) float64 {
+	return m.cfg.Pricing.cost(Usage{Conversions: 1, Seconds: d.Seconds()})
+}
+
+// Record adds a conversion to its tenant's usage.
+func (m *Meter) Record(e Event) {
+	if e.Tenant == "" {
+		e.Tenant = DefaultTenant
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.tenants[e.Tenant]
+	if !ok {
+		u = &Usage{Tenant: e.Tenant}
+		m.tenants[e.Tenant] = u
+	}
+	u.Conversions++
+	u.Pages += int64(e.Pages)
+	u.InputBytes += e.InputBytes
+	u.OutputBytes += e.OutputBytes
+	u.Seconds += e.Duration.Seconds()
+}
+
+// Export sends the usage accumulated since the last successful export, one
+// entry per tenant sorted by tenant, and starts a new period. Nothing is
+// sent for a period without conversions. On failure the usage is kept, so
+// the next export covers both periods.
+func (m *Meter) Export(ctx context.Context) error {
+	m.mu.Lock()
+	start, end := m.start, time.Now()
+	tenants := m.tenants
+	m.start, m.tenants = end, make(map[string]*Usage)
+	m.mu.Unlock()
+
+	if len(tenants) == 0 {
+		return nil
+	}
+	usage := make([]Usage, 0, len(tenants))
+	for _, u := range tenants {
+		u.Start, u.End = start, end
+		u.CostUnits = m.cfg.Pricing.cost(*u)
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Tenant < usage[j].Tenant })
+
+	err := m.cfg.Exporter.Export(ctx, usage)
+	if err != nil {
+		m.restore(start, tenants)
+	}
+	return err
+}
+
+// restore merges unexported usage back into the current period, which then
+// starts where the unexported one did.
+func (m *Meter) restore(start time.Time, tenants map[string]*Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start = start
+	for name, old := range tenants {
+		u, ok := m.tenants[name]
+		if !ok {
+			m.tenants[name] = old
+			continue
+		}
+		u.Conversions += old.Conversions
+		u.Pages += old.Pages
+		u.InputBytes += old.InputBytes
+		u.OutputBytes += old.OutputBytes
+		u.Seconds += old.Seconds
+	}
+}
+
+// Close stops periodic exports and exports a final time.
+func (m *Meter) Close(ctx context.Context) error {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+	return m.Export(ctx)
+}
+
+func (m *Meter) exportLoop() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Interval)
+			if err := m.Export(ctx); err != nil && m.cfg.OnError != nil {
+				m.cfg.OnError(err)
+			}
+			cancel()
+		}
+	}
+}
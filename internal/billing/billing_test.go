@@ -0,0 +1,116 @@
+package billing_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/billing"
+)
+
+// recorder is an Exporter that keeps what it was given and can be told to
+// fail.
+type recorder struct {
+	mu      sync.Mutex
+	exports [][]billing.Usage
+	err     error
+}
+
+func (r *recorder) Export(_ context.Context, usage []billing.Usage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.exports = append(r.exports, usage)
+	return nil
+}
+
+func TestMeter_AggregatesPerTenant(t *testing.T) {
+	rec := &recorder{}
+	m := billing.New(billing.Config{Exporter: rec, Pricing: billing.Pricing{PerSecond: 2, PerPage: 0.5}})
+	m.Record(billing.Event{Tenant: "acme", Duration: time.Second, Pages: 3, InputBytes: 100, OutputBytes: 1000})
+	m.Record(billing.Event{Tenant: "acme", Duration: 2 * time.Second, Pages: 1, InputBytes: 50, OutputBytes: 500})
+	m.Record(billing.Event{Duration: time.Second})
+
+	if err := m.Export(context.Background()); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(rec.exports) != 1 || len(rec.exports[0]) != 2 {
+		t.Fatalf("expected one export with two tenants, got %+v", rec.exports)
+	}
+	acme, def := rec.exports[0][0], rec.exports[0][1]
+	if acme.Tenant != "acme" || def.Tenant != billing.DefaultTenant {
+		t.Fatalf("unexpected tenants %q, %q", acme.Tenant, def.Tenant)
+	}
+	if acme.Conversions != 2 || acme.Pages != 4 || acme.InputBytes != 150 || acme.OutputBytes != 1500 || acme.Seconds != 3 {
+		t.Errorf("unexpected acme usage %+v", acme)
+	}
+	if acme.CostUnits != 2*3+0.5*4 {
+		t.Errorf("cost units = %v, want 8", acme.CostUnits)
+	}
+	if acme.Start.IsZero() || !acme.End.After(acme.Start) {
+		t.Errorf("bad period %v – %v", acme.Start, acme.End)
+	}
+
+	// The next period starts empty and exports nothing.
+	if err := m.Export(context.Background()); err != nil || len(rec.exports) != 1 {
+		t.Errorf("expected no export for an empty period, got %v, %d exports", err, len(rec.exports))
+	}
+}
+
+func TestMeter_FailedExportIsRetried(t *testing.T) {
+	rec := &recorder{err: errors.New("endpoint down")}
+	m := billing.New(billing.Config{Exporter: rec})
+	m.Record(billing.Event{Tenant: "acme", Duration: time.Second})
+	if err := m.Export(context.Background()); err == nil {
+		t.Fatal("expected the export error")
+	}
+	first := time.Now()
+
+	m.Record(billing.Event{Tenant: "acme", Duration: time.Second})
+	rec.err = nil
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(rec.exports) != 1 || len(rec.exports[0]) != 1 {
+		t.Fatalf("expected one export, got %+v", rec.exports)
+	}
+	u := rec.exports[0][0]
+	if u.Conversions != 2 || u.Seconds != 2 {
+		t.Errorf("expected both periods' usage, got %+v", u)
+	}
+	if !u.Start.Before(first) {
+		t.Errorf("period should start with the unexported one, got %v", u.Start)
+	}
+}
+
+func TestMeter_Estimate(t *testing.T) {
+	m := billing.New(billing.Config{Exporter: &recorder{}, Pricing: billing.Pricing{PerSecond: 2, PerPage: 0.5, PerConversion: 1}})
+	if got := m.Estimate(1500 * time.Millisecond); got != 4 {
+		t.Errorf("Estimate = %v, want 4", got)
+	}
+}
+
+func TestMeter_ExportsPeriodically(t *testing.T) {
+	rec := &recorder{}
+	m := billing.New(billing.Config{Exporter: rec, Interval: 10 * time.Millisecond})
+	defer m.Close(context.Background())
+	m.Record(billing.Event{Tenant: "acme", Duration: time.Second})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		n := len(rec.exports)
+		rec.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("usage was never exported")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,87 @@
+package billing_test
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/billing"
+)
+
+func sampleUsage() []billing.Usage {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	return []billing.Usage{{
+		Tenant: "acme", Start: start, End: start.Add(time.Hour),
+		Conversions: 2, Pages: 4, InputBytes: 150, OutputBytes: 1500, Seconds: 3, CostUnits: 8,
+	}}
+}
+
+func TestCSV_AppendsWithHeaderOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.csv")
+	exp := billing.CSV{Path: path}
+	for range 2 {
+		if err := exp.Export(context.Background(), sampleUsage()); err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "period_start" {
+		t.Fatalf("expected a header and two rows, got %v", rows)
+	}
+	want := []string{"2026-10-01T00:00:00Z", "2026-10-01T01:00:00Z", "acme", "2", "4", "150", "1500", "3.000", "8.0000"}
+	for i, v := range want {
+		if rows[1][i] != v {
+			t.Errorf("column %s = %q, want %q", rows[0][i], rows[1][i], v)
+		}
+	}
+}
+
+func TestHTTPPush(t *testing.T) {
+	var got struct {
+		Usage []billing.Usage `json:"usage"`
+	}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	exp := billing.HTTPPush{URL: srv.URL, Token: "s3cret"}
+	if err := exp.Export(context.Background(), sampleUsage()); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if auth != "Bearer s3cret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if len(got.Usage) != 1 || got.Usage[0].Tenant != "acme" || got.Usage[0].CostUnits != 8 {
+		t.Errorf("unexpected body %+v", got)
+	}
+}
+
+func TestHTTPPush_FailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if err := (billing.HTTPPush{URL: srv.URL}).Export(context.Background(), sampleUsage()); err == nil {
+		t.Fatal("expected an error for a 502")
+	}
+}
@@ -0,0 +1,77 @@
+package billing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// pageObject matches a page object's type entry, "/Type /Page", but not the
+// "/Type /Pages" of the page tree nodes.
+var pageObject = []byte("/Page")
+
+// CountPDFPages counts the page objects in a PDF read from r. It scans the
+// file rather than parsing it, which is exact for the uncompressed object
+// layout LibreOffice writes but misses pages hidden in compressed object
+// streams.
+func CountPDFPages(r io.Reader) (int, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var (
+		pages   int
+		pending bool // saw "/Type", waiting for its value
+	)
+	for {
+		tok, err := nextName(br)
+		if len(tok) > 0 {
+			switch {
+			case bytes.Equal(tok, []byte("/Type")):
+				pending = true
+				continue
+			case pending && bytes.Equal(tok, pageObject):
+				pages++
+			}
+			pending = false
+		}
+		if err == io.EOF {
+			return pages, nil
+		}
+		if err != nil {
+			return pages, err
+		}
+	}
+}
+
+// nextName returns the next PDF name token ("/Something") in br, skipping
+// everything else.
+func nextName(br *bufio.Reader) ([]byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c != '/' {
+			continue
+		}
+		name := []byte{'/'}
+		for {
+			c, err := br.ReadByte()
+			if err != nil {
+				return name, err
+			}
+			if isDelimiter(c) {
+				_ = br.UnreadByte()
+				return name, nil
+			}
+			name = append(name, c)
+		}
+	}
+}
+
+// isDelimiter reports whether c ends a PDF name.
+func isDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '/', '<', '>', '[', ']', '(', ')', '{', '}', '%':
+		return true
+	}
+	return false
+}
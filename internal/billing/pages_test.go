@@ -0,0 +1,39 @@
+package billing_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/billing"
+)
+
+func TestCountPDFPages(t *testing.T) {
+	cases := map[string]struct {
+		pdf  string
+		want int
+	}{
+		"three pages": {`%PDF-1.4
+1 0 obj <</Type /Catalog /Pages 2 0 R>> endobj
+2 0 obj <</Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3>> endobj
+3 0 obj <</Type /Page /Parent 2 0 R>> endobj
+4 0 obj <</Type/Page/Parent 2 0 R>> endobj
+5 0 obj
+<</Type
+/Page /Parent 2 0 R>>
+endobj
+%%EOF`, 3},
+		"no pages":  {"%PDF-1.4\n<</Type /Pages /Count 0>>", 0},
+		"not a pdf": {"hello world", 0},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := billing.CountPDFPages(strings.NewReader(tc.pdf))
+			if err != nil {
+				t.Fatalf("CountPDFPages: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %d pages, want %d", got, tc.want)
+			}
+		})
+	}
+}
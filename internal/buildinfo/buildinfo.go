@@ -0,0 +1,78 @@
+// Package buildinfo describes the running binary: its version, the commit it
+// was built from and when. Release builds stamp these with
+//
+//	go build -ldflags "-X github.com/BRO3886/go-docpdf/internal/buildinfo.version=1.4.0
+//	    -X github.com/BRO3886/go-docpdf/internal/buildinfo.commit=$(git rev-parse HEAD)
+//	    -X github.com/BRO3886/go-docpdf/internal/buildinfo.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Anything left unstamped is taken from the VCS information the Go
+// toolchain embeds when building inside a git checkout.
+package buildinfo
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Set with -ldflags -X.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info describes a build.
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// BuildTime is when the binary was built if stamped, or else the time
+	// of the commit it was built from.
+	BuildTime time.Time `json:"build_time,omitzero"`
+	// Modified is true when the binary was built from a checkout with
+	// uncommitted changes.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Unknown stands in for a version or commit that could not be determined.
+const Unknown = "unknown"
+
+// Get returns the running binary's build information.
+func Get() Info {
+	bi, _ := debug.ReadBuildInfo()
+	return From(bi)
+}
+
+// From combines the values stamped with -ldflags with those embedded in bi,
+// preferring the stamped ones. bi may be nil.
+func From(bi *debug.BuildInfo) Info {
+	info := Info{Version: version, Commit: commit}
+	info.BuildTime, _ = time.Parse(time.RFC3339, date)
+	if bi != nil {
+		info.GoVersion = bi.GoVersion
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime.IsZero() {
+					info.BuildTime, _ = time.Parse(time.RFC3339, s.Value)
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true" && commit == ""
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = Unknown
+	}
+	if info.Commit == "" {
+		info.Commit = Unknown
+	}
+	return info
+}
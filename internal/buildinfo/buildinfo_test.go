@@ -0,0 +1,47 @@
+package buildinfo_test
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/buildinfo"
+)
+
+func TestFrom_VCSSettings(t *testing.T) {
+	info := buildinfo.From(&debug.BuildInfo{
+		GoVersion: "go1.24.0",
+		Main:      debug.Module{Path: "github.com/BRO3886/go-docpdf", Version: "v1.4.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "4e25b37c0ffee"},
+			{Key: "vcs.time", Value: "2026-10-15T09:30:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	})
+	want := buildinfo.Info{
+		Version:   "v1.4.0",
+		Commit:    "4e25b37c0ffee",
+		BuildTime: time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC),
+		Modified:  true,
+		GoVersion: "go1.24.0",
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
+
+func TestFrom_Unknown(t *testing.T) {
+	for _, bi := range []*debug.BuildInfo{nil, {Main: debug.Module{Version: "(devel)"}}} {
+		info := buildinfo.From(bi)
+		if info.Version != buildinfo.Unknown || info.Commit != buildinfo.Unknown || !info.BuildTime.IsZero() {
+			t.Errorf("expected unknown version and commit, got %+v", info)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	if info := buildinfo.Get(); info.GoVersion != runtime.Version() {
+		t.Errorf("GoVersion = %q, want %q", info.GoVersion, runtime.Version())
+	}
+}
@@ -0,0 +1,160 @@
+// Package cache keeps recent conversion results in memory, keyed by a hash of
+// the input document and the conversion options, so a re-uploaded document is
+// answered without running LibreOffice again.
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// Cache is a size-bounded LRU of conversion results. It is safe for
+// concurrent use. The zero value is not usable; construct one with New.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // front is most recently used
+	items    map[string]*list.Element
+}
+
+// entry is one cached result.
+type entry struct {
+	key    string
+	data   []byte
+	stored time.Time
+}
+
+// New returns a Cache holding at most maxBytes of results.
+func New(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Key returns the cache key for converting data with opts: the hex SHA-256 of
+// the options followed by the document. Every option takes part, so results
+// differing in any setting never share an entry.
+func Key(data []byte, opts converter.Options) string {
+	key, _ := KeyReader(bytes.NewReader(data), opts)
+	return key
+}
+
+// KeyReader is Key for a document read from r, e.g. one staged on disk.
+func KeyReader(r io.Reader, opts converter.Options) (string, error) {
+	h := sha256.New()
+	o, _ := json.Marshal(opts)
+	h.Write(o)
+	h.Write([]byte{0})
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// AffinityKey returns the affinity key of the document read from r: the
+// first 16 bytes of its SHA-256, in hex. It depends on the document alone,
+// not the options, so a client can compute it before uploading, and a load
+// balancer hashing on it sends every conversion of one document to the same
+// replica, the one with its results cached.
+func AffinityKey(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// Get returns the result stored under key and marks it recently used. The
+// returned slice is shared and must not be modified.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry).data, true
+}
+
+// Contains reports whether a result is stored under key, without marking
+// it used.
+func (c *Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[key]
+	return ok
+}
+
+// Put stores data under key, evicting the least recently used results until
+// it fits. A result larger than the whole cache is not stored.
+func (c *Cache) Put(key string, data []byte) {
+	n := int64(len(data))
+	if n > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.size -= int64(len(el.Value.(*entry).data))
+		el.Value.(*entry).data = data
+		el.Value.(*entry).stored = time.Now()
+		c.size += n
+		c.order.MoveToFront(el)
+	} else {
+		c.items[key] = c.order.PushFront(&entry{key: key, data: data, stored: time.Now()})
+		c.size += n
+	}
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		e := oldest.Value.(*entry)
+		c.order.Remove(oldest)
+		delete(c.items, e.key)
+		c.size -= int64(len(e.data))
+	}
+}
+
+// Expire removes the results stored more than maxAge ago, however recently
+// they were used, and returns how many it removed.
+func (c *Cache) Expire(maxAge time.Duration) int {
+	cutoff := time.Now().Add(-maxAge)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*entry); e.stored.Before(cutoff) {
+			c.order.Remove(el)
+			delete(c.items, e.key)
+			c.size -= int64(len(e.data))
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// Len returns the number of cached results.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Size returns the total size in bytes of the cached results.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
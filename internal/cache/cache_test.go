@@ -0,0 +1,137 @@
+package cache_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/cache"
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+func TestKey(t *testing.T) {
+	doc := []byte("PK\x03\x04 document")
+	pdf := cache.Key(doc, converter.Options{Format: "pdf"})
+
+	if pdf != cache.Key(doc, converter.Options{Format: "pdf"}) {
+		t.Error("same input and options gave different keys")
+	}
+	if pdf == cache.Key(doc, converter.Options{Format: "png"}) {
+		t.Error("different options share a key")
+	}
+	if pdf == cache.Key([]byte("PK\x03\x04 other"), converter.Options{Format: "pdf"}) {
+		t.Error("different documents share a key")
+	}
+}
+
+func TestAffinityKey(t *testing.T) {
+	// The first 16 bytes of sha256("doc"), as a client computes it.
+	key, err := cache.AffinityKey(strings.NewReader("doc"))
+	if err != nil || key != "139d544b821b13ebea14f1b0fe185772" {
+		t.Errorf("AffinityKey = %q, %v", key, err)
+	}
+}
+
+func TestGetPut(t *testing.T) {
+	c := cache.New(1 << 10)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("hit on empty cache")
+	}
+	c.Put("a", []byte("result"))
+	got, ok := c.Get("a")
+	if !ok || string(got) != "result" {
+		t.Fatalf("Get = %q, %v", got, ok)
+	}
+
+	c.Put("a", []byte("replaced"))
+	if got, _ := c.Get("a"); string(got) != "replaced" {
+		t.Errorf("Get after replace = %q", got)
+	}
+	if c.Len() != 1 || c.Size() != int64(len("replaced")) {
+		t.Errorf("Len, Size = %d, %d", c.Len(), c.Size())
+	}
+}
+
+func TestContains(t *testing.T) {
+	c := cache.New(20)
+	c.Put("a", make([]byte, 10))
+	c.Put("b", make([]byte, 10))
+	if !c.Contains("a") || c.Contains("c") {
+		t.Fatal("Contains does not match what is stored")
+	}
+	// Unlike Get, Contains leaves a as the least recently used.
+	c.Put("c", make([]byte, 10))
+	if c.Contains("a") {
+		t.Error("Contains marked a as used")
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := cache.New(30)
+	c.Put("a", make([]byte, 10))
+	c.Put("b", make([]byte, 10))
+	c.Put("c", make([]byte, 10))
+	c.Get("a") // b is now the least recently used
+
+	c.Put("d", make([]byte, 10))
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+	if c.Size() != 30 {
+		t.Errorf("Size = %d, want 30", c.Size())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := cache.New(1 << 10)
+	c.Put("old", []byte("12345"))
+	time.Sleep(20 * time.Millisecond)
+	c.Put("new", []byte("678"))
+	c.Get("old") // use doesn't keep a result
+
+	if n := c.Expire(10 * time.Millisecond); n != 1 {
+		t.Fatalf("expected 1 expired, got %d", n)
+	}
+	if _, ok := c.Get("old"); ok {
+		t.Error("old result survived")
+	}
+	if _, ok := c.Get("new"); !ok || c.Len() != 1 || c.Size() != 3 {
+		t.Errorf("expected only the new result left, len %d size %d", c.Len(), c.Size())
+	}
+}
+
+func TestSkipsOversizedResult(t *testing.T) {
+	c := cache.New(10)
+	c.Put("a", make([]byte, 5))
+	c.Put("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok {
+		t.Error("result larger than the cache was stored")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("oversized result evicted existing entries")
+	}
+}
+
+func TestConcurrentRace(t *testing.T) {
+	c := cache.New(100)
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k := string(rune('a' + i%10))
+			c.Put(k, make([]byte, i%20))
+			c.Get(k)
+		}()
+	}
+	wg.Wait()
+	if c.Size() > 100 {
+		t.Errorf("Size %d exceeds the limit", c.Size())
+	}
+}
@@ -0,0 +1,492 @@
+// Package capture keeps the raw requests of chosen clients, headers and
+// body exactly as sent, so an integration problem ("it works with curl but
+// not from SAP") can be reproduced with the client's own bytes. An admin arms
+// a capture for the next few requests of an API key or tenant; each request
+// captured is kept, up to a size cap, until it expires.
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Defaults of Config.
+const (
+	DefaultMaxBytes = 10 << 20
+	DefaultTTL      = 24 * time.Hour
+	DefaultRetain   = 100
+)
+
+// ErrNotFound is returned for a capture that is not kept, or no longer.
+var ErrNotFound = errors.New("capture not found")
+
+// redacted are the headers whose values are not kept: a captured request
+// must not hand its client's credentials to whoever reads it.
+var redacted = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// redactedParams are the query parameters and form fields whose values are
+// not kept: the passwords /convert/raw takes in the query and /convert in
+// its form.
+var redactedParams = []string{"document_password", "user_password", "owner_password"}
+
+// Config configures a Recorder.
+type Config struct {
+	// Dir holds the captured bodies. It is created if missing, and bodies
+	// left in it by a previous run are removed.
+	Dir string
+	// MaxBytes caps the body kept of each request; the handler still reads
+	// the rest. Default DefaultMaxBytes.
+	MaxBytes int64
+	// TTL is how long captures, and armings not used up, are kept. Default
+	// DefaultTTL.
+	TTL time.Duration
+	// Retain caps the captures kept; the oldest are dropped first. Default
+	// DefaultRetain.
+	Retain int
+}
+
+// Target selects the requests an arming captures: those made with the API
+// key named Client, for Tenant, or both.
+type Target struct {
+	Client string `json:"client,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func (t Target) match(client, tenant string) bool {
+	return (t.Client == "" || t.Client == client) && (t.Tenant == "" || t.Tenant == tenant)
+}
+
+// Arming is a capture waiting for requests.
+type Arming struct {
+	Target
+	// Remaining is the requests still to capture.
+	Remaining int       `json:"remaining"`
+	Expires   time.Time `json:"expires_at"`
+}
+
+// Capture is one captured request.
+type Capture struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Method    string    `json:"method"`
+	// URL is the request's path and query, passwords redacted.
+	URL string `json:"url"`
+	// Header is the request's headers, credentials redacted.
+	Header http.Header `json:"header"`
+	// ContentLength is the body size the client declared; -1 if it did not.
+	ContentLength int64 `json:"content_length"`
+	// Size is the body bytes kept, password fields redacted.
+	Size int64 `json:"size"`
+	// Truncated reports that the client sent more than was kept.
+	Truncated bool `json:"truncated,omitempty"`
+	// Complete reports that the handler read the body to its end, so Size
+	// is all the client sent unless Truncated. A request refused before its
+	// body was read keeps only what was read of it.
+	Complete bool `json:"complete"`
+	// Status is the response status.
+	Status  int       `json:"status"`
+	Expires time.Time `json:"expires_at"`
+
+	path string
+}
+
+// Recorder arms captures and keeps what they capture. It is safe for
+// concurrent use.
+type Recorder struct {
+	cfg Config
+
+	mu   sync.Mutex
+	arms []*Arming
+	caps []*Capture // oldest first
+	seq  int
+}
+
+// New returns a Recorder keeping its captures in cfg.Dir.
+func New(cfg Config) (*Recorder, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("capture: no directory")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.Retain <= 0 {
+		cfg.Retain = DefaultRetain
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	old, err := filepath.Glob(filepath.Join(cfg.Dir, "*.body"))
+	if err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	for _, p := range old {
+		if err := os.Remove(p); err != nil {
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+	}
+	return &Recorder{cfg: cfg}, nil
+}
+
+// Dir returns the directory the captured bodies are kept in.
+func (r *Recorder) Dir() string { return r.cfg.Dir }
+
+// Arm captures the next n requests matching t, replacing any arming for the
+// same target; n 0 disarms it.
+func (r *Recorder) Arm(t Target, n int, now time.Time) (Arming, error) {
+	if t.Client == "" && t.Tenant == "" {
+		return Arming{}, errors.New("capture: no client or tenant")
+	}
+	if n < 0 {
+		return Arming{}, errors.New("capture: negative count")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.arms = slices.DeleteFunc(r.arms, func(a *Arming) bool { return a.Target == t })
+	a := Arming{Target: t, Remaining: n, Expires: now.Add(r.cfg.TTL)}
+	if n > 0 {
+		r.arms = append(r.arms, &a)
+	}
+	return a, nil
+}
+
+// Armed returns the armings not used up or expired.
+func (r *Recorder) Armed(now time.Time) []Arming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Arming
+	for _, a := range r.arms {
+		if now.Before(a.Expires) {
+			out = append(out, *a)
+		}
+	}
+	return out
+}
+
+// take uses up one request of the first arming matching client and tenant,
+// reporting whether there was one.
+func (r *Recorder) take(client, tenant string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.arms {
+		if !now.Before(a.Expires) || !a.match(client, tenant) {
+			continue
+		}
+		if a.Remaining--; a.Remaining == 0 {
+			r.arms = slices.Delete(r.arms, i, i+1)
+		}
+		return true
+	}
+	return false
+}
+
+// Start begins capturing req if an arming matches client and tenant. It
+// returns a body to read in place of req.Body, which keeps what is read of
+// it, and a function to call with the response status once the request is
+// done; ok is false, and nothing is kept, when no arming matches.
+func (r *Recorder) Start(req *http.Request, requestID, client, tenant string) (body io.ReadCloser, done func(status int), ok bool) {
+	now := time.Now()
+	if !r.take(client, tenant, now) {
+		return nil, nil, false
+	}
+	r.mu.Lock()
+	r.seq++
+	id := fmt.Sprintf("%s-%d", now.UTC().Format("20060102T150405"), r.seq)
+	r.mu.Unlock()
+
+	c := &Capture{
+		ID:            id,
+		Time:          now,
+		RequestID:     requestID,
+		Client:        client,
+		Tenant:        tenant,
+		Method:        req.Method,
+		URL:           redactURL(req.URL),
+		Header:        req.Header.Clone(),
+		ContentLength: req.ContentLength,
+		path:          filepath.Join(r.cfg.Dir, id+".body"),
+	}
+	for _, h := range redacted {
+		if c.Header.Get(h) != "" {
+			c.Header.Set(h, "[redacted]")
+		}
+	}
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, nil, false
+	}
+	tee := &teeBody{ReadCloser: req.Body, w: f, left: r.cfg.MaxBytes}
+	var form *formRedactor
+	if mt, params, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil && mt == "multipart/form-data" && params["boundary"] != "" {
+		form = &formRedactor{w: f, delim: []byte("--" + params["boundary"])}
+		tee.w = form
+	}
+	done = func(status int) {
+		if form != nil {
+			form.flush()
+		}
+		if st, err := f.Stat(); err == nil {
+			c.Size = st.Size()
+		}
+		f.Close()
+		c.Truncated = tee.truncated
+		c.Complete = tee.eof
+		c.Status = status
+		c.Expires = time.Now().Add(r.cfg.TTL)
+		r.add(c)
+	}
+	return tee, done, true
+}
+
+// redactURL returns the request URI of u with the values of redactedParams
+// replaced.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	found := false
+	for _, p := range redactedParams {
+		if q.Has(p) {
+			q[p] = []string{"[redacted]"}
+			found = true
+		}
+	}
+	if !found {
+		return u.RequestURI()
+	}
+	r := *u
+	r.RawQuery = q.Encode()
+	return r.RequestURI()
+}
+
+// add keeps c, dropping the oldest captures over the Retain cap.
+func (r *Recorder) add(c *Capture) {
+	r.mu.Lock()
+	r.caps = append(r.caps, c)
+	var drop []*Capture
+	if n := len(r.caps) - r.cfg.Retain; n > 0 {
+		drop = slices.Clone(r.caps[:n])
+		r.caps = slices.Delete(r.caps, 0, n)
+	}
+	r.mu.Unlock()
+	for _, d := range drop {
+		os.Remove(d.path)
+	}
+}
+
+// List returns the captures matching f, newest first. Empty fields of f
+// match every capture.
+func (r *Recorder) List(f Target) []Capture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Capture
+	for _, c := range slices.Backward(r.caps) {
+		if f.match(c.Client, c.Tenant) {
+			out = append(out, *c)
+		}
+	}
+	return out
+}
+
+// Open returns the capture with the given ID and its body.
+func (r *Recorder) Open(id string) (Capture, *os.File, error) {
+	r.mu.Lock()
+	i := slices.IndexFunc(r.caps, func(c *Capture) bool { return c.ID == id })
+	var c Capture
+	if i >= 0 {
+		c = *r.caps[i]
+	}
+	r.mu.Unlock()
+	if i < 0 {
+		return Capture{}, nil, ErrNotFound
+	}
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Capture{}, nil, ErrNotFound
+	}
+	return c, f, err
+}
+
+// Delete removes the capture with the given ID.
+func (r *Recorder) Delete(id string) error {
+	r.mu.Lock()
+	i := slices.IndexFunc(r.caps, func(c *Capture) bool { return c.ID == id })
+	var c *Capture
+	if i >= 0 {
+		c = r.caps[i]
+		r.caps = slices.Delete(r.caps, i, i+1)
+	}
+	r.mu.Unlock()
+	if c == nil {
+		return ErrNotFound
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Expire drops the captures and armings expired at now, returning the
+// number of captures dropped.
+func (r *Recorder) Expire(now time.Time) int {
+	r.mu.Lock()
+	r.arms = slices.DeleteFunc(r.arms, func(a *Arming) bool { return !now.Before(a.Expires) })
+	var drop []*Capture
+	r.caps = slices.DeleteFunc(r.caps, func(c *Capture) bool {
+		if now.Before(c.Expires) {
+			return false
+		}
+		drop = append(drop, c)
+		return true
+	})
+	r.mu.Unlock()
+	for _, c := range drop {
+		os.Remove(c.path)
+	}
+	return len(drop)
+}
+
+// teeBody keeps what is read of a request body, up to left bytes, in w.
+type teeBody struct {
+	io.ReadCloser
+	w         io.Writer
+	left      int64
+	truncated bool
+	eof       bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	keep := min(int64(n), b.left)
+	if keep > 0 {
+		// A failed write only shortens the capture, never the request.
+		b.w.Write(p[:keep])
+		b.left -= keep
+	}
+	if int64(n) > keep {
+		b.truncated = true
+	}
+	if errors.Is(err, io.EOF) {
+		b.eof = true
+	}
+	return n, err
+}
+
+// Multipart parts of a formRedactor.
+const (
+	partBody    = iota // passed through: the preamble or a part kept
+	partHeaders        // the headers of a part, buffered a line at a time
+	partSecret         // the value of a redactedParams field, dropped
+)
+
+// maxHeaderLine caps the part header lines a formRedactor buffers; longer
+// ones are passed through unparsed.
+const maxHeaderLine = 4096
+
+// formRedactor writes a multipart/form-data body to w with the values of its
+// redactedParams fields replaced, as the body streams in. Delimiters start a
+// line, so it only buffers the start of each line, until it is known not to
+// be one, and part headers.
+type formRedactor struct {
+	w     io.Writer
+	delim []byte // "--" and the boundary
+	state int
+	// secret reports that the part whose headers are being read is a
+	// redactedParams field.
+	secret bool
+	line   []byte
+	// rest reports that the line being written is known not to be a
+	// delimiter or header, so it goes straight to emit.
+	rest bool
+}
+
+func (r *formRedactor) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		chunk := p
+		if i >= 0 {
+			chunk = p[:i+1]
+		}
+		p = p[len(chunk):]
+		if r.rest {
+			r.emit(chunk)
+			r.rest = i < 0
+			continue
+		}
+		r.line = append(r.line, chunk...)
+		if i >= 0 {
+			r.endLine()
+		} else if r.state == partHeaders && len(r.line) > maxHeaderLine ||
+			r.state != partHeaders && len(r.line) >= len(r.delim) && !bytes.HasPrefix(r.line, r.delim) {
+			r.emit(r.line)
+			r.line, r.rest = r.line[:0], true
+		}
+	}
+	return n, nil
+}
+
+// endLine handles the complete line buffered.
+func (r *formRedactor) endLine() {
+	line := r.line
+	r.line = r.line[:0]
+	text := bytes.TrimRight(line, "\r\n")
+	if bytes.HasPrefix(text, r.delim) {
+		if r.state == partSecret {
+			// The line break before a delimiter belongs to it, and went
+			// with the value dropped.
+			r.w.Write([]byte("\r\n"))
+		}
+		r.w.Write(line)
+		r.state, r.secret = partHeaders, false
+		return
+	}
+	switch r.state {
+	case partBody:
+		r.w.Write(line)
+	case partHeaders:
+		r.w.Write(line)
+		if len(text) == 0 {
+			r.state = partBody
+			if r.secret {
+				r.w.Write([]byte("[redacted]"))
+				r.state = partSecret
+			}
+			return
+		}
+		name, value, _ := bytes.Cut(text, []byte(":"))
+		if !bytes.EqualFold(bytes.TrimSpace(name), []byte("Content-Disposition")) {
+			return
+		}
+		if _, params, err := mime.ParseMediaType(string(value)); err == nil {
+			r.secret = slices.Contains(redactedParams, params["name"])
+		}
+	}
+}
+
+// emit writes part of a line that is not a delimiter, unless it is a
+// secret's.
+func (r *formRedactor) emit(b []byte) {
+	if r.state != partSecret {
+		r.w.Write(b)
+	}
+}
+
+// flush writes what is buffered of the last line, once the body is done.
+func (r *formRedactor) flush() {
+	r.emit(r.line)
+	r.line = r.line[:0]
+}
@@ -0,0 +1,292 @@
+package capture_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/capture"
+)
+
+func newRecorder(t *testing.T, cfg capture.Config) *capture.Recorder {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	rec, err := capture.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// serve captures a request with body as a handler reading all of it, or
+// read bytes of it, would.
+func serve(t *testing.T, rec *capture.Recorder, client, tenant, body string, read int) bool {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/convert?pdfa=1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	req.Header.Set("X-API-Key", "secret")
+	b, done, ok := rec.Start(req, "req-1", client, tenant)
+	if !ok {
+		return false
+	}
+	if read < 0 {
+		io.Copy(io.Discard, b)
+	} else {
+		io.CopyN(io.Discard, b, int64(read))
+	}
+	done(http.StatusOK)
+	return true
+}
+
+func TestRecorder_CapturesArmedRequests(t *testing.T) {
+	rec := newRecorder(t, capture.Config{})
+	if serve(t, rec, "sap", "acme", "body", -1) {
+		t.Fatal("captured without an arming")
+	}
+	if _, err := rec.Arm(capture.Target{Client: "sap"}, 2, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if serve(t, rec, "curl", "acme", "body", -1) {
+		t.Error("captured another client")
+	}
+	for i := range 3 {
+		if got := serve(t, rec, "sap", "acme", "body", -1); got != (i < 2) {
+			t.Errorf("request %d captured = %v", i, got)
+		}
+	}
+	if armed := rec.Armed(time.Now()); len(armed) != 0 {
+		t.Errorf("used up arming still armed: %+v", armed)
+	}
+
+	caps := rec.List(capture.Target{})
+	if len(caps) != 2 {
+		t.Fatalf("captures %+v", caps)
+	}
+	c := caps[0]
+	if c.Client != "sap" || c.Tenant != "acme" || c.RequestID != "req-1" || c.Method != "POST" || c.URL != "/convert?pdfa=1" {
+		t.Errorf("capture %+v", c)
+	}
+	if c.Size != 4 || c.Truncated || !c.Complete || c.Status != http.StatusOK {
+		t.Errorf("body %+v", c)
+	}
+	if got := c.Header.Get("X-API-Key"); got != "[redacted]" {
+		t.Errorf("X-API-Key kept as %q", got)
+	}
+
+	got, f, err := rec.Open(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	body, _ := io.ReadAll(f)
+	if string(body) != "body" || got.Header.Get("Content-Type") != "multipart/form-data; boundary=x" {
+		t.Errorf("opened %q, %+v", body, got.Header)
+	}
+	if st, _ := f.Stat(); st.Mode().Perm() != 0o600 {
+		t.Errorf("body mode %v", st.Mode().Perm())
+	}
+}
+
+func TestRecorder_RedactsPasswordParams(t *testing.T) {
+	rec := newRecorder(t, capture.Config{})
+	rec.Arm(capture.Target{Client: "sap"}, 1, time.Now())
+	req := httptest.NewRequest(http.MethodPost, "/convert/raw?filename=a.docx&document_password=open-sesame&owner_password=s3cret", strings.NewReader("body"))
+	b, done, ok := rec.Start(req, "req-1", "sap", "acme")
+	if !ok {
+		t.Fatal("not captured")
+	}
+	io.Copy(io.Discard, b)
+	done(http.StatusOK)
+
+	c := rec.List(capture.Target{})[0]
+	if strings.Contains(c.URL, "open-sesame") || strings.Contains(c.URL, "s3cret") {
+		t.Errorf("password kept in %q", c.URL)
+	}
+	if !strings.HasPrefix(c.URL, "/convert/raw?") || !strings.Contains(c.URL, "filename=a.docx") || !strings.Contains(c.URL, "document_password=%5Bredacted%5D") {
+		t.Errorf("url %q", c.URL)
+	}
+}
+
+func TestRecorder_RedactsPasswordFields(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	doc := strings.Repeat("PK\x03\x04 no line breaks here ", 200) + "\r\n--not-the-boundary\r\n"
+	fw, _ := mw.CreateFormFile("file", "a.docx")
+	fw.Write([]byte(doc))
+	mw.WriteField("document_password", "open-sesame")
+	mw.WriteField("pdfa", "1")
+	mw.WriteField("owner_password", "s3cret\r\nline two")
+	mw.Close()
+
+	for _, chunked := range []bool{false, true} {
+		rec := newRecorder(t, capture.Config{})
+		rec.Arm(capture.Target{Client: "sap"}, 1, time.Now())
+		req := httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(buf.Bytes()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		b, done, ok := rec.Start(req, "req-1", "sap", "acme")
+		if !ok {
+			t.Fatal("not captured")
+		}
+		var r io.Reader = b
+		if chunked {
+			r = iotest.OneByteReader(b)
+		}
+		if n, _ := io.Copy(io.Discard, r); n != int64(buf.Len()) {
+			t.Errorf("handler read %d bytes, want %d", n, buf.Len())
+		}
+		done(http.StatusOK)
+
+		c := rec.List(capture.Target{})[0]
+		_, f, err := rec.Open(c.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept, _ := io.ReadAll(f)
+		f.Close()
+		if bytes.Contains(kept, []byte("open-sesame")) || bytes.Contains(kept, []byte("s3cret")) {
+			t.Fatalf("chunked %v: password kept in %q", chunked, kept)
+		}
+		if c.Size != int64(len(kept)) {
+			t.Errorf("size %d, kept %d bytes", c.Size, len(kept))
+		}
+
+		form, err := multipart.NewReader(bytes.NewReader(kept), mw.Boundary()).ReadForm(1 << 20)
+		if err != nil {
+			t.Fatalf("chunked %v: kept body does not parse: %v", chunked, err)
+		}
+		for field, want := range map[string]string{"document_password": "[redacted]", "owner_password": "[redacted]", "pdfa": "1"} {
+			if got := form.Value[field]; len(got) != 1 || got[0] != want {
+				t.Errorf("chunked %v: %s = %q, want %q", chunked, field, got, want)
+			}
+		}
+		ff, err := form.File["file"][0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := io.ReadAll(ff); string(got) != doc {
+			t.Errorf("chunked %v: file part changed", chunked)
+		}
+	}
+}
+
+func TestRecorder_TenantTarget(t *testing.T) {
+	rec := newRecorder(t, capture.Config{})
+	rec.Arm(capture.Target{Tenant: "acme"}, 5, time.Now())
+	serve(t, rec, "sap", "acme", "a", -1)
+	serve(t, rec, "sap", "globex", "b", -1)
+	serve(t, rec, "", "acme", "c", -1)
+	if caps := rec.List(capture.Target{}); len(caps) != 2 {
+		t.Errorf("captures %+v", caps)
+	}
+	if caps := rec.List(capture.Target{Client: "sap"}); len(caps) != 1 {
+		t.Errorf("sap captures %+v", caps)
+	}
+}
+
+func TestRecorder_Truncates(t *testing.T) {
+	rec := newRecorder(t, capture.Config{MaxBytes: 3})
+	rec.Arm(capture.Target{Client: "sap"}, 2, time.Now())
+	serve(t, rec, "sap", "", "0123456789", -1)
+	serve(t, rec, "sap", "", "0123456789", 2)
+
+	caps := rec.List(capture.Target{})
+	if c := caps[1]; c.Size != 3 || !c.Truncated || !c.Complete {
+		t.Errorf("read in full: %+v", c)
+	}
+	if c := caps[0]; c.Size != 2 || c.Truncated || c.Complete {
+		t.Errorf("read in part: %+v", c)
+	}
+}
+
+func TestRecorder_Retain(t *testing.T) {
+	dir := t.TempDir()
+	rec := newRecorder(t, capture.Config{Dir: dir, Retain: 2})
+	rec.Arm(capture.Target{Client: "sap"}, 3, time.Now())
+	for range 3 {
+		serve(t, rec, "sap", "", "body", -1)
+	}
+	if caps := rec.List(capture.Target{}); len(caps) != 2 {
+		t.Errorf("captures %+v", caps)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.body")); len(files) != 2 {
+		t.Errorf("files %v", files)
+	}
+}
+
+func TestRecorder_Expire(t *testing.T) {
+	dir := t.TempDir()
+	rec := newRecorder(t, capture.Config{Dir: dir, TTL: time.Hour})
+	rec.Arm(capture.Target{Client: "sap"}, 1, time.Now())
+	rec.Arm(capture.Target{Client: "erp"}, 1, time.Now())
+	serve(t, rec, "sap", "", "body", -1)
+
+	if n := rec.Expire(time.Now()); n != 0 {
+		t.Errorf("expired %d before the TTL", n)
+	}
+	later := time.Now().Add(2 * time.Hour)
+	if n := rec.Expire(later); n != 1 {
+		t.Errorf("expired %d, want 1", n)
+	}
+	if serve(t, rec, "erp", "", "body", -1) {
+		t.Error("captured under an expired arming")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.body")); len(files) != 0 {
+		t.Errorf("files left %v", files)
+	}
+}
+
+func TestRecorder_DeleteAndDisarm(t *testing.T) {
+	rec := newRecorder(t, capture.Config{})
+	rec.Arm(capture.Target{Client: "sap"}, 3, time.Now())
+	serve(t, rec, "sap", "", "body", -1)
+	if _, err := rec.Arm(capture.Target{Client: "sap"}, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if serve(t, rec, "sap", "", "body", -1) {
+		t.Error("captured after disarming")
+	}
+
+	id := rec.List(capture.Target{})[0].ID
+	if err := rec.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rec.Open(id); !errors.Is(err, capture.ErrNotFound) {
+		t.Errorf("open deleted: %v", err)
+	}
+	if err := rec.Delete(id); !errors.Is(err, capture.ErrNotFound) {
+		t.Errorf("delete twice: %v", err)
+	}
+}
+
+func TestRecorder_ArmErrors(t *testing.T) {
+	rec := newRecorder(t, capture.Config{})
+	if _, err := rec.Arm(capture.Target{}, 1, time.Now()); err == nil {
+		t.Error("armed without a target")
+	}
+	if _, err := rec.Arm(capture.Target{Client: "sap"}, -1, time.Now()); err == nil {
+		t.Error("armed a negative count")
+	}
+}
+
+func TestNew_RemovesLeftoverBodies(t *testing.T) {
+	dir := t.TempDir()
+	left := filepath.Join(dir, "old.body")
+	if err := os.WriteFile(left, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	newRecorder(t, capture.Config{Dir: dir})
+	if _, err := os.Stat(left); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("leftover body kept: %v", err)
+	}
+}
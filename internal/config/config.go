@@ -0,0 +1,523 @@
+// Package config loads the server's settings. Every setting has a default
+// and can be overridden, in increasing order of precedence, by a YAML or
+// TOML file, an environment variable and a command-line flag. A setting
+// named "request_timeout" is REQUEST_TIMEOUT in the environment,
+// request_timeout in a file and -request-timeout on the command line.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every server setting. Fields are tagged with their setting
+// name; secret ones are redacted by ServeHTTP.
+type Config struct {
+	// Server.
+	Port                int           `config:"port" usage:"port to listen on"`
+	RequestTimeout      time.Duration `config:"request_timeout" usage:"deadline for a synchronous conversion request, queueing included"`
+	ParseTimeout        time.Duration `config:"parse_timeout" usage:"time allowed to receive the upload of a synchronous request (0 = off)"`
+	QueueTimeout        time.Duration `config:"queue_timeout" usage:"time a synchronous request may wait for a worker (0 = off)"`
+	ConvertTimeout      time.Duration `config:"convert_timeout" usage:"deadline for the conversion step of a synchronous request (0 = off)"`
+	PreviewTimeout      time.Duration `config:"preview_timeout" usage:"time a fast=true preview may take before the full conversion is queued as an async job instead (0 disables fast=true)"`
+	MinTransferKBps     int           `config:"min_transfer_kbps" usage:"minimum upload/download speed (0 = off)"`
+	MinTransferWindow   time.Duration `config:"min_transfer_window" usage:"window min_transfer_kbps is measured over"`
+	ReadHeaderTimeout   time.Duration `config:"read_header_timeout" usage:"time allowed to receive request headers"`
+	ReadTimeout         time.Duration `config:"read_timeout" usage:"time allowed to receive a whole request"`
+	WriteTimeout        time.Duration `config:"write_timeout" usage:"time from the end of the headers until the response is written (default derived)"`
+	WriteAllowance      time.Duration `config:"write_allowance" usage:"time allowed for sending the result, used to derive write_timeout"`
+	IdleTimeout         time.Duration `config:"idle_timeout" usage:"how long an idle keep-alive connection is kept open"`
+	ShutdownTimeout     time.Duration `config:"shutdown_timeout" usage:"time in-flight requests get to finish on SIGINT/SIGTERM"`
+	ReadyCheckInterval  time.Duration `config:"ready_check_interval" usage:"how long a /readyz test conversion result is reused"`
+	LiveStallTimeout    time.Duration `config:"live_stall_timeout" usage:"time the worker pool may stay full without progress before /livez fails (default derived)"`
+	ReadyMaxQueueDepth  int           `config:"ready_max_queue_depth" usage:"requests waiting for a worker above which /readyz fails (0 = off)"`
+	ReadyMaxFailureRate float64       `config:"ready_max_failure_rate" usage:"share of conversions (0-1) failing within ready_failure_window above which /readyz fails (0 = off)"`
+	ReadyFailureWindow  time.Duration `config:"ready_failure_window" usage:"window ready_max_failure_rate is measured over"`
+	ReadyMinFreeDiskMB  int           `config:"ready_min_free_disk_mb" usage:"free space in MB in the temp directory below which /readyz fails (0 = off)"`
+
+	// Logging.
+	LogLevel  string `config:"log_level" usage:"lowest level logged: debug, info, warn or error"`
+	LogFormat string `config:"log_format" usage:"log line format: json or text"`
+
+	// Conversion.
+	LibreOfficePath            string        `config:"libreoffice_path" usage:"LibreOffice binary"`
+	LibreOfficeProfileTemplate string        `config:"libreoffice_profile_template" usage:"registrymodifications.xcu or profile directory copied into every profile"`
+	PdftoppmPath               string        `config:"pdftoppm_path" usage:"pdftoppm binary (poppler-utils) rendering /thumbnail images"`
+	FontSubstitutions          string        `config:"font_substitutions" usage:"font replacement table, e.g. Calibri=Carlito; none disables it (default built-in)"`
+	FcListPath                 string        `config:"fc_list_path" usage:"fc-list binary (fontconfig) listing installed fonts for GET /fonts and missing-font reports; empty disables both"`
+	MaxConcurrentConversions   int           `config:"max_concurrent_conversions" usage:"conversions allowed to run at once (default number of CPUs)"`
+	MaxQueueDepth              int           `config:"max_queue_depth" usage:"requests allowed to wait for a worker (default 4 x workers)"`
+	ConverterBackend           string        `config:"converter_backend" usage:"libreoffice or unoserver"`
+	ConverterBackends          []string      `config:"converter_backends" usage:"comma-separated backends tried in order, each falling back to the next: libreoffice, unoserver, gotenberg, pandoc or msgraph, optionally limited to input types as gotenberg:docx+xlsx (default converter_backend alone)"`
+	GotenbergURL               string        `config:"gotenberg_url" usage:"base URL of the Gotenberg server used by the gotenberg backend"`
+	PandocPath                 string        `config:"pandoc_path" usage:"pandoc binary used by the pandoc backend"`
+	PandocPDFEngine            string        `config:"pandoc_pdf_engine" usage:"PDF engine of the pandoc backend: pdflatex, xelatex, lualatex or wkhtmltopdf"`
+	MSGraphTenantID            string        `config:"msgraph_tenant_id" usage:"Entra ID tenant of the app the msgraph backend authenticates as"`
+	MSGraphClientID            string        `config:"msgraph_client_id" usage:"client ID of the app the msgraph backend authenticates as"`
+	MSGraphClientSecret        string        `config:"msgraph_client_secret" secret:"true" usage:"client secret of the app the msgraph backend authenticates as"`
+	MSGraphDriveID             string        `config:"msgraph_drive_id" usage:"OneDrive or SharePoint drive the msgraph backend uploads documents to"`
+	MSGraphFolder              string        `config:"msgraph_folder" usage:"drive folder the msgraph backend uploads documents to, each deleted after its conversion"`
+	BackendFailureThreshold    int           `config:"backend_failure_threshold" usage:"consecutive failures after which a backend of converter_backends is taken out of rotation"`
+	BackendCooldown            time.Duration `config:"backend_cooldown" usage:"how long a failing backend of converter_backends stays out of rotation"`
+	UnoserverPath              string        `config:"unoserver_path" usage:"unoserver executable"`
+	UnoconvertPath             string        `config:"unoconvert_path" usage:"unoconvert executable"`
+	UnoserverBasePort          int           `config:"unoserver_base_port" usage:"first local port used by the unoserver backend"`
+	ConvertNice                int           `config:"convert_nice" usage:"niceness increment (1-19) for LibreOffice"`
+	ConvertIoniceClass         int           `config:"convert_ionice_class" usage:"ionice class for LibreOffice: 1 realtime, 2 best-effort, 3 idle"`
+	ConvertIoniceLevel         int           `config:"convert_ionice_level" usage:"best-effort I/O priority level (0-7)"`
+	ConvertCPUSet              string        `config:"convert_cpuset" usage:"pin LibreOffice to these CPUs, taskset syntax"`
+	ConvertCPUSeconds          int           `config:"convert_cpu_seconds" usage:"CPU time a LibreOffice process may use before its conversion fails with resource_limit (0 = none)"`
+	ConvertMaxRSSMB            int           `config:"convert_max_rss_mb" usage:"resident memory in MB a LibreOffice process tree may use before it is killed (0 = none)"`
+	ConvertMaxOutputMB         int           `config:"convert_max_output_mb" usage:"largest file in MB a LibreOffice process may write (0 = none)"`
+	ConvertMinFreeDiskMB       int           `config:"convert_min_free_disk_mb" usage:"free space in MB in the temp directory below which new conversions are refused with 507 (0 = off)"`
+	ConvertRetries             int           `config:"convert_retries" usage:"times a conversion failing with an error in convert_retry_on is run again (0 = off)"`
+	ConvertRetryBackoff        time.Duration `config:"convert_retry_backoff" usage:"wait before the first retry of a conversion, doubled before each one after"`
+	ConvertRetryOn             []string      `config:"convert_retry_on" usage:"comma-separated conversion errors retried: failed, no_output, timeout"`
+	Sandbox                    string        `config:"sandbox" usage:"run LibreOffice in a sandbox: bwrap, nsjail or unshare (empty = off)"`
+	SandboxPath                string        `config:"sandbox_path" usage:"sandbox tool binary (default the tool on PATH)"`
+	SandboxReadOnly            []string      `config:"sandbox_read_only" usage:"comma-separated paths bound read-only into the sandbox (default /usr,/lib,/lib64,/bin,/sbin,/etc,/opt)"`
+	SandboxUID                 int           `config:"sandbox_uid" usage:"user LibreOffice runs as in the sandbox (0 = unchanged)"`
+	SandboxGID                 int           `config:"sandbox_gid" usage:"group LibreOffice runs as in the sandbox (0 = unchanged)"`
+	SandboxCPUSeconds          int           `config:"sandbox_cpu_seconds" usage:"CPU time limit of each LibreOffice process in seconds (0 = none)"`
+	SandboxMemoryMB            int           `config:"sandbox_memory_mb" usage:"address space limit of each LibreOffice process in MB (0 = none)"`
+	UnoserverRecycleInterval   time.Duration `config:"unoserver_recycle_interval" usage:"how often an idle unoserver instance is restarted with a fresh profile (0 = off)"`
+	SelfTestInterval           time.Duration `config:"self_test_interval" usage:"how often the /readyz test conversion is refreshed in the background (0 = off)"`
+	BatchParallelism           int           `config:"batch_parallelism" usage:"documents of one batch request converted at once"`
+	PostProcessWorkers         int           `config:"postprocess_workers" usage:"pages of one result watermarked or otherwise post-processed at once (default number of CPUs)"`
+	ScratchDir                 string        `config:"scratch_dir" usage:"tmpfs directory synchronous conversions are staged in, falling back to disk (empty = off)"`
+	ScratchMaxMB               int           `config:"scratch_max_mb" usage:"space in MB of scratch_dir reserved at once; keep it within the tmpfs size"`
+	ScratchConversionMB        int           `config:"scratch_conversion_mb" usage:"space in MB each conversion may use in scratch_dir before it moves to disk"`
+	TempMaxAge                 time.Duration `config:"temp_max_age" usage:"age at which docpdf-* temp directories nothing has modified, left by crashed requests, are removed (0 = off)"`
+	TempOrphanAge              time.Duration `config:"temp_orphan_age" usage:"age at which docpdf-* temp directories of processes no longer running are removed, sooner than temp_max_age (0 = wait for temp_max_age)"`
+
+	// Input policy.
+	AllowedInputTypes        string `config:"allowed_input_types" usage:"comma-separated input types to accept (default all)"`
+	TenantAllowedInputTypes  string `config:"tenant_allowed_input_types" usage:"per-tenant type lists, tenant=docx,odt;other=xlsx"`
+	MacroPolicy              string `config:"macro_policy" usage:"uploads carrying macros: reject, strip or allow"`
+	ProtectionPolicy         string `config:"protection_policy" usage:"uploads marked read-only or restricting editing: honor, ignore or warn"`
+	PackageMaxEntries        int    `config:"package_max_entries" usage:"entries a ZIP-based upload may hold"`
+	PackageMaxUncompressedMB int    `config:"package_max_uncompressed_mb" usage:"size in MB a ZIP-based upload may expand to"`
+
+	// Memory watchdog and statistics.
+	MemoryWatchdogThreshold int           `config:"memory_watchdog_threshold" usage:"memory usage percentage at which the longest conversion is cancelled (0 = off)"`
+	MemoryWatchdogInterval  time.Duration `config:"memory_watchdog_interval" usage:"how often memory usage is sampled"`
+	StatsFile               string        `config:"stats_file" usage:"JSON file persisting /stats across restarts"`
+	StatsFlushInterval      time.Duration `config:"stats_flush_interval" usage:"how often statistics are saved to stats_file"`
+	EgressFlushInterval     time.Duration `config:"egress_flush_interval" usage:"how often egress usage is saved to egress_file"`
+	RuntimeMetrics          bool          `config:"runtime_metrics" usage:"include Go runtime and process metrics in /metrics"`
+
+	// Results.
+	PDFVersion        string        `config:"pdf_version" usage:"PDF version produced when a request names none: 1.5, 1.6, 1.7, pdfa-1b, pdfa-2b or pdfa-3b (default LibreOffice's)"`
+	TenantPDFVersions string        `config:"tenant_pdf_versions" usage:"per-tenant default PDF versions, tenant=pdfa-2b;other=1.6"`
+	ImageDPI          int           `config:"image_dpi" usage:"resolution images in PDF results are downsampled to when a request names none, 50-1200 (0 = keep their own)"`
+	TenantImageDPI    string        `config:"tenant_image_dpi" usage:"per-tenant default image resolutions, print=300;web=96 (original = keep their own)"`
+	CacheMaxMB        int           `config:"cache_max_mb" usage:"memory for cached results in MB (0 = off)"`
+	CacheTTL          time.Duration `config:"cache_ttl" usage:"age at which cached results are dropped (0 = kept until evicted for space)"`
+	Affinity          bool          `config:"affinity" usage:"send X-Affinity-Key on /convert responses for load balancers to route a document to one replica"`
+	AffinityCookie    string        `config:"affinity_cookie" usage:"also set the affinity key as a cookie of this name"`
+	OutputSink        string        `config:"output_sink" usage:"where store=true writes results: s3, gcs or dir"`
+	SinkBucket        string        `config:"sink_bucket" usage:"bucket for s3/gcs"`
+	SinkRegion        string        `config:"sink_region" usage:"region the sink requests are signed for"`
+	SinkEndpoint      string        `config:"sink_endpoint" usage:"storage endpoint, e.g. a MinIO server"`
+	SinkAccessKey     string        `config:"sink_access_key" usage:"sink access key"`
+	SinkSecretKey     string        `config:"sink_secret_key" secret:"true" usage:"sink secret key"`
+	SinkPrefix        string        `config:"sink_prefix" usage:"prefix for every stored key"`
+	SinkPathStyle     bool          `config:"sink_path_style" usage:"address the bucket as endpoint/bucket"`
+	SinkURLTTL        time.Duration `config:"sink_url_ttl" usage:"validity of presigned result URLs"`
+	SinkDir           string        `config:"sink_dir" usage:"directory for the dir sink"`
+	SinkBaseURL       string        `config:"sink_base_url" usage:"URL the dir sink is served under"`
+
+	// Async jobs and webhooks.
+	JobWorkers          int           `config:"job_workers" usage:"concurrent async job conversions"`
+	JobQueueDepth       int           `config:"job_queue_depth" usage:"async jobs allowed to wait"`
+	JobTTL              time.Duration `config:"job_ttl" usage:"how long finished jobs and results are kept"`
+	JobResultDir        string        `config:"job_result_dir" usage:"directory keeping async results by content, so identical results are stored once (empty = in each job's directory)"`
+	WebhookSecret       string        `config:"webhook_secret" secret:"true" usage:"enables callback_url and signs webhook payloads"`
+	WebhookAllowedHosts []string      `config:"webhook_allowed_hosts" usage:"comma-separated hosts callback URLs may target"`
+	OutboxDir           string        `config:"outbox_dir" usage:"directory for pending completion events"`
+	TemplateDir         string        `config:"template_dir" usage:"directory of the template library served at /templates, behind admin_token (empty = off)"`
+
+	// Access.
+	APIKeys            string `config:"api_keys" secret:"true" usage:"comma-separated name:secret API keys"`
+	APIKeysFile        string `config:"api_keys_file" usage:"JSON file of API keys, reloaded on SIGHUP"`
+	RateLimitPerMinute int    `config:"rate_limit_per_minute" usage:"conversion requests allowed per client per minute (0 = off)"`
+	RateLimitBurst     int    `config:"rate_limit_burst" usage:"requests a client may make in a burst (default the per-minute rate)"`
+	RateLimitRedisURL  string `config:"rate_limit_redis_url" secret:"true" usage:"redis:// or rediss:// URL of a Redis holding the rate limit buckets, shared by every replica"`
+	EgressCapGB        int    `config:"egress_cap_gb" usage:"result bytes each tenant may download per calendar month, in GB (0 = no cap)"`
+	TenantEgressCaps   string `config:"tenant_egress_caps" usage:"per-tenant monthly egress caps in GB, acme=500;trial=1 (0 = no cap)"`
+	EgressFile         string `config:"egress_file" usage:"JSON file persisting the month's egress per tenant across restarts"`
+	AdminToken         string `config:"admin_token" secret:"true" usage:"bearer token for /admin/* and /debug/* endpoints"`
+	DenialAuditSize    int    `config:"denial_audit_size" usage:"denied requests kept for GET /admin/denials (0 = off)"`
+	PprofEnabled       bool   `config:"pprof_enabled" usage:"serve Go profiles at /debug/pprof/, behind admin_token"`
+
+	// Request capture.
+	CaptureDir    string        `config:"capture_dir" usage:"directory request bodies captured by /admin/captures are kept in (default a docpdf-capture-* temp directory)"`
+	CaptureMaxMB  int           `config:"capture_max_mb" usage:"body kept of each captured request, in MB"`
+	CaptureTTL    time.Duration `config:"capture_ttl" usage:"how long captured requests, and captures armed but not used up, are kept"`
+	CaptureRetain int           `config:"capture_retain" usage:"captured requests kept for /admin/captures, behind admin_token (0 = off)"`
+
+	// API versions.
+	APIV1Deprecated      time.Time `config:"api_v1_deprecated" usage:"date (YYYY-MM-DD) from which API v1 is deprecated"`
+	APIV1Sunset          time.Time `config:"api_v1_sunset" usage:"date (YYYY-MM-DD) API v1 is to be removed"`
+	APIV1DeprecationLink string    `config:"api_v1_deprecation_link" usage:"migration notes URL sent with v1 deprecation notices"`
+
+	// Billing.
+	BillingExport             string        `config:"billing_export" usage:"http(s) URL or CSV file per-tenant usage is exported to"`
+	BillingInterval           time.Duration `config:"billing_interval" usage:"length of a billing period"`
+	BillingToken              string        `config:"billing_token" secret:"true" usage:"bearer token sent with HTTP usage exports"`
+	BillingUnitsPerSecond     float64       `config:"billing_units_per_second" usage:"cost units per second of conversion time"`
+	BillingUnitsPerPage       float64       `config:"billing_units_per_page" usage:"cost units per output page"`
+	BillingUnitsPerConversion float64       `config:"billing_units_per_conversion" usage:"cost units per conversion"`
+
+	// Tracing.
+	OTelExporterOTLPEndpoint string `config:"otel_exporter_otlp_endpoint" usage:"OpenTelemetry collector URL traces are exported to over OTLP/HTTP (empty = off)"`
+	OTelExporterOTLPHeaders  string `config:"otel_exporter_otlp_headers" secret:"true" usage:"headers sent with trace exports, key=value,..."`
+	OTelServiceName          string `config:"otel_service_name" usage:"service.name traces are reported under"`
+
+	// File is the config file the settings were read from, if any.
+	File string `json:"-"`
+
+	sources map[string]string
+}
+
+// Where a setting's value came from.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+	// SourceDerived marks a setting computed from others because it was
+	// not set.
+	SourceDerived = "derived"
+)
+
+// FileEnv and FileFlag name the config file: CONFIG_FILE in the environment
+// or -config on the command line.
+const (
+	FileEnv  = "CONFIG_FILE"
+	FileFlag = "config"
+)
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Port:                     8080,
+		RequestTimeout:           2 * time.Minute,
+		PreviewTimeout:           2 * time.Second,
+		MinTransferWindow:        30 * time.Second,
+		ReadHeaderTimeout:        10 * time.Second,
+		ReadTimeout:              time.Minute,
+		WriteAllowance:           30 * time.Second,
+		IdleTimeout:              2 * time.Minute,
+		ShutdownTimeout:          30 * time.Second,
+		ReadyCheckInterval:       time.Minute,
+		ReadyFailureWindow:       5 * time.Minute,
+		LogLevel:                 "info",
+		LogFormat:                "json",
+		LibreOfficePath:          "libreoffice",
+		PdftoppmPath:             "pdftoppm",
+		FcListPath:               "fc-list",
+		MaxConcurrentConversions: runtime.NumCPU(),
+		ConverterBackend:         "libreoffice",
+		PandocPath:               "pandoc",
+		PandocPDFEngine:          "pdflatex",
+		MSGraphFolder:            "docpdf",
+		BackendFailureThreshold:  3,
+		BackendCooldown:          30 * time.Second,
+		UnoserverBasePort:        2003,
+		BatchParallelism:         2,
+		PostProcessWorkers:       runtime.NumCPU(),
+		ScratchMaxMB:             512,
+		ScratchConversionMB:      64,
+		TempMaxAge:               6 * time.Hour,
+		TempOrphanAge:            5 * time.Minute,
+		ConvertRetryBackoff:      500 * time.Millisecond,
+		ConvertRetryOn:           []string{"failed"},
+		MacroPolicy:              "reject",
+		ProtectionPolicy:         "warn",
+		PackageMaxEntries:        10000,
+		PackageMaxUncompressedMB: 256,
+		MemoryWatchdogThreshold:  90,
+		MemoryWatchdogInterval:   2 * time.Second,
+		StatsFlushInterval:       time.Minute,
+		EgressFlushInterval:      time.Minute,
+		RuntimeMetrics:           true,
+		SinkURLTTL:               time.Hour,
+		JobWorkers:               2,
+		JobQueueDepth:            100,
+		JobTTL:                   time.Hour,
+		DenialAuditSize:          1000,
+		CaptureMaxMB:             10,
+		CaptureTTL:               24 * time.Hour,
+		CaptureRetain:            100,
+		BillingInterval:          time.Hour,
+		BillingUnitsPerSecond:    1,
+		OTelServiceName:          "docpdf",
+	}
+}
+
+// Load reads the settings from args (the command line without the program
+// name), lookupEnv (normally os.LookupEnv) and the config file named by
+// either, on top of Default. Settings whose default depends on others are
+// then derived, and the result is validated. A bad value, an unknown file
+// setting or a failed validation is an error; -h returns flag.ErrHelp.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := Default()
+	c.sources = make(map[string]string)
+	for _, s := range c.settings() {
+		c.sources[s.name] = SourceDefault
+	}
+
+	flags, file, err := c.parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		file, _ = lookupEnv(FileEnv)
+	}
+	if file != "" {
+		values, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.apply(values, SourceFile); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		c.File = file
+	}
+
+	env := make(map[string]string)
+	for _, s := range c.settings() {
+		if v, ok := lookupEnv(strings.ToUpper(s.name)); ok && v != "" {
+			env[s.name] = v
+		}
+	}
+	if err := c.apply(env, SourceEnv); err != nil {
+		return nil, err
+	}
+	if err := c.apply(flags, SourceFlag); err != nil {
+		return nil, err
+	}
+
+	c.derive()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Source reports where the named setting's value came from: SourceDefault,
+// SourceFile, SourceEnv, SourceFlag or SourceDerived.
+func (c *Config) Source(name string) string {
+	if src, ok := c.sources[name]; ok {
+		return src
+	}
+	return SourceDefault
+}
+
+// IsSet reports whether the named setting was given explicitly rather than
+// left at its default.
+func (c *Config) IsSet(name string) bool {
+	src := c.Source(name)
+	return src != SourceDefault && src != SourceDerived
+}
+
+// Backends returns the names of the converter backends in use, in order:
+// those of ConverterBackends, or else ConverterBackend.
+func (c *Config) Backends() []string {
+	if len(c.ConverterBackends) == 0 {
+		return []string{c.ConverterBackend}
+	}
+	names := make([]string, len(c.ConverterBackends))
+	for i, b := range c.ConverterBackends {
+		names[i], _, _ = strings.Cut(b, ":")
+	}
+	return names
+}
+
+// derive normalizes the named choices and fills in the settings whose
+// default depends on others, unless they were set explicitly.
+func (c *Config) derive() {
+	c.ConverterBackend = strings.ToLower(c.ConverterBackend)
+	for i, b := range c.ConverterBackends {
+		c.ConverterBackends[i] = strings.ToLower(strings.TrimSpace(b))
+	}
+	c.MacroPolicy = strings.ToLower(c.MacroPolicy)
+	c.ProtectionPolicy = strings.ToLower(c.ProtectionPolicy)
+	c.OutputSink = strings.ToLower(c.OutputSink)
+	c.LogLevel = strings.ToLower(c.LogLevel)
+	c.LogFormat = strings.ToLower(c.LogFormat)
+	if !c.IsSet("max_queue_depth") {
+		c.MaxQueueDepth = 4 * c.MaxConcurrentConversions
+		c.sources["max_queue_depth"] = SourceDerived
+	}
+	if !c.IsSet("rate_limit_burst") {
+		c.RateLimitBurst = c.RateLimitPerMinute
+		c.sources["rate_limit_burst"] = SourceDerived
+	}
+	longest := max(c.RequestTimeout, c.ConvertTimeout, ConverterTimeout)
+	if !c.IsSet("write_timeout") {
+		c.sources["write_timeout"] = SourceDerived
+		// The write timeout runs from the end of the request headers until
+		// the response is written, so it covers reading the body, the
+		// longest a conversion may take and the allowance for sending the
+		// result back.
+		c.WriteTimeout = c.ReadTimeout + longest + c.WriteAllowance
+	}
+	if !c.IsSet("live_stall_timeout") {
+		// No conversion holds a worker longer than its timeouts allow, so a
+		// pool full for twice that long has leaked its slots.
+		c.sources["live_stall_timeout"] = SourceDerived
+		c.LiveStallTimeout = 2 * longest
+	}
+}
+
+// ConverterTimeout is LibreOffice's own limit on a single conversion, which
+// the derived write timeout has to cover.
+const ConverterTimeout = 60 * time.Second
+
+// setting is one field of Config.
+type setting struct {
+	name   string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// settings returns c's fields in declaration order.
+func (c *Config) settings() []setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var out []setting
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name := f.Tag.Get("config")
+		if name == "" {
+			continue
+		}
+		out = append(out, setting{
+			name:   name,
+			usage:  f.Tag.Get("usage"),
+			secret: f.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return out
+}
+
+// parseFlags parses args into raw setting values, keyed by setting name, and
+// returns the -config file separately.
+func (c *Config) parseFlags(args []string) (map[string]string, string, error) {
+	values := make(map[string]string)
+	fs := flag.NewFlagSet("docpdf-server", flag.ContinueOnError)
+	file := fs.String(FileFlag, "", "YAML (.yaml, .yml) or TOML (.toml) config file; also "+FileEnv)
+	for _, s := range c.settings() {
+		name := s.name
+		set := func(v string) error {
+			values[name] = v
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(strings.ReplaceAll(name, "_", "-"), s.usage, set)
+		} else {
+			fs.Func(strings.ReplaceAll(name, "_", "-"), s.usage, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return values, *file, nil
+}
+
+// apply sets the settings in values, recording src as their source. Unknown
+// names are an error.
+func (c *Config) apply(values map[string]string, src string) error {
+	byName := make(map[string]setting)
+	for _, s := range c.settings() {
+		byName[s.name] = s
+	}
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		raw := values[name]
+		s, ok := byName[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %q", name))
+			continue
+		}
+		if err := set(s.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		c.sources[name] = src
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+)
+
+// set parses raw into the field v according to its type.
+func set(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Type() == timeType:
+		var t time.Time
+		if raw != "" {
+			var err error
+			if t, err = time.Parse(time.DateOnly, raw); err != nil {
+				return fmt.Errorf("invalid date %q, want YYYY-MM-DD", raw)
+			}
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
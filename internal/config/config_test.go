@@ -0,0 +1,232 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/config"
+)
+
+// env returns a lookup function over vars.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := config.Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != 8080 || cfg.RequestTimeout != 2*time.Minute || cfg.LibreOfficePath != "libreoffice" {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+	if cfg.MaxQueueDepth != 4*cfg.MaxConcurrentConversions {
+		t.Errorf("max_queue_depth = %d, want 4 x %d", cfg.MaxQueueDepth, cfg.MaxConcurrentConversions)
+	}
+	if want := time.Minute + 2*time.Minute + 30*time.Second; cfg.WriteTimeout != want {
+		t.Errorf("write_timeout = %v, want %v", cfg.WriteTimeout, want)
+	}
+	if src := cfg.Source("port"); src != config.SourceDefault {
+		t.Errorf("port source = %q", src)
+	}
+	if src := cfg.Source("write_timeout"); src != config.SourceDerived {
+		t.Errorf("write_timeout source = %q", src)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := writeFile(t, "docpdf.yaml", "port: 9000\njob_workers: 4\nbatch_parallelism: 3\n")
+	cfg, err := config.Load(
+		[]string{"-config", file, "-job-workers", "8"},
+		env(map[string]string{"PORT": "9100", "JOB_WORKERS": "6"}),
+	)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.BatchParallelism != 3 || cfg.Source("batch_parallelism") != config.SourceFile {
+		t.Errorf("file value lost: %d from %s", cfg.BatchParallelism, cfg.Source("batch_parallelism"))
+	}
+	if cfg.Port != 9100 || cfg.Source("port") != config.SourceEnv {
+		t.Errorf("env should override the file: %d from %s", cfg.Port, cfg.Source("port"))
+	}
+	if cfg.JobWorkers != 8 || cfg.Source("job_workers") != config.SourceFlag {
+		t.Errorf("flag should override env: %d from %s", cfg.JobWorkers, cfg.Source("job_workers"))
+	}
+	if cfg.File != file {
+		t.Errorf("File = %q", cfg.File)
+	}
+}
+
+func TestLoad_FileFromEnv(t *testing.T) {
+	file := writeFile(t, "docpdf.toml", "port = 9000\n")
+	cfg, err := config.Load(nil, env(map[string]string{config.FileEnv: file}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != 9000 {
+		t.Errorf("port = %d, want 9000", cfg.Port)
+	}
+}
+
+func TestLoad_ExplicitValueNotDerived(t *testing.T) {
+	cfg, err := config.Load([]string{"-max-queue-depth", "0", "-rate-limit-per-minute", "60"}, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MaxQueueDepth != 0 {
+		t.Errorf("explicit max_queue_depth 0 was replaced by %d", cfg.MaxQueueDepth)
+	}
+	if cfg.RateLimitBurst != 60 {
+		t.Errorf("rate_limit_burst = %d, want the per-minute rate", cfg.RateLimitBurst)
+	}
+}
+
+func TestLoad_Types(t *testing.T) {
+	cfg, err := config.Load([]string{"-sink-path-style"}, env(map[string]string{
+		"API_V1_DEPRECATED":        "2026-01-31",
+		"API_V1_SUNSET":            "2026-06-30",
+		"WEBHOOK_ALLOWED_HOSTS":    " Hooks.Example.com, ,other.example ",
+		"BILLING_UNITS_PER_PAGE":   "0.25",
+		"MEMORY_WATCHDOG_INTERVAL": "500ms",
+		"MACRO_POLICY":             "STRIP",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.SinkPathStyle {
+		t.Error("bare boolean flag should set sink_path_style")
+	}
+	if want := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC); !cfg.APIV1Deprecated.Equal(want) {
+		t.Errorf("api_v1_deprecated = %v", cfg.APIV1Deprecated)
+	}
+	if got := strings.Join(cfg.WebhookAllowedHosts, ","); got != "hooks.example.com,other.example" {
+		t.Errorf("webhook_allowed_hosts = %q", got)
+	}
+	if cfg.BillingUnitsPerPage != 0.25 || cfg.MemoryWatchdogInterval != 500*time.Millisecond {
+		t.Errorf("unexpected values %v, %v", cfg.BillingUnitsPerPage, cfg.MemoryWatchdogInterval)
+	}
+	if cfg.MacroPolicy != "strip" {
+		t.Errorf("macro_policy = %q, want it lowercased", cfg.MacroPolicy)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	cfg, err := config.Load(nil, env(map[string]string{"CONVERTER_BACKEND": "unoserver"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Backends(); !slices.Equal(got, []string{"unoserver"}) {
+		t.Errorf("without converter_backends: %v", got)
+	}
+	cfg, err = config.Load(nil, env(map[string]string{
+		"CONVERTER_BACKENDS": "Gotenberg:DOCX+xlsx, unoserver",
+		"GOTENBERG_URL":      "http://gotenberg:3000",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Backends(); !slices.Equal(got, []string{"gotenberg", "unoserver"}) {
+		t.Errorf("with converter_backends: %v", got)
+	}
+	if got := cfg.ConverterBackends[0]; got != "gotenberg:docx+xlsx" {
+		t.Errorf("entry not normalized: %q", got)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{"bad integer", nil, map[string]string{"PORT": "http"}, []string{`port: invalid integer "http"`}},
+		{"bad duration", []string{"-job-ttl", "soon"}, nil, []string{`job_ttl: invalid duration "soon"`}},
+		{"bad date", nil, map[string]string{"API_V1_DEPRECATED": "31/01/2026"}, []string{"api_v1_deprecated: invalid date"}},
+		{"out of range", nil, map[string]string{"PORT": "70000", "CONVERT_NICE": "20"}, []string{"port: 70000", "convert_nice"}},
+		{"image dpi out of range", nil, map[string]string{"IMAGE_DPI": "20"}, []string{"image_dpi: must be 0 or 50-1200"}},
+		{"failure rate above 1", nil, map[string]string{"READY_MAX_FAILURE_RATE": "25"}, []string{"ready_max_failure_rate: must be between 0 and 1"}},
+		{"unknown choice", nil, map[string]string{"CONVERTER_BACKEND": "pandoc"}, []string{`converter_backend: "pandoc"`}},
+		{"unknown protection policy", nil, map[string]string{"PROTECTION_POLICY": "obey"}, []string{`protection_policy: "obey"`}},
+		{"unknown log level", nil, map[string]string{"LOG_LEVEL": "verbose", "LOG_FORMAT": "xml"}, []string{`log_level: "verbose"`, `log_format: "xml"`}},
+		{"scratch share too large", nil, map[string]string{"SCRATCH_DIR": "/dev/shm/docpdf", "SCRATCH_CONVERSION_MB": "1024"}, []string{"scratch_max_mb: must be at least scratch_conversion_mb"}},
+		{"missing dependency", nil, map[string]string{"OUTPUT_SINK": "dir"}, []string{"sink_dir: required"}},
+		{"pprof without token", nil, map[string]string{"PPROF_ENABLED": "true"}, []string{"pprof_enabled: requires admin_token"}},
+		{"templates without token", nil, map[string]string{"TEMPLATE_DIR": "/tmp/templates"}, []string{"template_dir: requires admin_token"}},
+		{"negative denial audit", nil, map[string]string{"DENIAL_AUDIT_SIZE": "-1"}, []string{"denial_audit_size: must not be negative"}},
+		{"unknown backend in list", nil, map[string]string{"CONVERTER_BACKENDS": "unoserver,docraptor"}, []string{`converter_backends: "docraptor" is not libreoffice, unoserver, gotenberg, pandoc or msgraph`}},
+		{"backend listed twice", nil, map[string]string{"CONVERTER_BACKENDS": "libreoffice,libreoffice:docx"}, []string{`converter_backends: "libreoffice" is listed twice`}},
+		{"empty backend type", nil, map[string]string{"CONVERTER_BACKENDS": "libreoffice:docx+"}, []string{`converter_backends: "libreoffice:docx+": want name:type+type`}},
+		{"gotenberg without url", nil, map[string]string{"CONVERTER_BACKENDS": "gotenberg,libreoffice"}, []string{"gotenberg_url: must be an http(s) URL for the gotenberg backend"}},
+		{"unknown pandoc engine", nil, map[string]string{"CONVERTER_BACKENDS": "pandoc,libreoffice", "PANDOC_PDF_ENGINE": "weasyprint"}, []string{`pandoc_pdf_engine: "weasyprint" is not pdflatex, xelatex, lualatex or wkhtmltopdf`}},
+		{"msgraph without credentials", nil, map[string]string{"CONVERTER_BACKENDS": "msgraph:docx,libreoffice", "MSGRAPH_TENANT_ID": "t"}, []string{"msgraph_drive_id: required for the msgraph backend"}},
+		{"zero failure threshold", nil, map[string]string{"BACKEND_FAILURE_THRESHOLD": "0"}, []string{"backend_failure_threshold: must be at least 1"}},
+		{"zero backend cooldown", nil, map[string]string{"BACKEND_COOLDOWN": "0s"}, []string{"backend_cooldown: must be positive"}},
+		{"negative capture retain", nil, map[string]string{"CAPTURE_RETAIN": "-1"}, []string{"capture_retain: must not be negative"}},
+		{"zero capture size", nil, map[string]string{"CAPTURE_MAX_MB": "0"}, []string{"capture_max_mb: must be at least 1"}},
+		{"zero capture ttl", nil, map[string]string{"CAPTURE_TTL": "0s"}, []string{"capture_ttl: must be positive"}},
+		{"unknown sandbox", nil, map[string]string{"SANDBOX": "chroot"}, []string{`sandbox: "chroot" is not bwrap, nsjail or unshare`}},
+		{"sandboxed unoserver", nil, map[string]string{"SANDBOX": "bwrap", "CONVERTER_BACKEND": "unoserver"}, []string{"sandbox: cannot confine the unoserver backend"}},
+		{"sandboxed unoserver fallback", nil, map[string]string{"SANDBOX": "bwrap", "CONVERTER_BACKENDS": "libreoffice,unoserver"}, []string{"sandbox: cannot confine the unoserver backend"}},
+		{"negative sandbox limit", nil, map[string]string{"SANDBOX_MEMORY_MB": "-1"}, []string{"sandbox_memory_mb: must not be negative"}},
+		{"negative convert limit", nil, map[string]string{"CONVERT_MAX_RSS_MB": "-1"}, []string{"convert_max_rss_mb: must not be negative"}},
+		{"negative convert free disk", nil, map[string]string{"CONVERT_MIN_FREE_DISK_MB": "-1"}, []string{"convert_min_free_disk_mb: must not be negative"}},
+		{"negative convert retries", nil, map[string]string{"CONVERT_RETRIES": "-1"}, []string{"convert_retries: must not be negative"}},
+		{"unknown convert retry error", nil, map[string]string{"CONVERT_RETRY_ON": "failed,crash"}, []string{`convert_retry_on: "crash" is not failed, no_output or timeout`}},
+		{"no package entries", nil, map[string]string{"PACKAGE_MAX_ENTRIES": "0"}, []string{"package_max_entries: must be positive"}},
+		{"no package size", nil, map[string]string{"PACKAGE_MAX_UNCOMPRESSED_MB": "-1"}, []string{"package_max_uncompressed_mb: must be positive"}},
+		{"sunset before deprecation", nil, map[string]string{"API_V1_DEPRECATED": "2026-06-01", "API_V1_SUNSET": "2026-01-01"}, []string{"api_v1_sunset: before"}},
+		{"temp age within a request", nil, map[string]string{"TEMP_MAX_AGE": "1m", "REQUEST_TIMEOUT": "2m"}, []string{"temp_max_age: must exceed request_timeout"}},
+		{"negative duration", nil, map[string]string{"READ_TIMEOUT": "-1s"}, []string{"read_timeout: must not be negative"}},
+		{"relative URL", nil, map[string]string{"API_V1_DEPRECATION_LINK": "/docs"}, []string{"api_v1_deprecation_link"}},
+		{"redis URL without a rate", nil, map[string]string{"RATE_LIMIT_REDIS_URL": "http://cache:6379"}, []string{"rate_limit_redis_url: must be a redis://", "rate_limit_redis_url: requires rate_limit_per_minute"}},
+		{"bad OTLP header", nil, map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "x-team=a,api-key"}, []string{"otel_exporter_otlp_headers", "entry 2"}},
+		{"unknown flag", []string{"-nope"}, nil, []string{"flag provided but not defined"}},
+		{"stray argument", []string{"extra"}, nil, []string{`unexpected argument "extra"`}},
+		{"missing file", []string{"-config", "/does/not/exist.yaml"}, nil, []string{"reading config file"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := config.Load(tc.args, env(tc.env))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_OTLPHeadersErrorHidesSecret(t *testing.T) {
+	_, err := config.Load(nil, env(map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "Bearer sk-live-0123456789"}))
+	if err == nil || strings.Contains(err.Error(), "sk-live") {
+		t.Errorf("got %v, want an error without the header value", err)
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	if _, err := config.Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+}
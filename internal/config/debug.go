@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Redacted replaces the value of a secret setting that is set.
+const Redacted = "[redacted]"
+
+// Setting is one entry of the /debug/config dump.
+type Setting struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// Dump returns every setting by name, with secrets replaced by Redacted.
+// Durations are rendered as Go duration strings and dates as YYYY-MM-DD.
+func (c *Config) Dump() map[string]Setting {
+	out := make(map[string]Setting)
+	for _, s := range c.settings() {
+		var v any
+		switch x := s.value.Interface().(type) {
+		case time.Duration:
+			v = x.String()
+		case time.Time:
+			v = ""
+			if !x.IsZero() {
+				v = x.Format(time.DateOnly)
+			}
+		default:
+			v = x
+		}
+		if s.secret && !s.value.IsZero() {
+			v = Redacted
+		}
+		if s.value.Kind() == reflect.Slice && s.value.IsNil() {
+			v = []string{}
+		}
+		out[s.name] = Setting{Value: v, Source: c.Source(s.name)}
+	}
+	return out
+}
+
+// ServeHTTP serves GET /debug/config: the config file, if any, and every
+// setting with where its value came from, secrets redacted.
+func (c *Config) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"file":     c.File,
+		"settings": c.Dump(),
+	})
+}
@@ -0,0 +1,51 @@
+package config_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/config"
+)
+
+func TestServeHTTP_Redacts(t *testing.T) {
+	cfg, err := config.Load([]string{"-admin-token", "s3cret-admin"}, env(map[string]string{
+		"API_KEYS":          "ci:s3cret-key",
+		"SINK_ACCESS_KEY":   "AKIAEXAMPLE",
+		"API_V1_DEPRECATED": "2026-01-31",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	cfg.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if strings.Contains(rr.Body.String(), "s3cret") {
+		t.Fatalf("secret leaked: %s", rr.Body.String())
+	}
+
+	var body struct {
+		Settings map[string]config.Setting `json:"settings"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for name, want := range map[string]config.Setting{
+		"admin_token":       {Value: config.Redacted, Source: config.SourceFlag},
+		"api_keys":          {Value: config.Redacted, Source: config.SourceEnv},
+		"webhook_secret":    {Value: "", Source: config.SourceDefault},
+		"sink_access_key":   {Value: "AKIAEXAMPLE", Source: config.SourceEnv},
+		"request_timeout":   {Value: "2m0s", Source: config.SourceDefault},
+		"api_v1_deprecated": {Value: "2026-01-31", Source: config.SourceEnv},
+		"port":              {Value: float64(8080), Source: config.SourceDefault},
+	} {
+		if got := body.Settings[name]; got != want {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFile reads a config file into raw setting values. The format follows
+// the extension: .yaml or .yml, or .toml. Only what settings need is
+// understood: scalar values, lists (joined with commas) and one level of
+// grouping, whose name prefixes the settings in it, so
+//
+//	sink:
+//	  bucket: results
+//
+// in YAML and
+//
+//	[sink]
+//	bucket = "results"
+//
+// in TOML both set sink_bucket.
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+
+	var parse func(*bufio.Scanner) (map[string]string, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		parse = parseYAML
+	case ".toml":
+		parse = parseTOML
+	default:
+		return nil, fmt.Errorf("config file %s: unknown format, want .yaml, .yml or .toml", path)
+	}
+	values, err := parse(bufio.NewScanner(f))
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// parseYAML reads "key: value" lines, with a key without a value opening a
+// group for the indented lines below it. A group's lines may also be list
+// items ("- value").
+func parseYAML(sc *bufio.Scanner) (map[string]string, error) {
+	values := make(map[string]string)
+	var group, listKey string
+	for n := 1; sc.Scan(); n++ {
+		line := stripComment(sc.Text())
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "---" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		line = strings.TrimSpace(line)
+
+		if item, ok := strings.CutPrefix(line, "- "); ok && listKey != "" {
+			v, err := unquote(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if values[listKey] != "" {
+				values[listKey] += ","
+			}
+			values[listKey] += v
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key = strings.TrimSpace(key)
+		raw = strings.TrimSpace(raw)
+		if !indented {
+			group = ""
+		}
+		name := key
+		if group != "" {
+			name = group + "_" + key
+		}
+
+		if raw == "" {
+			// Either a group or a list follows; which one depends on
+			// the next lines.
+			if !indented {
+				group = key
+			}
+			listKey = name
+			continue
+		}
+		listKey = ""
+		if strings.HasPrefix(raw, "[") {
+			v, err := inlineList(raw)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			values[name] = v
+			continue
+		}
+		v, err := unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[name] = v
+	}
+	return values, sc.Err()
+}
+
+// parseTOML reads "key = value" lines, with "[table]" headers grouping the
+// keys below them.
+func parseTOML(sc *bufio.Scanner) (map[string]string, error) {
+	values := make(map[string]string)
+	var group string
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: bad table header", n)
+			}
+			group = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		name := strings.TrimSpace(key)
+		if group != "" {
+			name = group + "_" + name
+		}
+		raw = strings.TrimSpace(raw)
+		var (
+			v   string
+			err error
+		)
+		if strings.HasPrefix(raw, "[") {
+			v, err = inlineList(raw)
+		} else {
+			v, err = unquote(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[name] = v
+	}
+	return values, sc.Err()
+}
+
+// inlineList joins the items of a "[a, b]" list with commas.
+func inlineList(raw string) (string, error) {
+	if !strings.HasSuffix(raw, "]") {
+		return "", fmt.Errorf("unterminated list %s", raw)
+	}
+	var items []string
+	for _, item := range strings.Split(raw[1:len(raw)-1], ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := unquote(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, v)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// unquote returns a value without its quotes; bare values are taken as is.
+func unquote(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("bad string %s", raw)
+		}
+		return v, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("bad string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	}
+	return raw, nil
+}
+
+// stripComment removes a "#" comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
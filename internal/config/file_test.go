@@ -0,0 +1,95 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/config"
+)
+
+func TestLoad_YAMLFile(t *testing.T) {
+	file := writeFile(t, "docpdf.yml", `# docpdf settings
+---
+port: 9000
+request_timeout: 90s   # trailing comment
+libreoffice_path: "/opt/libre office/soffice"
+api_v1_deprecation_link: 'https://example.com/#v2'
+sink:
+  bucket: results
+  path_style: true
+webhook_allowed_hosts:
+  - a.example
+  - "b.example"
+allowed_input_types: [docx, odt]
+`)
+	cfg, err := config.Load([]string{"-config", file}, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != 9000 || cfg.RequestTimeout != 90*time.Second {
+		t.Errorf("port %d, request_timeout %v", cfg.Port, cfg.RequestTimeout)
+	}
+	if cfg.LibreOfficePath != "/opt/libre office/soffice" || cfg.APIV1DeprecationLink != "https://example.com/#v2" {
+		t.Errorf("quoted values: %q, %q", cfg.LibreOfficePath, cfg.APIV1DeprecationLink)
+	}
+	if cfg.SinkBucket != "results" || !cfg.SinkPathStyle {
+		t.Errorf("grouped values: %q, %v", cfg.SinkBucket, cfg.SinkPathStyle)
+	}
+	if got := strings.Join(cfg.WebhookAllowedHosts, ","); got != "a.example,b.example" {
+		t.Errorf("block list = %q", got)
+	}
+	if cfg.AllowedInputTypes != "docx,odt" {
+		t.Errorf("inline list = %q", cfg.AllowedInputTypes)
+	}
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	file := writeFile(t, "docpdf.toml", `# docpdf settings
+port = 9000
+request_timeout = "90s"
+webhook_allowed_hosts = ["a.example", "b.example"]
+
+[sink]
+bucket = "results" # comment
+path_style = true
+
+[billing]
+units_per_page = 0.5
+`)
+	cfg, err := config.Load([]string{"-config", file}, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != 9000 || cfg.RequestTimeout != 90*time.Second {
+		t.Errorf("port %d, request_timeout %v", cfg.Port, cfg.RequestTimeout)
+	}
+	if cfg.SinkBucket != "results" || !cfg.SinkPathStyle || cfg.BillingUnitsPerPage != 0.5 {
+		t.Errorf("table values: %q, %v, %v", cfg.SinkBucket, cfg.SinkPathStyle, cfg.BillingUnitsPerPage)
+	}
+	if got := strings.Join(cfg.WebhookAllowedHosts, ","); got != "a.example,b.example" {
+		t.Errorf("list = %q", got)
+	}
+}
+
+func TestLoad_BadFiles(t *testing.T) {
+	cases := map[string]struct {
+		name, content, want string
+	}{
+		"unknown setting": {"c.yaml", "prot: 9000\n", `unknown setting "prot"`},
+		"bad value":       {"c.toml", "port = \"http\"\n", "port: invalid integer"},
+		"not key value":   {"c.yaml", "port 9000\n", "line 1: expected key: value"},
+		"bad table":       {"c.toml", "[sink\n", "line 1: bad table header"},
+		"bad string":      {"c.toml", "sink_dir = \"/tmp\n", "line 1: bad string"},
+		"unknown format":  {"c.json", "{}", "unknown format"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			file := writeFile(t, tc.name, tc.content)
+			_, err := config.Load([]string{"-config", file}, env(nil))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error mentioning %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
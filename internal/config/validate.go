@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Validate checks the settings against each other and their allowed ranges,
+// returning every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port: %d is not a valid port", c.Port)
+	check(c.MaxConcurrentConversions >= 1, "max_concurrent_conversions: must be at least 1")
+	check(c.MaxQueueDepth >= 0, "max_queue_depth: must not be negative")
+	check(c.BatchParallelism >= 1, "batch_parallelism: must be at least 1")
+	check(c.PostProcessWorkers >= 1, "postprocess_workers: must be at least 1")
+	check(c.JobWorkers >= 1, "job_workers: must be at least 1")
+	check(c.JobQueueDepth >= 0, "job_queue_depth: must not be negative")
+	if slices.Contains(c.Backends(), "unoserver") {
+		check(c.UnoserverBasePort > 0 && c.UnoserverBasePort+2*c.MaxConcurrentConversions <= 65536,
+			"unoserver_base_port: %d leaves no room for %d instances", c.UnoserverBasePort, c.MaxConcurrentConversions)
+	}
+	check(c.ReadyMaxQueueDepth >= 0, "ready_max_queue_depth: must not be negative")
+	check(c.ReadyMaxFailureRate >= 0 && c.ReadyMaxFailureRate <= 1, "ready_max_failure_rate: must be between 0 and 1")
+	check(c.ReadyMinFreeDiskMB >= 0, "ready_min_free_disk_mb: must not be negative")
+	if c.ScratchDir != "" {
+		check(c.ScratchConversionMB >= 1, "scratch_conversion_mb: must be at least 1")
+		check(c.ScratchMaxMB >= c.ScratchConversionMB, "scratch_max_mb: must be at least scratch_conversion_mb")
+	}
+	check(!c.PprofEnabled || c.AdminToken != "", "pprof_enabled: requires admin_token")
+	check(c.TemplateDir == "" || c.AdminToken != "", "template_dir: requires admin_token")
+	check(c.DenialAuditSize >= 0, "denial_audit_size: must not be negative")
+	check(c.CaptureRetain >= 0, "capture_retain: must not be negative")
+	if c.CaptureRetain > 0 {
+		check(c.CaptureMaxMB >= 1, "capture_max_mb: must be at least 1")
+		check(c.CaptureTTL > 0, "capture_ttl: must be positive")
+	}
+	check(c.PackageMaxEntries > 0, "package_max_entries: must be positive")
+	check(c.PackageMaxUncompressedMB > 0, "package_max_uncompressed_mb: must be positive")
+	check(c.MinTransferKBps >= 0, "min_transfer_kbps: must not be negative")
+	check(c.ImageDPI == 0 || (c.ImageDPI >= 50 && c.ImageDPI <= 1200), "image_dpi: must be 0 or 50-1200")
+	check(c.CacheMaxMB >= 0, "cache_max_mb: must not be negative")
+	check(c.AffinityCookie == "" || c.Affinity, "affinity_cookie: requires affinity")
+	check(c.RateLimitPerMinute >= 0, "rate_limit_per_minute: must not be negative")
+	check(c.RateLimitBurst >= 0, "rate_limit_burst: must not be negative")
+	check(c.EgressCapGB >= 0, "egress_cap_gb: must not be negative")
+	if c.RateLimitRedisURL != "" {
+		u, err := url.Parse(c.RateLimitRedisURL)
+		check(err == nil && (u.Scheme == "redis" || u.Scheme == "rediss") && u.Host != "",
+			"rate_limit_redis_url: must be a redis:// or rediss:// URL")
+		check(c.RateLimitPerMinute > 0, "rate_limit_redis_url: requires rate_limit_per_minute")
+	}
+	check(c.MemoryWatchdogThreshold >= 0 && c.MemoryWatchdogThreshold <= 100,
+		"memory_watchdog_threshold: must be a percentage (0-100)")
+	check(c.TempMaxAge == 0 || c.TempMaxAge > c.RequestTimeout, "temp_max_age: must exceed request_timeout")
+	check(c.TempOrphanAge >= 0, "temp_orphan_age: must not be negative")
+	check(c.ConvertNice >= 0 && c.ConvertNice <= 19, "convert_nice: must be 0-19")
+	check(c.ConvertIoniceClass >= 0 && c.ConvertIoniceClass <= 3, "convert_ionice_class: must be 0-3")
+	check(c.ConvertIoniceLevel >= 0 && c.ConvertIoniceLevel <= 7, "convert_ionice_level: must be 0-7")
+
+	for _, s := range c.settings() {
+		if d, ok := s.value.Interface().(time.Duration); ok {
+			check(d >= 0, "%s: must not be negative", s.name)
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"request_timeout", c.RequestTimeout},
+		{"ready_check_interval", c.ReadyCheckInterval},
+		{"live_stall_timeout", c.LiveStallTimeout},
+		{"ready_failure_window", c.ReadyFailureWindow},
+		{"min_transfer_window", c.MinTransferWindow},
+		{"memory_watchdog_interval", c.MemoryWatchdogInterval},
+		{"stats_flush_interval", c.StatsFlushInterval},
+		{"egress_flush_interval", c.EgressFlushInterval},
+		{"job_ttl", c.JobTTL},
+		{"billing_interval", c.BillingInterval},
+		{"backend_cooldown", c.BackendCooldown},
+	} {
+		check(d.value != 0, "%s: must be positive", d.name)
+	}
+	check(c.SinkURLTTL > 0 && c.SinkURLTTL <= 7*24*time.Hour, "sink_url_ttl: must be positive and at most 7 days")
+
+	check(slices.Contains([]string{"libreoffice", "unoserver"}, c.ConverterBackend),
+		"converter_backend: %q is not libreoffice or unoserver", c.ConverterBackend)
+	check(slices.Contains([]string{"", "bwrap", "nsjail", "unshare"}, c.Sandbox),
+		"sandbox: %q is not bwrap, nsjail or unshare", c.Sandbox)
+	// The sandbox wraps each soffice the libreoffice backend spawns;
+	// unoserver's long-lived soffice would run outside it.
+	check(c.Sandbox == "" || !slices.Contains(c.Backends(), "unoserver"),
+		"sandbox: cannot confine the unoserver backend")
+	seen := map[string]bool{}
+	for _, b := range c.ConverterBackends {
+		name, types, typed := strings.Cut(b, ":")
+		check(slices.Contains([]string{"libreoffice", "unoserver", "gotenberg", "pandoc", "msgraph"}, name),
+			"converter_backends: %q is not libreoffice, unoserver, gotenberg, pandoc or msgraph", name)
+		check(!seen[name], "converter_backends: %q is listed twice", name)
+		check(!typed || !slices.Contains(strings.Split(types, "+"), ""), "converter_backends: %q: want name:type+type", b)
+		seen[name] = true
+	}
+	if slices.Contains(c.Backends(), "gotenberg") {
+		u, err := url.Parse(c.GotenbergURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"gotenberg_url: must be an http(s) URL for the gotenberg backend")
+	}
+	check(!slices.Contains(c.Backends(), "pandoc") || slices.Contains([]string{"pdflatex", "xelatex", "lualatex", "wkhtmltopdf"}, c.PandocPDFEngine),
+		"pandoc_pdf_engine: %q is not pdflatex, xelatex, lualatex or wkhtmltopdf", c.PandocPDFEngine)
+	check(!slices.Contains(c.Backends(), "msgraph") || c.MSGraphTenantID != "" && c.MSGraphClientID != "" && c.MSGraphClientSecret != "" && c.MSGraphDriveID != "",
+		"msgraph_tenant_id, msgraph_client_id, msgraph_client_secret, msgraph_drive_id: required for the msgraph backend")
+	check(c.BackendFailureThreshold >= 1, "backend_failure_threshold: must be at least 1")
+	check(c.SandboxUID >= 0 && c.SandboxGID >= 0, "sandbox_uid, sandbox_gid: must not be negative")
+	check(c.ConvertCPUSeconds >= 0, "convert_cpu_seconds: must not be negative")
+	check(c.ConvertMaxRSSMB >= 0, "convert_max_rss_mb: must not be negative")
+	check(c.ConvertMaxOutputMB >= 0, "convert_max_output_mb: must not be negative")
+	check(c.ConvertMinFreeDiskMB >= 0, "convert_min_free_disk_mb: must not be negative")
+	check(c.ConvertRetries >= 0, "convert_retries: must not be negative")
+	for _, kind := range c.ConvertRetryOn {
+		check(slices.Contains([]string{"failed", "no_output", "timeout"}, kind),
+			"convert_retry_on: %q is not failed, no_output or timeout", kind)
+	}
+	check(c.SandboxCPUSeconds >= 0, "sandbox_cpu_seconds: must not be negative")
+	check(c.SandboxMemoryMB >= 0, "sandbox_memory_mb: must not be negative")
+	check(slices.Contains([]string{"", "reject", "strip", "allow"}, c.MacroPolicy),
+		"macro_policy: %q is not reject, strip or allow", c.MacroPolicy)
+	check(slices.Contains([]string{"", "honor", "ignore", "warn"}, c.ProtectionPolicy),
+		"protection_policy: %q is not honor, ignore or warn", c.ProtectionPolicy)
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, c.LogLevel),
+		"log_level: %q is not debug, info, warn or error", c.LogLevel)
+	check(slices.Contains([]string{"json", "text"}, c.LogFormat),
+		"log_format: %q is not json or text", c.LogFormat)
+	switch c.OutputSink {
+	case "":
+	case "s3", "gcs":
+		check(c.SinkBucket != "", "sink_bucket: required for output_sink %s", c.OutputSink)
+	case "dir":
+		check(c.SinkDir != "", "sink_dir: required for output_sink dir")
+	default:
+		check(false, "output_sink: %q is not s3, gcs or dir", c.OutputSink)
+	}
+
+	if c.APIV1Deprecated.IsZero() {
+		check(c.APIV1Sunset.IsZero(), "api_v1_sunset: requires api_v1_deprecated")
+	} else if !c.APIV1Sunset.IsZero() {
+		check(!c.APIV1Sunset.Before(c.APIV1Deprecated), "api_v1_sunset: before api_v1_deprecated")
+	}
+	for _, link := range []struct{ name, value string }{
+		{"api_v1_deprecation_link", c.APIV1DeprecationLink},
+		{"sink_endpoint", c.SinkEndpoint},
+		{"sink_base_url", c.SinkBaseURL},
+		{"otel_exporter_otlp_endpoint", c.OTelExporterOTLPEndpoint},
+	} {
+		if link.value != "" {
+			u, err := url.Parse(link.value)
+			check(err == nil && u.Scheme != "" && u.Host != "", "%s: %q is not an absolute URL", link.name, link.value)
+		}
+	}
+
+	// The headers carry credentials, so a bad entry is reported by its
+	// position only.
+	for i, pair := range strings.Split(c.OTelExporterOTLPHeaders, ",") {
+		k, _, ok := strings.Cut(pair, "=")
+		check(strings.TrimSpace(pair) == "" || (ok && strings.TrimSpace(k) != ""),
+			"otel_exporter_otlp_headers: entry %d is not key=value", i+1)
+	}
+
+	check(c.BillingUnitsPerSecond >= 0 && c.BillingUnitsPerPage >= 0 && c.BillingUnitsPerConversion >= 0,
+		"billing_units_per_*: must not be negative")
+	return errors.Join(errs...)
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -22,23 +24,263 @@ var (
 
 	// ErrConversionFailed is returned when LibreOffice exits with a non-zero status.
 	ErrConversionFailed = errors.New("conversion failed")
+
+	// ErrUnsupportedFormat is returned when the requested output format cannot
+	// be produced from the input's document family.
+	ErrUnsupportedFormat = errors.New("unsupported output format")
+)
+
+// Output formats accepted in Options.Format.
+const (
+	FormatPDF  = "pdf"
+	FormatPNG  = "png"
+	FormatHTML = "html"
+	FormatTXT  = "txt"
+	FormatDOCX = "docx"
 )
 
-// Converter converts a .docx file to PDF.
+// Document families, keyed by input extension. LibreOffice needs a different
+// export filter for each; without an explicit filter it guesses from the
+// loaded component, which is unreliable for spreadsheets and slide decks.
+const (
+	familyWriter  = "writer"
+	familyCalc    = "calc"
+	familyImpress = "impress"
+)
+
+var families = map[string]string{
+	".docx": familyWriter,
+	".odt":  familyWriter,
+	".rtf":  familyWriter,
+	".txt":  familyWriter,
+	".md":   familyWriter,
+	".xlsx": familyCalc,
+	".ods":  familyCalc,
+	".pptx": familyImpress,
+	".odp":  familyImpress,
+}
+
+// importExts maps the extensions of inputs LibreOffice has no import filter
+// for to the one it should read them as: Markdown is plain text to it.
+var importExts = map[string]string{
+	".md": ".txt",
+}
+
+// importable returns inputPath, or for an input LibreOffice reads under
+// another extension (see importExts) a link to it named so, in a
+// subdirectory of outDir so as not to be overwritten by the result.
+func importable(inputPath, outDir string) (string, error) {
+	ext := filepath.Ext(inputPath)
+	as, ok := importExts[strings.ToLower(ext)]
+	if !ok {
+		return inputPath, nil
+	}
+	dir := filepath.Join(outDir, "import")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	linked := filepath.Join(dir, strings.TrimSuffix(filepath.Base(inputPath), ext)+as)
+	if err := os.Link(inputPath, linked); err != nil {
+		return "", err
+	}
+	return linked, nil
+}
+
+// exportFilters maps output format → document family → --convert-to value.
+// A missing family entry means the combination is unsupported.
+var exportFilters = map[string]map[string]string{
+	FormatPDF: {
+		familyWriter:  "pdf:writer_pdf_Export",
+		familyCalc:    "pdf:calc_pdf_Export",
+		familyImpress: "pdf:impress_pdf_Export",
+	},
+	FormatPNG: {
+		familyWriter:  "png:writer_png_Export",
+		familyCalc:    "png:calc_png_Export",
+		familyImpress: "png:impress_png_Export",
+	},
+	FormatHTML: {
+		familyWriter:  "html:XHTML Writer File:UTF8",
+		familyCalc:    "html:HTML (StarCalc)",
+		familyImpress: "html:impress_html_Export",
+	},
+	FormatTXT: {
+		familyWriter: "txt:Text (encoded):UTF8",
+	},
+	FormatDOCX: {
+		familyWriter: "docx:MS Word 2007 XML",
+	},
+}
+
+// contentTypes maps each output format to the media type of its files.
+var contentTypes = map[string]string{
+	FormatPDF:  "application/pdf",
+	FormatPNG:  "image/png",
+	FormatHTML: "text/html; charset=utf-8",
+	FormatTXT:  "text/plain; charset=utf-8",
+	FormatDOCX: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+// ContentType returns the media type for files produced in format, or "" if
+// the format is unknown.
+func ContentType(format string) string { return contentTypes[format] }
+
+// Supports reports whether an input with extension ext can be converted to
+// format. Unknown extensions support only PDF (LibreOffice picks the filter).
+func Supports(ext, format string) bool {
+	filters, ok := exportFilters[format]
+	if !ok {
+		return false
+	}
+	family, known := families[strings.ToLower(ext)]
+	if !known {
+		return format == FormatPDF
+	}
+	_, ok = filters[family]
+	return ok
+}
+
+// TextFormat returns the output format the text of an input with extension
+// ext is extracted through, each a single file: FormatTXT for text
+// documents, or FormatHTML when structured is set, to keep headings, lists
+// and tables apart; FormatHTML for spreadsheets. ok is false for
+// presentations, whose HTML export is a page per slide, and unknown types.
+func TextFormat(ext string, structured bool) (format string, ok bool) {
+	switch families[strings.ToLower(ext)] {
+	case familyWriter:
+		if structured {
+			return FormatHTML, true
+		}
+		return FormatTXT, true
+	case familyCalc:
+		return FormatHTML, true
+	}
+	return "", false
+}
+
+// Options controls a single conversion. The zero value converts to PDF.
+type Options struct {
+	// Format is the output format (FormatPDF, FormatPNG, ...). Empty means PDF.
+	Format string
+	// PDFVersion is the PDF version to produce, one of PDFVersions. Empty
+	// leaves it to LibreOffice. Only valid for PDF output.
+	PDFVersion string `json:",omitempty"`
+	// Pages selects the pages to export, e.g. "1-3,7" (see ParsePageRange).
+	// Empty exports all of them. Only valid for PDF output.
+	Pages string `json:",omitempty"`
+	// ImageDPI downsamples images above this many dots per inch, from
+	// MinImageDPI to MaxImageDPI. 0 keeps them at their own resolution. Only
+	// valid for PDF output.
+	ImageDPI int `json:",omitempty"`
+	// Orientation, OrientationPortrait or OrientationLandscape, turns every
+	// page of the document before it is converted. Empty keeps the
+	// document's own. Only valid where SupportsOrientation.
+	Orientation string `json:",omitempty"`
+	// NamedDestinations exports the document's bookmarks, and so the
+	// targets of its cross-references, as PDF named destinations that
+	// links from outside the PDF can point at (file.pdf#name).
+	NamedDestinations bool `json:",omitempty"`
+	// ConvertLinks points links to other documents at their PDF instead
+	// (manual.odt becomes manual.pdf) and keeps relative links relative,
+	// for documents converted as a set.
+	ConvertLinks bool `json:",omitempty"`
+	// UserPassword encrypts the PDF so it opens only with this password.
+	// Only valid for PDF output other than PDF/A.
+	UserPassword string `json:",omitempty"`
+	// OwnerPassword restricts the PDF's permissions (printing, changes,
+	// copying) until it is given. Only valid for PDF output other than
+	// PDF/A.
+	OwnerPassword string `json:",omitempty"`
+	// Preview trades quality for speed, for a first look at a document:
+	// images are downsampled to PreviewImageDPI and compressed harder, and
+	// bookmarks and notes are left out. Only valid for PDF output.
+	Preview bool `json:",omitempty"`
+}
+
+// Encrypted reports whether o produces a password-protected PDF.
+func (o Options) Encrypted() bool { return o.UserPassword != "" || o.OwnerPassword != "" }
+
+// String formats o with the passwords redacted, so Options can be logged or
+// put in an error safely.
+func (o Options) String() string {
+	for _, p := range []*string{&o.UserPassword, &o.OwnerPassword} {
+		if *p != "" {
+			*p = "[redacted]"
+		}
+	}
+	type options Options // without the String method
+	return fmt.Sprintf("%+v", options(o))
+}
+
+// LogValue implements slog.LogValuer, redacting the passwords.
+func (o Options) LogValue() slog.Value { return slog.StringValue(o.String()) }
+
+// Converter converts a document to PDF.
 type Converter interface {
-	// Convert converts the file at inputPath, writing the PDF to outDir.
-	// Returns the absolute path of the generated PDF on success.
-	Convert(ctx context.Context, inputPath string, outDir string) (string, error)
+	// Convert converts the file at inputPath, writing the result to outDir.
+	// Returns the absolute path of the generated file on success.
+	Convert(ctx context.Context, inputPath string, outDir string, opts Options) (string, error)
 }
 
 // LibreOffice implements Converter by shelling out to LibreOffice.
 type LibreOffice struct {
 	BinaryPath string
 	Timeout    time.Duration
+
+	// Priority lowers the scheduling priority of each LibreOffice process so
+	// the HTTP serving path stays responsive while conversions grind. The zero
+	// value runs soffice at normal priority.
+	Priority Priority
+
+	// Profile, if set, is copied into each conversion's fresh user profile.
+	Profile *ProfileTemplate
+
+	// Sandbox, if set, confines each LibreOffice process (see Sandboxed).
+	Sandbox *Sandbox
+
+	// Limits caps the CPU time, memory and output size of each LibreOffice
+	// process; a conversion that hits one fails with ErrResourceLimit.
+	Limits Limits
+}
+
+// Priority configures the CPU and I/O priority of conversion subprocesses.
+// Each non-zero field wraps the command in the corresponding utility, which
+// must be on PATH: taskset (CPUSet), ionice (IOClass), nice (Nice). All three
+// exec the target in place, so timeouts still kill soffice itself.
+type Priority struct {
+	// Nice is the niceness increment (1–19). 0 leaves it unchanged.
+	Nice int
+	// IOClass is the ionice scheduling class: 1 realtime, 2 best-effort,
+	// 3 idle. 0 leaves it unchanged.
+	IOClass int
+	// IOLevel is the best-effort priority level (0–7), used when IOClass is 2.
+	IOLevel int
+	// CPUSet pins soffice to a CPU list in taskset syntax (e.g. "2-3").
+	CPUSet string
+}
+
+// wrap returns argv prefixed with the priority wrappers.
+func (p Priority) wrap(argv []string) []string {
+	var prefix []string
+	if p.CPUSet != "" {
+		prefix = append(prefix, "taskset", "-c", p.CPUSet)
+	}
+	if p.IOClass != 0 {
+		prefix = append(prefix, "ionice", "-c", strconv.Itoa(p.IOClass))
+		if p.IOClass == 2 {
+			prefix = append(prefix, "-n", strconv.Itoa(p.IOLevel))
+		}
+	}
+	if p.Nice != 0 {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(p.Nice))
+	}
+	return append(prefix, argv...)
 }
 
 // New returns a LibreOffice converter configured from the environment.
-// LIBREOFFICE_PATH overrides the default binary name "libreoffice".
+// LIBREOFFICE_PATH overrides the default binary name "libreoffice";
+// CONVERT_NICE, CONVERT_IONICE_CLASS, CONVERT_IONICE_LEVEL and CONVERT_CPUSET
+// set the subprocess Priority.
 func New() *LibreOffice {
 	bin := os.Getenv("LIBREOFFICE_PATH")
 	if bin == "" {
@@ -47,46 +289,189 @@ func New() *LibreOffice {
 	return &LibreOffice{
 		BinaryPath: bin,
 		Timeout:    60 * time.Second,
+		Priority: Priority{
+			Nice:    envInt("CONVERT_NICE"),
+			IOClass: envInt("CONVERT_IONICE_CLASS"),
+			IOLevel: envInt("CONVERT_IONICE_LEVEL"),
+			CPUSet:  os.Getenv("CONVERT_CPUSET"),
+		},
 	}
 }
 
-// Convert implements Converter.
-func (lo *LibreOffice) Convert(ctx context.Context, inputPath string, outDir string) (string, error) {
+// envInt returns the integer value of the named env var, or 0.
+func envInt(name string) int {
+	n, _ := strconv.Atoi(os.Getenv(name))
+	return n
+}
+
+// waitDelay bounds how long Convert waits for output pipes to close after the
+// LibreOffice process has exited or been killed.
+const waitDelay = 5 * time.Second
+
+// target is where and how a single conversion writes its result.
+type target struct {
+	// convertTo is the LibreOffice --convert-to value: "<ext>[:<filter>[:<options>]]".
+	convertTo string
+	// filterOptions are the export filter options in convertTo, for
+	// backends that take them separately.
+	filterOptions []filterOption
+	resultDir     string
+	outPath       string
+}
+
+// planTarget validates opts against inputPath and resolves the export filter
+// and output location.
+func planTarget(inputPath, outDir string, opts Options) (target, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatPDF
+	}
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	if !Supports(ext, format) {
+		return target{}, ErrUnsupportedFormat
+	}
+	convertTo := format
+	family, known := families[ext]
+	if known {
+		convertTo = exportFilters[format][family]
+	}
+	filterOpts, err := exportOptions(format, known, opts)
+	if err != nil {
+		return target{}, err
+	}
+	if len(filterOpts) > 0 {
+		convertTo += ":" + filterOptionsJSON(filterOpts)
+	}
+	switch opts.Orientation {
+	case "":
+	case OrientationPortrait, OrientationLandscape:
+		if !SupportsOrientation(ext) {
+			return target{}, ErrUnsupportedFormat
+		}
+	default:
+		return target{}, ErrUnsupportedFormat
+	}
+
+	// Converting to the input's own format (docx → docx) would overwrite the
+	// input in place, so write the result to a subdirectory instead.
+	resultDir := outDir
+	if ext == "."+format {
+		resultDir = filepath.Join(outDir, "out")
+	}
+
+	// LibreOffice names the output after the input file with the format's
+	// extension.
+	base := filepath.Base(inputPath)
+	outName := strings.TrimSuffix(base, filepath.Ext(base)) + "." + format
+	return target{
+		convertTo:     convertTo,
+		filterOptions: filterOpts,
+		resultDir:     resultDir,
+		outPath:       filepath.Join(resultDir, outName),
+	}, nil
+}
+
+// checkOutput returns path if it names a non-empty file, or ErrNoOutput.
+func checkOutput(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return "", ErrNoOutput
+	}
+	return path, nil
+}
+
+// Convert implements Converter. The soffice run is traced as a
+// "libreoffice.convert" span.
+func (lo *LibreOffice) Convert(ctx context.Context, inputPath string, outDir string, opts Options) (string, error) {
+	return traced(ctx, "libreoffice.convert", inputPath, opts, func(ctx context.Context) (string, error) {
+		return lo.convert(ctx, inputPath, outDir, opts)
+	})
+}
+
+func (lo *LibreOffice) convert(ctx context.Context, inputPath string, outDir string, opts Options) (string, error) {
+	tgt, err := planTarget(inputPath, outDir, opts)
+	if err != nil {
+		return "", err
+	}
+	if inputPath, err = orient(inputPath, outDir, opts.Orientation); err != nil {
+		return "", err
+	}
+	if inputPath, err = importable(inputPath, outDir); err != nil {
+		return "", err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, lo.Timeout)
 	defer cancel()
+	ctx, kill := context.WithCancelCause(ctx)
+	defer kill(nil)
 
-	cmd := exec.CommandContext(ctx,
-		lo.BinaryPath,
-		"--headless",
-		"--convert-to", "pdf",
-		"--outdir", outDir,
+	profile := "file://" + outDir + "/lo-profile"
+	args := []string{lo.BinaryPath, "--headless"}
+	if lo.Profile != nil {
+		if err := lo.Profile.install(filepath.Join(outDir, "lo-profile")); err != nil {
+			return "", fmt.Errorf("installing profile template: %w", err)
+		}
+		args = append(args, "-env:UserInstallation="+profile)
+	}
+	argv := lo.Limits.wrap(lo.Priority.wrap(append(args,
+		"--convert-to", tgt.convertTo,
+		"--outdir", tgt.resultDir,
 		inputPath,
-	)
+	)))
+	argv, err = lo.Sandbox.wrap(argv, outDir, filepath.Dir(inputPath))
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	// Give each conversion its own HOME so LibreOffice creates a fresh, isolated
 	// user profile inside outDir. This prevents lock-file conflicts and state
 	// bleed between concurrent requests. outDir is already cleaned up by the
 	// caller, so the profile is removed for free.
 	cmd.Env = append(os.Environ(),
 		"HOME="+outDir,
-		"UserInstallation=file://"+outDir+"/lo-profile",
+		"UserInstallation="+profile,
 	)
+	killGroupOnCancel(cmd)
+	// Don't wait on output pipes held open by stray descendants once the
+	// process itself has been killed.
+	cmd.WaitDelay = waitDelay
 
-	if _, err := cmd.CombinedOutput(); err != nil {
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrConversionFailed, err)
+	}
+	stop := lo.Limits.watch(cmd.Process.Pid, kill)
+	err = cmd.Wait()
+	stop()
+	if err != nil {
+		if lerr := lo.Limits.exceeded(ctx, cmd.ProcessState, tgt.outPath); lerr != nil {
+			return "", lerr
+		}
 		if ctx.Err() == context.DeadlineExceeded {
 			return "", ErrTimeout
 		}
 		return "", fmt.Errorf("%w: %w", ErrConversionFailed, err)
 	}
+	// A result cut off at the size cap may still exit cleanly.
+	if lerr := lo.Limits.exceeded(ctx, nil, tgt.outPath); lerr != nil {
+		return "", lerr
+	}
 
-	// LibreOffice names the output after the input file with a .pdf extension.
-	base := filepath.Base(inputPath)
-	pdfName := strings.TrimSuffix(base, filepath.Ext(base)) + ".pdf"
-	pdfPath := filepath.Join(outDir, pdfName)
+	return checkOutput(tgt.outPath)
+}
 
-	info, err := os.Stat(pdfPath)
-	if err != nil || info.Size() == 0 {
-		return "", ErrNoOutput
+// Version runs the LibreOffice binary with --version and returns the first
+// line it prints, e.g. "LibreOffice 7.6.4.1 e19e193f88cd6c0525a17fb7a176ed8e6a3e2aa1".
+func (lo *LibreOffice) Version(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, lo.BinaryPath, "--version")
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = waitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s --version: %w", lo.BinaryPath, err)
 	}
-
-	return pdfPath, nil
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if line == "" {
+		return "", fmt.Errorf("%s --version printed nothing", lo.BinaryPath)
+	}
+	return strings.TrimSpace(line), nil
 }
@@ -2,8 +2,10 @@ package converter_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
 )
 
 // TestLibreOffice_Timeout verifies that a converter with a very short timeout
@@ -30,7 +33,7 @@ func TestLibreOffice_Timeout(t *testing.T) {
 	inputPath := filepath.Join(tmpDir, "input.docx")
 	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
 
-	_, err := c.Convert(context.Background(), inputPath, tmpDir)
+	_, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{})
 	if err == nil {
 		t.Fatal("expected ErrTimeout, got nil")
 	}
@@ -51,7 +54,7 @@ func TestLibreOffice_MissingOutput(t *testing.T) {
 	inputPath := filepath.Join(tmpDir, "input.docx")
 	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
 
-	_, err := c.Convert(context.Background(), inputPath, tmpDir)
+	_, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{})
 	if err == nil {
 		t.Fatal("expected error for missing output, got nil")
 	}
@@ -76,7 +79,7 @@ func TestLibreOffice_OutputFound(t *testing.T) {
 		Timeout:    5 * time.Second,
 	}
 
-	pdfPath, err := c.Convert(context.Background(), inputPath, tmpDir)
+	pdfPath, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -88,6 +91,32 @@ func TestLibreOffice_OutputFound(t *testing.T) {
 	}
 }
 
+// TestLibreOffice_MarkdownAsText verifies that LibreOffice, which has no
+// Markdown import filter, is given a Markdown input as plain text.
+func TestLibreOffice_MarkdownAsText(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.md")
+	_ = os.WriteFile(inputPath, []byte("# Title\n"), 0600)
+
+	argFile := filepath.Join(tmpDir, "args")
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$6\" > %s\necho fake > %s/input.txt\n", argFile, tmpDir)
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	out, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{Format: converter.FormatTXT})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != filepath.Join(tmpDir, "input.txt") {
+		t.Errorf("output %q", out)
+	}
+	args, _ := os.ReadFile(argFile)
+	if got := strings.TrimSpace(string(args)); got != filepath.Join(tmpDir, "import", "input.txt") {
+		t.Errorf("LibreOffice was given %q", got)
+	}
+}
+
 // TestLibreOffice_ConversionFailed verifies that a non-zero exit from the
 // subprocess returns ErrConversionFailed (wrapped).
 func TestLibreOffice_ConversionFailed(t *testing.T) {
@@ -100,12 +129,152 @@ func TestLibreOffice_ConversionFailed(t *testing.T) {
 	inputPath := filepath.Join(tmpDir, "input.docx")
 	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
 
-	_, err := c.Convert(context.Background(), inputPath, tmpDir)
+	_, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{})
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
 }
 
+// TestLibreOffice_ExportFilterPerType verifies that the PDF export filter is
+// chosen from the input extension's document family.
+func TestLibreOffice_ExportFilterPerType(t *testing.T) {
+	cases := map[string]string{
+		"input.docx": "pdf:writer_pdf_Export",
+		"input.xlsx": "pdf:calc_pdf_Export",
+		"input.odp":  "pdf:impress_pdf_Export",
+		"input.bin":  "pdf",
+	}
+	for name, want := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, name)
+			_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+			// Fake binary: record the --convert-to argument, then create the PDF.
+			argFile := filepath.Join(tmpDir, "args.txt")
+			base := strings.TrimSuffix(name, filepath.Ext(name))
+			script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$3\" > %s\necho fake > %s/%s.pdf\n", argFile, tmpDir, base)
+			scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+			_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+			c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+			if _, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, _ := os.ReadFile(argFile)
+			if string(got) != want {
+				t.Errorf("expected --convert-to %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+// TestLibreOffice_PDFVersion verifies that the requested PDF version is
+// passed to the export filter, and refused where there is no PDF filter to
+// pass it to.
+func TestLibreOffice_PDFVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.xlsx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	argFile := filepath.Join(tmpDir, "args.txt")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$3\" > %s\necho fake > %s/input.pdf\n", argFile, tmpDir)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	if _, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{PDFVersion: converter.PDF15}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `pdf:calc_pdf_Export:{"SelectPdfVersion":{"type":"long","value":"15"}}`
+	if got, _ := os.ReadFile(argFile); string(got) != want {
+		t.Errorf("expected --convert-to %q, got %q", want, got)
+	}
+
+	for name, opts := range map[string]converter.Options{
+		"not pdf":       {Format: converter.FormatHTML, PDFVersion: converter.PDF17},
+		"unknown":       {PDFVersion: "2.0"},
+		"unknown input": {PDFVersion: converter.PDF17},
+	} {
+		input := inputPath
+		if name == "unknown input" {
+			input = filepath.Join(tmpDir, "input.bin")
+		}
+		if _, err := c.Convert(context.Background(), input, tmpDir, opts); !errors.Is(err, converter.ErrUnsupportedFormat) {
+			t.Errorf("%s: expected ErrUnsupportedFormat, got %v", name, err)
+		}
+	}
+}
+
+// TestLibreOffice_SameFormatWritesToSubdir verifies that converting a file to
+// its own format does not overwrite the staged input.
+func TestLibreOffice_SameFormatWritesToSubdir(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	// Fake binary: write the result into --outdir ($5).
+	script := "#!/bin/sh\nmkdir -p \"$5\" && echo converted > \"$5/input.docx\"\n"
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	outPath, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{Format: converter.FormatDOCX})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if outPath == inputPath {
+		t.Fatal("output path must differ from input path")
+	}
+	if data, _ := os.ReadFile(inputPath); string(data) != "dummy" {
+		t.Errorf("input was overwritten: %q", data)
+	}
+}
+
+// TestLibreOffice_UnsupportedFormat verifies that impossible family/format
+// combinations fail before LibreOffice is invoked.
+func TestLibreOffice_UnsupportedFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.xlsx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	c := &converter.LibreOffice{BinaryPath: "false", Timeout: 5 * time.Second}
+	_, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{Format: converter.FormatTXT})
+	if !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+// TestLibreOffice_Priority verifies that the subprocess runs with the
+// configured niceness.
+func TestLibreOffice_Priority(t *testing.T) {
+	if _, err := exec.LookPath("nice"); err != nil {
+		t.Skip("nice not on PATH")
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	// Fake binary: record its own niceness, then create input.pdf.
+	niceFile := filepath.Join(tmpDir, "nice.txt")
+	script := fmt.Sprintf("#!/bin/sh\nnice > %s\necho fake > %s/input.pdf\n", niceFile, tmpDir)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{
+		BinaryPath: scriptPath,
+		Timeout:    5 * time.Second,
+		Priority:   converter.Priority{Nice: 7},
+	}
+	if _, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := os.ReadFile(niceFile)
+	if strings.TrimSpace(string(got)) != "7" {
+		t.Errorf("expected niceness 7, got %q", got)
+	}
+}
+
 // TestLibreOffice_ProfileIsolation verifies that each Convert call receives a
 // distinct HOME environment variable, confirming per-request profile isolation.
 func TestLibreOffice_ProfileIsolation(t *testing.T) {
@@ -140,7 +309,7 @@ func TestLibreOffice_ProfileIsolation(t *testing.T) {
 			_ = os.WriteFile(scriptPath, []byte(script), 0755)
 
 			c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
-			_, errs[idx] = c.Convert(context.Background(), inputPath, tmpDir)
+			_, errs[idx] = c.Convert(context.Background(), inputPath, tmpDir, converter.Options{})
 
 			data, readErr := os.ReadFile(homeFile)
 			if readErr == nil {
@@ -165,3 +334,95 @@ func TestLibreOffice_ProfileIsolation(t *testing.T) {
 		t.Errorf("both conversions shared the same HOME (%q) — isolation not working", homeSeen[0])
 	}
 }
+
+// TestLibreOffice_Version verifies that Version returns the first line
+// printed by --version.
+func TestLibreOffice_Version(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	script := "#!/bin/sh\n[ \"$1\" = --version ] || exit 1\necho 'LibreOffice 7.6.4.1 e19e193f88cd6c0525a17fb7a176ed8e6a3e2aa1'\necho\n"
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath}
+	got, err := c.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if want := "LibreOffice 7.6.4.1 e19e193f88cd6c0525a17fb7a176ed8e6a3e2aa1"; got != want {
+		t.Errorf("Version = %q, want %q", got, want)
+	}
+
+	c.BinaryPath = filepath.Join(tmpDir, "missing")
+	if _, err := c.Version(context.Background()); err == nil {
+		t.Error("expected an error for a missing binary")
+	}
+}
+
+// spanRecorder is a tracing.Exporter that keeps what it is given.
+type spanRecorder struct{ spans []tracing.SpanData }
+
+func (r *spanRecorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+// TestLibreOffice_Traced verifies that a conversion under a traced request
+// records a child span with the input and output sizes.
+func TestLibreOffice_Traced(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	script := fmt.Sprintf("#!/bin/sh\necho 'fake pdf content' > %s/input.pdf\n", tmpDir)
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	rec := &spanRecorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour})
+	ctx, root := tr.Start(context.Background(), "POST", tracing.KindServer, tracing.SpanContext{})
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	if _, err := c.Convert(ctx, inputPath, tmpDir, converter.Options{}); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	root.End()
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(rec.spans))
+	}
+	span := rec.spans[0]
+	if span.Name != "libreoffice.convert" || span.Parent != root.Context().SpanID {
+		t.Errorf("unexpected span %+v", span)
+	}
+	attrs := make(map[string]any)
+	for _, a := range span.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["docpdf.format"] != "pdf" || attrs["docpdf.input_bytes"] != int64(5) || attrs["docpdf.output_bytes"] != int64(17) {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	if _, ok := attrs["docpdf.duration_ms"]; !ok {
+		t.Error("missing docpdf.duration_ms")
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	for _, tc := range []struct {
+		ext        string
+		structured bool
+		format     string
+		ok         bool
+	}{
+		{".docx", false, converter.FormatTXT, true},
+		{".ODT", true, converter.FormatHTML, true},
+		{".xlsx", false, converter.FormatHTML, true},
+		{".pptx", false, "", false},
+		{".pdf", false, "", false},
+	} {
+		if format, ok := converter.TextFormat(tc.ext, tc.structured); format != tc.format || ok != tc.ok {
+			t.Errorf("TextFormat(%q, %v) = %q, %v; want %q, %v", tc.ext, tc.structured, format, ok, tc.format, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// FontSubstitution replaces Font with Replacement wherever a document uses
+// it, through LibreOffice's font replacement table.
+type FontSubstitution struct {
+	Font        string
+	Replacement string
+}
+
+// DefaultFontSubstitutions map common Microsoft fonts to metric-compatible
+// free fonts, so documents keep their line and page breaks when the
+// originals are not installed.
+var DefaultFontSubstitutions = []FontSubstitution{
+	{"Calibri", "Carlito"},
+	{"Cambria", "Caladea"},
+	{"Arial", "Liberation Sans"},
+	{"Helvetica", "Liberation Sans"},
+	{"Times New Roman", "Liberation Serif"},
+	{"Courier New", "Liberation Mono"},
+}
+
+// ParseFontSubstitutions parses a table of the form
+// "Calibri=Carlito,Cambria=Caladea".
+func ParseFontSubstitutions(s string) ([]FontSubstitution, error) {
+	var subs []FontSubstitution
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		font, repl, ok := strings.Cut(pair, "=")
+		font, repl = strings.TrimSpace(font), strings.TrimSpace(repl)
+		if !ok || font == "" || repl == "" {
+			return nil, fmt.Errorf("font substitution %q: want Font=Replacement", pair)
+		}
+		subs = append(subs, FontSubstitution{Font: font, Replacement: repl})
+	}
+	return subs, nil
+}
+
+// FontInventory is the set of font families installed for LibreOffice, as
+// fontconfig lists them. Family names are matched case-insensitively.
+type FontInventory struct {
+	families []string        // sorted, as first listed
+	index    map[string]bool // lowercased families
+}
+
+// NewFontInventory returns the inventory of families.
+func NewFontInventory(families []string) *FontInventory {
+	inv := &FontInventory{index: make(map[string]bool)}
+	for _, f := range families {
+		key := strings.ToLower(f)
+		if f == "" || inv.index[key] {
+			continue
+		}
+		inv.index[key] = true
+		inv.families = append(inv.families, f)
+	}
+	slices.Sort(inv.families)
+	return inv
+}
+
+// ScanFonts lists the installed font families with fcList, fontconfig's
+// fc-list. A family is listed under each of its names, e.g. both
+// "DejaVu Sans" and "DejaVu Sans Condensed".
+func ScanFonts(ctx context.Context, fcList string) (*FontInventory, error) {
+	out, err := exec.CommandContext(ctx, fcList, ":", "family").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fcList, err)
+	}
+	var families []string
+	for line := range strings.SplitSeq(string(out), "\n") {
+		for name := range strings.SplitSeq(line, ",") {
+			families = append(families, strings.TrimSpace(name))
+		}
+	}
+	return NewFontInventory(families), nil
+}
+
+// Families returns the installed families, sorted.
+func (inv *FontInventory) Families() []string { return slices.Clone(inv.families) }
+
+// Has reports whether family is installed.
+func (inv *FontInventory) Has(family string) bool { return inv.index[strings.ToLower(family)] }
+
+// Missing returns those of fonts that are not installed and that subs do not
+// replace with an installed font: the fonts LibreOffice will fall back from
+// to whatever fontconfig finds closest, changing the layout.
+func (inv *FontInventory) Missing(fonts []string, subs []FontSubstitution) []string {
+	var missing []string
+	for _, f := range fonts {
+		if inv.Has(f) {
+			continue
+		}
+		i := slices.IndexFunc(subs, func(s FontSubstitution) bool { return strings.EqualFold(s.Font, f) })
+		if i >= 0 && inv.Has(subs[i].Replacement) {
+			continue
+		}
+		missing = append(missing, f)
+	}
+	return missing
+}
+
+// registryFile is where LibreOffice keeps user settings, relative to the
+// profile root.
+const registryFile = "user/registrymodifications.xcu"
+
+// emptyRegistry is a registrymodifications.xcu with no settings.
+const emptyRegistry = `<?xml version="1.0" encoding="UTF-8"?>
+<oor:items xmlns:oor="http://openoffice.org/2001/registry" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+</oor:items>
+`
+
+// WithFontSubstitutions returns a copy of t (which may be nil) whose
+// registrymodifications.xcu also enables the replacement table with subs.
+// Without subs it returns t.
+func (t *ProfileTemplate) WithFontSubstitutions(subs []FontSubstitution) (*ProfileTemplate, error) {
+	if len(subs) == 0 {
+		return t, nil
+	}
+	out := &ProfileTemplate{files: make(map[string][]byte)}
+	if t != nil {
+		maps.Copy(out.files, t.files)
+	}
+	reg, ok := out.files[registryFile]
+	if !ok {
+		reg = []byte(emptyRegistry)
+	}
+	end := bytes.LastIndex(reg, []byte("</oor:items>"))
+	if end < 0 {
+		return nil, errors.New("profile template: registrymodifications.xcu has no </oor:items>")
+	}
+
+	var items bytes.Buffer
+	items.WriteString(`<item oor:path="/org.openoffice.Office.Common/Font/Substitution"><prop oor:name="Replacement" oor:op="fuse"><value>true</value></prop></item>` + "\n")
+	for i, s := range subs {
+		fmt.Fprintf(&items, `<item oor:path="/org.openoffice.Office.Common/Font/Substitution/FontPairs"><node oor:name="docpdf%d" oor:op="replace">`, i)
+		items.WriteString(`<prop oor:name="Always" oor:op="fuse"><value>true</value></prop>`)
+		items.WriteString(`<prop oor:name="OnScreenOnly" oor:op="fuse"><value>false</value></prop>`)
+		items.WriteString(`<prop oor:name="ReplaceFont" oor:op="fuse"><value>`)
+		_ = xml.EscapeText(&items, []byte(s.Font))
+		items.WriteString(`</value></prop><prop oor:name="SubstituteFont" oor:op="fuse"><value>`)
+		_ = xml.EscapeText(&items, []byte(s.Replacement))
+		items.WriteString("</value></prop></node></item>\n")
+	}
+
+	merged := make([]byte, 0, len(reg)+items.Len())
+	merged = append(merged, reg[:end]...)
+	merged = append(merged, items.Bytes()...)
+	merged = append(merged, reg[end:]...)
+	out.files[registryFile] = merged
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package converter_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+func TestParseFontSubstitutions(t *testing.T) {
+	subs, err := converter.ParseFontSubstitutions(" Calibri=Carlito, Times New Roman = Liberation Serif,")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []converter.FontSubstitution{{"Calibri", "Carlito"}, {"Times New Roman", "Liberation Serif"}}
+	if len(subs) != len(want) || subs[0] != want[0] || subs[1] != want[1] {
+		t.Errorf("got %v, want %v", subs, want)
+	}
+	for _, bad := range []string{"Calibri", "Calibri=", "=Carlito"} {
+		if _, err := converter.ParseFontSubstitutions(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+// checkWellFormed fails t unless s is well-formed XML.
+func checkWellFormed(t *testing.T, s string) {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(s))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("malformed profile: %v\n%s", err, s)
+			}
+			return
+		}
+	}
+}
+
+func TestWithFontSubstitutions_NoTemplate(t *testing.T) {
+	var none *converter.ProfileTemplate
+	tmpl, err := none.WithFontSubstitutions([]converter.FontSubstitution{{"Calibri", "Carlito"}, {"A&B", "C<D"}})
+	if err != nil {
+		t.Fatalf("substitute: %v", err)
+	}
+	_, profile := convertWithProfile(t, tmpl)
+	checkWellFormed(t, profile)
+	for _, want := range []string{
+		`<value>Calibri</value>`,
+		`<value>Carlito</value>`,
+		`<value>A&amp;B</value>`,
+		`/org.openoffice.Office.Common/Font/Substitution/FontPairs`,
+	} {
+		if !strings.Contains(profile, want) {
+			t.Errorf("profile lacks %q:\n%s", want, profile)
+		}
+	}
+
+	if same, _ := none.WithFontSubstitutions(nil); same != nil {
+		t.Error("no substitutions still produced a template")
+	}
+}
+
+func TestWithFontSubstitutions_MergesTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tuned.xcu")
+	_ = os.WriteFile(path, []byte(xcu), 0600)
+	base, err := converter.LoadProfileTemplate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	tmpl, err := base.WithFontSubstitutions(converter.DefaultFontSubstitutions)
+	if err != nil {
+		t.Fatalf("substitute: %v", err)
+	}
+
+	_, profile := convertWithProfile(t, tmpl)
+	checkWellFormed(t, profile)
+	if !strings.Contains(profile, "AutoFunction/Completion") || !strings.Contains(profile, "<value>Caladea</value>") {
+		t.Errorf("profile lost the template or the table:\n%s", profile)
+	}
+	if _, original := convertWithProfile(t, base); original != xcu {
+		t.Error("substituting modified the original template")
+	}
+}
+
+func TestScanFonts(t *testing.T) {
+	dir := t.TempDir()
+	fcList := writeScript(t, dir, "#!/bin/sh\n[ \"$*\" = ': family' ] || exit 1\n"+
+		"printf 'DejaVu Sans,DejaVu Sans Condensed\\nCarlito\\n\\ncarlito\\n'\n")
+	inv, err := converter.ScanFonts(context.Background(), fcList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inv.Families(), []string{"Carlito", "DejaVu Sans", "DejaVu Sans Condensed"}; !slices.Equal(got, want) {
+		t.Errorf("families %q, want %q", got, want)
+	}
+	if !inv.Has("dejavu sans") || inv.Has("Calibri") {
+		t.Error("Has does not match families case-insensitively")
+	}
+
+	if _, err := converter.ScanFonts(context.Background(), filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error without fc-list")
+	}
+}
+
+func TestFontInventory_Missing(t *testing.T) {
+	inv := converter.NewFontInventory([]string{"Carlito", "Liberation Serif"})
+	subs := []converter.FontSubstitution{{"Calibri", "Carlito"}, {"Cambria", "Caladea"}}
+	got := inv.Missing([]string{"calibri", "Cambria", "Liberation Serif", "Wingdings"}, subs)
+	if want := []string{"Cambria", "Wingdings"}; !slices.Equal(got, want) {
+		t.Errorf("missing %q, want %q", got, want)
+	}
+}
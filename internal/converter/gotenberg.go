@@ -0,0 +1,181 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gotenbergPDFA maps the PDF/A versions Gotenberg produces to its pdfa
+// form field. It cannot produce a plain PDF of a given version.
+var gotenbergPDFA = map[string]string{
+	PDFA1B: "PDF/A-1b",
+	PDFA2B: "PDF/A-2b",
+	PDFA3B: "PDF/A-3b",
+}
+
+// gotenbergResolutions are the image resolutions Gotenberg downsamples to.
+var gotenbergResolutions = []int{75, 150, 300, 600, 1200}
+
+// Gotenberg implements Converter by sending documents to a remote
+// Gotenberg (https://gotenberg.dev) server's LibreOffice route. It only
+// produces PDFs, and takes the Options Gotenberg has form fields for; see
+// Supports.
+type Gotenberg struct {
+	// URL is the server's base URL, e.g. "http://gotenberg:3000".
+	URL string
+	// Timeout bounds each conversion, upload and download included; 0
+	// leaves it to the context.
+	Timeout time.Duration
+	// Client sends the requests; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Supports reports whether Gotenberg can convert an input with extension
+// ext with opts.
+func (g *Gotenberg) Supports(ext string, opts Options) bool {
+	if opts.Format != "" && opts.Format != FormatPDF {
+		return false
+	}
+	if _, ok := families[strings.ToLower(ext)]; !ok {
+		return false
+	}
+	if opts.PDFVersion != "" && gotenbergPDFA[opts.PDFVersion] == "" {
+		return false
+	}
+	if dpi := opts.ImageResolution(); dpi != 0 && !slices.Contains(gotenbergResolutions, dpi) {
+		return false
+	}
+	return opts.Orientation != OrientationPortrait
+}
+
+// Convert implements Converter. A conversion Gotenberg does not support
+// fails with ErrUnsupportedFormat; one it rejects or fails, or that cannot
+// reach it, with ErrConversionFailed.
+func (g *Gotenberg) Convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	ext := filepath.Ext(inputPath)
+	if !g.Supports(ext, opts) {
+		return "", fmt.Errorf("%w: gotenberg cannot convert %s with %v", ErrUnsupportedFormat, ext, opts)
+	}
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+
+	body, contentType := g.form(inputPath, opts)
+	defer body.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(g.URL, "/")+"/forms/libreoffice/convert", body)
+	if err != nil {
+		return "", fmt.Errorf("%w: gotenberg: %w", ErrConversionFailed, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set("Gotenberg-Trace", id)
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", ErrTimeout
+		}
+		return "", fmt.Errorf("%w: gotenberg: %w", ErrConversionFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return "", fmt.Errorf("%w: gotenberg: %s: %s", ErrConversionFailed, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	outPath := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(inputPath), ext)+".pdf")
+	f, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "", ErrTimeout
+	case err != nil:
+		return "", fmt.Errorf("%w: gotenberg: %w", ErrConversionFailed, err)
+	case n == 0:
+		return "", ErrNoOutput
+	}
+	return outPath, nil
+}
+
+// form streams the multipart form converting inputPath with opts.
+func (g *Gotenberg) form(inputPath string, opts Options) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fields := [][2]string{}
+		if v := gotenbergPDFA[opts.PDFVersion]; v != "" {
+			fields = append(fields, [2]string{"pdfa", v})
+		}
+		if opts.Pages != "" {
+			fields = append(fields, [2]string{"nativePageRanges", opts.Pages})
+		}
+		if dpi := opts.ImageResolution(); dpi != 0 {
+			fields = append(fields, [2]string{"reduceImageResolution", "true"}, [2]string{"maxImageResolution", strconv.Itoa(dpi)})
+		}
+		if opts.Preview {
+			fields = append(fields, [2]string{"losslessImageCompression", "false"}, [2]string{"quality", strconv.Itoa(previewQuality)}, [2]string{"exportBookmarks", "false"}, [2]string{"exportNotes", "false"})
+		}
+		if opts.Orientation == OrientationLandscape {
+			fields = append(fields, [2]string{"landscape", "true"})
+		}
+		if opts.NamedDestinations {
+			fields = append(fields, [2]string{"exportBookmarksToPdfDestination", "true"})
+		}
+		if opts.ConvertLinks {
+			fields = append(fields, [2]string{"convertOooTargetToPdfTarget", "true"}, [2]string{"exportLinksRelativeFsys", "true"})
+		}
+		if opts.UserPassword != "" {
+			fields = append(fields, [2]string{"userPassword", opts.UserPassword})
+		}
+		if opts.OwnerPassword != "" {
+			fields = append(fields, [2]string{"ownerPassword", opts.OwnerPassword})
+		}
+		for _, f := range fields {
+			if err := mw.WriteField(f[0], f[1]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		in, err := os.Open(inputPath)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		defer in.Close()
+		name := filepath.Base(inputPath)
+		if as, ok := importExts[strings.ToLower(filepath.Ext(name))]; ok {
+			name = strings.TrimSuffix(name, filepath.Ext(name)) + as
+		}
+		part, err := mw.CreateFormFile("files", name)
+		if err == nil {
+			_, err = io.Copy(part, in)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, mw.FormDataContentType()
+}
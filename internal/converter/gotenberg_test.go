@@ -0,0 +1,111 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+func TestGotenberg_Convert(t *testing.T) {
+	var fields map[string][]string
+	var upload string
+	var trace string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/forms/libreoffice/convert" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields = r.MultipartForm.Value
+		f, _, err := r.FormFile("files")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		upload = string(b)
+		trace = r.Header.Get("Gotenberg-Trace")
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "report.docx")
+	if err := os.WriteFile(in, []byte("docx bytes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	g := &converter.Gotenberg{URL: srv.URL + "/"}
+	ctx := converter.WithRequestID(context.Background(), "req-1")
+	out, err := g.Convert(ctx, in, dir, converter.Options{PDFVersion: converter.PDFA2B, Pages: "1-2", Orientation: converter.OrientationLandscape})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != filepath.Join(dir, "report.pdf") {
+		t.Errorf("output %q", out)
+	}
+	if b, _ := os.ReadFile(out); string(b) != "%PDF-1.7" {
+		t.Errorf("output content %q", b)
+	}
+	if upload != "docx bytes" || trace != "req-1" {
+		t.Errorf("upload %q, trace %q", upload, trace)
+	}
+	for k, v := range map[string]string{"pdfa": "PDF/A-2b", "nativePageRanges": "1-2", "landscape": "true"} {
+		if got := fields[k]; len(got) != 1 || got[0] != v {
+			t.Errorf("field %s = %v, want %s", k, got, v)
+		}
+	}
+}
+
+func TestGotenberg_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, "LibreOffice failed", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	in := filepath.Join(dir, "report.docx")
+	os.WriteFile(in, []byte("docx"), 0o600)
+
+	g := &converter.Gotenberg{URL: srv.URL}
+	if _, err := g.Convert(context.Background(), in, dir, converter.Options{}); !errors.Is(err, converter.ErrConversionFailed) {
+		t.Errorf("server error: %v", err)
+	}
+	if _, err := g.Convert(context.Background(), in, dir, converter.Options{Format: converter.FormatPNG}); !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Errorf("png: %v", err)
+	}
+	srv.Close()
+	if _, err := g.Convert(context.Background(), in, dir, converter.Options{}); !errors.Is(err, converter.ErrConversionFailed) {
+		t.Errorf("unreachable: %v", err)
+	}
+}
+
+func TestGotenberg_Supports(t *testing.T) {
+	g := &converter.Gotenberg{}
+	for _, tc := range []struct {
+		ext  string
+		opts converter.Options
+		want bool
+	}{
+		{".docx", converter.Options{}, true},
+		{".xlsx", converter.Options{PDFVersion: converter.PDFA1B, ImageDPI: 150}, true},
+		{".docx", converter.Options{Format: converter.FormatHTML}, false},
+		{".docx", converter.Options{PDFVersion: converter.PDF17}, false},
+		{".docx", converter.Options{ImageDPI: 200}, false},
+		{".docx", converter.Options{Orientation: converter.OrientationPortrait}, false},
+		{".pdf", converter.Options{}, false},
+	} {
+		if got := g.Supports(tc.ext, tc.opts); got != tc.want {
+			t.Errorf("%s %+v: got %v", tc.ext, tc.opts, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrResourceLimit is returned when a conversion is stopped for exceeding
+// one of the converter's Limits. The error is a *LimitError naming the
+// resource.
+var ErrResourceLimit = errors.New("conversion exceeded a resource limit")
+
+// Resources capped by Limits, as named in LimitError.Resource.
+const (
+	ResourceCPU    = "cpu"
+	ResourceRSS    = "rss"
+	ResourceOutput = "output"
+)
+
+// LimitError is the error for a conversion stopped by a limit. It matches
+// ErrResourceLimit with errors.Is.
+type LimitError struct {
+	// Resource is ResourceCPU, ResourceRSS or ResourceOutput.
+	Resource string
+}
+
+func (e *LimitError) Error() string { return ErrResourceLimit.Error() + ": " + e.Resource }
+
+// Is reports whether target is ErrResourceLimit.
+func (e *LimitError) Is(target error) bool { return target == ErrResourceLimit }
+
+// rssInterval is how often the resident memory of a conversion is sampled.
+const rssInterval = 250 * time.Millisecond
+
+// Limits caps the resources of each LibreOffice process. Zero fields are not
+// capped. CPU time and file size are rlimits set with prlimit, which must be
+// on PATH and execs soffice in place; resident memory, which no rlimit caps
+// on Linux, is sampled from /proc and is not capped on other systems.
+type Limits struct {
+	// CPUSeconds caps the CPU time of each process (RLIMIT_CPU); the kernel
+	// stops it with SIGXCPU.
+	CPUSeconds int
+	// MaxRSSMB caps the resident memory of soffice and its descendants
+	// together; the process group is killed when a sample exceeds it.
+	MaxRSSMB int
+	// MaxOutputMB caps the size of each file a process writes
+	// (RLIMIT_FSIZE), the result among them.
+	MaxOutputMB int
+}
+
+// wrap returns argv prefixed with prlimit for the rlimits that are set.
+func (l Limits) wrap(argv []string) []string {
+	if l.CPUSeconds <= 0 && l.MaxOutputMB <= 0 {
+		return argv
+	}
+	prefix := []string{"prlimit"}
+	if l.CPUSeconds > 0 {
+		// A soft limit below the hard one gets SIGXCPU, which tells the
+		// limit apart from any other SIGKILL.
+		prefix = append(prefix, "--cpu="+strconv.Itoa(l.CPUSeconds)+":"+strconv.Itoa(l.CPUSeconds+1))
+	}
+	if l.MaxOutputMB > 0 {
+		prefix = append(prefix, "--fsize="+strconv.FormatInt(int64(l.MaxOutputMB)<<20, 10))
+	}
+	return append(append(prefix, "--"), argv...)
+}
+
+// watch samples the resident memory of pid and its descendants until the
+// returned stop is called, and calls kill with a *LimitError once it is over
+// MaxRSSMB.
+func (l Limits) watch(pid int, kill context.CancelCauseFunc) (stop func()) {
+	if l.MaxRSSMB <= 0 {
+		return func() {}
+	}
+	limit := int64(l.MaxRSSMB) << 20
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(rssInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if rss, ok := treeRSS(pid); ok && rss > limit {
+					kill(&LimitError{Resource: ResourceRSS})
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// exceeded returns the *LimitError for a conversion that failed, or whose
+// result is at MaxOutputMB, because of a limit: ctx was cancelled by watch,
+// the process used up its CPU time, or its output reached the size cap.
+func (l Limits) exceeded(ctx context.Context, ps *os.ProcessState, outPath string) error {
+	var lerr *LimitError
+	if errors.As(context.Cause(ctx), &lerr) {
+		return lerr
+	}
+	// The rusage of the process includes the soffice.bin it waited for,
+	// though it can fall just short of the limit the kernel enforced.
+	if l.CPUSeconds > 0 && ps != nil && (cpuLimited(ps) || ps.UserTime()+ps.SystemTime() >= time.Duration(l.CPUSeconds)*time.Second) {
+		return &LimitError{Resource: ResourceCPU}
+	}
+	if l.MaxOutputMB > 0 {
+		if info, err := os.Stat(outPath); err == nil && info.Size() >= int64(l.MaxOutputMB)<<20 {
+			return &LimitError{Resource: ResourceOutput}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// treeRSS returns the resident memory, in bytes, of pid and its descendants,
+// read from /proc.
+func treeRSS(pid int) (int64, bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, false
+	}
+	children := make(map[int][]int)
+	for _, ent := range entries {
+		p, err := strconv.Atoi(ent.Name())
+		if err != nil {
+			continue
+		}
+		if ppid, ok := parentPID(p); ok {
+			children[ppid] = append(children[ppid], p)
+		}
+	}
+	var total int64
+	page := int64(os.Getpagesize())
+	for queue := []int{pid}; len(queue) > 0; queue = queue[1:] {
+		p := queue[0]
+		total += residentPages(p) * page
+		queue = append(queue, children[p]...)
+	}
+	return total, true
+}
+
+// parentPID reads the parent of p from /proc/<p>/stat, whose second field,
+// the command name, may itself hold spaces and parentheses.
+func parentPID(p int) (int, bool) {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(p) + "/stat")
+	if err != nil {
+		return 0, false
+	}
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return 0, false
+	}
+	// After the command: state, then ppid.
+	fields := bytes.Fields(b[i+1:])
+	if len(fields) < 2 {
+		return 0, false
+	}
+	ppid, err := strconv.Atoi(string(fields[1]))
+	return ppid, err == nil
+}
+
+// residentPages reads the resident set of p, in pages, from
+// /proc/<p>/statm; 0 if p is gone.
+func residentPages(p int) int64 {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(p) + "/statm")
+	if err != nil {
+		return 0
+	}
+	fields := bytes.Fields(b)
+	if len(fields) < 2 {
+		return 0
+	}
+	n, _ := strconv.ParseInt(string(fields[1]), 10, 64)
+	return n
+}
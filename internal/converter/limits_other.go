@@ -0,0 +1,6 @@
+//go:build !linux
+
+package converter
+
+// treeRSS is unavailable without /proc; Limits.MaxRSSMB is not enforced.
+func treeRSS(pid int) (int64, bool) { return 0, false }
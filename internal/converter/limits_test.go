@@ -0,0 +1,83 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// limitedRun converts a dummy document with a fake soffice running script
+// (in which $DIR is the conversion directory) under limits, and returns the
+// *LimitError it fails with.
+func limitedRun(t *testing.T, limits converter.Limits, script string) *converter.LimitError {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are enforced on Linux only")
+	}
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		t.Skip("prlimit not on PATH")
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+	lo := &converter.LibreOffice{
+		BinaryPath: writeScript(t, tmpDir, "#!/bin/sh\nDIR="+tmpDir+"\n"+script),
+		Timeout:    20 * time.Second,
+		Limits:     limits,
+	}
+	_, err := lo.Convert(context.Background(), inputPath, tmpDir, converter.Options{})
+	if !errors.Is(err, converter.ErrResourceLimit) {
+		t.Fatalf("expected ErrResourceLimit, got %v", err)
+	}
+	var lerr *converter.LimitError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected *LimitError, got %T", err)
+	}
+	return lerr
+}
+
+func TestLimits_Output(t *testing.T) {
+	lerr := limitedRun(t, converter.Limits{MaxOutputMB: 1}, "head -c 2097152 /dev/zero > $DIR/input.pdf\n")
+	if lerr.Resource != converter.ResourceOutput {
+		t.Errorf("Resource = %s, want %s", lerr.Resource, converter.ResourceOutput)
+	}
+}
+
+func TestLimits_CPU(t *testing.T) {
+	lerr := limitedRun(t, converter.Limits{CPUSeconds: 1}, "while :; do :; done\n")
+	if lerr.Resource != converter.ResourceCPU {
+		t.Errorf("Resource = %s, want %s", lerr.Resource, converter.ResourceCPU)
+	}
+}
+
+func TestLimits_RSS(t *testing.T) {
+	// tail buffers a line that never ends, in a child of the fake soffice.
+	lerr := limitedRun(t, converter.Limits{MaxRSSMB: 20}, "tail /dev/zero\necho fake > $DIR/input.pdf\n")
+	if lerr.Resource != converter.ResourceRSS {
+		t.Errorf("Resource = %s, want %s", lerr.Resource, converter.ResourceRSS)
+	}
+}
+
+func TestLimits_UnderCaps(t *testing.T) {
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		t.Skip("prlimit not on PATH")
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+	lo := &converter.LibreOffice{
+		BinaryPath: writeScript(t, tmpDir, "#!/bin/sh\necho fake > "+tmpDir+"/input.pdf\n"),
+		Timeout:    5 * time.Second,
+		Limits:     converter.Limits{CPUSeconds: 30, MaxRSSMB: 512, MaxOutputMB: 1},
+	}
+	if _, err := lo.Convert(context.Background(), inputPath, tmpDir, converter.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
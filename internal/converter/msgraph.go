@@ -0,0 +1,348 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/logging"
+)
+
+// Microsoft Graph endpoints MSGraph uses unless overridden.
+const (
+	defaultGraphURL = "https://graph.microsoft.com/v1.0"
+	defaultLoginURL = "https://login.microsoftonline.com"
+	graphScope      = "https://graph.microsoft.com/.default"
+)
+
+// Graph takes a single PUT up to 4 MiB; larger files go through an upload
+// session in chunks, which must be multiples of 320 KiB.
+const (
+	graphSimpleUpload = 4 << 20
+	graphChunk        = 10 * 320 << 10
+)
+
+// graphCleanupTimeout bounds deleting an uploaded file, which is done even
+// when the conversion's context is done.
+const graphCleanupTimeout = 30 * time.Second
+
+// graphInputs are the input extensions Graph renders as PDF.
+var graphInputs = map[string]bool{
+	".docx": true, ".odt": true, ".rtf": true, ".md": true, ".html": true,
+	".xlsx": true, ".ods": true, ".pptx": true, ".odp": true,
+}
+
+// MSGraph implements Converter with Microsoft Graph: it uploads each
+// document to a folder of a OneDrive or SharePoint drive, downloads its PDF
+// rendition and deletes the upload, for Office-rendered output. It
+// authenticates as an app with the OAuth client-credentials grant, which
+// needs the Files.ReadWrite.All application permission. It only produces
+// plain PDFs; see Supports.
+type MSGraph struct {
+	// TenantID, ClientID and ClientSecret are the Entra ID app's
+	// credentials.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// DriveID is the drive documents are uploaded to.
+	DriveID string
+	// Folder is the drive folder uploads are made in, created by Graph on
+	// first use; empty means the drive's root.
+	Folder string
+	// Timeout bounds each conversion, upload and download included; 0
+	// leaves it to the context.
+	Timeout time.Duration
+	// Client sends the requests; nil means http.DefaultClient.
+	Client *http.Client
+	// GraphURL and LoginURL replace the Graph API and Entra ID login base
+	// URLs, for tests or national clouds; empty means the global ones.
+	GraphURL string
+	LoginURL string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Supports reports whether MSGraph can convert an input with extension ext
+// with opts: an Office, OpenDocument, RTF, Markdown or HTML document to a
+// PDF without any other option. A preview is no faster through Graph, so
+// it is taken too.
+func (g *MSGraph) Supports(ext string, opts Options) bool {
+	if !graphInputs[strings.ToLower(ext)] {
+		return false
+	}
+	opts.Preview = false
+	return opts == Options{} || opts == Options{Format: FormatPDF}
+}
+
+// Convert implements Converter. The upload is deleted whatever the outcome.
+// A conversion Graph does not support fails with ErrUnsupportedFormat; one
+// it rejects or fails, or that cannot reach it, with ErrConversionFailed.
+func (g *MSGraph) Convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	return traced(ctx, "msgraph.convert", inputPath, opts, func(ctx context.Context) (string, error) {
+		out, err := g.convert(ctx, inputPath, outDir, opts)
+		if err != nil && !errors.Is(err, ErrUnsupportedFormat) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", ErrTimeout
+		}
+		return out, err
+	})
+}
+
+func (g *MSGraph) convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	ext := filepath.Ext(inputPath)
+	if !g.Supports(ext, opts) {
+		return "", fmt.Errorf("%w: msgraph cannot convert %s with %v", ErrUnsupportedFormat, ext, opts)
+	}
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+
+	itemID, err := g.upload(ctx, inputPath)
+	if err != nil {
+		return "", fmt.Errorf("%w: msgraph upload: %w", ErrConversionFailed, err)
+	}
+	defer g.remove(ctx, itemID)
+
+	resp, err := g.do(ctx, http.MethodGet, g.drive()+"/items/"+url.PathEscape(itemID)+"/content?format=pdf", nil, nil)
+	if err != nil {
+		if errors.Is(err, errGraphNotAcceptable) {
+			return "", fmt.Errorf("%w: msgraph cannot render %s as pdf", ErrUnsupportedFormat, ext)
+		}
+		return "", fmt.Errorf("%w: msgraph download: %w", ErrConversionFailed, err)
+	}
+	defer resp.Body.Close()
+
+	outPath := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(inputPath), ext)+".pdf")
+	f, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("%w: msgraph download: %w", ErrConversionFailed, err)
+	case n == 0:
+		return "", ErrNoOutput
+	}
+	return outPath, nil
+}
+
+// errGraphNotAcceptable is a 406 from Graph, its answer to a rendition it
+// cannot make.
+var errGraphNotAcceptable = errors.New("406 Not Acceptable")
+
+// upload uploads inputPath under a random name in Folder, returning the
+// drive item's ID. The name keeps concurrent conversions of files with the
+// same name apart, and its extension tells Graph the input type.
+func (g *MSGraph) upload(ctx context.Context, inputPath string) (string, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	name := path.Join(strings.Trim(g.Folder, "/"), hex.EncodeToString(b)+ext)
+	target := g.drive() + "/root:/" + (&url.URL{Path: name}).EscapedPath() + ":"
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	var item struct {
+		ID string `json:"id"`
+	}
+	if fi.Size() <= graphSimpleUpload {
+		resp, err := g.do(ctx, http.MethodPut, target+"/content", f, http.Header{"Content-Type": {"application/octet-stream"}})
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&item); err != nil || item.ID == "" {
+			return "", fmt.Errorf("no drive item in upload response: %v", err)
+		}
+		return item.ID, nil
+	}
+
+	resp, err := g.do(ctx, http.MethodPost, target+"/createUploadSession",
+		strings.NewReader(`{"item":{"@microsoft.graph.conflictBehavior":"fail"}}`), http.Header{"Content-Type": {"application/json"}})
+	if err != nil {
+		return "", err
+	}
+	var session struct {
+		UploadURL string `json:"uploadUrl"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&session)
+	resp.Body.Close()
+	if err != nil || session.UploadURL == "" {
+		return "", fmt.Errorf("no upload session: %v", err)
+	}
+	buf := make([]byte, graphChunk)
+	for off := int64(0); off < fi.Size(); {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		// The upload URL is pre-authenticated: it takes no bearer token.
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, session.UploadURL, bytes.NewReader(buf[:n]))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", off, off+int64(n)-1, fi.Size()))
+		resp, err := g.client().Do(req)
+		if err != nil {
+			return "", err
+		}
+		off += int64(n)
+		if err := graphStatus(resp); err != nil {
+			return "", err
+		}
+		if off == fi.Size() {
+			err = json.NewDecoder(resp.Body).Decode(&item)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if item.ID == "" {
+		return "", errors.New("no drive item in upload response")
+	}
+	return item.ID, nil
+}
+
+// remove deletes the uploaded item, on a context of its own so that a
+// conversion cut short leaves nothing behind in the drive.
+func (g *MSGraph) remove(ctx context.Context, itemID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), graphCleanupTimeout)
+	defer cancel()
+	resp, err := g.do(ctx, http.MethodDelete, g.drive()+"/items/"+url.PathEscape(itemID), nil, nil)
+	if err != nil {
+		logging.FromContext(ctx).Warn("msgraph: deleting upload", "item", itemID, "error", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// drive is the Graph URL of DriveID.
+func (g *MSGraph) drive() string {
+	base := g.GraphURL
+	if base == "" {
+		base = defaultGraphURL
+	}
+	return strings.TrimSuffix(base, "/") + "/drives/" + url.PathEscape(g.DriveID)
+}
+
+// do sends an authenticated request to Graph, returning its response if
+// successful, or else an error with Graph's message.
+func (g *MSGraph) do(ctx context.Context, method, u string, body io.Reader, header http.Header) (*http.Response, error) {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set("client-request-id", id)
+	}
+	resp, err := g.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := graphStatus(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// graphStatus closes resp and returns an error with Graph's message unless
+// its status is a success.
+func graphStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotAcceptable {
+		return errGraphNotAcceptable
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// accessToken returns a Graph token, fetched with the client-credentials
+// grant and reused until a minute before it expires.
+func (g *MSGraph) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Before(g.expires) {
+		return g.token, nil
+	}
+	base := g.LoginURL
+	if base == "" {
+		base = defaultLoginURL
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {g.ClientID},
+		"client_secret": {g.ClientSecret},
+		"scope":         {graphScope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(base, "/")+"/"+url.PathEscape(g.TenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := g.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	if err := graphStatus(resp); err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("token: no access token in response: %v", err)
+	}
+	g.token = tok.AccessToken
+	g.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return g.token, nil
+}
+
+func (g *MSGraph) client() *http.Client {
+	if g.Client != nil {
+		return g.Client
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,178 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// fakeGraph is a Microsoft Graph and Entra ID login server holding one
+// drive, recording the requests it is sent.
+type fakeGraph struct {
+	mu       sync.Mutex
+	tokens   int
+	uploads  map[string][]byte
+	deleted  []string
+	rendered int // the status of renditions; 0 means 200
+}
+
+func (f *fakeGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/tenant/oauth2/v2.0/token":
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_secret") != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		f.tokens++
+		w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"tok"}`))
+		return
+	case r.Header.Get("Authorization") != "Bearer tok":
+		http.Error(w, "unauthenticated", http.StatusUnauthorized)
+		return
+	}
+	const drive = "/drives/d1"
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, drive+"/root:/scratch/") && strings.HasSuffix(r.URL.Path, ":/content"):
+		body, _ := io.ReadAll(r.Body)
+		f.uploads["item1"] = body
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"item1"}`))
+	case r.Method == http.MethodGet && r.URL.Path == drive+"/items/item1/content" && r.URL.Query().Get("format") == "pdf":
+		if f.rendered != 0 {
+			w.WriteHeader(f.rendered)
+			return
+		}
+		w.Write([]byte("%PDF-1.7 from " + string(f.uploads["item1"])))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, drive+"/items/"):
+		f.deleted = append(f.deleted, strings.TrimPrefix(r.URL.Path, drive+"/items/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newGraph(t *testing.T, f *fakeGraph) *converter.MSGraph {
+	t.Helper()
+	f.uploads = map[string][]byte{}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return &converter.MSGraph{
+		TenantID: "tenant", ClientID: "app", ClientSecret: "s3cret",
+		DriveID: "d1", Folder: "scratch",
+		GraphURL: srv.URL, LoginURL: srv.URL,
+	}
+}
+
+func TestMSGraph_Convert(t *testing.T) {
+	f := &fakeGraph{}
+	g := newGraph(t, f)
+	dir := t.TempDir()
+	in := filepath.Join(dir, "report.docx")
+	os.WriteFile(in, []byte("docx"), 0o600)
+
+	for range 2 {
+		out, err := g.Convert(context.Background(), in, dir, converter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != filepath.Join(dir, "report.pdf") {
+			t.Errorf("output %q", out)
+		}
+		if b, _ := os.ReadFile(out); string(b) != "%PDF-1.7 from docx" {
+			t.Errorf("output %q", b)
+		}
+	}
+	if f.tokens != 1 {
+		t.Errorf("%d tokens fetched, want the first reused", f.tokens)
+	}
+	if len(f.deleted) != 2 {
+		t.Errorf("uploads deleted: %v", f.deleted)
+	}
+}
+
+func TestMSGraph_Failures(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		secret   string
+		want     error
+		deletion bool
+	}{
+		{"unrenderable", http.StatusNotAcceptable, "s3cret", converter.ErrUnsupportedFormat, true},
+		{"throttled", http.StatusTooManyRequests, "s3cret", converter.ErrConversionFailed, true},
+		{"bad credentials", 0, "wrong", converter.ErrConversionFailed, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeGraph{rendered: tc.status}
+			g := newGraph(t, f)
+			g.ClientSecret = tc.secret
+			dir := t.TempDir()
+			in := filepath.Join(dir, "input.pptx")
+			os.WriteFile(in, []byte("pptx"), 0o600)
+			if _, err := g.Convert(context.Background(), in, dir, converter.Options{}); !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			if deleted := len(f.deleted) == 1; deleted != tc.deletion {
+				t.Errorf("uploads deleted: %v", f.deleted)
+			}
+		})
+	}
+}
+
+func TestMSGraph_DeletesAfterCancel(t *testing.T) {
+	f := &fakeGraph{}
+	g := newGraph(t, f)
+	dir := t.TempDir()
+	in := filepath.Join(dir, "input.docx")
+	os.WriteFile(in, []byte("docx"), 0o600)
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Client = &http.Client{Transport: cancelOnRender{cancel}}
+	if _, err := g.Convert(ctx, in, dir, converter.Options{}); err == nil {
+		t.Fatal("a cancelled conversion succeeded")
+	}
+	if len(f.deleted) != 1 {
+		t.Errorf("uploads deleted: %v", f.deleted)
+	}
+}
+
+// cancelOnRender cancels the conversion when its rendition is asked for.
+type cancelOnRender struct{ cancel context.CancelFunc }
+
+func (c cancelOnRender) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Query().Get("format") == "pdf" {
+		c.cancel()
+		return nil, r.Context().Err()
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestMSGraph_Supports(t *testing.T) {
+	g := &converter.MSGraph{}
+	for _, tc := range []struct {
+		ext  string
+		opts converter.Options
+		want bool
+	}{
+		{".docx", converter.Options{}, true},
+		{".XLSX", converter.Options{Format: converter.FormatPDF, Preview: true}, true},
+		{".txt", converter.Options{}, false},
+		{".docx", converter.Options{Format: converter.FormatPNG}, false},
+		{".docx", converter.Options{Pages: "1-2"}, false},
+	} {
+		if got := g.Supports(tc.ext, tc.opts); got != tc.want {
+			t.Errorf("Supports(%s, %v) = %v", tc.ext, tc.opts, got)
+		}
+	}
+}
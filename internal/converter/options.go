@@ -0,0 +1,252 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Page orientations accepted in Options.Orientation.
+const (
+	OrientationPortrait  = "portrait"
+	OrientationLandscape = "landscape"
+)
+
+// Bounds of Options.ImageDPI.
+const (
+	MinImageDPI = 50
+	MaxImageDPI = 1200
+)
+
+// Export settings of a preview (Options.Preview): images downsampled to
+// PreviewImageDPI, unless ImageDPI is lower, and compressed to JPEG quality
+// previewQuality.
+const (
+	PreviewImageDPI = 75
+	previewQuality  = 50
+)
+
+// ImageDPIOriginal is the name ParseImageDPI accepts for an ImageDPI of 0:
+// images kept at their own resolution.
+const ImageDPIOriginal = "original"
+
+var (
+	// ErrInvalidPageRange is returned by ParsePageRange for a malformed
+	// range.
+	ErrInvalidPageRange = errors.New("invalid page range")
+	// ErrPageOutOfRange is returned by PageNumbers for a selection naming a
+	// page past the end of the document.
+	ErrPageOutOfRange = errors.New("page out of range")
+	// ErrInvalidImageDPI is returned by ParseImageDPI for a resolution out
+	// of bounds.
+	ErrInvalidImageDPI = errors.New("invalid image dpi")
+)
+
+// ParsePageRange validates a page selection such as "1-3,7" or "5-" and
+// returns it normalised: comma-separated, without spaces. Pages count from
+// 1; an open range runs to the last page.
+func ParsePageRange(s string) (string, error) {
+	var parts []string
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := pageNumber(from)
+		if err != nil {
+			return "", fmt.Errorf("%w %q", ErrInvalidPageRange, s)
+		}
+		if !isRange {
+			parts = append(parts, strconv.Itoa(first))
+			continue
+		}
+		if to = strings.TrimSpace(to); to == "" {
+			parts = append(parts, strconv.Itoa(first)+"-")
+			continue
+		}
+		last, err := pageNumber(to)
+		if err != nil || last < first {
+			return "", fmt.Errorf("%w %q", ErrInvalidPageRange, s)
+		}
+		parts = append(parts, strconv.Itoa(first)+"-"+strconv.Itoa(last))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// PageNumbers returns the pages a selection valid for ParsePageRange picks
+// from a document of n pages, in the order given.
+func PageNumbers(s string, n int) ([]int, error) {
+	s, err := ParsePageRange(s)
+	if err != nil {
+		return nil, err
+	}
+	var pages []int
+	for part := range strings.SplitSeq(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, _ := strconv.Atoi(from)
+		last := first
+		if isRange {
+			if last = n; to != "" {
+				last, _ = strconv.Atoi(to)
+			}
+		}
+		if first > n || last > n {
+			return nil, fmt.Errorf("%w: %q in a document of %d pages", ErrPageOutOfRange, s, n)
+		}
+		for p := first; p <= last; p++ {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+func pageNumber(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || s[0] == '+' {
+		return 0, ErrInvalidPageRange
+	}
+	return n, nil
+}
+
+// ParseImageDPI parses an image resolution for Options.ImageDPI: dots per
+// inch from MinImageDPI to MaxImageDPI, or ImageDPIOriginal for 0.
+func ParseImageDPI(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == ImageDPIOriginal {
+		return 0, nil
+	}
+	dpi, err := strconv.Atoi(s)
+	if err != nil || dpi < MinImageDPI || dpi > MaxImageDPI {
+		return 0, fmt.Errorf("%w %q", ErrInvalidImageDPI, s)
+	}
+	return dpi, nil
+}
+
+// ParseImageDPIs parses per-tenant image resolutions in the form
+// "print=300;web=96".
+func ParseImageDPIs(s string) (map[string]int, error) {
+	return parseTenantRules(s, ParseImageDPI)
+}
+
+// filterOption is one option of a LibreOffice export filter.
+type filterOption struct {
+	name  string
+	typ   string // UNO type: "long", "string" or "boolean"
+	value string
+}
+
+// exportOptions returns the export filter options opts asks for. They are
+// all PDF export options, so any of them with another format, or with an
+// input whose family, and so export filter, is unknown, is
+// ErrUnsupportedFormat.
+func exportOptions(format string, known bool, opts Options) ([]filterOption, error) {
+	var fo []filterOption
+	if opts.PDFVersion != "" {
+		v, ok := selectPdfVersion[opts.PDFVersion]
+		if !ok {
+			return nil, ErrUnsupportedFormat
+		}
+		fo = append(fo, filterOption{"SelectPdfVersion", "long", v})
+	}
+	if opts.Pages != "" {
+		pages, err := ParsePageRange(opts.Pages)
+		if err != nil {
+			return nil, ErrUnsupportedFormat
+		}
+		fo = append(fo, filterOption{"PageRange", "string", pages})
+	}
+	if opts.ImageDPI != 0 && (opts.ImageDPI < MinImageDPI || opts.ImageDPI > MaxImageDPI) {
+		return nil, ErrUnsupportedFormat
+	}
+	if dpi := opts.ImageResolution(); dpi != 0 {
+		fo = append(fo,
+			filterOption{"ReduceImageResolution", "boolean", "true"},
+			filterOption{"MaxImageResolution", "long", strconv.Itoa(dpi)},
+		)
+	}
+	if opts.Preview {
+		fo = append(fo,
+			filterOption{"UseLosslessCompression", "boolean", "false"},
+			filterOption{"Quality", "long", strconv.Itoa(previewQuality)},
+			filterOption{"ExportBookmarks", "boolean", "false"},
+			filterOption{"ExportNotes", "boolean", "false"},
+		)
+	}
+	if opts.NamedDestinations {
+		fo = append(fo, filterOption{"ExportBookmarksToPDFDestination", "boolean", "true"})
+	}
+	if opts.ConvertLinks {
+		fo = append(fo,
+			filterOption{"ConvertOOoTargetToPDFTarget", "boolean", "true"},
+			filterOption{"ExportLinksRelativeFsys", "boolean", "true"},
+		)
+	}
+	if opts.Encrypted() && strings.HasPrefix(opts.PDFVersion, "pdfa-") {
+		// PDF/A forbids encryption.
+		return nil, ErrUnsupportedFormat
+	}
+	if opts.UserPassword != "" {
+		fo = append(fo,
+			filterOption{"EncryptFile", "boolean", "true"},
+			filterOption{"DocumentOpenPassword", "string", opts.UserPassword},
+		)
+	}
+	if opts.OwnerPassword != "" {
+		fo = append(fo,
+			filterOption{"RestrictPermissions", "boolean", "true"},
+			filterOption{"PermissionPassword", "string", opts.OwnerPassword},
+		)
+	}
+	if len(fo) > 0 && (format != FormatPDF || !known) {
+		return nil, ErrUnsupportedFormat
+	}
+	return fo, nil
+}
+
+// ImageResolution returns the resolution images are downsampled to, 0 for
+// none: ImageDPI, or for a preview PreviewImageDPI if that is lower.
+func (o Options) ImageResolution() int {
+	if o.Preview && (o.ImageDPI == 0 || o.ImageDPI > PreviewImageDPI) {
+		return PreviewImageDPI
+	}
+	return o.ImageDPI
+}
+
+// filterOptionsJSON is the JSON form of fo appended to a --convert-to value,
+// as soffice has accepted since LibreOffice 7.4.
+func filterOptionsJSON(fo []filterOption) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, o := range fo {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(o.name)
+		value, _ := json.Marshal(o.value)
+		fmt.Fprintf(&b, `%s:{"type":"%s","value":%s}`, name, o.typ, value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// parseTenantRules parses per-tenant settings in the form
+// "tenant=value;other=value", each value parsed with parse.
+func parseTenantRules[T any](s string, parse func(string) (T, error)) (map[string]T, error) {
+	rules := make(map[string]T)
+	for rule := range strings.SplitSeq(s, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		tenant, v, ok := strings.Cut(rule, "=")
+		tenant = strings.TrimSpace(tenant)
+		if !ok || tenant == "" {
+			return nil, fmt.Errorf("converter: malformed tenant rule %q", rule)
+		}
+		var err error
+		if rules[tenant], err = parse(v); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
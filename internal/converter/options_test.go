@@ -0,0 +1,174 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+func TestParsePageRange(t *testing.T) {
+	cases := map[string]string{
+		"1-3,7":       "1-3,7",
+		" 2 , 4 - 6 ": "2,4-6",
+		"5-":          "5-",
+		"3-3":         "3-3",
+	}
+	for in, want := range cases {
+		if got, err := converter.ParsePageRange(in); err != nil || got != want {
+			t.Errorf("ParsePageRange(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0", "3-1", "1,,2", "-4", "a-b", "1;2", "+1", "1-2-3"} {
+		if _, err := converter.ParsePageRange(in); !errors.Is(err, converter.ErrInvalidPageRange) {
+			t.Errorf("ParsePageRange(%q): expected ErrInvalidPageRange, got %v", in, err)
+		}
+	}
+}
+
+func TestPageNumbers(t *testing.T) {
+	cases := map[string][]int{
+		"1-3,7": {1, 2, 3, 7},
+		"5-":    {5, 6, 7},
+		"7,2-2": {7, 2},
+	}
+	for in, want := range cases {
+		if got, err := converter.PageNumbers(in, 7); err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("PageNumbers(%q, 7) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"8", "6-8", "8-"} {
+		if _, err := converter.PageNumbers(in, 7); !errors.Is(err, converter.ErrPageOutOfRange) {
+			t.Errorf("PageNumbers(%q, 7): expected ErrPageOutOfRange, got %v", in, err)
+		}
+	}
+	if _, err := converter.PageNumbers("0", 7); !errors.Is(err, converter.ErrInvalidPageRange) {
+		t.Errorf("expected ErrInvalidPageRange, got %v", err)
+	}
+}
+
+func TestParseImageDPI(t *testing.T) {
+	cases := map[string]int{"300": 300, " 96": 96, "Original": 0, "1200": 1200}
+	for in, want := range cases {
+		if got, err := converter.ParseImageDPI(in); err != nil || got != want {
+			t.Errorf("ParseImageDPI(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0", "49", "1201", "300dpi"} {
+		if _, err := converter.ParseImageDPI(in); !errors.Is(err, converter.ErrInvalidImageDPI) {
+			t.Errorf("ParseImageDPI(%q): expected ErrInvalidImageDPI, got %v", in, err)
+		}
+	}
+	got, err := converter.ParseImageDPIs("print=300; web=96;archive=original")
+	if err != nil || len(got) != 3 || got["print"] != 300 || got["web"] != 96 || got["archive"] != 0 {
+		t.Errorf("ParseImageDPIs = %v, %v", got, err)
+	}
+}
+
+// TestLibreOffice_FilterOptions verifies that PDF export options are passed
+// to the export filter together.
+func TestLibreOffice_FilterOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	argFile := filepath.Join(tmpDir, "args.txt")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$3\" > %s\necho fake > %s/input.pdf\n", argFile, tmpDir)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	opts := converter.Options{PDFVersion: converter.PDFA2B, Pages: "1-3,7", ImageDPI: 150, NamedDestinations: true, ConvertLinks: true}
+	if _, err := c.Convert(context.Background(), inputPath, tmpDir, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `pdf:writer_pdf_Export:{"SelectPdfVersion":{"type":"long","value":"2"},"PageRange":{"type":"string","value":"1-3,7"},` +
+		`"ReduceImageResolution":{"type":"boolean","value":"true"},"MaxImageResolution":{"type":"long","value":"150"},` +
+		`"ExportBookmarksToPDFDestination":{"type":"boolean","value":"true"},` +
+		`"ConvertOOoTargetToPDFTarget":{"type":"boolean","value":"true"},"ExportLinksRelativeFsys":{"type":"boolean","value":"true"}}`
+	if got, _ := os.ReadFile(argFile); string(got) != want {
+		t.Errorf("expected --convert-to %q, got %q", want, got)
+	}
+
+	_, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{Format: converter.FormatPNG, Pages: "1"})
+	if !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Errorf("pages with png: expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+// TestLibreOffice_Preview verifies that a preview downsamples images to
+// PreviewImageDPI, or a lower ImageDPI, and compresses them harder.
+func TestLibreOffice_Preview(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	argFile := filepath.Join(tmpDir, "args.txt")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$3\" > %s\necho fake > %s/input.pdf\n", argFile, tmpDir)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	rest := `"UseLosslessCompression":{"type":"boolean","value":"false"},"Quality":{"type":"long","value":"50"},` +
+		`"ExportBookmarks":{"type":"boolean","value":"false"},"ExportNotes":{"type":"boolean","value":"false"}}`
+	for _, tc := range []struct {
+		dpi  int
+		want string
+	}{
+		{0, "75"},
+		{300, "75"},
+		{50, "50"},
+	} {
+		if _, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{Preview: true, ImageDPI: tc.dpi}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `pdf:writer_pdf_Export:{"ReduceImageResolution":{"type":"boolean","value":"true"},"MaxImageResolution":{"type":"long","value":"` + tc.want + `"},` + rest
+		if got, _ := os.ReadFile(argFile); string(got) != want {
+			t.Errorf("image_dpi %d: expected --convert-to %q, got %q", tc.dpi, want, got)
+		}
+	}
+
+	_, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{Format: converter.FormatPNG, Preview: true})
+	if !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Errorf("preview with png: expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+// TestLibreOffice_Passwords verifies that passwords reach the export filter,
+// are refused for PDF/A, and are redacted when Options is formatted.
+func TestLibreOffice_Passwords(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	argFile := filepath.Join(tmpDir, "args.txt")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$3\" > %s\necho fake > %s/input.pdf\n", argFile, tmpDir)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	opts := converter.Options{UserPassword: `open "sesame"`, OwnerPassword: "s3cret"}
+	if _, err := c.Convert(context.Background(), inputPath, tmpDir, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `pdf:writer_pdf_Export:{"EncryptFile":{"type":"boolean","value":"true"},"DocumentOpenPassword":{"type":"string","value":"open \"sesame\""},` +
+		`"RestrictPermissions":{"type":"boolean","value":"true"},"PermissionPassword":{"type":"string","value":"s3cret"}}`
+	if got, _ := os.ReadFile(argFile); string(got) != want {
+		t.Errorf("expected --convert-to %q, got %q", want, got)
+	}
+
+	opts.PDFVersion = converter.PDFA2B
+	if _, err := c.Convert(context.Background(), inputPath, tmpDir, opts); !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Errorf("passwords with pdf/a: expected ErrUnsupportedFormat, got %v", err)
+	}
+
+	if s := fmt.Sprint(opts); strings.Contains(s, "sesame") || strings.Contains(s, "s3cret") || !strings.Contains(s, "[redacted]") {
+		t.Errorf("formatted options leak a password: %s", s)
+	}
+}
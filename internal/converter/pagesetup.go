@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LibreOffice has no export option for page orientation: it comes from the
+// page styles of the document. Options.Orientation is applied by rewriting
+// the page setup in a copy of the document before it is converted.
+//
+// In Word packages every section's <w:pgSz> gets its width and height
+// swapped as needed and w:orient set; in Excel packages every sheet's
+// <pageSetup> gets the orientation attribute; in OpenDocument files every
+// page layout in styles.xml gets its width and height swapped as needed and
+// style:print-orientation set.
+var pageSetups = map[string]pageSetup{
+	".docx": {
+		part:        func(name string) bool { return name == "word/document.xml" },
+		element:     regexp.MustCompile(`<w:pgSz\b[^>]*>`),
+		width:       "w:w",
+		height:      "w:h",
+		orientation: "w:orient",
+	},
+	".xlsx": {
+		part: func(name string) bool {
+			return path.Dir(name) == "xl/worksheets" && path.Ext(name) == ".xml"
+		},
+		element:     regexp.MustCompile(`<pageSetup\b[^>]*>`),
+		orientation: "orientation",
+		// Sheets without print settings get them after their margins, where
+		// the schema orders them.
+		insertAfter: regexp.MustCompile(`<pageMargins\b[^>]*/>`),
+	},
+	".odt": odfPageSetup,
+	".ods": odfPageSetup,
+}
+
+var odfPageSetup = pageSetup{
+	part:        func(name string) bool { return name == "styles.xml" },
+	element:     regexp.MustCompile(`<style:page-layout-properties\b[^>]*>`),
+	width:       "fo:page-width",
+	height:      "fo:page-height",
+	orientation: "style:print-orientation",
+}
+
+// pageSetup describes where a document format keeps its page setup.
+type pageSetup struct {
+	part        func(name string) bool // the package entries holding it
+	element     *regexp.Regexp         // its start tag
+	width       string                 // page size attributes, if any
+	height      string
+	orientation string
+	insertAfter *regexp.Regexp // where to add a missing element, if anywhere
+}
+
+// SupportsOrientation reports whether Options.Orientation can be applied to
+// inputs with extension ext.
+func SupportsOrientation(ext string) bool {
+	_, ok := pageSetups[strings.ToLower(ext)]
+	return ok
+}
+
+// orient writes a copy of the document at inputPath with every page turned
+// to orientation into a subdirectory of outDir, under the same name, and
+// returns its path. An empty orientation returns inputPath.
+func orient(inputPath, outDir, orientation string) (string, error) {
+	if orientation == "" {
+		return inputPath, nil
+	}
+	ps, ok := pageSetups[strings.ToLower(filepath.Ext(inputPath))]
+	if !ok || (orientation != OrientationPortrait && orientation != OrientationLandscape) {
+		return "", ErrUnsupportedFormat
+	}
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: not a zip package", ErrConversionFailed)
+	}
+
+	dir := filepath.Join(outDir, "oriented")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	oriented := filepath.Join(dir, filepath.Base(inputPath))
+	f, err := os.OpenFile(oriented, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, entry := range zr.File {
+		if !ps.part(entry.Name) {
+			if err := zw.Copy(entry); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err := rewriteZipEntry(zw, entry, func(b []byte) []byte { return ps.apply(b, orientation) }); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return oriented, f.Close()
+}
+
+// apply sets orientation on every page setup element in part.
+func (ps pageSetup) apply(part []byte, orientation string) []byte {
+	if ps.insertAfter != nil && !ps.element.Match(part) {
+		if loc := ps.insertAfter.FindIndex(part); loc != nil {
+			tag := fmt.Sprintf(`<pageSetup %s="%s"/>`, ps.orientation, orientation)
+			return append(part[:loc[1]:loc[1]], append([]byte(tag), part[loc[1]:]...)...)
+		}
+	}
+	return ps.element.ReplaceAllFunc(part, func(el []byte) []byte {
+		if ps.width != "" {
+			w, wok := attr(el, ps.width)
+			h, hok := attr(el, ps.height)
+			wide := length(w) > length(h)
+			if wok && hok && wide != (orientation == OrientationLandscape) {
+				el = setAttr(setAttr(el, ps.width, h), ps.height, w)
+			}
+		}
+		return setAttr(el, ps.orientation, orientation)
+	})
+}
+
+// attr returns the value of attribute name in the start tag el.
+func attr(el []byte, name string) (string, bool) {
+	m := regexp.MustCompile(`\s` + regexp.QuoteMeta(name) + `="([^"]*)"`).FindSubmatch(el)
+	if m == nil {
+		return "", false
+	}
+	return string(m[1]), true
+}
+
+// setAttr sets attribute name in the start tag el, adding it when missing.
+func setAttr(el []byte, name, value string) []byte {
+	re := regexp.MustCompile(`\s` + regexp.QuoteMeta(name) + `="[^"]*"`)
+	a := []byte(` ` + name + `="` + value + `"`)
+	if re.Match(el) {
+		return re.ReplaceAllLiteral(el, a)
+	}
+	end := len(el) - 1
+	if bytes.HasSuffix(el, []byte("/>")) {
+		end--
+	}
+	return append(el[:end:end], append(a, el[end:]...)...)
+}
+
+// length returns the number at the start of a length attribute such as
+// "11906" or "21.001cm"; both sizes of a page use the same unit.
+func length(s string) float64 {
+	end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(s)
+	}
+	n, _ := strconv.ParseFloat(s[:end], 64)
+	return n
+}
+
+// rewriteZipEntry writes f to zw with its contents passed through rewrite.
+func rewriteZipEntry(zw *zip.Writer, f *zip.File, rewrite func([]byte) []byte) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     f.Name,
+		Method:   f.Method,
+		Modified: f.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(rewrite(b))
+	return err
+}
@@ -0,0 +1,139 @@
+package converter_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// writePackage writes a ZIP with the given entries to path.
+func writePackage(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range entries {
+		w, _ := zw.Create(name)
+		_, _ = io.WriteString(w, body)
+	}
+	_ = zw.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// convertCopy converts name with opts through a fake LibreOffice that copies
+// the document it is given to the result, and returns the result's entries.
+func convertCopy(t *testing.T, name string, entries map[string]string, opts converter.Options) map[string]string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, name)
+	writePackage(t, inputPath, entries)
+	original := mustRead(t, inputPath)
+
+	// Fake binary: $5 is --outdir, $6 the input.
+	script := "#!/bin/sh\ncp \"$6\" \"$5/input.pdf\"\n"
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second}
+	out, err := c.Convert(context.Background(), inputPath, tmpDir, opts)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if !bytes.Equal(mustRead(t, inputPath), original) {
+		t.Fatal("input was modified")
+	}
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("result is not a package: %v", err)
+	}
+	defer zr.Close()
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(b)
+	}
+	return got
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOrientation_Word(t *testing.T) {
+	doc := `<w:body><w:sectPr><w:pgSz w:w="11906" w:h="16838"/></w:sectPr>` +
+		`<w:sectPr><w:pgSz w:w="16838" w:h="11906" w:orient="landscape"/></w:sectPr></w:body>`
+	got := convertCopy(t, "input.docx", map[string]string{"word/document.xml": doc, "word/styles.xml": "<w:styles/>"},
+		converter.Options{Orientation: converter.OrientationLandscape})
+
+	want := `<w:body><w:sectPr><w:pgSz w:w="16838" w:h="11906" w:orient="landscape"/></w:sectPr>` +
+		`<w:sectPr><w:pgSz w:w="16838" w:h="11906" w:orient="landscape"/></w:sectPr></w:body>`
+	if got["word/document.xml"] != want {
+		t.Errorf("document.xml = %s", got["word/document.xml"])
+	}
+	if got["word/styles.xml"] != "<w:styles/>" {
+		t.Error("other parts should be copied unchanged")
+	}
+}
+
+func TestOrientation_Spreadsheet(t *testing.T) {
+	got := convertCopy(t, "input.xlsx", map[string]string{
+		"xl/worksheets/sheet1.xml": `<worksheet><pageMargins left="0.7"/><pageSetup paperSize="9" orientation="landscape"/></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData/><pageMargins left="0.7"/><headerFooter/></worksheet>`,
+	}, converter.Options{Orientation: converter.OrientationPortrait})
+
+	if s := got["xl/worksheets/sheet1.xml"]; !strings.Contains(s, `<pageSetup paperSize="9" orientation="portrait"/>`) {
+		t.Errorf("sheet1 = %s", s)
+	}
+	if s := got["xl/worksheets/sheet2.xml"]; !strings.Contains(s, `<pageMargins left="0.7"/><pageSetup orientation="portrait"/><headerFooter/>`) {
+		t.Errorf("expected a pageSetup added after the margins, sheet2 = %s", s)
+	}
+}
+
+func TestOrientation_OpenDocument(t *testing.T) {
+	styles := `<style:page-layout style:name="pm1"><style:page-layout-properties fo:page-width="21.001cm" fo:page-height="29.7cm" style:print-orientation="portrait"></style:page-layout-properties></style:page-layout>`
+	got := convertCopy(t, "input.odt", map[string]string{"mimetype": "application/vnd.oasis.opendocument.text", "styles.xml": styles},
+		converter.Options{Orientation: converter.OrientationLandscape})
+
+	want := `<style:page-layout-properties fo:page-width="29.7cm" fo:page-height="21.001cm" style:print-orientation="landscape">`
+	if !strings.Contains(got["styles.xml"], want) {
+		t.Errorf("styles.xml = %s", got["styles.xml"])
+	}
+}
+
+func TestOrientation_Unsupported(t *testing.T) {
+	tmpDir := t.TempDir()
+	c := &converter.LibreOffice{BinaryPath: "false", Timeout: 5 * time.Second}
+	for name, opts := range map[string]converter.Options{
+		"input.pptx": {Orientation: converter.OrientationLandscape},
+		"input.txt":  {Orientation: converter.OrientationLandscape},
+		"input.docx": {Orientation: "sideways"},
+	} {
+		inputPath := filepath.Join(tmpDir, name)
+		_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+		if _, err := c.Convert(context.Background(), inputPath, tmpDir, opts); !errors.Is(err, converter.ErrUnsupportedFormat) {
+			t.Errorf("%s %+v: expected ErrUnsupportedFormat, got %v", name, opts, err)
+		}
+	}
+	for _, ext := range []string{".docx", ".XLSX", ".odt", ".ods"} {
+		if !converter.SupportsOrientation(ext) {
+			t.Errorf("SupportsOrientation(%q) = false", ext)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PDF engines Pandoc can be configured with.
+const (
+	EnginePDFLaTeX    = "pdflatex"
+	EngineXeLaTeX     = "xelatex"
+	EngineLuaLaTeX    = "lualatex"
+	EngineWkhtmltopdf = "wkhtmltopdf"
+)
+
+// maxPandocError bounds the pandoc output kept in a conversion error: its
+// last bytes, where the engine's own error is.
+const maxPandocError = 1 << 10
+
+// PandocEngines lists the engines accepted in Pandoc.Engine.
+var PandocEngines = []string{EnginePDFLaTeX, EngineXeLaTeX, EngineLuaLaTeX, EngineWkhtmltopdf}
+
+// pandocReaders maps the input extensions Pandoc takes to its reader.
+// Markdown's raw TeX would reach the LaTeX engine as it is, and with it
+// \input or \openin of any file on the server, so it is turned off.
+var pandocReaders = map[string]string{
+	".md":   "markdown-raw_tex-raw_attribute",
+	".html": "html",
+}
+
+// Pandoc implements Converter for Markdown and HTML documents by running
+// pandoc, a far lighter process than LibreOffice for them. It only produces
+// plain PDFs, through Engine; see Supports.
+type Pandoc struct {
+	// BinaryPath is the pandoc binary; empty means "pandoc" on PATH.
+	BinaryPath string
+	// Engine is the PDF engine pandoc typesets with, one of PandocEngines,
+	// which must be installed too. Empty means pdflatex.
+	Engine string
+	// Timeout bounds each conversion; 0 leaves it to the context.
+	Timeout time.Duration
+	// Priority lowers the scheduling priority of each pandoc process.
+	Priority Priority
+}
+
+// Supports reports whether Pandoc can convert an input with extension ext
+// with opts: Markdown or HTML to a PDF without any other option. A preview
+// is no faster than its full conversion, so it is taken too.
+func (p *Pandoc) Supports(ext string, opts Options) bool {
+	if _, ok := pandocReaders[strings.ToLower(ext)]; !ok {
+		return false
+	}
+	opts.Preview = false
+	return opts == Options{} || opts == Options{Format: FormatPDF}
+}
+
+// Convert implements Converter. The pandoc run is traced as a
+// "pandoc.convert" span.
+func (p *Pandoc) Convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	return traced(ctx, "pandoc.convert", inputPath, opts, func(ctx context.Context) (string, error) {
+		return p.convert(ctx, inputPath, outDir, opts)
+	})
+}
+
+func (p *Pandoc) convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	ext := filepath.Ext(inputPath)
+	if !p.Supports(ext, opts) {
+		return "", fmt.Errorf("%w: pandoc cannot convert %s with %v", ErrUnsupportedFormat, ext, opts)
+	}
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	bin := p.BinaryPath
+	if bin == "" {
+		bin = "pandoc"
+	}
+	engine := p.Engine
+	if engine == "" {
+		engine = EnginePDFLaTeX
+	}
+	outPath := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(inputPath), ext)+".pdf")
+	// --sandbox keeps pandoc from reading files or URLs the document
+	// names, but not the PDF engine: wkhtmltopdf, which fetches them
+	// itself, is kept off local files, and the LaTeX engines run without
+	// shell escapes.
+	args := []string{bin, "--sandbox",
+		"--from", pandocReaders[strings.ToLower(ext)],
+		"--pdf-engine", engine,
+		"--output", outPath,
+	}
+	if engine == EngineWkhtmltopdf {
+		args = append(args, "--pdf-engine-opt=--disable-local-file-access")
+	} else {
+		args = append(args, "--pdf-engine-opt=-no-shell-escape")
+	}
+	argv := p.Priority.wrap(append(args, inputPath))
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = outDir
+	// LaTeX engines keep their caches under HOME; give them outDir, which
+	// the caller removes. Paranoid openin_any and openout_any keep them
+	// from opening absolute paths, dot files and parent directories.
+	cmd.Env = append(os.Environ(), "HOME="+outDir, "openin_any=p", "openout_any=p")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = waitDelay
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", ErrTimeout
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxPandocError {
+			msg = msg[len(msg)-maxPandocError:]
+		}
+		return "", fmt.Errorf("%w: pandoc: %w: %s", ErrConversionFailed, err, msg)
+	}
+	return checkOutput(outPath)
+}
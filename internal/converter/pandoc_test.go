@@ -0,0 +1,97 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// fakePandoc is a pandoc recording its arguments to args and the LaTeX
+// engines' file access settings to args.env, and writing a PDF to its
+// --output, or failing with the message fail.
+func fakePandoc(t *testing.T, dir, args, fail string) string {
+	t.Helper()
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\necho \"$openin_any $openout_any\" > " + args + ".env\n"
+	if fail != "" {
+		script += "echo '" + fail + "' >&2\nexit 43\n"
+	}
+	script += "while [ $# -gt 0 ]; do [ \"$1\" = --output ] && echo '%PDF-1.5' > \"$2\"; shift; done\n"
+	return writeScript(t, dir, script)
+}
+
+func TestPandoc_Convert(t *testing.T) {
+	for _, tc := range []struct {
+		input, engine, want string
+	}{
+		{"input.md", "", "--from markdown-raw_tex-raw_attribute --pdf-engine pdflatex --output"},
+		{"input.html", converter.EngineWkhtmltopdf, "--from html --pdf-engine wkhtmltopdf --output"},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			dir := t.TempDir()
+			argFile := filepath.Join(dir, "args")
+			in := filepath.Join(dir, tc.input)
+			if err := os.WriteFile(in, []byte("# Title\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			p := &converter.Pandoc{BinaryPath: fakePandoc(t, dir, argFile, ""), Engine: tc.engine}
+			out, err := p.Convert(context.Background(), in, dir, converter.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != filepath.Join(dir, "input.pdf") {
+				t.Errorf("output %q", out)
+			}
+			args, _ := os.ReadFile(argFile)
+			if !strings.HasPrefix(string(args), "--sandbox ") || !strings.Contains(string(args), tc.want) {
+				t.Errorf("args %q, want %q", args, tc.want)
+			}
+			wk := tc.engine == converter.EngineWkhtmltopdf
+			if strings.Contains(string(args), "--disable-local-file-access") != wk || strings.Contains(string(args), "-no-shell-escape") == wk {
+				t.Errorf("args %q", args)
+			}
+			if env, _ := os.ReadFile(argFile + ".env"); string(env) != "p p\n" {
+				t.Errorf("openin_any and openout_any %q, want paranoid", env)
+			}
+		})
+	}
+}
+
+func TestPandoc_Failure(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "input.md")
+	os.WriteFile(in, []byte("# Title\n"), 0o600)
+	p := &converter.Pandoc{BinaryPath: fakePandoc(t, dir, filepath.Join(dir, "args"), "pdflatex not found")}
+	_, err := p.Convert(context.Background(), in, dir, converter.Options{})
+	if !errors.Is(err, converter.ErrConversionFailed) || !strings.Contains(err.Error(), "pdflatex not found") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPandoc_Supports(t *testing.T) {
+	p := &converter.Pandoc{}
+	for _, tc := range []struct {
+		ext  string
+		opts converter.Options
+		want bool
+	}{
+		{".md", converter.Options{}, true},
+		{".HTML", converter.Options{Format: converter.FormatPDF}, true},
+		{".docx", converter.Options{}, false},
+		{".md", converter.Options{Format: converter.FormatDOCX}, false},
+		{".md", converter.Options{PDFVersion: converter.PDFA2B}, false},
+		{".html", converter.Options{Pages: "1"}, false},
+	} {
+		if got := p.Supports(tc.ext, tc.opts); got != tc.want {
+			t.Errorf("Supports(%s, %v) = %v", tc.ext, tc.opts, got)
+		}
+	}
+	in := filepath.Join(t.TempDir(), "input.md")
+	if _, err := p.Convert(context.Background(), in, t.TempDir(), converter.Options{Pages: "1"}); !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Errorf("expected unsupported format, got %v", err)
+	}
+}
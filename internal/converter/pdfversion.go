@@ -0,0 +1,129 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDF versions accepted in Options.PDFVersion and reported by
+// DetectPDFVersion.
+const (
+	PDF15  = "1.5"
+	PDF16  = "1.6"
+	PDF17  = "1.7"
+	PDFA1B = "pdfa-1b"
+	PDFA2B = "pdfa-2b"
+	PDFA3B = "pdfa-3b"
+)
+
+// selectPdfVersion maps each PDF version to the value of the PDF export
+// filter's SelectPdfVersion option.
+var selectPdfVersion = map[string]string{
+	PDF15:  "15",
+	PDF16:  "16",
+	PDF17:  "17",
+	PDFA1B: "1",
+	PDFA2B: "2",
+	PDFA3B: "3",
+}
+
+// PDFVersions lists the accepted PDF versions, oldest first.
+var PDFVersions = []string{PDF15, PDF16, PDF17, PDFA1B, PDFA2B, PDFA3B}
+
+// ErrUnknownPDFVersion is returned by ParsePDFVersion for a version not in
+// PDFVersions.
+var ErrUnknownPDFVersion = errors.New("unknown pdf version")
+
+// ParsePDFVersion returns the PDF version named by s, in the form used by
+// Options.PDFVersion. It is case-insensitive and also accepts the written
+// forms "PDF-1.7" and "PDF/A-2b".
+func ParsePDFVersion(s string) (string, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	v = strings.TrimPrefix(v, "pdf-")
+	v = strings.Replace(v, "pdf/a", "pdfa", 1)
+	if _, ok := selectPdfVersion[v]; !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownPDFVersion, s)
+	}
+	return v, nil
+}
+
+// ParsePDFVersions parses per-tenant PDF versions in the form
+// "tenant=pdfa-2b;other=1.6".
+func ParsePDFVersions(s string) (map[string]string, error) {
+	return parseTenantRules(s, ParsePDFVersion)
+}
+
+// Markers DetectPDFVersion looks for. PDF/A conformance is declared in the
+// document's XMP metadata, as either elements or attributes.
+var (
+	pdfHeader      = []byte("%PDF-")
+	pdfaPart       = []byte("pdfaid:part")
+	pdfaConformant = []byte("pdfaid:conformance")
+)
+
+// DetectPDFVersion reports the version of the PDF read from r, in the form
+// of PDFVersions: a PDF/A version ("pdfa-2b") when the XMP metadata declares
+// conformance, otherwise the header's ("1.7"). It reads all of r.
+func DetectPDFVersion(r io.Reader) (string, error) {
+	const overlap = 64 // longer than any marker and its value
+	buf := make([]byte, 64<<10)
+	n, err := io.ReadFull(r, buf[:len(pdfHeader)+3])
+	if err != nil || !bytes.HasPrefix(buf[:n], pdfHeader) {
+		return "", errors.New("converter: not a pdf")
+	}
+	version := string(buf[len(pdfHeader):n])
+
+	var part, conformance byte
+	kept := 0
+	for {
+		n, err := r.Read(buf[kept:])
+		window := buf[:kept+n]
+		if part == 0 {
+			part = markerValue(window, pdfaPart)
+		}
+		if conformance == 0 {
+			conformance = markerValue(window, pdfaConformant)
+		}
+		if part != 0 && conformance != 0 {
+			break
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		kept = min(len(window), overlap)
+		copy(buf, window[len(window)-kept:])
+	}
+	if part == 0 {
+		return version, nil
+	}
+	if conformance == 0 {
+		conformance = 'b'
+	}
+	return "pdfa-" + strings.ToLower(string([]byte{part, conformance})), nil
+}
+
+// markerValue returns the first character of the value following marker in
+// p, in "<marker>2</marker>" or `marker="2"` form, or 0 if p has none.
+func markerValue(p, marker []byte) byte {
+	for {
+		i := bytes.Index(p, marker)
+		if i < 0 {
+			return 0
+		}
+		p = p[i+len(marker):]
+		v := bytes.TrimLeft(p, " \t\r\n=\"'>")
+		if len(v) > 0 && len(v) < len(p) && isAlnum(v[0]) {
+			return v[0]
+		}
+	}
+}
+
+func isAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,65 @@
+package converter_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+func TestParsePDFVersion(t *testing.T) {
+	cases := map[string]string{
+		"1.7":      converter.PDF17,
+		" PDF-1.5": converter.PDF15,
+		"PDFA-2B":  converter.PDFA2B,
+		"PDF/A-3b": converter.PDFA3B,
+	}
+	for in, want := range cases {
+		if got, err := converter.ParsePDFVersion(in); err != nil || got != want {
+			t.Errorf("ParsePDFVersion(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "2.0", "pdfa-2u", "pdf"} {
+		if _, err := converter.ParsePDFVersion(in); !errors.Is(err, converter.ErrUnknownPDFVersion) {
+			t.Errorf("ParsePDFVersion(%q): expected ErrUnknownPDFVersion, got %v", in, err)
+		}
+	}
+}
+
+func TestParsePDFVersions(t *testing.T) {
+	got, err := converter.ParsePDFVersions("archive=PDF/A-2b; print = 1.6;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["archive"] != converter.PDFA2B || got["print"] != converter.PDF16 {
+		t.Errorf("unexpected versions %v", got)
+	}
+	for _, in := range []string{"archive", "=1.7", "archive=2.0"} {
+		if _, err := converter.ParsePDFVersions(in); err == nil {
+			t.Errorf("ParsePDFVersions(%q): expected an error", in)
+		}
+	}
+}
+
+func TestDetectPDFVersion(t *testing.T) {
+	// The XMP packet sits well past the first read, split across reads.
+	padding := strings.Repeat("0 0 obj\n", 20000)
+	cases := map[string]string{
+		"%PDF-1.7\n" + padding + "%%EOF": converter.PDF17,
+		"%PDF-1.4\n" + padding + "<pdfaid:part>1</pdfaid:part><pdfaid:conformance>B</pdfaid:conformance>":    converter.PDFA1B,
+		"%PDF-1.7\n" + padding + `<rdf:Description pdfaid:part="3" pdfaid:conformance="B"/>`:                 converter.PDFA3B,
+		"%PDF-1.7\n<x:xmpmeta xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\"><pdfaid:part>2</pdfaid:part>": converter.PDFA2B,
+	}
+	for doc, want := range cases {
+		got, err := converter.DetectPDFVersion(iotest.HalfReader(strings.NewReader(doc)))
+		if err != nil || got != want {
+			t.Errorf("DetectPDFVersion(%.20q...) = %q, %v; want %q", doc, got, err, want)
+		}
+	}
+	if _, err := converter.DetectPDFVersion(bytes.NewReader([]byte("PK\x03\x04"))); err == nil {
+		t.Error("expected an error for a non-PDF")
+	}
+}
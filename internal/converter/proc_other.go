@@ -0,0 +1,15 @@
+//go:build !unix
+
+package converter
+
+import (
+	"os"
+	"os/exec"
+)
+
+// killGroupOnCancel is a no-op where process groups are unavailable; only the
+// direct child is killed on cancellation.
+func killGroupOnCancel(cmd *exec.Cmd) {}
+
+// cpuLimited is always false where there is no RLIMIT_CPU.
+func cpuLimited(ps *os.ProcessState) bool { return false }
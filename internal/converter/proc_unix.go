@@ -0,0 +1,30 @@
+//go:build unix
+
+package converter
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// killGroupOnCancel starts cmd in its own process group and makes context
+// cancellation kill the whole group. The soffice launcher forks soffice.bin,
+// which would otherwise outlive the killed parent and keep its memory.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// cpuLimited reports whether ps ended with SIGXCPU, or is the soffice
+// launcher reporting that soffice.bin did.
+func cpuLimited(ps *os.ProcessState) bool {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok {
+		return false
+	}
+	return ws.Signaled() && ws.Signal() == syscall.SIGXCPU ||
+		ws.Exited() && ws.ExitStatus() == 128+int(syscall.SIGXCPU)
+}
@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxProfileTemplate caps the size of a profile template, which is held in
+// memory and written out for every conversion.
+const maxProfileTemplate = 8 << 20
+
+// ProfileTemplate is a pre-baked LibreOffice user profile, e.g. a
+// registrymodifications.xcu with autocorrect disabled, fixed measurement
+// units or default fonts. It is copied into every fresh profile before
+// soffice starts, instead of LibreOffice generating defaults each time.
+type ProfileTemplate struct {
+	// files maps slash-separated paths under the profile root (the
+	// directory UserInstallation points at) to their contents.
+	files map[string][]byte
+}
+
+// LoadProfileTemplate reads a profile template from path, which is either a
+// single registrymodifications.xcu file or a profile directory: the
+// directory holding "user/", or the "user" directory itself. Every .xcu file
+// must be well-formed XML.
+func LoadProfileTemplate(path string) (*ProfileTemplate, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &ProfileTemplate{files: make(map[string][]byte)}
+	if !info.IsDir() {
+		if err := t.add(registryFile, path); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	prefix := "user/"
+	if sub, err := os.Stat(filepath.Join(path, "user")); err == nil && sub.IsDir() {
+		prefix = ""
+	}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("profile template: %s is not a regular file", p)
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		return t.add(prefix+filepath.ToSlash(rel), p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(t.files) == 0 {
+		return nil, errors.New("profile template: " + path + " is empty")
+	}
+	return t, nil
+}
+
+// add reads the file at src into the template as name.
+func (t *ProfileTemplate) add(name, src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	total := len(data)
+	for _, f := range t.files {
+		total += len(f)
+	}
+	if total > maxProfileTemplate {
+		return fmt.Errorf("profile template: larger than %d bytes", maxProfileTemplate)
+	}
+	if strings.HasSuffix(name, ".xcu") {
+		if err := checkXML(data); err != nil {
+			return fmt.Errorf("profile template: %s: %w", src, err)
+		}
+	}
+	t.files[name] = data
+	return nil
+}
+
+// checkXML reports whether data is a well-formed XML document.
+func checkXML(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// install writes the template into the profile root dir, replacing any
+// files of the same name.
+func (t *ProfileTemplate) install(dir string) error {
+	for name, data := range t.files {
+		dst := filepath.Join(dir, filepath.FromSlash(path.Clean(name)))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package converter_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+const xcu = `<?xml version="1.0" encoding="UTF-8"?>
+<oor:items xmlns:oor="http://openoffice.org/2001/registry">
+<item oor:path="/org.openoffice.Office.Writer/AutoFunction/Completion"><prop oor:name="Enable" oor:op="fuse"><value>false</value></prop></item>
+</oor:items>
+`
+
+// convertWithProfile runs a fake LibreOffice with tmpl and returns the
+// arguments it saw and the registrymodifications.xcu in its profile.
+func convertWithProfile(t *testing.T, tmpl *converter.ProfileTemplate) (args, profile string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+
+	argsFile := filepath.Join(tmpDir, "args.txt")
+	profileFile := filepath.Join(tmpDir, "profile.txt")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\ncat %s/lo-profile/user/registrymodifications.xcu > %s\necho fake > %s/input.pdf\n",
+		argsFile, tmpDir, profileFile, tmpDir)
+	scriptPath := filepath.Join(tmpDir, "fake-lo.sh")
+	_ = os.WriteFile(scriptPath, []byte(script), 0755)
+
+	c := &converter.LibreOffice{BinaryPath: scriptPath, Timeout: 5 * time.Second, Profile: tmpl}
+	if _, err := c.Convert(context.Background(), inputPath, tmpDir, converter.Options{}); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	a, _ := os.ReadFile(argsFile)
+	p, _ := os.ReadFile(profileFile)
+	return string(a), string(p)
+}
+
+func TestProfileTemplate_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tuned.xcu")
+	_ = os.WriteFile(path, []byte(xcu), 0600)
+	tmpl, err := converter.LoadProfileTemplate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	args, profile := convertWithProfile(t, tmpl)
+	if profile != xcu {
+		t.Errorf("profile registrymodifications.xcu = %q", profile)
+	}
+	if !strings.Contains(args, "-env:UserInstallation=file://") {
+		t.Errorf("args %q do not select the profile", args)
+	}
+}
+
+func TestProfileTemplate_Directory(t *testing.T) {
+	for _, userDir := range []bool{true, false} {
+		root := t.TempDir()
+		dir := root
+		if userDir {
+			dir = filepath.Join(root, "user")
+		}
+		_ = os.MkdirAll(filepath.Join(dir, "autotext"), 0700)
+		_ = os.WriteFile(filepath.Join(dir, "registrymodifications.xcu"), []byte(xcu), 0600)
+		_ = os.WriteFile(filepath.Join(dir, "autotext", "standard.bau"), []byte("x"), 0600)
+
+		tmpl, err := converter.LoadProfileTemplate(root)
+		if err != nil {
+			t.Fatalf("load (user dir %v): %v", userDir, err)
+		}
+		if _, profile := convertWithProfile(t, tmpl); profile != xcu {
+			t.Errorf("user dir %v: profile registrymodifications.xcu = %q", userDir, profile)
+		}
+	}
+}
+
+func TestProfileTemplate_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "registrymodifications.xcu")
+	_ = os.WriteFile(bad, []byte("<oor:items><item>"), 0600)
+
+	if _, err := converter.LoadProfileTemplate(bad); err == nil {
+		t.Error("malformed .xcu accepted")
+	}
+	if _, err := converter.LoadProfileTemplate(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing template accepted")
+	}
+	if _, err := converter.LoadProfileTemplate(t.TempDir()); err == nil {
+		t.Error("empty directory accepted")
+	}
+}
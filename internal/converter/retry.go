@@ -0,0 +1,112 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kinds of error RetryConfig.On can name.
+const (
+	// RetryFailed is ErrConversionFailed: LibreOffice exited non-zero, as
+	// it does on a profile lock race or a crash on first run.
+	RetryFailed = "failed"
+	// RetryNoOutput is ErrNoOutput: LibreOffice exited cleanly but wrote
+	// nothing.
+	RetryNoOutput = "no_output"
+	// RetryTimeout is ErrTimeout. Retrying it can double the time a
+	// request waits on a document that always hangs.
+	RetryTimeout = "timeout"
+)
+
+// RetryKinds lists every kind RetryConfig.On accepts.
+var RetryKinds = []string{RetryFailed, RetryNoOutput, RetryTimeout}
+
+// RetryConfig configures Retrying.
+type RetryConfig struct {
+	// Attempts is the most times a conversion is run, the first included
+	// (min 1).
+	Attempts int
+	// Backoff is the wait before the second attempt, doubled before each
+	// one after (default 500ms).
+	Backoff time.Duration
+	// On names the kinds of error that are retried (default RetryFailed).
+	// Errors of other kinds, such as a resource limit or an unsupported
+	// format, and a cancelled context are returned straight away.
+	On []string
+	// OnRetry, if set, is called before each retry with the number of the
+	// attempt about to be made and the error of the one before.
+	OnRetry func(ctx context.Context, attempt int, err error)
+}
+
+// Retrying returns a Converter running each conversion on conv again, with
+// backoff, when it fails with an error of a kind in cfg.On. An unknown kind
+// is an error. Every attempt writes to the same outDir.
+func Retrying(conv Converter, cfg RetryConfig) (Converter, error) {
+	if cfg.Attempts < 1 {
+		cfg.Attempts = 1
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	if len(cfg.On) == 0 {
+		cfg.On = []string{RetryFailed}
+	}
+	r := &retrying{conv: conv, cfg: cfg}
+	for _, kind := range cfg.On {
+		switch kind {
+		case RetryFailed:
+			r.on = append(r.on, ErrConversionFailed)
+		case RetryNoOutput:
+			r.on = append(r.on, ErrNoOutput)
+		case RetryTimeout:
+			r.on = append(r.on, ErrTimeout)
+		default:
+			return nil, fmt.Errorf("unknown retry error kind %q", kind)
+		}
+	}
+	return r, nil
+}
+
+type retrying struct {
+	conv Converter
+	cfg  RetryConfig
+	on   []error
+}
+
+// Convert implements Converter.
+func (r *retrying) Convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	backoff := r.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		out, err := r.conv.Convert(ctx, inputPath, outDir, opts)
+		if err == nil || attempt == r.cfg.Attempts || !r.retryable(ctx, err) {
+			return out, err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return out, err
+		case <-t.C:
+		}
+		backoff *= 2
+		if r.cfg.OnRetry != nil {
+			r.cfg.OnRetry(ctx, attempt+1, err)
+		}
+	}
+}
+
+// retryable reports whether err is of a kind to retry. A resource limit is
+// never retried, even where it comes wrapped in another kind.
+func (r *retrying) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrResourceLimit) {
+		return false
+	}
+	for _, target := range r.on {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// flaky is a Converter failing with each of errs in turn, then succeeding.
+type flaky struct {
+	errs  []error
+	calls int
+}
+
+func (f *flaky) Convert(context.Context, string, string, converter.Options) (string, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return "", f.errs[f.calls-1]
+	}
+	return "out.pdf", nil
+}
+
+func TestRetrying(t *testing.T) {
+	failed := fmt.Errorf("%w: exit status 139", converter.ErrConversionFailed)
+	for _, tc := range []struct {
+		name      string
+		on        []string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds after transient failures", nil, []error{failed, failed}, 3, nil},
+		{"gives up after the last attempt", nil, []error{failed, failed, failed, failed}, 3, converter.ErrConversionFailed},
+		{"does not retry other kinds", nil, []error{converter.ErrTimeout}, 1, converter.ErrTimeout},
+		{"retries the kinds configured", []string{converter.RetryTimeout, converter.RetryNoOutput}, []error{converter.ErrTimeout, converter.ErrNoOutput}, 3, nil},
+		{"never retries a resource limit", nil, []error{&converter.LimitError{Resource: converter.ResourceCPU}}, 1, converter.ErrResourceLimit},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := &flaky{errs: tc.errs}
+			var retries []int
+			conv, err := converter.Retrying(inner, converter.RetryConfig{
+				Attempts: 3,
+				Backoff:  time.Millisecond,
+				On:       tc.on,
+				OnRetry:  func(_ context.Context, attempt int, _ error) { retries = append(retries, attempt) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := conv.Convert(context.Background(), "in.docx", t.TempDir(), converter.Options{})
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && err != nil) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if err == nil && out != "out.pdf" {
+				t.Errorf("unexpected output %q", out)
+			}
+			if inner.calls != tc.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tc.wantCalls, inner.calls)
+			}
+			if len(retries) != tc.wantCalls-1 || (len(retries) > 0 && retries[0] != 2) {
+				t.Errorf("unexpected retries %v", retries)
+			}
+		})
+	}
+}
+
+func TestRetrying_StopsWhenCancelled(t *testing.T) {
+	inner := &flaky{errs: []error{converter.ErrConversionFailed, converter.ErrConversionFailed}}
+	conv, _ := converter.Retrying(inner, converter.RetryConfig{Attempts: 3, Backoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := conv.Convert(ctx, "in.docx", t.TempDir(), converter.Options{}); !errors.Is(err, converter.ErrConversionFailed) {
+		t.Fatalf("expected the last failure, got %v", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected no retry once cancelled, got %d attempts", inner.calls)
+	}
+}
+
+func TestRetrying_UnknownKind(t *testing.T) {
+	if _, err := converter.Retrying(&flaky{}, converter.RetryConfig{On: []string{"crash"}}); err == nil {
+		t.Error("expected an error for an unknown error kind")
+	}
+}
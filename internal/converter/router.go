@@ -0,0 +1,244 @@
+package converter
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of a conversion on one backend, as reported to a RouterObserver.
+const (
+	BackendSuccess       = "success"
+	BackendFailed        = "failed"
+	BackendTimeout       = "timeout"
+	BackendUnsupported   = "unsupported"
+	BackendResourceLimit = "resource_limit"
+	BackendCanceled      = "canceled"
+)
+
+// Route is one backend of a Router.
+type Route struct {
+	// Name identifies the backend in metrics and logs.
+	Name string
+	Conv Converter
+	// Types restricts the backend to inputs with these extensions, such as
+	// ".docx". Empty takes any input.
+	Types []string
+	// MaxInFlight is the conversions the backend can run at once; past it
+	// the backend is passed over while another can take the document. 0 is
+	// no limit.
+	MaxInFlight int
+}
+
+// Supporter is implemented by converters that cannot carry out every
+// conversion, such as Gotenberg. A Router does not send them the
+// conversions they do not support.
+type Supporter interface {
+	Supports(ext string, opts Options) bool
+}
+
+// RouterObserver receives a Router's per-backend events.
+type RouterObserver interface {
+	// BackendConverted is called after each conversion a backend is given,
+	// with its outcome.
+	BackendConverted(backend, outcome string)
+	// BackendFellBack is called when a conversion that failed on one
+	// backend is tried on the next.
+	BackendFellBack(from, to string)
+	// BackendHealthChanged is called when a backend is taken out of
+	// rotation after failing repeatedly, and when it is back.
+	BackendHealthChanged(backend string, healthy bool)
+}
+
+// RouterConfig configures a Router.
+type RouterConfig struct {
+	// Routes are the backends in order of preference.
+	Routes []Route
+	// FailureThreshold is the consecutive failures after which a backend
+	// is taken out of rotation for Cooldown (default 3). Unsupported
+	// conversions, resource limits and cancellations are not failures.
+	FailureThreshold int
+	// Cooldown is how long a failing backend is out of rotation before it
+	// is tried again (default 30s).
+	Cooldown time.Duration
+	// Observer, if set, receives per-backend events.
+	Observer RouterObserver
+}
+
+// Router is a Converter spreading conversions over several backends. Each
+// conversion goes to the first backend, in order of preference, that takes
+// its input type and options, has room for it and is in rotation; when it
+// fails there it is tried on the next. A backend that fails
+// FailureThreshold times in a row is out of rotation for Cooldown, and is
+// only used meanwhile when no other backend can take the conversion.
+type Router struct {
+	cfg      RouterConfig
+	backends []*backend
+}
+
+// backend is a Route with its load and health.
+type backend struct {
+	Route
+	types []string
+
+	mu       sync.Mutex
+	inFlight int
+	failures int       // consecutive
+	down     time.Time // out of rotation until
+}
+
+// NewRouter returns a Router over cfg.Routes. It is an error to give no
+// routes, or two with the same name.
+func NewRouter(cfg RouterConfig) (*Router, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, errors.New("router: no backends")
+	}
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 3
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	r := &Router{cfg: cfg}
+	seen := map[string]bool{}
+	for _, rt := range cfg.Routes {
+		if rt.Name == "" || rt.Conv == nil {
+			return nil, errors.New("router: backend without a name or converter")
+		}
+		if seen[rt.Name] {
+			return nil, fmt.Errorf("router: duplicate backend %q", rt.Name)
+		}
+		seen[rt.Name] = true
+		b := &backend{Route: rt}
+		for _, t := range rt.Types {
+			b.types = append(b.types, "."+strings.TrimPrefix(strings.ToLower(t), "."))
+		}
+		r.backends = append(r.backends, b)
+		if cfg.Observer != nil {
+			cfg.Observer.BackendHealthChanged(rt.Name, true)
+		}
+	}
+	return r, nil
+}
+
+// Backends returns the names of the backends that would be tried for an
+// input with extension ext, in order.
+func (r *Router) Backends(ext string, opts Options) []string {
+	var names []string
+	for _, b := range r.order(ext, opts) {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+// order returns the backends that can take a conversion: those in
+// rotation with room for it, then those in rotation without, then those
+// out of rotation, each in order of preference.
+func (r *Router) order(ext string, opts Options) []*backend {
+	ext = strings.ToLower(ext)
+	now := time.Now()
+	var ready, full, down []*backend
+	for _, b := range r.backends {
+		if len(b.types) > 0 && !slices.Contains(b.types, ext) {
+			continue
+		}
+		if s, ok := b.Conv.(Supporter); ok && !s.Supports(ext, opts) {
+			continue
+		}
+		b.mu.Lock()
+		switch {
+		case now.Before(b.down):
+			down = append(down, b)
+		case b.MaxInFlight > 0 && b.inFlight >= b.MaxInFlight:
+			full = append(full, b)
+		default:
+			ready = append(ready, b)
+		}
+		b.mu.Unlock()
+	}
+	return slices.Concat(ready, full, down)
+}
+
+// Convert implements Converter. When every backend fails, the last one's
+// error is returned; when none takes the input, ErrUnsupportedFormat.
+func (r *Router) Convert(ctx context.Context, inputPath, outDir string, opts Options) (string, error) {
+	backends := r.order(filepath.Ext(inputPath), opts)
+	if len(backends) == 0 {
+		return "", fmt.Errorf("%w: no backend converts %s to %s", ErrUnsupportedFormat, filepath.Ext(inputPath), cmp.Or(opts.Format, FormatPDF))
+	}
+	var err error
+	for i, b := range backends {
+		if i > 0 && r.cfg.Observer != nil {
+			r.cfg.Observer.BackendFellBack(backends[i-1].Name, b.Name)
+		}
+		var out string
+		out, err = r.convert(ctx, b, inputPath, outDir, opts)
+		if err == nil {
+			return out, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrResourceLimit) {
+			break
+		}
+	}
+	return "", err
+}
+
+// convert runs one conversion on b, keeping its load and health.
+func (r *Router) convert(ctx context.Context, b *backend, inputPath, outDir string, opts Options) (string, error) {
+	b.mu.Lock()
+	b.inFlight++
+	b.mu.Unlock()
+	out, err := b.Conv.Convert(ctx, inputPath, outDir, opts)
+	outcome := backendOutcome(ctx, err)
+
+	b.mu.Lock()
+	b.inFlight--
+	changed, healthy := false, false
+	switch outcome {
+	case BackendSuccess:
+		changed, healthy = b.failures >= r.cfg.FailureThreshold, true
+		b.failures, b.down = 0, time.Time{}
+	case BackendFailed, BackendTimeout:
+		b.failures++
+		if b.failures >= r.cfg.FailureThreshold {
+			changed = b.failures == r.cfg.FailureThreshold
+			b.down = time.Now().Add(r.cfg.Cooldown)
+		}
+	}
+	b.mu.Unlock()
+
+	if obs := r.cfg.Observer; obs != nil {
+		obs.BackendConverted(b.Name, outcome)
+		if changed {
+			obs.BackendHealthChanged(b.Name, healthy)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", b.Name, err)
+	}
+	return out, err
+}
+
+// backendOutcome classifies the result of a conversion on one backend.
+func backendOutcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return BackendSuccess
+	case ctx.Err() != nil:
+		return BackendCanceled
+	case errors.Is(err, ErrResourceLimit):
+		return BackendResourceLimit
+	case errors.Is(err, ErrUnsupportedFormat):
+		return BackendUnsupported
+	case errors.Is(err, ErrTimeout):
+		return BackendTimeout
+	default:
+		return BackendFailed
+	}
+}
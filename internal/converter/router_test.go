@@ -0,0 +1,255 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// backendFunc is a Converter "writing" inputPath + ".pdf" unless it fails.
+type backendFunc func(ctx context.Context, inputPath string, opts converter.Options) error
+
+func (f backendFunc) Convert(ctx context.Context, inputPath, _ string, opts converter.Options) (string, error) {
+	if err := f(ctx, inputPath, opts); err != nil {
+		return "", err
+	}
+	return inputPath + ".pdf", nil
+}
+
+func ok(context.Context, string, converter.Options) error { return nil }
+
+func failing(err error) backendFunc {
+	return func(context.Context, string, converter.Options) error { return err }
+}
+
+// pdfOnly is a backend that only takes PDF output.
+type pdfOnly struct{ backendFunc }
+
+func (pdfOnly) Supports(_ string, opts converter.Options) bool {
+	return opts.Format == "" || opts.Format == converter.FormatPDF
+}
+
+// events records a Router's observer calls.
+type events struct {
+	mu        sync.Mutex
+	converted []string
+	fellBack  []string
+	health    []string
+}
+
+func (e *events) BackendConverted(backend, outcome string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.converted = append(e.converted, backend+"="+outcome)
+}
+
+func (e *events) BackendFellBack(from, to string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fellBack = append(e.fellBack, from+"->"+to)
+}
+
+func (e *events) BackendHealthChanged(backend string, healthy bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.health = append(e.health, fmt.Sprintf("%s=%v", backend, healthy))
+}
+
+func TestRouter_FallsBack(t *testing.T) {
+	failed := fmt.Errorf("%w: exit status 1", converter.ErrConversionFailed)
+	ev := &events{}
+	r, err := converter.NewRouter(converter.RouterConfig{
+		Routes: []converter.Route{
+			{Name: "unoserver", Conv: failing(failed)},
+			{Name: "libreoffice", Conv: backendFunc(ok)},
+		},
+		Observer: ev,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.Convert(context.Background(), "in.docx", t.TempDir(), converter.Options{})
+	if err != nil || out != "in.docx.pdf" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+	if !slices.Equal(ev.converted, []string{"unoserver=failed", "libreoffice=success"}) || !slices.Equal(ev.fellBack, []string{"unoserver->libreoffice"}) {
+		t.Errorf("events %+v", ev)
+	}
+}
+
+func TestRouter_ReturnsLastError(t *testing.T) {
+	r, err := converter.NewRouter(converter.RouterConfig{Routes: []converter.Route{
+		{Name: "a", Conv: failing(converter.ErrConversionFailed)},
+		{Name: "b", Conv: failing(converter.ErrTimeout)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Convert(context.Background(), "in.docx", t.TempDir(), converter.Options{}); !errors.Is(err, converter.ErrTimeout) {
+		t.Errorf("expected the last backend's timeout, got %v", err)
+	}
+}
+
+func TestRouter_NoFallbackOnResourceLimit(t *testing.T) {
+	called := false
+	r, err := converter.NewRouter(converter.RouterConfig{Routes: []converter.Route{
+		{Name: "a", Conv: failing(&converter.LimitError{Resource: converter.ResourceRSS})},
+		{Name: "b", Conv: backendFunc(func(context.Context, string, converter.Options) error { called = true; return nil })},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Convert(context.Background(), "in.docx", t.TempDir(), converter.Options{}); !errors.Is(err, converter.ErrResourceLimit) {
+		t.Errorf("expected a resource limit, got %v", err)
+	}
+	if called {
+		t.Error("a document over a resource limit was tried again")
+	}
+}
+
+func TestRouter_ByTypeAndOptions(t *testing.T) {
+	r, err := converter.NewRouter(converter.RouterConfig{Routes: []converter.Route{
+		{Name: "gotenberg", Conv: pdfOnly{backendFunc(ok)}, Types: []string{"docx", ".XLSX"}},
+		{Name: "libreoffice", Conv: backendFunc(ok)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		ext  string
+		opts converter.Options
+		want []string
+	}{
+		{".docx", converter.Options{}, []string{"gotenberg", "libreoffice"}},
+		{".xlsx", converter.Options{}, []string{"gotenberg", "libreoffice"}},
+		{".pptx", converter.Options{}, []string{"libreoffice"}},
+		{".docx", converter.Options{Format: converter.FormatPNG}, []string{"libreoffice"}},
+	} {
+		if got := r.Backends(tc.ext, tc.opts); !slices.Equal(got, tc.want) {
+			t.Errorf("%s %+v: got %v, want %v", tc.ext, tc.opts, got, tc.want)
+		}
+	}
+
+	only, err := converter.NewRouter(converter.RouterConfig{Routes: []converter.Route{
+		{Name: "gotenberg", Conv: pdfOnly{backendFunc(ok)}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := only.Convert(context.Background(), "in.docx", t.TempDir(), converter.Options{Format: converter.FormatPNG}); !errors.Is(err, converter.ErrUnsupportedFormat) {
+		t.Errorf("expected unsupported format, got %v", err)
+	}
+}
+
+func TestRouter_PassesOverFullBackend(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var mu sync.Mutex
+	var used []string
+	record := func(name string) backendFunc {
+		return func(_ context.Context, input string, _ converter.Options) error {
+			mu.Lock()
+			used = append(used, name)
+			mu.Unlock()
+			if input == "slow.docx" {
+				close(started)
+				<-release
+			}
+			return nil
+		}
+	}
+	r, err := converter.NewRouter(converter.RouterConfig{Routes: []converter.Route{
+		{Name: "unoserver", Conv: record("unoserver"), MaxInFlight: 1},
+		{Name: "libreoffice", Conv: record("libreoffice")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := r.Convert(context.Background(), "slow.docx", t.TempDir(), converter.Options{})
+		done <- err
+	}()
+	<-started
+	if got := r.Backends(".docx", converter.Options{}); !slices.Equal(got, []string{"libreoffice", "unoserver"}) {
+		t.Errorf("while full: %v", got)
+	}
+	if _, err := r.Convert(context.Background(), "fast.docx", t.TempDir(), converter.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(used, []string{"unoserver", "libreoffice"}) {
+		t.Errorf("backends used %v", used)
+	}
+}
+
+func TestRouter_TakesFailingBackendOutOfRotation(t *testing.T) {
+	var healthy bool
+	var mu sync.Mutex
+	flappy := backendFunc(func(context.Context, string, converter.Options) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if healthy {
+			return nil
+		}
+		return converter.ErrConversionFailed
+	})
+	ev := &events{}
+	r, err := converter.NewRouter(converter.RouterConfig{
+		Routes: []converter.Route{
+			{Name: "gotenberg", Conv: flappy},
+			{Name: "libreoffice", Conv: backendFunc(ok)},
+		},
+		FailureThreshold: 2,
+		Cooldown:         50 * time.Millisecond,
+		Observer:         ev,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	convert := func() {
+		t.Helper()
+		if _, err := r.Convert(context.Background(), "in.docx", t.TempDir(), converter.Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	convert()
+	convert()
+	if got := r.Backends(".docx", converter.Options{}); !slices.Equal(got, []string{"libreoffice", "gotenberg"}) {
+		t.Errorf("after %d failures: %v", 2, got)
+	}
+	convert()
+	if n := len(ev.converted); n != 5 {
+		t.Errorf("a backend out of rotation was tried: %v", ev.converted)
+	}
+
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	time.Sleep(60 * time.Millisecond)
+	convert()
+	want := []string{"gotenberg=true", "libreoffice=true", "gotenberg=false", "gotenberg=true"}
+	if !slices.Equal(ev.health, want) {
+		t.Errorf("health %v, want %v", ev.health, want)
+	}
+}
+
+func TestNewRouter_Errors(t *testing.T) {
+	if _, err := converter.NewRouter(converter.RouterConfig{}); err == nil {
+		t.Error("no routes accepted")
+	}
+	if _, err := converter.NewRouter(converter.RouterConfig{Routes: []converter.Route{
+		{Name: "a", Conv: backendFunc(ok)}, {Name: "a", Conv: backendFunc(ok)},
+	}}); err == nil {
+		t.Error("duplicate names accepted")
+	}
+}
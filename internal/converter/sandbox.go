@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Sandbox tools.
+const (
+	SandboxBubblewrap = "bwrap"
+	SandboxNsjail     = "nsjail"
+	SandboxUnshare    = "unshare"
+)
+
+// DefaultSandboxReadOnly are the paths bound read-only into the sandbox when
+// Sandbox.ReadOnly is empty: enough for soffice, its libraries and fonts.
+var DefaultSandboxReadOnly = []string{"/usr", "/lib", "/lib64", "/bin", "/sbin", "/etc", "/opt"}
+
+// Sandbox confines each LibreOffice process, which parses untrusted
+// documents, with an external tool: bubblewrap or nsjail give it a
+// read-only view of the system with only the conversion's directory
+// writable, and no network; unshare only takes the network away.
+type Sandbox struct {
+	// Tool is SandboxBubblewrap, SandboxNsjail or SandboxUnshare.
+	Tool string
+	// Path is the tool's binary; empty looks Tool up on PATH.
+	Path string
+	// ReadOnly are the paths bound read-only (default
+	// DefaultSandboxReadOnly). unshare does not change the filesystem.
+	ReadOnly []string
+	// UID and GID, if non-zero, are the user and group soffice runs as. The
+	// server must run as root to switch to them.
+	UID, GID int
+	// CPUSeconds caps the CPU time of each process (RLIMIT_CPU); 0 is no cap.
+	CPUSeconds int
+	// MemoryMB caps the address space of each process (RLIMIT_AS); 0 is no
+	// cap. soffice maps far more than it touches, so leave ample room.
+	MemoryMB int
+}
+
+// Sandboxed returns a copy of lo whose conversions run in sb. It takes a
+// LibreOffice rather than decorating any Converter because the sandbox wraps
+// the argv of each soffice it starts, which a Converter does not expose.
+func Sandboxed(lo *LibreOffice, sb Sandbox) *LibreOffice {
+	c := *lo
+	c.Sandbox = &sb
+	return &c
+}
+
+// wrap returns argv run inside the sandbox, with the writable directories
+// bound read-write. Like Priority, every wrapper execs or waits on soffice
+// in its own process group, so timeouts still kill it.
+func (s *Sandbox) wrap(argv []string, writable ...string) ([]string, error) {
+	if s == nil {
+		return argv, nil
+	}
+	tool := s.Path
+	if tool == "" {
+		tool = s.Tool
+	}
+	readOnly := s.ReadOnly
+	if len(readOnly) == 0 {
+		readOnly = DefaultSandboxReadOnly
+	}
+	writable = dedupe(writable)
+
+	var prefix []string
+	if s.Tool != SandboxNsjail {
+		// nsjail switches user and sets limits itself.
+		if s.UID != 0 || s.GID != 0 {
+			prefix = append(prefix, "setpriv", "--reuid="+strconv.Itoa(s.UID), "--regid="+strconv.Itoa(s.GID), "--clear-groups")
+		}
+		if s.CPUSeconds > 0 || s.MemoryMB > 0 {
+			prefix = append(prefix, "prlimit")
+			if s.CPUSeconds > 0 {
+				prefix = append(prefix, "--cpu="+strconv.Itoa(s.CPUSeconds))
+			}
+			if s.MemoryMB > 0 {
+				prefix = append(prefix, "--as="+strconv.FormatInt(int64(s.MemoryMB)<<20, 10))
+			}
+			prefix = append(prefix, "--")
+		}
+	}
+
+	switch s.Tool {
+	case SandboxBubblewrap:
+		prefix = append(prefix, tool, "--unshare-all", "--die-with-parent", "--new-session")
+		for _, p := range readOnly {
+			prefix = append(prefix, "--ro-bind-try", p, p)
+		}
+		prefix = append(prefix, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+		for _, p := range writable {
+			prefix = append(prefix, "--bind", p, p)
+		}
+	case SandboxNsjail:
+		prefix = append(prefix, tool, "--mode", "o", "--quiet", "--keep_env", "--time_limit", "0",
+			"--rlimit_as", rlimit(s.MemoryMB), "--rlimit_cpu", rlimit(s.CPUSeconds),
+			"--rlimit_fsize", "inf", "--rlimit_nofile", "1024")
+		if s.UID != 0 || s.GID != 0 {
+			prefix = append(prefix, "--user", strconv.Itoa(s.UID), "--group", strconv.Itoa(s.GID))
+		}
+		for _, p := range readOnly {
+			// Unlike bubblewrap, nsjail fails on a missing mount source.
+			if _, err := os.Stat(p); err == nil {
+				prefix = append(prefix, "--bindmount_ro", p)
+			}
+		}
+		prefix = append(prefix, "--mount", "none:/tmp:tmpfs:size=268435456")
+		for _, p := range writable {
+			prefix = append(prefix, "--bindmount", p)
+		}
+	case SandboxUnshare:
+		prefix = append(prefix, tool, "--user", "--map-root-user", "--net", "--pid", "--fork", "--kill-child", "--mount-proc")
+	default:
+		return nil, fmt.Errorf("converter: unknown sandbox %q", s.Tool)
+	}
+	return append(append(prefix, "--"), argv...), nil
+}
+
+// rlimit formats an nsjail limit, where 0 means none.
+func rlimit(n int) string {
+	if n <= 0 {
+		return "inf"
+	}
+	return strconv.Itoa(n)
+}
+
+// dedupe returns the distinct cleaned paths of dirs, in order.
+func dedupe(dirs []string) []string {
+	var out []string
+	seen := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		d = filepath.Clean(d)
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package converter_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// fakeSandbox writes a sandbox tool to dir that records its arguments in
+// args.txt and runs the command after "--".
+func fakeSandbox(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "fake-sandbox.sh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s/args.txt\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift\nexec \"$@\"\n", dir)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sandboxedRun converts a dummy document with lo and returns the arguments
+// the sandbox tool was given.
+func sandboxedRun(t *testing.T, sb converter.Sandbox) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+	lo := &converter.LibreOffice{
+		BinaryPath: writeScript(t, tmpDir, fmt.Sprintf("#!/bin/sh\necho fake > %s/input.pdf\n", tmpDir)),
+		Timeout:    5 * time.Second,
+	}
+	sb.Path = fakeSandbox(t, tmpDir)
+	if _, err := converter.Sandboxed(lo, sb).Convert(context.Background(), inputPath, tmpDir, converter.Options{}); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if lo.Sandbox != nil {
+		t.Error("Sandboxed changed the converter it was given")
+	}
+	args, _ := os.ReadFile(filepath.Join(tmpDir, "args.txt"))
+	return strings.ReplaceAll(string(args), tmpDir, "$DIR")
+}
+
+func writeScript(t *testing.T, dir, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, "fake-lo.sh")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSandbox_Bubblewrap(t *testing.T) {
+	args := sandboxedRun(t, converter.Sandbox{Tool: converter.SandboxBubblewrap, ReadOnly: []string{"/usr", "/etc"}})
+	for _, want := range []string{
+		"--unshare-all --die-with-parent --new-session ",
+		"--ro-bind-try /usr /usr --ro-bind-try /etc /etc ",
+		"--bind $DIR $DIR -- $DIR/fake-lo.sh --headless",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("bwrap args %q lack %q", args, want)
+		}
+	}
+	if strings.Count(args, "--bind ") != 1 {
+		t.Errorf("the conversion directory is bound more than once: %q", args)
+	}
+}
+
+func TestSandbox_Nsjail(t *testing.T) {
+	args := sandboxedRun(t, converter.Sandbox{Tool: converter.SandboxNsjail, ReadOnly: []string{"/", "/no/such/dir"},
+		CPUSeconds: 30, MemoryMB: 2048})
+	for _, want := range []string{
+		"--mode o --quiet --keep_env ",
+		"--rlimit_as 2048 --rlimit_cpu 30 ",
+		"--bindmount_ro / ",
+		"--bindmount $DIR -- $DIR/fake-lo.sh --headless",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("nsjail args %q lack %q", args, want)
+		}
+	}
+	if strings.Contains(args, "/no/such/dir") {
+		t.Errorf("missing path bound: %q", args)
+	}
+}
+
+func TestSandbox_Unshare(t *testing.T) {
+	args := sandboxedRun(t, converter.Sandbox{Tool: converter.SandboxUnshare})
+	if !strings.HasPrefix(args, "--user --map-root-user --net ") || !strings.Contains(args, " -- $DIR/fake-lo.sh --headless") {
+		t.Errorf("unshare args %q", args)
+	}
+}
+
+func TestSandbox_UnknownTool(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.docx")
+	_ = os.WriteFile(inputPath, []byte("dummy"), 0600)
+	lo := converter.Sandboxed(&converter.LibreOffice{BinaryPath: "true", Timeout: time.Second}, converter.Sandbox{Tool: "chroot"})
+	if _, err := lo.Convert(context.Background(), inputPath, tmpDir, converter.Options{}); err == nil {
+		t.Error("expected an error for an unknown sandbox")
+	}
+}
@@ -0,0 +1,42 @@
+package converter
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+// traced runs a conversion under a span named name, a child of the request
+// span in ctx, recording the output format, the input and output sizes and
+// how long the subprocess took. Without a span in ctx it just runs it.
+func traced(ctx context.Context, name, inputPath string, opts Options, run func(context.Context) (string, error)) (string, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatPDF
+	}
+	ctx, span := tracing.Start(ctx, name, tracing.String("docpdf.format", format))
+	if span == nil {
+		return run(ctx)
+	}
+	defer span.End()
+	if opts.PDFVersion != "" {
+		span.SetAttributes(tracing.String("docpdf.pdf_version", opts.PDFVersion))
+	}
+	if info, err := os.Stat(inputPath); err == nil {
+		span.SetAttributes(tracing.Int64("docpdf.input_bytes", info.Size()))
+	}
+
+	start := time.Now()
+	out, err := run(ctx)
+	span.SetAttributes(tracing.Int64("docpdf.duration_ms", time.Since(start).Milliseconds()))
+	if err != nil {
+		span.SetError(err)
+		return out, err
+	}
+	if info, err := os.Stat(out); err == nil {
+		span.SetAttributes(tracing.Int64("docpdf.output_bytes", info.Size()))
+	}
+	return out, nil
+}
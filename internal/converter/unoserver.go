@@ -0,0 +1,453 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+)
+
+// ErrClosed is returned by UnoServer.Convert after Close.
+var ErrClosed = errors.New("converter closed")
+
+// UnoConfig configures an UnoServer.
+type UnoConfig struct {
+	// ServerPath is the unoserver executable (default "unoserver").
+	ServerPath string
+	// ConvertPath is the unoconvert executable (default "unoconvert").
+	ConvertPath string
+	// SofficePath is the LibreOffice binary unoserver launches (default
+	// "libreoffice").
+	SofficePath string
+	// Instances is the number of warm soffice processes (min 1). Each
+	// converts one document at a time.
+	Instances int
+	// BasePort is the first port used. Instance i listens for unoconvert on
+	// BasePort+2i and runs soffice's UNO socket on BasePort+2i+1.
+	BasePort int
+	// Timeout bounds a single conversion. An instance that times out is
+	// restarted, since soffice may be wedged on the document.
+	Timeout time.Duration
+	// StartTimeout bounds how long a (re)started instance may take to accept
+	// connections (default 60s).
+	StartTimeout time.Duration
+	// HealthInterval is how often idle and busy instances are probed
+	// (default 10s). An instance that stops accepting connections is
+	// restarted.
+	HealthInterval time.Duration
+	// Priority applies to the long-lived unoserver/soffice processes.
+	Priority Priority
+	// Profile, if set, is copied into each instance's user profile every
+	// time the instance starts.
+	Profile *ProfileTemplate
+}
+
+// UnoServer implements Converter by keeping long-lived LibreOffice processes
+// warm behind unoserver and submitting conversions with unoconvert, avoiding
+// soffice's 1–3s startup on every request. Crashed or unresponsive instances
+// are restarted automatically.
+type UnoServer struct {
+	cfg       UnoConfig
+	idle      chan *unoInstance
+	instances []*unoInstance
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// unoInstance is one supervised unoserver process. It is in the idle channel
+// exactly when it is healthy and not converting.
+type unoInstance struct {
+	srv     *UnoServer
+	port    int
+	unoPort int
+	dir     string // user profile, reused across restarts
+
+	mu      sync.Mutex
+	healthy bool
+	busy    bool
+	queued  bool
+	stop    context.CancelFunc // kills the current process
+	started time.Time          // when the current process became healthy
+	fresh   bool               // start the next process with an empty profile
+	pid     int                // of the current process; 0 when none runs
+
+	requestID   string // of the conversion running, when busy
+	conversions int64  // run by the current process
+}
+
+// StartUnoServer starts cfg.Instances supervised unoserver processes. It
+// returns immediately; conversions wait until an instance is ready. Call
+// Close to stop them.
+func StartUnoServer(cfg UnoConfig) (*UnoServer, error) {
+	if cfg.ServerPath == "" {
+		cfg.ServerPath = "unoserver"
+	}
+	if cfg.ConvertPath == "" {
+		cfg.ConvertPath = "unoconvert"
+	}
+	if cfg.SofficePath == "" {
+		cfg.SofficePath = "libreoffice"
+	}
+	if cfg.Instances < 1 {
+		cfg.Instances = 1
+	}
+	if cfg.BasePort == 0 {
+		cfg.BasePort = 2003
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	if cfg.StartTimeout <= 0 {
+		cfg.StartTimeout = 60 * time.Second
+	}
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &UnoServer{
+		cfg:    cfg,
+		idle:   make(chan *unoInstance, cfg.Instances),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := range cfg.Instances {
+		dir, err := os.MkdirTemp("", tempclean.Pattern("uno", ""))
+		if err != nil {
+			u.Close()
+			return nil, err
+		}
+		inst := &unoInstance{
+			srv:     u,
+			port:    cfg.BasePort + 2*i,
+			unoPort: cfg.BasePort + 2*i + 1,
+			dir:     dir,
+		}
+		u.instances = append(u.instances, inst)
+		u.wg.Add(1)
+		go inst.supervise()
+	}
+	return u, nil
+}
+
+// Dirs returns the working directories of the instances, which hold their
+// profiles for as long as the server runs.
+func (u *UnoServer) Dirs() []string {
+	dirs := make([]string, len(u.instances))
+	for i, inst := range u.instances {
+		dirs[i] = inst.dir
+	}
+	return dirs
+}
+
+// Convert implements Converter. The unoconvert run, including the wait
+// for a free instance, is traced as a "unoserver.convert" span.
+func (u *UnoServer) Convert(ctx context.Context, inputPath string, outDir string, opts Options) (string, error) {
+	return traced(ctx, "unoserver.convert", inputPath, opts, func(ctx context.Context) (string, error) {
+		return u.convert(ctx, inputPath, outDir, opts)
+	})
+}
+
+func (u *UnoServer) convert(ctx context.Context, inputPath string, outDir string, opts Options) (string, error) {
+	tgt, err := planTarget(inputPath, outDir, opts)
+	if err != nil {
+		return "", err
+	}
+	if inputPath, err = orient(inputPath, outDir, opts.Orientation); err != nil {
+		return "", err
+	}
+	if inputPath, err = importable(inputPath, outDir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(tgt.resultDir, 0700); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrConversionFailed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+	defer cancel()
+
+	inst, err := u.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer inst.release()
+	inst.mu.Lock()
+	inst.requestID = requestIDFrom(ctx)
+	inst.mu.Unlock()
+
+	format, filter, _ := strings.Cut(tgt.convertTo, ":")
+	filter, _, _ = strings.Cut(filter, ":")
+	args := []string{
+		"--host", "127.0.0.1",
+		"--port", strconv.Itoa(inst.port),
+		"--convert-to", format,
+	}
+	if filter != "" {
+		args = append(args, "--filter", filter)
+	}
+	for _, o := range tgt.filterOptions {
+		args = append(args, "--filter-options", o.name+"="+o.value)
+	}
+	args = append(args, inputPath, tgt.outPath)
+
+	cmd := exec.CommandContext(ctx, u.cfg.ConvertPath, args...)
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = waitDelay
+	if _, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			inst.restart()
+			return "", ErrTimeout
+		}
+		return "", fmt.Errorf("%w: %w", ErrConversionFailed, err)
+	}
+	return checkOutput(tgt.outPath)
+}
+
+// Close stops every instance and removes their profiles.
+func (u *UnoServer) Close() error {
+	u.cancel()
+	u.wg.Wait()
+	return nil
+}
+
+// Recycle restarts the idle instance that has been running longest, with a
+// fresh user profile, so what soffice accumulates over many conversions
+// (caches, leaked memory, a damaged profile) does not live forever. It
+// restarts at most one instance per call, so capacity drops by one at most,
+// and reports whether it did; when every instance is busy or down it does
+// nothing.
+func (u *UnoServer) Recycle() bool {
+	var oldest *unoInstance
+	var oldestStart time.Time
+	for _, inst := range u.instances {
+		inst.mu.Lock()
+		if inst.healthy && !inst.busy && (oldest == nil || inst.started.Before(oldestStart)) {
+			oldest, oldestStart = inst, inst.started
+		}
+		inst.mu.Unlock()
+	}
+	if oldest == nil {
+		return false
+	}
+	oldest.mu.Lock()
+	if !oldest.healthy || oldest.busy {
+		// Taken by a conversion since.
+		oldest.mu.Unlock()
+		return false
+	}
+	// Marked down before the lock is released, so acquire skips it.
+	oldest.healthy, oldest.fresh = false, true
+	stop := oldest.stop
+	oldest.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return true
+}
+
+// acquire waits for an idle, healthy instance.
+func (u *UnoServer) acquire(ctx context.Context) (*unoInstance, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrTimeout
+			}
+			return nil, fmt.Errorf("%w: %w", ErrConversionFailed, ctx.Err())
+		case <-u.ctx.Done():
+			return nil, ErrClosed
+		case inst := <-u.idle:
+			inst.mu.Lock()
+			inst.queued = false
+			if inst.healthy {
+				inst.busy = true
+				inst.mu.Unlock()
+				return inst, nil
+			}
+			// Went down while queued; the supervisor re-queues it once it
+			// is back.
+			inst.mu.Unlock()
+		}
+	}
+}
+
+// release returns the instance to the idle set if it is still healthy.
+func (i *unoInstance) release() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.busy = false
+	i.requestID = ""
+	i.conversions++
+	i.enqueueLocked()
+}
+
+// setHealthy records the instance's health, making it available when it
+// becomes healthy while idle.
+func (i *unoInstance) setHealthy(ok bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.healthy = ok
+	i.enqueueLocked()
+}
+
+func (i *unoInstance) enqueueLocked() {
+	if i.healthy && !i.busy && !i.queued {
+		i.queued = true
+		i.srv.idle <- i // capacity is the instance count; never blocks
+	}
+}
+
+// restart marks the instance down and kills its process; the supervisor
+// starts a new one.
+func (i *unoInstance) restart() {
+	i.mu.Lock()
+	i.healthy = false
+	stop := i.stop
+	i.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// supervise runs the instance's unoserver process until the UnoServer is
+// closed, restarting it with backoff whenever it exits.
+func (i *unoInstance) supervise() {
+	defer i.srv.wg.Done()
+	defer os.RemoveAll(i.dir)
+
+	backoff := time.Second
+	for i.srv.ctx.Err() == nil {
+		started := time.Now()
+		i.run()
+		i.setHealthy(false)
+
+		// Reset the backoff after a run that lasted a while, so an
+		// occasional crash restarts promptly but a crash loop slows down.
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		select {
+		case <-i.srv.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+// run starts unoserver, marks the instance healthy once it accepts
+// connections, probes it periodically, and returns when the process exits.
+func (i *unoInstance) run() {
+	cfg := i.srv.cfg
+	argv := cfg.Priority.wrap([]string{
+		cfg.ServerPath,
+		"--interface", "127.0.0.1",
+		"--port", strconv.Itoa(i.port),
+		"--uno-interface", "127.0.0.1",
+		"--uno-port", strconv.Itoa(i.unoPort),
+		"--executable", cfg.SofficePath,
+		"--user-installation", "file://" + i.dir + "/lo-profile",
+	})
+	ctx, cancel := context.WithCancel(i.srv.ctx)
+	defer cancel()
+	i.mu.Lock()
+	i.stop = cancel
+	fresh := i.fresh
+	i.fresh = false
+	i.mu.Unlock()
+
+	if fresh {
+		if err := os.RemoveAll(filepath.Join(i.dir, "lo-profile")); err != nil {
+			return
+		}
+	}
+	if cfg.Profile != nil {
+		if err := cfg.Profile.install(filepath.Join(i.dir, "lo-profile")); err != nil {
+			return
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "HOME="+i.dir)
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = waitDelay
+	if err := cmd.Start(); err != nil {
+		return
+	}
+	i.mu.Lock()
+	i.pid, i.conversions = cmd.Process.Pid, 0
+	i.mu.Unlock()
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		i.mu.Lock()
+		i.pid = 0
+		i.mu.Unlock()
+		close(exited)
+	}()
+
+	if !i.waitReady(exited, cfg.StartTimeout) {
+		cancel()
+		<-exited
+		return
+	}
+	i.mu.Lock()
+	i.started = time.Now()
+	i.mu.Unlock()
+	i.setHealthy(true)
+
+	ticker := time.NewTicker(cfg.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			if !i.probe() {
+				cancel()
+				<-exited
+				return
+			}
+		}
+	}
+}
+
+// waitReady polls until the instance accepts connections, the process
+// exits, or timeout elapses.
+func (i *unoInstance) waitReady(exited <-chan struct{}, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		if i.probe() {
+			return true
+		}
+		select {
+		case <-exited:
+			return false
+		case <-deadline:
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// probe reports whether unoserver accepts TCP connections.
+func (i *unoInstance) probe() bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(i.port)), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,295 @@
+package converter_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// The test binary doubles as fake unoserver and unoconvert executables when
+// DOCPDF_FAKE_UNO is set, so UnoServer can be exercised without LibreOffice.
+func TestMain(m *testing.M) {
+	if os.Getenv("DOCPDF_FAKE_UNO") != "" {
+		fakeUno(os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func fakeUno(args []string) {
+	flags := map[string]string{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "--") && i+1 < len(args) {
+			flags[args[i]] = args[i+1]
+			i++
+			continue
+		}
+		positional = append(positional, args[i])
+	}
+
+	if _, server := flags["--uno-port"]; server {
+		f, _ := os.OpenFile(os.Getenv("DOCPDF_FAKE_UNO_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		f.WriteString("start\n")
+		f.Close()
+		ln, err := net.Listen("tcp", "127.0.0.1:"+flags["--port"])
+		if err != nil {
+			os.Exit(1)
+		}
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				os.Exit(1)
+			}
+			conn.Close()
+		}
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+flags["--port"])
+	if err != nil {
+		os.Exit(1)
+	}
+	conn.Close()
+
+	in, out := positional[0], positional[1]
+	switch {
+	case strings.Contains(in, "hang"):
+		time.Sleep(time.Minute)
+	case strings.Contains(in, "fail"):
+		os.Exit(1)
+	}
+	result := flags["--convert-to"] + ":" + flags["--filter"]
+	if opts := flags["--filter-options"]; opts != "" {
+		result += ":" + opts
+	}
+	_ = os.WriteFile(out, []byte(result), 0600)
+	os.Exit(0)
+}
+
+// startFakeUno starts an UnoServer backed by the fake executables and
+// returns it with the path of its start log.
+func startFakeUno(t *testing.T, timeout time.Duration) (*converter.UnoServer, string) {
+	t.Helper()
+	log := filepath.Join(t.TempDir(), "starts.log")
+	t.Setenv("DOCPDF_FAKE_UNO", "1")
+	t.Setenv("DOCPDF_FAKE_UNO_LOG", log)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	u, err := converter.StartUnoServer(converter.UnoConfig{
+		ServerPath:     os.Args[0],
+		ConvertPath:    os.Args[0],
+		BasePort:       port,
+		Timeout:        timeout,
+		StartTimeout:   5 * time.Second,
+		HealthInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("StartUnoServer: %v", err)
+	}
+	t.Cleanup(func() { u.Close() })
+	return u, log
+}
+
+func countStarts(t *testing.T, log string) int {
+	t.Helper()
+	b, _ := os.ReadFile(log)
+	return strings.Count(string(b), "start")
+}
+
+func TestUnoServer_Convert(t *testing.T) {
+	u, _ := startFakeUno(t, 5*time.Second)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.xlsx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+
+	out, err := u.Convert(context.Background(), input, dir, converter.Options{})
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if out != filepath.Join(dir, "input.pdf") {
+		t.Errorf("unexpected output path %q", out)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "pdf:calc_pdf_Export" {
+		t.Errorf("expected calc PDF filter, got %q", got)
+	}
+	for _, d := range u.Dirs() {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("instance directory %s: %v", d, err)
+		}
+	}
+}
+
+func TestUnoServer_PDFVersion(t *testing.T) {
+	u, _ := startFakeUno(t, 5*time.Second)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.docx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+
+	out, err := u.Convert(context.Background(), input, dir, converter.Options{PDFVersion: converter.PDFA2B})
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "pdf:writer_pdf_Export:SelectPdfVersion=2" {
+		t.Errorf("expected SelectPdfVersion filter option, got %q", got)
+	}
+}
+
+func TestUnoServer_ConversionFailed(t *testing.T) {
+	u, _ := startFakeUno(t, 5*time.Second)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fail.docx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+
+	if _, err := u.Convert(context.Background(), input, dir, converter.Options{}); !errors.Is(err, converter.ErrConversionFailed) {
+		t.Fatalf("expected ErrConversionFailed, got %v", err)
+	}
+}
+
+func TestUnoServer_TimeoutRestartsInstance(t *testing.T) {
+	u, log := startFakeUno(t, 2*time.Second)
+
+	dir := t.TempDir()
+	hang := filepath.Join(dir, "hang.docx")
+	_ = os.WriteFile(hang, []byte("dummy"), 0600)
+	if _, err := u.Convert(context.Background(), hang, dir, converter.Options{}); err != converter.ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	// The wedged instance is replaced; the next conversion waits for it.
+	input := filepath.Join(dir, "input.docx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err := u.Convert(context.Background(), input, dir, converter.Options{})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("conversion never succeeded after restart: %v (starts=%d)", err, countStarts(t, log))
+		}
+	}
+	if n := countStarts(t, log); n < 2 {
+		t.Errorf("expected the instance to be restarted, got %d starts", n)
+	}
+}
+
+func TestUnoServer_UnsupportedFormat(t *testing.T) {
+	u, _ := startFakeUno(t, 5*time.Second)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.pptx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+
+	_, err := u.Convert(context.Background(), input, dir, converter.Options{Format: converter.FormatTXT})
+	if err != converter.ErrUnsupportedFormat {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestUnoServer_ClosedRejects(t *testing.T) {
+	u, _ := startFakeUno(t, 5*time.Second)
+	u.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.docx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+	if _, err := u.Convert(context.Background(), input, dir, converter.Options{}); err == nil {
+		t.Fatal("expected an error after Close")
+	}
+}
+
+func TestUnoServer_Recycle(t *testing.T) {
+	u, log := startFakeUno(t, 5*time.Second)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.docx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+	if _, err := u.Convert(context.Background(), input, dir, converter.Options{}); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if !u.Recycle() {
+		t.Fatal("expected the idle instance to be recycled")
+	}
+	if u.Recycle() {
+		t.Error("an instance that is down was recycled again")
+	}
+
+	// Conversions wait for the restarted instance.
+	if _, err := u.Convert(context.Background(), input, dir, converter.Options{}); err != nil {
+		t.Fatalf("Convert after recycling: %v", err)
+	}
+	if n := countStarts(t, log); n != 2 {
+		t.Errorf("expected 2 starts, got %d", n)
+	}
+}
+
+func TestUnoServer_Workers(t *testing.T) {
+	u, log := startFakeUno(t, 5*time.Second)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.docx")
+	_ = os.WriteFile(input, []byte("dummy"), 0600)
+	if _, err := u.Convert(converter.WithRequestID(context.Background(), "req-1"), input, dir, converter.Options{}); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	w := u.Workers()
+	if len(w) != 1 {
+		t.Fatalf("expected 1 worker, got %+v", w)
+	}
+	if w[0].State != converter.WorkerIdle || w[0].RequestID != "" || w[0].Conversions != 1 || w[0].PID == 0 || w[0].Started.IsZero() {
+		t.Errorf("unexpected idle worker %+v", w[0])
+	}
+
+	// A wedged conversion shows its request until the worker is recycled.
+	hang := filepath.Join(dir, "hang.docx")
+	_ = os.WriteFile(hang, []byte("dummy"), 0600)
+	ctx, cancel := context.WithCancel(converter.WithRequestID(context.Background(), "req-2"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = u.Convert(ctx, hang, dir, converter.Options{})
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for w := u.Workers()[0]; w.State != converter.WorkerBusy || w.RequestID != "req-2"; w = u.Workers()[0] {
+		if time.Now().After(deadline) {
+			t.Fatalf("worker never reported busy: %+v", w)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := u.RecycleWorker(0); err != nil {
+		t.Fatalf("RecycleWorker: %v", err)
+	}
+	if w := u.Workers()[0]; w.State != converter.WorkerStarting {
+		t.Errorf("expected the recycled worker starting, got %+v", w)
+	}
+	cancel()
+	<-done
+
+	if _, err := u.Convert(context.Background(), input, dir, converter.Options{}); err != nil {
+		t.Fatalf("Convert after recycling: %v", err)
+	}
+	if n := countStarts(t, log); n != 2 {
+		t.Errorf("expected 2 starts, got %d", n)
+	}
+	if err := u.RecycleWorker(1); !errors.Is(err, converter.ErrUnknownWorker) {
+		t.Errorf("expected ErrUnknownWorker, got %v", err)
+	}
+}
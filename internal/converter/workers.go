@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnknownWorker is returned by UnoServer.RecycleWorker for an ID that
+// names no worker.
+var ErrUnknownWorker = errors.New("unknown worker")
+
+// Worker states, as reported in WorkerStatus.State.
+const (
+	WorkerIdle     = "idle"
+	WorkerBusy     = "busy"
+	WorkerStarting = "starting"
+)
+
+// WorkerStatus describes one pooled LibreOffice process.
+type WorkerStatus struct {
+	// ID identifies the worker to RecycleWorker; it stays the same across
+	// restarts.
+	ID int
+	// State is WorkerIdle, WorkerBusy, or WorkerStarting while the process
+	// is being (re)started and takes no conversions.
+	State string
+	// RequestID is the request the worker is converting for, when busy.
+	RequestID string
+	// Conversions is how many conversions the current process has run.
+	Conversions int64
+	// Started is when the current process became ready; zero while
+	// starting.
+	Started time.Time
+	// PID is the process ID of unoserver; 0 while none is running.
+	PID int
+	// RSS is the resident memory in bytes of unoserver and the soffice
+	// under it; 0 where it cannot be read.
+	RSS int64
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the request a conversion is
+// run for, which UnoServer.Workers reports while it converts.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Workers returns the status of every instance, by ID.
+func (u *UnoServer) Workers() []WorkerStatus {
+	out := make([]WorkerStatus, len(u.instances))
+	for id, inst := range u.instances {
+		inst.mu.Lock()
+		st := WorkerStatus{
+			ID:          id,
+			State:       WorkerIdle,
+			RequestID:   inst.requestID,
+			Conversions: inst.conversions,
+			PID:         inst.pid,
+		}
+		switch {
+		case !inst.healthy:
+			st.State = WorkerStarting
+		case inst.busy:
+			st.State = WorkerBusy
+		}
+		if inst.healthy {
+			st.Started = inst.started
+		}
+		inst.mu.Unlock()
+		if st.PID > 0 {
+			st.RSS, _ = treeRSS(st.PID)
+		}
+		out[id] = st
+	}
+	return out
+}
+
+// RecycleWorker restarts worker id with a fresh user profile, busy or not: a
+// conversion it is running fails. Unlike Recycle it is meant for a worker
+// that is wedged, and so does not wait for it to be idle.
+func (u *UnoServer) RecycleWorker(id int) error {
+	if id < 0 || id >= len(u.instances) {
+		return ErrUnknownWorker
+	}
+	inst := u.instances[id]
+	inst.mu.Lock()
+	inst.fresh = true
+	inst.mu.Unlock()
+	inst.restart()
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package egress meters the result bytes each tenant downloads in a calendar
+// month (UTC) and caps them, since downloads rather than conversions make up
+// the bandwidth bill. The month's usage is persisted to disk so a restart or
+// deploy does not reset it.
+package egress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// monthLayout names a month in usage and the persisted file.
+const monthLayout = "2006-01"
+
+// Config configures a Meter.
+type Config struct {
+	// Path is the JSON file the month's usage is loaded from and saved to.
+	// Empty keeps usage in memory only.
+	Path string
+	// Cap is the monthly limit, in bytes, of tenants without one in
+	// Tenants; 0 is no limit.
+	Cap int64
+	// Tenants maps tenants to their own monthly limit in bytes; 0 is no
+	// limit.
+	Tenants map[string]int64
+}
+
+// Usage is one tenant's egress in the current month.
+type Usage struct {
+	Tenant string `json:"tenant"`
+	Month  string `json:"month"`
+	Bytes  int64  `json:"bytes"`
+	// Cap is the tenant's monthly limit in bytes, omitted when there is
+	// none.
+	Cap int64 `json:"cap_bytes,omitempty"`
+	// Resets is when the next month starts.
+	Resets time.Time `json:"resets_at"`
+}
+
+// state is the persisted usage of one month.
+type state struct {
+	Month   string           `json:"month"`
+	Tenants map[string]int64 `json:"tenants"`
+}
+
+// Meter counts egress per tenant for the current month.
+type Meter struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	month   string
+	tenants map[string]int64
+}
+
+// New returns a Meter, loading the current month's usage from cfg.Path when
+// it exists; usage saved in an earlier month is dropped. A file that cannot
+// be parsed is reported as an error along with a usable, empty Meter.
+func New(cfg Config) (*Meter, error) {
+	m := &Meter{cfg: cfg, now: time.Now, tenants: make(map[string]int64)}
+	m.month = m.now().UTC().Format(monthLayout)
+	return m, m.load()
+}
+
+// Cap returns tenant's monthly limit in bytes; 0 is no limit.
+func (m *Meter) Cap(tenant string) int64 {
+	if c, ok := m.cfg.Tenants[tenant]; ok {
+		return c
+	}
+	return m.cfg.Cap
+}
+
+// Allow reports whether tenant is under its cap. When it is not, it also
+// returns how long until the next month starts and the cap lifts.
+func (m *Meter) Allow(tenant string) (bool, time.Duration) {
+	c := m.Cap(tenant)
+	if c == 0 {
+		return true, 0
+	}
+	u := m.Usage(tenant)
+	if u.Bytes < c {
+		return true, 0
+	}
+	return false, u.Resets.Sub(m.now())
+}
+
+// Add counts n bytes downloaded by tenant.
+func (m *Meter) Add(tenant string, n int64) {
+	if n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollLocked()
+	m.tenants[tenant] += n
+}
+
+// Usage returns tenant's egress this month.
+func (m *Meter) Usage(tenant string) Usage {
+	m.mu.Lock()
+	m.rollLocked()
+	n := m.tenants[tenant]
+	m.mu.Unlock()
+	return m.usage(tenant, n)
+}
+
+// Snapshot returns the usage of every tenant that downloaded anything this
+// month or has a cap of its own, sorted by tenant.
+func (m *Meter) Snapshot() []Usage {
+	m.mu.Lock()
+	m.rollLocked()
+	tenants := make(map[string]int64, len(m.tenants)+len(m.cfg.Tenants))
+	for t := range m.cfg.Tenants {
+		tenants[t] = 0
+	}
+	for t, n := range m.tenants {
+		tenants[t] = n
+	}
+	m.mu.Unlock()
+
+	out := make([]Usage, 0, len(tenants))
+	for t, n := range tenants {
+		out = append(out, m.usage(t, n))
+	}
+	slices.SortFunc(out, func(a, b Usage) int { return strings.Compare(a.Tenant, b.Tenant) })
+	return out
+}
+
+func (m *Meter) usage(tenant string, n int64) Usage {
+	now := m.now().UTC()
+	return Usage{
+		Tenant: tenant,
+		Month:  now.Format(monthLayout),
+		Bytes:  n,
+		Cap:    m.Cap(tenant),
+		Resets: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// rollLocked starts a new month's usage once the month has changed.
+func (m *Meter) rollLocked() {
+	if month := m.now().UTC().Format(monthLayout); month != m.month {
+		m.month = month
+		m.tenants = make(map[string]int64)
+	}
+}
+
+// Save writes the month's usage to Config.Path. The file is replaced
+// atomically so a crash mid-save never leaves a truncated file behind.
+func (m *Meter) Save() error {
+	if m.cfg.Path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	data, err := json.Marshal(state{Month: m.month, Tenants: m.tenants})
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.cfg.Path), ".egress-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.cfg.Path)
+}
+
+// ServeHTTP serves GET /admin/egress: every tenant's usage this month.
+func (m *Meter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"tenants": m.Snapshot()})
+}
+
+func (m *Meter) load() error {
+	if m.cfg.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.cfg.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s.Month == m.month && s.Tenants != nil {
+		m.tenants = s.Tenants
+	}
+	return nil
+}
+
+// ParseCaps parses per-tenant monthly caps in gigabytes in the form
+// "acme=500;trial=1", returning them in bytes.
+func ParseCaps(s string) (map[string]int64, error) {
+	caps := make(map[string]int64)
+	for rule := range strings.SplitSeq(s, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		tenant, v, ok := strings.Cut(rule, "=")
+		tenant = strings.TrimSpace(tenant)
+		if !ok || tenant == "" {
+			return nil, fmt.Errorf("egress: malformed tenant cap %q", rule)
+		}
+		gb, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || gb < 0 {
+			return nil, fmt.Errorf("egress: invalid cap %q for tenant %q", v, tenant)
+		}
+		caps[tenant] = gb << 30
+	}
+	return caps, nil
+}
@@ -0,0 +1,102 @@
+package egress_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/egress"
+)
+
+func newMeter(t *testing.T, cfg egress.Config) *egress.Meter {
+	t.Helper()
+	m, err := egress.New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestCaps(t *testing.T) {
+	m := newMeter(t, egress.Config{Cap: 100, Tenants: map[string]int64{"acme": 0, "trial": 10}})
+
+	m.Add("trial", 9)
+	if ok, _ := m.Allow("trial"); !ok {
+		t.Error("trial refused under its cap")
+	}
+	m.Add("trial", 5)
+	ok, wait := m.Allow("trial")
+	if ok {
+		t.Error("trial allowed over its cap")
+	}
+	if u := m.Usage("trial"); wait <= 0 || u.Bytes != 14 || u.Cap != 10 || time.Until(u.Resets) > 31*24*time.Hour {
+		t.Errorf("usage %+v, retry after %v", u, wait)
+	}
+
+	m.Add("acme", 1<<40)
+	if ok, _ := m.Allow("acme"); !ok {
+		t.Error("acme, which has no cap, was refused")
+	}
+	m.Add("globex", 100)
+	if ok, _ := m.Allow("globex"); ok {
+		t.Error("globex allowed at the default cap")
+	}
+}
+
+func TestSnapshotListsCappedTenants(t *testing.T) {
+	m := newMeter(t, egress.Config{Tenants: map[string]int64{"trial": 10}})
+	m.Add("acme", 3)
+	got := m.Snapshot()
+	if len(got) != 2 || got[0].Tenant != "acme" || got[0].Bytes != 3 || got[1].Tenant != "trial" || got[1].Cap != 10 {
+		t.Errorf("snapshot %+v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/egress", nil))
+	var body struct {
+		Tenants []egress.Usage `json:"tenants"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || len(body.Tenants) != 2 {
+		t.Errorf("body %s: %v", rr.Body, err)
+	}
+}
+
+func TestPersistsTheMonth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "egress.json")
+	m := newMeter(t, egress.Config{Path: path})
+	m.Add("acme", 42)
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := newMeter(t, egress.Config{Path: path}).Usage("acme").Bytes; got != 42 {
+		t.Errorf("reloaded %d bytes, want 42", got)
+	}
+
+	os.WriteFile(path, []byte(`{"month":"2020-01","tenants":{"acme":42}}`), 0o600)
+	if got := newMeter(t, egress.Config{Path: path}).Usage("acme").Bytes; got != 0 {
+		t.Errorf("an earlier month's %d bytes were carried over", got)
+	}
+
+	os.WriteFile(path, []byte("{"), 0o600)
+	if m, err := egress.New(egress.Config{Path: path}); err == nil || m == nil {
+		t.Errorf("expected a usable meter and an error, got %v, %v", m, err)
+	}
+}
+
+func TestParseCaps(t *testing.T) {
+	caps, err := egress.ParseCaps("acme=500; trial=1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caps) != 2 || caps["acme"] != 500<<30 || caps["trial"] != 1<<30 {
+		t.Errorf("caps %v", caps)
+	}
+	for _, s := range []string{"acme", "=5", "acme=lots", "acme=-1"} {
+		if _, err := egress.ParseCaps(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package filetype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf16"
+)
+
+// Password-protected OOXML documents are not ZIP packages: Office stores the
+// encrypted package in an OLE compound file (MS-CFB), next to the parameters
+// needed to decrypt it. compoundFile reads just enough of that container to
+// get named streams out of it.
+
+var cfbMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// errCorruptCompound is returned for a compound file whose structures do not
+// add up.
+var errCorruptCompound = errors.New("filetype: corrupt compound file")
+
+// Special sector numbers.
+const (
+	cfbMaxRegSect = 0xFFFFFFFA // highest regular sector number
+	cfbEndOfChain = 0xFFFFFFFE
+)
+
+// Directory entry types.
+const (
+	cfbStream = 2
+	cfbRoot   = 5
+)
+
+type compoundFile struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int
+	miniCutoff uint64 // streams smaller than this live in the mini stream
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+}
+
+type cfbEntry struct {
+	name  string
+	typ   byte
+	start uint32
+	size  uint64
+}
+
+// openCompound reads the allocation tables and directory of the compound
+// file in r.
+func openCompound(r io.ReaderAt, size int64) (*compoundFile, error) {
+	hdr := make([]byte, 512)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !bytes.HasPrefix(hdr, cfbMagic) {
+		return nil, errCorruptCompound
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(hdr[0x1E:])
+	if (shift != 9 && shift != 12) || le.Uint16(hdr[0x20:]) != 6 {
+		return nil, errCorruptCompound
+	}
+	cf := &compoundFile{r: r, size: size, sectorSize: 1 << shift, miniCutoff: uint64(le.Uint32(hdr[0x38:]))}
+	// No count in the header can exceed the sectors the file holds.
+	sectors := uint64(size) / uint64(cf.sectorSize)
+
+	// The sectors of the FAT are listed by the DIFAT: 109 entries in the
+	// header, the rest in a chain of DIFAT sectors.
+	var difat []uint32
+	for i := range 109 {
+		difat = append(difat, le.Uint32(hdr[0x4C+4*i:]))
+	}
+	next, n := le.Uint32(hdr[0x44:]), le.Uint32(hdr[0x48:])
+	if uint64(n) > sectors {
+		return nil, errCorruptCompound
+	}
+	seen := make(map[uint32]bool)
+	for ; n > 0 && next <= cfbMaxRegSect; n-- {
+		if seen[next] {
+			return nil, errCorruptCompound
+		}
+		seen[next] = true
+		sec, err := cf.sector(next)
+		if err != nil {
+			return nil, err
+		}
+		last := len(sec) - 4
+		for i := 0; i < last; i += 4 {
+			difat = append(difat, le.Uint32(sec[i:]))
+		}
+		next = le.Uint32(sec[last:])
+	}
+	numFAT := le.Uint32(hdr[0x2C:])
+	if uint64(numFAT) > uint64(len(difat)) || uint64(numFAT) > sectors {
+		return nil, errCorruptCompound
+	}
+	for _, id := range difat[:numFAT] {
+		sec, err := cf.sector(id)
+		if err != nil {
+			return nil, err
+		}
+		cf.fat = append(cf.fat, uint32s(sec)...)
+	}
+
+	dir, err := cf.chain(cf.fat, cf.sector, le.Uint32(hdr[0x30:]), -1)
+	if err != nil {
+		return nil, err
+	}
+	for off := 0; off+128 <= len(dir); off += 128 {
+		e := dir[off : off+128]
+		n := int(le.Uint16(e[64:]))
+		if n < 2 || n > 64 || n%2 != 0 {
+			continue
+		}
+		size := le.Uint64(e[120:])
+		if cf.sectorSize == 512 {
+			// Version 3 files may leave garbage in the high half.
+			size &= 0xFFFFFFFF
+		}
+		cf.entries = append(cf.entries, cfbEntry{
+			name:  string(utf16.Decode(uint16s(e[:n-2]))),
+			typ:   e[66],
+			start: le.Uint32(e[116:]),
+			size:  size,
+		})
+	}
+	if len(cf.entries) == 0 || cf.entries[0].typ != cfbRoot {
+		return nil, errCorruptCompound
+	}
+
+	// Small streams are stored in 64-byte sectors of the mini stream, which
+	// is the root entry's own stream.
+	root := cf.entries[0]
+	if root.size > 0 {
+		if cf.miniStream, err = cf.chain(cf.fat, cf.sector, root.start, int64(root.size)); err != nil {
+			return nil, err
+		}
+		mf, err := cf.chain(cf.fat, cf.sector, le.Uint32(hdr[0x3C:]), -1)
+		if err != nil {
+			return nil, err
+		}
+		cf.miniFAT = uint32s(mf)
+	}
+	return cf, nil
+}
+
+// stream returns the contents of the stream called name.
+func (cf *compoundFile) stream(name string) ([]byte, bool, error) {
+	for _, e := range cf.entries {
+		if e.typ != cfbStream || e.name != name {
+			continue
+		}
+		if e.size > uint64(cf.size) {
+			return nil, true, errCorruptCompound
+		}
+		if e.size < cf.miniCutoff {
+			b, err := cf.chain(cf.miniFAT, cf.miniSector, e.start, int64(e.size))
+			return b, true, err
+		}
+		b, err := cf.chain(cf.fat, cf.sector, e.start, int64(e.size))
+		return b, true, err
+	}
+	return nil, false, nil
+}
+
+// has reports whether the file holds a stream called name.
+func (cf *compoundFile) has(name string) bool {
+	for _, e := range cf.entries {
+		if e.typ == cfbStream && e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chain reads the chain of sectors starting at start through table, up to
+// size bytes; a negative size reads to the end of the chain. A chain that
+// loops, or outgrows the file, is corrupt.
+func (cf *compoundFile) chain(table []uint32, read func(uint32) ([]byte, error), start uint32, size int64) ([]byte, error) {
+	var out []byte
+	seen := make(map[uint32]bool)
+	id := start
+	for range len(table) {
+		if id == cfbEndOfChain || (size >= 0 && int64(len(out)) >= size) {
+			break
+		}
+		if int(id) >= len(table) || seen[id] || int64(len(out)) >= cf.size {
+			return nil, errCorruptCompound
+		}
+		seen[id] = true
+		sec, err := read(id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sec...)
+		id = table[id]
+	}
+	if size < 0 {
+		return out, nil
+	}
+	if int64(len(out)) < size {
+		return nil, errCorruptCompound
+	}
+	return out[:size], nil
+}
+
+// sector reads regular sector id.
+func (cf *compoundFile) sector(id uint32) ([]byte, error) {
+	off := (int64(id) + 1) * int64(cf.sectorSize)
+	if id > cfbMaxRegSect || off >= cf.size {
+		return nil, errCorruptCompound
+	}
+	sec := make([]byte, cf.sectorSize)
+	// The last sector may be cut short.
+	n, err := cf.r.ReadAt(sec, off)
+	if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+		return nil, errCorruptCompound
+	}
+	return sec, nil
+}
+
+// miniSector reads 64-byte sector id of the mini stream.
+func (cf *compoundFile) miniSector(id uint32) ([]byte, error) {
+	off := int(id) * 64
+	if off+64 > len(cf.miniStream) {
+		return nil, errCorruptCompound
+	}
+	return cf.miniStream[off : off+64], nil
+}
+
+func uint32s(b []byte) []uint32 {
+	v := make([]uint32, len(b)/4)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return v
+}
+
+func uint16s(b []byte) []uint16 {
+	v := make([]uint16, len(b)/2)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return v
+}
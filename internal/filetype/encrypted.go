@@ -0,0 +1,267 @@
+package filetype
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"hash"
+	"io"
+	"unicode/utf16"
+)
+
+var (
+	// ErrWrongPassword is returned by Decrypt when the password does not
+	// open the document.
+	ErrWrongPassword = errors.New("filetype: wrong document password")
+	// ErrUnsupportedEncryption is returned by Decrypt for documents
+	// encrypted other than with the agile encryption of Office 2010 and
+	// later, AES in CBC mode.
+	ErrUnsupportedEncryption = errors.New("filetype: unsupported document encryption")
+)
+
+// Encrypted reports whether the document is a password-protected OOXML
+// package (.docx, .xlsx, .pptx): a compound file holding an EncryptionInfo
+// and an EncryptedPackage stream.
+func Encrypted(r io.ReaderAt, size int64) bool {
+	if !bytes.HasPrefix(head(r, size, len(cfbMagic)), cfbMagic) {
+		return false
+	}
+	cf, err := openCompound(r, size)
+	return err == nil && cf.has("EncryptionInfo") && cf.has("EncryptedPackage")
+}
+
+// Decrypt opens the password-protected OOXML document in r with password
+// and returns the package inside: an ordinary ZIP for Detect to identify.
+func Decrypt(r io.ReaderAt, size int64, password string) ([]byte, error) {
+	cf, err := openCompound(r, size)
+	if err != nil {
+		return nil, err
+	}
+	info, ok, err := cf.stream("EncryptionInfo")
+	if err != nil || !ok {
+		return nil, errCorruptCompound
+	}
+	pkg, ok, err := cf.stream("EncryptedPackage")
+	if err != nil || !ok {
+		return nil, errCorruptCompound
+	}
+	// Agile encryption is version 4.4, followed by reserved flags and an
+	// XML descriptor.
+	if len(info) < 8 || binary.LittleEndian.Uint16(info) != 4 || binary.LittleEndian.Uint16(info[2:]) != 4 {
+		return nil, ErrUnsupportedEncryption
+	}
+	var desc agileDescriptor
+	if err := xml.Unmarshal(info[8:], &desc); err != nil {
+		return nil, errCorruptCompound
+	}
+	key, err := desc.secretKey(password)
+	if err != nil {
+		return nil, err
+	}
+	return desc.decryptPackage(key, pkg)
+}
+
+// agileDescriptor is the XML in the EncryptionInfo stream of an agile
+// encrypted document (MS-OFFCRYPTO 2.3.4.10). The package is encrypted with
+// a random secret key, which is stored encrypted with a key derived from
+// the password.
+type agileDescriptor struct {
+	KeyData       agileParams `xml:"keyData"`
+	KeyEncryptors []struct {
+		URI          string        `xml:"uri,attr"`
+		EncryptedKey agilePassword `xml:"encryptedKey"`
+	} `xml:"keyEncryptors>keyEncryptor"`
+}
+
+type agileParams struct {
+	SaltSize        int    `xml:"saltSize,attr"`
+	BlockSize       int    `xml:"blockSize,attr"`
+	KeyBits         int    `xml:"keyBits,attr"`
+	HashSize        int    `xml:"hashSize,attr"`
+	CipherAlgorithm string `xml:"cipherAlgorithm,attr"`
+	CipherChaining  string `xml:"cipherChaining,attr"`
+	HashAlgorithm   string `xml:"hashAlgorithm,attr"`
+	SaltValue       string `xml:"saltValue,attr"`
+}
+
+type agilePassword struct {
+	agileParams
+	SpinCount                  int    `xml:"spinCount,attr"`
+	EncryptedVerifierHashInput string `xml:"encryptedVerifierHashInput,attr"`
+	EncryptedVerifierHashValue string `xml:"encryptedVerifierHashValue,attr"`
+	EncryptedKeyValue          string `xml:"encryptedKeyValue,attr"`
+}
+
+// passwordKeyEncryptor is the URI of the key encryptor holding the
+// password-derived parameters; others use certificates.
+const passwordKeyEncryptor = "http://schemas.microsoft.com/office/2006/keyEncryptor/password"
+
+// Block keys used to derive a key for each value protected by the password.
+var (
+	blockVerifierInput = []byte{0xfe, 0xa7, 0xd2, 0x76, 0x3b, 0x4b, 0x9e, 0x79}
+	blockVerifierValue = []byte{0xd7, 0xaa, 0x0f, 0x6d, 0x30, 0x61, 0x34, 0x4e}
+	blockKeyValue      = []byte{0x14, 0x6e, 0x0b, 0xe7, 0xab, 0xac, 0xd0, 0xd6}
+)
+
+// maxSpinCount bounds the password hashing iterations; MS-OFFCRYPTO allows
+// no more, and a forged file should not be able to ask for more.
+const maxSpinCount = 10_000_000
+
+// packageSegment is the size of the independently encrypted segments of
+// the package.
+const packageSegment = 4096
+
+// secretKey derives the key the password protects, checking the password
+// against the stored verifier.
+func (d agileDescriptor) secretKey(password string) ([]byte, error) {
+	var p *agilePassword
+	for i, ke := range d.KeyEncryptors {
+		if ke.URI == passwordKeyEncryptor {
+			p = &d.KeyEncryptors[i].EncryptedKey
+		}
+	}
+	if p == nil || !p.supported() || !d.KeyData.supported() || p.SpinCount < 0 || p.SpinCount > maxSpinCount {
+		return nil, ErrUnsupportedEncryption
+	}
+	salt, err1 := base64.StdEncoding.DecodeString(p.SaltValue)
+	input, err2 := base64.StdEncoding.DecodeString(p.EncryptedVerifierHashInput)
+	value, err3 := base64.StdEncoding.DecodeString(p.EncryptedVerifierHashValue)
+	encKey, err4 := base64.StdEncoding.DecodeString(p.EncryptedKeyValue)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return nil, errCorruptCompound
+	}
+
+	newHash := hashes[p.HashAlgorithm]
+	h := newHash()
+	h.Write(salt)
+	h.Write(utf16le(password))
+	pwHash := h.Sum(nil)
+	var iter [4]byte
+	for i := range p.SpinCount {
+		h.Reset()
+		binary.LittleEndian.PutUint32(iter[:], uint32(i))
+		h.Write(iter[:])
+		h.Write(pwHash)
+		pwHash = h.Sum(pwHash[:0])
+	}
+	iv := fit(salt, p.BlockSize)
+	unlock := func(block, data []byte) ([]byte, error) {
+		h.Reset()
+		h.Write(pwHash)
+		h.Write(block)
+		return decryptCBC(fit(h.Sum(nil), p.KeyBits/8), iv, data)
+	}
+
+	verifier, err := unlock(blockVerifierInput, input)
+	if err != nil || len(verifier) < p.SaltSize {
+		return nil, errCorruptCompound
+	}
+	want, err := unlock(blockVerifierValue, value)
+	if err != nil || len(want) < p.HashSize {
+		return nil, errCorruptCompound
+	}
+	h.Reset()
+	h.Write(verifier[:p.SaltSize])
+	if got := h.Sum(nil); len(got) != p.HashSize || subtle.ConstantTimeCompare(got, want[:p.HashSize]) != 1 {
+		return nil, ErrWrongPassword
+	}
+	key, err := unlock(blockKeyValue, encKey)
+	if err != nil || len(key) < d.KeyData.KeyBits/8 {
+		return nil, errCorruptCompound
+	}
+	return key[:d.KeyData.KeyBits/8], nil
+}
+
+// decryptPackage decrypts the EncryptedPackage stream with the secret key.
+// It starts with the package's size; each segment after that has its own
+// IV, derived from the key data salt and the segment's index.
+func (d agileDescriptor) decryptPackage(key, pkg []byte) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(d.KeyData.SaltValue)
+	if err != nil || len(pkg) < 8 {
+		return nil, errCorruptCompound
+	}
+	size := binary.LittleEndian.Uint64(pkg)
+	pkg = pkg[8:]
+	if size > uint64(len(pkg)) {
+		return nil, errCorruptCompound
+	}
+	h := hashes[d.KeyData.HashAlgorithm]()
+	out := make([]byte, 0, len(pkg))
+	var index [4]byte
+	for i := 0; len(pkg) > 0; i++ {
+		seg := pkg[:min(len(pkg), packageSegment)]
+		pkg = pkg[len(seg):]
+		h.Reset()
+		h.Write(salt)
+		binary.LittleEndian.PutUint32(index[:], uint32(i))
+		h.Write(index[:])
+		plain, err := decryptCBC(key, fit(h.Sum(nil), d.KeyData.BlockSize), seg)
+		if err != nil {
+			return nil, errCorruptCompound
+		}
+		out = append(out, plain...)
+	}
+	return out[:size], nil
+}
+
+// supported reports whether the parameters name a cipher and hash Decrypt
+// implements.
+func (p agileParams) supported() bool {
+	_, ok := hashes[p.HashAlgorithm]
+	return ok && p.SaltSize > 0 && p.HashSize > 0 && p.CipherAlgorithm == "AES" && p.CipherChaining == "ChainingModeCBC" &&
+		p.BlockSize == aes.BlockSize && (p.KeyBits == 128 || p.KeyBits == 192 || p.KeyBits == 256)
+}
+
+// hashes are the hash algorithms agile encryption may name.
+var hashes = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA384": sha512.New384,
+	"SHA512": sha512.New,
+}
+
+// decryptCBC decrypts data, a whole number of AES blocks, with key and iv.
+func decryptCBC(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errCorruptCompound
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
+
+// fit truncates b to n bytes, or pads it with 0x36 up to n bytes, as agile
+// encryption does with hashes used as keys and IVs.
+func fit(b []byte, n int) []byte {
+	if len(b) >= n {
+		return b[:n]
+	}
+	out := make([]byte, n)
+	copy(out, b)
+	for i := len(b); i < n; i++ {
+		out[i] = 0x36
+	}
+	return out
+}
+
+// utf16le encodes s as UTF-16LE, the form passwords are hashed in.
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package filetype_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// testdata/protected.docx is a Word document encrypted by the agile scheme
+// with AES-256 and SHA-512, password "open-sesame". Its descriptor is small
+// enough for the mini stream; its package, over 4 KiB, is not.
+func readProtected(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/protected.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestEncrypted(t *testing.T) {
+	data := readProtected(t)
+	if !filetype.Encrypted(bytes.NewReader(data), int64(len(data))) {
+		t.Error("protected.docx not reported as encrypted")
+	}
+	if _, ok := filetype.Default.Detect(bytes.NewReader(data), int64(len(data))); ok {
+		t.Error("an encrypted document should not be detected as a known type")
+	}
+	plain := docmPackage(t)
+	if filetype.Encrypted(bytes.NewReader(plain), int64(len(plain))) {
+		t.Error("plain package reported as encrypted")
+	}
+	// A compound file that is not an encrypted package, such as a .doc.
+	header := append([]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), make([]byte, 1024)...)
+	if filetype.Encrypted(bytes.NewReader(header), int64(len(header))) {
+		t.Error("bare compound file header reported as encrypted")
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	data := readProtected(t)
+	plain, err := filetype.Decrypt(bytes.NewReader(data), int64(len(data)), "open-sesame")
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if ft, ok := filetype.Default.Detect(bytes.NewReader(plain), int64(len(plain))); !ok || ft != filetype.DOCX {
+		t.Errorf("decrypted package detected as %v, %v; want docx", ft, ok)
+	}
+	if !bytes.Contains(plain, []byte("Confidential.")) {
+		t.Error("decrypted package is missing the document text")
+	}
+
+	for _, pw := range []string{"", "Open-sesame", "open-sesame "} {
+		if _, err := filetype.Decrypt(bytes.NewReader(data), int64(len(data)), pw); !errors.Is(err, filetype.ErrWrongPassword) {
+			t.Errorf("Decrypt with %q: expected ErrWrongPassword, got %v", pw, err)
+		}
+	}
+}
+
+func TestDecrypt_Corrupt(t *testing.T) {
+	data := readProtected(t)
+	// Cut into the encrypted package.
+	cut := data[:len(data)-2048]
+	if _, err := filetype.Decrypt(bytes.NewReader(cut), int64(len(cut)), "open-sesame"); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+	plain := docmPackage(t)
+	if _, err := filetype.Decrypt(bytes.NewReader(plain), int64(len(plain)), "open-sesame"); err == nil {
+		t.Error("expected an error for a plain package")
+	}
+}
+
+// loopingCompound returns an 8 KiB compound file with 4 KiB sectors whose
+// single sector is both the FAT, listed numFAT times, and, when difatLoop
+// is set, a DIFAT sector claiming 3000 successors; either way it points at
+// itself.
+func loopingCompound(numFAT uint32, difatLoop bool) []byte {
+	data := make([]byte, 8192)
+	copy(data, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	le := binary.LittleEndian
+	le.PutUint16(data[0x1E:], 12)
+	le.PutUint16(data[0x20:], 6)
+	le.PutUint32(data[0x2C:], numFAT)
+	le.PutUint32(data[0x44:], 0xFFFFFFFE)
+	for i := range 109 {
+		le.PutUint32(data[0x4C+4*i:], 0)
+	}
+	if difatLoop {
+		le.PutUint32(data[0x44:], 0)
+		le.PutUint32(data[0x48:], 3000)
+	}
+	// Sector 0, at 4096: every FAT and DIFAT entry is 0, itself.
+	return data
+}
+
+func TestEncrypted_LoopingChains(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"self-referencing FAT":   loopingCompound(109, false),
+		"self-referencing DIFAT": loopingCompound(1, true),
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if filetype.Encrypted(bytes.NewReader(data), int64(len(data))) {
+			t.Errorf("%s: reported as encrypted", name)
+		}
+		if _, err := filetype.Decrypt(bytes.NewReader(data), int64(len(data)), "x"); err == nil {
+			t.Errorf("%s: decrypted", name)
+		}
+		runtime.ReadMemStats(&after)
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+			t.Errorf("%s: allocated %d MB parsing an 8 KiB file", name, alloc>>20)
+		}
+	}
+}
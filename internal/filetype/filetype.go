@@ -0,0 +1,253 @@
+// Package filetype identifies uploaded documents by content rather than by
+// filename, so the converter can hand LibreOffice a file with the extension
+// its import filter selection expects.
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Type describes a recognised input document format.
+type Type struct {
+	// Name is the short, stable identifier used in logs and metrics (e.g. "docx").
+	Name string
+	// Class is the document family: ClassText, ClassSpreadsheet or
+	// ClassPresentation. LibreOffice needs a different PDF export filter for each.
+	Class string
+	// Ext is the file extension, including the leading dot, that LibreOffice
+	// uses to select its import filter.
+	Ext string
+	// MIME is the media type of the format.
+	MIME string
+}
+
+// Document classes.
+const (
+	ClassText         = "text"
+	ClassSpreadsheet  = "spreadsheet"
+	ClassPresentation = "presentation"
+)
+
+// Known input types.
+var (
+	DOCX = Type{Name: "docx", Class: ClassText, Ext: ".docx", MIME: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"}
+	ODT  = Type{Name: "odt", Class: ClassText, Ext: ".odt", MIME: "application/vnd.oasis.opendocument.text"}
+	RTF  = Type{Name: "rtf", Class: ClassText, Ext: ".rtf", MIME: "application/rtf"}
+	TXT  = Type{Name: "txt", Class: ClassText, Ext: ".txt", MIME: "text/plain"}
+	MD   = Type{Name: "md", Class: ClassText, Ext: ".md", MIME: "text/markdown"}
+	HTML = Type{Name: "html", Class: ClassText, Ext: ".html", MIME: "text/html"}
+	XLSX = Type{Name: "xlsx", Class: ClassSpreadsheet, Ext: ".xlsx", MIME: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+	ODS  = Type{Name: "ods", Class: ClassSpreadsheet, Ext: ".ods", MIME: "application/vnd.oasis.opendocument.spreadsheet"}
+	PPTX = Type{Name: "pptx", Class: ClassPresentation, Ext: ".pptx", MIME: "application/vnd.openxmlformats-officedocument.presentationml.presentation"}
+	ODP  = Type{Name: "odp", Class: ClassPresentation, Ext: ".odp", MIME: "application/vnd.oasis.opendocument.presentation"}
+)
+
+// All lists every known input type.
+var All = []Type{DOCX, ODT, RTF, TXT, MD, HTML, XLSX, ODS, PPTX, ODP}
+
+// ByMIME returns the known type whose media type matches contentType,
+// ignoring parameters such as charset.
+func ByMIME(contentType string) (Type, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Type{}, false
+	}
+	for _, t := range All {
+		if t.MIME == mt {
+			return t, true
+		}
+	}
+	// RTF is also commonly sent as text/rtf, Markdown as text/x-markdown.
+	switch mt {
+	case "text/rtf":
+		return RTF, true
+	case "text/x-markdown":
+		return MD, true
+	}
+	return Type{}, false
+}
+
+// Named refines t, detected from a document's content, by the name it was
+// uploaded under: plain text named *.md or *.markdown is Markdown, which
+// its content does not tell apart.
+func Named(t Type, name string) Type {
+	if t != TXT {
+		return t
+	}
+	switch strings.ToLower(path.Ext(strings.ReplaceAll(name, `\`, "/"))) {
+	case ".md", ".markdown":
+		return MD
+	}
+	return t
+}
+
+// Detector identifies the type of a document. r holds the full document of
+// length size.
+type Detector interface {
+	Detect(r io.ReaderAt, size int64) (Type, bool)
+}
+
+// DetectorFunc adapts a function to the Detector interface.
+type DetectorFunc func(r io.ReaderAt, size int64) (Type, bool)
+
+// Detect implements Detector.
+func (f DetectorFunc) Detect(r io.ReaderAt, size int64) (Type, bool) { return f(r, size) }
+
+// Chain tries each detector in order and returns the first match.
+type Chain []Detector
+
+// Detect implements Detector.
+func (c Chain) Detect(r io.ReaderAt, size int64) (Type, bool) {
+	for _, d := range c {
+		if t, ok := d.Detect(r, size); ok {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// Default recognises every built-in type. Order matters: binary signatures are
+// checked before the plain-text fallback.
+var Default Detector = Chain{
+	DetectorFunc(detectZip),
+	DetectorFunc(detectRTF),
+	DetectorFunc(detectHTML),
+	DetectorFunc(detectText),
+}
+
+// sniffLen is how many leading bytes the signature checks inspect.
+const sniffLen = 8 << 10
+
+var (
+	zipMagic = []byte{0x50, 0x4B, 0x03, 0x04}
+	rtfMagic = []byte(`{\rtf`)
+	utf8BOM  = []byte{0xEF, 0xBB, 0xBF}
+	// htmlStarts are how an HTML document starts, compared without case
+	// once leading whitespace and a byte order mark are skipped.
+	htmlStarts = [][]byte{[]byte("<!doctype html"), []byte("<html")}
+)
+
+// odfTypes maps the ODF "mimetype" entry to the corresponding Type.
+var odfTypes = map[string]Type{
+	ODT.MIME: ODT,
+	ODS.MIME: ODS,
+	ODP.MIME: ODP,
+}
+
+// ooxmlParts maps the top-level part directory of an OOXML package to its type.
+var ooxmlParts = map[string]Type{
+	"word/": DOCX,
+	"xl/":   XLSX,
+	"ppt/":  PPTX,
+}
+
+// detectZip recognises ZIP-based formats. ODF packages are identified by their
+// "mimetype" entry and OOXML packages by their main part directory; any other
+// ZIP is treated as OOXML (.docx).
+func detectZip(r io.ReaderAt, size int64) (Type, bool) {
+	if !bytes.HasPrefix(head(r, size, len(zipMagic)), zipMagic) {
+		return Type{}, false
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return DOCX, true
+	}
+	for _, f := range zr.File {
+		if f.Name == "mimetype" {
+			if t, ok := odfTypes[readSmall(f)]; ok {
+				return t, true
+			}
+			continue
+		}
+		for prefix, t := range ooxmlParts {
+			if strings.HasPrefix(f.Name, prefix) {
+				return t, true
+			}
+		}
+	}
+	return DOCX, true
+}
+
+func detectRTF(r io.ReaderAt, size int64) (Type, bool) {
+	if bytes.HasPrefix(head(r, size, len(rtfMagic)), rtfMagic) {
+		return RTF, true
+	}
+	return Type{}, false
+}
+
+// detectHTML recognises text starting with an HTML doctype or <html> tag.
+// Fragments without either are left to detectText.
+func detectHTML(r io.ReaderAt, size int64) (Type, bool) {
+	b := bytes.TrimLeft(bytes.TrimPrefix(head(r, size, 512), utf8BOM), " \t\r\n\f")
+	for _, start := range htmlStarts {
+		if len(b) > len(start) && bytes.EqualFold(b[:len(start)], start) {
+			if _, ok := detectText(r, size); ok {
+				return HTML, true
+			}
+		}
+	}
+	return Type{}, false
+}
+
+// detectText accepts non-empty, valid UTF-8 without control characters other
+// than common whitespace.
+func detectText(r io.ReaderAt, size int64) (Type, bool) {
+	b := head(r, size, sniffLen)
+	if len(b) == 0 {
+		return Type{}, false
+	}
+	// Don't reject a multi-byte rune split by the sniff window.
+	if int64(len(b)) < size {
+		for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+			b = b[:len(b)-1]
+		}
+	}
+	if !utf8.Valid(b) {
+		return Type{}, false
+	}
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' {
+			return Type{}, false
+		}
+	}
+	return TXT, true
+}
+
+// Truncated reports whether r starts like a ZIP package but its central
+// directory, which sits at the end of the file, is missing or unreadable.
+// That is what an upload cut short looks like; Detect still classifies such
+// a file by its signature.
+func Truncated(r io.ReaderAt, size int64) bool {
+	if !bytes.HasPrefix(head(r, size, len(zipMagic)), zipMagic) {
+		return false
+	}
+	_, err := zip.NewReader(r, size)
+	return err != nil
+}
+
+// head returns up to n leading bytes of r.
+func head(r io.ReaderAt, size int64, n int) []byte {
+	if int64(n) > size {
+		n = int(size)
+	}
+	buf := make([]byte, n)
+	m, _ := r.ReadAt(buf, 0)
+	return buf[:m]
+}
+
+// readSmall returns the trimmed contents of a small ZIP entry, or "" on error.
+func readSmall(f *zip.File) string {
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(io.LimitReader(rc, 256))
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,143 @@
+package filetype_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// odfPackage builds a minimal ODF ZIP whose first, stored entry is "mimetype".
+func odfPackage(t *testing.T, mime string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("create mimetype: %v", err)
+	}
+	_, _ = w.Write([]byte(mime))
+	w, _ = zw.Create("content.xml")
+	_, _ = w.Write([]byte("<office:document-content/>"))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// ooxmlPackage builds a minimal OOXML ZIP containing the given part.
+func ooxmlPackage(t *testing.T, part string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", part} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		_, _ = w.Write([]byte("<xml/>"))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func detect(data []byte) (filetype.Type, bool) {
+	return filetype.Default.Detect(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want filetype.Type
+	}{
+		{"docx magic only", []byte{0x50, 0x4B, 0x03, 0x04, 0, 0, 0, 0}, filetype.DOCX},
+		{"odt package", odfPackage(t, "application/vnd.oasis.opendocument.text"), filetype.ODT},
+		{"docx package", ooxmlPackage(t, "word/document.xml"), filetype.DOCX},
+		{"xlsx package", ooxmlPackage(t, "xl/workbook.xml"), filetype.XLSX},
+		{"pptx package", ooxmlPackage(t, "ppt/presentation.xml"), filetype.PPTX},
+		{"ods package", odfPackage(t, "application/vnd.oasis.opendocument.spreadsheet"), filetype.ODS},
+		{"odp package", odfPackage(t, "application/vnd.oasis.opendocument.presentation"), filetype.ODP},
+		{"rtf", []byte(`{\rtf1\ansi Hello}`), filetype.RTF},
+		{"plain text", []byte("Hello, plain text\nsecond line\n"), filetype.TXT},
+		{"utf-8 text", []byte("Grüße — 你好"), filetype.TXT},
+		{"html", []byte("\xEF\xBB\xBF\n  <!DOCTYPE html>\n<html><body>Hi</body></html>"), filetype.HTML},
+		{"html without doctype", []byte("<HTML><p>Hi</p></HTML>"), filetype.HTML},
+		{"html fragment", []byte("<p>Hi</p>"), filetype.TXT},
+		{"markdown", []byte("# Title\n\n* item\n"), filetype.TXT},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := detect(tc.data)
+			if !ok {
+				t.Fatal("expected a match")
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want.Name, got.Name)
+			}
+		})
+	}
+}
+
+func TestNamed(t *testing.T) {
+	cases := []struct {
+		t    filetype.Type
+		name string
+		want filetype.Type
+	}{
+		{filetype.TXT, "README.md", filetype.MD},
+		{filetype.TXT, `C:\notes\todo.Markdown`, filetype.MD},
+		{filetype.TXT, "notes.txt", filetype.TXT},
+		{filetype.TXT, "", filetype.TXT},
+		{filetype.HTML, "page.md", filetype.HTML},
+		{filetype.DOCX, "report.md", filetype.DOCX},
+	}
+	for _, tc := range cases {
+		if got := filetype.Named(tc.t, tc.name); got != tc.want {
+			t.Errorf("Named(%s, %q) = %s, want %s", tc.t.Name, tc.name, got.Name, tc.want.Name)
+		}
+	}
+}
+
+func TestDetect_Rejects(t *testing.T) {
+	cases := map[string][]byte{
+		"empty":  {},
+		"png":    {0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0},
+		"binary": {0x00, 0x01, 0x02, 0xff, 0xfe},
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got, ok := detect(data); ok {
+				t.Errorf("expected no match, got %q", got.Name)
+			}
+		})
+	}
+}
+
+func TestDetect_UnknownODFFallsBackToDOCX(t *testing.T) {
+	// A ZIP with an unrecognised mimetype is still handed to LibreOffice as OOXML.
+	got, ok := detect(odfPackage(t, "application/x-unknown"))
+	if !ok || got != filetype.DOCX {
+		t.Errorf("expected docx fallback, got %q (ok=%v)", got.Name, ok)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	docx := ooxmlPackage(t, "word/document.xml")
+	cases := map[string]struct {
+		data []byte
+		want bool
+	}{
+		"complete package": {docx, false},
+		"cut short":        {docx[:len(docx)/2], true},
+		"magic only":       {[]byte{0x50, 0x4B, 0x03, 0x04}, true},
+		"not a zip":        {[]byte(`{\rtf1 hello}`), false},
+		"empty":            {nil, false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := filetype.Truncated(bytes.NewReader(tc.data), int64(len(tc.data))); got != tc.want {
+				t.Errorf("Truncated = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Patterns finding the fonts of a DOCX: rFonts finds a run's or style's
+// font selection, fontAttr the font it names for each script, and fontTheme
+// a script set in one of the theme's fonts instead.
+var (
+	rFonts    = regexp.MustCompile(`<w:rFonts\b[^>]*>`)
+	fontAttr  = regexp.MustCompile(`\bw:(?:ascii|hAnsi|eastAsia|cs)="([^"]*)"`)
+	fontTheme = regexp.MustCompile(`\bw:(?:ascii|hAnsi|eastAsia|cs)Theme="`)
+	// themeLatin finds the Latin typefaces of a theme's major (headings)
+	// and minor (body) fonts, the only ones a theme names for every
+	// document.
+	themeLatin = regexp.MustCompile(`<a:(?:majorFont|minorFont)>\s*<a:latin\b[^>]*\btypeface="([^"]*)"`)
+)
+
+// isFontPart reports whether the WordprocessingML part name can select
+// fonts for the document's text.
+func isFontPart(name string) bool {
+	dir, base := path.Split(name)
+	if dir != "word/" {
+		return false
+	}
+	switch base {
+	case "document.xml", "styles.xml", "numbering.xml", "footnotes.xml", "endnotes.xml", "comments.xml":
+		return true
+	}
+	return path.Ext(base) == ".xml" && (strings.HasPrefix(base, "header") || strings.HasPrefix(base, "footer"))
+}
+
+// Fonts returns the font families a DOCX uses, sorted and without
+// duplicates: those its runs, styles and lists name, and its theme's heading
+// and body fonts when any text uses them. Other documents, and fonts named
+// only in the font table, which lists fonts whether or not any text is set
+// in them, yield none.
+func Fonts(r io.ReaderAt, size int64) []string {
+	if !bytes.HasPrefix(head(r, size, len(zipMagic)), zipMagic) {
+		return nil
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var theme *zip.File
+	usesTheme := false
+	for _, f := range zr.File {
+		if f.Name == "word/theme/theme1.xml" {
+			theme = f
+		}
+		if !isFontPart(f.Name) {
+			continue
+		}
+		b := readPart(f)
+		for _, tag := range rFonts.FindAll(b, -1) {
+			for _, m := range fontAttr.FindAllSubmatch(tag, -1) {
+				seen[html.UnescapeString(string(m[1]))] = true
+			}
+			usesTheme = usesTheme || fontTheme.Match(tag)
+		}
+	}
+	if usesTheme && theme != nil {
+		for _, m := range themeLatin.FindAllSubmatch(readPart(theme), -1) {
+			seen[html.UnescapeString(string(m[1]))] = true
+		}
+	}
+	delete(seen, "")
+
+	fonts := make([]string, 0, len(seen))
+	for f := range seen {
+		fonts = append(fonts, f)
+	}
+	slices.Sort(fonts)
+	return fonts
+}
+
+// readPart returns up to 4 MiB of a package part, or nil if it cannot be
+// read.
+func readPart(f *zip.File) []byte {
+	rc, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(io.LimitReader(rc, 4<<20))
+	return b
+}
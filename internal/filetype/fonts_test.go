@@ -0,0 +1,42 @@
+package filetype_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+func fonts(data []byte) []string {
+	return filetype.Fonts(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestFonts(t *testing.T) {
+	const theme = `<a:theme><a:themeElements><a:fontScheme name="Office">` +
+		`<a:majorFont><a:latin typeface="Calibri Light"/><a:ea typeface=""/></a:majorFont>` +
+		`<a:minorFont><a:latin typeface="Calibri"/></a:minorFont></a:fontScheme></a:themeElements></a:theme>`
+	cases := map[string]struct {
+		data []byte
+		want []string
+	}{
+		"runs, styles and headers": {packageOf(t,
+			[2]string{"word/document.xml", `<w:body><w:r><w:rPr><w:rFonts w:ascii="Georgia" w:hAnsi="Georgia" w:cs="Arial"/></w:rPr></w:r></w:body>`},
+			[2]string{"word/styles.xml", `<w:rPrDefault><w:rPr><w:rFonts w:ascii="Times New Roman" w:eastAsia="ＭＳ 明朝"/></w:rPr></w:rPrDefault>`},
+			[2]string{"word/header1.xml", `<w:rFonts w:ascii="Bodoni &amp; Co"></w:rFonts>`},
+			[2]string{"word/fontTable.xml", `<w:font w:name="Symbol"/><w:rFonts w:ascii="Unused"/>`},
+			[2]string{"word/theme/theme1.xml", theme}),
+			[]string{"Arial", "Bodoni & Co", "Georgia", "Times New Roman", "ＭＳ 明朝"}},
+		"theme fonts": {packageOf(t,
+			[2]string{"word/styles.xml", `<w:rFonts w:asciiTheme="minorHAnsi" w:hAnsiTheme="minorHAnsi"/>`},
+			[2]string{"word/theme/theme1.xml", theme}),
+			[]string{"Calibri", "Calibri Light"}},
+		"spreadsheet":   {packageOf(t, [2]string{"xl/workbook.xml", "<workbook/>"}), nil},
+		"not a package": {[]byte("%PDF-1.7"), nil},
+	}
+	for name, tc := range cases {
+		if got := fonts(tc.data); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", name, got, tc.want)
+		}
+	}
+}
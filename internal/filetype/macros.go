@@ -0,0 +1,159 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// MacroPolicy decides what happens to an upload that carries macros.
+type MacroPolicy string
+
+// Macro policies.
+const (
+	// MacroReject refuses macro-bearing documents.
+	MacroReject MacroPolicy = "reject"
+	// MacroStrip removes the macro project and converts what remains.
+	MacroStrip MacroPolicy = "strip"
+	// MacroAllow converts macro-bearing documents unchanged. LibreOffice does
+	// not run macros in headless conversion, but the document still reaches it.
+	MacroAllow MacroPolicy = "allow"
+)
+
+// ParseMacroPolicy parses "reject", "strip" or "allow". Empty means MacroReject.
+func ParseMacroPolicy(s string) (MacroPolicy, error) {
+	switch p := MacroPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return MacroReject, nil
+	case MacroReject, MacroStrip, MacroAllow:
+		return p, nil
+	default:
+		return "", fmt.Errorf("filetype: unknown macro policy %q", s)
+	}
+}
+
+// ErrNotPackage is returned by StripMacros and StripExternalTemplate for
+// input that is not a ZIP package.
+var ErrNotPackage = errors.New("filetype: not a ZIP package")
+
+// HasMacros reports whether the document carries a macro project: an OOXML
+// vbaProject.bin (.docm, .xlsm, .pptm) or ODF Basic/Scripts storage.
+func HasMacros(r io.ReaderAt, size int64) bool {
+	if !bytes.HasPrefix(head(r, size, len(zipMagic)), zipMagic) {
+		return false
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if isMacroPart(f.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMacroPart reports whether a package entry belongs to a macro project.
+func isMacroPart(name string) bool {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "vbaproject.bin"),
+		strings.HasSuffix(lower, "vbaproject.bin.rels"),
+		strings.HasSuffix(lower, "vbadata.xml"),
+		strings.HasPrefix(name, "Basic/"),
+		strings.HasPrefix(name, "Scripts/"):
+		return true
+	}
+	return false
+}
+
+// macroContentTypes maps macro-enabled OOXML main part types to their plain
+// equivalents, so a stripped .docm reads as an ordinary .docx.
+var macroContentTypes = strings.NewReplacer(
+	"application/vnd.ms-word.document.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+	"application/vnd.ms-excel.sheet.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml",
+	"application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml",
+)
+
+// References to macro parts in [Content_Types].xml, relationship parts and the
+// ODF manifest.
+var (
+	macroOverride     = regexp.MustCompile(`<Override[^>]*PartName="[^"]*(?i:vbaProject\.bin|vbaData\.xml)"[^>]*/>`)
+	macroRelationship = regexp.MustCompile(`<Relationship[^>]*Target="[^"]*(?i:vbaProject\.bin|vbaData\.xml)"[^>]*/>`)
+	macroManifest     = regexp.MustCompile(`<manifest:file-entry[^>]*manifest:full-path="(?:Basic|Scripts)/[^"]*"[^>]*/>`)
+	binDefault        = regexp.MustCompile(`<Default[^>]*Extension="bin"[^>]*ContentType="application/vnd\.ms-office\.vbaProject"[^>]*/>`)
+)
+
+// StripMacros returns a copy of the package with its macro project and every
+// reference to it removed. Other entries are copied byte for byte, keeping an
+// ODF "mimetype" entry first and uncompressed.
+func StripMacros(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrNotPackage
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		if isMacroPart(f.Name) {
+			continue
+		}
+		var rewrite func([]byte) []byte
+		switch {
+		case f.Name == "[Content_Types].xml":
+			rewrite = func(b []byte) []byte {
+				b = macroOverride.ReplaceAll(b, nil)
+				b = binDefault.ReplaceAll(b, nil)
+				return []byte(macroContentTypes.Replace(string(b)))
+			}
+		case strings.HasSuffix(f.Name, ".rels"):
+			rewrite = func(b []byte) []byte { return macroRelationship.ReplaceAll(b, nil) }
+		case f.Name == "META-INF/manifest.xml":
+			rewrite = func(b []byte) []byte { return macroManifest.ReplaceAll(b, nil) }
+		}
+		if rewrite == nil {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := rewriteEntry(zw, f, rewrite); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rewriteEntry writes f to zw with its contents passed through rewrite.
+func rewriteEntry(zw *zip.Writer, f *zip.File, rewrite func([]byte) []byte) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     f.Name,
+		Method:   f.Method,
+		Modified: f.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(rewrite(b))
+	return err
+}
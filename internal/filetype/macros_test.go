@@ -0,0 +1,139 @@
+package filetype_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// docmPackage builds a minimal macro-enabled Word package.
+func docmPackage(t *testing.T) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"[Content_Types].xml": `<Types><Default Extension="bin" ContentType="application/vnd.ms-office.vbaProject"/>` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.ms-word.document.macroEnabled.main+xml"/></Types>`,
+		"word/document.xml":            "<w:document/>",
+		"word/_rels/document.xml.rels": `<Relationships><Relationship Id="rId1" Type="http://schemas.microsoft.com/office/2006/relationships/vbaProject" Target="vbaProject.bin"/></Relationships>`,
+		"word/vbaProject.bin":          "\xd0\xcf\x11\xe0",
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", "word/document.xml", "word/_rels/document.xml.rels", "word/vbaProject.bin"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		_, _ = w.Write([]byte(parts[name]))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func hasMacros(data []byte) bool {
+	return filetype.HasMacros(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestHasMacros(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"docm", docmPackage(t), true},
+		{"xlsm", ooxmlPackage(t, "xl/vbaProject.bin"), true},
+		{"odt with basic", odfWithEntry(t, "Basic/Standard/Module1.xml"), true},
+		{"docx", ooxmlPackage(t, "word/document.xml"), false},
+		{"odt", odfPackage(t, "application/vnd.oasis.opendocument.text"), false},
+		{"rtf", []byte(`{\rtf1 hi}`), false},
+	}
+	for _, tc := range cases {
+		if got := hasMacros(tc.data); got != tc.want {
+			t.Errorf("%s: HasMacros = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// odfWithEntry builds an ODF text package with one extra entry.
+func odfWithEntry(t *testing.T, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	_, _ = w.Write([]byte("application/vnd.oasis.opendocument.text"))
+	w, _ = zw.Create("META-INF/manifest.xml")
+	_, _ = w.Write([]byte(`<manifest:manifest><manifest:file-entry manifest:full-path="/" manifest:media-type="application/vnd.oasis.opendocument.text"/>` +
+		`<manifest:file-entry manifest:full-path="` + name + `" manifest:media-type="text/xml"/></manifest:manifest>`))
+	w, _ = zw.Create(name)
+	_, _ = w.Write([]byte("<script/>"))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestStripMacros_OOXML(t *testing.T) {
+	out, err := filetype.StripMacros(docmPackage(t))
+	if err != nil {
+		t.Fatalf("StripMacros: %v", err)
+	}
+	if hasMacros(out) {
+		t.Fatal("stripped package still has macros")
+	}
+	if ft, _ := detect(out); ft != filetype.DOCX {
+		t.Errorf("stripped package detected as %s, want docx", ft.Name)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("read stripped package: %v", err)
+	}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		if s := string(b); strings.Contains(s, "vbaProject") || strings.Contains(s, "macroEnabled") {
+			t.Errorf("%s still references macros: %s", f.Name, s)
+		}
+	}
+}
+
+func TestStripMacros_ODFKeepsMimetypeFirst(t *testing.T) {
+	out, err := filetype.StripMacros(odfWithEntry(t, "Basic/Standard/Module1.xml"))
+	if err != nil {
+		t.Fatalf("StripMacros: %v", err)
+	}
+	if hasMacros(out) {
+		t.Fatal("stripped package still has macros")
+	}
+	if ft, _ := detect(out); ft != filetype.ODT {
+		t.Errorf("stripped package detected as %s, want odt", ft.Name)
+	}
+	zr, _ := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if first := zr.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("expected stored mimetype first, got %s (method %d)", first.Name, first.Method)
+	}
+}
+
+func TestStripMacros_NotPackage(t *testing.T) {
+	if _, err := filetype.StripMacros([]byte(`{\rtf1 hi}`)); err != filetype.ErrNotPackage {
+		t.Errorf("expected ErrNotPackage, got %v", err)
+	}
+}
+
+func TestParseMacroPolicy(t *testing.T) {
+	for in, want := range map[string]filetype.MacroPolicy{
+		"":       filetype.MacroReject,
+		"reject": filetype.MacroReject,
+		"Strip":  filetype.MacroStrip,
+		"allow":  filetype.MacroAllow,
+	} {
+		if got, err := filetype.ParseMacroPolicy(in); err != nil || got != want {
+			t.Errorf("ParseMacroPolicy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := filetype.ParseMacroPolicy("sometimes"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,89 @@
+package filetype
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Package limits applied when PackageLimits leaves them zero.
+const (
+	DefaultMaxEntries      = 10000
+	DefaultMaxUncompressed = 256 << 20 // 256 MB
+)
+
+// PackageLimits bounds what a ZIP-based document may expand to. Zero fields
+// take the defaults.
+type PackageLimits struct {
+	// MaxEntries caps the entries in the archive.
+	MaxEntries int
+	// MaxUncompressed caps the total size, in bytes, the entries declare
+	// they expand to.
+	MaxUncompressed int64
+}
+
+// Errors returned by CheckPackage, wrapped with what was wrong.
+var (
+	// ErrInvalidPackage is returned for a document that is not the package
+	// its type requires, such as a ZIP without word/document.xml.
+	ErrInvalidPackage = errors.New("filetype: invalid package")
+	// ErrPackageTooLarge is returned for a package with more entries, or
+	// expanding to more bytes, than the limits allow.
+	ErrPackageTooLarge = errors.New("filetype: package too large")
+)
+
+// requiredParts lists the entries each ZIP-based type cannot be opened
+// without: the OPC content types and main part of OOXML, and the mimetype
+// and content of ODF.
+var requiredParts = map[string][]string{
+	DOCX.Name: {"[Content_Types].xml", "word/document.xml"},
+	XLSX.Name: {"[Content_Types].xml", "xl/workbook.xml"},
+	PPTX.Name: {"[Content_Types].xml", "ppt/presentation.xml"},
+	ODT.Name:  {"mimetype", "content.xml"},
+	ODS.Name:  {"mimetype", "content.xml"},
+	ODP.Name:  {"mimetype", "content.xml"},
+}
+
+// CheckPackage reports whether the document in r, detected as t, is a ZIP
+// package LibreOffice can be given: one holding the parts t requires, with
+// no more entries and expanding to no more than limits allow. Types that are
+// not ZIP-based always pass. Sizes are those the central directory declares,
+// so a zip bomb is refused before anything is decompressed.
+func CheckPackage(r io.ReaderAt, size int64, t Type, limits PackageLimits) error {
+	parts, ok := requiredParts[t.Name]
+	if !ok {
+		return nil
+	}
+	if limits.MaxEntries <= 0 {
+		limits.MaxEntries = DefaultMaxEntries
+	}
+	if limits.MaxUncompressed <= 0 {
+		limits.MaxUncompressed = DefaultMaxUncompressed
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if len(zr.File) > limits.MaxEntries {
+		return fmt.Errorf("%w: %d entries, more than %d", ErrPackageTooLarge, len(zr.File), limits.MaxEntries)
+	}
+	var total uint64
+	names := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		total += f.UncompressedSize64
+		if total > uint64(limits.MaxUncompressed) {
+			return fmt.Errorf("%w: expands to more than %d bytes", ErrPackageTooLarge, limits.MaxUncompressed)
+		}
+		// OPC part names are case-insensitive.
+		names[strings.ToLower(f.Name)] = true
+	}
+	for _, p := range parts {
+		if !names[strings.ToLower(p)] {
+			return fmt.Errorf("%w: %s has no %s", ErrInvalidPackage, t.Name, p)
+		}
+	}
+	return nil
+}
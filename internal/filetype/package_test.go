@@ -0,0 +1,83 @@
+package filetype_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+func checkPackage(data []byte, t filetype.Type, limits filetype.PackageLimits) error {
+	return filetype.CheckPackage(bytes.NewReader(data), int64(len(data)), t, limits)
+}
+
+func TestCheckPackage(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		typ  filetype.Type
+		want error
+	}{
+		{"docx", ooxmlPackage(t, "word/document.xml"), filetype.DOCX, nil},
+		{"xlsx", ooxmlPackage(t, "xl/workbook.xml"), filetype.XLSX, nil},
+		{"pptx", ooxmlPackage(t, "ppt/presentation.xml"), filetype.PPTX, nil},
+		{"odt", odfPackage(t, filetype.ODT.MIME), filetype.ODT, nil},
+		{"part names ignore case", ooxmlPackage(t, "Word/Document.xml"), filetype.DOCX, nil},
+		{"docx without document.xml", ooxmlPackage(t, "word/styles.xml"), filetype.DOCX, filetype.ErrInvalidPackage},
+		{"xlsx without workbook", ooxmlPackage(t, "xl/styles.xml"), filetype.XLSX, filetype.ErrInvalidPackage},
+		{"not a zip", []byte("PK\x03\x04 nothing more"), filetype.DOCX, filetype.ErrInvalidPackage},
+		{"rtf is not checked", []byte(`{\rtf1 hi}`), filetype.RTF, nil},
+		{"txt is not checked", []byte("hello"), filetype.TXT, nil},
+	}
+	for _, tc := range cases {
+		if err := checkPackage(tc.data, tc.typ, filetype.PackageLimits{}); !errors.Is(err, tc.want) || (tc.want == nil) != (err == nil) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+}
+
+// zipEntries builds a ZIP holding the named entries, each with data.
+func zipEntries(t *testing.T, data []byte, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		_, _ = w.Write(data)
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestCheckPackage_MissingContentTypes(t *testing.T) {
+	data := zipEntries(t, []byte("<xml/>"), "word/document.xml")
+	if err := checkPackage(data, filetype.DOCX, filetype.PackageLimits{}); !errors.Is(err, filetype.ErrInvalidPackage) {
+		t.Errorf("got %v, want ErrInvalidPackage", err)
+	}
+}
+
+func TestCheckPackage_Limits(t *testing.T) {
+	// 1 MB of zeros deflates to about 1 KB.
+	data := zipEntries(t, make([]byte, 1<<20), "[Content_Types].xml", "word/document.xml", "word/styles.xml")
+
+	for _, tc := range []struct {
+		name   string
+		limits filetype.PackageLimits
+		want   error
+	}{
+		{"within", filetype.PackageLimits{MaxEntries: 3, MaxUncompressed: 3 << 20}, nil},
+		{"defaults", filetype.PackageLimits{}, nil},
+		{"too many entries", filetype.PackageLimits{MaxEntries: 2}, filetype.ErrPackageTooLarge},
+		{"expands too far", filetype.PackageLimits{MaxUncompressed: 2 << 20}, filetype.ErrPackageTooLarge},
+	} {
+		if err := checkPackage(data, filetype.DOCX, tc.limits); !errors.Is(err, tc.want) || (tc.want == nil) != (err == nil) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
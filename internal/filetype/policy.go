@@ -0,0 +1,93 @@
+package filetype
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy restricts which detected input types are accepted, globally and per
+// tenant. Tenant rules narrow the global list and can never widen it, so a
+// request that omits or forges its tenant gets at most the global list. A nil
+// *Policy allows every type.
+type Policy struct {
+	global  map[string]bool // nil allows every type
+	tenants map[string]map[string]bool
+}
+
+// ParsePolicy builds a Policy from a comma-separated list of type names
+// ("docx,odt"; empty allows all) and semicolon-separated per-tenant lists
+// ("acme=docx,odt;globex=xlsx"). Unknown type names are an error.
+func ParsePolicy(global, tenants string) (*Policy, error) {
+	p := &Policy{tenants: make(map[string]map[string]bool)}
+	var err error
+	if strings.TrimSpace(global) != "" {
+		if p.global, err = parseTypeList(global); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range strings.Split(tenants, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		tenant, list, ok := strings.Cut(rule, "=")
+		tenant = strings.TrimSpace(tenant)
+		if !ok || tenant == "" {
+			return nil, fmt.Errorf("filetype: malformed tenant rule %q", rule)
+		}
+		if p.tenants[tenant], err = parseTypeList(list); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func parseTypeList(list string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := ByName(name); !ok {
+			return nil, fmt.Errorf("filetype: unknown type %q", name)
+		}
+		names[name] = true
+	}
+	return names, nil
+}
+
+// ByName returns the known type with the given Name.
+func ByName(name string) (Type, bool) {
+	for _, t := range All {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// Allows reports whether t may be converted for tenant ("" for none).
+func (p *Policy) Allows(tenant string, t Type) bool {
+	if p == nil {
+		return true
+	}
+	if p.global != nil && !p.global[t.Name] {
+		return false
+	}
+	if rule, ok := p.tenants[tenant]; ok && !rule[t.Name] {
+		return false
+	}
+	return true
+}
+
+// AllowedTypes returns the types that may be converted for tenant, in the
+// order of All.
+func (p *Policy) AllowedTypes(tenant string) []Type {
+	var types []Type
+	for _, t := range All {
+		if p.Allows(tenant, t) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
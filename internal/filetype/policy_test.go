@@ -0,0 +1,85 @@
+package filetype_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+func TestPolicy_Allows(t *testing.T) {
+	p, err := filetype.ParsePolicy("docx, odt, xlsx", "acme=docx;globex=odt,pptx")
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	cases := []struct {
+		tenant string
+		typ    filetype.Type
+		want   bool
+	}{
+		{"", filetype.DOCX, true},
+		{"", filetype.PPTX, false},
+		{"acme", filetype.DOCX, true},
+		{"acme", filetype.ODT, false},
+		// Tenant rules narrow the global list, never widen it.
+		{"globex", filetype.ODT, true},
+		{"globex", filetype.PPTX, false},
+		{"unknown", filetype.XLSX, true},
+	}
+	for _, tc := range cases {
+		if got := p.Allows(tc.tenant, tc.typ); got != tc.want {
+			t.Errorf("Allows(%q, %s) = %v, want %v", tc.tenant, tc.typ.Name, got, tc.want)
+		}
+	}
+}
+
+func TestPolicy_EmptyAndNilAllowAll(t *testing.T) {
+	p, err := filetype.ParsePolicy("", "")
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	var nilPolicy *filetype.Policy
+	for _, typ := range filetype.All {
+		if !p.Allows("acme", typ) || !nilPolicy.Allows("acme", typ) {
+			t.Errorf("expected %s allowed", typ.Name)
+		}
+	}
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	cases := map[string][2]string{
+		"unknown global type": {"docx,exe", ""},
+		"unknown tenant type": {"", "acme=docm"},
+		"missing tenant":      {"", "=docx"},
+		"missing separator":   {"", "acme"},
+	}
+	for name, tc := range cases {
+		if _, err := filetype.ParsePolicy(tc[0], tc[1]); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestPolicy_AllowedTypes(t *testing.T) {
+	p, err := filetype.ParsePolicy("docx, odt, xlsx", "acme=xlsx,docx")
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	names := func(types []filetype.Type) string {
+		var s []string
+		for _, t := range types {
+			s = append(s, t.Name)
+		}
+		return strings.Join(s, ",")
+	}
+	if got := names(p.AllowedTypes("")); got != "docx,odt,xlsx" {
+		t.Errorf("AllowedTypes(\"\") = %s", got)
+	}
+	if got := names(p.AllowedTypes("acme")); got != "docx,xlsx" {
+		t.Errorf("AllowedTypes(acme) = %s", got)
+	}
+	var nilPolicy *filetype.Policy
+	if got := len(nilPolicy.AllowedTypes("acme")); got != len(filetype.All) {
+		t.Errorf("nil policy allows %d types, want all", got)
+	}
+}
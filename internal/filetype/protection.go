@@ -0,0 +1,114 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ProtectionPolicy decides what happens to an upload whose author marked it
+// read-only recommended or restricted editing. Converting does not edit the
+// document, but LibreOffice can stall loading one, waiting on a prompt no
+// one will answer in headless mode, until the conversion times out.
+type ProtectionPolicy string
+
+// Protection policies.
+const (
+	// ProtectionHonor refuses protected documents.
+	ProtectionHonor ProtectionPolicy = "honor"
+	// ProtectionIgnore removes the protection and converts the document.
+	ProtectionIgnore ProtectionPolicy = "ignore"
+	// ProtectionWarn removes the protection, converts the document and says
+	// so in the response.
+	ProtectionWarn ProtectionPolicy = "warn"
+)
+
+// ParseProtectionPolicy parses "honor", "ignore" or "warn". Empty means
+// ProtectionWarn.
+func ParseProtectionPolicy(s string) (ProtectionPolicy, error) {
+	switch p := ProtectionPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ProtectionWarn, nil
+	case ProtectionHonor, ProtectionIgnore, ProtectionWarn:
+		return p, nil
+	default:
+		return "", fmt.Errorf("filetype: unknown protection policy %q", s)
+	}
+}
+
+// protectionMarkers maps each package part that can carry protection to the
+// elements that do: Word's read-only recommendation and editing
+// restrictions, Excel's read-only recommendation and workbook structure
+// lock, PowerPoint's modify password, and the ODF "open read-only" setting.
+var protectionMarkers = map[string]*regexp.Regexp{
+	"word/settings.xml":    regexp.MustCompile(`<w:(?:writeProtection|documentProtection)\b[^>]*/>`),
+	"xl/workbook.xml":      regexp.MustCompile(`<(?:fileSharing|workbookProtection)\b[^>]*/>`),
+	"ppt/presentation.xml": regexp.MustCompile(`<p:modifyVerifier\b[^>]*/>`),
+	"settings.xml":         regexp.MustCompile(`<config:config-item config:name="LoadReadonly" config:type="boolean">true</config:config-item>`),
+}
+
+// odfLoadReadonly is the ODF setting with protection turned off.
+const odfLoadReadonly = `<config:config-item config:name="LoadReadonly" config:type="boolean">false</config:config-item>`
+
+// Protected reports whether the document is marked read-only recommended or
+// carries editing restrictions.
+func Protected(r io.ReaderAt, size int64) bool {
+	if !bytes.HasPrefix(head(r, size, len(zipMagic)), zipMagic) {
+		return false
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		marker, ok := protectionMarkers[f.Name]
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return false
+		}
+		b, _ := io.ReadAll(io.LimitReader(rc, 4<<20))
+		rc.Close()
+		if marker.Match(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// StripProtection returns a copy of the package with its read-only
+// recommendation and editing restrictions removed. Other entries are copied
+// byte for byte.
+func StripProtection(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrNotPackage
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		marker, ok := protectionMarkers[f.Name]
+		if !ok {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		replacement := []byte(nil)
+		if f.Name == "settings.xml" {
+			replacement = []byte(odfLoadReadonly)
+		}
+		if err := rewriteEntry(zw, f, func(b []byte) []byte { return marker.ReplaceAllLiteral(b, replacement) }); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
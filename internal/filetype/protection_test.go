@@ -0,0 +1,116 @@
+package filetype_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// packageOf builds a ZIP package of the given parts, in order.
+func packageOf(t *testing.T, parts ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, p := range parts {
+		w, err := zw.Create(p[0])
+		if err != nil {
+			t.Fatalf("create %s: %v", p[0], err)
+		}
+		_, _ = w.Write([]byte(p[1]))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func protected(data []byte) bool {
+	return filetype.Protected(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestParseProtectionPolicy(t *testing.T) {
+	cases := map[string]filetype.ProtectionPolicy{
+		"":        filetype.ProtectionWarn,
+		"Honor":   filetype.ProtectionHonor,
+		" ignore": filetype.ProtectionIgnore,
+		"warn":    filetype.ProtectionWarn,
+	}
+	for in, want := range cases {
+		if got, err := filetype.ParseProtectionPolicy(in); err != nil || got != want {
+			t.Errorf("ParseProtectionPolicy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := filetype.ParseProtectionPolicy("obey"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestProtected(t *testing.T) {
+	cases := map[string]struct {
+		data []byte
+		want bool
+	}{
+		"word read-only recommended": {packageOf(t,
+			[2]string{"word/document.xml", "<w:document/>"},
+			[2]string{"word/settings.xml", `<w:settings><w:writeProtection w:recommended="1"/></w:settings>`}), true},
+		"word editing restricted": {packageOf(t,
+			[2]string{"word/settings.xml", `<w:settings><w:documentProtection w:edit="readOnly" w:enforcement="1"/></w:settings>`}), true},
+		"excel read-only recommended": {packageOf(t,
+			[2]string{"xl/workbook.xml", `<workbook><fileSharing readOnlyRecommended="1"/><sheets/></workbook>`}), true},
+		"powerpoint modify password": {packageOf(t,
+			[2]string{"ppt/presentation.xml", `<p:presentation><p:modifyVerifier p:spinValue="100000"/></p:presentation>`}), true},
+		"odf open read-only": {packageOf(t,
+			[2]string{"mimetype", filetype.ODT.MIME},
+			[2]string{"settings.xml", `<config:config-item config:name="LoadReadonly" config:type="boolean">true</config:config-item>`}), true},
+		"odf read-write": {packageOf(t,
+			[2]string{"mimetype", filetype.ODT.MIME},
+			[2]string{"settings.xml", `<config:config-item config:name="LoadReadonly" config:type="boolean">false</config:config-item>`}), false},
+		"plain docx":    {docmPackage(t), false},
+		"not a package": {[]byte(`{\rtf1 hello}`), false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := protected(tc.data); got != tc.want {
+				t.Errorf("Protected = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStripProtection(t *testing.T) {
+	data := packageOf(t,
+		[2]string{"mimetype", filetype.ODT.MIME},
+		[2]string{"content.xml", "<office:document-content/>"},
+		[2]string{"settings.xml", `<config:config-item config:name="LoadReadonly" config:type="boolean">true</config:config-item>`},
+	)
+	stripped, err := filetype.StripProtection(data)
+	if err != nil {
+		t.Fatalf("StripProtection: %v", err)
+	}
+	if protected(stripped) {
+		t.Error("stripped package is still protected")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(stripped), int64(len(stripped)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.File[0].Name != "mimetype" || len(zr.File) != 3 {
+		t.Fatalf("unexpected entries after stripping: %v", zr.File)
+	}
+	rc, _ := zr.File[2].Open()
+	settings, _ := io.ReadAll(rc)
+	rc.Close()
+	if !strings.Contains(string(settings), `config:name="LoadReadonly" config:type="boolean">false<`) {
+		t.Errorf("LoadReadonly not turned off: %s", settings)
+	}
+
+	word := packageOf(t, [2]string{"word/settings.xml", `<w:settings><w:zoom/><w:writeProtection w:recommended="1"/></w:settings>`})
+	if stripped, err := filetype.StripProtection(word); err != nil || protected(stripped) {
+		t.Errorf("Word package still protected after stripping: %v", err)
+	}
+	if _, err := filetype.StripProtection([]byte("not a zip")); err != filetype.ErrNotPackage {
+		t.Errorf("expected ErrNotPackage, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// Word records the template a document was created from in word/settings.xml
+// as <w:attachedTemplate r:id="…"/>, resolved through an external
+// relationship in word/_rels/settings.xml.rels. On corporate documents the
+// target is often a UNC or intranet path (file://///fileserver/Templates/…)
+// that LibreOffice tries to reach while loading, stalling for seconds when
+// it is unreachable. The template contributes nothing to the rendered
+// output.
+const (
+	settingsPart = "word/settings.xml"
+	settingsRels = "word/_rels/settings.xml.rels"
+)
+
+var (
+	templateRelationship = regexp.MustCompile(`<Relationship[^>]*Type="[^"]*/attachedTemplate"[^>]*/>`)
+	attachedTemplate     = regexp.MustCompile(`<w:attachedTemplate\b[^>]*/>`)
+	externalTarget       = regexp.MustCompile(`TargetMode="External"`)
+)
+
+// HasExternalTemplate reports whether the document is a Word package whose
+// attached template is an external reference.
+func HasExternalTemplate(r io.ReaderAt, size int64) bool {
+	if !bytes.HasPrefix(head(r, size, len(zipMagic)), zipMagic) {
+		return false
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name != settingsRels {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return false
+		}
+		b, _ := io.ReadAll(io.LimitReader(rc, 1<<20))
+		rc.Close()
+		for _, rel := range templateRelationship.FindAll(b, -1) {
+			if externalTarget.Match(rel) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StripExternalTemplate returns a copy of the package with its attached
+// template reference removed from the settings part and its relationships.
+// Other entries are copied byte for byte.
+func StripExternalTemplate(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrNotPackage
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		var rewrite func([]byte) []byte
+		switch f.Name {
+		case settingsRels:
+			rewrite = func(b []byte) []byte { return templateRelationship.ReplaceAll(b, nil) }
+		case settingsPart:
+			rewrite = func(b []byte) []byte { return attachedTemplate.ReplaceAll(b, nil) }
+		}
+		if rewrite == nil {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := rewriteEntry(zw, f, rewrite); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
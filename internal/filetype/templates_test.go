@@ -0,0 +1,100 @@
+package filetype_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// templatedDocx builds a Word package whose settings attach the template at
+// target with the given TargetMode ("" omits it).
+func templatedDocx(t *testing.T, target, mode string) []byte {
+	t.Helper()
+	attr := ""
+	if mode != "" {
+		attr = ` TargetMode="` + mode + `"`
+	}
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", "<Types/>"},
+		{"word/document.xml", "<w:document/>"},
+		{"word/settings.xml", `<w:settings><w:zoom w:percent="100"/><w:attachedTemplate r:id="rId1"/></w:settings>`},
+		{"word/_rels/settings.xml.rels", `<Relationships><Relationship Id="rId1" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/attachedTemplate" ` +
+			`Target="` + target + `"` + attr + `/></Relationships>`},
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, p := range parts {
+		w, err := zw.Create(p.name)
+		if err != nil {
+			t.Fatalf("create %s: %v", p.name, err)
+		}
+		_, _ = w.Write([]byte(p.body))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func hasExternalTemplate(data []byte) bool {
+	return filetype.HasExternalTemplate(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestHasExternalTemplate(t *testing.T) {
+	cases := map[string]struct {
+		data []byte
+		want bool
+	}{
+		"unc path":       {templatedDocx(t, `file:///\\fileserver\Templates\Letter.dotm`, "External"), true},
+		"intranet url":   {templatedDocx(t, "http://intranet/templates/memo.dotx", "External"), true},
+		"internal":       {templatedDocx(t, "template.dotx", ""), false},
+		"plain docx":     {docmPackage(t), false},
+		"not a package":  {[]byte(`{\rtf1 hello}`), false},
+		"truncated docx": {templatedDocx(t, "http://intranet/x.dotx", "External")[:40], false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := hasExternalTemplate(tc.data); got != tc.want {
+				t.Errorf("HasExternalTemplate = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStripExternalTemplate(t *testing.T) {
+	out, err := filetype.StripExternalTemplate(templatedDocx(t, `file:///\\fileserver\Templates\Letter.dotm`, "External"))
+	if err != nil {
+		t.Fatalf("StripExternalTemplate: %v", err)
+	}
+	if hasExternalTemplate(out) {
+		t.Fatal("template reference still present")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("result is not a valid package: %v", err)
+	}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		switch f.Name {
+		case "word/settings.xml":
+			if strings.Contains(string(b), "attachedTemplate") || !strings.Contains(string(b), "w:zoom") {
+				t.Errorf("settings not rewritten as expected: %s", b)
+			}
+		case "word/_rels/settings.xml.rels":
+			if strings.Contains(string(b), "fileserver") {
+				t.Errorf("relationship not removed: %s", b)
+			}
+		}
+	}
+}
+
+func TestStripExternalTemplate_NotPackage(t *testing.T) {
+	if _, err := filetype.StripExternalTemplate([]byte("plain text")); err != filetype.ErrNotPackage {
+		t.Errorf("expected ErrNotPackage, got %v", err)
+	}
+}
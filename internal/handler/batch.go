@@ -0,0 +1,581 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+)
+
+const (
+	// maxBatchFiles caps the number of documents in one batch request.
+	maxBatchFiles = 50
+	// maxBatchBodySize caps the whole batch upload.
+	maxBatchBodySize = 100 << 20 // 100 MB
+	// batchManifestName is the manifest entry written into every batch ZIP.
+	batchManifestName = "manifest.json"
+)
+
+// Policies of the duplicate_names field, naming the results of documents
+// whose names would give the same file in a batch ZIP.
+const (
+	// duplicateSuffix appends -2, -3, … to later repeats of a name.
+	duplicateSuffix = "suffix"
+	// duplicateDirectory puts every result in a directory numbered after
+	// its document's place in the request, e.g. 2/report.pdf.
+	duplicateDirectory = "directory"
+	// duplicateIndex names every result after its document's place in the
+	// request, e.g. 2.pdf; the manifest maps them back to the documents.
+	duplicateIndex = "index"
+)
+
+// Batch handles POST /convert/batch. It accepts several "file" parts and/or
+// "archive" parts (ZIPs of documents), converts each document with bounded
+// parallelism, and streams back a ZIP of the results plus a manifest.json
+// describing the outcome of every entry. One bad document does not fail the
+// batch.
+type Batch struct {
+	c           *Convert
+	parallelism int
+}
+
+// NewBatch returns a Batch handler converting up to parallelism documents of
+// one request at a time. Options are shared with Convert (WithPool applies per
+// document, WithDetector to every document).
+func NewBatch(conv converter.Converter, parallelism int, opts ...Option) *Batch {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &Batch{c: NewConvert(conv, opts...), parallelism: parallelism}
+}
+
+// batchInput is one document extracted from the request.
+type batchInput struct {
+	name string
+	data []byte
+	err  *stageError // set when the document was rejected while reading
+}
+
+// decrypt returns in with a password-protected document replaced by the
+// package inside, or rejected when password does not open it.
+func (in batchInput) decrypt(password string) batchInput {
+	if in.err != nil || !filetype.Encrypted(bytes.NewReader(in.data), int64(len(in.data))) {
+		return in
+	}
+	data, serr := decryptDocument(bytes.NewReader(in.data), int64(len(in.data)), password)
+	if serr != nil {
+		in.err = serr
+		return in
+	}
+	in.data = data
+	return in
+}
+
+// batchEntry is the manifest record for one document.
+type batchEntry struct {
+	Name   string `json:"name"`
+	Output string `json:"output,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// PDFVersion is the version of a PDF result, as reported by
+	// converter.DetectPDFVersion.
+	PDFVersion string `json:"pdf_version,omitempty"`
+	// Warnings are about how the document was converted, e.g. with its
+	// protection ignored.
+	Warnings []string `json:"warnings,omitempty"`
+	// Code is the machine-readable reason a document failed, the one
+	// /v2/convert gives for it alone, and Retryable whether sending it
+	// again may succeed. Both are reported from API version 2 on.
+	Code      string `json:"code,omitempty"`
+	Retryable *bool  `json:"retryable,omitempty"`
+
+	path string // converted file on disk, for succeeded entries
+	code string // Code, whatever the version
+}
+
+// failed returns e failed with the client-safe msg, and the status and code
+// /convert answers the document alone with; "" derives the code from the
+// status.
+func (e batchEntry) failed(status int, code, msg string) batchEntry {
+	if code == "" {
+		code = statusCode(status)
+	}
+	e.Error, e.code = msg, code
+	return e
+}
+
+// failedWith is failed with the response of serr.
+func (e batchEntry) failedWith(serr *stageError) batchEntry {
+	return e.failed(serr.status, serr.code, serr.msg)
+}
+
+// retryable reports whether a document that failed with code may succeed
+// when sent again: the server was busy, out of time or failed itself, rather
+// than refusing the document.
+func retryable(code string) bool {
+	switch code {
+	case statusCode(http.StatusInternalServerError), statusCode(http.StatusServiceUnavailable), statusCode(http.StatusGatewayTimeout):
+		return true
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Batch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "method not allowed")
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if r.ContentLength > maxBatchBodySize {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "batch too large")
+		writeError(w, r, http.StatusRequestEntityTooLarge, "batch too large")
+		return
+	}
+	if serr := h.c.checkDisk(); serr != nil {
+		serr.write(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodySize)
+	if err := r.ParseMultipartForm(maxFileSize); err != nil {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "invalid batch upload")
+		writeError(w, r, http.StatusRequestEntityTooLarge, "batch too large")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	format := strings.ToLower(r.FormValue("output"))
+	if format == "" {
+		format = converter.FormatPDF
+	}
+	if converter.ContentType(format) == "" {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "unknown output format")
+		writeError(w, r, http.StatusBadRequest, "unsupported output format")
+		return
+	}
+	version, serr := h.c.pdfVersion(tenantID(r), format, r.FormValue("target_pdf_version"))
+	if serr != nil {
+		serr.write(w, r)
+		return
+	}
+	dpi, serr := h.c.imageDPI(tenantID(r), format, r.FormValue("image_dpi"))
+	if serr != nil {
+		serr.write(w, r)
+		return
+	}
+	pages, orientation, serr := pageOptions(format, r.FormValue("pages"), r.FormValue("orientation"))
+	if serr != nil {
+		serr.write(w, r)
+		return
+	}
+	destinations, links, serr := linkOptions(format, r.FormValue("named_destinations"), r.FormValue("convert_links"))
+	if serr != nil {
+		serr.write(w, r)
+		return
+	}
+	user, owner := r.FormValue("user_password"), r.FormValue("owner_password")
+	if serr := checkPasswords(format, version, user, owner); serr != nil {
+		serr.write(w, r)
+		return
+	}
+	opts := converter.Options{
+		Format:            format,
+		PDFVersion:        version,
+		ImageDPI:          dpi,
+		Pages:             pages,
+		Orientation:       orientation,
+		NamedDestinations: destinations,
+		ConvertLinks:      links,
+		UserPassword:      user,
+		OwnerPassword:     owner,
+	}
+	wreq := watermarkRequest{
+		text:     r.FormValue("watermark"),
+		position: r.FormValue("watermark_position"),
+		opacity:  r.FormValue("watermark_opacity"),
+	}
+	if fhs := r.MultipartForm.File["watermark_image"]; len(fhs) > 0 {
+		if wreq.image, serr = readWatermarkImage(fhs[0]); serr != nil {
+			serr.write(w, r)
+			return
+		}
+	}
+	step, serr := watermark(r, opts, wreq)
+	if serr != nil {
+		serr.write(w, r)
+		return
+	}
+	var post []pdfpost.Step
+	if step != nil {
+		post = append(post, step)
+	}
+	if step, serr = metadata(opts, readMetadataRequest(r.FormValue)); serr != nil {
+		serr.write(w, r)
+		return
+	}
+	if step != nil {
+		post = append(post, step)
+	}
+
+	duplicates := strings.ToLower(r.FormValue("duplicate_names"))
+	if duplicates == "" {
+		duplicates = duplicateSuffix
+	}
+	if duplicates != duplicateSuffix && duplicates != duplicateDirectory && duplicates != duplicateIndex {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "unknown duplicate_names policy")
+		writeError(w, r, http.StatusBadRequest, "duplicate_names must be suffix, directory or index")
+		return
+	}
+
+	inputs := readBatchInputs(r.MultipartForm)
+	if len(inputs) == 0 {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "no files in batch")
+		writeError(w, r, http.StatusBadRequest, "no files in batch")
+		return
+	}
+	if len(inputs) > maxBatchFiles {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "too many files in batch")
+		writeError(w, r, http.StatusRequestEntityTooLarge, "too many files in batch")
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", tempclean.Pattern("batch", middleware.RequestIDFromContext(r.Context())))
+	if err != nil {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), "internal error: mkdirtemp")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	password := r.FormValue("document_password")
+	entries := make([]batchEntry, len(inputs))
+	sem := make(chan struct{}, h.parallelism)
+	var wg sync.WaitGroup
+	for i, in := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			in = in.decrypt(password)
+			entries[i] = h.convertOne(r.Context(), in, filepath.Join(tmpDir, strconv.Itoa(i)), opts, post, tenantID(r))
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	outputs := batchOutputs(inputs, opts.Format, duplicates)
+	v2 := responseVersion(w) >= V2
+	for i, e := range entries {
+		if e.Status == "succeeded" {
+			entries[i].Output = outputs[i]
+			continue
+		}
+		failed++
+		entries[i].Error = i18n.Localize(w, r, e.Error)
+		if v2 {
+			retry := retryable(e.code)
+			entries[i].Code, entries[i].Retryable = e.code, &retry
+		}
+	}
+	status := http.StatusOK
+	if failed == 0 {
+		middleware.SetOutcome(r.Context(), "success")
+	} else {
+		middleware.SetOutcome(r.Context(), "failed")
+		middleware.SetLogError(r.Context(), strconv.Itoa(failed)+" of "+strconv.Itoa(len(entries))+" batch entries failed")
+		// Version 1 answers 200 whatever the entries' outcome.
+		if v2 {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="converted.zip"`)
+	w.WriteHeader(status)
+	writeBatchZip(w, entries)
+}
+
+// convertOne converts a single batch document inside dir, applies the
+// post-processing steps, and returns its manifest entry.
+func (h *Batch) convertOne(ctx context.Context, in batchInput, dir string, opts converter.Options, post []pdfpost.Step, tenant string) batchEntry {
+	e := batchEntry{Name: in.name, Status: "failed"}
+	if in.err != nil {
+		return e.failedWith(in.err)
+	}
+
+	switch {
+	case len(in.data) == 0:
+		return e.failedWith(errBadUpload(badUploadEmpty, ""))
+	case filetype.Truncated(bytes.NewReader(in.data), int64(len(in.data))):
+		return e.failedWith(errBadUpload(badUploadTruncated, ""))
+	}
+	ft, ok := h.c.detect.Detect(bytes.NewReader(in.data), int64(len(in.data)))
+	if !ok {
+		return e.failed(http.StatusUnsupportedMediaType, "", "unsupported file type")
+	}
+	ft = filetype.Named(ft, in.name)
+	if !h.c.policy.Allows(tenant, ft) {
+		return e.failed(http.StatusUnsupportedMediaType, codeTypeNotAllowed, "document type not allowed")
+	}
+	if err := h.c.checkPackage(bytes.NewReader(in.data), int64(len(in.data)), ft); err != nil {
+		return e.failedWith(err)
+	}
+	data, action := h.c.applyMacroPolicy(in.data)
+	if action == macroRejected {
+		return e.failed(http.StatusUnsupportedMediaType, codeMacrosNotAllowed, "documents with macros are not allowed")
+	}
+	data, action = h.c.applyProtectionPolicy(data)
+	switch action {
+	case protectionRejected:
+		return e.failedWith(errDocumentProtected())
+	case protectionWarned:
+		e.Warnings = append(e.Warnings, protectionWarning)
+	}
+	data = h.c.stripTemplate(data)
+	if !converter.Supports(ft.Ext, opts.Format) {
+		return e.failed(http.StatusBadRequest, "", "output format not supported for this document type")
+	}
+	if opts.Orientation != "" && !converter.SupportsOrientation(ft.Ext) {
+		return e.failedWith(errOrientationNotSupported())
+	}
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return e.failed(http.StatusInternalServerError, "", "internal error")
+	}
+	inputPath := filepath.Join(dir, "input"+ft.Ext)
+	if err := os.WriteFile(inputPath, data, 0600); err != nil {
+		return e.failed(http.StatusInternalServerError, "", "internal error")
+	}
+
+	if h.c.pool != nil {
+		release, err := h.c.pool.Acquire(ctx)
+		if err != nil {
+			if !errors.Is(err, pool.ErrQueueFull) {
+				return e.failed(http.StatusServiceUnavailable, "", "request cancelled")
+			}
+			return e.failed(http.StatusServiceUnavailable, "", "server busy")
+		}
+		defer release()
+	}
+
+	outPath, err := h.c.convert(ctx, tenant, inputPath, dir, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, watchdog.ErrMemoryPressure):
+		return e.failed(http.StatusServiceUnavailable, "", "server busy")
+	case errors.Is(err, context.DeadlineExceeded):
+		return e.failed(http.StatusGatewayTimeout, "", "request timed out")
+	case errors.Is(err, context.Canceled):
+		return e.failed(http.StatusServiceUnavailable, "", "request cancelled")
+	case errors.Is(err, converter.ErrTimeout):
+		return e.failed(http.StatusGatewayTimeout, "", "conversion timed out")
+	case errors.Is(err, converter.ErrResourceLimit):
+		return e.failed(http.StatusUnprocessableEntity, codeResourceLimit, "conversion exceeded a resource limit")
+	case errors.Is(err, converter.ErrNoOutput):
+		return e.failed(http.StatusInternalServerError, "", "conversion produced no output")
+	default:
+		return e.failed(http.StatusInternalServerError, "", "conversion failed")
+	}
+	if err := pdfpost.Process(outPath, h.c.postWorkers, post...); err != nil {
+		return e.failed(http.StatusInternalServerError, "", "conversion failed")
+	}
+
+	e.Status = "succeeded"
+	e.path = outPath
+	if opts.Format == converter.FormatPDF {
+		if f, err := os.Open(outPath); err == nil {
+			e.PDFVersion, _ = converter.DetectPDFVersion(f)
+			f.Close()
+		}
+	}
+	return e
+}
+
+// batchOutputs returns the name in the batch ZIP of each input's result,
+// keeping them apart by policy. Names depend only on the inputs, so
+// every document gets the same one whichever others fail; compared without
+// case, they never clash with each other or the manifest.
+func batchOutputs(inputs []batchInput, format, policy string) []string {
+	names := make([]string, len(inputs))
+	seen := map[string]bool{batchManifestName: true}
+	for i, in := range inputs {
+		name := resultFilename(in.name, format)
+		switch policy {
+		case duplicateDirectory:
+			name = strconv.Itoa(i+1) + "/" + name
+		case duplicateIndex:
+			name = strconv.Itoa(i+1) + "." + format
+		default:
+			base := strings.TrimSuffix(name, "."+format)
+			for n := 2; seen[strings.ToLower(name)]; n++ {
+				name = base + "-" + strconv.Itoa(n) + "." + format
+			}
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// readBatchInputs collects documents from "file" parts and from the entries
+// of "archive" ZIP parts, in request order.
+func readBatchInputs(form *multipart.Form) []batchInput {
+	var inputs []batchInput
+	for _, fh := range form.File["file"] {
+		inputs = append(inputs, readPart(fh))
+	}
+	for _, fh := range form.File["archive"] {
+		inputs = append(inputs, readArchive(fh)...)
+		if len(inputs) > maxBatchFiles {
+			break
+		}
+	}
+	return inputs
+}
+
+func readPart(fh *multipart.FileHeader) batchInput {
+	in := batchInput{name: fh.Filename}
+	if fh.Size > maxFileSize {
+		in.err = errBatchFileTooLarge()
+		return in
+	}
+	f, err := fh.Open()
+	if err != nil {
+		in.err = errUnreadable("could not read file")
+		return in
+	}
+	defer f.Close()
+	in.data, err = io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		in.err = errUnreadable("could not read file")
+	}
+	return in
+}
+
+// errBatchFileTooLarge is the failure of a batch document over the size
+// limit.
+func errBatchFileTooLarge() *stageError {
+	return fail(http.StatusRequestEntityTooLarge, "file too large", "file too large")
+}
+
+// errUnreadable is the failure of a batch document that could not be read
+// out of the request, msg saying what.
+func errUnreadable(msg string) *stageError {
+	return fail(http.StatusBadRequest, msg, msg)
+}
+
+// readWatermarkImage reads a batch's watermark_image part.
+func readWatermarkImage(fh *multipart.FileHeader) ([]byte, *stageError) {
+	if fh.Size > maxWatermarkImage {
+		return nil, errWatermarkImageTooLarge()
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, fail(http.StatusInternalServerError, "internal error: open watermark image", "internal error")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fail(http.StatusInternalServerError, "internal error: read watermark image", "internal error")
+	}
+	return data, nil
+}
+
+// readArchive expands a ZIP of documents. Directories and macOS resource-fork
+// entries are skipped; an unreadable archive yields a single failed entry.
+func readArchive(fh *multipart.FileHeader) []batchInput {
+	f, err := fh.Open()
+	if err != nil {
+		return []batchInput{{name: fh.Filename, err: errUnreadable("could not read archive")}}
+	}
+	defer f.Close()
+	zr, err := zip.NewReader(f, fh.Size)
+	if err != nil {
+		return []batchInput{{name: fh.Filename, err: errUnreadable("invalid archive")}}
+	}
+
+	var inputs []batchInput
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") {
+			continue
+		}
+		if len(inputs) > maxBatchFiles {
+			break
+		}
+		in := batchInput{name: path.Base(zf.Name)}
+		if zf.UncompressedSize64 > maxFileSize {
+			in.err = errBatchFileTooLarge()
+			inputs = append(inputs, in)
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			in.err = errUnreadable("could not read archive entry")
+			inputs = append(inputs, in)
+			continue
+		}
+		// Don't trust the declared size: cap what we actually inflate.
+		in.data, err = io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+		rc.Close()
+		if err != nil {
+			in.err = errUnreadable("could not read archive entry")
+		} else if len(in.data) > maxFileSize {
+			in.data, in.err = nil, errBatchFileTooLarge()
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs
+}
+
+// writeBatchZip streams the converted files followed by the manifest. Errors
+// mid-stream can only truncate the archive, since the status is already sent.
+func writeBatchZip(w io.Writer, entries []batchEntry) {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		if e.path == "" {
+			continue
+		}
+		f, err := os.Open(e.path)
+		if err != nil {
+			continue
+		}
+		zf, err := zw.Create(e.Output)
+		if err == nil {
+			_, _ = io.Copy(zf, f)
+		}
+		f.Close()
+	}
+	if mf, err := zw.Create(batchManifestName); err == nil {
+		_ = json.NewEncoder(mf).Encode(map[string]any{"entries": entries})
+	}
+	_ = zw.Close()
+}
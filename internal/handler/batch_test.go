@@ -0,0 +1,460 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+// batchPart is one multipart file part of a batch request.
+type batchPart struct {
+	field, name string
+	data        []byte
+}
+
+func buildBatchRequest(t *testing.T, parts ...batchPart) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		fw, err := mw.CreateFormFile(p.field, p.name)
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		_, _ = fw.Write(p.data)
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/convert/batch", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// manifest mirrors the batch manifest.json.
+type manifest struct {
+	Entries []struct {
+		Name   string `json:"name"`
+		Output string `json:"output"`
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"entries"`
+}
+
+// readBatchZip returns the archive's file contents keyed by name, and the
+// decoded manifest.
+func readBatchZip(t *testing.T, body []byte) (map[string]string, manifest) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("response is not a ZIP: %v", err)
+	}
+	files := map[string]string{}
+	var m manifest
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if f.Name == "manifest.json" {
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatalf("decode manifest: %v", err)
+			}
+			continue
+		}
+		files[f.Name] = string(data)
+	}
+	return files, m
+}
+
+func TestBatch_MixedResults(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+			if strings.HasSuffix(inputPath, ".rtf") {
+				return "", converter.ErrTimeout
+			}
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			_ = os.WriteFile(pdfPath, []byte("%PDF "+filepath.Ext(inputPath)), 0600)
+			return pdfPath, nil
+		},
+	}
+	h := handler.NewBatch(mc, 2)
+
+	req := buildBatchRequest(t,
+		batchPart{"file", "a.docx", validDocxBody(256)},
+		batchPart{"file", "b.rtf", []byte(`{\rtf1 slow}`)},
+		batchPart{"file", "c.png", []byte("\x89PNG\r\n\x1a\n\x00")},
+		batchPart{"archive", "more.zip", zipOf(t, map[string][]byte{
+			"docs/d.txt":       []byte("hello"),
+			"__MACOSX/._d.txt": []byte("junk"),
+		})},
+	)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("expected application/zip, got %s", ct)
+	}
+
+	files, m := readBatchZip(t, rr.Body.Bytes())
+	if files["a.pdf"] != "%PDF .docx" || files["d.pdf"] != "%PDF .txt" {
+		t.Errorf("unexpected archive contents: %v", files)
+	}
+	if len(m.Entries) != 4 {
+		t.Fatalf("expected 4 manifest entries, got %+v", m.Entries)
+	}
+	want := []struct{ name, status, err string }{
+		{"a.docx", "succeeded", ""},
+		{"b.rtf", "failed", "conversion timed out"},
+		{"c.png", "failed", "unsupported file type"},
+		{"d.txt", "succeeded", ""},
+	}
+	for i, w := range want {
+		e := m.Entries[i]
+		if e.Name != w.name || e.Status != w.status || e.Error != w.err {
+			t.Errorf("entry %d: expected %+v, got %+v", i, w, e)
+		}
+	}
+}
+
+func TestBatch_PartialSuccessV2(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+			if strings.HasSuffix(inputPath, ".rtf") {
+				return "", converter.ErrTimeout
+			}
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			_ = os.WriteFile(pdfPath, []byte("%PDF"), 0600)
+			return pdfPath, nil
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/convert/batch", handler.NewBatch(mc, 2))
+	h := handler.Versions(mux)
+	send := func(path string, parts ...batchPart) *httptest.ResponseRecorder {
+		req := buildBatchRequest(t, parts...)
+		req.URL.Path = path
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	mixed := []batchPart{
+		{"file", "a.docx", validDocxBody(256)},
+		{"file", "b.rtf", []byte(`{\rtf1 slow}`)},
+		{"file", "c.png", []byte("\x89PNG\r\n\x1a\n\x00")},
+	}
+
+	rr := send("/v2/convert/batch", mixed...)
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d: %s", rr.Code, rr.Body.String())
+	}
+	files, _ := readBatchZip(t, rr.Body.Bytes())
+	if files["a.pdf"] != "%PDF" {
+		t.Errorf("succeeded entry missing: %v", files)
+	}
+	var m struct {
+		Entries []struct {
+			Status    string `json:"status"`
+			Code      string `json:"code"`
+			Retryable *bool  `json:"retryable"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(rawManifest(t, rr.Body.Bytes()), &m); err != nil || len(m.Entries) != 3 {
+		t.Fatalf("manifest %+v", m)
+	}
+	if e := m.Entries[0]; e.Status != "succeeded" || e.Code != "" || e.Retryable != nil {
+		t.Errorf("succeeded entry %+v", e)
+	}
+	if e := m.Entries[1]; e.Code != "gateway_timeout" || e.Retryable == nil || !*e.Retryable {
+		t.Errorf("timed out entry: code %q, retryable %v", e.Code, e.Retryable)
+	}
+	if e := m.Entries[2]; e.Code != "unsupported_media_type" || e.Retryable == nil || *e.Retryable {
+		t.Errorf("unsupported entry: code %q, retryable %v", e.Code, e.Retryable)
+	}
+
+	if rr := send("/v2/convert/batch", mixed[0]); rr.Code != http.StatusOK {
+		t.Errorf("all succeeded: %d, want 200", rr.Code)
+	}
+	// Version 1 is unchanged: 200, and no codes.
+	rr = send("/v1/convert/batch", mixed...)
+	if rr.Code != http.StatusOK {
+		t.Errorf("v1: %d, want 200", rr.Code)
+	}
+	if raw := rawManifest(t, rr.Body.Bytes()); bytes.Contains(raw, []byte("retryable")) {
+		t.Errorf("v1 manifest reports retryable: %s", raw)
+	}
+}
+
+// rawManifest returns the manifest.json of a batch ZIP as written.
+func rawManifest(t *testing.T, body []byte) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("response is not a ZIP: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name == "manifest.json" {
+			rc, _ := f.Open()
+			defer rc.Close()
+			data, _ := io.ReadAll(rc)
+			return data
+		}
+	}
+	t.Fatal("no manifest.json")
+	return nil
+}
+
+func TestBatch_NoFiles(t *testing.T) {
+	h := handler.NewBatch(happyMock(), 1)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildBatchRequest(t))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestBatch_LowDisk(t *testing.T) {
+	skipWithoutFreeDisk(t)
+	h := handler.NewBatch(happyMock(), 1, handler.WithMinFreeDisk(1<<62))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildBatchRequest(t, batchPart{"file", "a.docx", validDocxBody(256)}))
+
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestBatch_InvalidPackage(t *testing.T) {
+	mc := happyMock()
+	h := handler.NewBatch(mc, 1)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildBatchRequest(t,
+		batchPart{"file", "a.docx", zipOf(t, map[string][]byte{"word/styles.xml": []byte("<w:styles/>")})},
+		batchPart{"file", "b.docx", zipBomb(t)},
+	))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	_, m := readBatchZip(t, rr.Body.Bytes())
+	want := []string{
+		"document is not a valid package: required parts are missing",
+		"document expands to more entries or data than allowed",
+	}
+	if len(m.Entries) != len(want) {
+		t.Fatalf("entries %+v", m.Entries)
+	}
+	for i, w := range want {
+		if e := m.Entries[i]; e.Status != "failed" || e.Error != w {
+			t.Errorf("entry %d: expected error %q, got %+v", i, w, e)
+		}
+	}
+	if len(mc.calls) != 0 {
+		t.Errorf("converter should not run, got %v", mc.calls)
+	}
+}
+
+// zipOf builds a ZIP archive from name → contents.
+func zipOf(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		_, _ = w.Write(data)
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestBatch_PasswordProtected(t *testing.T) {
+	protected, err := os.ReadFile("../filetype/testdata/protected.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for password, want := range map[string]string{
+		"":            "document is password protected",
+		"open-sesame": "",
+	} {
+		h := handler.NewBatch(happyMock(), 1)
+		req := buildBatchRequest(t, batchPart{"file", "secret.docx", protected})
+		req.URL.RawQuery = "document_password=" + password
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		_, m := readBatchZip(t, rr.Body.Bytes())
+		if len(m.Entries) != 1 || m.Entries[0].Error != want {
+			t.Errorf("password %q: expected error %q, got %+v", password, want, m.Entries)
+		}
+	}
+}
+
+func TestBatch_ProtectedWarning(t *testing.T) {
+	readOnly := zipOf(t, map[string][]byte{
+		"[Content_Types].xml": []byte("<Types/>"),
+		"xl/workbook.xml":     []byte(`<workbook><fileSharing readOnlyRecommended="1"/></workbook>`),
+	})
+	h := handler.NewBatch(happyMock(), 1)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildBatchRequest(t, batchPart{"file", "budget.xlsx", readOnly}))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "manifest.json" {
+			continue
+		}
+		rc, _ := f.Open()
+		var m struct {
+			Entries []struct {
+				Status   string   `json:"status"`
+				Warnings []string `json:"warnings"`
+			} `json:"entries"`
+		}
+		_ = json.NewDecoder(rc).Decode(&m)
+		rc.Close()
+		if len(m.Entries) != 1 || m.Entries[0].Status != "succeeded" || len(m.Entries[0].Warnings) != 1 {
+			t.Errorf("expected a converted entry with a warning, got %+v", m.Entries)
+		}
+	}
+}
+
+func TestBatch_Watermark(t *testing.T) {
+	h := handler.NewBatch(pdfMock(), 2)
+	req := buildBatchRequest(t,
+		batchPart{"file", "a.docx", validDocxBody(256)},
+		batchPart{"file", "b.docx", validDocxBody(256)},
+		batchPart{"watermark_image", "stamp.png", pngImage(t)},
+	)
+	req.URL.RawQuery = "watermark=DRAFT"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	files, m := readBatchZip(t, rr.Body.Bytes())
+	if len(m.Entries) != 2 {
+		t.Fatalf("expected 2 manifest entries, got %+v", m.Entries)
+	}
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		if f := files[name]; !strings.Contains(f, "(DRAFT) Tj") || !strings.Contains(f, "/Im1 Do") {
+			t.Errorf("%s not watermarked", name)
+		}
+	}
+
+	// Rejected before any document is converted.
+	mc := pdfMock()
+	req = buildBatchRequest(t, batchPart{"file", "a.docx", validDocxBody(256)})
+	req.URL.RawQuery = "watermark=DRAFT&output=png"
+	rr = httptest.NewRecorder()
+	handler.NewBatch(mc, 1).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || len(mc.calls) != 0 {
+		t.Errorf("expected 400 without converting, got %d after %d calls", rr.Code, len(mc.calls))
+	}
+}
+
+func TestBatch_Metadata(t *testing.T) {
+	h := handler.NewBatch(pdfMock(), 2)
+	req := buildBatchRequest(t,
+		batchPart{"file", "a.docx", validDocxBody(256)},
+		batchPart{"file", "b.docx", validDocxBody(256)},
+	)
+	req.URL.RawQuery = "author=Acme+Legal&strip_metadata=true"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	files, _ := readBatchZip(t, rr.Body.Bytes())
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		if got := resultInfo(t, []byte(files[name]))["Author"]; got != "Acme Legal" {
+			t.Errorf("%s: Author %q", name, got)
+		}
+	}
+}
+
+func TestBatch_DuplicateNames(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		want   []string
+	}{
+		// The failed report.png keeps report-2.pdf, so the others' names do
+		// not depend on it failing.
+		{"", []string{"report.pdf", "", "report-3.pdf", "report-2-2.pdf", "Report-4.pdf"}},
+		{"directory", []string{"1/report.pdf", "", "3/report.pdf", "4/report-2.pdf", "5/Report.pdf"}},
+		{"index", []string{"1.pdf", "", "3.pdf", "4.pdf", "5.pdf"}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			h := handler.NewBatch(happyMock(), 2)
+			req := buildBatchRequest(t,
+				batchPart{"file", "report.docx", validDocxBody(256)},
+				batchPart{"file", "report.png", []byte("\x89PNG\r\n\x1a\n\x00")},
+				batchPart{"file", "report.txt", []byte("hello")},
+				batchPart{"file", "report-2.txt", []byte("hello")},
+				batchPart{"archive", "more.zip", zipOf(t, map[string][]byte{
+					"q3/Report.txt": []byte("hello"),
+				})},
+			)
+			req.URL.RawQuery = "duplicate_names=" + tc.policy
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			files, m := readBatchZip(t, rr.Body.Bytes())
+			if len(m.Entries) != len(tc.want) || len(files) != len(tc.want)-1 {
+				t.Fatalf("got %d entries and files %v", len(m.Entries), files)
+			}
+			for i, want := range tc.want {
+				if got := m.Entries[i].Output; got != want {
+					t.Errorf("entry %d (%s): output %q, want %q", i, m.Entries[i].Name, got, want)
+				}
+				if _, ok := files[want]; want != "" && !ok {
+					t.Errorf("%s missing from the archive", want)
+				}
+			}
+		})
+	}
+}
+
+func TestBatch_UnknownDuplicatePolicy(t *testing.T) {
+	h := handler.NewBatch(happyMock(), 1)
+	req := buildBatchRequest(t, batchPart{"file", "a.docx", validDocxBody(256)})
+	req.URL.RawQuery = "duplicate_names=overwrite"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	assertJSONError(t, rr.Body.String())
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"os"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/billing"
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// WithBilling records every successful conversion, synchronous, async or
+// batched, in m under the request's tenant.
+func WithBilling(m *billing.Meter) Option {
+	return func(h *Convert) { h.billing = m }
+}
+
+// bill records a successful conversion of inputPath into outPath. Pages are
+// counted for PDF results; a PNG is one page, and other formats have none.
+func (h *Convert) bill(tenant, inputPath, outPath, format string, d time.Duration) {
+	e := billing.Event{Tenant: tenant, Duration: d}
+	if info, err := os.Stat(inputPath); err == nil {
+		e.InputBytes = info.Size()
+	}
+	if f, err := os.Open(outPath); err == nil {
+		if info, err := f.Stat(); err == nil {
+			e.OutputBytes = info.Size()
+		}
+		switch format {
+		case "", converter.FormatPDF:
+			e.Pages, _ = billing.CountPDFPages(f)
+		case converter.FormatPNG:
+			e.Pages = 1
+		}
+		f.Close()
+	}
+	h.billing.Record(e)
+}
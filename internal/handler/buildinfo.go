@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/BRO3886/go-docpdf/internal/buildinfo"
+)
+
+// buildInfoBody is the GET /version response.
+type buildInfoBody struct {
+	buildinfo.Info
+	LibreOffice string `json:"libreoffice"`
+}
+
+// BuildInfo returns a handler for GET /version, reporting the running build
+// and libreoffice, the version string of the LibreOffice it converts with.
+// Both are fixed for the life of the process, so they are taken once.
+func BuildInfo(info buildinfo.Info, libreoffice string) http.HandlerFunc {
+	body := buildInfoBody{Info: info, LibreOffice: libreoffice}
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, body)
+	}
+}
@@ -0,0 +1,46 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/buildinfo"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+func TestBuildInfo(t *testing.T) {
+	info := buildinfo.Info{
+		Version:   "1.4.0",
+		Commit:    "4e25b37",
+		BuildTime: time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC),
+		GoVersion: "go1.24.0",
+	}
+	rr := httptest.NewRecorder()
+	handler.BuildInfo(info, "LibreOffice 7.6.4.1")(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rr.Body.String(), err)
+	}
+	want := map[string]any{
+		"version":     "1.4.0",
+		"commit":      "4e25b37",
+		"build_time":  "2026-10-15T09:30:00Z",
+		"go_version":  "go1.24.0",
+		"libreoffice": "LibreOffice 7.6.4.1",
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %v, want %v", k, body[k], v)
+		}
+	}
+	if _, ok := body["modified"]; ok {
+		t.Errorf("modified should be omitted for a clean build: %s", rr.Body.String())
+	}
+}
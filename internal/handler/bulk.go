@@ -0,0 +1,532 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/mailmerge"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+	"github.com/BRO3886/go-docpdf/internal/templates"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+)
+
+const (
+	// maxBulkRows caps the records of one bulk render.
+	maxBulkRows = 1000
+	// maxBulkName bounds the file name a row's name_field value gives its
+	// PDF, in bytes.
+	maxBulkName = 100
+	// bulkManifestName is the manifest entry written into every bulk ZIP.
+	bulkManifestName = "manifest.json"
+)
+
+// Bulk handles POST /render/bulk, mail merge to PDF: a template from the
+// library is filled with each record of an uploaded CSV or JSONL dataset and
+// every copy converted, as a job on the async queue. The job's result is a
+// ZIP of the PDFs plus a manifest.json, or with store=true the manifest of
+// where each PDF was written in the sink. One bad row does not fail the job.
+type Bulk struct {
+	c           *Convert
+	lib         *templates.Library
+	parallelism int
+}
+
+// NewBulk returns a Bulk handler rendering templates from lib on mgr,
+// converting up to parallelism rows of one job at a time. Options are shared
+// with Convert (WithSink enables store=true).
+func NewBulk(conv converter.Converter, mgr *jobs.Manager, lib *templates.Library, parallelism int, opts ...Option) *Bulk {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &Bulk{c: NewConvertAsync(conv, mgr, opts...), lib: lib, parallelism: parallelism}
+}
+
+// bulkRow is the manifest record, and the status, of one dataset row.
+type bulkRow struct {
+	// Row counts the dataset's records from 1.
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// MissingFields are the template fields the record has no value for.
+	MissingFields []string `json:"missing_fields,omitempty"`
+}
+
+func newBulkRow(i int, it jobs.Item) bulkRow {
+	row := bulkRow{Row: i + 1, Status: string(it.State), Output: it.Output, URL: it.URL, Error: it.Error}
+	if it.Detail != "" {
+		row.MissingFields = strings.Split(it.Detail, ",")
+	}
+	return row
+}
+
+// bulkResponse is the JSON representation of a bulk render job.
+type bulkResponse struct {
+	jobResponse
+	Total     int       `json:"total"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+	Rows      []bulkRow `json:"rows"`
+}
+
+// ServeHTTP implements http.Handler for POST /render/bulk. The multipart
+// request names the template_id (and optionally template_version, default
+// the latest) and carries the dataset as "data": CSV with a header row or
+// JSONL, told apart by data_format, the file name or the content. The
+// template's {{field}} placeholders must each be a column of the dataset.
+// name_field names a column whose values name the PDFs (default
+// row-<n>.pdf). It answers 202 with the job, whose rows are reported by GET
+// /render/bulk/{id}.
+func (h *Bulk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if serr := h.serve(w, r); serr != nil {
+		serr.write(w, r)
+	}
+}
+
+func (h *Bulk) serve(w http.ResponseWriter, r *http.Request) *stageError {
+	if serr := h.c.checkDisk(); serr != nil {
+		return serr
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseMultipartForm(maxFileSize); err != nil {
+		return fail(http.StatusBadRequest, "invalid bulk upload", "expected a multipart/form-data upload")
+	}
+	defer r.MultipartForm.RemoveAll()
+	tenant := tenantID(r)
+
+	if !h.c.policy.Allows(tenant, filetype.DOCX) {
+		serr := fail(http.StatusUnsupportedMediaType, "type not allowed", "document type not allowed")
+		serr.code = codeTypeNotAllowed
+		return serr
+	}
+	id := r.FormValue("template_id")
+	if id == "" {
+		return fail(http.StatusBadRequest, "missing template_id", "missing template_id")
+	}
+	version := 0
+	if v := r.FormValue("template_version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fail(http.StatusBadRequest, "invalid template_version", "invalid version")
+		}
+		version = n
+	}
+	tmpl, err := h.lib.Get(tenant, id)
+	if err != nil {
+		return templateError(err)
+	}
+	tmplPath, _, err := h.lib.File(tenant, id, version)
+	if err != nil {
+		return templateError(err)
+	}
+	doc, err := os.ReadFile(tmplPath)
+	if err != nil {
+		return fail(http.StatusNotFound, "template removed", "template not found")
+	}
+	doc = h.c.stripTemplate(doc)
+	fields, err := mailmerge.Fields(doc)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "internal error: read template: "+err.Error(), "internal error")
+	}
+
+	d, serr := readBulkDataset(r)
+	if serr != nil {
+		return serr
+	}
+	columns := make(map[string]bool, len(d.Columns))
+	for _, col := range d.Columns {
+		columns[col] = true
+	}
+	var absent []string
+	for _, f := range fields {
+		if !columns[f] {
+			absent = append(absent, f)
+		}
+	}
+	if len(absent) > 0 {
+		return fail(http.StatusBadRequest, "dataset lacks "+strings.Join(absent, ", "), "dataset has no column for a template field")
+	}
+	nameField := r.FormValue("name_field")
+	if nameField != "" && !columns[nameField] {
+		return fail(http.StatusBadRequest, "unknown name_field", "unknown name_field")
+	}
+
+	var store bool
+	if v := r.FormValue("store"); v != "" {
+		if store, err = strconv.ParseBool(v); err != nil {
+			return fail(http.StatusBadRequest, "invalid store", "store must be true or false")
+		}
+		if store && h.c.sink == nil {
+			return fail(http.StatusBadRequest, "store without a sink", "store is not supported")
+		}
+	}
+	pdfVersion, serr := h.c.pdfVersion(tenant, converter.FormatPDF, r.FormValue("target_pdf_version"))
+	if serr != nil {
+		return serr
+	}
+
+	dir, err := os.MkdirTemp("", tempclean.Pattern("bulk", middleware.RequestIDFromContext(r.Context())))
+	if err != nil {
+		return fail(http.StatusInternalServerError, "internal error: mkdirtemp", "internal error")
+	}
+	inputPath := filepath.Join(dir, "template"+filetype.DOCX.Ext)
+	if err := os.WriteFile(inputPath, doc, 0600); err != nil {
+		os.RemoveAll(dir)
+		return fail(http.StatusInternalServerError, "internal error: write template", "internal error")
+	}
+
+	var client string
+	if k, ok := auth.FromContext(r.Context()); ok {
+		client = k.Name
+	}
+	j := jobs.Job{
+		Dir:         dir,
+		InputPath:   inputPath,
+		DocType:     filetype.DOCX.Name,
+		Format:      converter.FormatPDF,
+		ContentType: "application/zip",
+		Disposition: dispositionAttachment,
+		Filename:    tmpl.Name + ".zip",
+		Client:      client,
+		Tenant:      tenant,
+		Traceparent: tracing.Traceparent(r.Context()),
+		InputSize:   int64(len(doc)),
+		Items:       make([]jobs.Item, len(d.Records)),
+	}
+	if store {
+		j.ContentType, j.Filename = "application/json", tmpl.Name+".json"
+	}
+	for i := range j.Items {
+		j.Items[i].State = jobs.StateQueued
+	}
+	opts := converter.Options{Format: converter.FormatPDF, PDFVersion: pdfVersion}
+	names := bulkNames(d.Records, nameField)
+	j, err = h.c.jobs.Submit(j, h.run(d.Records, names, store, opts, middleware.RequestIDFromContext(r.Context())))
+	if err != nil {
+		os.RemoveAll(dir)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			serr := fail(http.StatusServiceUnavailable, "job queue full", "server busy")
+			serr.outcome, serr.retryAfter = "rejected", queueRetryAfter
+			return serr
+		}
+		return fail(http.StatusInternalServerError, "internal error: submit job", "internal error")
+	}
+
+	middleware.SetOutcome(r.Context(), "success")
+	w.Header().Set("Location", "/render/bulk/"+j.ID)
+	writeJSON(w, http.StatusAccepted, h.response(w, r, j))
+	return nil
+}
+
+// readBulkDataset reads the request's "data" part.
+func readBulkDataset(r *http.Request) (*mailmerge.Dataset, *stageError) {
+	f, fh, err := r.FormFile("data")
+	if err != nil {
+		return nil, fail(http.StatusBadRequest, "missing data field", "missing data field")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	switch {
+	case err != nil:
+		return nil, fail(http.StatusBadRequest, "could not read data", "could not read file")
+	case len(data) > maxFileSize:
+		return nil, fail(http.StatusRequestEntityTooLarge, "dataset too large", "file too large")
+	}
+
+	format := strings.ToLower(r.FormValue("data_format"))
+	switch format {
+	case mailmerge.FormatCSV, mailmerge.FormatJSONL:
+	case "":
+		format = mailmerge.DetectFormat(fh.Filename, data)
+	default:
+		return nil, fail(http.StatusBadRequest, "invalid data_format", "invalid data_format")
+	}
+	d, err := mailmerge.ReadDataset(bytes.NewReader(data), format, maxBulkRows)
+	switch {
+	case err == nil:
+		return d, nil
+	case errors.Is(err, mailmerge.ErrEmptyDataset):
+		return nil, fail(http.StatusBadRequest, "empty dataset", "dataset has no rows")
+	case errors.Is(err, mailmerge.ErrTooManyRecords):
+		return nil, fail(http.StatusRequestEntityTooLarge, "dataset too long", "dataset has too many rows")
+	default:
+		return nil, fail(http.StatusBadRequest, err.Error(), "invalid dataset")
+	}
+}
+
+// templateError is writeTemplateError for stages.
+func templateError(err error) *stageError {
+	if errors.Is(err, templates.ErrNotFound) {
+		return fail(http.StatusNotFound, "template not found", "template not found")
+	}
+	return fail(http.StatusInternalServerError, "internal error: "+err.Error(), "internal error")
+}
+
+// run returns the job rendering each record, parallelism at a time, into a
+// directory of its own inside the job's, and reporting it as the job's item.
+// The job fails only when every row does. requestID is the submitting
+// request's, which the converter's workers report the rows under.
+func (h *Bulk) run(records []map[string]string, names []string, store bool, opts converter.Options, requestID string) jobs.RunFunc {
+	return func(ctx context.Context, j jobs.Job) (string, error) {
+		ctx = converter.WithRequestID(ctx, requestID)
+		doc, err := os.ReadFile(j.InputPath)
+		if err != nil {
+			return "", errors.New("template not found")
+		}
+		items := make([]jobs.Item, len(records))
+		paths := make([]string, len(records))
+		sem := make(chan struct{}, h.parallelism)
+		var wg sync.WaitGroup
+		for i, rec := range records {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				items[i], paths[i] = h.renderRow(ctx, j, doc, filepath.Join(j.Dir, strconv.Itoa(i)), rec, names[i], store, opts)
+				_ = h.c.jobs.SetItem(j.ID, i, items[i])
+			}()
+		}
+		wg.Wait()
+
+		succeeded := 0
+		rows := make([]bulkRow, len(items))
+		for i, it := range items {
+			rows[i] = newBulkRow(i, it)
+			if it.State == jobs.StateSucceeded {
+				succeeded++
+			}
+		}
+		if succeeded == 0 {
+			return "", errors.New("every row failed")
+		}
+		if store {
+			return writeBulkManifest(filepath.Join(j.Dir, "manifest.json"), rows)
+		}
+		return writeBulkZip(filepath.Join(j.Dir, "result.zip"), rows, paths)
+	}
+}
+
+// renderRow merges rec into the template, converts the copy inside dir and
+// returns the row's item, and for a ZIP the PDF's path.
+func (h *Bulk) renderRow(ctx context.Context, j jobs.Job, doc []byte, dir string, rec map[string]string, name string, store bool, opts converter.Options) (jobs.Item, string) {
+	it := jobs.Item{State: jobs.StateFailed}
+	merged, err := mailmerge.Merge(doc, rec)
+	if err != nil {
+		var missing *mailmerge.MissingFieldsError
+		if errors.As(err, &missing) {
+			it.Error, it.Detail = "no value for a template field", strings.Join(missing.Fields, ",")
+		} else {
+			it.Error = "conversion failed"
+		}
+		return it, ""
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		it.Error = "internal error"
+		return it, ""
+	}
+	inputPath := filepath.Join(dir, "input"+filetype.DOCX.Ext)
+	if err := os.WriteFile(inputPath, merged, 0600); err != nil {
+		it.Error = "internal error"
+		return it, ""
+	}
+
+	outPath, err := h.c.convert(ctx, j.Tenant, inputPath, dir, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, watchdog.ErrMemoryPressure):
+		it.Error = "server busy"
+		return it, ""
+	case errors.Is(err, context.Canceled):
+		it.Error = "request cancelled"
+		return it, ""
+	case errors.Is(err, converter.ErrTimeout):
+		it.Error = "conversion timed out"
+		return it, ""
+	case errors.Is(err, converter.ErrResourceLimit):
+		it.Error = "conversion exceeded a resource limit"
+		return it, ""
+	case errors.Is(err, converter.ErrNoOutput):
+		it.Error = "conversion produced no output"
+		return it, ""
+	default:
+		it.Error = "conversion failed"
+		return it, ""
+	}
+	os.Remove(inputPath)
+
+	if !store {
+		it.State, it.Output = jobs.StateSucceeded, name
+		return it, outPath
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		it.Error = "internal error"
+		return it, ""
+	}
+	loc, err := h.c.sink.Put(ctx, j.ID+"/"+name, data, converter.ContentType(converter.FormatPDF))
+	os.RemoveAll(dir)
+	if err != nil {
+		it.Error = "could not store result"
+		return it, ""
+	}
+	it.State, it.Output, it.URL = jobs.StateSucceeded, loc.Key, loc.URL
+	return it, ""
+}
+
+// writeBulkZip writes the rows' PDFs and the manifest to path, removing
+// each PDF once it is in the archive.
+func writeBulkZip(path string, rows []bulkRow, paths []string) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", errors.New("internal error")
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for i, p := range paths {
+		if p == "" {
+			continue
+		}
+		if err := addZipFile(zw, rows[i].Output, p); err != nil {
+			return "", errors.New("internal error")
+		}
+		os.RemoveAll(filepath.Dir(p))
+	}
+	mf, err := zw.Create(bulkManifestName)
+	if err == nil {
+		err = json.NewEncoder(mf).Encode(map[string]any{"rows": rows})
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return "", errors.New("internal error")
+	}
+	return path, f.Close()
+}
+
+func addZipFile(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// writeBulkManifest writes the manifest of a stored bulk render to path.
+func writeBulkManifest(path string, rows []bulkRow) (string, error) {
+	data, err := json.Marshal(map[string]any{"rows": rows})
+	if err != nil {
+		return "", errors.New("internal error")
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", errors.New("internal error")
+	}
+	return path, nil
+}
+
+// bulkNames returns the file name of each record's PDF: the value of
+// nameField, cleaned up for use as a file name, or row-<n>. Names repeated
+// get -2, -3, … appended.
+func bulkNames(records []map[string]string, nameField string) []string {
+	names := make([]string, len(records))
+	seen := make(map[string]bool, len(records))
+	for i, rec := range records {
+		base := ""
+		if nameField != "" {
+			base = cleanName(rec[nameField])
+		}
+		if base == "" {
+			base = "row-" + strconv.Itoa(i+1)
+		}
+		name := base + ".pdf"
+		for n := 2; seen[strings.ToLower(name)]; n++ {
+			name = base + "-" + strconv.Itoa(n) + ".pdf"
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// cleanName replaces path separators, characters Windows forbids in file
+// names and control characters with '_', and trims the result to
+// maxBulkName bytes.
+func cleanName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, " .")
+	for len(s) > maxBulkName {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return strings.TrimRight(s, " .")
+}
+
+// Status handles GET /render/bulk/{id}: the job, and the status of each of
+// its rows. Another caller's job is not found.
+func (h *Bulk) Status(w http.ResponseWriter, r *http.Request) {
+	j, err := h.c.jobs.Get(r.PathValue("id"))
+	if err != nil || j.Items == nil || !owns(r, j) {
+		if err == nil || errors.Is(err, jobs.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "job not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.response(w, r, j))
+}
+
+func (h *Bulk) response(w http.ResponseWriter, r *http.Request, j jobs.Job) bulkResponse {
+	resp := bulkResponse{jobResponse: newJobResponse(j), Total: len(j.Items), Rows: make([]bulkRow, len(j.Items))}
+	for i, it := range j.Items {
+		row := newBulkRow(i, it)
+		switch it.State {
+		case jobs.StateSucceeded:
+			resp.Succeeded++
+		case jobs.StateFailed:
+			resp.Failed++
+			row.Error = i18n.Localize(w, r, row.Error)
+		}
+		resp.Rows[i] = row
+	}
+	if resp.Error != "" {
+		resp.Error = i18n.Localize(w, r, resp.Error)
+	}
+	return resp
+}
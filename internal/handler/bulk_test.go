@@ -0,0 +1,321 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/sink"
+	"github.com/BRO3886/go-docpdf/internal/templates"
+)
+
+// letterTemplate is a DOCX whose body is "Dear {{name}}, you owe {{amount}}.",
+// with the first placeholder split across runs as Word stores it.
+func letterTemplate(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", "<Types/>"},
+		{"word/document.xml", `<w:document><w:body><w:p><w:r><w:t>Dear {{</w:t></w:r><w:r><w:t>name}}, you owe {{amount}}.</w:t></w:r></w:p></w:body></w:document>`},
+	} {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(part.content))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// mergeMock "converts" a merged letter to a PDF holding its document text.
+func mergeMock() *mockConverter {
+	return &mockConverter{
+		callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+			zr, err := zip.OpenReader(inputPath)
+			if err != nil {
+				return "", err
+			}
+			defer zr.Close()
+			var text string
+			for _, f := range zr.File {
+				if f.Name == "word/document.xml" {
+					rc, _ := f.Open()
+					b, _ := io.ReadAll(rc)
+					rc.Close()
+					text = string(b)
+				}
+			}
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			return pdfPath, os.WriteFile(pdfPath, []byte("%PDF-1.4 "+text), 0600)
+		},
+	}
+}
+
+type bulkFixture struct {
+	mux      *http.ServeMux
+	template templates.Template
+}
+
+// newBulkFixture serves POST /render/bulk and the job endpoints, with the
+// letter template stored for tenant acme.
+func newBulkFixture(t *testing.T, opts ...handler.Option) bulkFixture {
+	t.Helper()
+	lib, err := templates.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := lib.Create("acme", "letter", letterTemplate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	t.Cleanup(mgr.Close)
+
+	bulk := handler.NewBulk(mergeMock(), mgr, lib, 2, opts...)
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("POST /render/bulk", bulk)
+	mux.HandleFunc("GET /render/bulk/{id}", bulk.Status)
+	mux.HandleFunc("GET /jobs/{id}/result", jh.Result)
+	mux.HandleFunc("GET /jobs/{id}/results", jh.Results)
+	mux.HandleFunc("GET /jobs/{id}/results/{index}", jh.ResultEntry)
+	return bulkFixture{mux: mux, template: tmpl}
+}
+
+// bulkRequest builds a POST /render/bulk for tenant acme with the dataset
+// as "data" (named filename) and the given fields.
+func bulkRequest(t *testing.T, filename, data string, fields map[string]string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("data", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(data))
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/render/bulk", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-Tenant-ID", "acme")
+	return req
+}
+
+type bulkStatus struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	ResultURL string `json:"result_url"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Rows      []struct {
+		Row           int      `json:"row"`
+		Status        string   `json:"status"`
+		Output        string   `json:"output"`
+		URL           string   `json:"url"`
+		Error         string   `json:"error"`
+		MissingFields []string `json:"missing_fields"`
+	} `json:"rows"`
+}
+
+// tenantGet returns a GET of target by the tenant bulkRequest submits for,
+// which alone can see its jobs.
+func tenantGet(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	return req
+}
+
+// submitBulk submits req and polls the job until it finishes.
+func (f bulkFixture) submitBulk(t *testing.T, req *http.Request) bulkStatus {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body)
+	}
+	var st bulkStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Location") != "/render/bulk/"+st.ID || st.Total == 0 || len(st.Rows) != st.Total {
+		t.Fatalf("submitted %+v, Location %q", st, rr.Header().Get("Location"))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for st.Status != "succeeded" && st.Status != "failed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never finished, last status %q", st.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		f.mux.ServeHTTP(rr, tenantGet("/render/bulk/"+st.ID))
+		_ = json.Unmarshal(rr.Body.Bytes(), &st)
+	}
+	return st
+}
+
+func TestBulk_RendersZip(t *testing.T) {
+	f := newBulkFixture(t)
+	data := "name,amount\nAda,10\nGrace,20\nAda,30\n"
+	st := f.submitBulk(t, bulkRequest(t, "people.csv", data, map[string]string{
+		"template_id": f.template.ID,
+		"name_field":  "name",
+	}))
+	if st.Status != "succeeded" || st.Succeeded != 3 || st.Failed != 0 {
+		t.Fatalf("status %+v", st)
+	}
+	var outputs []string
+	for _, row := range st.Rows {
+		outputs = append(outputs, row.Output)
+	}
+	if want := []string{"Ada.pdf", "Grace.pdf", "Ada-2.pdf"}; !slices.Equal(outputs, want) {
+		t.Errorf("outputs %v, want %v", outputs, want)
+	}
+
+	rr := httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/render/bulk/"+st.ID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("another tenant's status: %d, want 404", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, tenantGet(st.ResultURL))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("result: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=letter.zip" {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, zf := range zr.File {
+		rc, _ := zf.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		got[zf.Name] = string(b)
+	}
+	for name, want := range map[string]string{
+		"Ada.pdf":   "Dear Ada, you owe 10.",
+		"Grace.pdf": "Dear Grace, you owe 20.",
+		"Ada-2.pdf": "Dear Ada, you owe 30.",
+	} {
+		if text := strings.NewReplacer(`<w:t xml:space="preserve">`, "", "</w:t>", "", "<w:r>", "", "</w:r>", "").Replace(got[name]); !strings.Contains(text, want) {
+			t.Errorf("%s: %q lacks %q", name, got[name], want)
+		}
+	}
+	if !strings.Contains(got["manifest.json"], `"output":"Grace.pdf"`) {
+		t.Errorf("manifest %s", got["manifest.json"])
+	}
+}
+
+func TestBulk_RowFailures(t *testing.T) {
+	f := newBulkFixture(t)
+	data := `{"name":"Ada","amount":10}` + "\n" + `{"name":"Grace"}` + "\n"
+	st := f.submitBulk(t, bulkRequest(t, "people.jsonl", data, map[string]string{"template_id": f.template.ID}))
+	if st.Status != "succeeded" || st.Succeeded != 1 || st.Failed != 1 {
+		t.Fatalf("status %+v", st)
+	}
+	if row := st.Rows[0]; row.Status != "succeeded" || row.Output != "row-1.pdf" {
+		t.Errorf("row 1 %+v", row)
+	}
+	if row := st.Rows[1]; row.Row != 2 || row.Status != "failed" || row.Error != "no value for a template field" || !slices.Equal(row.MissingFields, []string{"amount"}) {
+		t.Errorf("row 2 %+v", row)
+	}
+
+	// A job whose every row fails fails.
+	st = f.submitBulk(t, bulkRequest(t, "people.jsonl", `{"name":"Ada"}`+"\n"+`{"amount":1}`+"\n", map[string]string{"template_id": f.template.ID}))
+	if st.Status != "failed" || st.Error != "every row failed" || st.Failed != 2 {
+		t.Errorf("status %+v", st)
+	}
+}
+
+func TestBulk_Store(t *testing.T) {
+	dir := t.TempDir()
+	f := newBulkFixture(t, handler.WithSink(sink.NewDir(dir, "https://files.example.com")))
+	st := f.submitBulk(t, bulkRequest(t, "people.csv", "name,amount\nAda,10\n", map[string]string{
+		"template_id": f.template.ID,
+		"store":       "true",
+	}))
+	if st.Status != "succeeded" {
+		t.Fatalf("status %+v", st)
+	}
+	row := st.Rows[0]
+	if row.Output != st.ID+"/row-1.pdf" || row.URL != "https://files.example.com/"+st.ID+"/row-1.pdf" {
+		t.Errorf("row %+v", row)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, st.ID, "row-1.pdf")); err != nil || !bytes.HasPrefix(b, []byte("%PDF")) {
+		t.Errorf("stored PDF: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, tenantGet(st.ResultURL))
+	if rr.Header().Get("Content-Type") != "application/json" || !strings.Contains(rr.Body.String(), `"url":"https://files.example.com/`) {
+		t.Errorf("result %s: %s", rr.Header().Get("Content-Type"), rr.Body)
+	}
+}
+
+func TestBulk_Rejected(t *testing.T) {
+	f := newBulkFixture(t)
+	csv := "name,amount\nAda,10\n"
+	id := f.template.ID
+	for _, tc := range []struct {
+		name     string
+		filename string
+		data     string
+		fields   map[string]string
+		tenant   string
+		want     int
+	}{
+		{"no template_id", "a.csv", csv, nil, "", http.StatusBadRequest},
+		{"unknown template", "a.csv", csv, map[string]string{"template_id": "nope"}, "", http.StatusNotFound},
+		{"other tenant", "a.csv", csv, map[string]string{"template_id": id}, "globex", http.StatusNotFound},
+		{"unknown version", "a.csv", csv, map[string]string{"template_id": id, "template_version": "2"}, "", http.StatusNotFound},
+		{"invalid version", "a.csv", csv, map[string]string{"template_id": id, "template_version": "x"}, "", http.StatusBadRequest},
+		{"missing column", "a.csv", "name\nAda\n", map[string]string{"template_id": id}, "", http.StatusBadRequest},
+		{"empty dataset", "a.csv", "name,amount\n", map[string]string{"template_id": id}, "", http.StatusBadRequest},
+		{"invalid dataset", "a.jsonl", "[1]\n", map[string]string{"template_id": id}, "", http.StatusBadRequest},
+		{"invalid data_format", "a.csv", csv, map[string]string{"template_id": id, "data_format": "xlsx"}, "", http.StatusBadRequest},
+		{"unknown name_field", "a.csv", csv, map[string]string{"template_id": id, "name_field": "email"}, "", http.StatusBadRequest},
+		{"store without sink", "a.csv", csv, map[string]string{"template_id": id, "store": "true"}, "", http.StatusBadRequest},
+		{"too many rows", "a.csv", "name,amount\n" + strings.Repeat("Ada,1\n", 1001), map[string]string{"template_id": id}, "", http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := bulkRequest(t, tc.filename, tc.data, tc.fields)
+			if tc.tenant != "" {
+				req.Header.Set("X-Tenant-ID", tc.tenant)
+			}
+			rr := httptest.NewRecorder()
+			f.mux.ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Errorf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body)
+			}
+		})
+	}
+
+	// Only bulk jobs have rows to report.
+	rr := httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/render/bulk/nope", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown job: expected 404, got %d", rr.Code)
+	}
+}
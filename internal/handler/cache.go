@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/cache"
+)
+
+// Results reported for cache lookups.
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// WithCache answers synchronous conversions of a document already converted
+// with the same options from c, and stores new results in it. observe, if
+// non-nil, is called with "hit" or "miss" for each lookup. Async jobs bypass
+// the cache.
+func WithCache(c *cache.Cache, observe func(result string)) Option {
+	return func(h *Convert) {
+		h.cache = c
+		h.onCache = observe
+	}
+}
+
+// affinityHeader carries a document's affinity key (cache.AffinityKey) on
+// responses, and on requests for load balancers to hash on.
+const affinityHeader = "X-Affinity-Key"
+
+// WithAffinity sets the X-Affinity-Key header on synchronous conversion
+// responses to the uploaded document's cache.AffinityKey. Clients send it
+// back on later uploads of the document (or compute it themselves), and a
+// load balancer hashing on the header routes them all to one replica,
+// whose cache then holds the results. cookie, if not empty, also sets the
+// key as a cookie of that name, for balancers that only hash on cookies.
+func WithAffinity(cookie string) Option {
+	return func(h *Convert) {
+		h.affinity = true
+		h.affinityCookie = cookie
+	}
+}
+
+// setAffinity sets the affinity key of the upload, as received, on the
+// response.
+func (h *Convert) setAffinity(w http.ResponseWriter, c *conversion) {
+	if !h.affinity || h.jobs != nil {
+		return
+	}
+	f, err := os.Open(c.inputPath)
+	if err != nil {
+		return
+	}
+	key, err := cache.AffinityKey(f)
+	f.Close()
+	if err != nil {
+		return
+	}
+	w.Header().Set(affinityHeader, key)
+	if h.affinityCookie != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name: h.affinityCookie, Value: key, Path: "/",
+			MaxAge: int((24 * time.Hour).Seconds()), HttpOnly: true, SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// lookup loads a cached result for c into c.out and reports whether there
+// was one. On a miss it leaves c.cacheKey set so postProcess stores the
+// result. The X-Cache header tells the client which happened.
+//
+// Password-protected results are never cached: they would sit in memory
+// under a key derived from the password. Nor are post-processed ones, which
+// the key does not describe.
+func (h *Convert) lookup(w http.ResponseWriter, c *conversion) bool {
+	if h.cache == nil || c.opts.Encrypted() || len(c.post) > 0 {
+		return false
+	}
+	f, err := os.Open(c.inputPath)
+	if err != nil {
+		return false
+	}
+	key, err := cache.KeyReader(f, c.opts)
+	f.Close()
+	if err != nil {
+		return false
+	}
+	out, ok := h.cache.Get(key)
+	result, header := cacheMiss, "MISS"
+	if ok {
+		result, header = cacheHit, "HIT"
+		c.out = out
+	} else {
+		c.cacheKey = key
+	}
+	if h.onCache != nil {
+		h.onCache(result)
+	}
+	w.Header().Set("X-Cache", header)
+	return ok
+}
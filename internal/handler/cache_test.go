@@ -0,0 +1,131 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/cache"
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+func TestConvert_CachesResults(t *testing.T) {
+	mc := happyMock()
+	var lookups []string
+	h := handler.NewConvert(mc, handler.WithCache(cache.New(1<<20), func(result string) {
+		lookups = append(lookups, result)
+	}))
+	doc := validDocxBody(1024)
+
+	for i, want := range []string{"MISS", "HIT"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, buildRequest(t, doc))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+		if rr.Body.String() != "%PDF-1.4 fake" {
+			t.Errorf("request %d: body = %q", i, rr.Body.String())
+		}
+	}
+	if len(mc.calls) != 1 {
+		t.Errorf("converter called %d times, want 1", len(mc.calls))
+	}
+	if want := []string{"miss", "hit"}; !slices.Equal(lookups, want) {
+		t.Errorf("lookups = %v, want %v", lookups, want)
+	}
+}
+
+func TestConvert_CacheKeyedByOptions(t *testing.T) {
+	mc := happyMock()
+	h := handler.NewConvert(mc, handler.WithCache(cache.New(1<<20), nil))
+	doc := validDocxBody(1024)
+
+	h.ServeHTTP(httptest.NewRecorder(), buildRequest(t, doc))
+	req := buildRequest(t, doc)
+	req.URL.RawQuery = "output=txt"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("X-Cache = %q, want MISS for a different output format", got)
+	}
+	if len(mc.calls) != 2 {
+		t.Errorf("converter called %d times, want 2", len(mc.calls))
+	}
+}
+
+func TestConvert_FailedConversionNotCached(t *testing.T) {
+	c := cache.New(1 << 20)
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, _, _ string) (string, error) {
+			return "", converter.ErrTimeout
+		},
+	}
+	h := handler.NewConvert(mc, handler.WithCache(c, nil))
+	h.ServeHTTP(httptest.NewRecorder(), buildRequest(t, validDocxBody(1024)))
+
+	if c.Len() != 0 {
+		t.Errorf("cache holds %d results after a failed conversion", c.Len())
+	}
+}
+
+func TestConvert_EncryptedNotCached(t *testing.T) {
+	c := cache.New(1 << 20)
+	mc := happyMock()
+	h := handler.NewConvert(mc, handler.WithCache(c, nil))
+	doc := validDocxBody(1024)
+
+	for range 2 {
+		req := buildRequest(t, doc)
+		req.URL.RawQuery = "user_password=open-sesame"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(mc.calls) != 2 {
+		t.Errorf("converter called %d times, want 2", len(mc.calls))
+	}
+	if c.Len() != 0 {
+		t.Errorf("cache holds %d encrypted results", c.Len())
+	}
+}
+
+func TestConvert_Affinity(t *testing.T) {
+	h := handler.NewConvert(happyMock(), handler.WithAffinity("docpdf_affinity"))
+	send := func(doc []byte, query string) *httptest.ResponseRecorder {
+		req := buildRequest(t, doc)
+		req.URL.RawQuery = query
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+	doc := validDocxBody(1024)
+	rr := send(doc, "")
+	key := rr.Header().Get("X-Affinity-Key")
+	if len(key) != 32 {
+		t.Fatalf("X-Affinity-Key = %q", key)
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != "docpdf_affinity" || cookies[0].Value != key {
+		t.Errorf("cookies = %v", cookies)
+	}
+	// The key follows the document, whatever the options.
+	if got := send(doc, "output=txt").Header().Get("X-Affinity-Key"); got != key {
+		t.Errorf("same document, other options: key %q, want %q", got, key)
+	}
+	if got := send(validDocxBody(2048), "").Header().Get("X-Affinity-Key"); got == key {
+		t.Error("different documents share a key")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.NewConvert(happyMock()).ServeHTTP(rr, buildRequest(t, doc))
+	if got := rr.Header().Get("X-Affinity-Key"); got != "" {
+		t.Errorf("X-Affinity-Key = %q without WithAffinity", got)
+	}
+}
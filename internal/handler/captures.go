@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/capture"
+)
+
+// Limits of POST /admin/captures.
+const (
+	maxCaptureBody  = 4 << 10
+	maxCaptureCount = 100
+)
+
+// Captures serves the admin endpoints arming and reading request captures.
+type Captures struct {
+	rec *capture.Recorder
+}
+
+// NewCaptures returns a Captures handler backed by rec.
+func NewCaptures(rec *capture.Recorder) *Captures {
+	return &Captures{rec: rec}
+}
+
+// armRequest is the JSON body of POST /admin/captures.
+type armRequest struct {
+	capture.Target
+	Count int `json:"count"`
+}
+
+// Arm handles POST /admin/captures: it captures the next count requests
+// (1 to 100) made with the API key named client, for tenant, or both,
+// replacing any capture armed for the same ones; count 0 disarms it. The
+// response is 201 with the arming.
+func (h *Captures) Arm(w http.ResponseWriter, r *http.Request) {
+	var req armRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCaptureBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid capture body")
+		return
+	}
+	if req.Client == "" && req.Tenant == "" {
+		writeError(w, r, http.StatusBadRequest, "client or tenant is required")
+		return
+	}
+	if req.Count < 0 || req.Count > maxCaptureCount {
+		writeError(w, r, http.StatusBadRequest, "count must be from 0 to 100")
+		return
+	}
+	a, err := h.rec.Arm(req.Target, req.Count, time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+// List handles GET /admin/captures: the armed captures, and the requests
+// captured, newest first. ?client= and ?tenant= filter them.
+func (h *Captures) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := capture.Target{Client: q.Get("client"), Tenant: q.Get("tenant")}
+	armed := []capture.Arming{}
+	for _, a := range h.rec.Armed(time.Now()) {
+		if (f.Client == "" || a.Client == f.Client) && (f.Tenant == "" || a.Tenant == f.Tenant) {
+			armed = append(armed, a)
+		}
+	}
+	caps := h.rec.List(f)
+	if caps == nil {
+		caps = []capture.Capture{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"armed": armed, "captures": caps})
+}
+
+// Body handles GET /admin/captures/{id}/body: the captured body as the
+// client sent it, with its Content-Type, for replaying the request.
+func (h *Captures) Body(w http.ResponseWriter, r *http.Request) {
+	c, f, err := h.rec.Open(r.PathValue("id"))
+	switch {
+	case errors.Is(err, capture.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "capture not found")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	defer f.Close()
+	if ct := c.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(c.Size, 10))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+c.ID+`.body"`)
+	io.Copy(w, f)
+}
+
+// Delete handles DELETE /admin/captures/{id}.
+func (h *Captures) Delete(w http.ResponseWriter, r *http.Request) {
+	switch err := h.rec.Delete(r.PathValue("id")); {
+	case errors.Is(err, capture.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "capture not found")
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,92 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/capture"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func TestCaptures_ArmCaptureAndReplay(t *testing.T) {
+	rec, err := capture.New(capture.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := handler.NewCaptures(rec)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/captures", ch.Arm)
+	mux.HandleFunc("GET /admin/captures", ch.List)
+	mux.HandleFunc("GET /admin/captures/{id}/body", ch.Body)
+	mux.HandleFunc("DELETE /admin/captures/{id}", ch.Delete)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/captures", strings.NewReader(`{"tenant":"acme","count":1}`)))
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"remaining":1`) {
+		t.Fatalf("arm: %d %s", rr.Code, rr.Body)
+	}
+
+	app := middleware.Capture(rec, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad multipart", http.StatusBadRequest)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/convert", strings.NewReader("--x\r\nbroken"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	req.Header.Set("X-Tenant-ID", "acme")
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/captures?tenant=acme", nil))
+	var list struct {
+		Armed    []capture.Arming  `json:"armed"`
+		Captures []capture.Capture `json:"captures"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body)
+	}
+	if len(list.Armed) != 0 || len(list.Captures) != 1 || list.Captures[0].Status != http.StatusBadRequest {
+		t.Fatalf("unexpected list %+v", list)
+	}
+	id := list.Captures[0].ID
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/captures/"+id+"/body", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "" || rr.Header().Get("Content-Type") != "multipart/form-data; boundary=x" {
+		t.Errorf("body: %d %q %q", rr.Code, rr.Body, rr.Header().Get("Content-Type"))
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/admin/captures/"+id, nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("delete: %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/captures/"+id+"/body", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("deleted body: %d", rr.Code)
+	}
+}
+
+func TestCaptures_ArmErrors(t *testing.T) {
+	rec, err := capture.New(capture.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := handler.NewCaptures(rec)
+	for _, body := range []string{
+		`{"count":1}`,
+		`{"client":"sap","count":101}`,
+		`{"client":"sap","count":-1}`,
+		`{"client":"sap","cnt":1}`,
+		`not json`,
+	} {
+		rr := httptest.NewRecorder()
+		ch.Arm(rr, httptest.NewRequest(http.MethodPost, "/admin/captures", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+}
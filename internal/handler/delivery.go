@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// Content-Disposition values accepted in the "disposition" parameter.
+const (
+	dispositionInline     = "inline"
+	dispositionAttachment = "attachment"
+)
+
+// delivery describes how a conversion result is presented to the client:
+// which Content-Type it is labelled with and whether browsers should display
+// it inline or download it.
+type delivery struct {
+	contentType string
+	disposition string // "" leaves Content-Disposition unset
+	filename    string
+	store       bool // write the result to the sink instead of the response
+}
+
+// parseDelivery reads the "disposition", "content_type" and "store"
+// parameters. store is only accepted by synchronous handlers with a sink. The
+// content type may only be overridden with application/octet-stream or
+// another media type of the same top-level type as the output format (e.g.
+// application/x-pdf for PDF), so an override cannot turn a result into
+// something a browser would execute.
+func (h *Convert) parseDelivery(r *http.Request, format, uploadName string) (delivery, *stageError) {
+	d := delivery{
+		contentType: converter.ContentType(format),
+		filename:    resultFilename(uploadName, format),
+	}
+
+	switch disp := strings.ToLower(h.param(r, "disposition")); disp {
+	case "":
+	case dispositionInline, dispositionAttachment:
+		d.disposition = disp
+	default:
+		return delivery{}, fail(http.StatusBadRequest, "invalid disposition", "disposition must be inline or attachment")
+	}
+
+	if ct := h.param(r, "content_type"); ct != "" {
+		if !allowedContentType(ct, d.contentType) {
+			return delivery{}, fail(http.StatusBadRequest, "invalid content_type override", "content_type override not allowed")
+		}
+		d.contentType = ct
+	}
+
+	if v := h.param(r, "store"); v != "" {
+		store, err := strconv.ParseBool(v)
+		if err != nil {
+			return delivery{}, fail(http.StatusBadRequest, "invalid store", "store must be true or false")
+		}
+		if store && (h.sink == nil || h.jobs != nil) {
+			return delivery{}, fail(http.StatusBadRequest, "store without a sink", "store is not supported")
+		}
+		d.store = store
+	}
+
+	return d, nil
+}
+
+// allowedContentType reports whether override may replace the format's
+// default media type def.
+func allowedContentType(override, def string) bool {
+	mt, _, err := mime.ParseMediaType(override)
+	if err != nil {
+		return false
+	}
+	if mt == "application/octet-stream" {
+		return true
+	}
+	defType, _, _ := mime.ParseMediaType(def)
+	major := func(s string) string { return s[:strings.IndexByte(s, '/')] }
+	return major(mt) == major(defType) && mt != "text/html" && !strings.Contains(mt, "javascript")
+}
+
+// send writes the result in content to w with the delivery's headers. It is
+// streamed rather than loaded, and http.ServeContent sets Content-Length and
+// answers Range requests, so clients can fetch a large result in pieces or
+// resume an interrupted download. A non-zero modtime is sent as
+// Last-Modified for conditional requests.
+func (d delivery) send(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, modtime time.Time) {
+	w.Header().Set("Content-Type", d.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if d.disposition != "" {
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType(d.disposition, map[string]string{"filename": d.filename}))
+	}
+	http.ServeContent(w, r, d.filename, modtime, content)
+}
+
+// resultFilename derives the download name from the uploaded filename with
+// its extension replaced by the output format. Directory components are
+// dropped; an unnamed upload becomes "document".
+func resultFilename(uploadName, format string) string {
+	base := filepath.Base(strings.ReplaceAll(uploadName, `\`, "/"))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if base == "" || base == "." || base == "/" {
+		base = "document"
+	}
+	return base + "." + format
+}
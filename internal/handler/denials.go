@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+)
+
+// Limits of GET /admin/denials.
+const (
+	defaultDenialLimit = 100
+	maxDenialLimit     = 1000
+)
+
+// Denials serves the admin access decision audit.
+type Denials struct {
+	log *audit.Log
+}
+
+// NewDenials returns a Denials handler backed by log.
+func NewDenials(log *audit.Log) *Denials {
+	return &Denials{log: log}
+}
+
+// List handles GET /admin/denials: the denied requests kept, newest first,
+// up to ?limit= of them (default 100, at most 1000). ?client=, ?tenant=,
+// ?ip=, ?policy= and ?reason= filter them, and ?since= drops those older
+// than an RFC 3339 time or a duration ago, e.g. "15m".
+func (h *Denials) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Client: q.Get("client"),
+		Tenant: q.Get("tenant"),
+		IP:     q.Get("ip"),
+		Policy: q.Get("policy"),
+		Reason: q.Get("reason"),
+		Limit:  defaultDenialLimit,
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDenialLimit {
+			writeError(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		f.Limit = n
+	}
+	if v := q.Get("since"); v != "" {
+		since, ok := parseSince(v, time.Now())
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "since must be a time or a duration")
+			return
+		}
+		f.Since = since
+	}
+	recs := h.log.List(f)
+	if recs == nil {
+		recs = []audit.Record{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"denials": recs})
+}
+
+// parseSince parses an RFC 3339 time, or a positive duration before now.
+func parseSince(v string, now time.Time) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return time.Time{}, false
+	}
+	return now.Add(-d), true
+}
@@ -0,0 +1,96 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func TestConvert_AuditsTypeDenial(t *testing.T) {
+	policy, err := filetype.ParsePolicy("docx,odt", "acme=odt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := audit.NewLog(10)
+	h := middleware.RequestID(middleware.Audit(log, metrics.New(), handler.NewConvert(happyMock(), handler.WithPolicy(policy))))
+	req := buildRequest(t, validDocxBody(512))
+	req.Header.Set("X-Tenant-ID", "acme")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rr.Code)
+	}
+	recs := log.List(audit.Filter{})
+	if len(recs) != 1 {
+		t.Fatalf("records %+v", recs)
+	}
+	if rec := recs[0]; rec.Tenant != "acme" || rec.Policy != audit.PolicyTypes || rec.Reason != audit.ReasonTypeNotAllowed || rec.Detail != "docx" {
+		t.Errorf("record %+v", rec)
+	}
+}
+
+func TestDenials_List(t *testing.T) {
+	log := audit.NewLog(10)
+	now := time.Now()
+	log.Add(audit.Record{Time: now.Add(-time.Hour), Client: "acme", IP: "10.0.0.1",
+		Denial: audit.Denial{Status: http.StatusTooManyRequests, Policy: audit.PolicyRateLimit, Reason: audit.ReasonRateLimited}})
+	log.Add(audit.Record{Time: now.Add(-time.Minute), Client: "acme", IP: "10.0.0.1",
+		Denial: audit.Denial{Status: http.StatusForbidden, Policy: audit.PolicyAPIKey, Reason: audit.ReasonKeyExpired}})
+	log.Add(audit.Record{Time: now, IP: "10.0.0.2",
+		Denial: audit.Denial{Status: http.StatusUnauthorized, Policy: audit.PolicyAPIKey, Reason: audit.ReasonInvalidKey}})
+	h := handler.NewDenials(log)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{audit.ReasonInvalidKey, audit.ReasonKeyExpired, audit.ReasonRateLimited}},
+		{"client=acme", []string{audit.ReasonKeyExpired, audit.ReasonRateLimited}},
+		{"policy=api_key&ip=10.0.0.1", []string{audit.ReasonKeyExpired}},
+		{"reason=rate_limited", []string{audit.ReasonRateLimited}},
+		{"since=10m", []string{audit.ReasonInvalidKey, audit.ReasonKeyExpired}},
+		{"since=" + now.Add(-30*time.Second).UTC().Format(time.RFC3339), []string{audit.ReasonInvalidKey}},
+		{"limit=1", []string{audit.ReasonInvalidKey}},
+		{"tenant=none", nil},
+	} {
+		rr := httptest.NewRecorder()
+		h.List(rr, httptest.NewRequest(http.MethodGet, "/admin/denials?"+tc.query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d: %s", tc.query, rr.Code, rr.Body.String())
+		}
+		var body struct{ Denials []audit.Record }
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Denials == nil {
+			t.Fatalf("%q: body %s", tc.query, rr.Body.String())
+		}
+		var got []string
+		for _, rec := range body.Denials {
+			got = append(got, rec.Reason)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%q: reasons %v, want %v", tc.query, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%q: reasons %v, want %v", tc.query, got, tc.want)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"limit=0", "limit=5000", "since=yesterday", "since=-5m"} {
+		rr := httptest.NewRecorder()
+		h.List(rr, httptest.NewRequest(http.MethodGet, "/admin/denials?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rr.Code)
+		}
+	}
+}
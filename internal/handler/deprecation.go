@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deprecation describes an endpoint, parameter or API version that still
+// works but is going away. Requests using it are answered as usual, with a
+// Deprecation header (RFC 9745), a Sunset header (RFC 8594) once a removal
+// date is set, a Link to the migration notes and a Warning header; JSON
+// bodies also gain a "warnings" list.
+type Deprecation struct {
+	// Feature names what is deprecated in metrics, e.g. "v1" or
+	// "param:disposition".
+	Feature string
+	// Since is when it was (or will be) deprecated. RFC 9745 has no form
+	// without a date, so a zero Since leaves the Deprecation header out.
+	Since time.Time
+	// Sunset is when it stops working; zero when not yet scheduled.
+	Sunset time.Time
+	// Link points to documentation of the replacement.
+	Link string
+	// Message is the warning shown to clients; it defaults to one built from
+	// Feature and Sunset.
+	Message string
+}
+
+// warnCode is the Warning code for a miscellaneous persistent warning
+// (RFC 7234 §5.5.7), which is what a deprecation notice is.
+const warnCode = "299 - "
+
+// mark labels the response on w as using d.
+func (d Deprecation) mark(w http.ResponseWriter) {
+	hdr := w.Header()
+	if !d.Since.IsZero() && hdr.Get("Deprecation") == "" {
+		hdr.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	}
+	// With several deprecated features in one request, the first to go wins.
+	if !d.Sunset.IsZero() {
+		prev, err := http.ParseTime(hdr.Get("Sunset"))
+		if err != nil || d.Sunset.Before(prev) {
+			hdr.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+	if d.Link != "" {
+		hdr.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+	hdr.Add("Warning", warnCode+strconv.Quote(d.message()))
+}
+
+func (d Deprecation) message() string {
+	if d.Message != "" {
+		return d.Message
+	}
+	msg := d.Feature + " is deprecated"
+	if !d.Sunset.IsZero() {
+		msg += " and will be removed after " + d.Sunset.UTC().Format(time.DateOnly)
+	}
+	return msg
+}
+
+// Deprecated is middleware that marks every response from next as using d,
+// and calls observe, if non-nil, with d.Feature for each request.
+func Deprecated(d Deprecation, observe func(feature string), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mark(w)
+		if observe != nil {
+			observe(d.Feature)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DeprecatedVersion is Deprecated for requests served under one API version.
+// It must run inside Versions, which decides the version.
+func DeprecatedVersion(version int, d Deprecation, observe func(feature string), next http.Handler) http.Handler {
+	deprecated := Deprecated(d, observe, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if responseVersion(w) == version {
+			deprecated.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithDeprecatedParams marks requests that send any of the parameters in
+// params (by parameter name) as using the matching deprecation. observe, if
+// non-nil, is called with its Feature for each one.
+func WithDeprecatedParams(params map[string]Deprecation, observe func(feature string)) Option {
+	return func(h *Convert) {
+		h.deprecated = params
+		h.onDeprecated = observe
+	}
+}
+
+// markDeprecatedParams marks the response for each deprecated parameter the
+// request sent.
+func (h *Convert) markDeprecatedParams(w http.ResponseWriter, r *http.Request) {
+	for _, name := range slices.Sorted(maps.Keys(h.deprecated)) {
+		if h.param(r, name) == "" {
+			continue
+		}
+		d := h.deprecated[name]
+		d.mark(w)
+		if h.onDeprecated != nil {
+			h.onDeprecated(d.Feature)
+		}
+	}
+}
+
+// withWarnings adds the deprecation warnings set on w, if any, to the JSON
+// object v as a "warnings" list. Other values are returned unchanged.
+func withWarnings(w http.ResponseWriter, v any) any {
+	var warnings []string
+	for _, h := range w.Header().Values("Warning") {
+		if msg, ok := strings.CutPrefix(h, warnCode); ok {
+			if msg, err := strconv.Unquote(msg); err == nil {
+				warnings = append(warnings, msg)
+			}
+		}
+	}
+	if len(warnings) == 0 {
+		return v
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil || obj == nil {
+		return v
+	}
+	obj["warnings"], _ = json.Marshal(warnings)
+	return obj
+}
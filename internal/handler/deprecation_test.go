@@ -0,0 +1,115 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+var (
+	since  = time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	sunset = time.Date(2026, 7, 31, 0, 0, 0, 0, time.UTC)
+)
+
+func TestDeprecatedVersion(t *testing.T) {
+	var seen []string
+	mux := http.NewServeMux()
+	mux.Handle("/convert", handler.DeprecatedVersion(handler.V1, handler.Deprecation{
+		Feature: "v1",
+		Since:   since,
+		Sunset:  sunset,
+		Link:    "https://docs.example.com/v2",
+	}, func(f string) { seen = append(seen, f) }, handler.NewConvert(happyMock())))
+	h := handler.Versions(mux)
+
+	for _, tc := range []struct {
+		path       string
+		deprecated bool
+	}{
+		{"/v1/convert", true},
+		{"/convert", true},
+		{"/v2/convert", false},
+	} {
+		req := buildRequest(t, validDocxBody(1024))
+		req.URL.Path = tc.path
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.path, rr.Code, rr.Body.String())
+		}
+		got := rr.Header()
+		if !tc.deprecated {
+			if got.Get("Deprecation") != "" || got.Get("Warning") != "" {
+				t.Errorf("%s: marked deprecated: %v", tc.path, got)
+			}
+			continue
+		}
+		if got.Get("Deprecation") != "@1769817600" {
+			t.Errorf("%s: Deprecation = %q", tc.path, got.Get("Deprecation"))
+		}
+		if got.Get("Sunset") != "Fri, 31 Jul 2026 00:00:00 GMT" {
+			t.Errorf("%s: Sunset = %q", tc.path, got.Get("Sunset"))
+		}
+		if got.Get("Link") != `<https://docs.example.com/v2>; rel="deprecation"` {
+			t.Errorf("%s: Link = %q", tc.path, got.Get("Link"))
+		}
+		if want := `299 - "v1 is deprecated and will be removed after 2026-07-31"`; got.Get("Warning") != want {
+			t.Errorf("%s: Warning = %q, want %q", tc.path, got.Get("Warning"), want)
+		}
+	}
+	if len(seen) != 2 || seen[0] != "v1" {
+		t.Errorf("observed %v, want v1 twice", seen)
+	}
+}
+
+func TestDeprecatedParams_WarningsInJSON(t *testing.T) {
+	var seen []string
+	h := handler.NewConvert(happyMock(), handler.WithDeprecatedParams(map[string]handler.Deprecation{
+		"disposition": {Feature: "param:disposition", Sunset: sunset, Message: "use the Accept header instead"},
+	}, func(f string) { seen = append(seen, f) }))
+
+	req := buildRequest(t, validDocxBody(1024))
+	req.URL.RawQuery = "disposition=sideways"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Errorf("Deprecation set without a date: %q", rr.Header().Get("Deprecation"))
+	}
+	if rr.Header().Get("Sunset") == "" {
+		t.Error("missing Sunset header")
+	}
+	var body struct {
+		Error    string   `json:"error"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Error == "" || len(body.Warnings) != 1 || body.Warnings[0] != "use the Accept header instead" {
+		t.Errorf("body = %+v", body)
+	}
+	if len(seen) != 1 || seen[0] != "param:disposition" {
+		t.Errorf("observed %v", seen)
+	}
+}
+
+func TestDeprecatedParams_Unused(t *testing.T) {
+	h := handler.NewConvert(happyMock(), handler.WithDeprecatedParams(map[string]handler.Deprecation{
+		"disposition": {Feature: "param:disposition", Since: since},
+	}, nil))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Deprecation") != "" || rr.Header().Get("Warning") != "" {
+		t.Errorf("status %d, headers %v", rr.Code, rr.Header())
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/billing"
+	"github.com/BRO3886/go-docpdf/internal/egress"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+// EgressCap is middleware counting the bytes of next's successful responses
+// against the request's tenant in m. A tenant at its monthly cap is refused
+// with 429 and a Retry-After until the month ends. A download under the cap
+// is never cut short, so a tenant can end its month somewhat over it.
+func EgressCap(m *egress.Meter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := egressTenant(r)
+		if ok, wait := m.Allow(tenant); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			middleware.SetOutcome(r.Context(), "rejected")
+			middleware.SetLogError(r.Context(), "egress cap exceeded")
+			middleware.Deny(r.Context(), audit.Denial{
+				Status: http.StatusTooManyRequests,
+				Policy: audit.PolicyEgressCap,
+				Reason: audit.ReasonEgressCapped,
+				Detail: strconv.FormatInt(m.Cap(tenant), 10) + " bytes",
+			})
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, r, http.StatusTooManyRequests, "monthly egress cap exceeded")
+			return
+		}
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		m.Add(tenant, cw.n)
+	})
+}
+
+// egressTenant is the tenant egress is counted against: the API key's, or
+// billing.DefaultTenant for a key without one and for unauthenticated
+// requests. Unlike tenantID it never trusts X-Tenant-ID, which a caller could
+// change to start a fresh month under another tenant's cap.
+func egressTenant(r *http.Request) string {
+	if k, ok := auth.FromContext(r.Context()); ok && k.Tenant != "" {
+		return k.Tenant
+	}
+	return billing.DefaultTenant
+}
+
+// countingWriter counts the body bytes of a successful response.
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	if w.status < 300 {
+		w.n += int64(n)
+	}
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *countingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,94 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/billing"
+	"github.com/BRO3886/go-docpdf/internal/egress"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+func TestEgressCap(t *testing.T) {
+	m, err := egress.New(egress.Config{Tenants: map[string]int64{"trial": 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := auth.NewKeystore([]auth.Key{{Name: "team-a", Secret: "s3cret", Tenant: "trial"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := auth.Middleware(ks, handler.EgressCap(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "conversion failed", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("%PDF-1.7 ..."))
+	})))
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/jobs/1/result?"+query, nil)
+		req.Header.Set("X-API-Key", "s3cret")
+		// The key's tenant is charged, whatever the header claims.
+		req.Header.Set("X-Tenant-ID", "someone-else")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get("fail=1"); rr.Code != http.StatusInternalServerError || m.Usage("trial").Bytes != 0 {
+		t.Fatalf("an error response was counted: %d, %+v", rr.Code, m.Usage("trial"))
+	}
+	if rr := get(""); rr.Code != http.StatusOK || m.Usage("trial").Bytes != 12 {
+		t.Fatalf("download not counted: %d, %+v", rr.Code, m.Usage("trial"))
+	}
+	rr := get("")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rr.Code, rr.Header())
+	}
+	assertJSONError(t, rr.Body.String())
+	if !strings.Contains(rr.Body.String(), "egress") {
+		t.Errorf("body %s", rr.Body)
+	}
+
+	if u := m.Usage("someone-else"); u.Bytes != 0 {
+		t.Errorf("X-Tenant-ID was charged: %+v", u)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/limits", nil)
+	req.Header.Set("X-API-Key", "s3cret")
+	rr = httptest.NewRecorder()
+	auth.Middleware(ks, handler.NewLimits(nil, nil, m)).ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), `"egress":{"tenant":"trial"`) || !strings.Contains(rr.Body.String(), `"bytes":12,"cap_bytes":10`) {
+		t.Errorf("limits %s", rr.Body)
+	}
+}
+
+func TestEgressCap_UnauthenticatedSharesDefault(t *testing.T) {
+	m, err := egress.New(egress.Config{Tenants: map[string]int64{"trial": 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handler.EgressCap(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.7 ..."))
+	}))
+	for _, tenant := range []string{"trial", "fresh-1", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/jobs/1/result", nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("tenant %q: %d", tenant, rr.Code)
+		}
+	}
+	if u := m.Usage(billing.DefaultTenant); u.Bytes != 36 {
+		t.Errorf("default usage %+v, want 36 bytes", u)
+	}
+	if u := m.Usage("trial"); u.Bytes != 0 {
+		t.Errorf("X-Tenant-ID was charged: %+v", u)
+	}
+}
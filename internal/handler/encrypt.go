@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// checkPasswords validates the user_password and owner_password parameters
+// for output in format at the given PDF version. The passwords themselves
+// are never put in the error: it is logged.
+func checkPasswords(format, version, user, owner string) *stageError {
+	if user == "" && owner == "" {
+		return nil
+	}
+	if format != converter.FormatPDF {
+		return fail(http.StatusBadRequest, "passwords with non-pdf output", "passwords require pdf output")
+	}
+	if strings.HasPrefix(version, "pdfa-") {
+		return fail(http.StatusBadRequest, "passwords with pdf/a output", "passwords cannot be used with pdf/a")
+	}
+	return nil
+}
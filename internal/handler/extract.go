@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/textextract"
+)
+
+// Formats of an /extract-text response.
+const (
+	extractText = "text"
+	extractJSON = "json"
+)
+
+// Extract handles POST /extract-text. It converts a text document or
+// spreadsheet with LibreOffice's text or HTML export and returns its text:
+// plain text, a line per block, or with format=json the blocks themselves,
+// headings, paragraphs, list items and table rows, for a search indexer.
+type Extract struct {
+	c *Convert
+}
+
+// NewExtract returns an Extract handler. Options are shared with Convert.
+func NewExtract(conv converter.Converter, opts ...Option) *Extract {
+	h := NewConvert(conv, opts...)
+	h.extract = true
+	return &Extract{c: h}
+}
+
+// extractResponse is the body sent for format=json.
+type extractResponse struct {
+	Type       string              `json:"type"`
+	Paragraphs []textextract.Block `json:"paragraphs"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Extract) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.c.admit(w, r); err != nil {
+		err.write(w, r)
+		return
+	}
+
+	c := &conversion{}
+	defer c.cleanup()
+	if err := h.serve(w, r, c); err != nil {
+		if err.badUpload != "" && h.c.onBadUpload != nil {
+			h.c.onBadUpload(err.badUpload)
+		}
+		err.write(w, r)
+	}
+}
+
+// serve runs the stages for one request.
+func (h *Extract) serve(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.run(w, r, c, []stage{{stageParse, h.c.parse}}); err != nil {
+		return err
+	}
+	format := strings.ToLower(h.c.param(r, "format"))
+	switch format {
+	case "":
+		format = extractText
+	case extractText, extractJSON:
+	default:
+		return fail(http.StatusBadRequest, "invalid extract format", "format must be text or json")
+	}
+	return h.c.run(w, r, c, []stage{
+		{stageValidate, h.validate},
+		{stageStage, h.c.stage},
+		{stageConvert, h.c.runConversion},
+		{stagePost, h.c.postProcess},
+		{stageRespond, func(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+			return h.respond(w, r, c, format)
+		}},
+	})
+}
+
+// validate is the Convert validate stage, less what has no meaning for
+// text: the result is parsed, not stored or returned as a file.
+func (h *Extract) validate(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.validate(w, r, c); err != nil {
+		return err
+	}
+	switch {
+	case c.opts.Encrypted():
+		return fail(http.StatusBadRequest, "encrypted output", "passwords are not supported")
+	case c.dlv.store:
+		return fail(http.StatusBadRequest, "store with /extract-text", "store is not supported")
+	}
+	return nil
+}
+
+// respond parses the export and sends its text in format.
+func (h *Extract) respond(w http.ResponseWriter, r *http.Request, c *conversion, format string) *stageError {
+	f, err := os.Open(c.outPath)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "internal error: open result", "internal error")
+	}
+	defer f.Close()
+	parse := textextract.ParseHTML
+	if c.opts.Format == converter.FormatTXT {
+		parse = textextract.ParseText
+	}
+	blocks, err := parse(f)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "parse text export: "+err.Error(), "internal error")
+	}
+
+	middleware.SetOutcome(r.Context(), "success")
+	if format == extractJSON {
+		if blocks == nil {
+			blocks = []textextract.Block{}
+		}
+		writeJSON(w, http.StatusOK, extractResponse{Type: c.ft.Name, Paragraphs: blocks})
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, textextract.Text(blocks))
+	return nil
+}
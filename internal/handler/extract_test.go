@@ -0,0 +1,131 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/textextract"
+)
+
+// extractMock writes the export a format asks for: text for txt, a heading
+// and a table for html.
+func extractMock() *mockConverter {
+	m := &mockConverter{}
+	m.callsFn = func(_ context.Context, _ string, outDir string) (string, error) {
+		m.mu.Lock()
+		format := m.opts[len(m.opts)-1].Format
+		m.mu.Unlock()
+		out := filepath.Join(outDir, "input."+format)
+		content := "\ufeffFirst  line\n\nSecond line\n"
+		if format == "html" {
+			content = "<html><head><title>x</title></head><body><h1>Budget</h1>" +
+				"<table><tr><td>Q1</td><td>100</td></tr></table></body></html>"
+		}
+		return out, os.WriteFile(out, []byte(content), 0600)
+	}
+	return m
+}
+
+// buildExtractRequest is an /extract-text request for body, named name.
+func buildExtractRequest(t *testing.T, name string, body []byte, query string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(body)
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/extract-text?"+query, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestExtract_Text(t *testing.T) {
+	mock := extractMock()
+	h := handler.NewExtract(mock)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildExtractRequest(t, "notes.docx", validDocxBody(1024), ""))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if got := rr.Body.String(); got != "First line\nSecond line\n" {
+		t.Errorf("body %q", got)
+	}
+	if f := mock.opts[0].Format; f != "txt" {
+		t.Errorf("converted to %q, want txt", f)
+	}
+}
+
+func TestExtract_JSON(t *testing.T) {
+	for _, tc := range []struct {
+		name, typ string
+		body      []byte
+	}{
+		{"notes.docx", "docx", validDocxBody(1024)},
+		{"budget.xlsx", "xlsx", zipPackage(t, "xl/workbook.xml")},
+	} {
+		mock := extractMock()
+		h := handler.NewExtract(mock)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, buildExtractRequest(t, tc.name, tc.body, "format=json"))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.name, rr.Code, rr.Body.String())
+		}
+		var body struct {
+			Type       string
+			Paragraphs []textextract.Block
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Type != tc.typ || len(body.Paragraphs) != 2 {
+			t.Fatalf("%s: body %+v", tc.name, body)
+		}
+		if p := body.Paragraphs[0]; p.Kind != textextract.KindHeading || p.Level != 1 || p.Text != "Budget" {
+			t.Errorf("%s: first block %+v", tc.name, p)
+		}
+		if p := body.Paragraphs[1]; p.Kind != textextract.KindRow || len(p.Cells) != 2 || p.Cells[1] != "100" {
+			t.Errorf("%s: second block %+v", tc.name, p)
+		}
+		if f := mock.opts[0].Format; f != "html" {
+			t.Errorf("%s: converted to %q, want html", tc.name, f)
+		}
+	}
+}
+
+func TestExtract_Rejected(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, query string
+		body              []byte
+		status            int
+	}{
+		{"unknown format", "notes.docx", "format=xml", validDocxBody(1024), http.StatusBadRequest},
+		{"presentation", "deck.pptx", "", zipPackage(t, "ppt/presentation.xml"), http.StatusUnsupportedMediaType},
+		{"passwords", "notes.docx", "user_password=x", validDocxBody(1024), http.StatusBadRequest},
+		{"watermark", "notes.docx", "watermark=DRAFT", validDocxBody(1024), http.StatusBadRequest},
+	} {
+		mock := extractMock()
+		h := handler.NewExtract(mock)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, buildExtractRequest(t, tc.file, tc.body, tc.query))
+		if rr.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.status, rr.Code, rr.Body.String())
+		}
+		if len(mock.calls) != 0 {
+			t.Errorf("%s: converter called", tc.name)
+		}
+	}
+}
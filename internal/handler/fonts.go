@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// missingFontsHeader lists the fonts an upload uses that the host lacks.
+const missingFontsHeader = "X-Missing-Fonts"
+
+// WithFonts reports the fonts each Word upload uses that are missing from
+// inv, the installed fonts, once subs, the substitutions conversions run
+// with, are applied: in an X-Missing-Fonts header, and on the async job.
+// observe, if non-nil, is called for each upload with missing fonts.
+func WithFonts(inv *converter.FontInventory, subs []converter.FontSubstitution, observe func()) Option {
+	return func(h *Convert) {
+		h.fonts = inv
+		h.fontSubs = subs
+		h.onMissingFonts = observe
+	}
+}
+
+// screenFonts sets the X-Missing-Fonts header for the staged input at path
+// and returns the fonts it names, nil when nothing is missing or fonts are
+// not reported.
+func (h *Convert) screenFonts(w http.ResponseWriter, path string, size int64) []string {
+	if h.fonts == nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	missing := h.fonts.Missing(filetype.Fonts(f, size), h.fontSubs)
+	f.Close()
+	if len(missing) == 0 {
+		return nil
+	}
+	if h.onMissingFonts != nil {
+		h.onMissingFonts()
+	}
+	setMissingFonts(w, missing)
+	return missing
+}
+
+// setMissingFonts sets the X-Missing-Fonts header to fonts: each quoted, as
+// font names may hold commas, with non-ASCII characters escaped as \uXXXX.
+func setMissingFonts(w http.ResponseWriter, fonts []string) {
+	if len(fonts) == 0 {
+		return
+	}
+	quoted := make([]string, len(fonts))
+	for i, f := range fonts {
+		quoted[i] = strconv.QuoteToASCII(f)
+	}
+	w.Header().Set(missingFontsHeader, strings.Join(quoted, ", "))
+}
+
+// Fonts serves GET /fonts: the font families installed for conversions and
+// the substitutions applied to fonts that are not.
+type Fonts struct {
+	inv  *converter.FontInventory
+	subs []converter.FontSubstitution
+}
+
+// NewFonts returns a Fonts handler reporting inv and subs.
+func NewFonts(inv *converter.FontInventory, subs []converter.FontSubstitution) *Fonts {
+	return &Fonts{inv: inv, subs: subs}
+}
+
+// fontsResponse is the GET /fonts body.
+type fontsResponse struct {
+	Count         int                    `json:"count"`
+	Families      []string               `json:"families"`
+	Substitutions []substitutionResponse `json:"substitutions"`
+}
+
+type substitutionResponse struct {
+	Font        string `json:"font"`
+	Replacement string `json:"replacement"`
+	// Installed is false when the replacement is missing too, so the
+	// substitution has no effect.
+	Installed bool `json:"installed"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Fonts) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	families := h.inv.Families()
+	resp := fontsResponse{
+		Count:         len(families),
+		Families:      families,
+		Substitutions: make([]substitutionResponse, len(h.subs)),
+	}
+	for i, s := range h.subs {
+		resp.Substitutions[i] = substitutionResponse{Font: s.Font, Replacement: s.Replacement, Installed: h.inv.Has(s.Replacement)}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,107 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+// fontsDocx returns a DOCX set in Calibri, Wingdings and MS Mincho.
+func fontsDocx(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml":   `<w:document><w:r><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Wingdings" w:eastAsia="ＭＳ 明朝"/></w:rPr></w:r></w:document>`,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(body))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestConvert_MissingFonts(t *testing.T) {
+	inv := converter.NewFontInventory([]string{"Carlito", "DejaVu Sans"})
+	subs := []converter.FontSubstitution{{Font: "Calibri", Replacement: "Carlito"}}
+	// Non-ASCII names are escaped so the header stays ASCII.
+	const want = `"Wingdings", "\uff2d\uff33 \u660e\u671d"`
+
+	var observed int
+	h := handler.NewConvert(happyMock(), handler.WithFonts(inv, subs, func() { observed++ }))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, fontsDocx(t)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if got := rr.Header().Get("X-Missing-Fonts"); got != want {
+		t.Errorf("X-Missing-Fonts %q, want %q", got, want)
+	}
+	if observed != 1 {
+		t.Errorf("observed %d uploads with missing fonts, want 1", observed)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(512)))
+	if got := rr.Header().Get("X-Missing-Fonts"); got != "" || observed != 1 {
+		t.Errorf("reported %q for a document without fonts", got)
+	}
+
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("/convert/async", handler.NewConvertAsync(happyMock(), mgr, handler.WithFonts(inv, subs, nil)))
+	mux.HandleFunc("GET /jobs/{id}", jh.Status)
+
+	req := buildRequest(t, fontsDocx(t))
+	req.URL.Path = "/convert/async"
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted || rr.Header().Get("X-Missing-Fonts") != want {
+		t.Fatalf("submit: %d, X-Missing-Fonts %q", rr.Code, rr.Header().Get("X-Missing-Fonts"))
+	}
+	loc := rr.Header().Get("Location")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, loc, nil))
+	if got := rr.Header().Get("X-Missing-Fonts"); got != want {
+		t.Errorf("job status X-Missing-Fonts %q, want %q", got, want)
+	}
+}
+
+func TestFonts(t *testing.T) {
+	inv := converter.NewFontInventory([]string{"Liberation Sans", "Carlito", "carlito"})
+	subs := []converter.FontSubstitution{{Font: "Calibri", Replacement: "Carlito"}, {Font: "Cambria", Replacement: "Caladea"}}
+	rr := httptest.NewRecorder()
+	handler.NewFonts(inv, subs).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/fonts", nil))
+
+	var body struct {
+		Count         int      `json:"count"`
+		Families      []string `json:"families"`
+		Substitutions []struct {
+			Font      string `json:"font"`
+			Installed bool   `json:"installed"`
+		} `json:"substitutions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rr.Body, err)
+	}
+	if body.Count != 2 || body.Families[0] != "Carlito" || body.Families[1] != "Liberation Sans" {
+		t.Errorf("families %d %v", body.Count, body.Families)
+	}
+	if len(body.Substitutions) != 2 || !body.Substitutions[0].Installed || body.Substitutions[1].Installed {
+		t.Errorf("substitutions %+v", body.Substitutions)
+	}
+}
@@ -2,132 +2,831 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/billing"
+	"github.com/BRO3886/go-docpdf/internal/cache"
 	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
 	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/scratch"
+	"github.com/BRO3886/go-docpdf/internal/sink"
+	"github.com/BRO3886/go-docpdf/internal/spool"
+	"github.com/BRO3886/go-docpdf/internal/stats"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+	"github.com/BRO3886/go-docpdf/internal/webhook"
 )
 
 const maxFileSize = 10 << 20 // 10 MB
 
-// docxMagic is the PK ZIP header that all OOXML (.docx) files start with.
-var docxMagic = [4]byte{0x50, 0x4B, 0x03, 0x04}
+// maxBodySize allows for multipart framing around a maximum-size file.
+const maxBodySize = maxFileSize + 4096
+
+// queueRetryAfter is the Retry-After hint (seconds) sent when the conversion
+// queue is full.
+const queueRetryAfter = 5
+
+// diskRetryAfter is the Retry-After hint (seconds) sent when the temp
+// directory is low on space, which takes longer to clear than a queue.
+const diskRetryAfter = 60
 
 // Convert handles POST /convert requests.
-// It validates the uploaded file, shells out to LibreOffice via the Converter,
-// and streams back the resulting PDF.
+// It validates and identifies the uploaded file, shells out to LibreOffice via the Converter,
+// and streams back the result in the requested output format (PDF by default).
 type Convert struct {
-	conv converter.Converter
+	conv   converter.Converter
+	pool   *pool.Pool
+	detect filetype.Detector
+	raw    bool
+	// pdfOnly is set for /split and /thumbnail, which always convert to
+	// PDF rather than negotiate.
+	pdfOnly bool
+	// extract is set for /extract-text, which converts to the format
+	// converter.TextFormat picks rather than negotiate.
+	extract bool
+	jobs    *jobs.Manager // non-nil for /convert/async
+	wd      *watchdog.Watchdog
+	// scratch holds the working directories of synchronous conversions.
+	scratch *scratch.Space
+	stats   *stats.Recorder
+	// backend names the converter for plan=true.
+	backend string
+	hooks   *webhook.Dispatcher
+	policy  *filetype.Policy
+	macros  filetype.MacroPolicy
+	// onMacro is told the action taken on each macro-bearing upload.
+	onMacro  func(action string)
+	timeouts StageTimeouts
+	// onStage is told how long each stage of a request took.
+	onStage func(stage string, d time.Duration)
+	cache   *cache.Cache
+	// onCache is told whether each cache lookup hit.
+	onCache func(result string)
+	// affinity sets X-Affinity-Key, and the cookie affinityCookie names if
+	// any, on synchronous conversions.
+	affinity       bool
+	affinityCookie string
+	sink           sink.Sink
+	// deprecated maps deprecated parameter names to their deprecation.
+	deprecated   map[string]Deprecation
+	onDeprecated func(feature string)
+	// onBadUpload is told why each malformed upload was rejected.
+	onBadUpload func(reason string)
+	// onTemplate is told about each external template reference removed.
+	onTemplate func()
+	billing    *billing.Meter
+	// postWorkers bounds the pages of a result post-processed at once.
+	postWorkers int
+	// onSizes is told the input and result sizes of each conversion.
+	onSizes func(docType string, in, out int64)
+	// onLimit is told the resource of each conversion stopped by a limit.
+	onLimit func(resource string)
+	// minFreeDisk is the free space in bytes on the temp directory below
+	// which new conversions are refused.
+	minFreeDisk int64
+	// defaultPDFVersion and tenantPDFVersions are the default PDF versions.
+	defaultPDFVersion string
+	tenantPDFVersions map[string]string
+	// defaultImageDPI and tenantImageDPI are the default image resolutions.
+	defaultImageDPI int
+	tenantImageDPI  map[string]int
+	protection      filetype.ProtectionPolicy
+	packageLimits   filetype.PackageLimits
+	// onProtected is told the action taken on each protected upload.
+	onProtected func(action string)
+	// fonts, when set, are the installed fonts that uploads' fonts are
+	// checked against, after fontSubs; onMissingFonts is told of each
+	// upload with missing fonts.
+	fonts          *converter.FontInventory
+	fontSubs       []converter.FontSubstitution
+	onMissingFonts func()
+	// previewJobs queues the full conversion of a fast=true request whose
+	// preview did not finish within previewTimeout.
+	previewJobs    *jobs.Manager
+	previewTimeout time.Duration
+}
+
+// Option configures optional Convert behaviour.
+type Option func(*Convert)
+
+// WithPool bounds concurrent conversions with p. Requests are rejected with
+// 503 before their body is read when the queue is full, and told their queue
+// position via a 103 Early Hints response when they will have to wait.
+func WithPool(p *pool.Pool) Option {
+	return func(h *Convert) { h.pool = p }
+}
+
+// WithDetector replaces the default input type detector (filetype.Default).
+func WithDetector(d filetype.Detector) Option {
+	return func(h *Convert) { h.detect = d }
+}
+
+// WithWatchdog registers each conversion with wd so it can be cancelled under
+// memory pressure. The cancelled request gets a 503.
+func WithWatchdog(wd *watchdog.Watchdog) Option {
+	return func(h *Convert) { h.wd = wd }
+}
+
+// WithScratch stages synchronous conversions in working directories from
+// s, on a memory-backed filesystem. Async jobs, whose results are kept
+// until they expire, stay on disk.
+func WithScratch(s *scratch.Space) Option {
+	return func(h *Convert) { h.scratch = s }
+}
+
+// WithPostProcessWorkers bounds how many pages of one result post-processing
+// steps, such as a watermark, work on at once. The default, 0, is
+// runtime.GOMAXPROCS(0).
+func WithPostProcessWorkers(n int) Option {
+	return func(h *Convert) { h.postWorkers = n }
+}
+
+// WithStats records the duration of each successful conversion in rec.
+func WithStats(rec *stats.Recorder) Option {
+	return func(h *Convert) { h.stats = rec }
+}
+
+// WithPolicy rejects detected input types that p does not allow for the
+// request's tenant (the API key's tenant, or else the X-Tenant-ID header)
+// with 415 and code "type_not_allowed".
+func WithPolicy(p *filetype.Policy) Option {
+	return func(h *Convert) { h.policy = p }
+}
+
+// WithMacroPolicy sets what happens to uploads carrying macros (default
+// filetype.MacroReject). observe, if non-nil, is called with "allowed",
+// "stripped" or "rejected" for each one.
+func WithMacroPolicy(p filetype.MacroPolicy, observe func(action string)) Option {
+	return func(h *Convert) {
+		h.macros = p
+		h.onMacro = observe
+	}
+}
+
+// WithPackageLimits bounds the entries and uncompressed size of ZIP-based
+// uploads (default filetype.DefaultMaxEntries and
+// filetype.DefaultMaxUncompressed). Packages beyond them get a 413 with code
+// "package_too_large", and those missing the parts their type requires a
+// 415 with code "invalid_package", before LibreOffice sees them.
+func WithPackageLimits(l filetype.PackageLimits) Option {
+	return func(h *Convert) { h.packageLimits = l }
+}
+
+// WithUploadObserver calls observe with "empty", "truncated", "aborted",
+// "invalid_package" or "package_too_large" for each upload rejected as
+// malformed. Those requests get a 4xx with a code naming the problem and the
+// "bad_upload" outcome rather than "failed".
+func WithUploadObserver(observe func(reason string)) Option {
+	return func(h *Convert) { h.onBadUpload = observe }
+}
+
+// WithTemplateObserver calls observe each time an upload's external
+// attached-template reference is removed before conversion.
+func WithTemplateObserver(observe func()) Option {
+	return func(h *Convert) { h.onTemplate = observe }
+}
+
+// WithSizeObserver calls observe with the input and result sizes in bytes of
+// every successful conversion, synchronous, async or batched.
+func WithSizeObserver(observe func(docType string, in, out int64)) Option {
+	return func(h *Convert) { h.onSizes = observe }
+}
+
+// WithLimitObserver calls observe with the resource ("cpu", "rss" or
+// "output") of every conversion the converter stopped for exceeding a limit.
+func WithLimitObserver(observe func(resource string)) Option {
+	return func(h *Convert) { h.onLimit = observe }
+}
+
+// WithMinFreeDisk refuses new conversions with 507 while the temp directory
+// has less than bytes free, rather than letting them fail halfway through
+// with whatever error LibreOffice makes of a full disk. The check is skipped
+// on platforms where free space cannot be read.
+func WithMinFreeDisk(bytes int64) Option {
+	return func(h *Convert) { h.minFreeDisk = bytes }
 }
 
 // NewConvert returns a Convert handler backed by conv.
-func NewConvert(conv converter.Converter) *Convert {
-	return &Convert{conv: conv}
+func NewConvert(conv converter.Converter, opts ...Option) *Convert {
+	h := &Convert{conv: conv, detect: filetype.Default, macros: filetype.MacroReject, protection: filetype.ProtectionWarn}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-// ServeHTTP implements http.Handler.
-func (h *Convert) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "method not allowed")
-		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-		return
+// NewConvertRaw returns a Convert handler for POST /convert/raw, which takes the
+// document as the raw request body instead of a multipart form. The declared
+// Content-Type, when it names a known format, must match the content.
+func NewConvertRaw(conv converter.Converter, opts ...Option) *Convert {
+	h := NewConvert(conv, opts...)
+	h.raw = true
+	return h
+}
+
+// convert runs the conversion for tenant, registered with the watchdog when
+// one is configured, and records its duration and usage when it succeeds. A conversion the
+// watchdog cancelled returns watchdog.ErrMemoryPressure, and one aborted
+// because ctx ended returns ctx's error, regardless of how the converter
+// reported it.
+func (h *Convert) convert(ctx context.Context, tenant, inputPath, outDir string, opts converter.Options) (string, error) {
+	// Async jobs run outside the request; theirs is tagged by the RunFunc.
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		ctx = converter.WithRequestID(ctx, id)
+	}
+	if h.wd != nil {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		untrack := h.wd.Track(cancel)
+		defer untrack()
 	}
 
-	// Cap the request body before parsing so oversized uploads fail fast.
-	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize+4096)
+	start := time.Now()
+	outPath, err := h.conv.Convert(ctx, inputPath, outDir, opts)
+	if err != nil {
+		if errors.Is(context.Cause(ctx), watchdog.ErrMemoryPressure) {
+			return "", watchdog.ErrMemoryPressure
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		var lerr *converter.LimitError
+		if h.onLimit != nil && errors.As(err, &lerr) {
+			h.onLimit(lerr.Resource)
+		}
+		return "", err
+	}
+	d := time.Since(start)
+	// Inputs are staged with their detected type's extension.
+	docType := strings.TrimPrefix(filepath.Ext(inputPath), ".")
+	if h.stats != nil {
+		h.stats.Observe(docType, d)
+	}
+	if h.onSizes != nil {
+		h.observeSizes(docType, inputPath, outPath)
+	}
+	if h.billing != nil {
+		h.bill(tenant, inputPath, outPath, opts.Format, d)
+	}
+	return outPath, nil
+}
 
-	if err := r.ParseMultipartForm(maxFileSize); err != nil {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "file too large")
-		writeError(w, http.StatusRequestEntityTooLarge, "file too large")
+// observeSizes reports the sizes of inputPath and its result outPath to the
+// size observer. Files that cannot be read are skipped.
+func (h *Convert) observeSizes(docType, inputPath, outPath string) {
+	in, err := os.Stat(inputPath)
+	if err != nil {
 		return
 	}
-
-	f, _, err := r.FormFile("file")
+	out, err := os.Stat(outPath)
 	if err != nil {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "missing file field")
-		writeError(w, http.StatusBadRequest, "missing file field")
 		return
 	}
+	h.onSizes(docType, in.Size(), out.Size())
+}
+
+// admit runs every check that can be decided from the request line and
+// headers alone. It must never touch r.Body: net/http only sends
+// "100 Continue" to a client that sent "Expect: 100-continue" on the first
+// body read, so rejecting here means the client never uploads the document at
+// all. Auth and rate limiting run as
+// middleware ahead of the handler and get the same guarantee.
+func (h *Convert) admit(w http.ResponseWriter, r *http.Request) *stageError {
+	if r.Method != http.MethodPost {
+		return fail(http.StatusMethodNotAllowed, "method not allowed", "method not allowed")
+	}
+
+	// A declared length over the limit can be refused up front; chunked
+	// uploads (ContentLength == -1) are caught by MaxBytesReader instead.
+	if r.ContentLength > maxBodySize {
+		return fail(http.StatusRequestEntityTooLarge, "file too large", "file too large")
+	}
+
+	if serr := h.checkDisk(); serr != nil {
+		return serr
+	}
+
+	// A client streaming the body can abort as soon as it sees the rejection
+	// or its queue position.
+	if h.pool != nil {
+		pos, full := h.pool.Position()
+		if full {
+			return errQueueFull()
+		}
+		if pos > 0 {
+			w.Header().Set("X-Queue-Position", strconv.Itoa(pos))
+			w.WriteHeader(http.StatusEarlyHints)
+			// The position is stale by the final response.
+			w.Header().Del("X-Queue-Position")
+		}
+	}
+
+	return nil
+}
+
+// checkDisk returns errLowDisk when the temp directory has less than
+// minFreeDisk free.
+func (h *Convert) checkDisk() *stageError {
+	if h.minFreeDisk <= 0 {
+		return nil
+	}
+	dir := os.TempDir()
+	if free, err := freeDisk(dir); err == nil && free < h.minFreeDisk {
+		return errLowDisk(free, dir)
+	}
+	return nil
+}
+
+// maxFormFields caps the combined size of the text fields in a multipart
+// upload, which unlike the document are held in memory.
+const maxFormFields = 64 << 10
+
+// readMultipart streams the "file" form field of a multipart upload to dst
+// and returns its size and client-supplied filename. The other fields are
+// collected into r.Form and r.PostForm, as ParseMultipartForm would, so
+// parameters can still be read with FormValue.
+func readMultipart(r *http.Request, dst string) (int64, string, *stageError) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return 0, "", fail(http.StatusBadRequest, "not a multipart upload", "expected a multipart/form-data upload")
+	}
+
+	var (
+		size  int64
+		name  string
+		found bool
+	)
+	values := make(url.Values)
+	budget := int64(maxFormFields)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, "", uploadError(err)
+		}
+		switch {
+		case part.FileName() == "":
+			v, err := io.ReadAll(io.LimitReader(part, budget+1))
+			if err != nil {
+				return 0, "", uploadError(err)
+			}
+			if budget -= int64(len(v)); budget < 0 {
+				return 0, "", fail(http.StatusRequestEntityTooLarge, "form fields too large", "form fields too large")
+			}
+			values.Add(part.FormName(), string(v))
+		case part.FormName() == "file" && !found:
+			if size, err = saveUpload(dst, part); err != nil {
+				return 0, "", uploadError(err)
+			}
+			switch {
+			case size > maxFileSize:
+				return 0, "", fail(http.StatusRequestEntityTooLarge, "file too large", "file too large")
+			case size == 0:
+				return 0, "", errBadUpload(badUploadEmpty, "")
+			}
+			name, found = part.FileName(), true
+		case part.FormName() == "watermark_image":
+			img, err := io.ReadAll(io.LimitReader(part, maxWatermarkImage+1))
+			if err != nil {
+				return 0, "", uploadError(err)
+			}
+			if len(img) > maxWatermarkImage {
+				return 0, "", errWatermarkImageTooLarge()
+			}
+			if err := os.WriteFile(filepath.Join(filepath.Dir(dst), watermarkImageName), img, 0600); err != nil {
+				return 0, "", fail(http.StatusInternalServerError, "internal error: writefile", "internal error")
+			}
+		}
+		part.Close()
+	}
+	if !found {
+		return 0, "", fail(http.StatusBadRequest, "missing file field", "missing file field")
+	}
+
+	// Body fields take precedence over the query string, as in ParseForm.
+	r.PostForm = values
+	r.Form = make(url.Values, len(values))
+	for k, v := range values {
+		r.Form[k] = append([]string(nil), v...)
+	}
+	for k, v := range r.URL.Query() {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	r.MultipartForm = &multipart.Form{Value: values}
+	return size, name, nil
+}
+
+// readRaw streams the request body, which is the document, to dst and
+// returns its size.
+func readRaw(r *http.Request, dst string) (int64, *stageError) {
+	size, err := saveUpload(dst, r.Body)
+	switch {
+	case err != nil:
+		return 0, uploadError(err)
+	case size > maxFileSize:
+		return 0, fail(http.StatusRequestEntityTooLarge, "file too large", "file too large")
+	case size == 0:
+		return 0, errBadUpload(badUploadEmpty, "")
+	}
+	return size, nil
+}
+
+// saveUpload spools up to maxFileSize+1 bytes of src to a new file at dst,
+// so an oversized upload shows as a size over the limit without being stored
+// in full. The spool checksums the upload in chunks as it arrives.
+func saveUpload(dst string, src io.Reader) (int64, error) {
+	f, err := spool.Create(dst, spool.DefaultChunkSize)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, io.LimitReader(src, maxFileSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// uploadError maps a failure to receive the upload to its response. A body
+// or multipart stream that ends early means the client went away, or its
+// proxy cut the upload short, before sending the whole document.
+func uploadError(err error) *stageError {
+	var maxErr *http.MaxBytesError
+	var pathErr *os.PathError
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return errUploadTimeout()
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return errBadUpload(badUploadAborted, err.Error())
+	case errors.As(err, &maxErr):
+		return fail(http.StatusRequestEntityTooLarge, "file too large", "file too large")
+	case errors.As(err, &pathErr):
+		// Writing the staged file failed, not reading the request.
+		return fail(http.StatusInternalServerError, "internal error: staging upload: "+err.Error(), "internal error")
+	default:
+		return fail(http.StatusBadRequest, "could not read body: "+err.Error(), "could not read body")
+	}
+}
+
+// identify detects the document type from its content, read from the staged
+// upload, and its name (see filetype.Named). On /convert/raw a Content-Type
+// naming a known format must agree with the sniffed type, text/markdown
+// making plain text Markdown; application/octet-stream (or no Content-Type)
+// defers to sniffing alone.
+func (h *Convert) identify(r *http.Request, doc io.ReaderAt, size int64, name string) (filetype.Type, *stageError) {
+	if filetype.Truncated(doc, size) {
+		return filetype.Type{}, errBadUpload(badUploadTruncated, "")
+	}
+	ft, ok := h.detect.Detect(doc, size)
+	if !ok {
+		return filetype.Type{}, fail(http.StatusUnsupportedMediaType, "unsupported file type", "unsupported file type")
+	}
+	ft = filetype.Named(ft, name)
+	if declared, _ := filetype.ByMIME(r.Header.Get("Content-Type")); h.raw && ft == filetype.TXT && declared == filetype.MD {
+		ft = declared
+	}
+	if !h.policy.Allows(tenantID(r), ft) {
+		middleware.Deny(r.Context(), audit.Denial{Status: http.StatusUnsupportedMediaType, Policy: audit.PolicyTypes,
+			Reason: audit.ReasonTypeNotAllowed, Detail: ft.Name})
+		err := fail(http.StatusUnsupportedMediaType, "input type not allowed: "+ft.Name, "document type not allowed")
+		err.code = codeTypeNotAllowed
+		return filetype.Type{}, err
+	}
+	if err := h.checkPackage(doc, size, ft); err != nil {
+		return filetype.Type{}, err
+	}
+	if !h.raw {
+		return ft, nil
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if ct == "" || strings.HasPrefix(ct, "application/octet-stream") {
+		return ft, nil
+	}
+	declared, known := filetype.ByMIME(ct)
+	if !known {
+		return filetype.Type{}, fail(http.StatusUnsupportedMediaType, "unsupported content type", "unsupported file type")
+	}
+	if declared != ft && (declared != filetype.TXT || ft != filetype.MD) {
+		return filetype.Type{}, fail(http.StatusUnsupportedMediaType, "content does not match content type", "content does not match Content-Type")
+	}
+	return ft, nil
+}
+
+// checkPackage rejects a ZIP-based upload that lacks the parts its type
+// requires or would expand beyond the package limits.
+func (h *Convert) checkPackage(doc io.ReaderAt, size int64, ft filetype.Type) *stageError {
+	err := filetype.CheckPackage(doc, size, ft, h.packageLimits)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, filetype.ErrPackageTooLarge):
+		return errBadUpload(badUploadPackageTooLarge, err.Error())
+	default:
+		return errBadUpload(badUploadInvalidPackage, err.Error())
+	}
+}
+
+// decryptUpload replaces a password-protected OOXML upload at path with the
+// package inside, opened with the document_password parameter, and returns
+// its size. LibreOffice cannot be given a load password on its command line,
+// so it never sees the encrypted file.
+func (h *Convert) decryptUpload(r *http.Request, path string, size int64) (int64, *stageError) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: open upload", "internal error")
+	}
 	defer f.Close()
+	if !filetype.Encrypted(f, size) {
+		return size, nil
+	}
+	data, serr := decryptDocument(f, size, h.param(r, "document_password"))
+	if serr != nil {
+		return 0, serr
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: writefile", "internal error")
+	}
+	return int64(len(data)), nil
+}
+
+// decryptDocument opens an encrypted document with password. The password
+// is never part of the error.
+func decryptDocument(doc io.ReaderAt, size int64, password string) ([]byte, *stageError) {
+	if password == "" {
+		return nil, errPasswordProtected("no document password")
+	}
+	data, err := filetype.Decrypt(doc, size, password)
+	switch {
+	case err == nil:
+		return data, nil
+	case errors.Is(err, filetype.ErrWrongPassword):
+		return nil, errPasswordProtected("wrong document password")
+	case errors.Is(err, filetype.ErrUnsupportedEncryption):
+		return nil, fail(http.StatusUnprocessableEntity, "unsupported document encryption", "document encryption not supported")
+	default:
+		return nil, fail(http.StatusUnprocessableEntity, "decrypt document: "+err.Error(), "document could not be decrypted")
+	}
+}
 
-	// Read up to maxFileSize+1 bytes to detect oversized uploads.
-	lr := &io.LimitedReader{R: f, N: maxFileSize + 1}
-	data, err := io.ReadAll(lr)
+// errPasswordProtected is the 422 sent for an encrypted document without
+// its password, or with the wrong one.
+func errPasswordProtected(reason string) *stageError {
+	e := fail(http.StatusUnprocessableEntity, reason, "document is password protected")
+	e.code = codePasswordProtected
+	return e
+}
+
+// screenMacros applies the macro policy to the staged input at path, which
+// is rewritten without its macros under filetype.MacroStrip, and returns its
+// size. Only documents carrying macros are read into memory.
+func (h *Convert) screenMacros(path string, size int64) (int64, *stageError) {
+	f, err := os.Open(path)
 	if err != nil {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "could not read file")
-		writeError(w, http.StatusInternalServerError, "could not read file")
-		return
+		return 0, fail(http.StatusInternalServerError, "internal error: open upload", "internal error")
 	}
-	if int64(len(data)) > maxFileSize {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "file too large")
-		writeError(w, http.StatusRequestEntityTooLarge, "file too large")
-		return
+	has := filetype.HasMacros(f, size)
+	f.Close()
+	if !has {
+		return size, nil
 	}
 
-	if !hasDocxMagic(data) {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "unsupported file type")
-		writeError(w, http.StatusUnsupportedMediaType, "unsupported file type")
-		return
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: read upload", "internal error")
 	}
+	data, action := h.applyMacroPolicy(data)
+	switch action {
+	case macroRejected:
+		serr := fail(http.StatusUnsupportedMediaType, "document contains macros", "documents with macros are not allowed")
+		serr.code = codeMacrosNotAllowed
+		return 0, serr
+	case macroStripped:
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return 0, fail(http.StatusInternalServerError, "internal error: writefile", "internal error")
+		}
+	}
+	return int64(len(data)), nil
+}
 
-	tmpDir, err := os.MkdirTemp("", "docpdf-*")
+// dropExternalTemplate removes an external attached-template reference from
+// the staged Word document at path, which LibreOffice would otherwise try to
+// resolve while loading it, and returns the document's size.
+func (h *Convert) dropExternalTemplate(path string, size int64) (int64, *stageError) {
+	f, err := os.Open(path)
 	if err != nil {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "internal error: mkdirtemp")
-		writeError(w, http.StatusInternalServerError, "internal error")
-		return
+		return 0, fail(http.StatusInternalServerError, "internal error: open upload", "internal error")
+	}
+	has := filetype.HasExternalTemplate(f, size)
+	f.Close()
+	if !has {
+		return size, nil
 	}
-	defer os.RemoveAll(tmpDir)
 
-	inputPath := fmt.Sprintf("%s/input.docx", tmpDir)
-	if err := os.WriteFile(inputPath, data, 0600); err != nil {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "internal error: writefile")
-		writeError(w, http.StatusInternalServerError, "internal error")
-		return
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: read upload", "internal error")
+	}
+	data = h.stripTemplate(data)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: writefile", "internal error")
+	}
+	return int64(len(data)), nil
+}
+
+// stripTemplate returns data without its external attached template, or
+// unchanged when it has none or cannot be rewritten; the template only
+// slows loading down, so it is never a reason to refuse a document.
+func (h *Convert) stripTemplate(data []byte) []byte {
+	if !filetype.HasExternalTemplate(bytes.NewReader(data), int64(len(data))) {
+		return data
+	}
+	stripped, err := filetype.StripExternalTemplate(data)
+	if err != nil {
+		return data
+	}
+	if h.onTemplate != nil {
+		h.onTemplate()
 	}
+	return stripped
+}
 
-	pdfPath, convErr := h.conv.Convert(context.Background(), inputPath, tmpDir)
+// Actions reported for macro-bearing uploads.
+const (
+	macroAllowed  = "allowed"
+	macroStripped = "stripped"
+	macroRejected = "rejected"
+)
 
-	if convErr != nil {
-		switch {
-		case errors.Is(convErr, converter.ErrTimeout):
-			middleware.SetOutcome(r.Context(), "timeout")
-			middleware.SetLogError(r.Context(), "conversion timed out")
-			writeError(w, http.StatusGatewayTimeout, "conversion timed out")
-		default:
-			middleware.SetOutcome(r.Context(), "failed")
-			middleware.SetLogError(r.Context(), "conversion failed")
-			writeError(w, http.StatusInternalServerError, "conversion failed")
+// applyMacroPolicy returns data, with macros stripped if the policy says so,
+// and the action taken: "" when data carries no macros. A document whose
+// macros cannot be stripped is rejected.
+func (h *Convert) applyMacroPolicy(data []byte) ([]byte, string) {
+	if !filetype.HasMacros(bytes.NewReader(data), int64(len(data))) {
+		return data, ""
+	}
+	action := macroRejected
+	switch h.macros {
+	case filetype.MacroAllow:
+		action = macroAllowed
+	case filetype.MacroStrip:
+		if stripped, err := filetype.StripMacros(data); err == nil {
+			data, action = stripped, macroStripped
 		}
-		return
 	}
+	if h.onMacro != nil {
+		h.onMacro(action)
+	}
+	return data, action
+}
 
-	pdfData, err := os.ReadFile(pdfPath)
-	if err != nil || len(pdfData) == 0 {
-		middleware.SetOutcome(r.Context(), "failed")
-		middleware.SetLogError(r.Context(), "conversion produced no output")
-		writeError(w, http.StatusInternalServerError, "conversion produced no output")
-		return
+// param returns a conversion parameter. Multipart requests may send it as a
+// form field or query parameter; raw requests only have the query string.
+func (h *Convert) param(r *http.Request, name string) string {
+	if h.raw {
+		return r.URL.Query().Get(name)
 	}
+	return r.FormValue(name)
+}
 
-	middleware.SetOutcome(r.Context(), "success")
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(pdfData)))
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(pdfData)
+// options builds the converter options from request parameters, validating
+// them against the detected input type. Without an output parameter the
+// synchronous endpoints negotiate the format from the Accept header, where
+// application/json selects formatMetadata.
+func (h *Convert) options(w http.ResponseWriter, r *http.Request, ft filetype.Type) (converter.Options, *stageError) {
+	format := strings.ToLower(h.param(r, "output"))
+	if h.extract {
+		var ok bool
+		if format, ok = converter.TextFormat(ft.Ext, strings.ToLower(h.param(r, "format")) == extractJSON); !ok {
+			return converter.Options{}, fail(http.StatusUnsupportedMediaType, "text extraction not supported for input type", "text extraction is not supported for this document type")
+		}
+	}
+	if format == "" && h.jobs == nil && !h.pdfOnly {
+		w.Header().Add("Vary", "Accept")
+		var ok bool
+		if format, ok = negotiate(r.Header.Get("Accept"), ft); !ok {
+			return converter.Options{}, errNotAcceptable(ft)
+		}
+		if format == formatMetadata {
+			return converter.Options{Format: format}, nil
+		}
+	}
+	if format == "" {
+		format = converter.FormatPDF
+	}
+	if converter.ContentType(format) == "" {
+		return converter.Options{}, fail(http.StatusBadRequest, "unknown output format", "unsupported output format")
+	}
+	if !converter.Supports(ft.Ext, format) {
+		return converter.Options{}, fail(http.StatusBadRequest, "output format not supported for input type", "output format not supported for this document type")
+	}
+	version, err := h.pdfVersion(tenantID(r), format, h.param(r, "target_pdf_version"))
+	if err != nil {
+		return converter.Options{}, err
+	}
+	dpi, err := h.imageDPI(tenantID(r), format, h.param(r, "image_dpi"))
+	if err != nil {
+		return converter.Options{}, err
+	}
+	pages, orientation, err := pageOptions(format, h.param(r, "pages"), h.param(r, "orientation"))
+	if err != nil {
+		return converter.Options{}, err
+	}
+	if orientation != "" && !converter.SupportsOrientation(ft.Ext) {
+		return converter.Options{}, errOrientationNotSupported()
+	}
+	destinations, links, err := linkOptions(format, h.param(r, "named_destinations"), h.param(r, "convert_links"))
+	if err != nil {
+		return converter.Options{}, err
+	}
+	user, owner := h.param(r, "user_password"), h.param(r, "owner_password")
+	if err := checkPasswords(format, version, user, owner); err != nil {
+		return converter.Options{}, err
+	}
+	preview, err := h.previewParam(format, h.param(r, "fast"))
+	if err != nil {
+		return converter.Options{}, err
+	}
+	return converter.Options{
+		Format:            format,
+		PDFVersion:        version,
+		ImageDPI:          dpi,
+		Pages:             pages,
+		Orientation:       orientation,
+		NamedDestinations: destinations,
+		ConvertLinks:      links,
+		UserPassword:      user,
+		OwnerPassword:     owner,
+		Preview:           preview,
+	}, nil
+}
+
+// pageOptions validates the pages and orientation parameters for output in
+// format, returning them in converter.Options form. Whether the input type
+// can be turned is left to the caller.
+func pageOptions(format, pages, orientation string) (string, string, *stageError) {
+	if pages != "" {
+		var err error
+		if pages, err = converter.ParsePageRange(pages); err != nil {
+			return "", "", fail(http.StatusBadRequest, err.Error(), "invalid page range")
+		}
+		if format != converter.FormatPDF {
+			return "", "", fail(http.StatusBadRequest, "pages with non-pdf output", "pages requires pdf output")
+		}
+	}
+	switch orientation = strings.ToLower(orientation); orientation {
+	case "", converter.OrientationPortrait, converter.OrientationLandscape:
+	default:
+		return "", "", fail(http.StatusBadRequest, "invalid orientation", "orientation must be portrait or landscape")
+	}
+	return pages, orientation, nil
+}
+
+// linkOptions parses the named_destinations and convert_links parameters
+// for output in format.
+func linkOptions(format, destinations, links string) (bool, bool, *stageError) {
+	var flags [2]bool
+	for i, p := range []struct{ name, value string }{
+		{"named_destinations", destinations},
+		{"convert_links", links},
+	} {
+		if p.value == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(p.value)
+		if err != nil {
+			return false, false, fail(http.StatusBadRequest, "invalid "+p.name, p.name+" must be true or false")
+		}
+		if v && format != converter.FormatPDF {
+			return false, false, fail(http.StatusBadRequest, p.name+" with non-pdf output", p.name+" requires pdf output")
+		}
+		flags[i] = v
+	}
+	return flags[0], flags[1], nil
+}
+
+// errOrientationNotSupported is the 400 sent when orientation is given for
+// an input type whose page setup cannot be rewritten.
+func errOrientationNotSupported() *stageError {
+	return fail(http.StatusBadRequest, "orientation not supported for input type", "orientation not supported for this document type")
 }
 
 // Health handles GET /health requests.
@@ -137,17 +836,41 @@ func Health(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// hasDocxMagic returns true when data begins with the PK ZIP magic bytes.
-func hasDocxMagic(data []byte) bool {
-	if len(data) < 4 {
-		return false
-	}
-	return [4]byte(data[:4]) == docxMagic
+// writeError writes {"error": msg} as JSON with the given HTTP status, in
+// the shape of the response's API version and with msg in the language r
+// accepts.
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	writeJSON(w, status, errorBody(w, r, status, "", msg))
 }
 
-// writeError writes {"error": msg} as JSON with the given HTTP status.
-func writeError(w http.ResponseWriter, status int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+// Machine-readable error codes, sent alongside the message where a client
+// needs to tell one rejection from another with the same status.
+const (
+	codeTypeNotAllowed      = "type_not_allowed"
+	codeMacrosNotAllowed    = "macros_not_allowed"
+	codeNotAcceptable       = "not_acceptable"
+	codeEmptyUpload         = "empty_upload"
+	codeTruncatedUpload     = "truncated_upload"
+	codeUploadAborted       = "upload_aborted"
+	codePasswordProtected   = "password_protected"
+	codeDocumentProtected   = "document_protected"
+	codeInvalidPackage      = "invalid_package"
+	codePackageTooLarge     = "package_too_large"
+	codeResourceLimit       = "resource_limit"
+	codeInsufficientStorage = "insufficient_storage"
+)
+
+// writeErrorCode is writeError with a machine-readable "code" field.
+func writeErrorCode(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	writeJSON(w, status, errorBody(w, r, status, code, msg))
+}
+
+// tenantID returns the tenant a request is made for. An authenticated key
+// decides it; otherwise it is the X-Tenant-ID header set by the gateway in
+// front of the service.
+func tenantID(r *http.Request) string {
+	if k, ok := auth.FromContext(r.Context()); ok {
+		return k.Tenant
+	}
+	return r.Header.Get("X-Tenant-ID")
 }
@@ -1,45 +1,102 @@
 package handler_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/billing"
 	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
 	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/stats"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
 )
 
 // mockConverter is a test double for converter.Converter.
 type mockConverter struct {
 	mu      sync.Mutex
 	calls   []string
+	opts    []converter.Options
 	callsFn func(ctx context.Context, inputPath, outDir string) (string, error)
 }
 
-func (m *mockConverter) Convert(ctx context.Context, inputPath, outDir string) (string, error) {
+func (m *mockConverter) Convert(ctx context.Context, inputPath, outDir string, opts converter.Options) (string, error) {
 	m.mu.Lock()
 	m.calls = append(m.calls, inputPath)
+	m.opts = append(m.opts, opts)
 	m.mu.Unlock()
 	return m.callsFn(ctx, inputPath, outDir)
 }
 
-// docxMagic mirrors the magic bytes checked by the handler.
-var docxMagic = []byte{0x50, 0x4B, 0x03, 0x04}
-
-// validDocxBody returns a byte slice of size bytes starting with the PK magic header.
+// validDocxBody returns a well-formed DOCX-like ZIP of roughly size bytes:
+// its content types and a stored word/document.xml padded out to the
+// requested length.
 func validDocxBody(size int) []byte {
-	data := make([]byte, size)
-	copy(data, docxMagic)
-	return data
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "[Content_Types].xml", Method: zip.Store})
+	_, _ = w.Write([]byte("<Types/>"))
+	w, _ = zw.CreateHeader(&zip.FileHeader{Name: "word/document.xml", Method: zip.Store})
+	_, _ = w.Write(make([]byte, max(size-320, 0)))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// zipPackage returns a minimal OOXML-style ZIP containing the named parts.
+func zipPackage(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range append([]string{"[Content_Types].xml"}, parts...) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		_, _ = w.Write([]byte("<xml/>"))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// zipBomb returns a small DOCX-shaped ZIP whose document.xml claims to
+// expand to 1 TB.
+func zipBomb(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("[Content_Types].xml")
+	_, _ = w.Write([]byte("<Types/>"))
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "word/document.xml", Method: zip.Deflate,
+		CompressedSize64: 2, UncompressedSize64: 1 << 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte{0x03, 0x00})
+	_ = zw.Close()
+	return buf.Bytes()
 }
 
 // buildRequest constructs a multipart POST request with the given bytes as the "file" field.
@@ -100,8 +157,8 @@ func TestConvert_FileTooLarge(t *testing.T) {
 func TestConvert_WrongFileType(t *testing.T) {
 	h := handler.NewConvert(happyMock())
 	rr := httptest.NewRecorder()
-	// Plain text — no PK magic header.
-	h.ServeHTTP(rr, buildRequest(t, []byte("Hello, plain text")))
+	// PNG header — not a document format we recognise.
+	h.ServeHTTP(rr, buildRequest(t, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")))
 
 	if rr.Code != http.StatusUnsupportedMediaType {
 		t.Fatalf("expected 415, got %d: %s", rr.Code, rr.Body.String())
@@ -109,6 +166,654 @@ func TestConvert_WrongFileType(t *testing.T) {
 	assertJSONError(t, rr.Body.String())
 }
 
+func TestConvert_StagesInputWithDetectedExtension(t *testing.T) {
+	cases := map[string][]byte{
+		".docx": validDocxBody(512),
+		".xlsx": zipPackage(t, "xl/workbook.xml"),
+		".pptx": zipPackage(t, "ppt/presentation.xml"),
+		".rtf":  []byte(`{\rtf1\ansi Hello}`),
+		".txt":  []byte("Hello, plain text\n"),
+	}
+	for ext, body := range cases {
+		t.Run(ext, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, buildRequest(t, body))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 1 || filepath.Ext(mc.calls[0]) != ext {
+				t.Errorf("expected converter input with extension %s, got %v", ext, mc.calls)
+			}
+		})
+	}
+}
+
+func TestConvertRaw(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+		wantExt     string
+	}{
+		{"octet-stream sniffed", "application/octet-stream", validDocxBody(512), http.StatusOK, ".docx"},
+		{"no content type", "", []byte(`{\rtf1 Hi}`), http.StatusOK, ".rtf"},
+		{"declared matches", "text/plain; charset=utf-8", []byte("hello\n"), http.StatusOK, ".txt"},
+		{"declared mismatch", "text/plain", validDocxBody(512), http.StatusUnsupportedMediaType, ""},
+		{"unknown content type", "image/png", validDocxBody(512), http.StatusUnsupportedMediaType, ""},
+		{"empty body", "application/octet-stream", nil, http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvertRaw(mc)
+			req := httptest.NewRequest(http.MethodPost, "/convert/raw", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tc.wantExt == "" {
+				assertJSONError(t, rr.Body.String())
+				return
+			}
+			if len(mc.calls) != 1 || filepath.Ext(mc.calls[0]) != tc.wantExt {
+				t.Errorf("expected converter input with extension %s, got %v", tc.wantExt, mc.calls)
+			}
+		})
+	}
+}
+
+func TestConvert_OutputFormat(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+			outPath := filepath.Join(outDir, "input.png")
+			_ = os.WriteFile(outPath, []byte("\x89PNG fake"), 0600)
+			return outPath, nil
+		},
+	}
+	h := handler.NewConvert(mc)
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "output=png"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %s", ct)
+	}
+	if len(mc.opts) != 1 || mc.opts[0].Format != converter.FormatPNG {
+		t.Errorf("expected png forwarded to converter, got %+v", mc.opts)
+	}
+}
+
+func TestConvert_OutputFormatRejected(t *testing.T) {
+	cases := map[string]struct {
+		body   []byte
+		output string
+	}{
+		"unknown format":         {validDocxBody(512), "exe"},
+		"txt from spreadsheet":   {zipPackage(t, "xl/workbook.xml"), "txt"},
+		"docx from presentation": {zipPackage(t, "ppt/presentation.xml"), "docx"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, tc.body)
+			req.URL.RawQuery = "output=" + tc.output
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called for an invalid output format")
+			}
+			assertJSONError(t, rr.Body.String())
+		})
+	}
+}
+
+func TestConvert_PDFVersion(t *testing.T) {
+	cases := []struct {
+		name, query, tenant, want string
+	}{
+		{"requested", "target_pdf_version=PDF/A-2b", "", converter.PDFA2B},
+		{"request overrides tenant", "target_pdf_version=1.5", "archive", converter.PDF15},
+		{"tenant default", "", "archive", converter.PDFA1B},
+		{"global default", "", "other", converter.PDF17},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc, handler.WithPDFVersions(converter.PDF17, map[string]string{"archive": converter.PDFA1B}))
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = tc.query
+			req.Header.Set("X-Tenant-ID", tc.tenant)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.opts) != 1 || mc.opts[0].PDFVersion != tc.want {
+				t.Errorf("expected pdf version %q forwarded to converter, got %+v", tc.want, mc.opts)
+			}
+			// The header reports what was produced, here the mock's PDF 1.4.
+			if v := rr.Header().Get("X-PDF-Version"); v != "1.4" {
+				t.Errorf("expected X-PDF-Version 1.4, got %q", v)
+			}
+		})
+	}
+}
+
+func TestConvert_ImageDPI(t *testing.T) {
+	cases := []struct {
+		name, query, tenant string
+		want                int
+		header              string
+	}{
+		{"requested", "image_dpi=96", "", 96, "96"},
+		{"original overrides default", "image_dpi=original", "", 0, "original"},
+		{"tenant default", "", "print", 300, "300"},
+		{"global default", "", "", 150, "150"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc, handler.WithImageDPI(150, map[string]int{"print": 300}))
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = tc.query
+			req.Header.Set("X-Tenant-ID", tc.tenant)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.opts) != 1 || mc.opts[0].ImageDPI != tc.want {
+				t.Errorf("expected image dpi %d forwarded to converter, got %+v", tc.want, mc.opts)
+			}
+			if v := rr.Header().Get("X-Image-DPI"); v != tc.header {
+				t.Errorf("expected X-Image-DPI %q, got %q", tc.header, v)
+			}
+		})
+	}
+}
+
+func TestConvert_PDFOptionsRejected(t *testing.T) {
+	for name, query := range map[string]string{
+		"unknown version":   "target_pdf_version=2.0",
+		"not pdf output":    "output=png&target_pdf_version=1.7",
+		"image dpi too low": "image_dpi=10",
+		"image dpi for png": "output=png&image_dpi=300",
+		"bad link flag":     "named_destinations=yes",
+		"link flag for png": "output=png&convert_links=true",
+	} {
+		t.Run(name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = query
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called for invalid pdf options")
+			}
+			assertJSONError(t, rr.Body.String())
+		})
+	}
+}
+
+func TestConvert_LinkOptions(t *testing.T) {
+	mc := happyMock()
+	h := handler.NewConvert(mc)
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "named_destinations=true&convert_links=1"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := converter.Options{Format: converter.FormatPDF, NamedDestinations: true, ConvertLinks: true}
+	if len(mc.opts) != 1 || mc.opts[0] != want {
+		t.Errorf("expected %+v forwarded to converter, got %+v", want, mc.opts)
+	}
+}
+
+func TestConvert_Passwords(t *testing.T) {
+	mc := happyMock()
+	h := handler.NewConvert(mc)
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "user_password=open-sesame&owner_password=s3cret"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := converter.Options{Format: converter.FormatPDF, UserPassword: "open-sesame", OwnerPassword: "s3cret"}
+	if len(mc.opts) != 1 || mc.opts[0] != want {
+		t.Errorf("expected passwords forwarded to converter, got %v", mc.opts)
+	}
+}
+
+func TestConvert_PasswordsRejected(t *testing.T) {
+	for name, query := range map[string]string{
+		"png output": "output=png&user_password=open-sesame",
+		"pdf/a":      "target_pdf_version=pdfa-2b&owner_password=open-sesame",
+	} {
+		t.Run(name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = query
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called")
+			}
+			if strings.Contains(rr.Body.String(), "open-sesame") {
+				t.Errorf("error response leaks the password: %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestConvert_PageOptions(t *testing.T) {
+	mc := happyMock()
+	h := handler.NewConvert(mc)
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "pages=" + url.QueryEscape("1-3, 7") + "&orientation=Landscape"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := converter.Options{Format: converter.FormatPDF, Pages: "1-3,7", Orientation: converter.OrientationLandscape}
+	if len(mc.opts) != 1 || mc.opts[0] != want {
+		t.Errorf("expected %+v forwarded to converter, got %+v", want, mc.opts)
+	}
+}
+
+func TestConvert_PageOptionsRejected(t *testing.T) {
+	cases := map[string]struct {
+		body  []byte
+		query string
+	}{
+		"bad range":              {validDocxBody(512), "pages=3-1"},
+		"pages for png":          {validDocxBody(512), "output=png&pages=1"},
+		"unknown orientation":    {validDocxBody(512), "orientation=sideways"},
+		"orientation for slides": {zipPackage(t, "ppt/presentation.xml"), "orientation=portrait"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, tc.body)
+			req.URL.RawQuery = tc.query
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called for invalid page options")
+			}
+			assertJSONError(t, rr.Body.String())
+		})
+	}
+}
+
+func TestConvert_TypeNotAllowed(t *testing.T) {
+	policy, err := filetype.ParsePolicy("docx,odt", "acme=odt")
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	cases := []struct {
+		name   string
+		tenant string
+		body   []byte
+		want   int
+	}{
+		{"allowed globally", "", validDocxBody(512), http.StatusOK},
+		{"not allowed globally", "", zipPackage(t, "xl/workbook.xml"), http.StatusUnsupportedMediaType},
+		{"not allowed for tenant", "acme", validDocxBody(512), http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc, handler.WithPolicy(policy))
+			req := buildRequest(t, tc.body)
+			if tc.tenant != "" {
+				req.Header.Set("X-Tenant-ID", tc.tenant)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+			if tc.want == http.StatusOK {
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body["code"] != "type_not_allowed" {
+				t.Errorf("expected code type_not_allowed, got %q", body["code"])
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called for a disallowed type")
+			}
+		})
+	}
+}
+
+func TestConvert_TenantFromAPIKeyOverridesHeader(t *testing.T) {
+	policy, err := filetype.ParsePolicy("", "acme=odt")
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	ks, err := auth.NewKeystore([]auth.Key{{Name: "team-a", Secret: "s3cret", Tenant: "acme"}}, "")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	h := auth.Middleware(ks, handler.NewConvert(happyMock(), handler.WithPolicy(policy)))
+	req := buildRequest(t, validDocxBody(512))
+	req.Header.Set("X-API-Key", "s3cret")
+	req.Header.Set("X-Tenant-ID", "someone-else")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected the key's tenant rule to apply (415), got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConvert_MacroPolicy(t *testing.T) {
+	docm := zipPackage(t, "word/document.xml", "word/vbaProject.bin")
+	cases := []struct {
+		policy filetype.MacroPolicy
+		want   int
+	}{
+		{filetype.MacroReject, http.StatusUnsupportedMediaType},
+		{filetype.MacroStrip, http.StatusOK},
+		{filetype.MacroAllow, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			var staged []byte
+			mc := &mockConverter{callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+				staged, _ = os.ReadFile(inputPath)
+				return happyMock().callsFn(context.Background(), inputPath, outDir)
+			}}
+			var actions []string
+			h := handler.NewConvert(mc, handler.WithMacroPolicy(tc.policy, func(a string) { actions = append(actions, a) }))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, buildRequest(t, docm))
+
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+			if len(actions) != 1 {
+				t.Fatalf("expected one macro action, got %v", actions)
+			}
+			switch tc.policy {
+			case filetype.MacroReject:
+				if !strings.Contains(rr.Body.String(), `"code":"macros_not_allowed"`) {
+					t.Errorf("expected macros_not_allowed code, got %s", rr.Body.String())
+				}
+			case filetype.MacroStrip:
+				if filetype.HasMacros(bytes.NewReader(staged), int64(len(staged))) {
+					t.Error("converter received a document with macros")
+				}
+			case filetype.MacroAllow:
+				if !bytes.Equal(staged, docm) {
+					t.Error("converter should receive the upload unchanged")
+				}
+			}
+		})
+	}
+}
+
+func TestConvert_ProtectionPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml":   "<w:document/>",
+		"word/settings.xml":   `<w:settings><w:writeProtection w:recommended="1"/></w:settings>`,
+	} {
+		w, _ := zw.Create(name)
+		_, _ = w.Write([]byte(body))
+	}
+	_ = zw.Close()
+	readOnly := buf.Bytes()
+
+	cases := []struct {
+		policy filetype.ProtectionPolicy
+		want   int
+		action string
+	}{
+		{filetype.ProtectionHonor, http.StatusUnprocessableEntity, "rejected"},
+		{filetype.ProtectionIgnore, http.StatusOK, "ignored"},
+		{filetype.ProtectionWarn, http.StatusOK, "warned"},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			var staged []byte
+			mc := &mockConverter{callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+				staged, _ = os.ReadFile(inputPath)
+				return happyMock().callsFn(context.Background(), inputPath, outDir)
+			}}
+			var actions []string
+			h := handler.NewConvert(mc, handler.WithProtectionPolicy(tc.policy, func(a string) { actions = append(actions, a) }))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, buildRequest(t, readOnly))
+
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+			if len(actions) != 1 || actions[0] != tc.action {
+				t.Fatalf("expected action %q, got %v", tc.action, actions)
+			}
+			warning := rr.Header().Get("Warning")
+			switch tc.policy {
+			case filetype.ProtectionHonor:
+				if !strings.Contains(rr.Body.String(), `"code":"document_protected"`) {
+					t.Errorf("expected document_protected code, got %s", rr.Body.String())
+				}
+			case filetype.ProtectionIgnore:
+				if warning != "" {
+					t.Errorf("unexpected Warning %q", warning)
+				}
+			case filetype.ProtectionWarn:
+				if !strings.HasPrefix(warning, "299 - ") || !strings.Contains(warning, "read-only") {
+					t.Errorf("expected a read-only Warning, got %q", warning)
+				}
+			}
+			if tc.want == http.StatusOK && filetype.Protected(bytes.NewReader(staged), int64(len(staged))) {
+				t.Error("converter received a protected document")
+			}
+		})
+	}
+}
+
+func TestConvert_DropsExternalTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml":   "<w:document/>",
+		"word/settings.xml":   `<w:settings><w:attachedTemplate r:id="rId1"/></w:settings>`,
+		"word/_rels/settings.xml.rels": `<Relationships><Relationship Id="rId1" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/attachedTemplate" ` +
+			`Target="file:///\\corp-fs01\Templates\Normal.dotm" TargetMode="External"/></Relationships>`,
+	} {
+		w, _ := zw.Create(name)
+		_, _ = w.Write([]byte(body))
+	}
+	_ = zw.Close()
+
+	var staged []byte
+	mc := &mockConverter{callsFn: func(_ context.Context, inputPath, outDir string) (string, error) {
+		staged, _ = os.ReadFile(inputPath)
+		return happyMock().callsFn(context.Background(), inputPath, outDir)
+	}}
+	stripped := 0
+	h := handler.NewConvert(mc, handler.WithTemplateObserver(func() { stripped++ }))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, buf.Bytes()))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if filetype.HasExternalTemplate(bytes.NewReader(staged), int64(len(staged))) {
+		t.Error("converter received the external template reference")
+	}
+	if stripped != 1 {
+		t.Errorf("expected the observer to be called once, got %d", stripped)
+	}
+}
+
+// usageRecorder is a billing exporter that keeps the last export.
+type usageRecorder struct{ usage []billing.Usage }
+
+func (u *usageRecorder) Export(_ context.Context, usage []billing.Usage) error {
+	u.usage = usage
+	return nil
+}
+
+func TestConvert_BillsTenant(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			_ = os.WriteFile(pdfPath, []byte("%PDF-1.4\n<</Type /Page>>\n<</Type /Page>>\n"), 0600)
+			return pdfPath, nil
+		},
+	}
+	rec := &usageRecorder{}
+	meter := billing.New(billing.Config{Exporter: rec, Pricing: billing.Pricing{PerPage: 1}})
+	h := handler.NewConvert(mc, handler.WithBilling(meter))
+
+	req := buildRequest(t, validDocxBody(1024))
+	req.Header.Set("X-Tenant-ID", "acme")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// A failed conversion is not billed.
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, nil))
+
+	if err := meter.Export(context.Background()); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(rec.usage) != 1 {
+		t.Fatalf("expected usage for one tenant, got %+v", rec.usage)
+	}
+	u := rec.usage[0]
+	if u.Tenant != "acme" || u.Conversions != 1 || u.Pages != 2 || u.CostUnits != 2 {
+		t.Errorf("unexpected usage %+v", u)
+	}
+	if u.InputBytes == 0 || u.OutputBytes == 0 {
+		t.Errorf("expected byte counts, got %+v", u)
+	}
+}
+
+func TestConvert_MacrosRejectedByDefault(t *testing.T) {
+	h := handler.NewConvert(happyMock())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, zipPackage(t, "xl/workbook.xml", "xl/vbaProject.bin")))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConvert_Delivery(t *testing.T) {
+	cases := []struct {
+		name            string
+		query           string
+		wantCT          string
+		wantDisposition string
+	}{
+		{"default", "", "application/pdf", ""},
+		{"inline", "disposition=inline", "application/pdf", `inline; filename=test.pdf`},
+		{"attachment", "disposition=attachment", "application/pdf", `attachment; filename=test.pdf`},
+		{"octet-stream override", "content_type=application/octet-stream", "application/octet-stream", ""},
+		{"same major type", "content_type=application/x-pdf&disposition=attachment", "application/x-pdf", `attachment; filename=test.pdf`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handler.NewConvert(happyMock())
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = tc.query
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tc.wantCT {
+				t.Errorf("expected Content-Type %q, got %q", tc.wantCT, ct)
+			}
+			if cd := rr.Header().Get("Content-Disposition"); cd != tc.wantDisposition {
+				t.Errorf("expected Content-Disposition %q, got %q", tc.wantDisposition, cd)
+			}
+		})
+	}
+}
+
+func TestConvert_DeliveryRejected(t *testing.T) {
+	for _, query := range []string{
+		"disposition=download",
+		"content_type=text/html",
+		"content_type=image/png",
+		"content_type=not a type",
+	} {
+		t.Run(query, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = query
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called for invalid delivery parameters")
+			}
+		})
+	}
+}
+
 func TestConvert_TimeoutSimulation(t *testing.T) {
 	mc := &mockConverter{
 		callsFn: func(_ context.Context, _, _ string) (string, error) {
@@ -125,6 +830,108 @@ func TestConvert_TimeoutSimulation(t *testing.T) {
 	assertJSONError(t, rr.Body.String())
 }
 
+func TestConvert_ResourceLimit(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, _, _ string) (string, error) {
+			return "", &converter.LimitError{Resource: converter.ResourceRSS}
+		},
+	}
+	var got []string
+	h := handler.NewConvert(mc, handler.WithLimitObserver(func(resource string) { got = append(got, resource) }))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"code":"resource_limit"`) {
+		t.Errorf("expected code resource_limit: %s", rr.Body.String())
+	}
+	if len(got) != 1 || got[0] != converter.ResourceRSS {
+		t.Errorf("observed %v, want [rss]", got)
+	}
+}
+
+// blockingMock returns a mockConverter that waits for its context to end, as
+// LibreOffice does when killed, and reports a generic failure.
+func blockingMock() *mockConverter {
+	return &mockConverter{
+		callsFn: func(ctx context.Context, _, _ string) (string, error) {
+			<-ctx.Done()
+			return "", fmt.Errorf("%w: signal: killed", converter.ErrConversionFailed)
+		},
+	}
+}
+
+func TestConvert_RequestDeadlineAbortsConversion(t *testing.T) {
+	h := middleware.Timeout(50*time.Millisecond, handler.NewConvert(blockingMock()))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestConvert_ClientDisconnectAbortsConversion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := buildRequest(t, validDocxBody(1024)).WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.NewConvert(blockingMock()).ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("conversion kept running after the client went away")
+	}
+}
+
+func TestConvert_WatchdogCancelReturns503(t *testing.T) {
+	wd := watchdog.New(watchdog.Config{
+		Threshold: 0.5,
+		Interval:  5 * time.Millisecond,
+		Usage:     func() (uint64, uint64, error) { return 90, 100, nil },
+	})
+	defer wd.Close()
+
+	mc := &mockConverter{
+		callsFn: func(ctx context.Context, _, _ string) (string, error) {
+			<-ctx.Done()
+			return "", fmt.Errorf("%w: killed", converter.ErrConversionFailed)
+		},
+	}
+	h := handler.NewConvert(mc, handler.WithWatchdog(wd))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestConvert_RecordsStats(t *testing.T) {
+	rec, _ := stats.New(stats.Config{})
+	h := handler.NewConvert(happyMock(), handler.WithStats(rec))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, zipPackage(t, "word/document.xml")))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rec.Snapshot()["docx"].Count; got != 1 {
+		t.Errorf("expected 1 docx conversion recorded, got %d", got)
+	}
+}
+
 func TestConvert_ConcurrentRequestsAllSucceed(t *testing.T) {
 	// With per-request profile isolation, concurrent calls are safe.
 	// Verify that N simultaneous requests all complete successfully.
@@ -201,6 +1008,161 @@ func TestConvert_MissingFileField(t *testing.T) {
 	}
 }
 
+func TestConvert_FormFieldsAroundFile(t *testing.T) {
+	// Parameters may come before or after the streamed file part.
+	for name, fieldFirst := range map[string]bool{"before": true, "after": false} {
+		t.Run(name, func(t *testing.T) {
+			mc := &mockConverter{
+				callsFn: func(_ context.Context, _, outDir string) (string, error) {
+					outPath := filepath.Join(outDir, "input.png")
+					_ = os.WriteFile(outPath, []byte("\x89PNG fake"), 0600)
+					return outPath, nil
+				},
+			}
+			h := handler.NewConvert(mc)
+
+			var buf bytes.Buffer
+			mw := multipart.NewWriter(&buf)
+			if fieldFirst {
+				_ = mw.WriteField("output", "png")
+			}
+			fw, _ := mw.CreateFormFile("file", "test.docx")
+			_, _ = fw.Write(validDocxBody(512))
+			if !fieldFirst {
+				_ = mw.WriteField("output", "png")
+			}
+			_ = mw.Close()
+			req := httptest.NewRequest(http.MethodPost, "/convert", &buf)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.opts) != 1 || mc.opts[0].Format != converter.FormatPNG {
+				t.Errorf("expected png forwarded to converter, got %+v", mc.opts)
+			}
+		})
+	}
+}
+
+func TestConvert_OversizedUploadNotKept(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	h := handler.NewConvert(happyMock())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(11<<20)))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Fatalf("expected no staged files left, found %d", len(entries))
+	}
+}
+
+func TestConvert_BadUploads(t *testing.T) {
+	docx := validDocxBody(1024)
+	var partial bytes.Buffer
+	mw := multipart.NewWriter(&partial)
+	fw, _ := mw.CreateFormFile("file", "test.docx")
+	_, _ = fw.Write(docx)
+	// No closing boundary: the client stopped sending mid-upload.
+
+	cases := map[string]struct {
+		req    *http.Request
+		status int
+		code   string
+		reason string
+	}{
+		"empty file":     {buildRequest(t, nil), http.StatusBadRequest, "empty_upload", "empty"},
+		"truncated":      {buildRequest(t, docx[:len(docx)-40]), http.StatusUnprocessableEntity, "truncated_upload", "truncated"},
+		"aborted":        {httptest.NewRequest(http.MethodPost, "/convert", &partial), http.StatusBadRequest, "upload_aborted", "aborted"},
+		"empty raw body": {httptest.NewRequest(http.MethodPost, "/convert/raw", nil), http.StatusBadRequest, "empty_upload", "empty"},
+		"not a package":  {buildRequest(t, zipPackage(t, "notes.txt")), http.StatusUnsupportedMediaType, "invalid_package", "invalid_package"},
+		"zip bomb":       {buildRequest(t, zipBomb(t)), http.StatusRequestEntityTooLarge, "package_too_large", "package_too_large"},
+	}
+	cases["aborted"].req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mc := happyMock()
+			var reasons []string
+			newHandler := handler.NewConvert
+			if tc.req.URL.Path == "/convert/raw" {
+				newHandler = handler.NewConvertRaw
+			}
+			h := newHandler(mc, handler.WithUploadObserver(func(r string) { reasons = append(reasons, r) }))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, tc.req)
+
+			if rr.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), `"code":"`+tc.code+`"`) {
+				t.Errorf("expected code %s, got %s", tc.code, rr.Body.String())
+			}
+			if len(reasons) != 1 || reasons[0] != tc.reason {
+				t.Errorf("expected upload observer to see %q, got %v", tc.reason, reasons)
+			}
+			if len(mc.calls) != 0 {
+				t.Errorf("converter should not run, got %v", mc.calls)
+			}
+		})
+	}
+}
+
+func TestConvert_PasswordProtected(t *testing.T) {
+	protected, err := os.ReadFile("../filetype/testdata/protected.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]struct {
+		password string
+		status   int
+	}{
+		"no password":    {"", http.StatusUnprocessableEntity},
+		"wrong password": {"let-me-in", http.StatusUnprocessableEntity},
+		"password":       {"open-sesame", http.StatusOK},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var staged []byte
+			mc := &mockConverter{callsFn: func(ctx context.Context, inputPath, outDir string) (string, error) {
+				staged, _ = os.ReadFile(inputPath)
+				return happyMock().callsFn(ctx, inputPath, outDir)
+			}}
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, protected)
+			req.URL.RawQuery = url.Values{"document_password": {tc.password}}.Encode()
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				if !strings.Contains(rr.Body.String(), `"code":"password_protected"`) {
+					t.Errorf("expected code password_protected, got %s", rr.Body.String())
+				}
+				if len(mc.calls) != 0 {
+					t.Errorf("converter should not run, got %v", mc.calls)
+				}
+				return
+			}
+			if len(mc.calls) != 1 || filepath.Ext(mc.calls[0]) != ".docx" {
+				t.Fatalf("expected the document staged as .docx, got %v", mc.calls)
+			}
+			if !bytes.HasPrefix(staged, []byte("PK")) {
+				t.Error("converter was given the encrypted file, not the decrypted package")
+			}
+		})
+	}
+}
+
 func TestConvert_MethodNotAllowed(t *testing.T) {
 	h := handler.NewConvert(happyMock())
 	req := httptest.NewRequest(http.MethodGet, "/convert", nil)
@@ -212,6 +1174,558 @@ func TestConvert_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestConvert_QueueFullRejectsBeforeReadingBody(t *testing.T) {
+	p := pool.New(1, 0)
+	release, _ := p.Acquire(context.Background())
+	defer release()
+
+	h := handler.NewConvert(happyMock(), handler.WithPool(p))
+	req := buildRequest(t, validDocxBody(1024))
+	body := &readTracker{r: req.Body}
+	req.Body = body
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	if body.read {
+		t.Error("request body was read before rejecting")
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+// skipWithoutFreeDisk skips a test of the free-space guard where free space
+// cannot be read and the guard never refuses.
+func skipWithoutFreeDisk(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("free disk space is not read on " + runtime.GOOS)
+	}
+}
+
+func TestConvert_LowDiskRejectsBeforeReadingBody(t *testing.T) {
+	skipWithoutFreeDisk(t)
+	mc := happyMock()
+	h := handler.NewConvert(mc, handler.WithMinFreeDisk(1<<62))
+	req := buildRequest(t, validDocxBody(1024))
+	body := &readTracker{r: req.Body}
+	req.Body = body
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	if !strings.Contains(rr.Body.String(), `"code":"insufficient_storage"`) {
+		t.Errorf("expected code insufficient_storage, got %s", rr.Body.String())
+	}
+	if body.read {
+		t.Error("request body was read before rejecting")
+	}
+	if len(mc.calls) != 0 {
+		t.Errorf("expected no conversion, got %v", mc.calls)
+	}
+}
+
+func TestConvert_EnoughDiskConverts(t *testing.T) {
+	h := handler.NewConvert(happyMock(), handler.WithMinFreeDisk(1))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConvert_QueuedRequestGetsEarlyHint(t *testing.T) {
+	p := pool.New(1, 1)
+	release, _ := p.Acquire(context.Background())
+
+	srv := httptest.NewServer(handler.NewConvert(happyMock(), handler.WithPool(p)))
+	defer srv.Close()
+
+	var hintPos string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hintPos = header.Get("X-Queue-Position")
+				release() // let the queued request through
+			}
+			return nil
+		},
+	}
+
+	req := buildRequest(t, validDocxBody(1024))
+	out, err := http.NewRequestWithContext(
+		httptrace.WithClientTrace(context.Background(), trace),
+		http.MethodPost, srv.URL+"/convert", req.Body)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	out.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+
+	resp, err := http.DefaultClient.Do(out)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if hintPos != "1" {
+		t.Errorf("expected X-Queue-Position 1 in early hint, got %q", hintPos)
+	}
+	if got := resp.Header.Get("X-Queue-Position"); got != "" {
+		t.Errorf("final response kept the stale X-Queue-Position %q", got)
+	}
+}
+
+func TestConvert_ExpectContinueOversizedNeverUploads(t *testing.T) {
+	srv := httptest.NewServer(handler.NewConvert(happyMock()))
+	defer srv.Close()
+
+	req := buildRequest(t, validDocxBody(11<<20))
+	body := &readTracker{r: req.Body}
+	out, err := http.NewRequest(http.MethodPost, srv.URL+"/convert", body)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	out.ContentLength = req.ContentLength
+	out.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+	out.Header.Set("Expect", "100-continue")
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	resp, err := client.Do(out)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", resp.StatusCode)
+	}
+	if body.read {
+		t.Error("client uploaded the body even though the server rejected it up front")
+	}
+}
+
+func TestConvertAsync_Lifecycle(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+
+	release := make(chan struct{})
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+			<-release
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			_ = os.WriteFile(pdfPath, []byte("%PDF-1.4 async"), 0600)
+			return pdfPath, nil
+		},
+	}
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("/convert/async", handler.NewConvertAsync(mc, mgr))
+	mux.HandleFunc("GET /jobs/{id}", jh.Status)
+	mux.HandleFunc("GET /jobs/{id}/result", jh.Result)
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.Path = "/convert/async"
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var job struct {
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+		ResultURL string `json:"result_url"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if job.ID == "" || rr.Header().Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("expected job ID and Location header, got %+v / %q", job, rr.Header().Get("Location"))
+	}
+
+	// Result is not available while the job is still pending.
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result", nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 before completion, got %d", rr.Code)
+	}
+
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for job.Status != "succeeded" {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never succeeded, last status %q", job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID, nil))
+		_ = json.Unmarshal(rr.Body.Bytes(), &job)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, job.ResultURL, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for result, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("expected application/pdf, got %s", ct)
+	}
+	if rr.Body.String() != "%PDF-1.4 async" {
+		t.Errorf("unexpected result body %q", rr.Body.String())
+	}
+
+	// A download can be resumed with a Range request.
+	req = httptest.NewRequest(http.MethodGet, job.ResultURL, nil)
+	req.Header.Set("Range", "bytes=9-")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "async" {
+		t.Errorf("expected 206 with the tail of the result, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConvert_StreamsResult(t *testing.T) {
+	h := handler.NewConvert(happyMock())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if cl := rr.Header().Get("Content-Length"); cl != strconv.Itoa(len("%PDF-1.4 fake")) {
+		t.Errorf("Content-Length = %q, want the result size", cl)
+	}
+	if ar := rr.Header().Get("Accept-Ranges"); ar != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", ar)
+	}
+
+	req := buildRequest(t, validDocxBody(1024))
+	req.Header.Set("Range", "bytes=0-7")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Body.String() != "%PDF-1.4" {
+		t.Errorf("unexpected range body %q", rr.Body.String())
+	}
+	if cr := rr.Header().Get("Content-Range"); cr != "bytes 0-7/13" {
+		t.Errorf("Content-Range = %q", cr)
+	}
+}
+
+func TestJobs_NotFound(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{})
+	defer mgr.Close()
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", jh.Status)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/nope", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestJobs_ListMine(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	ks, err := auth.NewKeystore([]auth.Key{
+		{Name: "team-a", Secret: "secret-a", Tenant: "acme"},
+		{Name: "team-b", Secret: "secret-b"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("POST /convert/async", handler.NewConvertAsync(happyMock(), mgr))
+	mux.HandleFunc("GET /jobs", jh.List)
+	mux.HandleFunc("GET /jobs/{id}", jh.Status)
+	h := auth.Middleware(ks, mux)
+
+	submit := func(secret string) string {
+		t.Helper()
+		req := buildRequest(t, validDocxBody(512))
+		req.URL.Path = "/convert/async"
+		req.Header.Set("X-API-Key", secret)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var job struct{ ID string }
+		_ = json.Unmarshal(rr.Body.Bytes(), &job)
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if j, _ := mgr.Get(job.ID); j.State.Terminal() {
+				return job.ID
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("job never finished")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	first := submit("secret-a")
+	submit("secret-b")
+	second := submit("secret-a")
+
+	req := httptest.NewRequest(http.MethodGet, "/jobs?mine=true", nil)
+	req.Header.Set("X-API-Key", "secret-a")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list struct {
+		Jobs []struct {
+			ID         string    `json:"id"`
+			Status     string    `json:"status"`
+			UpdatedAt  time.Time `json:"updated_at"`
+			ResultURL  string    `json:"result_url"`
+			DocType    string    `json:"doc_type"`
+			Format     string    `json:"format"`
+			InputSize  int64     `json:"input_size"`
+			ResultSize int64     `json:"result_size"`
+			ExpiresAt  time.Time `json:"expires_at"`
+		} `json:"jobs"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list.Jobs) != 2 || list.Jobs[0].ID != second || list.Jobs[1].ID != first {
+		t.Fatalf("expected team-a's two jobs newest first, got %s", rr.Body.String())
+	}
+	j := list.Jobs[0]
+	if j.Status != "succeeded" || j.ResultURL != "/jobs/"+second+"/result" || j.DocType != "docx" || j.Format != "pdf" {
+		t.Errorf("unexpected entry %+v", j)
+	}
+	if j.InputSize == 0 || j.ResultSize != int64(len("%PDF-1.4 fake")) {
+		t.Errorf("sizes = %d, %d", j.InputSize, j.ResultSize)
+	}
+	if !j.ExpiresAt.Equal(j.UpdatedAt.Add(time.Hour)) {
+		t.Errorf("expires_at = %v, want an hour after %v", j.ExpiresAt, j.UpdatedAt)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/jobs?mine=true&limit=1", nil)
+	req.Header.Set("X-API-Key", "secret-a")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Jobs) != 1 || list.Jobs[0].ID != second {
+		t.Errorf("expected only the newest job with limit=1, got %s", rr.Body.String())
+	}
+}
+
+func TestJobs_OtherCallersJobsNotFound(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	ks, err := auth.NewKeystore([]auth.Key{
+		{Name: "team-a", Secret: "secret-a", Tenant: "acme"},
+		{Name: "team-b", Secret: "secret-b", Tenant: "acme"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("POST /convert/async", handler.NewConvertAsync(happyMock(), mgr))
+	mux.HandleFunc("GET /jobs/{id}", jh.Status)
+	mux.HandleFunc("GET /jobs/{id}/result", jh.Result)
+	mux.HandleFunc("POST /jobs/{id}/feedback", jh.Feedback)
+	h := auth.Middleware(ks, mux)
+	do := func(req *http.Request, secret string) *httptest.ResponseRecorder {
+		req.Header.Set("X-API-Key", secret)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.Path = "/convert/async"
+	rr := do(req, "secret-a")
+	var job struct{ ID string }
+	_ = json.Unmarshal(rr.Body.Bytes(), &job)
+	deadline := time.Now().Add(2 * time.Second)
+	for j, _ := mgr.Get(job.ID); !j.State.Terminal(); j, _ = mgr.Get(job.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("job never finished")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// team-b shares the tenant but not the key.
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID, nil),
+		httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result", nil),
+		httptest.NewRequest(http.MethodPost, "/jobs/"+job.ID+"/feedback", strings.NewReader(`{"rating":1}`)),
+	} {
+		if rr := do(req, "secret-b"); rr.Code != http.StatusNotFound {
+			t.Errorf("%s %s by another key: %d, want 404", req.Method, req.URL.Path, rr.Code)
+		}
+	}
+	if j, _ := mgr.Get(job.ID); j.Feedback != nil {
+		t.Error("another key's feedback was stored")
+	}
+	if rr := do(httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result", nil), "secret-a"); rr.Code != http.StatusOK {
+		t.Errorf("owner's download: %d", rr.Code)
+	}
+}
+
+func TestJobs_ListRejected(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{})
+	defer mgr.Close()
+	ks, err := auth.NewKeystore([]auth.Key{{Name: "team-a", Secret: "secret-a"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := http.HandlerFunc(handler.NewJobs(mgr).List)
+
+	for _, tc := range []struct {
+		name   string
+		h      http.Handler
+		target string
+		want   int
+	}{
+		{"without mine", auth.Middleware(ks, list), "/jobs", http.StatusBadRequest},
+		{"bad limit", auth.Middleware(ks, list), "/jobs?mine=true&limit=0", http.StatusBadRequest},
+		{"limit too large", auth.Middleware(ks, list), "/jobs?mine=true&limit=101", http.StatusBadRequest},
+		{"no api key", list, "/jobs?mine=true", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			req.Header.Set("X-API-Key", "secret-a")
+			rr := httptest.NewRecorder()
+			tc.h.ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+			assertJSONError(t, rr.Body.String())
+		})
+	}
+}
+
+func TestJobs_Feedback(t *testing.T) {
+	var rated []jobs.Job
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, LibreOffice: "24.2.1.2",
+		OnFeedback: func(j jobs.Job) { rated = append(rated, j) }})
+	defer mgr.Close()
+	finish := func(err error) string {
+		t.Helper()
+		j, _ := mgr.Submit(jobs.Job{DocType: "docx", Format: "pdf"}, func(context.Context, jobs.Job) (string, error) {
+			return "/result.pdf", err
+		})
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if done, _ := mgr.Get(j.ID); done.State.Terminal() {
+				return j.ID
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("job never finished")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	succeeded, failed := finish(nil), finish(errors.New("conversion failed"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs/{id}/feedback", handler.NewJobs(mgr).Feedback)
+	send := func(id, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/jobs/"+id+"/feedback", strings.NewReader(body)))
+		return rr
+	}
+
+	for _, tc := range []struct {
+		name, id, body string
+		want           int
+	}{
+		{"not json", succeeded, "great", http.StatusBadRequest},
+		{"unknown field", succeeded, `{"rating":3,"stars":3}`, http.StatusBadRequest},
+		{"no rating", succeeded, `{"note":"tables shifted"}`, http.StatusBadRequest},
+		{"rating too high", succeeded, `{"rating":6}`, http.StatusBadRequest},
+		{"note too long", succeeded, `{"rating":2,"note":"` + strings.Repeat("x", 2001) + `"}`, http.StatusBadRequest},
+		{"unknown job", "nope", `{"rating":2}`, http.StatusNotFound},
+		{"failed job", failed, `{"rating":2}`, http.StatusConflict},
+	} {
+		if rr := send(tc.id, tc.body); rr.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+	if len(rated) != 0 {
+		t.Fatalf("rejected feedback was observed: %+v", rated)
+	}
+
+	rr := send(succeeded, `{"rating":2,"note":" tables shifted "}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got struct {
+		Rating int
+		Note   string
+		At     time.Time
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || got.Rating != 2 || got.Note != "tables shifted" || got.At.IsZero() {
+		t.Errorf("feedback response %s", rr.Body.String())
+	}
+	j, _ := mgr.Get(succeeded)
+	if j.Feedback == nil || j.Feedback.Rating != 2 || j.LibreOffice != "24.2.1.2" {
+		t.Errorf("stored job %+v", j)
+	}
+	if len(rated) != 1 || rated[0].ID != succeeded {
+		t.Errorf("observed %+v", rated)
+	}
+
+	if rr := send(succeeded, `{"rating":5}`); rr.Code != http.StatusConflict {
+		t.Errorf("second feedback: expected 409, got %d", rr.Code)
+	}
+}
+
+func TestConvert_ObservesSizes(t *testing.T) {
+	var docType string
+	var in, out int64
+	h := handler.NewConvert(happyMock(), handler.WithSizeObserver(func(t string, i, o int64) {
+		docType, in, out = t, i, o
+	}))
+	body := validDocxBody(1024)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, body))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if docType != "docx" || in != int64(len(body)) || out != int64(len("%PDF-1.4 fake")) {
+		t.Errorf("observed %q, %d, %d", docType, in, out)
+	}
+}
+
+// readTracker records whether a request body was read.
+type readTracker struct {
+	r    io.ReadCloser
+	read bool
+}
+
+func (rt *readTracker) Read(p []byte) (int, error) {
+	rt.read = true
+	return rt.r.Read(p)
+}
+
+func (rt *readTracker) Close() error { return rt.r.Close() }
+
 func TestHealth(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	rr := httptest.NewRecorder()
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// WithImageDPI sets the resolution images in PDF results are downsampled to
+// for requests without an image_dpi: tenants' entry for the request's
+// tenant, else def. 0 keeps images at their own resolution.
+func WithImageDPI(def int, tenants map[string]int) Option {
+	return func(h *Convert) {
+		h.defaultImageDPI = def
+		h.tenantImageDPI = tenants
+	}
+}
+
+// imageDPI resolves the image resolution for output in format for tenant,
+// from the requested image_dpi or else the configured defaults, which only
+// apply to PDF output.
+func (h *Convert) imageDPI(tenant, format, requested string) (int, *stageError) {
+	if requested == "" {
+		if format != converter.FormatPDF {
+			return 0, nil
+		}
+		if dpi, ok := h.tenantImageDPI[tenant]; ok {
+			return dpi, nil
+		}
+		return h.defaultImageDPI, nil
+	}
+	dpi, err := converter.ParseImageDPI(requested)
+	if err != nil {
+		return 0, fail(http.StatusBadRequest, err.Error(), "image_dpi must be between 50 and 1200, or original")
+	}
+	if format != converter.FormatPDF {
+		return 0, fail(http.StatusBadRequest, "image_dpi with non-pdf output", "image_dpi requires pdf output")
+	}
+	return dpi, nil
+}
+
+// setImageDPI reports the image resolution applied to a PDF result in the
+// X-Image-DPI header: dots per inch, or "original".
+func setImageDPI(w http.ResponseWriter, dpi int) {
+	v := converter.ImageDPIOriginal
+	if dpi != 0 {
+		v = strconv.Itoa(dpi)
+	}
+	w.Header().Set("X-Image-DPI", v)
+}
@@ -0,0 +1,395 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+)
+
+// NewConvertAsync returns a Convert handler for POST /convert/async. The
+// upload is validated exactly as on /convert, then handed to mgr and answered
+// with 202 and the job's status; the conversion runs in the background.
+func NewConvertAsync(conv converter.Converter, mgr *jobs.Manager, opts ...Option) *Convert {
+	h := NewConvert(conv, opts...)
+	h.jobs = mgr
+	return h
+}
+
+// enqueue hands the staged upload's directory to a new job on mgr and
+// answers 202.
+// The directory outlives the request; the manager removes it when the job
+// expires.
+func (h *Convert) enqueue(w http.ResponseWriter, r *http.Request, c *conversion, mgr *jobs.Manager) *stageError {
+	callback, serr := h.callbackURL(r)
+	if serr != nil {
+		return serr
+	}
+
+	ft, opts, dlv := c.ft, c.opts, c.dlv
+	var client string
+	if k, ok := auth.FromContext(r.Context()); ok {
+		client = k.Name
+	}
+	j, err := mgr.Submit(jobs.Job{
+		Dir:          c.dir.Path(),
+		InputPath:    c.inputPath,
+		DocType:      ft.Name,
+		Format:       opts.Format,
+		ContentType:  dlv.contentType,
+		Disposition:  dlv.disposition,
+		Filename:     dlv.filename,
+		CallbackURL:  callback,
+		Client:       client,
+		Tenant:       tenantID(r),
+		Traceparent:  tracing.Traceparent(r.Context()),
+		InputSize:    c.size,
+		MissingFonts: c.missingFonts,
+	}, h.runJob(opts, c.post, tenantID(r), middleware.RequestIDFromContext(r.Context())))
+	if err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) {
+			serr := fail(http.StatusServiceUnavailable, "job queue full", "server busy")
+			serr.outcome, serr.retryAfter = "rejected", queueRetryAfter
+			return serr
+		}
+		return fail(http.StatusInternalServerError, "internal error: submit job", "internal error")
+	}
+
+	// The job owns the staged upload now.
+	c.dir = nil
+	middleware.SetOutcome(r.Context(), "success")
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, newJobResponse(j))
+	return nil
+}
+
+// runJob returns the background conversion for a job, followed by the
+// post-processing steps. The job's Traceparent carries the submitting
+// request's trace to it, and requestID, that request's ID, is what the
+// converter's workers report it under. Errors are reduced to the same
+// client-safe messages the synchronous endpoint uses.
+func (h *Convert) runJob(opts converter.Options, post []pdfpost.Step, tenant, requestID string) jobs.RunFunc {
+	return func(ctx context.Context, j jobs.Job) (string, error) {
+		ctx = converter.WithRequestID(ctx, requestID)
+		outPath, err := h.convert(ctx, tenant, j.InputPath, j.Dir, opts)
+		if err == nil {
+			err = pdfpost.Process(outPath, h.postWorkers, post...)
+		}
+		switch {
+		case err == nil:
+			return outPath, nil
+		case errors.Is(err, watchdog.ErrMemoryPressure):
+			return "", errors.New("conversion cancelled under memory pressure")
+		case errors.Is(err, converter.ErrTimeout):
+			return "", errors.New("conversion timed out")
+		case errors.Is(err, converter.ErrResourceLimit):
+			return "", errors.New("conversion exceeded a resource limit")
+		case errors.Is(err, converter.ErrNoOutput):
+			return "", errors.New("conversion produced no output")
+		default:
+			return "", errors.New("conversion failed")
+		}
+	}
+}
+
+// Jobs serves the status and result endpoints of the async API.
+type Jobs struct {
+	mgr *jobs.Manager
+}
+
+// NewJobs returns a Jobs handler backed by mgr.
+func NewJobs(mgr *jobs.Manager) *Jobs {
+	return &Jobs{mgr: mgr}
+}
+
+// jobResponse is the JSON representation of a job.
+type jobResponse struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Error     string    `json:"error,omitempty"`
+	ResultURL string    `json:"result_url,omitempty"`
+}
+
+func newJobResponse(j jobs.Job) jobResponse {
+	resp := jobResponse{
+		ID:        j.ID,
+		Status:    string(j.State),
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+		Error:     j.Error,
+	}
+	if j.State == jobs.StateSucceeded {
+		resp.ResultURL = "/jobs/" + j.ID + "/result"
+	}
+	return resp
+}
+
+// Job history page sizes.
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// jobListResponse is the JSON representation of a caller's job history.
+type jobListResponse struct {
+	Jobs []jobListEntry `json:"jobs"`
+}
+
+// jobListEntry describes one job in a history listing. It carries more than
+// jobResponse, whose fields are fixed for API version 1.
+type jobListEntry struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Error      string    `json:"error,omitempty"`
+	ResultURL  string    `json:"result_url,omitempty"`
+	DocType    string    `json:"doc_type"`
+	Format     string    `json:"format"`
+	InputSize  int64     `json:"input_size"`
+	ResultSize int64     `json:"result_size,omitempty"`
+	// MissingFonts are the fonts the input uses that the host lacks.
+	MissingFonts []string `json:"missing_fonts,omitempty"`
+	// ExpiresAt is when a finished job, and its result, are removed.
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	Feedback  *feedbackResponse `json:"feedback,omitempty"`
+}
+
+// List handles GET /jobs?mine=true, the caller's recent jobs, newest first,
+// up to ?limit= of them (default 20, at most 100). Jobs are listed until they
+// expire, so every result_url in the listing can still be downloaded. Only
+// requests authenticated with an API key have a history; anonymous callers
+// get 403 rather than everyone else's jobs.
+func (h *Jobs) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("mine") != "true" {
+		writeError(w, r, http.StatusBadRequest, "mine=true is required")
+		return
+	}
+	k, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.Deny(r.Context(), audit.Denial{Status: http.StatusForbidden, Policy: audit.PolicyAPIKey, Reason: audit.ReasonKeyRequired,
+			Detail: "job history"})
+		writeError(w, r, http.StatusForbidden, "job history requires an api key")
+		return
+	}
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			writeError(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	list, err := h.mgr.ListByClient(k.Name, limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	resp := jobListResponse{Jobs: make([]jobListEntry, len(list))}
+	for i, j := range list {
+		e := jobListEntry{
+			ID:           j.ID,
+			Status:       string(j.State),
+			CreatedAt:    j.CreatedAt,
+			UpdatedAt:    j.UpdatedAt,
+			Error:        j.Error,
+			DocType:      j.DocType,
+			Format:       j.Format,
+			InputSize:    j.InputSize,
+			ResultSize:   j.ResultSize,
+			MissingFonts: j.MissingFonts,
+			Feedback:     newFeedbackResponse(j.Feedback),
+		}
+		switch j.State {
+		case jobs.StateSucceeded:
+			e.ResultURL = "/jobs/" + j.ID + "/result"
+			e.ExpiresAt = j.UpdatedAt.Add(h.mgr.TTL())
+		case jobs.StateFailed:
+			e.ExpiresAt = j.UpdatedAt.Add(h.mgr.TTL())
+		}
+		resp.Jobs[i] = e
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Status handles GET /jobs/{id}. The fonts the input uses that the host
+// lacks are listed in X-Missing-Fonts, as on the synchronous endpoints.
+func (h *Jobs) Status(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	setMissingFonts(w, j.MissingFonts)
+	writeJSON(w, http.StatusOK, newJobResponse(j))
+}
+
+// Result handles GET /jobs/{id}/result, streaming the converted file once the
+// job has succeeded, with support for Range and conditional requests.
+// Unfinished and failed jobs return 409.
+func (h *Jobs) Result(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch j.State {
+	case jobs.StateSucceeded:
+	case jobs.StateFailed:
+		writeError(w, r, http.StatusConflict, "job failed")
+		return
+	default:
+		writeError(w, r, http.StatusConflict, "job not finished")
+		return
+	}
+	h.sendResult(w, r, j)
+}
+
+// sendResult streams the result of the succeeded job j.
+func (h *Jobs) sendResult(w http.ResponseWriter, r *http.Request, j jobs.Job) {
+	f, err := os.Open(j.ResultPath)
+	if err != nil {
+		// The janitor may have removed the result between lookup and open.
+		writeError(w, r, http.StatusNotFound, "job not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if j.Format == converter.FormatPDF {
+		setPDFVersion(w, f)
+	}
+	setMissingFonts(w, j.MissingFonts)
+	dlv := delivery{contentType: j.ContentType, disposition: j.Disposition, filename: j.Filename}
+	dlv.send(w, r, f, info.ModTime())
+}
+
+// Limits of POST /jobs/{id}/feedback.
+const (
+	maxFeedbackBody = 16 << 10
+	maxFeedbackNote = 2000 // runes
+	minRating       = 1
+	maxRating       = 5
+)
+
+// feedbackRequest is the body of POST /jobs/{id}/feedback.
+type feedbackRequest struct {
+	Rating int    `json:"rating"`
+	Note   string `json:"note"`
+}
+
+// feedbackResponse is the JSON representation of a job's feedback.
+type feedbackResponse struct {
+	Rating int       `json:"rating"`
+	Note   string    `json:"note,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+func newFeedbackResponse(f *jobs.Feedback) *feedbackResponse {
+	if f == nil {
+		return nil
+	}
+	return &feedbackResponse{Rating: f.Rating, Note: f.Note, At: f.At}
+}
+
+// Feedback handles POST /jobs/{id}/feedback, a report on how faithfully a
+// succeeded job's result was rendered: a JSON body with a rating from 1
+// (unusable) to 5 (faithful) and an optional note. It is stored with the job
+// and counted by LibreOffice version and format. A job takes feedback once;
+// a second report, or one on an unfinished or failed job, gets 409.
+func (h *Jobs) Feedback(w http.ResponseWriter, r *http.Request) {
+	var req feedbackRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFeedbackBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid feedback body")
+		return
+	}
+	if req.Rating < minRating || req.Rating > maxRating {
+		writeError(w, r, http.StatusBadRequest, "rating must be from 1 to 5")
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > maxFeedbackNote {
+		writeError(w, r, http.StatusBadRequest, "note is too long")
+		return
+	}
+
+	if _, ok := h.lookup(w, r); !ok {
+		return
+	}
+	j, err := h.mgr.SetFeedback(r.PathValue("id"), jobs.Feedback{Rating: req.Rating, Note: req.Note})
+	switch {
+	case err == nil:
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "job not found")
+		return
+	case errors.Is(err, jobs.ErrNotSucceeded):
+		writeError(w, r, http.StatusConflict, "feedback is only taken on succeeded jobs")
+		return
+	case errors.Is(err, jobs.ErrFeedbackGiven):
+		writeError(w, r, http.StatusConflict, "feedback already given")
+		return
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, newFeedbackResponse(j.Feedback))
+}
+
+// lookup returns the job named in the path. Another caller's job is
+// reported as not found, so a job ID alone does not reveal it.
+func (h *Jobs) lookup(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	j, err := h.mgr.Get(r.PathValue("id"))
+	if err == nil && !owns(r, j) {
+		err = jobs.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "job not found")
+			return jobs.Job{}, false
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return jobs.Job{}, false
+	}
+	return j, true
+}
+
+// owns reports whether the caller of r submitted j: with the same API key,
+// or, without keys, for the same tenant.
+func owns(r *http.Request, j jobs.Job) bool {
+	var client string
+	if k, ok := auth.FromContext(r.Context()); ok {
+		client = k.Name
+	}
+	return j.Client == client && j.Tenant == tenantID(r)
+}
+
+// writeJSON writes v as JSON with the given HTTP status, adding any
+// deprecation warnings for the request.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(withWarnings(w, v))
+}
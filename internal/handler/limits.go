@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/egress"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+// Limits serves GET /limits: the limits that apply to the caller, so a
+// client can check an upload before sending it instead of learning the
+// limits from 4xx responses.
+type Limits struct {
+	policy  *filetype.Policy
+	limiter *middleware.RateLimiter
+	egress  *egress.Meter
+}
+
+// NewLimits returns a Limits handler reporting policy, the input type policy
+// (nil allows every type), limiter, the conversion rate limiter, and
+// meter, the monthly egress meter (both nil when there is none).
+func NewLimits(policy *filetype.Policy, limiter *middleware.RateLimiter, meter *egress.Meter) *Limits {
+	return &Limits{policy: policy, limiter: limiter, egress: meter}
+}
+
+// limitsResponse is the GET /limits body.
+type limitsResponse struct {
+	Client string `json:"client,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// MaxFileSize is the largest document accepted, in bytes.
+	MaxFileSize int64 `json:"max_file_size"`
+	// MaxBatchSize and MaxBatchFiles cap a /convert/batch request.
+	MaxBatchSize  int64 `json:"max_batch_size"`
+	MaxBatchFiles int   `json:"max_batch_files"`
+	// MaxPages is always null: no page count is enforced.
+	MaxPages *int `json:"max_pages"`
+	// Formats maps each input type the caller may upload to the output
+	// formats it converts to.
+	Formats map[string][]string `json:"formats"`
+	// RateLimit is null when conversions are not rate limited.
+	RateLimit *rateLimitResponse `json:"rate_limit"`
+	// Egress is null when downloads are not metered.
+	Egress *egress.Usage `json:"egress"`
+}
+
+type rateLimitResponse struct {
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+	// Remaining is how many conversion requests the caller can make right
+	// now; it refills at PerMinute up to Burst.
+	Remaining int `json:"remaining"`
+}
+
+// ServeHTTP implements http.Handler.
+func (l *Limits) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := limitsResponse{
+		Tenant:        tenantID(r),
+		MaxFileSize:   maxFileSize,
+		MaxBatchSize:  maxBatchBodySize,
+		MaxBatchFiles: maxBatchFiles,
+		Formats:       make(map[string][]string),
+	}
+	if k, ok := auth.FromContext(r.Context()); ok {
+		resp.Client = k.Name
+	}
+	for _, t := range l.policy.AllowedTypes(resp.Tenant) {
+		resp.Formats[t.Name] = outputsFor(t)
+	}
+	if l.limiter != nil {
+		resp.RateLimit = &rateLimitResponse{
+			PerMinute: l.limiter.PerMinute(),
+			Burst:     l.limiter.Burst(),
+			Remaining: l.limiter.Remaining(r),
+		}
+	}
+	if l.egress != nil {
+		u := l.egress.Usage(egressTenant(r))
+		resp.Egress = &u
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,98 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+type limitsBody struct {
+	Client        string              `json:"client"`
+	Tenant        string              `json:"tenant"`
+	MaxFileSize   int64               `json:"max_file_size"`
+	MaxBatchFiles int                 `json:"max_batch_files"`
+	MaxPages      *int                `json:"max_pages"`
+	Formats       map[string][]string `json:"formats"`
+	RateLimit     *struct {
+		PerMinute int `json:"per_minute"`
+		Burst     int `json:"burst"`
+		Remaining int `json:"remaining"`
+	} `json:"rate_limit"`
+}
+
+func getLimits(t *testing.T, h http.Handler, header, value string) limitsBody {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/limits", nil)
+	req.Header.Set(header, value)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body limitsBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rr.Body.String(), err)
+	}
+	return body
+}
+
+func TestLimits_PerClient(t *testing.T) {
+	policy, err := filetype.ParsePolicy("docx,xlsx,txt", "acme=docx,txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := auth.NewKeystore([]auth.Key{{Name: "team-a", Secret: "s3cret", Tenant: "acme"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := middleware.NewRateLimiter(60, 5)
+	convert := middleware.RateLimit(limiter, metrics.New(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mux := http.NewServeMux()
+	mux.Handle("/convert", convert)
+	mux.Handle("/limits", handler.NewLimits(policy, limiter, nil))
+	h := middleware.RequestID(auth.Middleware(ks, mux))
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+	req.Header.Set("X-API-Key", "s3cret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	body := getLimits(t, h, "X-API-Key", "s3cret")
+	if body.Client != "team-a" || body.Tenant != "acme" {
+		t.Errorf("client, tenant = %q, %q", body.Client, body.Tenant)
+	}
+	if body.MaxFileSize != 10<<20 || body.MaxBatchFiles != 50 || body.MaxPages != nil {
+		t.Errorf("unexpected size limits %+v", body)
+	}
+	want := map[string][]string{
+		"docx": {"pdf", "png", "html", "txt", "docx"},
+		"txt":  {"pdf", "png", "html", "txt", "docx"},
+	}
+	if !reflect.DeepEqual(body.Formats, want) {
+		t.Errorf("formats = %v, want %v", body.Formats, want)
+	}
+	if rl := body.RateLimit; rl == nil || rl.PerMinute != 60 || rl.Burst != 5 || rl.Remaining != 4 {
+		t.Errorf("unexpected rate limit %+v", rl)
+	}
+}
+
+func TestLimits_Unrestricted(t *testing.T) {
+	h := handler.NewLimits(nil, nil, nil)
+	body := getLimits(t, h, "X-Tenant-ID", "globex")
+	if body.Tenant != "globex" || body.Client != "" {
+		t.Errorf("client, tenant = %q, %q", body.Client, body.Tenant)
+	}
+	if len(body.Formats) != len(filetype.All) || len(body.Formats["xlsx"]) == 0 {
+		t.Errorf("expected every input type, got %v", body.Formats)
+	}
+	if body.RateLimit != nil {
+		t.Errorf("expected no rate limit, got %+v", body.RateLimit)
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+const (
+	// maxMetadataValue caps each metadata field, in characters.
+	maxMetadataValue = 1024
+	// maxMetadataFields caps the fields of custom_metadata.
+	maxMetadataFields = 32
+)
+
+// metadataRequest holds a request's document metadata parameters.
+type metadataRequest struct {
+	title, author, subject, keywords string
+	custom                           string // a JSON object of strings
+	strip                            string
+}
+
+// readMetadataRequest reads the metadata parameters with param.
+func readMetadataRequest(param func(string) string) metadataRequest {
+	return metadataRequest{
+		title:    param("title"),
+		author:   param("author"),
+		subject:  param("subject"),
+		keywords: param("keywords"),
+		custom:   param("custom_metadata"),
+		strip:    param("strip_metadata"),
+	}
+}
+
+// metadata resolves the metadata written into a result converted with
+// opts, nil if the request sets none and keeps the source's.
+func metadata(opts converter.Options, req metadataRequest) (pdfpost.Step, *stageError) {
+	m := pdfpost.Metadata{Title: req.title, Author: req.author, Subject: req.subject, Keywords: req.keywords}
+	if req.strip != "" {
+		var err error
+		if m.Strip, err = strconv.ParseBool(req.strip); err != nil {
+			return nil, fail(http.StatusBadRequest, "invalid strip_metadata", "strip_metadata must be true or false")
+		}
+	}
+	if req.custom != "" {
+		if err := json.Unmarshal([]byte(req.custom), &m.Custom); err != nil || m.Custom == nil {
+			return nil, fail(http.StatusBadRequest, "invalid custom_metadata", "custom_metadata must be a JSON object of strings")
+		}
+	}
+	if m.Title == "" && m.Author == "" && m.Subject == "" && m.Keywords == "" && len(m.Custom) == 0 && !m.Strip {
+		return nil, nil
+	}
+
+	switch {
+	case opts.Format != converter.FormatPDF:
+		return nil, fail(http.StatusBadRequest, "metadata with non-pdf output", "metadata requires pdf output")
+	case opts.Encrypted():
+		// An encrypted result cannot be edited after conversion.
+		return nil, fail(http.StatusBadRequest, "metadata with encrypted output", "metadata cannot be used with passwords")
+	case len(m.Custom) > maxMetadataFields:
+		return nil, fail(http.StatusBadRequest, "too many custom_metadata fields", "custom_metadata has too many fields")
+	}
+	values := []string{m.Title, m.Author, m.Subject, m.Keywords}
+	for k, v := range m.Custom {
+		if err := pdfpost.CheckField(k); err != nil {
+			return nil, fail(http.StatusBadRequest, err.Error(), "invalid custom_metadata field name")
+		}
+		values = append(values, v)
+	}
+	for _, v := range values {
+		if utf8.RuneCountInString(v) > maxMetadataValue {
+			return nil, fail(http.StatusBadRequest, "metadata value too long", "metadata values must be at most 1024 characters")
+		}
+	}
+	return m, nil
+}
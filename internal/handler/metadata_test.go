@@ -0,0 +1,80 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// resultInfo parses a converted PDF and returns its document information.
+func resultInfo(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	doc, err := pdfpost.Open(data)
+	if err != nil {
+		t.Fatalf("result does not parse: %v", err)
+	}
+	info, err := doc.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestConvert_Metadata(t *testing.T) {
+	h := handler.NewConvert(pdfMock())
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = url.Values{
+		"title":           {"Quarterly report"},
+		"keywords":        {"q3, revenue"},
+		"custom_metadata": {`{"Department":"Legal"}`},
+	}.Encode()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	info := resultInfo(t, rr.Body.Bytes())
+	for k, want := range map[string]string{"Title": "Quarterly report", "Keywords": "q3, revenue", "Department": "Legal"} {
+		if info[k] != want {
+			t.Errorf("%s = %q, want %q", k, info[k], want)
+		}
+	}
+	doc, _ := pdfpost.Open(rr.Body.Bytes())
+	if xmp, err := doc.XMP(); err != nil || !strings.Contains(string(xmp), "Quarterly report") {
+		t.Errorf("title not in XMP: %q, %v", xmp, err)
+	}
+}
+
+func TestConvert_MetadataRejected(t *testing.T) {
+	for name, query := range map[string]string{
+		"png output": "output=png&title=x",
+		"passwords":  "user_password=open-sesame&title=x",
+		"strip":      "strip_metadata=maybe",
+		"not json":   "custom_metadata=Department",
+		"not string": `custom_metadata={"Pages":3}`,
+		"field name": `custom_metadata={"Producer":"me"}`,
+		"too long":   "title=" + strings.Repeat("x", 1025),
+	} {
+		t.Run(name, func(t *testing.T) {
+			mc := pdfMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = strings.ReplaceAll(query, `"`, "%22")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called")
+			}
+		})
+	}
+}
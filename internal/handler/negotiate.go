@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+// formatMetadata is the pseudo output format selected by "Accept:
+// application/json": the document is described instead of converted.
+const formatMetadata = "json"
+
+// negotiable lists the results an Accept header can select, in the order
+// preferred when a wildcard range matches several. HTML and DOCX stay
+// reachable only through the output parameter, so a browser's
+// "text/html,...,*/*" still gets a PDF.
+var negotiable = []struct {
+	mediaType string
+	format    string
+}{
+	{"application/pdf", converter.FormatPDF},
+	{"image/png", converter.FormatPNG},
+	{"text/plain", converter.FormatTXT},
+	{"application/json", formatMetadata},
+}
+
+// acceptRange is one media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate picks the result format for ft from an Accept header. It returns
+// "" with ok when accept is empty, and ok=false when nothing acceptable can be
+// produced.
+func negotiate(accept string, ft filetype.Type) (format string, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return "", true
+	}
+	ranges := parseAccept(accept)
+	for _, ar := range ranges {
+		if ar.q == 0 {
+			continue
+		}
+		for _, n := range negotiable {
+			if !mediaMatch(ar.mediaType, n.mediaType) || excluded(ranges, n.mediaType) {
+				continue
+			}
+			if n.format == formatMetadata || converter.Supports(ft.Ext, n.format) {
+				return n.format, true
+			}
+		}
+	}
+	return "", false
+}
+
+// parseAccept returns the media ranges of an Accept header, most preferred
+// first: by quality, then by specificity. Malformed ranges are ignored.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mt, q: q})
+	}
+	slices.SortStableFunc(ranges, func(a, b acceptRange) int {
+		if a.q != b.q {
+			if a.q > b.q {
+				return -1
+			}
+			return 1
+		}
+		return specificity(b.mediaType) - specificity(a.mediaType)
+	})
+	return ranges
+}
+
+// specificity ranks "*/*" below "type/*" below "type/subtype".
+func specificity(mediaRange string) int {
+	switch {
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// mediaMatch reports whether mediaType falls within mediaRange.
+func mediaMatch(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	major, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, major+"/")
+}
+
+// excluded reports whether the header explicitly refuses mediaType with q=0.
+func excluded(ranges []acceptRange, mediaType string) bool {
+	for _, ar := range ranges {
+		if ar.q == 0 && ar.mediaType == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// errNotAcceptable is the 406 for ft, naming what could have been produced.
+func errNotAcceptable(ft filetype.Type) *stageError {
+	var available []string
+	for _, n := range negotiable {
+		if n.format == formatMetadata || converter.Supports(ft.Ext, n.format) {
+			available = append(available, n.mediaType)
+		}
+	}
+	err := fail(http.StatusNotAcceptable, "no acceptable result type",
+		"cannot produce any accepted type for this document; available: "+strings.Join(available, ", "))
+	err.code = codeNotAcceptable
+	return err
+}
+
+// metadataResponse is the body returned for "Accept: application/json".
+type metadataResponse struct {
+	Type    string   `json:"type"`
+	Class   string   `json:"class"`
+	MIME    string   `json:"mime"`
+	Size    int64    `json:"size"`
+	Outputs []string `json:"outputs"`
+}
+
+// writeMetadata describes the uploaded document without converting it.
+func writeMetadata(w http.ResponseWriter, r *http.Request, ft filetype.Type, size int64) {
+	resp := metadataResponse{Type: ft.Name, Class: ft.Class, MIME: ft.MIME, Size: size, Outputs: outputsFor(ft)}
+	middleware.SetOutcome(r.Context(), "success")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// outputFormats lists every output format, in the order they are reported.
+var outputFormats = []string{converter.FormatPDF, converter.FormatPNG, converter.FormatHTML, converter.FormatTXT, converter.FormatDOCX}
+
+// outputsFor returns the output formats ft can be converted to.
+func outputsFor(ft filetype.Type) []string {
+	var outputs []string
+	for _, format := range outputFormats {
+		if converter.Supports(ft.Ext, format) {
+			outputs = append(outputs, format)
+		}
+	}
+	return outputs
+}
@@ -0,0 +1,93 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+func TestConvert_AcceptNegotiation(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       []byte
+		accept     string
+		output     string
+		wantStatus int
+		wantFormat string // forwarded to the converter; "" when not called
+	}{
+		{"no accept", validDocxBody(512), "", "", http.StatusOK, "pdf"},
+		{"pdf", validDocxBody(512), "application/pdf", "", http.StatusOK, "pdf"},
+		{"png preview", validDocxBody(512), "image/png", "", http.StatusOK, "png"},
+		{"text extraction", validDocxBody(512), "text/plain", "", http.StatusOK, "txt"},
+		{"browser default", validDocxBody(512), "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", http.StatusOK, "pdf"},
+		{"quality order", validDocxBody(512), "application/pdf;q=0.5, image/png", "", http.StatusOK, "png"},
+		{"wildcard subtype", validDocxBody(512), "image/*", "", http.StatusOK, "png"},
+		{"skips unsupported", zipPackage(t, "xl/workbook.xml"), "text/plain, application/pdf;q=0.9", "", http.StatusOK, "pdf"},
+		{"output param wins", validDocxBody(512), "image/png", "pdf", http.StatusOK, "pdf"},
+		{"nothing acceptable", validDocxBody(512), "image/gif", "", http.StatusNotAcceptable, ""},
+		{"refused with q=0", validDocxBody(512), "application/pdf;q=0", "", http.StatusNotAcceptable, ""},
+		{"text from spreadsheet", zipPackage(t, "xl/workbook.xml"), "text/plain", "", http.StatusNotAcceptable, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := happyMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, tc.body)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			if tc.output != "" {
+				req.URL.RawQuery = "output=" + tc.output
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tc.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tc.wantFormat == "" {
+				if len(mc.calls) != 0 {
+					t.Error("converter should not be called")
+				}
+				assertJSONError(t, rr.Body.String())
+				return
+			}
+			if len(mc.opts) != 1 || mc.opts[0].Format != tc.wantFormat {
+				t.Errorf("expected %s forwarded to converter, got %+v", tc.wantFormat, mc.opts)
+			}
+		})
+	}
+}
+
+func TestConvert_AcceptJSONReturnsMetadata(t *testing.T) {
+	mc := happyMock()
+	h := handler.NewConvert(mc)
+	req := buildRequest(t, zipPackage(t, "xl/workbook.xml"))
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mc.calls) != 0 {
+		t.Error("metadata requests should not convert")
+	}
+	var body struct {
+		Type    string   `json:"type"`
+		Class   string   `json:"class"`
+		Outputs []string `json:"outputs"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Type != "xlsx" || body.Class != "spreadsheet" || len(body.Outputs) != 3 {
+		t.Errorf("unexpected metadata: %+v", body)
+	}
+	if rr.Header().Get("Vary") != "Accept" {
+		t.Errorf("expected Vary: Accept, got %q", rr.Header().Get("Vary"))
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// WithPDFVersions sets the PDF version produced for requests without a
+// target_pdf_version: tenants' entry for the request's tenant, else def. An
+// empty def leaves the version to LibreOffice. Both are in the form returned
+// by converter.ParsePDFVersion.
+func WithPDFVersions(def string, tenants map[string]string) Option {
+	return func(h *Convert) {
+		h.defaultPDFVersion = def
+		h.tenantPDFVersions = tenants
+	}
+}
+
+// pdfVersion resolves the PDF version to produce in format for tenant, from
+// the requested target_pdf_version or else the configured defaults, which
+// only apply to PDF output.
+func (h *Convert) pdfVersion(tenant, format, requested string) (string, *stageError) {
+	if requested == "" {
+		if format != converter.FormatPDF {
+			return "", nil
+		}
+		if v, ok := h.tenantPDFVersions[tenant]; ok {
+			return v, nil
+		}
+		return h.defaultPDFVersion, nil
+	}
+	v, err := converter.ParsePDFVersion(requested)
+	if err != nil {
+		return "", fail(http.StatusBadRequest, err.Error(), "unsupported pdf version")
+	}
+	if format != converter.FormatPDF {
+		return "", fail(http.StatusBadRequest, "target_pdf_version with non-pdf output", "target_pdf_version requires pdf output")
+	}
+	return v, nil
+}
+
+// setPDFVersion reports the version of the PDF in content in the
+// X-PDF-Version header, and rewinds content for sending. The header is left
+// out when the version cannot be read.
+func setPDFVersion(w http.ResponseWriter, content io.ReadSeeker) {
+	v, err := converter.DetectPDFVersion(content)
+	if _, serr := content.Seek(0, io.SeekStart); err == nil && serr == nil {
+		w.Header().Set("X-PDF-Version", v)
+	}
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/cache"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// WithBackend names the converter backend ("libreoffice" or "unoserver"),
+// or the routed backends in order ("unoserver,libreoffice"), that
+// plan=true reports.
+func WithBackend(name string) Option {
+	return func(h *Convert) { h.backend = name }
+}
+
+// planResponse is what plan=true returns instead of a conversion: how the
+// request would be carried out.
+type planResponse struct {
+	Input       metadataResponse `json:"input"`
+	Backend     string           `json:"backend,omitempty"`
+	Async       bool             `json:"async"`
+	Options     planOptions      `json:"options"`
+	PostProcess []string         `json:"postprocess"`
+	Delivery    planDelivery     `json:"delivery"`
+	// Cache is "hit", "miss", or "bypass" for a result that is never
+	// cached; omitted where there is no cache.
+	Cache    string        `json:"cache,omitempty"`
+	Estimate *planEstimate `json:"estimate,omitempty"`
+}
+
+// planOptions are the resolved converter options, tenant defaults applied.
+// Passwords are never echoed; encrypted says whether there are any.
+type planOptions struct {
+	Format            string `json:"format"`
+	PDFVersion        string `json:"pdf_version,omitempty"`
+	Pages             string `json:"pages,omitempty"`
+	ImageDPI          int    `json:"image_dpi,omitempty"`
+	Orientation       string `json:"orientation,omitempty"`
+	NamedDestinations bool   `json:"named_destinations,omitempty"`
+	ConvertLinks      bool   `json:"convert_links,omitempty"`
+	Encrypted         bool   `json:"encrypted,omitempty"`
+}
+
+type planDelivery struct {
+	ContentType string `json:"content_type"`
+	Disposition string `json:"disposition,omitempty"`
+	Filename    string `json:"filename"`
+	Store       bool   `json:"store,omitempty"`
+}
+
+// planEstimate is drawn from recent conversions of the same type. The cost
+// leaves out the per-page price, as the pages are not known until the
+// document is converted.
+type planEstimate struct {
+	Samples   int64    `json:"samples"`
+	P50Ms     int64    `json:"p50_ms"`
+	P95Ms     int64    `json:"p95_ms"`
+	CostUnits *float64 `json:"cost_units,omitempty"`
+}
+
+// planParam reads the "plan" parameter.
+func (h *Convert) planParam(r *http.Request) (bool, *stageError) {
+	v := h.param(r, "plan")
+	if v == "" {
+		return false, nil
+	}
+	plan, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fail(http.StatusBadRequest, "invalid plan", "plan must be true or false")
+	}
+	return plan, nil
+}
+
+// writePlan describes how the validated request c would be converted,
+// without converting it.
+func (h *Convert) writePlan(w http.ResponseWriter, r *http.Request, c *conversion) {
+	resp := planResponse{
+		Input:   metadataResponse{Type: c.ft.Name, Class: c.ft.Class, MIME: c.ft.MIME, Size: c.size, Outputs: outputsFor(c.ft)},
+		Backend: h.backend,
+		Async:   h.jobs != nil,
+		Options: planOptions{
+			Format:            c.opts.Format,
+			PDFVersion:        c.opts.PDFVersion,
+			Pages:             c.opts.Pages,
+			ImageDPI:          c.opts.ImageDPI,
+			Orientation:       c.opts.Orientation,
+			NamedDestinations: c.opts.NamedDestinations,
+			ConvertLinks:      c.opts.ConvertLinks,
+			Encrypted:         c.opts.Encrypted(),
+		},
+		PostProcess: []string{},
+		Delivery: planDelivery{
+			ContentType: c.dlv.contentType,
+			Disposition: c.dlv.disposition,
+			Filename:    c.dlv.filename,
+			Store:       c.dlv.store,
+		},
+		Cache:    h.planCache(c),
+		Estimate: h.planEstimate(strings.TrimPrefix(c.ft.Ext, ".")),
+	}
+	for _, step := range c.post {
+		resp.PostProcess = append(resp.PostProcess, stepName(step))
+	}
+	middleware.SetOutcome(r.Context(), "success")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// planCache reports what lookup would find for c, without counting a lookup
+// or marking the result used.
+func (h *Convert) planCache(c *conversion) string {
+	if h.cache == nil || h.jobs != nil {
+		return ""
+	}
+	if c.opts.Encrypted() || len(c.post) > 0 {
+		return "bypass"
+	}
+	f, err := os.Open(c.inputPath)
+	if err != nil {
+		return ""
+	}
+	key, err := cache.KeyReader(f, c.opts)
+	f.Close()
+	if err != nil {
+		return ""
+	}
+	if h.cache.Contains(key) {
+		return cacheHit
+	}
+	return cacheMiss
+}
+
+// planEstimate estimates the duration and cost of converting a document of
+// docType; nil without stats or billing.
+func (h *Convert) planEstimate(docType string) *planEstimate {
+	if h.stats == nil && h.billing == nil {
+		return nil
+	}
+	var e planEstimate
+	if h.stats != nil {
+		s := h.stats.Snapshot()[docType]
+		e.Samples, e.P50Ms, e.P95Ms = s.Count, s.P50Ms, s.P95Ms
+	}
+	if h.billing != nil {
+		cost := h.billing.Estimate(time.Duration(e.P50Ms) * time.Millisecond)
+		e.CostUnits = &cost
+	}
+	return &e
+}
+
+// stepName names a post-processing step for the plan.
+func stepName(step pdfpost.Step) string {
+	switch step.(type) {
+	case pdfpost.Watermark:
+		return "watermark"
+	case pdfpost.Metadata:
+		return "metadata"
+	}
+	return fmt.Sprintf("%T", step)
+}
@@ -0,0 +1,143 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/billing"
+	"github.com/BRO3886/go-docpdf/internal/cache"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/stats"
+)
+
+// planRequest is a conversion request of doc with plan=true and params.
+func planRequest(t *testing.T, doc []byte, params url.Values) *http.Request {
+	t.Helper()
+	req := buildRequest(t, doc)
+	params.Set("plan", "true")
+	req.URL.RawQuery = params.Encode()
+	return req
+}
+
+type plan struct {
+	Input struct {
+		Type string `json:"type"`
+		Size int64  `json:"size"`
+	} `json:"input"`
+	Backend     string         `json:"backend"`
+	Async       bool           `json:"async"`
+	Options     map[string]any `json:"options"`
+	PostProcess []string       `json:"postprocess"`
+	Delivery    map[string]any `json:"delivery"`
+	Cache       string         `json:"cache"`
+	Estimate    *struct {
+		Samples   int64    `json:"samples"`
+		P50Ms     int64    `json:"p50_ms"`
+		CostUnits *float64 `json:"cost_units"`
+	} `json:"estimate"`
+}
+
+func servePlan(t *testing.T, h http.Handler, req *http.Request) plan {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var p plan
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode %s: %v", rr.Body.String(), err)
+	}
+	return p
+}
+
+func TestConvert_Plan(t *testing.T) {
+	mc := happyMock()
+	rec, _ := stats.New(stats.Config{})
+	rec.Observe("docx", 2*time.Second)
+	meter := billing.New(billing.Config{Exporter: &usageRecorder{}, Pricing: billing.Pricing{PerSecond: 1, PerConversion: 0.5}})
+	h := handler.NewConvert(mc, handler.WithBackend("libreoffice"), handler.WithStats(rec), handler.WithBilling(meter),
+		handler.WithCache(cache.New(1<<20), nil), handler.WithPDFVersions("1.7", nil))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, planRequest(t, validDocxBody(1024), url.Values{
+		"pages":       {"1-2"},
+		"title":       {"Report"},
+		"disposition": {"inline"},
+	}))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mc.calls) != 0 {
+		t.Fatal("plan=true ran the converter")
+	}
+	var p plan
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Input.Type != "docx" || p.Input.Size == 0 || p.Backend != "libreoffice" || p.Async {
+		t.Errorf("input, backend = %+v, %q, async %v", p.Input, p.Backend, p.Async)
+	}
+	for name, want := range map[string]any{"format": "pdf", "pdf_version": "1.7", "pages": "1-2"} {
+		if p.Options[name] != want {
+			t.Errorf("options.%s = %v, want %v", name, p.Options[name], want)
+		}
+	}
+	if len(p.PostProcess) != 1 || p.PostProcess[0] != "metadata" {
+		t.Errorf("postprocess = %v", p.PostProcess)
+	}
+	if p.Delivery["disposition"] != "inline" || p.Delivery["content_type"] != "application/pdf" {
+		t.Errorf("delivery = %v", p.Delivery)
+	}
+	if p.Cache != "bypass" {
+		t.Errorf("cache = %q, want bypass", p.Cache)
+	}
+	if e := p.Estimate; e == nil || e.Samples != 1 || e.P50Ms != 2000 || e.CostUnits == nil || *e.CostUnits != 2.5 {
+		t.Errorf("estimate = %+v", e)
+	}
+}
+
+func TestConvert_PlanRedactsPasswords(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handler.NewConvert(happyMock()).ServeHTTP(rr, planRequest(t, validDocxBody(512), url.Values{"user_password": {"s3cret"}}))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "s3cret") || !strings.Contains(rr.Body.String(), `"encrypted":true`) {
+		t.Errorf("plan = %s", rr.Body.String())
+	}
+}
+
+func TestConvert_PlanCache(t *testing.T) {
+	var lookups int
+	h := handler.NewConvert(happyMock(), handler.WithCache(cache.New(1<<20), func(string) { lookups++ }))
+	doc := validDocxBody(1024)
+
+	if p := servePlan(t, h, planRequest(t, doc, url.Values{})); p.Cache != "miss" || p.Estimate != nil {
+		t.Errorf("before converting: cache %q, estimate %v", p.Cache, p.Estimate)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, doc))
+	if p := servePlan(t, h, planRequest(t, doc, url.Values{})); p.Cache != "hit" {
+		t.Errorf("after converting: cache %q, want hit", p.Cache)
+	}
+	if lookups != 1 {
+		t.Errorf("%d cache lookups counted, want only the conversion's", lookups)
+	}
+}
+
+func TestConvert_PlanInvalid(t *testing.T) {
+	h := handler.NewConvert(happyMock())
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "plan=maybe"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
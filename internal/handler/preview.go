@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+// WithPreview accepts fast=true on a synchronous handler: the document is
+// converted as a preview (converter.Options.Preview) within timeout, and
+// when that does not succeed its full conversion is queued on mgr, as
+// /convert/async would, and answered with 202 and the job.
+func WithPreview(mgr *jobs.Manager, timeout time.Duration) Option {
+	return func(h *Convert) { h.previewJobs, h.previewTimeout = mgr, timeout }
+}
+
+// previewParam parses the fast parameter, only accepted for PDF output by a
+// handler WithPreview.
+func (h *Convert) previewParam(format, v string) (bool, *stageError) {
+	if v == "" {
+		return false, nil
+	}
+	fast, err := strconv.ParseBool(v)
+	switch {
+	case err != nil:
+		return false, fail(http.StatusBadRequest, "invalid fast", "fast must be true or false")
+	case !fast:
+		return false, nil
+	case h.previewJobs == nil || h.jobs != nil:
+		return false, fail(http.StatusBadRequest, "fast without preview", "fast is not supported")
+	case format != converter.FormatPDF:
+		return false, fail(http.StatusBadRequest, "fast with non-pdf output", "fast requires pdf output")
+	}
+	return true, nil
+}
+
+// fallBack queues the full conversion of c after its preview failed with
+// serr, when that was for want of time or the preview's own failure. Other
+// failures, such as a resource limit or the client going away, are
+// returned as they are.
+func (h *Convert) fallBack(w http.ResponseWriter, r *http.Request, c *conversion, serr *stageError) *stageError {
+	if r.Context().Err() != nil || c.outPath != "" || (serr.outcome != "timeout" && serr.status != http.StatusInternalServerError) {
+		return serr
+	}
+	// The job outlives the request, so its directory must be on disk.
+	if c.dir.InMemory() {
+		if err := c.dir.ToDisk(); err != nil {
+			return serr
+		}
+		c.followDir()
+	}
+	if c.release != nil {
+		c.release()
+		c.release = nil
+	}
+	c.opts.Preview = false
+	return h.enqueue(w, r, c, h.previewJobs)
+}
@@ -0,0 +1,119 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+func TestConvert_FastPreview(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	mc := happyMock()
+	h := handler.NewConvert(mc, handler.WithPreview(mgr, time.Second))
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "fast=true"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("X-Preview"); got != "true" {
+		t.Errorf("X-Preview = %q", got)
+	}
+	if got := rr.Header().Get("X-Image-DPI"); got != "75" {
+		t.Errorf("X-Image-DPI = %q", got)
+	}
+	if len(mc.opts) != 1 || !mc.opts[0].Preview {
+		t.Errorf("converter options %+v", mc.opts)
+	}
+}
+
+func TestConvert_FastFallsBackToJob(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	var calls atomic.Int32
+	mc := &mockConverter{
+		callsFn: func(ctx context.Context, _ string, outDir string) (string, error) {
+			if calls.Add(1) == 1 {
+				<-ctx.Done()
+				return "", ctx.Err()
+			}
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			_ = os.WriteFile(pdfPath, []byte("%PDF-1.4 full"), 0600)
+			return pdfPath, nil
+		},
+	}
+	h := handler.NewConvert(mc, handler.WithPreview(mgr, 50*time.Millisecond))
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "fast=true"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var job struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil || rr.Header().Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("unexpected job response %q, Location %q", rr.Body, rr.Header().Get("Location"))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, err := mgr.Get(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.State == jobs.StateSucceeded {
+			break
+		}
+		if j.State == jobs.StateFailed || time.Now().After(deadline) {
+			t.Fatalf("job %+v", j)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(mc.opts) != 2 || !mc.opts[0].Preview || mc.opts[1].Preview {
+		t.Errorf("converter options %+v", mc.opts)
+	}
+}
+
+func TestConvert_FastErrors(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{})
+	defer mgr.Close()
+	for _, tc := range []struct {
+		name  string
+		h     *handler.Convert
+		query string
+	}{
+		{"not a bool", handler.NewConvert(happyMock(), handler.WithPreview(mgr, time.Second)), "fast=soon"},
+		{"not pdf", handler.NewConvert(happyMock(), handler.WithPreview(mgr, time.Second)), "fast=true&output=docx"},
+		{"without preview", handler.NewConvert(happyMock()), "fast=true"},
+		{"async", handler.NewConvertAsync(happyMock(), mgr, handler.WithPreview(mgr, time.Second)), "fast=true"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = tc.query
+			rr := httptest.NewRecorder()
+			tc.h.ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			assertJSONError(t, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+)
+
+// ProbeConfig tunes the readiness and liveness probes.
+type ProbeConfig struct {
+	// ReadyTTL is how long a readiness check result is reused before the
+	// next request triggers a new one. Default 1m.
+	ReadyTTL time.Duration
+	// ReadyTimeout bounds the readiness check conversion. Default 60s.
+	ReadyTimeout time.Duration
+	// StallAfter is how long the pool may stay full without a slot being
+	// taken or given back before /livez fails. Default 5m.
+	StallAfter time.Duration
+
+	// The thresholds below fail /readyz while the server could run a
+	// conversion but should not be sent more. Zero disables each.
+
+	// MaxQueueDepth is the number of requests waiting for a worker above
+	// which /readyz fails.
+	MaxQueueDepth int
+	// MaxFailureRate is the share of conversions, 0 to 1, failing within
+	// FailureWindow above which /readyz fails. It applies once at least
+	// minFailureSample conversions ran in the window.
+	MaxFailureRate float64
+	// FailureWindow is the window MaxFailureRate is measured over. Default
+	// 5m.
+	FailureWindow time.Duration
+	// MinFreeDisk is the free space in bytes on the temp directory's
+	// filesystem below which /readyz fails.
+	MinFreeDisk int64
+	// TempDir is where conversions stage files. Default os.TempDir().
+	TempDir string
+}
+
+// minFailureSample is the number of conversions in the window below which
+// the failure rate is too noisy to fail readiness on.
+const minFailureSample = 10
+
+// probeDocument is converted by the readiness check.
+const probeDocument = "docpdf readiness probe\n"
+
+// Probes serves /readyz and /livez. Unlike /health, which only says the
+// process is up, they check that conversions can actually run.
+type Probes struct {
+	conv converter.Converter
+	pool *pool.Pool
+	cfg  ProbeConfig
+
+	mu      sync.Mutex
+	checked time.Time     // when the last readiness check finished
+	err     error         // its result
+	running chan struct{} // closed when the check in progress finishes
+
+	outcomes *outcomeWindow
+}
+
+// NewProbes returns probes that check conv by converting a small text
+// document, and p for leaked slots. p may be nil.
+func NewProbes(conv converter.Converter, p *pool.Pool, cfg ProbeConfig) *Probes {
+	if cfg.ReadyTTL <= 0 {
+		cfg.ReadyTTL = time.Minute
+	}
+	if cfg.ReadyTimeout <= 0 {
+		cfg.ReadyTimeout = 60 * time.Second
+	}
+	if cfg.StallAfter <= 0 {
+		cfg.StallAfter = 5 * time.Minute
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = 5 * time.Minute
+	}
+	if cfg.TempDir == "" {
+		cfg.TempDir = os.TempDir()
+	}
+	return &Probes{conv: conv, pool: p, cfg: cfg, outcomes: newOutcomeWindow(cfg.FailureWindow)}
+}
+
+// Track returns conv, recording the outcome of each of its conversions for
+// MaxFailureRate. Conversions whose caller gave up (context.Canceled) say
+// nothing about the server and are not counted.
+func (p *Probes) Track(conv converter.Converter) converter.Converter {
+	return trackedConverter{conv: conv, outcomes: p.outcomes}
+}
+
+type trackedConverter struct {
+	conv     converter.Converter
+	outcomes *outcomeWindow
+}
+
+func (t trackedConverter) Convert(ctx context.Context, inputPath, outDir string, opts converter.Options) (string, error) {
+	out, err := t.conv.Convert(ctx, inputPath, outDir, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.outcomes.add(time.Now(), err != nil)
+	}
+	return out, err
+}
+
+// Ready handles GET /readyz: 200 when the last real conversion succeeded and
+// every configured threshold is met, 503 when it failed, a threshold is
+// crossed or no conversion has finished yet. A result older than ReadyTTL
+// is refreshed in the background, so the probe answers from the previous
+// result instead of waiting several seconds for LibreOffice; only the very
+// first request waits for a result, and only as long as its context allows.
+func (p *Probes) Ready(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	if p.running == nil && time.Since(p.checked) >= p.cfg.ReadyTTL {
+		p.running = make(chan struct{})
+		go p.check(p.running)
+	}
+	running, checked := p.running, p.checked
+	p.mu.Unlock()
+
+	if checked.IsZero() {
+		select {
+		case <-running:
+		case <-r.Context().Done():
+		}
+	}
+
+	p.mu.Lock()
+	checked, err := p.checked, p.err
+	p.mu.Unlock()
+	if err == nil && !checked.IsZero() {
+		err = p.thresholds()
+	}
+	switch {
+	case checked.IsZero():
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+	case err != nil:
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status":     "unavailable",
+			"error":      err.Error(),
+			"checked_at": checked.UTC().Format(time.RFC3339),
+		})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":     "ok",
+			"checked_at": checked.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// Refresh runs the readiness check conversion now, or waits for the one in
+// progress, and returns its result. Run periodically, it keeps /readyz
+// answering from a recent conversion even when nothing polls it.
+func (p *Probes) Refresh(ctx context.Context) error {
+	p.mu.Lock()
+	if p.running == nil {
+		p.running = make(chan struct{})
+		go p.check(p.running)
+	}
+	running := p.running
+	p.mu.Unlock()
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// thresholds returns why the server should not take new conversions under
+// the configured thresholds, or nil.
+func (p *Probes) thresholds() error {
+	cfg := p.cfg
+	if cfg.MaxQueueDepth > 0 && p.pool != nil {
+		if n := p.pool.Waiting(); n > cfg.MaxQueueDepth {
+			return fmt.Errorf("%d requests waiting for a worker, more than %d", n, cfg.MaxQueueDepth)
+		}
+	}
+	if cfg.MaxFailureRate > 0 {
+		total, failed := p.outcomes.counts(time.Now())
+		if total >= minFailureSample && float64(failed) > cfg.MaxFailureRate*float64(total) {
+			return fmt.Errorf("%d of the last %d conversions failed, more than %g%%", failed, total, cfg.MaxFailureRate*100)
+		}
+	}
+	if cfg.MinFreeDisk > 0 {
+		// Where free space cannot be read, the check is skipped rather
+		// than taking every instance out of rotation.
+		if free, err := freeDisk(cfg.TempDir); err == nil && free < cfg.MinFreeDisk {
+			return fmt.Errorf("%d MB free in %s, less than %d MB", free>>20, cfg.TempDir, cfg.MinFreeDisk>>20)
+		}
+	}
+	return nil
+}
+
+// check converts probeDocument, records the result and closes done.
+func (p *Probes) check(done chan struct{}) {
+	err := p.convertProbe()
+	p.mu.Lock()
+	p.checked, p.err, p.running = time.Now(), err, nil
+	p.mu.Unlock()
+	close(done)
+}
+
+// convertProbe converts probeDocument to PDF in a temp dir of its own.
+func (p *Probes) convertProbe() error {
+	dir, err := os.MkdirTemp("", tempclean.Pattern("probe", ""))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "probe.txt")
+	if err := os.WriteFile(in, []byte(probeDocument), 0600); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.ReadyTimeout)
+	defer cancel()
+	_, err = p.conv.Convert(ctx, in, dir, converter.Options{Format: converter.FormatPDF})
+	return err
+}
+
+// Live handles GET /livez: 503 when the worker pool has been full for
+// StallAfter without any conversion starting or finishing, which no timeout
+// allows and means slots have leaked; restarting is the only way out.
+func (p *Probes) Live(w http.ResponseWriter, _ *http.Request) {
+	if p.pool == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+	body := map[string]any{
+		"status":  "ok",
+		"workers": p.pool.Workers(),
+		"busy":    p.pool.Busy(),
+		"waiting": p.pool.Waiting(),
+	}
+	if p.pool.Stalled(p.cfg.StallAfter) {
+		body["status"] = "stalled"
+		writeJSON(w, http.StatusServiceUnavailable, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// windowBuckets is the number of buckets an outcomeWindow is divided into.
+const windowBuckets = 10
+
+// outcomeWindow counts conversion outcomes over a sliding window, kept in
+// fixed buckets so its size does not grow with traffic.
+type outcomeWindow struct {
+	width time.Duration // of one bucket
+
+	mu      sync.Mutex
+	buckets [windowBuckets]outcomeBucket
+}
+
+type outcomeBucket struct {
+	index         int64 // start time in units of width
+	total, failed int
+}
+
+func newOutcomeWindow(window time.Duration) *outcomeWindow {
+	return &outcomeWindow{width: max(window/windowBuckets, time.Millisecond)}
+}
+
+func (w *outcomeWindow) add(now time.Time, failed bool) {
+	i := now.UnixNano() / int64(w.width)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := &w.buckets[i%windowBuckets]
+	if b.index != i {
+		*b = outcomeBucket{index: i}
+	}
+	b.total++
+	if failed {
+		b.failed++
+	}
+}
+
+// counts returns the conversions and failures recorded within the window
+// ending at now.
+func (w *outcomeWindow) counts(now time.Time) (total, failed int) {
+	i := now.UnixNano() / int64(w.width)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, b := range w.buckets {
+		if i-b.index < windowBuckets {
+			total += b.total
+			failed += b.failed
+		}
+	}
+	return total, failed
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package handler
+
+import "syscall"
+
+// freeDisk returns the bytes available to unprivileged users on the
+// filesystem holding dir.
+func freeDisk(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin)
+
+package handler
+
+import "errors"
+
+// freeDisk is not implemented on this platform, so MinFreeDisk is not
+// checked.
+func freeDisk(string) (int64, error) { return 0, errors.ErrUnsupported }
@@ -0,0 +1,254 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+)
+
+func probeStatus(t *testing.T, rr *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rr.Body.String(), err)
+	}
+	return body
+}
+
+func TestProbes_ReadyConvertsAndCaches(t *testing.T) {
+	mc := happyMock()
+	p := handler.NewProbes(mc, nil, handler.ProbeConfig{ReadyTTL: time.Hour})
+
+	for range 3 {
+		rr := httptest.NewRecorder()
+		p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if body := probeStatus(t, rr); body["status"] != "ok" || body["checked_at"] == "" {
+			t.Errorf("unexpected body %v", body)
+		}
+	}
+	if len(mc.calls) != 1 {
+		t.Errorf("expected one cached test conversion, got %d", len(mc.calls))
+	}
+	if _, err := os.Stat(mc.calls[0]); !os.IsNotExist(err) {
+		t.Errorf("probe input %s was not cleaned up", mc.calls[0])
+	}
+}
+
+func TestProbes_ReadyFailsWhenConversionFails(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(context.Context, string, string) (string, error) {
+			return "", errors.New(`exec: "libreoffice": executable file not found in $PATH`)
+		},
+	}
+	p := handler.NewProbes(mc, nil, handler.ProbeConfig{})
+
+	rr := httptest.NewRecorder()
+	p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body := probeStatus(t, rr); body["status"] != "unavailable" || body["error"] == nil {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestProbes_ReadyRefreshesInBackground(t *testing.T) {
+	release := make(chan struct{})
+	fail := false
+	mc := &mockConverter{
+		callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+			if fail {
+				<-release
+				return "", errors.New("broken")
+			}
+			return happyMock().callsFn(context.Background(), "", outDir)
+		},
+	}
+	p := handler.NewProbes(mc, nil, handler.ProbeConfig{ReadyTTL: time.Millisecond})
+
+	rr := httptest.NewRecorder()
+	p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	// The result is stale; the refresh hangs, but the probe answers from
+	// the previous result at once.
+	fail = true
+	time.Sleep(5 * time.Millisecond)
+	rr = httptest.NewRecorder()
+	p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the cached 200 during a refresh, got %d", rr.Code)
+	}
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rr = httptest.NewRecorder()
+		p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rr.Code == http.StatusServiceUnavailable {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the failed refresh never surfaced")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProbes_ReadyStartingUntilFirstResult(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	mc := &mockConverter{
+		callsFn: func(context.Context, string, string) (string, error) {
+			<-release
+			return "", errors.New("released")
+		},
+	}
+	p := handler.NewProbes(mc, nil, handler.ProbeConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rr := httptest.NewRecorder()
+	p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+	if body := probeStatus(t, rr); body["status"] != "starting" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestProbes_Refresh(t *testing.T) {
+	mc := happyMock()
+	p := handler.NewProbes(mc, nil, handler.ProbeConfig{ReadyTTL: time.Hour})
+	for range 2 {
+		if err := p.Refresh(context.Background()); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+	}
+	if len(mc.calls) != 2 {
+		t.Errorf("expected a conversion per refresh, got %d", len(mc.calls))
+	}
+	// /readyz answers from the refreshed result.
+	rr := httptest.NewRecorder()
+	p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK || len(mc.calls) != 2 {
+		t.Errorf("expected a cached 200, got %d after %d conversions", rr.Code, len(mc.calls))
+	}
+}
+
+func TestProbes_Live(t *testing.T) {
+	cp := pool.New(1, 0)
+	p := handler.NewProbes(happyMock(), cp, handler.ProbeConfig{StallAfter: 10 * time.Millisecond})
+
+	rr := httptest.NewRecorder()
+	p.Live(rr, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	release, _ := cp.Acquire(context.Background())
+	defer release()
+	time.Sleep(20 * time.Millisecond)
+	rr = httptest.NewRecorder()
+	p.Live(rr, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a stalled pool, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body := probeStatus(t, rr); body["status"] != "stalled" || body["busy"] != float64(1) {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestProbes_ReadyQueueDepth(t *testing.T) {
+	pl := pool.New(1, 2)
+	p := handler.NewProbes(happyMock(), pl, handler.ProbeConfig{ReadyTTL: time.Hour, MaxQueueDepth: 1})
+	ready := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr
+	}
+	if rr := ready(); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 with an empty queue, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	release, _ := pl.Acquire(context.Background())
+	defer release()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for range 2 {
+		go pl.Acquire(ctx)
+	}
+	deadline := time.Now().Add(time.Second)
+	for pl.Waiting() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("requests never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	rr := ready()
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 over the queue threshold, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body := probeStatus(t, rr); body["status"] != "unavailable" || body["error"] != "2 requests waiting for a worker, more than 1" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestProbes_ReadyFailureRate(t *testing.T) {
+	mc := &mockConverter{
+		callsFn: func(ctx context.Context, _, _ string) (string, error) {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", errors.New("broken")
+		},
+	}
+	p := handler.NewProbes(happyMock(), nil, handler.ProbeConfig{ReadyTTL: time.Hour, MaxFailureRate: 0.5})
+	conv := p.Track(mc)
+	convert := func(ctx context.Context) {
+		conv.Convert(ctx, "in.docx", t.TempDir(), converter.Options{})
+	}
+	ready := func() int {
+		rr := httptest.NewRecorder()
+		p.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr.Code
+	}
+
+	// Too few conversions to judge.
+	for range 5 {
+		convert(context.Background())
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("expected 200 below the minimum sample, got %d", code)
+	}
+	// Abandoned conversions are not counted.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range 10 {
+		convert(cancelled)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("expected cancelled conversions to be ignored, got %d", code)
+	}
+	for range 6 {
+		convert(context.Background())
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with 11 of 11 failed, got %d", code)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+)
+
+// WithProtectionPolicy sets what happens to uploads marked read-only
+// recommended or restricting editing (default filetype.ProtectionWarn).
+// observe, if non-nil, is called with "ignored", "warned" or "rejected" for
+// each one.
+func WithProtectionPolicy(p filetype.ProtectionPolicy, observe func(action string)) Option {
+	return func(h *Convert) {
+		h.protection = p
+		h.onProtected = observe
+	}
+}
+
+// Actions reported for protected uploads.
+const (
+	protectionIgnored  = "ignored"
+	protectionWarned   = "warned"
+	protectionRejected = "rejected"
+)
+
+// protectionWarning is the warning sent under filetype.ProtectionWarn.
+const protectionWarning = "document is marked read-only or restricts editing; the protection was ignored for conversion"
+
+// screenProtection applies the protection policy to the staged input at
+// path, which is rewritten without its protection unless the policy refuses
+// it, and returns its size. Only protected documents are read into memory.
+func (h *Convert) screenProtection(w http.ResponseWriter, path string, size int64) (int64, *stageError) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: open upload", "internal error")
+	}
+	protected := filetype.Protected(f, size)
+	f.Close()
+	if !protected {
+		return size, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: read upload", "internal error")
+	}
+	data, action := h.applyProtectionPolicy(data)
+	switch action {
+	case protectionRejected:
+		return 0, errDocumentProtected()
+	case protectionWarned:
+		w.Header().Add("Warning", warnCode+strconv.Quote(protectionWarning))
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return 0, fail(http.StatusInternalServerError, "internal error: writefile", "internal error")
+	}
+	return int64(len(data)), nil
+}
+
+// applyProtectionPolicy returns data, without its protection unless the
+// policy refuses it, and the action taken: "" when data is not protected. A
+// document whose protection cannot be removed is converted as it is; the
+// conversion timeout still bounds a stalled load.
+func (h *Convert) applyProtectionPolicy(data []byte) ([]byte, string) {
+	if !filetype.Protected(bytes.NewReader(data), int64(len(data))) {
+		return data, ""
+	}
+	action := protectionWarned
+	switch h.protection {
+	case filetype.ProtectionHonor:
+		action = protectionRejected
+	case filetype.ProtectionIgnore:
+		action = protectionIgnored
+	}
+	if action != protectionRejected {
+		if stripped, err := filetype.StripProtection(data); err == nil {
+			data = stripped
+		}
+	}
+	if h.onProtected != nil {
+		h.onProtected(action)
+	}
+	return data, action
+}
+
+// errDocumentProtected is the 422 sent for a protected document under
+// filetype.ProtectionHonor.
+func errDocumentProtected() *stageError {
+	e := fail(http.StatusUnprocessableEntity, "document is protected", "document is marked read-only or restricts editing")
+	e.code = codeDocumentProtected
+	return e
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+// Page sizes of GET /jobs/{id}/results.
+const (
+	defaultResultsLimit = 50
+	maxResultsLimit     = 500
+)
+
+// resultEntry is one entry of a job's results: a row of a bulk render, or
+// the whole result of a job converting one document.
+type resultEntry struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Size   int64  `json:"size,omitempty"`
+	// Download is where the entry alone can be fetched, once the job has
+	// succeeded; URL is where a bulk render with store=true put it instead.
+	Download string `json:"download,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// MissingFields are the template fields a bulk row has no value for.
+	MissingFields []string `json:"missing_fields,omitempty"`
+}
+
+// resultsResponse is a page of a job's results.
+type resultsResponse struct {
+	JobID   string        `json:"job_id"`
+	Status  string        `json:"status"`
+	Total   int           `json:"total"`
+	Entries []resultEntry `json:"entries"`
+	// NextCursor fetches the next page; it is omitted on the last.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Results handles GET /jobs/{id}/results, the job's entries a page at a
+// time, each with its status and, once the job has succeeded, a link to
+// download it alone: the rows of a bulk render, or the one result of any
+// other job. ?limit= sets the page size (default 50, at most 500) and
+// ?cursor= continues from a previous page's next_cursor.
+func (h *Jobs) Results(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit := defaultResultsLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxResultsLimit {
+			writeError(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	total := resultCount(j)
+	start := 0
+	if v := q.Get("cursor"); v != "" {
+		var ok bool
+		if start, ok = decodeCursor(v, j.ID); !ok || start > total {
+			writeError(w, r, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+	end := min(start+limit, total)
+
+	resp := resultsResponse{JobID: j.ID, Status: string(j.State), Total: total, Entries: make([]resultEntry, 0, end-start)}
+	if j.Items == nil {
+		if start == 0 && total > 0 {
+			resp.Entries = append(resp.Entries, singleEntry(w, r, j))
+		}
+	} else {
+		sizes := zipSizes(j)
+		for i := start; i < end; i++ {
+			resp.Entries = append(resp.Entries, itemEntry(w, r, j, i, sizes))
+		}
+	}
+	if end < total {
+		resp.NextCursor = encodeCursor(j.ID, end)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ResultEntry handles GET /jobs/{id}/results/{index}, one entry of a
+// succeeded job, as Result serves the whole result. Entries of a failed row,
+// or stored in the sink, are not found; an unfinished or failed job is 409.
+func (h *Jobs) ResultEntry(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	i, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || i < 0 || i >= resultCount(j) {
+		writeError(w, r, http.StatusNotFound, "entry not found")
+		return
+	}
+	switch j.State {
+	case jobs.StateSucceeded:
+	case jobs.StateFailed:
+		writeError(w, r, http.StatusConflict, "job failed")
+		return
+	default:
+		writeError(w, r, http.StatusConflict, "job not finished")
+		return
+	}
+	if j.Items == nil {
+		h.sendResult(w, r, j)
+		return
+	}
+	it := j.Items[i]
+	if it.State != jobs.StateSucceeded || !bulkZip(j) {
+		writeError(w, r, http.StatusNotFound, "entry not found")
+		return
+	}
+
+	zr, err := zip.OpenReader(j.ResultPath)
+	if err != nil {
+		// The janitor may have removed the result between lookup and open.
+		writeError(w, r, http.StatusNotFound, "job not found")
+		return
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		if zf.Name != it.Output {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, int64(zf.UncompressedSize64)))
+		rc.Close()
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		content := bytes.NewReader(data)
+		if j.Format == converter.FormatPDF {
+			setPDFVersion(w, content)
+		}
+		dlv := delivery{contentType: converter.ContentType(j.Format), disposition: dispositionAttachment, filename: it.Output}
+		dlv.send(w, r, content, zf.Modified)
+		return
+	}
+	writeError(w, r, http.StatusNotFound, "entry not found")
+}
+
+// resultCount is the number of entries in j's results: one per item, or
+// one for a job converting a single document.
+func resultCount(j jobs.Job) int {
+	if j.Items != nil {
+		return len(j.Items)
+	}
+	return 1
+}
+
+// bulkZip reports whether j's result is a ZIP of its items' outputs, rather
+// than a manifest of where they were stored.
+func bulkZip(j jobs.Job) bool {
+	return j.ContentType == "application/zip"
+}
+
+// singleEntry is the one entry of a job converting a single document.
+func singleEntry(w http.ResponseWriter, r *http.Request, j jobs.Job) resultEntry {
+	e := resultEntry{Name: j.Filename, Status: string(j.State)}
+	switch j.State {
+	case jobs.StateSucceeded:
+		e.Size = j.ResultSize
+		e.Download = "/jobs/" + j.ID + "/results/0"
+	case jobs.StateFailed:
+		e.Error = i18n.Localize(w, r, j.Error)
+	}
+	return e
+}
+
+// itemEntry is the entry of item i of j, with sizes the sizes of the outputs
+// in j's ZIP.
+func itemEntry(w http.ResponseWriter, r *http.Request, j jobs.Job, i int, sizes map[string]int64) resultEntry {
+	it := j.Items[i]
+	e := resultEntry{Index: i, Name: it.Output, Status: string(it.State), URL: it.URL}
+	if it.Detail != "" {
+		e.MissingFields = strings.Split(it.Detail, ",")
+	}
+	if it.State == jobs.StateFailed {
+		e.Error = i18n.Localize(w, r, it.Error)
+	}
+	if size, ok := sizes[it.Output]; ok && it.State == jobs.StateSucceeded {
+		e.Size = size
+		e.Download = "/jobs/" + j.ID + "/results/" + strconv.Itoa(i)
+	}
+	return e
+}
+
+// zipSizes returns the size of each file in the ZIP result of a succeeded
+// bulk job, by name; nil for any other job.
+func zipSizes(j jobs.Job) map[string]int64 {
+	if j.State != jobs.StateSucceeded || !bulkZip(j) {
+		return nil
+	}
+	zr, err := zip.OpenReader(j.ResultPath)
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	sizes := make(map[string]int64, len(zr.File))
+	for _, zf := range zr.File {
+		sizes[zf.Name] = int64(zf.UncompressedSize64)
+	}
+	return sizes
+}
+
+// encodeCursor returns the cursor of the page of job id's results starting
+// at entry i. It names the job, so it cannot page through another one.
+func encodeCursor(id string, i int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id + ":" + strconv.Itoa(i)))
+}
+
+// decodeCursor returns the entry a cursor of job id's results starts at.
+func decodeCursor(cursor, id string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	cid, n, ok := strings.Cut(string(b), ":")
+	if !ok || cid != id {
+		return 0, false
+	}
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,136 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+type resultsPage struct {
+	JobID   string `json:"job_id"`
+	Status  string `json:"status"`
+	Total   int    `json:"total"`
+	Entries []struct {
+		Index         int      `json:"index"`
+		Name          string   `json:"name"`
+		Status        string   `json:"status"`
+		Size          int64    `json:"size"`
+		Download      string   `json:"download"`
+		Error         string   `json:"error"`
+		MissingFields []string `json:"missing_fields"`
+	} `json:"entries"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// getPage fetches target from mux as tenant acme and decodes the page.
+func getPage(t *testing.T, mux http.Handler, target string) resultsPage {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, tenantGet(target))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", target, rr.Code, rr.Body)
+	}
+	var page resultsPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestJobs_ResultsPagesBulkRows(t *testing.T) {
+	f := newBulkFixture(t)
+	data := `{"name":"Ada","amount":10}` + "\n" + `{"name":"Grace"}` + "\n" + `{"name":"Linus","amount":30}` + "\n"
+	st := f.submitBulk(t, bulkRequest(t, "people.jsonl", data, map[string]string{"template_id": f.template.ID}))
+	if st.Status != "succeeded" {
+		t.Fatalf("status %+v", st)
+	}
+	base := "/jobs/" + st.ID + "/results"
+
+	page := getPage(t, f.mux, base+"?limit=2")
+	if page.JobID != st.ID || page.Total != 3 || len(page.Entries) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page %+v", page)
+	}
+	if e := page.Entries[0]; e.Status != "succeeded" || e.Name != "row-1.pdf" || e.Download != base+"/0" || e.Size == 0 {
+		t.Errorf("entry 0 %+v", e)
+	}
+	if e := page.Entries[1]; e.Index != 1 || e.Status != "failed" || e.Download != "" || e.Error != "no value for a template field" || len(e.MissingFields) != 1 {
+		t.Errorf("entry 1 %+v", e)
+	}
+	page = getPage(t, f.mux, base+"?limit=2&cursor="+page.NextCursor)
+	if len(page.Entries) != 1 || page.Entries[0].Index != 2 || page.NextCursor != "" {
+		t.Fatalf("last page %+v", page)
+	}
+
+	rr := httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, tenantGet(page.Entries[0].Download))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/pdf" || !strings.Contains(rr.Body.String(), "Linus") {
+		t.Fatalf("entry 2: %d %s %q", rr.Code, rr.Header().Get("Content-Type"), rr.Body)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=row-3.pdf" {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+
+	for target, want := range map[string]int{
+		base + "/1":                          http.StatusNotFound, // the row failed
+		base + "/3":                          http.StatusNotFound,
+		base + "?limit=0":                    http.StatusBadRequest,
+		base + "?limit=501":                  http.StatusBadRequest,
+		base + "?cursor=bm90LXRoaXMtam9iOjE": http.StatusBadRequest, // "not-this-job:1"
+		base + "?cursor=!!!":                 http.StatusBadRequest,
+	} {
+		rr := httptest.NewRecorder()
+		f.mux.ServeHTTP(rr, tenantGet(target))
+		if rr.Code != want {
+			t.Errorf("GET %s: %d, want %d", target, rr.Code, want)
+		}
+	}
+	rr = httptest.NewRecorder()
+	f.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, base, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("another tenant's results: %d, want 404", rr.Code)
+	}
+}
+
+func TestJobs_ResultsOfSingleDocument(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("POST /convert/async", handler.NewConvertAsync(happyMock(), mgr))
+	mux.HandleFunc("GET /jobs/{id}/results", jh.Results)
+	mux.HandleFunc("GET /jobs/{id}/results/{index}", jh.ResultEntry)
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.Path = "/convert/async"
+	req.Header.Set("X-Tenant-ID", "acme")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("submit: %d %s", rr.Code, rr.Body)
+	}
+	id := strings.TrimPrefix(rr.Header().Get("Location"), "/jobs/")
+
+	var page resultsPage
+	deadline := time.Now().Add(2 * time.Second)
+	for page.Status != "succeeded" {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never succeeded, last page %+v", page)
+		}
+		time.Sleep(5 * time.Millisecond)
+		page = getPage(t, mux, "/jobs/"+id+"/results")
+	}
+	if page.Total != 1 || len(page.Entries) != 1 || page.Entries[0].Download != "/jobs/"+id+"/results/0" || page.NextCursor != "" {
+		t.Fatalf("page %+v", page)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, tenantGet(page.Entries[0].Download))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "%PDF") {
+		t.Errorf("entry 0: %d %q", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/sink"
+)
+
+// WithSink lets synchronous requests ask, with store=true, for the result to
+// be written to s instead of returned: the response is then a JSON
+// description of where it went.
+func WithSink(s sink.Sink) Option {
+	return func(h *Convert) { h.sink = s }
+}
+
+// storedResponse is the body returned for a result written to the sink.
+type storedResponse struct {
+	Key         string `json:"key"`
+	URL         string `json:"url,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	PDFVersion  string `json:"pdf_version,omitempty"`
+	// ImageDPI is the resolution images were downsampled to; omitted when
+	// they were kept at their own.
+	ImageDPI int `json:"image_dpi,omitempty"`
+}
+
+// store writes the result to the sink under a fresh random directory, so
+// results never overwrite each other, and answers 201 with its location.
+func (h *Convert) store(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	key := hex.EncodeToString(b[:]) + "/" + c.dlv.filename
+
+	data := c.out
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(c.outPath); err != nil {
+			return fail(http.StatusInternalServerError, "internal error: read result", "internal error")
+		}
+	}
+	loc, err := h.sink.Put(r.Context(), key, data, c.dlv.contentType)
+	if err != nil {
+		return fail(http.StatusBadGateway, "storing result: "+err.Error(), "could not store result")
+	}
+	middleware.SetOutcome(r.Context(), "success")
+	if loc.URL != "" {
+		w.Header().Set("Location", loc.URL)
+	}
+	resp := storedResponse{
+		Key:         loc.Key,
+		URL:         loc.URL,
+		ContentType: c.dlv.contentType,
+		Size:        len(data),
+	}
+	if c.opts.Format == converter.FormatPDF {
+		resp.PDFVersion, _ = converter.DetectPDFVersion(bytes.NewReader(data))
+		resp.ImageDPI = c.opts.ImageDPI
+	}
+	writeJSON(w, http.StatusCreated, resp)
+	return nil
+}
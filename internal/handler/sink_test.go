@@ -0,0 +1,79 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/sink"
+)
+
+func TestConvert_StoreInSink(t *testing.T) {
+	dir := t.TempDir()
+	h := handler.NewConvert(happyMock(), handler.WithSink(sink.NewDir(dir, "https://files.example.com")))
+	req := buildRequest(t, validDocxBody(1024))
+	req.URL.RawQuery = "store=true"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Key         string `json:"key"`
+		URL         string `json:"url"`
+		ContentType string `json:"content_type"`
+		Size        int    `json:"size"`
+		PDFVersion  string `json:"pdf_version"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasSuffix(resp.Key, "/test.pdf") || resp.ContentType != "application/pdf" || resp.Size != len("%PDF-1.4 fake") || resp.PDFVersion != "1.4" {
+		t.Errorf("response = %+v", resp)
+	}
+	if rr.Header().Get("Location") != resp.URL || resp.URL != "https://files.example.com/"+resp.Key {
+		t.Errorf("URL = %q, Location = %q", resp.URL, rr.Header().Get("Location"))
+	}
+	got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(resp.Key)))
+	if err != nil || string(got) != "%PDF-1.4 fake" {
+		t.Errorf("stored %q, %v", got, err)
+	}
+}
+
+func TestConvert_StoreWithoutSink(t *testing.T) {
+	req := buildRequest(t, validDocxBody(1024))
+	req.URL.RawQuery = "store=true"
+	rr := httptest.NewRecorder()
+	handler.NewConvert(happyMock()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestConvert_StoreFailure(t *testing.T) {
+	broken := &sink.Writer{Open: func(context.Context, string) (io.WriteCloser, error) {
+		return nil, errors.New("bucket unreachable")
+	}}
+	req := buildRequest(t, validDocxBody(1024))
+	req.URL.RawQuery = "store=1"
+	rr := httptest.NewRecorder()
+	handler.NewConvert(happyMock(), handler.WithSink(broken)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "bucket unreachable") {
+		t.Error("sink error leaked to the client")
+	}
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// maxSplitRanges caps the ranges of one /split request.
+const maxSplitRanges = 100
+
+// Split handles POST /split. It takes a PDF, or a document it converts to
+// PDF first, and cuts from it the page ranges given by the "ranges"
+// parameter, repeated for each: page selections as "pages" takes them (e.g.
+// "1-3,7" or "4-"). A single range is returned as a PDF, several as a ZIP
+// holding one PDF per range.
+type Split struct {
+	c *Convert
+}
+
+// NewSplit returns a Split handler. Options are shared with Convert, and a
+// document is converted as /convert would convert it to PDF.
+func NewSplit(conv converter.Converter, opts ...Option) *Split {
+	h := NewConvert(conv, opts...)
+	h.pdfOnly = true
+	return &Split{c: h}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Split) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.c.admit(w, r); err != nil {
+		err.write(w, r)
+		return
+	}
+
+	c := &conversion{}
+	defer c.cleanup()
+	if err := h.serve(w, r, c); err != nil {
+		if err.badUpload != "" && h.c.onBadUpload != nil {
+			h.c.onBadUpload(err.badUpload)
+		}
+		err.write(w, r)
+	}
+}
+
+// serve runs the stages for one request. An uploaded PDF skips the
+// conversion.
+func (h *Split) serve(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.run(w, r, c, []stage{{stageParse, h.c.parse}}); err != nil {
+		return err
+	}
+	ranges, err := splitRanges(r.Form["ranges"])
+	if err != nil {
+		return err
+	}
+	stages := []stage{
+		{stageValidate, h.validate},
+		{stageStage, h.c.stage},
+		{stageConvert, h.c.runConversion},
+		{stagePost, h.c.postProcess},
+	}
+	if isPDF(c.inputPath) {
+		stages = []stage{{stageValidate, h.validatePDF}, {stagePost, h.c.postProcess}}
+	}
+	stages = append(stages, stage{stageRespond, func(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+		return h.respond(w, r, c, ranges)
+	}})
+	return h.c.run(w, r, c, stages)
+}
+
+// splitRanges parses the values of the ranges parameter.
+func splitRanges(values []string) ([]string, *stageError) {
+	if len(values) == 0 {
+		return nil, fail(http.StatusBadRequest, "missing ranges", "ranges is required")
+	}
+	ranges := slices.Clone(values)
+	if len(ranges) > maxSplitRanges {
+		return nil, fail(http.StatusBadRequest, "too many ranges", "too many ranges")
+	}
+	seen := make(map[string]bool, len(ranges))
+	for i, spec := range ranges {
+		var err error
+		if ranges[i], err = converter.ParsePageRange(spec); err != nil {
+			return nil, fail(http.StatusBadRequest, err.Error(), "invalid page range")
+		}
+		// Each range names its file in the ZIP.
+		if seen[ranges[i]] {
+			return nil, fail(http.StatusBadRequest, "duplicate range "+ranges[i], "duplicate page range")
+		}
+		seen[ranges[i]] = true
+	}
+	return ranges, nil
+}
+
+// isPDF reports whether the file at path is a PDF.
+func isPDF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 5)
+	_, err = io.ReadFull(f, head)
+	return err == nil && string(head) == "%PDF-"
+}
+
+// validate is the Convert validate stage, less what cannot be split.
+func (h *Split) validate(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.validate(w, r, c); err != nil {
+		return err
+	}
+	return checkPDFResult(c)
+}
+
+// validatePDF takes an uploaded PDF as the result to split, once pdfpost
+// can read it.
+func (h *Split) validatePDF(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	data, err := os.ReadFile(c.inputPath)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "internal error: read upload", "internal error")
+	}
+	if _, err := pdfpost.Open(data); err != nil {
+		return errUnsplittable(err)
+	}
+	if err := h.c.takePDF(r, c); err != nil {
+		return err
+	}
+	return checkPDFResult(c)
+}
+
+// takePDF makes an uploaded PDF the result, as if converted from it: the
+// watermark and metadata steps still apply.
+func (h *Convert) takePDF(r *http.Request, c *conversion) *stageError {
+	middleware.SetDocType(r.Context(), "pdf")
+	c.outPath = filepath.Join(c.dir.Path(), "input.pdf")
+	if err := os.Rename(c.inputPath, c.outPath); err != nil {
+		return fail(http.StatusInternalServerError, "internal error: rename upload", "internal error")
+	}
+	c.inputPath = c.outPath
+	c.opts = converter.Options{Format: converter.FormatPDF}
+	var err *stageError
+	if err = h.postSteps(r, c); err != nil {
+		return err
+	}
+	c.dlv, err = h.parseDelivery(r, c.opts.Format, c.uploadName)
+	return err
+}
+
+// checkPDFResult rejects options whose result cannot be read back as a PDF
+// and returned: another output format, passwords, or store.
+func checkPDFResult(c *conversion) *stageError {
+	switch {
+	case c.opts.Format != converter.FormatPDF:
+		return fail(http.StatusBadRequest, "non-pdf output", "output must be pdf")
+	case c.opts.Encrypted():
+		// An encrypted result cannot be read back without the password.
+		return fail(http.StatusBadRequest, "encrypted output", "passwords are not supported")
+	case c.dlv.store:
+		return fail(http.StatusBadRequest, "store with a pdf-only endpoint", "store is not supported")
+	}
+	return nil
+}
+
+// errUnsplittable is the 422 sent for a PDF pdfpost cannot read.
+func errUnsplittable(err error) *stageError {
+	if errors.Is(err, pdfpost.ErrEncrypted) {
+		return fail(http.StatusUnprocessableEntity, err.Error(), "encrypted PDFs cannot be split")
+	}
+	return fail(http.StatusUnprocessableEntity, err.Error(), "PDF structure not supported for splitting")
+}
+
+// respond cuts the ranges from the result and sends them.
+func (h *Split) respond(w http.ResponseWriter, r *http.Request, c *conversion, ranges []string) *stageError {
+	data, err := os.ReadFile(c.outPath)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "internal error: read result", "internal error")
+	}
+	doc, err := pdfpost.Open(data)
+	if err != nil {
+		return errUnsplittable(err)
+	}
+	n, err := doc.NumPages()
+	if err != nil {
+		return errUnsplittable(err)
+	}
+	parts := make([][]byte, len(ranges))
+	for i, spec := range ranges {
+		pages, err := converter.PageNumbers(spec, n)
+		if err != nil {
+			return fail(http.StatusBadRequest, err.Error(), "page range outside the document")
+		}
+		if parts[i], err = doc.Extract(pages); err != nil {
+			return errUnsplittable(err)
+		}
+	}
+
+	middleware.SetOutcome(r.Context(), "success")
+	base := strings.TrimSuffix(c.dlv.filename, ".pdf")
+	if len(parts) == 1 {
+		dlv := c.dlv
+		dlv.filename = base + "_" + ranges[0] + ".pdf"
+		content := bytes.NewReader(parts[0])
+		setPDFVersion(w, content)
+		dlv.send(w, r, content, time.Time{})
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="split.zip"`)
+	w.WriteHeader(http.StatusOK)
+	zw := zip.NewWriter(w)
+	for i, part := range parts {
+		if zf, err := zw.Create(base + "_" + ranges[i] + ".pdf"); err == nil {
+			_, _ = zf.Write(part)
+		}
+	}
+	_ = zw.Close()
+	return nil
+}
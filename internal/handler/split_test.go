@@ -0,0 +1,175 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// pagesPDF is a PDF of n empty pages, the kth with a MediaBox k points wide
+// so pages can be told apart.
+func pagesPDF(n int) []byte {
+	kids := make([]string, n)
+	objs := []string{"<</Type /Catalog /Pages 2 0 R>>", ""}
+	for i := range n {
+		kids[i] = fmt.Sprintf("%d 0 R", i+3)
+		objs = append(objs, fmt.Sprintf("<</Type /Page /Parent 2 0 R /MediaBox [0 0 %d 792]>>", i+1))
+	}
+	objs[1] = fmt.Sprintf("<</Type /Pages /Kids [%s] /Count %d>>", strings.Join(kids, " "), n)
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return buf.Bytes()
+}
+
+// buildSplitRequest is a /split request for the document in body, named
+// name, with the given query.
+func buildSplitRequest(t *testing.T, name string, body []byte, query string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(body)
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/split?"+query, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// pageWidths returns the MediaBox widths of the pages of a split result.
+func pageWidths(t *testing.T, data []byte) string {
+	t.Helper()
+	doc, err := pdfpost.Open(data)
+	if err != nil {
+		t.Fatalf("result does not parse: %v", err)
+	}
+	n, err := doc.NumPages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var widths []string
+	for i := range 20 {
+		if bytes.Contains(data, fmt.Appendf(nil, "/MediaBox [0 0 %d 792]", i+1)) {
+			widths = append(widths, fmt.Sprint(i+1))
+		}
+	}
+	if len(widths) != n {
+		t.Fatalf("%d pages but widths %v", n, widths)
+	}
+	return strings.Join(widths, ",")
+}
+
+func TestSplit_PDF(t *testing.T) {
+	mock := pdfMock()
+	h := handler.NewSplit(mock)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildSplitRequest(t, "report.pdf", pagesPDF(5), "ranges=2-3,5&disposition=attachment"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="report_2-3,5.pdf"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if got := pageWidths(t, rr.Body.Bytes()); got != "2,3,5" {
+		t.Errorf("pages %s, want 2,3,5", got)
+	}
+	if len(mock.calls) != 0 {
+		t.Error("PDF upload converted")
+	}
+}
+
+func TestSplit_ConvertsDocument(t *testing.T) {
+	mock := &mockConverter{callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+		path := filepath.Join(outDir, "input.pdf")
+		return path, os.WriteFile(path, pagesPDF(4), 0600)
+	}}
+	h := handler.NewSplit(mock)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildSplitRequest(t, "deck.docx", validDocxBody(512), "ranges=1-2&ranges=3-"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"deck_1-2.pdf": "1,2", "deck_3-.pdf": "3,4"}
+	if len(zr.File) != len(want) {
+		t.Fatalf("%d entries, want %d", len(zr.File), len(want))
+	}
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if got := pageWidths(t, data); got != want[zf.Name] {
+			t.Errorf("%s has pages %s, want %q", zf.Name, got, want[zf.Name])
+		}
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("converted %d times, want 1", len(mock.calls))
+	}
+}
+
+func TestSplit_Rejected(t *testing.T) {
+	encrypted := bytes.Replace(pagesPDF(1), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 1 0 R"), 1)
+	for name, tc := range map[string]struct {
+		file   string
+		body   []byte
+		query  string
+		status int
+	}{
+		"no ranges":      {"a.pdf", pagesPDF(2), "", http.StatusBadRequest},
+		"bad range":      {"a.pdf", pagesPDF(2), "ranges=2-1", http.StatusBadRequest},
+		"empty range":    {"a.pdf", pagesPDF(2), "ranges=1&ranges=", http.StatusBadRequest},
+		"repeated range": {"a.pdf", pagesPDF(2), "ranges=1&ranges=1", http.StatusBadRequest},
+		"past the end":   {"a.pdf", pagesPDF(2), "ranges=1&ranges=2-3", http.StatusBadRequest},
+		"encrypted pdf":  {"a.pdf", encrypted, "ranges=1", http.StatusUnprocessableEntity},
+		"xref stream":    {"a.pdf", []byte("%PDF-1.5\nstartxref\n9\n%%EOF\n"), "ranges=1", http.StatusUnprocessableEntity},
+		"odt output":     {"a.docx", validDocxBody(512), "ranges=1&output=odt", http.StatusBadRequest},
+		"passwords":      {"a.docx", validDocxBody(512), "ranges=1&user_password=open-sesame", http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.NewSplit(pdfMock()).ServeHTTP(rr, buildSplitRequest(t, tc.file, tc.body, tc.query))
+			if rr.Code != tc.status {
+				t.Errorf("expected %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/scratch"
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+)
+
+// Stages of a conversion request, in order, as reported to the stage
+// observer.
+const (
+	stageParse    = "parse"    // stream the upload to disk
+	stageValidate = "validate" // detect the type, apply policies, resolve options
+	stageStage    = "stage"    // wait for a worker
+	stageConvert  = "convert"  // run the converter
+	stagePost     = "postprocess"
+	stageRespond  = "respond"
+)
+
+// StageTimeouts bounds individual stages of a synchronous conversion. A zero
+// field leaves that stage bounded only by the request's own deadline.
+type StageTimeouts struct {
+	// Parse bounds reading the upload, through the connection's read
+	// deadline. A slow upload gets 408.
+	Parse time.Duration
+	// Queue bounds the wait for a conversion worker. Exceeding it is a 503
+	// with Retry-After, like a full queue.
+	Queue time.Duration
+	// Convert bounds the conversion itself. Exceeding it is a 504.
+	Convert time.Duration
+}
+
+// WithStageTimeouts bounds the stages of each synchronous conversion.
+func WithStageTimeouts(t StageTimeouts) Option {
+	return func(h *Convert) { h.timeouts = t }
+}
+
+// WithStageObserver calls observe with the duration of every stage a request
+// runs, including the one that failed.
+func WithStageObserver(observe func(stage string, d time.Duration)) Option {
+	return func(h *Convert) { h.onStage = observe }
+}
+
+// conversion is the state one request carries through the stages.
+type conversion struct {
+	size       int64 // of the staged input
+	uploadName string
+	ft         filetype.Type
+	opts       converter.Options
+	post       []pdfpost.Step // applied to the result after conversion
+	dlv        delivery
+	plan       bool // describe the conversion instead of running it
+
+	dir       *scratch.Dir // holds the input and the result
+	inputPath string       // the staged upload, named for its type once detected
+	release   func()       // returns the pool slot; nil without a pool
+	outPath   string
+	out       []byte // the result, when it was read into memory for the cache
+	cacheKey  string // set on a cache miss; the result is stored under it
+
+	missingFonts []string // fonts the input uses that the host lacks
+}
+
+// cleanup releases whatever the stages acquired.
+func (c *conversion) cleanup() {
+	if c.release != nil {
+		c.release()
+	}
+	if c.dir != nil {
+		c.dir.Remove()
+	}
+}
+
+// followDir points inputPath into the working directory again after it has
+// been moved to disk.
+func (c *conversion) followDir() {
+	c.inputPath = filepath.Join(c.dir.Path(), filepath.Base(c.inputPath))
+}
+
+// stageFunc is one stage. It either advances c or returns the failure to
+// report; only the final stage writes a successful response.
+type stageFunc func(w http.ResponseWriter, r *http.Request, c *conversion) *stageError
+
+// stage is a named stageFunc.
+type stage struct {
+	name string
+	fn   stageFunc
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Convert) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.admit(w, r); err != nil {
+		err.write(w, r)
+		return
+	}
+
+	c := &conversion{}
+	defer c.cleanup()
+	if err := h.serve(w, r, c); err != nil {
+		if err.badUpload != "" && h.onBadUpload != nil {
+			h.onBadUpload(err.badUpload)
+		}
+		err.write(w, r)
+	}
+}
+
+// serve runs the stages for one request. Metadata and plan requests stop
+// after validation, async requests are queued as jobs instead of converted,
+// and cached results skip straight to the response.
+func (h *Convert) serve(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.run(w, r, c, []stage{{stageParse, h.parse}}); err != nil {
+		return err
+	}
+	h.setAffinity(w, c)
+	if err := h.run(w, r, c, []stage{{stageValidate, h.validate}}); err != nil {
+		return err
+	}
+	switch {
+	case c.opts.Format == formatMetadata:
+		writeMetadata(w, r, c.ft, c.size)
+		return nil
+	case c.plan:
+		h.writePlan(w, r, c)
+		return nil
+	case h.jobs != nil:
+		return h.enqueue(w, r, c, h.jobs)
+	}
+	stages := []stage{
+		{stageStage, h.stage},
+		{stageConvert, h.runConversion},
+		{stagePost, h.postProcess},
+		{stageRespond, h.respond},
+	}
+	if h.lookup(w, c) {
+		stages = stages[len(stages)-1:]
+	}
+	err := h.run(w, r, c, stages)
+	if err != nil && c.opts.Preview {
+		return h.fallBack(w, r, c, err)
+	}
+	return err
+}
+
+// run executes stages in order, timing each, and stops at the first failure
+// or once the request is cancelled or past its deadline. Each stage works on
+// what the one before it produced, so there is nothing to run alongside it;
+// the stages bound their own waits by the request's context.
+func (h *Convert) run(w http.ResponseWriter, r *http.Request, c *conversion, stages []stage) *stageError {
+	for _, s := range stages {
+		if err := r.Context().Err(); err != nil {
+			return errCancelled(err, s.name)
+		}
+		start := time.Now()
+		err := s.fn(w, r, c)
+		if h.onStage != nil {
+			h.onStage(s.name, time.Since(start))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse streams the upload into a fresh temp directory, bounded by the Parse
+// timeout. The document is never held in memory.
+func (h *Convert) parse(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if h.timeouts.Parse > 0 {
+		// Not every ResponseWriter supports deadlines (httptest's doesn't);
+		// the request deadline still applies then.
+		rc := http.NewResponseController(w)
+		if rc.SetReadDeadline(time.Now().Add(h.timeouts.Parse)) == nil {
+			defer rc.SetReadDeadline(time.Time{})
+		}
+	}
+
+	// Cap the request body before parsing so oversized uploads fail fast.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	space := h.scratch
+	if h.jobs != nil {
+		space = nil
+	}
+	dir, err := space.MkdirTemp(tempclean.Pattern("", middleware.RequestIDFromContext(r.Context())), r.ContentLength)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "internal error: mkdirtemp", "internal error")
+	}
+	c.dir = dir
+	c.inputPath = filepath.Join(dir.Path(), "upload")
+
+	var serr *stageError
+	if h.raw {
+		c.size, serr = readRaw(r, c.inputPath)
+		c.uploadName = r.URL.Query().Get("filename")
+	} else {
+		c.size, c.uploadName, serr = readMultipart(r, c.inputPath)
+	}
+	if serr != nil {
+		return serr
+	}
+	// An upload of unknown length may have turned out too big for memory.
+	if err := c.dir.Fit(); err != nil {
+		return fail(http.StatusInternalServerError, "internal error: move upload to disk", "internal error")
+	}
+	c.followDir()
+	return nil
+}
+
+// validate identifies the document, applies the type and macro policies, and
+// resolves the conversion and delivery options.
+func (h *Convert) validate(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	h.markDeprecatedParams(w, r)
+	var err *stageError
+	if c.size, err = h.decryptUpload(r, c.inputPath, c.size); err != nil {
+		return err
+	}
+	f, ferr := os.Open(c.inputPath)
+	if ferr != nil {
+		return fail(http.StatusInternalServerError, "internal error: open upload", "internal error")
+	}
+	c.ft, err = h.identify(r, f, c.size, c.uploadName)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	middleware.SetDocType(r.Context(), c.ft.Name)
+
+	// LibreOffice picks its import filter from the extension, so name the
+	// staged file after the detected type.
+	typed := filepath.Join(c.dir.Path(), "input"+c.ft.Ext)
+	if err := os.Rename(c.inputPath, typed); err != nil {
+		return fail(http.StatusInternalServerError, "internal error: rename upload", "internal error")
+	}
+	c.inputPath = typed
+	if c.size, err = h.screenMacros(c.inputPath, c.size); err != nil {
+		return err
+	}
+	if c.size, err = h.screenProtection(w, c.inputPath, c.size); err != nil {
+		return err
+	}
+	if c.size, err = h.dropExternalTemplate(c.inputPath, c.size); err != nil {
+		return err
+	}
+	c.missingFonts = h.screenFonts(w, c.inputPath, c.size)
+	if c.opts, err = h.options(w, r, c.ft); err != nil || c.opts.Format == formatMetadata {
+		return err
+	}
+	if err = h.postSteps(r, c); err != nil {
+		return err
+	}
+	if c.dlv, err = h.parseDelivery(r, c.opts.Format, c.uploadName); err != nil {
+		return err
+	}
+	c.plan, err = h.planParam(r)
+	return err
+}
+
+// postSteps resolves the steps applied to the result once converted with
+// c.opts: the watermark, then the metadata.
+func (h *Convert) postSteps(r *http.Request, c *conversion) *stageError {
+	step, err := h.watermarkStep(r, c)
+	if err != nil {
+		return err
+	}
+	if step != nil {
+		c.post = append(c.post, step)
+	}
+	if step, err = metadata(c.opts, readMetadataRequest(func(name string) string { return h.param(r, name) })); err != nil {
+		return err
+	}
+	if step != nil {
+		c.post = append(c.post, step)
+	}
+	return nil
+}
+
+// stage waits for a conversion worker; the input is already on disk.
+func (h *Convert) stage(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if h.pool == nil {
+		return nil
+	}
+	release, err := h.acquire(r.Context(), r)
+	if err != nil {
+		return err
+	}
+	c.release = release
+	return nil
+}
+
+// acquire waits for a pool slot, bounded by the Queue timeout.
+func (h *Convert) acquire(ctx context.Context, r *http.Request) (func(), *stageError) {
+	if h.timeouts.Queue > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeouts.Queue)
+		defer cancel()
+	}
+	release, err := h.pool.Acquire(ctx)
+	switch {
+	case err == nil:
+		return release, nil
+	case errors.Is(err, pool.ErrQueueFull):
+		return nil, errQueueFull()
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		serr := fail(http.StatusGatewayTimeout, "request deadline exceeded while queued", "request timed out")
+		serr.outcome = "timeout"
+		return nil, serr
+	case r.Context().Err() != nil:
+		return nil, fail(http.StatusServiceUnavailable, "client gone while queued", "server busy")
+	case errors.Is(err, context.DeadlineExceeded):
+		serr := errQueueFull()
+		serr.reason = "queue wait timeout"
+		return nil, serr
+	default:
+		return nil, fail(http.StatusInternalServerError, "internal error: staging cancelled", "internal error")
+	}
+}
+
+// runConversion converts the staged input, bounded by the Convert timeout,
+// or for a preview the preview timeout.
+func (h *Convert) runConversion(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	ctx := r.Context()
+	timeout := h.timeouts.Convert
+	if c.opts.Preview {
+		timeout = h.previewTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	wctx, stop := c.dir.Watch(ctx)
+	outPath, err := h.convert(wctx, tenantID(r), c.inputPath, c.dir.Path(), c.opts)
+	stop()
+	if err != nil && errors.Is(context.Cause(wctx), scratch.ErrLimit) {
+		// The conversion outgrew its share of memory; run it again on disk.
+		if err = c.dir.ToDisk(); err == nil {
+			c.followDir()
+			outPath, err = h.convert(ctx, tenantID(r), c.inputPath, c.dir.Path(), c.opts)
+		}
+	}
+	var serr *stageError
+	switch {
+	case err == nil:
+		c.outPath = outPath
+		return nil
+	case errors.Is(err, watchdog.ErrMemoryPressure):
+		serr = fail(http.StatusServiceUnavailable, "conversion cancelled under memory pressure", "server busy")
+		serr.retryAfter = queueRetryAfter
+	case errors.Is(err, context.DeadlineExceeded) && r.Context().Err() != nil:
+		serr = fail(http.StatusGatewayTimeout, "request deadline exceeded during conversion", "request timed out")
+		serr.outcome = "timeout"
+	case errors.Is(err, context.Canceled):
+		serr = fail(http.StatusServiceUnavailable, "client disconnected during conversion", "request cancelled")
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, converter.ErrTimeout):
+		serr = fail(http.StatusGatewayTimeout, "conversion timed out", "conversion timed out")
+		serr.outcome = "timeout"
+	case errors.Is(err, converter.ErrResourceLimit):
+		serr = fail(http.StatusUnprocessableEntity, err.Error(), "conversion exceeded a resource limit")
+		serr.code = codeResourceLimit
+	case errors.Is(err, converter.ErrUnsupportedFormat):
+		serr = fail(http.StatusBadRequest, "output format not supported for input type", "output format not supported for this document type")
+	default:
+		serr = fail(http.StatusInternalServerError, "conversion failed", "conversion failed")
+	}
+	return serr
+}
+
+// postProcess checks the converted result, applies the post-processing
+// steps, such as a watermark, and caches it. Only a result going into the
+// cache is read into memory; otherwise it stays on disk until respond
+// streams it.
+func (h *Convert) postProcess(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	info, err := os.Stat(c.outPath)
+	if err != nil || info.Size() == 0 {
+		return fail(http.StatusInternalServerError, "conversion produced no output", "conversion produced no output")
+	}
+	if err := pdfpost.Process(c.outPath, h.postWorkers, c.post...); err != nil {
+		return fail(http.StatusInternalServerError, "postprocess: "+err.Error(), "conversion failed")
+	}
+	if c.cacheKey != "" {
+		if c.out, err = os.ReadFile(c.outPath); err != nil {
+			return fail(http.StatusInternalServerError, "internal error: read result", "internal error")
+		}
+		h.cache.Put(c.cacheKey, c.out)
+	}
+	return nil
+}
+
+// respond streams the result, or stores it when the client asked for that.
+// A result already in memory, from the cache, is served from there.
+func (h *Convert) respond(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if c.dlv.store {
+		return h.store(w, r, c)
+	}
+	var content io.ReadSeeker
+	if c.out != nil {
+		content = bytes.NewReader(c.out)
+	} else {
+		f, err := os.Open(c.outPath)
+		if err != nil {
+			return fail(http.StatusInternalServerError, "internal error: open result", "internal error")
+		}
+		defer f.Close()
+		content = f
+	}
+	if c.opts.Format == converter.FormatPDF {
+		setPDFVersion(w, content)
+		setImageDPI(w, c.opts.ImageResolution())
+	}
+	if c.opts.Preview {
+		w.Header().Set("X-Preview", "true")
+	}
+	middleware.SetOutcome(r.Context(), "success")
+	c.dlv.send(w, r, content, time.Time{})
+	return nil
+}
+
+// stageError is a failed request and the response it maps to. Stages return
+// it instead of writing the response, so each can be run on its own.
+type stageError struct {
+	status     int
+	outcome    string // metrics outcome; "failed" when empty
+	reason     string // logged, never sent to the client
+	msg        string // client-safe message
+	code       string // machine-readable code, optional
+	retryAfter int    // Retry-After seconds; 0 omits the header
+	badUpload  string // why the upload was malformed, if that was the failure
+}
+
+// fail returns a stageError with the "failed" outcome.
+func fail(status int, reason, msg string) *stageError {
+	return &stageError{status: status, reason: reason, msg: msg}
+}
+
+// errQueueFull is the 503 sent when the conversion queue has no room left.
+func errQueueFull() *stageError {
+	return &stageError{
+		status:     http.StatusServiceUnavailable,
+		outcome:    "rejected",
+		reason:     "conversion queue full",
+		msg:        "server busy",
+		retryAfter: queueRetryAfter,
+	}
+}
+
+// errLowDisk is the 507 sent when dir has only free bytes left.
+func errLowDisk(free int64, dir string) *stageError {
+	return &stageError{
+		status:     http.StatusInsufficientStorage,
+		outcome:    "rejected",
+		code:       codeInsufficientStorage,
+		reason:     fmt.Sprintf("low disk space: %d MB free in %s", free>>20, dir),
+		msg:        "server is low on disk space",
+		retryAfter: diskRetryAfter,
+	}
+}
+
+// errCancelled is the failure of a request whose context ended with err
+// before the named stage could start.
+func errCancelled(err error, stage string) *stageError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		serr := fail(http.StatusGatewayTimeout, "request deadline exceeded before "+stage, "request timed out")
+		serr.outcome = "timeout"
+		return serr
+	}
+	return fail(http.StatusServiceUnavailable, "client gone before "+stage, "request cancelled")
+}
+
+// errUploadTimeout is the 408 sent when the upload outlasts the Parse
+// timeout.
+func errUploadTimeout() *stageError {
+	return fail(http.StatusRequestTimeout, "upload read timed out", "upload timed out")
+}
+
+// Reasons an upload is rejected as malformed, reported to the upload
+// observer.
+const (
+	badUploadEmpty     = "empty"     // no bytes at all
+	badUploadTruncated = "truncated" // a ZIP package missing its central directory
+	badUploadAborted   = "aborted"   // the client stopped sending mid-upload
+	// A ZIP package missing the parts its type requires.
+	badUploadInvalidPackage = "invalid_package"
+	// A ZIP package with more entries, or expanding to more, than allowed.
+	badUploadPackageTooLarge = "package_too_large"
+)
+
+// errBadUpload is the 4xx sent for an upload that is empty, truncated, not
+// a sound package or was abandoned by the client. Its "bad_upload" outcome keeps these client
+// faults out of the failed-conversion count.
+func errBadUpload(reason, detail string) *stageError {
+	e := &stageError{status: http.StatusBadRequest, outcome: "bad_upload", badUpload: reason}
+	switch reason {
+	case badUploadEmpty:
+		e.reason, e.msg, e.code = "empty upload", "uploaded file is empty", codeEmptyUpload
+	case badUploadTruncated:
+		e.status = http.StatusUnprocessableEntity
+		e.reason, e.msg, e.code = "truncated upload", "document is truncated: its ZIP central directory is missing", codeTruncatedUpload
+	case badUploadAborted:
+		e.reason, e.msg, e.code = "upload aborted", "upload ended before the document was complete", codeUploadAborted
+	case badUploadInvalidPackage:
+		e.status = http.StatusUnsupportedMediaType
+		e.reason, e.msg, e.code = "invalid package", "document is not a valid package: required parts are missing", codeInvalidPackage
+	case badUploadPackageTooLarge:
+		e.status = http.StatusRequestEntityTooLarge
+		e.reason, e.msg, e.code = "package too large", "document expands to more entries or data than allowed", codePackageTooLarge
+	}
+	if detail != "" {
+		e.reason += ": " + detail
+	}
+	return e
+}
+
+func (e *stageError) Error() string { return e.reason }
+
+// write records the failure on the request's log line and metrics and sends
+// the JSON error response.
+func (e *stageError) write(w http.ResponseWriter, r *http.Request) {
+	outcome := e.outcome
+	if outcome == "" {
+		outcome = "failed"
+	}
+	middleware.SetOutcome(r.Context(), outcome)
+	middleware.SetLogError(r.Context(), e.reason)
+	if e.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.retryAfter))
+	}
+	if e.code != "" {
+		writeErrorCode(w, r, e.status, e.code, e.msg)
+		return
+	}
+	writeError(w, r, e.status, e.msg)
+}
@@ -0,0 +1,233 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/pool"
+	"github.com/BRO3886/go-docpdf/internal/scratch"
+)
+
+// stageRecorder collects the stages reported to a stage observer.
+type stageRecorder struct {
+	mu     sync.Mutex
+	stages []string
+}
+
+func (s *stageRecorder) observe(stage string, _ time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stages = append(s.stages, stage)
+}
+
+func TestConvert_ObservesEveryStage(t *testing.T) {
+	var rec stageRecorder
+	h := handler.NewConvert(happyMock(), handler.WithStageObserver(rec.observe))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := []string{"parse", "validate", "stage", "convert", "postprocess", "respond"}
+	if !slices.Equal(rec.stages, want) {
+		t.Errorf("stages = %v, want %v", rec.stages, want)
+	}
+}
+
+func TestConvert_ObservesFailedStage(t *testing.T) {
+	var rec stageRecorder
+	h := handler.NewConvert(happyMock(), handler.WithStageObserver(rec.observe))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, []byte("\x00\x01\x02 not a document")))
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if want := []string{"parse", "validate"}; !slices.Equal(rec.stages, want) {
+		t.Errorf("stages = %v, want %v", rec.stages, want)
+	}
+}
+
+// cancelOnRead cancels a request's context, as a client hanging up
+// mid-upload would, once the handler starts reading its body.
+type cancelOnRead struct {
+	io.Reader
+	cancel context.CancelFunc
+}
+
+func (b cancelOnRead) Read(p []byte) (int, error) {
+	b.cancel()
+	return b.Reader.Read(p)
+}
+
+func TestConvert_StopsAfterClientGone(t *testing.T) {
+	var rec stageRecorder
+	h := handler.NewConvert(happyMock(), handler.WithStageObserver(rec.observe))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := buildRequest(t, validDocxBody(1024))
+	req.Body = io.NopCloser(cancelOnRead{req.Body, cancel})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req.WithContext(ctx))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if want := []string{"parse"}; !slices.Equal(rec.stages, want) {
+		t.Errorf("stages = %v, want %v", rec.stages, want)
+	}
+}
+
+func TestConvert_QueueTimeout(t *testing.T) {
+	p := pool.New(1, 1)
+	release, _ := p.Acquire(context.Background())
+	defer release()
+
+	// A real server, since the recorder would take the queued request's 103
+	// Early Hints for its final status.
+	srv := httptest.NewServer(handler.NewConvert(happyMock(), handler.WithPool(p),
+		handler.WithStageTimeouts(handler.StageTimeouts{Queue: 50 * time.Millisecond})))
+	defer srv.Close()
+
+	req := buildRequest(t, validDocxBody(1024))
+	resp, err := http.Post(srv.URL+"/convert", req.Header.Get("Content-Type"), req.Body)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	assertJSONError(t, string(body))
+}
+
+func TestConvert_ConvertTimeout(t *testing.T) {
+	h := handler.NewConvert(blockingMock(),
+		handler.WithStageTimeouts(handler.StageTimeouts{Convert: 50 * time.Millisecond}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestConvert_ParseTimeout(t *testing.T) {
+	srv := httptest.NewServer(handler.NewConvert(happyMock(),
+		handler.WithStageTimeouts(handler.StageTimeouts{Parse: 100 * time.Millisecond})))
+	defer srv.Close()
+
+	// Send the start of the upload, then stall.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fw, _ := mw.CreateFormFile("file", "slow.docx")
+		_, _ = fw.Write(validDocxBody(512))
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/convert", pr)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("expected 408, got %d", resp.StatusCode)
+	}
+}
+
+func TestConvert_Scratch(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "tmpfs")
+	var fallbacks []string
+	space, err := scratch.New(scratch.Config{
+		Dir:        root,
+		Capacity:   1 << 20,
+		Limit:      64 << 10,
+		Interval:   5 * time.Millisecond,
+		OnFallback: func(reason string) { fallbacks = append(fallbacks, reason) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	mc := &mockConverter{callsFn: func(ctx context.Context, _ string, outDir string) (string, error) {
+		dirs = append(dirs, outDir)
+		out := filepath.Join(outDir, "input.pdf")
+		if len(dirs) == 1 {
+			// Outgrow the share, then wait to be stopped.
+			_ = os.WriteFile(out, make([]byte, 128<<10), 0600)
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		_ = os.WriteFile(out, []byte("%PDF-1.4 fake"), 0600)
+		return out, nil
+	}}
+	h := handler.NewConvert(mc, handler.WithScratch(space))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(1024)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(dirs) != 2 || !strings.HasPrefix(dirs[0], root) || strings.HasPrefix(dirs[1], root) {
+		t.Fatalf("expected a conversion in memory, then one on disk: %v", dirs)
+	}
+	if !slices.Equal(fallbacks, []string{scratch.FallbackLimit}) {
+		t.Errorf("fallbacks %v", fallbacks)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 || space.Reserved() != 0 {
+		t.Errorf("scratch not cleaned up: %d entries, %d bytes reserved", len(entries), space.Reserved())
+	}
+	if _, err := os.Stat(dirs[1]); !os.IsNotExist(err) {
+		t.Error("disk directory not cleaned up")
+	}
+}
+
+func TestConvert_ScratchOversizedUpload(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "tmpfs")
+	space, err := scratch.New(scratch.Config{Dir: root, Capacity: 1 << 20, Limit: 4 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dir string
+	mc := &mockConverter{callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+		dir = outDir
+		out := filepath.Join(outDir, "input.pdf")
+		_ = os.WriteFile(out, []byte("%PDF-1.4 fake"), 0600)
+		return out, nil
+	}}
+	h := handler.NewConvert(mc, handler.WithScratch(space))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildRequest(t, validDocxBody(16<<10)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if dir == "" || strings.HasPrefix(dir, root) {
+		t.Errorf("upload over the limit converted in %q", dir)
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/filetype"
+	"github.com/BRO3886/go-docpdf/internal/templates"
+)
+
+// maxTemplateName bounds a template's name, in bytes.
+const maxTemplateName = 200
+
+// Templates serves the admin API of the template library. Templates are
+// scoped to the tenant in X-Tenant-ID; requests without one manage the
+// templates that belong to no tenant.
+type Templates struct {
+	lib *templates.Library
+}
+
+// NewTemplates returns a Templates handler backed by lib.
+func NewTemplates(lib *templates.Library) *Templates {
+	return &Templates{lib: lib}
+}
+
+// templateListResponse is the JSON representation of a tenant's templates.
+type templateListResponse struct {
+	Templates []templates.Template `json:"templates"`
+}
+
+// Create handles POST /templates: a multipart upload of a DOCX "file", and
+// optionally its "name" (default the file name), stored as version 1 of a
+// new template. It answers 201 with the template.
+func (h *Templates) Create(w http.ResponseWriter, r *http.Request) {
+	data, filename, ok := readTemplate(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	if name == "" || len(name) > maxTemplateName {
+		writeError(w, r, http.StatusBadRequest, "invalid template name")
+		return
+	}
+	t, err := h.lib.Create(tenantID(r), name, data)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.Header().Set("Location", "/templates/"+t.ID)
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// List handles GET /templates, the tenant's templates, most recently
+// updated first.
+func (h *Templates) List(w http.ResponseWriter, r *http.Request) {
+	list := h.lib.List(tenantID(r))
+	if list == nil {
+		list = []templates.Template{}
+	}
+	writeJSON(w, http.StatusOK, templateListResponse{Templates: list})
+}
+
+// Get handles GET /templates/{id}, the template and its versions.
+func (h *Templates) Get(w http.ResponseWriter, r *http.Request) {
+	t, err := h.lib.Get(tenantID(r), r.PathValue("id"))
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// Update handles PUT /templates/{id}: a multipart upload of a DOCX "file"
+// stored as the template's next version. Earlier versions are kept. It
+// answers 201 with the template.
+func (h *Templates) Update(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := h.lib.Get(tenantID(r), id); err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	data, _, ok := readTemplate(w, r)
+	if !ok {
+		return
+	}
+	t, err := h.lib.AddVersion(tenantID(r), id, data)
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// Download handles GET /templates/{id}/file, the document of the latest
+// version, or of ?version=.
+func (h *Templates) Download(w http.ResponseWriter, r *http.Request) {
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "invalid version")
+			return
+		}
+		version = n
+	}
+	tenant, id := tenantID(r), r.PathValue("id")
+	t, err := h.lib.Get(tenant, id)
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	path, v, err := h.lib.File(tenant, id, version)
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		// Deleted between lookup and open.
+		writeError(w, r, http.StatusNotFound, "template not found")
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", filetype.DOCX.MIME)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": t.Name + filetype.DOCX.Ext}))
+	w.Header().Set("ETag", `"`+v.SHA256+`"`)
+	http.ServeContent(w, r, "", v.CreatedAt, f)
+}
+
+// Delete handles DELETE /templates/{id}, removing the template with every
+// version. It answers 204.
+func (h *Templates) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.lib.Delete(tenantID(r), r.PathValue("id")); err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readTemplate reads the uploaded "file" of a template request and checks
+// that it is a DOCX package. It writes the error response and returns false
+// otherwise.
+func readTemplate(w http.ResponseWriter, r *http.Request) ([]byte, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseMultipartForm(maxFileSize); err != nil {
+		writeError(w, r, http.StatusBadRequest, "expected a multipart/form-data upload")
+		return nil, "", false
+	}
+	defer r.MultipartForm.RemoveAll()
+	f, fh, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "missing file field")
+		return nil, "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	switch {
+	case err != nil:
+		writeError(w, r, http.StatusBadRequest, "could not read file")
+		return nil, "", false
+	case len(data) > maxFileSize:
+		writeError(w, r, http.StatusRequestEntityTooLarge, "file too large")
+		return nil, "", false
+	}
+
+	doc, size := bytes.NewReader(data), int64(len(data))
+	if ft, ok := filetype.Default.Detect(doc, size); !ok || ft != filetype.DOCX {
+		writeError(w, r, http.StatusUnsupportedMediaType, "templates must be DOCX documents")
+		return nil, "", false
+	}
+	if err := filetype.CheckPackage(doc, size, filetype.DOCX, filetype.PackageLimits{}); err != nil {
+		if errors.Is(err, filetype.ErrPackageTooLarge) {
+			writeErrorCode(w, r, http.StatusRequestEntityTooLarge, codePackageTooLarge, "document expands to more entries or data than allowed")
+		} else {
+			writeErrorCode(w, r, http.StatusUnsupportedMediaType, codeInvalidPackage, "document is not a valid package: required parts are missing")
+		}
+		return nil, "", false
+	}
+	return data, fh.Filename, true
+}
+
+// writeTemplateError sends 404 for templates.ErrNotFound and 500 otherwise.
+func writeTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, templates.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "template not found")
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, "internal error")
+}
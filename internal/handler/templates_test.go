@@ -0,0 +1,190 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/templates"
+)
+
+// templatesMux returns the template routes as main.go registers them,
+// without the admin token.
+func templatesMux(t *testing.T) *http.ServeMux {
+	t.Helper()
+	lib, err := templates.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handler.NewTemplates(lib)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /templates", h.List)
+	mux.HandleFunc("POST /templates", h.Create)
+	mux.HandleFunc("GET /templates/{id}", h.Get)
+	mux.HandleFunc("PUT /templates/{id}", h.Update)
+	mux.HandleFunc("DELETE /templates/{id}", h.Delete)
+	mux.HandleFunc("GET /templates/{id}/file", h.Download)
+	return mux
+}
+
+// templateUpload builds a multipart template request with body as "file",
+// and name as "name" unless empty.
+func templateUpload(t *testing.T, method, target, name string, body []byte) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if name != "" {
+		_ = mw.WriteField("name", name)
+	}
+	fw, err := mw.CreateFormFile("file", "invoice.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(body)
+	_ = mw.Close()
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func serveTemplates(mux *http.ServeMux, req *http.Request, tenant string) *httptest.ResponseRecorder {
+	if tenant != "" {
+		req.Header.Set("X-Tenant-ID", tenant)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTemplates_Lifecycle(t *testing.T) {
+	mux := templatesMux(t)
+	v1, v2 := zipPackage(t, "word/document.xml"), zipPackage(t, "word/document.xml", "word/styles.xml")
+
+	rr := serveTemplates(mux, templateUpload(t, http.MethodPost, "/templates", "", v1), "acme")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rr.Code, rr.Body)
+	}
+	var created templates.Template
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "invoice" || created.Tenant != "acme" || len(created.Versions) != 1 {
+		t.Fatalf("created %+v", created)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/templates/"+created.ID {
+		t.Errorf("Location %q", loc)
+	}
+
+	rr = serveTemplates(mux, templateUpload(t, http.MethodPut, "/templates/"+created.ID, "", v2), "acme")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("update: %d %s", rr.Code, rr.Body)
+	}
+
+	rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates/"+created.ID, nil), "acme")
+	var got templates.Template
+	_ = json.Unmarshal(rr.Body.Bytes(), &got)
+	if rr.Code != http.StatusOK || len(got.Versions) != 2 || got.Latest().Version != 2 {
+		t.Fatalf("get: %d %+v", rr.Code, got)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []byte
+	}{
+		{"", v2},
+		{"?version=1", v1},
+		{"?version=2", v2},
+	} {
+		rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates/"+created.ID+"/file"+tc.query, nil), "acme")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("download %q: %d", tc.query, rr.Code)
+		}
+		if body, _ := io.ReadAll(rr.Body); !bytes.Equal(body, tc.want) {
+			t.Errorf("download %q: wrong document", tc.query)
+		}
+		if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename=invoice.docx` {
+			t.Errorf("Content-Disposition %q", cd)
+		}
+	}
+	for _, query := range []string{"?version=0", "?version=x"} {
+		rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates/"+created.ID+"/file"+query, nil), "acme")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("download %q: expected 400, got %d", query, rr.Code)
+		}
+	}
+	rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates/"+created.ID+"/file?version=3", nil), "acme")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("missing version: expected 404, got %d", rr.Code)
+	}
+
+	rr = serveTemplates(mux, httptest.NewRequest(http.MethodDelete, "/templates/"+created.ID, nil), "acme")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", rr.Code)
+	}
+	rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates/"+created.ID, nil), "acme")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("after delete: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestTemplates_TenantScope(t *testing.T) {
+	mux := templatesMux(t)
+	rr := serveTemplates(mux, templateUpload(t, http.MethodPost, "/templates", "Letter", zipPackage(t, "word/document.xml")), "acme")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rr.Code, rr.Body)
+	}
+	var created templates.Template
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+
+	for _, tenant := range []string{"globex", ""} {
+		rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates", nil), tenant)
+		if rr.Body.String() != "{\"templates\":[]}\n" {
+			t.Errorf("tenant %q lists %s", tenant, rr.Body)
+		}
+		for _, req := range []*http.Request{
+			httptest.NewRequest(http.MethodGet, "/templates/"+created.ID, nil),
+			httptest.NewRequest(http.MethodGet, "/templates/"+created.ID+"/file", nil),
+			templateUpload(t, http.MethodPut, "/templates/"+created.ID, "", zipPackage(t, "word/document.xml")),
+			httptest.NewRequest(http.MethodDelete, "/templates/"+created.ID, nil),
+		} {
+			if rr := serveTemplates(mux, req, tenant); rr.Code != http.StatusNotFound {
+				t.Errorf("tenant %q %s %s: expected 404, got %d", tenant, req.Method, req.URL, rr.Code)
+			}
+		}
+	}
+
+	rr = serveTemplates(mux, httptest.NewRequest(http.MethodGet, "/templates", nil), "acme")
+	var list struct {
+		Templates []templates.Template `json:"templates"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Templates) != 1 || list.Templates[0].Name != "Letter" {
+		t.Errorf("acme lists %s", rr.Body)
+	}
+}
+
+func TestTemplates_RejectedUploads(t *testing.T) {
+	mux := templatesMux(t)
+	for _, tc := range []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"not multipart", httptest.NewRequest(http.MethodPost, "/templates", bytes.NewReader([]byte("{}"))), http.StatusBadRequest},
+		{"not docx", templateUpload(t, http.MethodPost, "/templates", "", []byte("%PDF-1.7\n")), http.StatusUnsupportedMediaType},
+		{"no document part", templateUpload(t, http.MethodPost, "/templates", "", zipPackage(t, "word/styles.xml")), http.StatusUnsupportedMediaType},
+		{"zip bomb", templateUpload(t, http.MethodPost, "/templates", "", zipBomb(t)), http.StatusRequestEntityTooLarge},
+		{"unknown template", templateUpload(t, http.MethodPut, "/templates/nope", "", zipPackage(t, "word/document.xml")), http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rr := serveTemplates(mux, tc.req, ""); rr.Code != tc.want {
+				t.Errorf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body)
+			}
+		})
+	}
+}
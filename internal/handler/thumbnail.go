@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+	"github.com/BRO3886/go-docpdf/internal/preview"
+)
+
+// Thumbnail handles POST /thumbnail. It renders one page of a PDF, or of a
+// document it converts to PDF first, to a PNG or JPEG image for previews.
+// The "page" parameter picks the page (default 1), "format" the image
+// format (png or jpeg, default png), and either "dpi" or "width" its size
+// (default preview.DefaultDPI).
+type Thumbnail struct {
+	c      *Convert
+	render preview.Renderer
+}
+
+// NewThumbnail returns a Thumbnail handler rendering with render. Options
+// are shared with Convert, and a document is converted as /convert would
+// convert it to PDF.
+func NewThumbnail(conv converter.Converter, render preview.Renderer, opts ...Option) *Thumbnail {
+	h := NewConvert(conv, opts...)
+	h.pdfOnly = true
+	return &Thumbnail{c: h, render: render}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Thumbnail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.c.admit(w, r); err != nil {
+		err.write(w, r)
+		return
+	}
+
+	c := &conversion{}
+	defer c.cleanup()
+	if err := h.serve(w, r, c); err != nil {
+		if err.badUpload != "" && h.c.onBadUpload != nil {
+			h.c.onBadUpload(err.badUpload)
+		}
+		err.write(w, r)
+	}
+}
+
+// serve runs the stages for one request. An uploaded PDF skips the
+// conversion.
+func (h *Thumbnail) serve(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.run(w, r, c, []stage{{stageParse, h.c.parse}}); err != nil {
+		return err
+	}
+	page, opts, err := h.options(r)
+	if err != nil {
+		return err
+	}
+	uploadedPDF := isPDF(c.inputPath)
+	stages := []stage{
+		{stageValidate, h.validate},
+		{stageStage, h.c.stage},
+		{stageConvert, h.c.runConversion},
+		{stagePost, h.c.postProcess},
+	}
+	if uploadedPDF {
+		stages = []stage{{stageValidate, h.validatePDF}, {stagePost, h.c.postProcess}}
+	}
+	stages = append(stages, stage{stageRespond, func(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+		return h.respond(w, r, c, page, opts, uploadedPDF)
+	}})
+	return h.c.run(w, r, c, stages)
+}
+
+// options reads the page and image parameters.
+func (h *Thumbnail) options(r *http.Request) (int, preview.Options, *stageError) {
+	page := 1
+	if v := h.c.param(r, "page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, preview.Options{}, fail(http.StatusBadRequest, "invalid page "+strconv.Quote(v), "page must be a positive integer")
+		}
+		page = n
+	}
+	var opts preview.Options
+	if v := h.c.param(r, "format"); v != "" {
+		f, err := preview.ParseFormat(v)
+		if err != nil {
+			return 0, preview.Options{}, fail(http.StatusBadRequest, err.Error(), "format must be png or jpeg")
+		}
+		opts.Format = f
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"dpi", &opts.DPI}, {"width", &opts.Width}} {
+		if v := h.c.param(r, p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, preview.Options{}, fail(http.StatusBadRequest, "invalid "+p.name+" "+strconv.Quote(v), "invalid thumbnail size")
+			}
+			*p.dst = n
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return 0, preview.Options{}, fail(http.StatusBadRequest, err.Error(), "invalid thumbnail size")
+	}
+	return page, opts, nil
+}
+
+// validate is the Convert validate stage, less what cannot be rendered.
+func (h *Thumbnail) validate(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.validate(w, r, c); err != nil {
+		return err
+	}
+	return h.check(r, c)
+}
+
+// validatePDF takes an uploaded PDF as the result to render.
+func (h *Thumbnail) validatePDF(w http.ResponseWriter, r *http.Request, c *conversion) *stageError {
+	if err := h.c.takePDF(r, c); err != nil {
+		return err
+	}
+	return h.check(r, c)
+}
+
+// check rejects options whose result cannot be rendered, and a
+// content_type override: the response is always labelled as the image.
+func (h *Thumbnail) check(r *http.Request, c *conversion) *stageError {
+	if h.c.param(r, "content_type") != "" {
+		return fail(http.StatusBadRequest, "content_type with thumbnail", "content_type override not allowed")
+	}
+	return checkPDFResult(c)
+}
+
+// respond renders the page and sends the image. The page count is checked
+// first where pdfpost can read the PDF; pdftoppm reads more than it does,
+// so one it cannot is still rendered.
+func (h *Thumbnail) respond(w http.ResponseWriter, r *http.Request, c *conversion, page int, opts preview.Options, uploadedPDF bool) *stageError {
+	if n, ok := pageCount(c.outPath); ok && page > n {
+		return fail(http.StatusBadRequest, "page "+strconv.Itoa(page)+" of "+strconv.Itoa(n), "page outside the document")
+	}
+
+	ctx := r.Context()
+	if h.c.timeouts.Convert > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.c.timeouts.Convert)
+		defer cancel()
+	}
+	img, err := h.render.Render(ctx, c.outPath, page, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		serr := fail(http.StatusGatewayTimeout, "thumbnail rendering timed out", "conversion timed out")
+		serr.outcome = "timeout"
+		return serr
+	case uploadedPDF:
+		return fail(http.StatusUnprocessableEntity, "render: "+err.Error(), "PDF could not be rendered")
+	default:
+		return fail(http.StatusInternalServerError, "render: "+err.Error(), "conversion failed")
+	}
+
+	middleware.SetOutcome(r.Context(), "success")
+	dlv := c.dlv
+	dlv.contentType = preview.ContentType(opts.Format)
+	ext := "png"
+	if opts.Format == preview.FormatJPEG {
+		ext = "jpg"
+	}
+	dlv.filename = resultFilename(c.uploadName, ext)
+	dlv.send(w, r, bytes.NewReader(img), time.Time{})
+	return nil
+}
+
+// pageCount returns the number of pages of the PDF at path, if pdfpost can
+// read it.
+func pageCount(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	doc, err := pdfpost.Open(data)
+	if err != nil {
+		return 0, false
+	}
+	n, err := doc.NumPages()
+	return n, err == nil
+}
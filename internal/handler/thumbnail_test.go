@@ -0,0 +1,121 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/preview"
+)
+
+// fakeRenderer records what it was asked to render and returns a stand-in
+// image, or err.
+type fakeRenderer struct {
+	page int
+	opts preview.Options
+	pdf  []byte
+	err  error
+}
+
+func (f *fakeRenderer) Render(_ context.Context, pdfPath string, page int, opts preview.Options) ([]byte, error) {
+	f.page, f.opts = page, opts
+	f.pdf, _ = os.ReadFile(pdfPath)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte("image"), nil
+}
+
+func buildThumbnailRequest(t *testing.T, name string, body []byte, query string) *http.Request {
+	t.Helper()
+	req := buildSplitRequest(t, name, body, query)
+	req.URL.Path = "/thumbnail"
+	return req
+}
+
+func TestThumbnail_PDF(t *testing.T) {
+	mock := pdfMock()
+	render := &fakeRenderer{}
+	rr := httptest.NewRecorder()
+	handler.NewThumbnail(mock, render).ServeHTTP(rr, buildThumbnailRequest(t, "report.pdf", pagesPDF(3), "page=2&dpi=150&disposition=inline"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "inline; filename=report.png" {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if rr.Body.String() != "image" {
+		t.Errorf("body = %q", rr.Body.String())
+	}
+	if render.page != 2 || render.opts != (preview.Options{DPI: 150}) {
+		t.Errorf("rendered page %d with %+v", render.page, render.opts)
+	}
+	if len(mock.calls) != 0 {
+		t.Error("PDF upload converted")
+	}
+}
+
+func TestThumbnail_ConvertsDocument(t *testing.T) {
+	mock := &mockConverter{callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+		path := filepath.Join(outDir, "input.pdf")
+		return path, os.WriteFile(path, pagesPDF(2), 0600)
+	}}
+	render := &fakeRenderer{}
+	rr := httptest.NewRecorder()
+	handler.NewThumbnail(mock, render).ServeHTTP(rr, buildThumbnailRequest(t, "deck.docx", validDocxBody(512), "format=jpg&width=320&disposition=attachment"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=deck.jpg" {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if render.page != 1 || render.opts != (preview.Options{Format: preview.FormatJPEG, Width: 320}) {
+		t.Errorf("rendered page %d with %+v", render.page, render.opts)
+	}
+	if string(render.pdf) != string(pagesPDF(2)) {
+		t.Error("rendered something other than the converted PDF")
+	}
+}
+
+func TestThumbnail_Rejected(t *testing.T) {
+	for name, tc := range map[string]struct {
+		file   string
+		body   []byte
+		query  string
+		err    error
+		status int
+	}{
+		"page zero":      {"a.pdf", pagesPDF(2), "page=0", nil, http.StatusBadRequest},
+		"past the end":   {"a.pdf", pagesPDF(2), "page=3", nil, http.StatusBadRequest},
+		"bad format":     {"a.pdf", pagesPDF(2), "format=gif", nil, http.StatusBadRequest},
+		"dpi and width":  {"a.pdf", pagesPDF(2), "dpi=96&width=200", nil, http.StatusBadRequest},
+		"huge width":     {"a.pdf", pagesPDF(2), "width=100000", nil, http.StatusBadRequest},
+		"content type":   {"a.pdf", pagesPDF(2), "content_type=image/webp", nil, http.StatusBadRequest},
+		"odt output":     {"a.docx", validDocxBody(512), "output=odt", nil, http.StatusBadRequest},
+		"passwords":      {"a.docx", validDocxBody(512), "user_password=open-sesame", nil, http.StatusBadRequest},
+		"unrenderable":   {"a.pdf", pagesPDF(2), "", errors.New("pdftoppm: exit status 1"), http.StatusUnprocessableEntity},
+		"render timeout": {"a.pdf", pagesPDF(2), "", context.DeadlineExceeded, http.StatusGatewayTimeout},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h := handler.NewThumbnail(pdfMock(), &fakeRenderer{err: tc.err})
+			h.ServeHTTP(rr, buildThumbnailRequest(t, tc.file, tc.body, tc.query))
+			if rr.Code != tc.status {
+				t.Errorf("expected %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
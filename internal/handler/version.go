@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+)
+
+// API versions. V1 is the original API, frozen so existing clients keep
+// today's exact responses; changes to response shapes ship in V2.
+const (
+	V1 = 1
+	V2 = 2
+
+	// latestVersion is the newest version a client can ask for.
+	latestVersion = V2
+)
+
+// versionHeader selects the version on unprefixed routes, and reports the
+// version a response was produced under.
+const versionHeader = "API-Version"
+
+// Versions is middleware that serves every route under /v1/ and /v2/ as well
+// as unprefixed. The prefix is stripped before next routes the request. The
+// version is taken from the prefix, else from an API-Version request header,
+// else V1, and is echoed in the API-Version response header, where the error
+// writers read it. An unknown version gets 404 by prefix and 400 by header.
+func Versions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, rest, prefixed := splitVersion(r.URL.Path)
+		switch {
+		case prefixed && version == 0:
+			w.Header().Set(versionHeader, strconv.Itoa(latestVersion))
+			writeError(w, r, http.StatusNotFound, "unknown API version")
+			return
+		case prefixed:
+			r = stripVersion(r, rest)
+		default:
+			w.Header().Add("Vary", versionHeader)
+			version = V1
+			if h := r.Header.Get(versionHeader); h != "" {
+				v, err := strconv.Atoi(strings.TrimSpace(h))
+				if err != nil || v < V1 || v > latestVersion {
+					w.Header().Set(versionHeader, strconv.Itoa(latestVersion))
+					writeError(w, r, http.StatusBadRequest, "unsupported API-Version; latest is "+strconv.Itoa(latestVersion))
+					return
+				}
+				version = v
+			}
+		}
+		w.Header().Set(versionHeader, strconv.Itoa(version))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitVersion splits a "/vN/..." path into N and the rest. prefixed reports
+// whether the path had a version prefix at all; version is 0 when N is not a
+// supported version.
+func splitVersion(path string) (version int, rest string, prefixed bool) {
+	seg, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if len(seg) < 2 || seg[0] != 'v' {
+		return 0, path, false
+	}
+	n, err := strconv.Atoi(seg[1:])
+	if err != nil {
+		return 0, path, false
+	}
+	if n < V1 || n > latestVersion {
+		return 0, "", true
+	}
+	return n, "/" + rest, true
+}
+
+// stripVersion returns a copy of r addressed to path.
+func stripVersion(r *http.Request, path string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	return r2
+}
+
+// errorBody builds a JSON error body in the shape of the response's API
+// version. V1 bodies carry the message, and a code only where one was
+// assigned. V2 bodies always carry a code, falling back to one derived from
+// the status (e.g. "request_entity_too_large"), and the request ID. Only the
+// message is localized; codes are the same in every language.
+func errorBody(w http.ResponseWriter, r *http.Request, status int, code, msg string) map[string]string {
+	body := map[string]string{"error": i18n.Localize(w, r, msg)}
+	if responseVersion(w) < V2 {
+		if code != "" {
+			body["code"] = code
+		}
+		return body
+	}
+	if code == "" {
+		code = statusCode(status)
+	}
+	body["code"] = code
+	if id := w.Header().Get("X-Request-ID"); id != "" {
+		body["request_id"] = id
+	}
+	return body
+}
+
+// responseVersion returns the API version the response on w is produced
+// under, V1 outside the Versions middleware.
+func responseVersion(w http.ResponseWriter) int {
+	if v, err := strconv.Atoi(w.Header().Get(versionHeader)); err == nil {
+		return v
+	}
+	return V1
+}
+
+// statusCode is the code of an error with no more specific one: its status
+// text in snake case, e.g. "service_unavailable".
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
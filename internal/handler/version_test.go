@@ -0,0 +1,105 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+// versionedMux serves /convert behind the Versions middleware.
+func versionedMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/convert", handler.NewConvert(happyMock()))
+	return handler.Versions(mux)
+}
+
+func TestVersions_Routing(t *testing.T) {
+	cases := []struct {
+		path, header string
+		wantStatus   int
+		wantVersion  string
+	}{
+		{"/convert", "", http.StatusOK, "1"},
+		{"/v1/convert", "", http.StatusOK, "1"},
+		{"/v2/convert", "", http.StatusOK, "2"},
+		{"/convert", "2", http.StatusOK, "2"},
+		{"/v1/convert", "2", http.StatusOK, "1"}, // the prefix wins
+		{"/v9/convert", "", http.StatusNotFound, "2"},
+		{"/convert", "9", http.StatusBadRequest, "2"},
+		{"/convert", "two", http.StatusBadRequest, "2"},
+	}
+	for _, tc := range cases {
+		req := buildRequest(t, validDocxBody(1024))
+		req.URL.Path = tc.path
+		if tc.header != "" {
+			req.Header.Set("API-Version", tc.header)
+		}
+		rr := httptest.NewRecorder()
+		versionedMux().ServeHTTP(rr, req)
+
+		if rr.Code != tc.wantStatus {
+			t.Errorf("%s (API-Version %q): status %d, want %d: %s", tc.path, tc.header, rr.Code, tc.wantStatus, rr.Body.String())
+		}
+		if got := rr.Header().Get("API-Version"); got != tc.wantVersion {
+			t.Errorf("%s (API-Version %q): version %q, want %q", tc.path, tc.header, got, tc.wantVersion)
+		}
+	}
+}
+
+func TestVersions_ErrorShape(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want map[string]string
+	}{
+		// v1 keeps today's body exactly.
+		{"/v1/convert", map[string]string{"error": "unsupported file type"}},
+		{"/v2/convert", map[string]string{"error": "unsupported file type", "code": "unsupported_media_type", "request_id": "req-7"}},
+	} {
+		req := buildRequest(t, []byte("\x00\x01 not a document"))
+		req.URL.Path = tc.path
+		rr := httptest.NewRecorder()
+		rr.Header().Set("X-Request-ID", "req-7") // as the RequestID middleware does
+		versionedMux().ServeHTTP(rr, req)
+
+		var got map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: decode: %v", tc.path, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: body %v, want %v", tc.path, got, tc.want)
+			continue
+		}
+		for k, v := range tc.want {
+			if got[k] != v {
+				t.Errorf("%s: body %v, want %v", tc.path, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestErrors_Localized(t *testing.T) {
+	req := buildRequest(t, []byte("\x00\x01 not a document"))
+	req.URL.Path = "/v2/convert"
+	req.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, en;q=0.5")
+	rr := httptest.NewRecorder()
+	versionedMux().ServeHTTP(rr, req)
+
+	var got map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["error"] != "type de fichier non pris en charge" {
+		t.Errorf("error = %q, want the French message", got["error"])
+	}
+	// The code is what clients branch on, so it is never translated.
+	if got["code"] != "unsupported_media_type" {
+		t.Errorf("code = %q, want unsupported_media_type", got["code"])
+	}
+	if cl := rr.Header().Get("Content-Language"); cl != "fr" {
+		t.Errorf("Content-Language = %q, want fr", cl)
+	}
+}
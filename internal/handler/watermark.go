@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// maxWatermarkImage caps the watermark_image upload.
+const maxWatermarkImage = 1 << 20 // 1 MB
+
+// watermarkImageName is the file a watermark_image part is staged in, next
+// to the upload.
+const watermarkImageName = "watermark-image"
+
+// watermarkRequest holds a request's watermark parameters.
+type watermarkRequest struct {
+	text     string
+	image    []byte
+	position string
+	opacity  string
+}
+
+// watermarkStep reads the watermark parameters of a /convert request, and
+// the watermark_image staged by readMultipart, and resolves its watermark.
+func (h *Convert) watermarkStep(r *http.Request, c *conversion) (pdfpost.Step, *stageError) {
+	req := watermarkRequest{
+		text:     h.param(r, "watermark"),
+		position: h.param(r, "watermark_position"),
+		opacity:  h.param(r, "watermark_opacity"),
+	}
+	img, err := os.ReadFile(filepath.Join(c.dir.Path(), watermarkImageName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fail(http.StatusInternalServerError, "internal error: read watermark image", "internal error")
+	}
+	req.image = img
+	return watermark(r, c.opts, req)
+}
+
+// watermark resolves the watermark stamped on a result converted with opts:
+// the request's own, else its API key's, else none (a nil Step). The
+// request's position and opacity also apply to the key's watermark.
+func watermark(r *http.Request, opts converter.Options, req watermarkRequest) (pdfpost.Step, *stageError) {
+	wm := pdfpost.Watermark{Text: req.text, Image: req.image}
+	position, opacity := req.position, req.opacity
+	if k, ok := auth.FromContext(r.Context()); ok && k.Watermark != nil && wm.Text == "" && wm.Image == nil {
+		wm.Text, wm.Image = k.Watermark.Text, k.Watermark.ImageData
+		if position == "" {
+			position = k.Watermark.Position
+		}
+		if opacity == "" && k.Watermark.Opacity != 0 {
+			opacity = strconv.FormatFloat(k.Watermark.Opacity, 'f', -1, 64)
+		}
+	}
+	if wm.Text == "" && wm.Image == nil {
+		return nil, nil
+	}
+
+	switch {
+	case opts.Format != converter.FormatPDF:
+		return nil, fail(http.StatusBadRequest, "watermark with non-pdf output", "watermark requires pdf output")
+	case strings.HasPrefix(opts.PDFVersion, "pdfa-"):
+		// The stamp's font is not embedded, which PDF/A forbids.
+		return nil, fail(http.StatusBadRequest, "watermark with pdf/a output", "watermark cannot be used with pdf/a")
+	case opts.Encrypted():
+		// An encrypted result cannot be edited after conversion.
+		return nil, fail(http.StatusBadRequest, "watermark with encrypted output", "watermark cannot be used with passwords")
+	}
+	var err error
+	if wm.Position, err = pdfpost.ParsePosition(position); err != nil {
+		return nil, fail(http.StatusBadRequest, err.Error(), "watermark_position must be diagonal, center, top or bottom")
+	}
+	if opacity != "" {
+		if wm.Opacity, err = strconv.ParseFloat(opacity, 64); err != nil || !(wm.Opacity > 0 && wm.Opacity <= 1) {
+			return nil, fail(http.StatusBadRequest, "invalid watermark_opacity", "watermark_opacity must be between 0 and 1")
+		}
+	}
+	if wm.Image != nil {
+		if err := pdfpost.CheckImage(wm.Image); err != nil {
+			return nil, fail(http.StatusBadRequest, err.Error(), "watermark image must be a png or jpeg")
+		}
+	}
+	wm.Text = expandWatermark(r, wm.Text, time.Now())
+	return wm, nil
+}
+
+// expandWatermark fills in the placeholders of watermark text: {client},
+// the API key's name; {tenant}; {date} and {time}, in UTC.
+func expandWatermark(r *http.Request, text string, now time.Time) string {
+	if !strings.Contains(text, "{") {
+		return text
+	}
+	var client string
+	if k, ok := auth.FromContext(r.Context()); ok {
+		client = k.Name
+	}
+	now = now.UTC()
+	return strings.NewReplacer(
+		"{client}", client,
+		"{tenant}", tenantID(r),
+		"{date}", now.Format(time.DateOnly),
+		"{time}", now.Format("2006-01-02 15:04 UTC"),
+	).Replace(text)
+}
+
+// errWatermarkImageTooLarge is the 413 sent for a watermark_image over
+// maxWatermarkImage.
+func errWatermarkImageTooLarge() *stageError {
+	return fail(http.StatusRequestEntityTooLarge, "watermark image too large", "watermark image too large")
+}
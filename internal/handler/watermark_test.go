@@ -0,0 +1,275 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/auth"
+	"github.com/BRO3886/go-docpdf/internal/cache"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+// onePagePDF is a minimal but well-formed PDF, one that a watermark can be
+// stamped on.
+func onePagePDF() []byte {
+	objs := []string{
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [3 0 R] /Count 1>>",
+		"<</Type /Page /Parent 2 0 R /MediaBox [0 0 612 792]>>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfMock returns a mockConverter that writes onePagePDF.
+func pdfMock() *mockConverter {
+	return &mockConverter{
+		callsFn: func(_ context.Context, _ string, outDir string) (string, error) {
+			pdfPath := filepath.Join(outDir, "input.pdf")
+			_ = os.WriteFile(pdfPath, onePagePDF(), 0600)
+			return pdfPath, nil
+		},
+	}
+}
+
+// buildWatermarkRequest is buildRequest with a watermark_image part.
+func buildWatermarkRequest(t *testing.T, body, img []byte) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range []struct {
+		field, name string
+		data        []byte
+	}{{"watermark_image", "stamp.png", img}, {"file", "test.docx", body}} {
+		fw, err := mw.CreateFormFile(p.field, p.name)
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		_, _ = fw.Write(p.data)
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/convert", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConvert_Watermark(t *testing.T) {
+	ks, err := auth.NewKeystore([]auth.Key{{Name: "team-a", Secret: "s3cret", Tenant: "acme"}}, "")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	h := auth.Middleware(ks, handler.NewConvert(pdfMock(), handler.WithCache(cache.New(1<<20), nil)))
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "watermark=CONFIDENTIAL+{client}+{tenant}&watermark_position=top&watermark_opacity=0.5"
+	req.Header.Set("X-API-Key", "s3cret")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.Bytes()
+	if !bytes.HasPrefix(body, onePagePDF()) {
+		t.Error("converted PDF not kept as the prefix of the result")
+	}
+	for _, want := range []string{"(CONFIDENTIAL team-a acme) Tj", "/CA 0.5", "/F1 12 Tf"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("result lacks %q", want)
+		}
+	}
+	if x := rr.Header().Get("X-Cache"); x != "" {
+		t.Errorf("watermarked result went through the cache: X-Cache %q", x)
+	}
+}
+
+func TestConvert_WatermarkImage(t *testing.T) {
+	h := handler.NewConvert(pdfMock())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, buildWatermarkRequest(t, validDocxBody(512), pngImage(t)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !bytes.Contains(rr.Body.Bytes(), []byte("/Im1 Do")) {
+		t.Error("image watermark not drawn")
+	}
+}
+
+func TestConvert_KeyWatermark(t *testing.T) {
+	ks, err := auth.NewKeystore([]auth.Key{{
+		Name: "team-a", Secret: "s3cret", Tenant: "acme",
+		Watermark: &auth.Watermark{Text: "Licensed to {tenant}", Position: "bottom"},
+	}}, "")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	h := auth.Middleware(ks, handler.NewConvert(pdfMock()))
+	for query, want := range map[string]string{
+		"":                       "(Licensed to acme) Tj",
+		"watermark=DRAFT":        "(DRAFT) Tj",
+		"watermark_position=top": "(Licensed to acme) Tj",
+	} {
+		req := buildRequest(t, validDocxBody(512))
+		req.URL.RawQuery = query
+		req.Header.Set("X-API-Key", "s3cret")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		if !bytes.Contains(rr.Body.Bytes(), []byte(want)) {
+			t.Errorf("%q: result lacks %q", query, want)
+		}
+	}
+
+	// The key's watermark makes other output formats unavailable to it.
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "output=png"
+	req.Header.Set("X-API-Key", "s3cret")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for png output under a key watermark, got %d", rr.Code)
+	}
+}
+
+func TestConvert_WatermarkRejected(t *testing.T) {
+	for name, query := range map[string]string{
+		"png output":  "output=png&watermark=x",
+		"pdf/a":       "target_pdf_version=pdfa-2b&watermark=x",
+		"passwords":   "user_password=open-sesame&watermark=x",
+		"position":    "watermark=x&watermark_position=left",
+		"opacity":     "watermark=x&watermark_opacity=0",
+		"opacity nan": "watermark=x&watermark_opacity=NaN",
+	} {
+		t.Run(name, func(t *testing.T) {
+			mc := pdfMock()
+			h := handler.NewConvert(mc)
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.RawQuery = query
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called")
+			}
+		})
+	}
+
+	for name, tc := range map[string]struct {
+		img  []byte
+		want int
+	}{
+		"not an image": {[]byte("GIF89a"), http.StatusBadRequest},
+		"too large":    {make([]byte, 1<<20+1), http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mc := pdfMock()
+			h := handler.NewConvert(mc)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, buildWatermarkRequest(t, validDocxBody(512), tc.img))
+
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rr.Code, rr.Body.String())
+			}
+			if len(mc.calls) != 0 {
+				t.Error("converter should not be called")
+			}
+		})
+	}
+}
+
+func TestConvert_WatermarkUnsupportedResult(t *testing.T) {
+	// happyMock's "%PDF-1.4 fake" has no cross-reference table to update.
+	h := handler.NewConvert(happyMock())
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.RawQuery = "watermark=x"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "pdfpost") {
+		t.Errorf("error leaks internals: %s", rr.Body.String())
+	}
+}
+
+func TestConvertAsync_Watermark(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, TTL: time.Hour})
+	defer mgr.Close()
+	jh := handler.NewJobs(mgr)
+	mux := http.NewServeMux()
+	mux.Handle("/convert/async", handler.NewConvertAsync(pdfMock(), mgr))
+	mux.HandleFunc("GET /jobs/{id}", jh.Status)
+	mux.HandleFunc("GET /jobs/{id}/result", jh.Result)
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.Path = "/convert/async"
+	req.URL.RawQuery = "watermark=DRAFT"
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var job struct {
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+		ResultURL string `json:"result_url"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &job)
+	deadline := time.Now().Add(2 * time.Second)
+	for job.Status != "succeeded" {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never succeeded, last status %q", job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID, nil))
+		_ = json.Unmarshal(rr.Body.Bytes(), &job)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, job.ResultURL, nil))
+	if !strings.Contains(rr.Body.String(), "(DRAFT) Tj") {
+		t.Error("job result not watermarked")
+	}
+}
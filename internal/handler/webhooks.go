@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/outbox"
+	"github.com/BRO3886/go-docpdf/internal/webhook"
+)
+
+// WithWebhooks lets /convert/async callers pass a callback_url, which d
+// notifies when the job finishes (see JobNotifier).
+func WithWebhooks(d *webhook.Dispatcher) Option {
+	return func(h *Convert) { h.hooks = d }
+}
+
+// callbackURL returns the validated callback_url parameter, failing with 400
+// when it is present but unusable.
+func (h *Convert) callbackURL(r *http.Request) (string, *stageError) {
+	raw := h.param(r, "callback_url")
+	if raw == "" {
+		return "", nil
+	}
+	if h.hooks == nil {
+		return "", fail(http.StatusBadRequest, "callback_url without webhooks configured", "callback_url is not supported")
+	}
+	if err := h.hooks.CheckURL(raw); err != nil {
+		return "", fail(http.StatusBadRequest, err.Error(), "invalid callback_url")
+	}
+	return raw, nil
+}
+
+// webhookEvent is the JSON body of a job webhook.
+type webhookEvent struct {
+	Event string      `json:"event"`
+	Job   jobResponse `json:"job"`
+}
+
+// JobEvents returns a jobs.Config.OnFinish hook that adds a "job.succeeded"
+// or "job.failed" event to o for jobs with a callback URL. The outbox's
+// publisher delivers it.
+func JobEvents(o *outbox.Outbox) func(jobs.Job) {
+	return func(j jobs.Job) {
+		if j.CallbackURL == "" {
+			return
+		}
+		event := "job." + string(j.State)
+		payload, err := json.Marshal(webhookEvent{Event: event, Job: newJobResponse(j)})
+		if err != nil {
+			return
+		}
+		_ = o.Add(outbox.Event{Kind: event, Key: j.ID, Target: j.CallbackURL, Payload: payload, Traceparent: j.Traceparent})
+	}
+}
+
+// Webhooks serves the admin delivery-status and redelivery endpoints.
+type Webhooks struct {
+	d *webhook.Dispatcher
+}
+
+// NewWebhooks returns a Webhooks handler backed by d.
+func NewWebhooks(d *webhook.Dispatcher) *Webhooks {
+	return &Webhooks{d: d}
+}
+
+// deliveryResponse is the JSON representation of a webhook delivery.
+type deliveryResponse struct {
+	ID             string    `json:"id"`
+	JobID          string    `json:"job_id"`
+	Event          string    `json:"event"`
+	URL            string    `json:"url"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	LastStatusCode int       `json:"last_status_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func newDeliveryResponse(dl webhook.Delivery) deliveryResponse {
+	return deliveryResponse{
+		ID:             dl.ID,
+		JobID:          dl.JobID,
+		Event:          dl.Event,
+		URL:            dl.URL,
+		Status:         string(dl.Status),
+		Attempts:       dl.Attempts,
+		LastStatusCode: dl.LastStatusCode,
+		LastError:      dl.LastError,
+		CreatedAt:      dl.CreatedAt,
+		UpdatedAt:      dl.UpdatedAt,
+	}
+}
+
+// List handles GET /admin/webhooks, newest first. ?job_id= filters by job.
+func (h *Webhooks) List(w http.ResponseWriter, r *http.Request) {
+	resp := []deliveryResponse{}
+	for _, dl := range h.d.List(r.URL.Query().Get("job_id")) {
+		resp = append(resp, newDeliveryResponse(dl))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": resp})
+}
+
+// Redeliver handles POST /admin/webhooks/{delivery_id}/redeliver. The
+// delivery is re-sent in the background with the same delivery ID; the
+// response is 202 with its status.
+func (h *Webhooks) Redeliver(w http.ResponseWriter, r *http.Request) {
+	dl, err := h.d.Redeliver(r.PathValue("delivery_id"))
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusAccepted, newDeliveryResponse(dl))
+	case errors.Is(err, webhook.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "delivery not found")
+	case errors.Is(err, webhook.ErrInProgress):
+		writeError(w, r, http.StatusConflict, "delivery in progress")
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// Outbox serves the admin outbox endpoints.
+type Outbox struct {
+	o *outbox.Outbox
+}
+
+// NewOutbox returns an Outbox handler backed by o.
+func NewOutbox(o *outbox.Outbox) *Outbox {
+	return &Outbox{o: o}
+}
+
+// Flush handles POST /admin/outbox/flush: every pending event is attempted
+// immediately, ignoring backoff, and the counts are returned.
+func (h *Outbox) Flush(w http.ResponseWriter, r *http.Request) {
+	res, err := h.o.Flush(r.Context())
+	if err != nil {
+		middleware.SetLogError(r.Context(), "outbox flush: "+err.Error())
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,187 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/handler"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/outbox"
+	"github.com/BRO3886/go-docpdf/internal/webhook"
+)
+
+func TestConvertAsync_CallbackWebhook(t *testing.T) {
+	secret := []byte("hook-secret")
+	type event struct {
+		Event string `json:"event"`
+		Job   struct {
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			ResultURL string `json:"result_url"`
+		} `json:"job"`
+	}
+	got := make(chan event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+			t.Errorf("signature did not verify: %v", err)
+		}
+		var ev event
+		_ = json.Unmarshal(body, &ev)
+		got <- ev
+	}))
+	defer receiver.Close()
+
+	hooks := webhook.New(webhook.Config{Secret: secret})
+	defer hooks.Close()
+	events := outbox.New(outbox.Config{Publisher: hooks})
+	defer events.Close()
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4, OnFinish: handler.JobEvents(events)})
+	defer mgr.Close()
+	h := handler.NewConvertAsync(happyMock(), mgr, handler.WithWebhooks(hooks))
+
+	req := buildRequest(t, validDocxBody(512))
+	req.URL.Path = "/convert/async"
+	req.URL.RawQuery = "callback_url=" + url.QueryEscape(receiver.URL+"/done")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case ev := <-got:
+		if ev.Event != "job.succeeded" || ev.Job.Status != "succeeded" || ev.Job.ResultURL == "" {
+			t.Errorf("unexpected webhook event: %+v", ev)
+		}
+		if deliveries := hooks.List(ev.Job.ID); len(deliveries) != 1 {
+			t.Errorf("expected 1 delivery recorded for the job, got %d", len(deliveries))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestConvertAsync_CallbackRejected(t *testing.T) {
+	mgr := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 4})
+	defer mgr.Close()
+	hooks := webhook.New(webhook.Config{Secret: []byte("s"), AllowedHosts: []string{"hooks.example.com"}})
+	defer hooks.Close()
+
+	tests := []struct {
+		name     string
+		h        *handler.Convert
+		callback string
+	}{
+		{"webhooks disabled", handler.NewConvertAsync(happyMock(), mgr), "https://hooks.example.com/"},
+		{"not http", handler.NewConvertAsync(happyMock(), mgr, handler.WithWebhooks(hooks)), "file:///etc/passwd"},
+		{"host not allowed", handler.NewConvertAsync(happyMock(), mgr, handler.WithWebhooks(hooks)), "http://169.254.169.254/"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := buildRequest(t, validDocxBody(512))
+			req.URL.Path = "/convert/async"
+			req.URL.RawQuery = "callback_url=" + url.QueryEscape(tc.callback)
+			rr := httptest.NewRecorder()
+			tc.h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+			assertJSONError(t, rr.Body.String())
+		})
+	}
+}
+
+func TestWebhooks_ListAndRedeliver(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	hooks := webhook.New(webhook.Config{Secret: []byte("s"), MaxAttempts: 1})
+	defer hooks.Close()
+	dl := hooks.Send("job1", receiver.URL, "job.succeeded", []byte(`{}`))
+
+	wh := handler.NewWebhooks(hooks)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/webhooks", wh.List)
+	mux.HandleFunc("POST /admin/webhooks/{delivery_id}/redeliver", wh.Redeliver)
+
+	var list struct {
+		Deliveries []struct {
+			ID             string `json:"id"`
+			Status         string `json:"status"`
+			LastStatusCode int    `json:"last_status_code"`
+		} `json:"deliveries"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(list.Deliveries) == 0 || list.Deliveries[0].Status != "failed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery never failed: %+v", list)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/webhooks?job_id=job1", nil))
+		_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	}
+	if list.Deliveries[0].ID != dl.ID || list.Deliveries[0].LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("unexpected listing: %+v", list)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/webhooks/"+dl.ID+"/redeliver", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/webhooks/nope/redeliver", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	assertJSONError(t, rr.Body.String())
+}
+
+func TestOutbox_Flush(t *testing.T) {
+	var up atomic.Bool
+	events := outbox.New(outbox.Config{
+		Interval: time.Hour,
+		Backoff:  time.Hour,
+		Publisher: outbox.PublisherFunc(func(context.Context, outbox.Event) error {
+			if !up.Load() {
+				return errors.New("broker down")
+			}
+			return nil
+		}),
+	})
+	defer events.Close()
+	_ = events.Add(outbox.Event{Kind: "job.succeeded", Key: "job1"})
+
+	flush := func() map[string]int {
+		rr := httptest.NewRecorder()
+		handler.NewOutbox(events).Flush(rr, httptest.NewRequest(http.MethodPost, "/admin/outbox/flush", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var res map[string]int
+		_ = json.Unmarshal(rr.Body.Bytes(), &res)
+		return res
+	}
+
+	if res := flush(); res["failed"] != 1 || res["pending"] != 1 {
+		t.Errorf("expected the event to stay pending while down, got %v", res)
+	}
+	up.Store(true)
+	if res := flush(); res["published"] != 1 || res["pending"] != 0 {
+		t.Errorf("expected the event to be published by flush despite backoff, got %v", res)
+	}
+}
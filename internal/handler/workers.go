@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+)
+
+// WorkerPool is a converter that keeps LibreOffice processes running between
+// conversions, such as converter.UnoServer.
+type WorkerPool interface {
+	Workers() []converter.WorkerStatus
+	RecycleWorker(id int) error
+}
+
+// Workers serves the admin endpoints listing and recycling the converter's
+// pooled LibreOffice processes.
+type Workers struct {
+	pool WorkerPool
+}
+
+// NewWorkers returns a Workers handler backed by pool.
+func NewWorkers(pool WorkerPool) *Workers {
+	return &Workers{pool: pool}
+}
+
+// workerResponse is the JSON representation of a worker.
+type workerResponse struct {
+	ID          int    `json:"id"`
+	State       string `json:"state"`
+	RequestID   string `json:"request_id,omitempty"`
+	Conversions int64  `json:"conversions"`
+	// UptimeSeconds is how long the current process has been ready; 0
+	// while it is starting.
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	PID           int   `json:"pid,omitempty"`
+	RSSBytes      int64 `json:"rss_bytes,omitempty"`
+}
+
+func newWorkerResponse(st converter.WorkerStatus, now time.Time) workerResponse {
+	resp := workerResponse{
+		ID:          st.ID,
+		State:       st.State,
+		RequestID:   st.RequestID,
+		Conversions: st.Conversions,
+		PID:         st.PID,
+		RSSBytes:    st.RSS,
+	}
+	if !st.Started.IsZero() {
+		resp.UptimeSeconds = int64(now.Sub(st.Started).Seconds())
+	}
+	return resp
+}
+
+// List handles GET /admin/workers.
+func (h *Workers) List(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	resp := []workerResponse{}
+	for _, st := range h.pool.Workers() {
+		resp = append(resp, newWorkerResponse(st, now))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"workers": resp})
+}
+
+// Recycle handles POST /admin/workers/{id}/recycle. The worker is restarted
+// with a fresh profile in the background, failing any conversion it is
+// running; the response is 202 with its status, "starting" until it is
+// back.
+func (h *Workers) Recycle(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "worker not found")
+		return
+	}
+	switch err := h.pool.RecycleWorker(id); {
+	case errors.Is(err, converter.ErrUnknownWorker):
+		writeError(w, r, http.StatusNotFound, "worker not found")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	st := h.pool.Workers()[id]
+	writeJSON(w, http.StatusAccepted, newWorkerResponse(st, time.Now()))
+}
@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/converter"
+	"github.com/BRO3886/go-docpdf/internal/handler"
+)
+
+// fakeWorkers is a handler.WorkerPool whose workers are recycled in place.
+type fakeWorkers struct {
+	workers []converter.WorkerStatus
+}
+
+func (f *fakeWorkers) Workers() []converter.WorkerStatus {
+	return append([]converter.WorkerStatus(nil), f.workers...)
+}
+
+func (f *fakeWorkers) RecycleWorker(id int) error {
+	if id < 0 || id >= len(f.workers) {
+		return converter.ErrUnknownWorker
+	}
+	f.workers[id] = converter.WorkerStatus{ID: id, State: converter.WorkerStarting}
+	return nil
+}
+
+func TestWorkers_ListAndRecycle(t *testing.T) {
+	pool := &fakeWorkers{workers: []converter.WorkerStatus{
+		{ID: 0, State: converter.WorkerBusy, RequestID: "req-1", Conversions: 7, Started: time.Now().Add(-time.Minute), PID: 42, RSS: 1 << 20},
+		{ID: 1, State: converter.WorkerStarting},
+	}}
+	wh := handler.NewWorkers(pool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/workers", wh.List)
+	mux.HandleFunc("POST /admin/workers/{id}/recycle", wh.Recycle)
+
+	type worker struct {
+		ID            int    `json:"id"`
+		State         string `json:"state"`
+		RequestID     string `json:"request_id"`
+		Conversions   int64  `json:"conversions"`
+		UptimeSeconds int64  `json:"uptime_seconds"`
+		PID           int    `json:"pid"`
+		RSSBytes      int64  `json:"rss_bytes"`
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/workers", nil))
+	var list struct {
+		Workers []worker `json:"workers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body.String())
+	}
+	want := worker{ID: 0, State: "busy", RequestID: "req-1", Conversions: 7, UptimeSeconds: 60, PID: 42, RSSBytes: 1 << 20}
+	if len(list.Workers) != 2 || list.Workers[0] != want {
+		t.Errorf("unexpected workers %+v", list.Workers)
+	}
+	if w := list.Workers[1]; w.State != "starting" || w.UptimeSeconds != 0 {
+		t.Errorf("a starting worker has no uptime: %+v", w)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/workers/0/recycle", nil))
+	var recycled worker
+	_ = json.Unmarshal(rr.Body.Bytes(), &recycled)
+	if rr.Code != http.StatusAccepted || recycled.ID != 0 || recycled.State != "starting" {
+		t.Errorf("recycle: %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, id := range []string{"2", "x"} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/workers/"+id+"/recycle", nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("worker %s: expected 404, got %d", id, rr.Code)
+		}
+		assertJSONError(t, rr.Body.String())
+	}
+}
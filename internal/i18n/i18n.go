@@ -0,0 +1,148 @@
+// Package i18n localizes the client-facing error messages the service sends.
+// Messages are written in English in the code, and a catalog maps each one to
+// its translation per language, gettext-style. Machine-readable error codes
+// are never translated, so clients should branch on those.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is the language messages are written in. It needs no catalog and
+// is the fallback when a client accepts none of the catalog's languages.
+const Source = "en"
+
+// Catalog holds translations of messages, keyed by language and then by the
+// English message.
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+//go:embed catalog/*.json
+var builtin embed.FS
+
+// Default is the catalog built into the binary, from catalog/<lang>.json.
+var Default = mustLoad(builtin, "catalog")
+
+func mustLoad(fsys fs.FS, dir string) *Catalog {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	c, err := Load(sub)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load reads a catalog from the <lang>.json files in fsys, each a JSON object
+// mapping English messages to their translation. The language is the file
+// name, a lowercase BCP 47 tag such as "de" or "pt-br".
+func Load(fsys fs.FS) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{messages: make(map[string]map[string]string, len(files))}
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", name, err)
+		}
+		c.messages[strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))] = msgs
+	}
+	return c, nil
+}
+
+// Languages returns the languages c can translate into, including Source,
+// sorted.
+func (c *Catalog) Languages() []string {
+	langs := []string{Source}
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Negotiate picks the language to answer in from an Accept-Language header:
+// the most preferred language that c has, matched exactly or by its primary
+// subtag ("de-AT" is served "de"). It returns Source when nothing matches.
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	best, bestQ := Source, 0.0
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		if lang, ok := c.match(tag); ok {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// match returns the language c serves for tag.
+func (c *Catalog) match(tag string) (string, bool) {
+	if tag == Source || strings.HasPrefix(tag, Source+"-") {
+		return Source, true
+	}
+	if _, ok := c.messages[tag]; ok {
+		return tag, true
+	}
+	primary, _, _ := strings.Cut(tag, "-")
+	if _, ok := c.messages[primary]; ok {
+		return primary, true
+	}
+	return "", false
+}
+
+// Translate returns msg in lang, or msg itself when the catalog has no
+// translation. Text after the first "; " is data, such as a list of
+// formats, and is kept as is when only the part before it is in the catalog.
+func (c *Catalog) Translate(lang, msg string) string {
+	msgs := c.messages[lang]
+	if t, ok := msgs[msg]; ok {
+		return t
+	}
+	if head, tail, ok := strings.Cut(msg, "; "); ok {
+		if t, ok := msgs[head]; ok {
+			return t + "; " + tail
+		}
+	}
+	return msg
+}
+
+// Localize translates msg into the language r's Accept-Language header asks
+// for, using the Default catalog, and labels the response on w with
+// Content-Language. Call it before the response header is written.
+func Localize(w http.ResponseWriter, r *http.Request, msg string) string {
+	w.Header().Add("Vary", "Accept-Language")
+	if r.Header.Get("Accept-Language") == "" {
+		return msg
+	}
+	lang := Default.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", lang)
+	return Default.Translate(lang, msg)
+}
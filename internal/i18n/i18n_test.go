@@ -0,0 +1,126 @@
+package i18n_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+)
+
+func testCatalog(t *testing.T) *i18n.Catalog {
+	t.Helper()
+	c, err := i18n.Load(fstest.MapFS{
+		"de.json":    {Data: []byte(`{"file too large": "Datei zu groß", "cannot produce": "kann nicht erzeugen"}`)},
+		"pt-br.json": {Data: []byte(`{"file too large": "arquivo muito grande"}`)},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return c
+}
+
+func TestNegotiate(t *testing.T) {
+	c := testCatalog(t)
+	cases := map[string]string{
+		"":                        "en",
+		"de":                      "de",
+		"de-AT":                   "de",
+		"DE-at":                   "de",
+		"pt-BR":                   "pt-br",
+		"ja, de;q=0.5":            "de",
+		"en;q=0.9, de":            "de",
+		"de;q=0.4, en;q=0.8":      "en",
+		"fr-CA, fr;q=0.9":         "en",
+		"de;q=0":                  "en",
+		"de;q=bogus, pt-br;q=0.1": "pt-br",
+		"*":                       "en",
+	}
+	for header, want := range cases {
+		if got := c.Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c := testCatalog(t)
+	cases := []struct{ lang, msg, want string }{
+		{"de", "file too large", "Datei zu groß"},
+		{"de", "cannot produce; available: application/pdf", "kann nicht erzeugen; available: application/pdf"},
+		{"de", "not in the catalog", "not in the catalog"},
+		{"en", "file too large", "file too large"},
+		{"xx", "file too large", "file too large"},
+	}
+	for _, tc := range cases {
+		if got := c.Translate(tc.lang, tc.msg); got != tc.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", tc.lang, tc.msg, got, tc.want)
+		}
+	}
+}
+
+func TestLoad_RejectsMalformedCatalog(t *testing.T) {
+	if _, err := i18n.Load(fstest.MapFS{"de.json": {Data: []byte(`{`)}}); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
+
+func TestDefault_CatalogsAreComplete(t *testing.T) {
+	// Every built-in language translates the same set of messages, so adding
+	// a message to one catalog and forgetting another fails here.
+	files, _ := filepath.Glob("catalog/*.json")
+	if len(files) == 0 {
+		t.Fatal("no built-in catalogs")
+	}
+	var want []string
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		keys := slices.Sorted(maps.Keys(msgs))
+		if want == nil {
+			want = keys
+			continue
+		}
+		if !slices.Equal(keys, want) {
+			t.Errorf("%s translates a different set of messages than %s", name, files[0])
+		}
+	}
+	if len(i18n.Default.Languages()) != len(files)+1 {
+		t.Errorf("Default languages %v, want en plus %v", i18n.Default.Languages(), files)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	if got := i18n.Localize(w, r, "file too large"); got != "file too large" {
+		t.Errorf("without Accept-Language got %q", got)
+	}
+	if cl := w.Header().Get("Content-Language"); cl != "" {
+		t.Errorf("Content-Language set without Accept-Language: %q", cl)
+	}
+
+	r.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	w = httptest.NewRecorder()
+	if got := i18n.Localize(w, r, "file too large"); got != "Datei zu groß" {
+		t.Errorf("got %q, want the German message", got)
+	}
+	if cl := w.Header().Get("Content-Language"); cl != "de" {
+		t.Errorf("Content-Language = %q, want de", cl)
+	}
+	if v := w.Header().Get("Vary"); v != "Accept-Language" {
+		t.Errorf("Vary = %q, want Accept-Language", v)
+	}
+}
@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors returned by Manager.SetFeedback.
+var (
+	// ErrNotSucceeded is returned for feedback on a job that has not
+	// succeeded: there is no rendering to rate.
+	ErrNotSucceeded = errors.New("job has not succeeded")
+	// ErrFeedbackGiven is returned for a job that already has feedback.
+	ErrFeedbackGiven = errors.New("job already has feedback")
+)
+
+// Feedback is a caller's report on the quality of a job's result.
+type Feedback struct {
+	// Rating is from 1 (unusable) to 5 (faithful).
+	Rating int
+	// Note describes what rendered wrongly, if anything.
+	Note string
+	At   time.Time
+}
+
+// SetFeedback stores f on the succeeded job with the given ID and returns
+// the job. Each job takes feedback once; f.At is set by the Manager. A job
+// that expires meanwhile is ErrNotFound, never stored again.
+func (m *Manager) SetFeedback(id string, f Feedback) (Job, error) {
+	m.finishedMu.Lock()
+	defer m.finishedMu.Unlock()
+	j, err := m.store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	switch {
+	case j.State != StateSucceeded:
+		return Job{}, ErrNotSucceeded
+	case j.Feedback != nil:
+		return Job{}, ErrFeedbackGiven
+	}
+	f.At = time.Now().UTC()
+	j.Feedback = &f
+	if err := m.store.Put(j); err != nil {
+		return Job{}, err
+	}
+	if m.onFeedback != nil {
+		m.onFeedback(j)
+	}
+	return j, nil
+}
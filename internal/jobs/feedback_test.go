@@ -0,0 +1,120 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+func TestSetFeedback(t *testing.T) {
+	var observed []jobs.Job
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 2, LibreOffice: "7.6.4.1",
+		OnFeedback: func(j jobs.Job) { observed = append(observed, j) }})
+	defer m.Close()
+
+	ok, _ := m.Submit(jobs.Job{}, func(context.Context, jobs.Job) (string, error) { return "/result.pdf", nil })
+	bad, _ := m.Submit(jobs.Job{}, func(context.Context, jobs.Job) (string, error) { return "", errors.New("conversion failed") })
+	waitFor(t, m, ok.ID)
+	waitFor(t, m, bad.ID)
+
+	if _, err := m.SetFeedback(bad.ID, jobs.Feedback{Rating: 1}); !errors.Is(err, jobs.ErrNotSucceeded) {
+		t.Errorf("failed job: got %v, want ErrNotSucceeded", err)
+	}
+	if _, err := m.SetFeedback("nope", jobs.Feedback{Rating: 1}); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("unknown job: got %v, want ErrNotFound", err)
+	}
+
+	j, err := m.SetFeedback(ok.ID, jobs.Feedback{Rating: 4, Note: "fonts substituted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Feedback == nil || j.Feedback.Rating != 4 || j.Feedback.At.IsZero() || j.LibreOffice != "7.6.4.1" {
+		t.Errorf("job %+v", j)
+	}
+	if stored, _ := m.Get(ok.ID); stored.Feedback == nil || stored.Feedback.Note != "fonts substituted" {
+		t.Errorf("feedback not stored: %+v", stored)
+	}
+	if _, err := m.SetFeedback(ok.ID, jobs.Feedback{Rating: 5}); !errors.Is(err, jobs.ErrFeedbackGiven) {
+		t.Errorf("second feedback: got %v, want ErrFeedbackGiven", err)
+	}
+	if len(observed) != 1 || observed[0].ID != ok.ID {
+		t.Errorf("observed %+v", observed)
+	}
+}
+
+// resurrectionStore is a MemoryStore that records jobs stored again after
+// they were deleted. Get returns late, to widen the window between a read
+// and the write that follows it.
+type resurrectionStore struct {
+	*jobs.MemoryStore
+	mu          sync.Mutex
+	deleted     map[string]bool
+	resurrected []string
+}
+
+func (s *resurrectionStore) Get(id string) (jobs.Job, error) {
+	j, err := s.MemoryStore.Get(id)
+	time.Sleep(2 * time.Millisecond)
+	return j, err
+}
+
+func (s *resurrectionStore) Put(j jobs.Job) error {
+	s.mu.Lock()
+	if s.deleted[j.ID] {
+		s.resurrected = append(s.resurrected, j.ID)
+	}
+	s.mu.Unlock()
+	return s.MemoryStore.Put(j)
+}
+
+func (s *resurrectionStore) Delete(id string) error {
+	s.mu.Lock()
+	s.deleted[id] = true
+	s.mu.Unlock()
+	return s.MemoryStore.Delete(id)
+}
+
+func TestSetFeedback_RacesExpiry(t *testing.T) {
+	store := &resurrectionStore{MemoryStore: jobs.NewMemoryStore(), deleted: make(map[string]bool)}
+	const n, ttl = 64, 100 * time.Millisecond
+	var finished sync.WaitGroup
+	finished.Add(n)
+	m := jobs.NewManager(jobs.Config{Store: store, Workers: 4, QueueSize: n, TTL: ttl,
+		OnFinish: func(jobs.Job) { finished.Done() }})
+	defer m.Close()
+
+	var ids []string
+	for range n {
+		j, err := m.Submit(jobs.Job{}, func(context.Context, jobs.Job) (string, error) { return "/result.pdf", nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, j.ID)
+	}
+	finished.Wait()
+
+	// Give feedback on the jobs, a millisecond apart, from well before
+	// the janitor expires them to after.
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(ttl/2 + time.Duration(i)*time.Millisecond)
+			if _, err := m.SetFeedback(id, jobs.Feedback{Rating: 3}); err != nil && !errors.Is(err, jobs.ErrNotFound) {
+				t.Errorf("feedback on %s: %v", id, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.resurrected) > 0 {
+		t.Errorf("feedback stored %d expired jobs again", len(store.resurrected))
+	}
+}
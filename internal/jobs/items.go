@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrNoItem is returned by Manager.SetItem for an index the job has no item
+// at.
+var ErrNoItem = errors.New("job has no such item")
+
+// Item is the outcome of one of the units of work a job is made of, such as
+// a row of a bulk render. A job submitted with Items reports on each of them
+// as it runs.
+type Item struct {
+	State State
+	// Error is a client-safe failure reason, set when State is StateFailed,
+	// and Detail what it applies to (e.g. the fields a row lacks).
+	Error  string
+	Detail string
+	// Output names what the item produced: its entry in the job's result,
+	// or where it was stored, and URL a link to it.
+	Output string
+	URL    string
+}
+
+// SetItem replaces item i of the job with the given ID. A RunFunc calls it
+// as it finishes each item, so status requests see the job's progress.
+func (m *Manager) SetItem(id string, i int, it Item) error {
+	m.itemsMu.Lock()
+	defer m.itemsMu.Unlock()
+	j, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if i < 0 || i >= len(j.Items) {
+		return ErrNoItem
+	}
+	// Copies of the job share the slice, so it is replaced, not modified.
+	j.Items = slices.Clone(j.Items)
+	j.Items[i] = it
+	j.UpdatedAt = time.Now().UTC()
+	return m.store.Put(j)
+}
@@ -0,0 +1,53 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+func TestSetItem(t *testing.T) {
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1})
+	defer m.Close()
+
+	progress := make(chan jobs.Job)
+	proceed := make(chan struct{})
+	j, err := m.Submit(jobs.Job{Items: make([]jobs.Item, 2)}, func(_ context.Context, j jobs.Job) (string, error) {
+		if err := m.SetItem(j.ID, 0, jobs.Item{State: jobs.StateSucceeded, Output: "row-1.pdf"}); err != nil {
+			t.Error(err)
+		}
+		cur, _ := m.Get(j.ID)
+		progress <- cur
+		<-proceed
+		if err := m.SetItem(j.ID, 2, jobs.Item{}); !errors.Is(err, jobs.ErrNoItem) {
+			t.Errorf("out of range: got %v, want ErrNoItem", err)
+		}
+		return "/result.zip", m.SetItem(j.ID, 1, jobs.Item{State: jobs.StateFailed, Error: "no value for a template field", Detail: "name"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Items) != 2 || j.Items[0].State != "" {
+		t.Fatalf("submitted %+v", j.Items)
+	}
+
+	mid := <-progress
+	if mid.State != jobs.StateRunning || mid.Items[0].Output != "row-1.pdf" || mid.Items[1].State != "" {
+		t.Errorf("while running: %+v", mid)
+	}
+	close(proceed)
+
+	done := waitFor(t, m, j.ID)
+	if done.State != jobs.StateSucceeded || done.Items[0].State != jobs.StateSucceeded || done.Items[1].Detail != "name" {
+		t.Errorf("finished: %+v", done)
+	}
+	// The snapshot taken while running is unchanged.
+	if mid.Items[1].State != "" {
+		t.Errorf("snapshot modified: %+v", mid.Items)
+	}
+	if err := m.SetItem("nope", 0, jobs.Item{}); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("unknown job: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,443 @@
+// Package jobs runs conversions asynchronously: uploads are enqueued, worker
+// goroutines convert them in the background, and results are kept for a TTL
+// so clients can poll for status and download the output later.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+// State is the lifecycle state of a job.
+type State string
+
+// Job states. Succeeded and Failed are terminal.
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// States lists every job state.
+var States = []State{StateQueued, StateRunning, StateSucceeded, StateFailed}
+
+// Terminal reports whether s is a final state.
+func (s State) Terminal() bool { return s == StateSucceeded || s == StateFailed }
+
+// ErrQueueFull is returned by Submit when the job queue is at capacity.
+var ErrQueueFull = errors.New("job queue full")
+
+// Job is a single asynchronous conversion.
+type Job struct {
+	ID        string
+	State     State
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Error is a client-safe failure reason, set when State is StateFailed.
+	Error string
+
+	// Dir is the job's working directory. It holds the staged input and the
+	// result, and is removed when the job expires.
+	Dir string
+	// InputPath is the staged input document inside Dir.
+	InputPath string
+	// ResultPath is the converted output, set on success: inside Dir, or in
+	// Config.Results when the Manager keeps results there.
+	ResultPath string
+	// ResultSum is the hex SHA-256 of the result kept in Config.Results,
+	// empty when it is kept in Dir.
+	ResultSum string
+
+	// DocType is the detected input type (e.g. "docx").
+	DocType string
+	// Format is the requested output format (e.g. "pdf").
+	Format string
+	// ContentType, Disposition and Filename describe how the result is served.
+	ContentType string
+	Disposition string
+	Filename    string
+
+	// CallbackURL, if set, is notified when the job finishes (see
+	// Config.OnFinish).
+	CallbackURL string
+
+	// Client is the name of the API key the job was submitted with, and
+	// Tenant the tenant it was submitted for; both are "" when unknown.
+	Client string
+	Tenant string
+	// Traceparent is the W3C traceparent of the request that submitted the
+	// job, so the job is traced as part of that request's trace however
+	// long after it runs. Empty when the request was not traced.
+	Traceparent string
+	// InputSize is the size of the input in bytes, and ResultSize that of
+	// the result, set on success.
+	InputSize  int64
+	ResultSize int64
+
+	// MissingFonts are the fonts the input uses that are not installed,
+	// which the conversion falls back from to similar ones.
+	MissingFonts []string
+
+	// LibreOffice is the version of LibreOffice the job was converted with
+	// (see Config.LibreOffice).
+	LibreOffice string
+	// Feedback is the caller's report on the result, once given. It is
+	// never modified once set, so copies of a Job may share it.
+	Feedback *Feedback
+	// Items are the units of work of a job made of several, updated with
+	// Manager.SetItem as it runs. The slice is never modified in place, so
+	// copies of a Job may share it.
+	Items []Item
+}
+
+// RunFunc performs the conversion for j and returns the result path. The
+// returned error's message is stored on the job and shown to clients, so it
+// must be safe to expose.
+type RunFunc func(ctx context.Context, j Job) (resultPath string, err error)
+
+// Observer is notified of every job state transition. from is "" for a newly
+// submitted job and to is "" for a job removed on expiry.
+type Observer interface {
+	JobTransition(from, to State)
+}
+
+// Config configures a Manager.
+type Config struct {
+	// Store persists job records. Defaults to a MemoryStore.
+	Store Store
+	// Workers is the number of concurrent background conversions (min 1).
+	Workers int
+	// QueueSize is the number of jobs that may wait for a worker.
+	QueueSize int
+	// TTL is how long a finished job and its result are kept.
+	TTL time.Duration
+	// Observer, if set, receives state transitions (e.g. for metrics).
+	Observer Observer
+	// OnFinish, if set, is called with each job after its terminal state has
+	// been stored, so anything it triggers sees the final job.
+	OnFinish func(Job)
+	// Results, if set, keeps succeeded jobs' results by content, so that
+	// identical results share a file until the last job holding one expires.
+	Results *Results
+	// OnDedup, if set, is called with the size of each result found
+	// identical to one already kept in Results (e.g. for metrics).
+	OnDedup func(size int64)
+	// LibreOffice is the version of LibreOffice conversions run with,
+	// recorded on each job so feedback can be told apart across upgrades.
+	LibreOffice string
+	// OnFeedback, if set, is called with each job once its feedback has
+	// been stored (e.g. for metrics).
+	OnFeedback func(Job)
+	// Tracer, if set, traces each job with a Traceparent: a "job.run" span
+	// with how long the job queued, whose context the RunFunc gets, and a
+	// "job.store" span for keeping its result in Results.
+	Tracer *tracing.Tracer
+}
+
+type task struct {
+	id  string
+	run RunFunc
+}
+
+// Manager owns the job queue, its workers, and the expiry janitor.
+type Manager struct {
+	store    Store
+	obs      Observer
+	onFinish func(Job)
+	results  *Results
+	onDedup  func(int64)
+	ttl      time.Duration
+	queue    chan task
+
+	libreoffice string
+	onFeedback  func(Job)
+	tracer      *tracing.Tracer
+	// finishedMu serializes the updates of finished jobs: SetFeedback's
+	// check and store is one step, and expire never deletes a job in
+	// between, which the store would then bring back.
+	finishedMu sync.Mutex
+	// itemsMu makes reading and storing a job in SetItem one step.
+	itemsMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager starts cfg.Workers workers and the expiry janitor. Call Close to
+// stop them.
+func NewManager(cfg Config) *Manager {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Hour
+	}
+
+	if cfg.Results != nil {
+		if all, err := cfg.Store.List(); err == nil {
+			cfg.Results.recount(all)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		store:    cfg.Store,
+		obs:      cfg.Observer,
+		onFinish: cfg.OnFinish,
+		results:  cfg.Results,
+		onDedup:  cfg.OnDedup,
+		ttl:      cfg.TTL,
+		queue:    make(chan task, cfg.QueueSize),
+
+		libreoffice: cfg.LibreOffice,
+		onFeedback:  cfg.OnFeedback,
+		tracer:      cfg.Tracer,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for range cfg.Workers {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	m.wg.Add(1)
+	go m.janitor()
+	return m
+}
+
+// Submit records j as queued and schedules run. ID, State, timestamps and
+// LibreOffice are assigned by the Manager. On ErrQueueFull nothing is stored and the caller
+// still owns j.Dir.
+func (m *Manager) Submit(j Job, run RunFunc) (Job, error) {
+	now := time.Now().UTC()
+	j.ID = newID()
+	j.State = StateQueued
+	j.CreatedAt = now
+	j.UpdatedAt = now
+	j.LibreOffice = m.libreoffice
+
+	if err := m.store.Put(j); err != nil {
+		return Job{}, err
+	}
+	m.notify("", StateQueued)
+	select {
+	case m.queue <- task{id: j.ID, run: run}:
+	default:
+		_ = m.store.Delete(j.ID)
+		m.notify(StateQueued, "")
+		return Job{}, ErrQueueFull
+	}
+	return j, nil
+}
+
+// Get returns the job with the given ID, or ErrNotFound.
+func (m *Manager) Get(id string) (Job, error) { return m.store.Get(id) }
+
+// ListByClient returns the jobs submitted by client, newest first, at most
+// limit of them (0 for no limit). Expired jobs are gone from the store, so
+// every job listed still has its result if it succeeded.
+func (m *Manager) ListByClient(client string, limit int) ([]Job, error) {
+	all, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []Job
+	for i := len(all) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if all[i].Client == client {
+			out = append(out, all[i])
+		}
+	}
+	return out, nil
+}
+
+// Dirs returns the working directories of the jobs held, which stay in use
+// until the jobs expire.
+func (m *Manager) Dirs() ([]string, error) {
+	all, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, j := range all {
+		if j.Dir != "" {
+			dirs = append(dirs, j.Dir)
+		}
+	}
+	return dirs, nil
+}
+
+// TTL returns how long finished jobs are kept.
+func (m *Manager) TTL() time.Duration { return m.ttl }
+
+// Close stops the workers and janitor and waits for running jobs to return.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case t := <-m.queue:
+			m.execute(t)
+		}
+	}
+}
+
+func (m *Manager) execute(t task) {
+	j, err := m.store.Get(t.id)
+	if err != nil {
+		return
+	}
+	ctx, span := m.startSpan(j)
+	m.transition(&j, StateRunning)
+
+	resultPath, runErr := t.run(ctx, j)
+	// Pick up the items the run updated.
+	if cur, err := m.store.Get(t.id); err == nil {
+		j.Items = cur.Items
+	}
+	if runErr != nil {
+		j.Error = runErr.Error()
+		span.SetError(runErr)
+		m.transition(&j, StateFailed)
+	} else {
+		j.ResultPath = resultPath
+		if info, err := os.Stat(resultPath); err == nil {
+			j.ResultSize = info.Size()
+		}
+		m.keep(ctx, &j)
+		m.transition(&j, StateSucceeded)
+	}
+	span.SetAttributes(tracing.String("docpdf.job_state", string(j.State)))
+	span.End()
+	if m.onFinish != nil {
+		m.onFinish(j)
+	}
+}
+
+// startSpan starts the "job.run" span of j in the trace it was submitted
+// under. Without a Tracer or a Traceparent it returns the Manager's context
+// and a nil span.
+func (m *Manager) startSpan(j Job) (context.Context, *tracing.Span) {
+	parent, ok := tracing.ParseTraceparent(j.Traceparent)
+	if m.tracer == nil || !ok {
+		return m.ctx, nil
+	}
+	return m.tracer.Start(m.ctx, "job.run", tracing.KindInternal, parent,
+		tracing.String("docpdf.job_id", j.ID),
+		tracing.String("docpdf.doc_type", j.DocType),
+		tracing.Int64("docpdf.queue_ms", time.Since(j.CreatedAt).Milliseconds()),
+	)
+}
+
+// keep moves j's result into the Manager's Results, if it has any. On
+// failure the result stays where it is.
+func (m *Manager) keep(ctx context.Context, j *Job) {
+	if m.results == nil {
+		return
+	}
+	_, span := tracing.Start(ctx, "job.store", tracing.Int64("docpdf.output_bytes", j.ResultSize))
+	defer span.End()
+	kept, sum, dup, err := m.results.Add(j.ResultPath)
+	if err != nil {
+		span.SetError(err)
+		return
+	}
+	span.SetAttributes(tracing.Bool("docpdf.dedup", dup))
+	j.ResultPath, j.ResultSum = kept, sum
+	if dup && m.onDedup != nil {
+		m.onDedup(j.ResultSize)
+	}
+}
+
+func (m *Manager) transition(j *Job, to State) {
+	from := j.State
+	j.State = to
+	j.UpdatedAt = time.Now().UTC()
+	_ = m.store.Put(*j)
+	m.notify(from, to)
+}
+
+// janitor removes finished jobs, their working directories and their
+// references to kept results, once they are older than the TTL.
+func (m *Manager) janitor() {
+	defer m.wg.Done()
+	interval := max(m.ttl/4, 10*time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.expire(time.Now().UTC())
+		}
+	}
+}
+
+// expire deletes every terminal job last updated before now-TTL.
+func (m *Manager) expire(now time.Time) {
+	all, err := m.store.List()
+	if err != nil {
+		return
+	}
+	for _, j := range all {
+		if !j.State.Terminal() || now.Sub(j.UpdatedAt) < m.ttl {
+			continue
+		}
+		m.expireJob(j.ID)
+	}
+}
+
+// expireJob deletes the finished job with the given ID, unless it is gone
+// already, and releases its result.
+func (m *Manager) expireJob(id string) {
+	m.finishedMu.Lock()
+	defer m.finishedMu.Unlock()
+	j, err := m.store.Get(id)
+	if err != nil {
+		return
+	}
+	if j.Dir != "" {
+		_ = os.RemoveAll(j.Dir)
+	}
+	if j.ResultSum != "" && m.results != nil {
+		_ = m.results.Release(j.ResultSum)
+	}
+	_ = m.store.Delete(j.ID)
+	m.notify(j.State, "")
+}
+
+func (m *Manager) notify(from, to State) {
+	if m.obs != nil {
+		m.obs.JobTransition(from, to)
+	}
+}
+
+// newID returns a random 128-bit hex job ID.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
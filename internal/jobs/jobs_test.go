@@ -0,0 +1,328 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+// recorder is a jobs.Observer that records transitions.
+type recorder struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (r *recorder) JobTransition(from, to jobs.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = append(r.log, string(from)+"->"+string(to))
+}
+
+func (r *recorder) transitions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.log...)
+}
+
+// waitFor polls until the job reaches a terminal state.
+func waitFor(t *testing.T, m *jobs.Manager, id string) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := m.Get(id)
+		if err == nil && j.State.Terminal() {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return jobs.Job{}
+}
+
+func TestSubmit_Succeeds(t *testing.T) {
+	obs := &recorder{}
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1, TTL: time.Hour, Observer: obs})
+	defer m.Close()
+
+	j, err := m.Submit(jobs.Job{Format: "pdf"}, func(_ context.Context, _ jobs.Job) (string, error) {
+		return "/result.pdf", nil
+	})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if j.ID == "" || j.State != jobs.StateQueued {
+		t.Fatalf("expected queued job with ID, got %+v", j)
+	}
+
+	done := waitFor(t, m, j.ID)
+	if done.State != jobs.StateSucceeded || done.ResultPath != "/result.pdf" {
+		t.Errorf("unexpected final job: %+v", done)
+	}
+	want := []string{"->queued", "queued->running", "running->succeeded"}
+	got := obs.transitions()
+	if len(got) != len(want) {
+		t.Fatalf("expected transitions %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("transition %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestSubmit_FailureRecordsError(t *testing.T) {
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1})
+	defer m.Close()
+
+	j, _ := m.Submit(jobs.Job{}, func(_ context.Context, _ jobs.Job) (string, error) {
+		return "", errors.New("conversion failed")
+	})
+	done := waitFor(t, m, j.ID)
+	if done.State != jobs.StateFailed || done.Error != "conversion failed" {
+		t.Errorf("unexpected final job: %+v", done)
+	}
+}
+
+func TestOnFinish_SeesStoredTerminalJob(t *testing.T) {
+	finished := make(chan jobs.State, 1)
+	var m *jobs.Manager
+	m = jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1, OnFinish: func(j jobs.Job) {
+		stored, _ := m.Get(j.ID)
+		finished <- stored.State
+	}})
+	defer m.Close()
+
+	if _, err := m.Submit(jobs.Job{}, func(_ context.Context, _ jobs.Job) (string, error) {
+		return "", errors.New("conversion failed")
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	select {
+	case state := <-finished:
+		if state != jobs.StateFailed {
+			t.Errorf("expected stored state failed when OnFinish runs, got %q", state)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnFinish was not called")
+	}
+}
+
+func TestListByClient(t *testing.T) {
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 10})
+	defer m.Close()
+
+	result := t.TempDir() + "/out.pdf"
+	if err := os.WriteFile(result, []byte("%PDF-1.7"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(_ context.Context, _ jobs.Job) (string, error) { return result, nil }
+	var ids []string
+	for _, client := range []string{"team-a", "team-b", "team-a", "team-a"} {
+		j, err := m.Submit(jobs.Job{Client: client}, run)
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		waitFor(t, m, j.ID)
+		ids = append(ids, j.ID)
+	}
+
+	got, err := m.ListByClient("team-a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != ids[3] || got[1].ID != ids[2] {
+		t.Fatalf("expected team-a's two newest jobs, got %+v", got)
+	}
+	if got[0].ResultSize != 8 {
+		t.Errorf("ResultSize = %d, want 8", got[0].ResultSize)
+	}
+	if all, _ := m.ListByClient("team-a", 0); len(all) != 3 {
+		t.Errorf("expected 3 jobs without a limit, got %d", len(all))
+	}
+	if none, _ := m.ListByClient("team-c", 0); len(none) != 0 {
+		t.Errorf("expected no jobs for team-c, got %d", len(none))
+	}
+}
+
+func TestDirs(t *testing.T) {
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 10})
+	defer m.Close()
+
+	dir := t.TempDir()
+	run := func(_ context.Context, _ jobs.Job) (string, error) { return "", errors.New("failed") }
+	for _, d := range []string{dir, ""} {
+		j, err := m.Submit(jobs.Job{Dir: d}, run)
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		waitFor(t, m, j.ID)
+	}
+	dirs, err := m.Dirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 1 || dirs[0] != dir {
+		t.Errorf("Dirs = %v, want [%s]", dirs, dir)
+	}
+}
+
+func TestSubmit_QueueFull(t *testing.T) {
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1})
+	defer m.Close()
+
+	block := make(chan struct{})
+	started := make(chan struct{}, 2)
+	run := func(_ context.Context, _ jobs.Job) (string, error) {
+		started <- struct{}{}
+		<-block
+		return "x", nil
+	}
+	if _, err := m.Submit(jobs.Job{}, run); err != nil {
+		t.Fatalf("first submit: %v", err)
+	}
+	<-started // the only worker is now busy
+	defer close(block)
+
+	if _, err := m.Submit(jobs.Job{}, run); err != nil {
+		t.Fatalf("second submit should queue: %v", err)
+	}
+
+	if _, err := m.Submit(jobs.Job{}, nil); !errors.Is(err, jobs.ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestExpiry_RemovesJobAndDir(t *testing.T) {
+	obs := &recorder{}
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1, TTL: 20 * time.Millisecond, Observer: obs})
+	defer m.Close()
+
+	dir := t.TempDir()
+	j, _ := m.Submit(jobs.Job{Dir: dir}, func(_ context.Context, _ jobs.Job) (string, error) {
+		return dir + "/out.pdf", nil
+	})
+	waitFor(t, m, j.ID)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := m.Get(j.ID); errors.Is(err, jobs.ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job was not expired")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("job dir %s still exists after expiry", dir)
+	}
+	got := obs.transitions()
+	if got[len(got)-1] != "succeeded->" {
+		t.Errorf("expected final transition succeeded->, got %v", got)
+	}
+}
+
+func TestMemoryStore_ListOldestFirst(t *testing.T) {
+	s := jobs.NewMemoryStore()
+	now := time.Now()
+	_ = s.Put(jobs.Job{ID: "b", CreatedAt: now.Add(time.Second)})
+	_ = s.Put(jobs.Job{ID: "a", CreatedAt: now})
+
+	all, _ := s.List()
+	if len(all) != 2 || all[0].ID != "a" || all[1].ID != "b" {
+		t.Errorf("unexpected order: %+v", all)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// spanRecorder is a tracing.Exporter that keeps what it is given.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestSubmit_TracedUnderTraceparent(t *testing.T) {
+	rec := &spanRecorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour})
+	results, err := jobs.NewResults(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1, Results: results, Tracer: tr})
+	defer m.Close()
+
+	_, request := tr.Start(context.Background(), "POST", tracing.KindServer, tracing.SpanContext{})
+	request.End()
+	dir := t.TempDir()
+	var converted tracing.SpanID
+	j, err := m.Submit(jobs.Job{Dir: dir, Traceparent: request.Context().Traceparent()}, func(ctx context.Context, j jobs.Job) (string, error) {
+		// Work the job does is traced under its run.
+		_, span := tracing.Start(ctx, "libreoffice.convert")
+		converted = span.Context().SpanID
+		span.End()
+		out := dir + "/out.pdf"
+		return out, os.WriteFile(out, []byte("%PDF"), 0600)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waitFor(t, m, j.ID).State != jobs.StateSucceeded {
+		t.Fatal("job failed")
+	}
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]tracing.SpanData)
+	for _, s := range rec.spans {
+		byName[s.Name] = s
+	}
+	run, ok := byName["job.run"]
+	if !ok {
+		t.Fatalf("no job.run span in %+v", rec.spans)
+	}
+	if run.Context.TraceID != request.Context().TraceID || run.Parent != request.Context().SpanID {
+		t.Errorf("job.run does not continue the request's trace: %+v", run)
+	}
+	if convert := byName["libreoffice.convert"]; convert.Context.SpanID != converted || convert.Parent != run.Context.SpanID {
+		t.Errorf("conversion not traced under job.run: %+v", convert)
+	}
+	if store := byName["job.store"]; store.Parent != run.Context.SpanID {
+		t.Errorf("job.store not traced under job.run: %+v", store)
+	}
+}
+
+func TestSubmit_UntracedWithoutTraceparent(t *testing.T) {
+	rec := &spanRecorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour})
+	m := jobs.NewManager(jobs.Config{Workers: 1, QueueSize: 1, Tracer: tr})
+	defer m.Close()
+
+	j, _ := m.Submit(jobs.Job{}, func(ctx context.Context, j jobs.Job) (string, error) {
+		if tracing.SpanFromContext(ctx) != nil {
+			t.Error("expected no span for a job without a traceparent")
+		}
+		return "", errors.New("conversion failed")
+	})
+	waitFor(t, m, j.ID)
+	_ = tr.Close(context.Background())
+	if len(rec.spans) != 0 {
+		t.Errorf("expected no spans, got %+v", rec.spans)
+	}
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Results keeps job results in one directory named by the SHA-256 of their
+// content, so identical results, such as those of a bulk re-conversion,
+// are stored once however many jobs produced them. Each file is counted
+// once per job referencing it and removed with the last reference.
+type Results struct {
+	dir string
+
+	mu   sync.Mutex
+	refs map[string]int // by hex SHA-256
+}
+
+// NewResults returns a Results keeping files in dir, which is created if it
+// does not exist.
+func NewResults(dir string) (*Results, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("jobs: %w", err)
+	}
+	return &Results{dir: dir, refs: make(map[string]int)}, nil
+}
+
+// Add moves the result at path into the directory and returns the path it
+// is now kept at and its hash. When an identical result is already kept,
+// the file at path is removed and dup is true.
+func (r *Results) Add(path string) (kept, sum string, dup bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", false, err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return "", "", false, err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	kept = filepath.Join(r.dir, sum)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs[sum] > 0 {
+		os.Remove(path)
+		r.refs[sum]++
+		return kept, sum, true, nil
+	}
+	if err := move(path, kept); err != nil {
+		return "", "", false, err
+	}
+	r.refs[sum] = 1
+	return kept, sum, false, nil
+}
+
+// Release drops a reference to the result with hash sum, removing the file
+// once no job references it.
+func (r *Results) Release(sum string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs[sum] > 1 {
+		r.refs[sum]--
+		return nil
+	}
+	delete(r.refs, sum)
+	if err := os.Remove(filepath.Join(r.dir, sum)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Refs returns the number of jobs referencing the result with hash sum.
+func (r *Results) Refs(sum string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refs[sum]
+}
+
+// recount sets the reference counts from the stored jobs, and removes the
+// files no job references, e.g. those of jobs lost with a restart.
+func (r *Results) recount(all []Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.refs)
+	for _, j := range all {
+		if j.ResultSum != "" {
+			r.refs[j.ResultSum]++
+		}
+	}
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if r.refs[e.Name()] == 0 {
+			os.RemoveAll(filepath.Join(r.dir, e.Name()))
+		}
+	}
+}
+
+// move renames src to dst, copying when they are on different filesystems.
+func move(src, dst string) error {
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".incoming-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Remove(src)
+	return nil
+}
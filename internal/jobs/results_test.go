@@ -0,0 +1,153 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/jobs"
+)
+
+// writeResult writes data to a fresh file standing in for a job's result.
+func writeResult(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out.pdf")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResults_Dedup(t *testing.T) {
+	r, err := jobs.NewResults(filepath.Join(t.TempDir(), "results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := writeResult(t, "%PDF-1.7 a")
+	kept, sum, dup, err := r.Add(first)
+	if err != nil || dup {
+		t.Fatalf("Add = %v, dup %v", err, dup)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Error("result not moved")
+	}
+	second := writeResult(t, "%PDF-1.7 a")
+	again, sum2, dup, err := r.Add(second)
+	if err != nil || !dup || again != kept || sum2 != sum {
+		t.Fatalf("identical Add = %q %q %v %v, want %q %q dup", again, sum2, dup, err, kept, sum)
+	}
+	if _, err := os.Stat(second); !os.IsNotExist(err) {
+		t.Error("duplicate not removed")
+	}
+	other, _, dup, err := r.Add(writeResult(t, "%PDF-1.7 b"))
+	if err != nil || dup || other == kept {
+		t.Fatalf("different Add = %q %v %v", other, dup, err)
+	}
+	if n := r.Refs(sum); n != 2 {
+		t.Errorf("Refs = %d, want 2", n)
+	}
+
+	// The file stays until the last reference goes.
+	if err := r.Release(sum); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(kept); err != nil || string(data) != "%PDF-1.7 a" {
+		t.Fatalf("shared result gone with a reference left: %q, %v", data, err)
+	}
+	if err := r.Release(sum); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Error("unreferenced result not removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated result removed: %v", err)
+	}
+}
+
+func TestExpiry_ReleasesSharedResult(t *testing.T) {
+	results, err := jobs.NewResults(filepath.Join(t.TempDir(), "results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved atomic.Int64
+	m := jobs.NewManager(jobs.Config{
+		Workers: 1, QueueSize: 2, TTL: 20 * time.Millisecond,
+		Results: results,
+		OnDedup: func(size int64) { saved.Add(size) },
+	})
+	defer m.Close()
+
+	var ids []string
+	var kept string
+	for range 2 {
+		out := writeResult(t, "%PDF-1.7")
+		j, err := m.Submit(jobs.Job{}, func(_ context.Context, _ jobs.Job) (string, error) { return out, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := waitFor(t, m, j.ID)
+		if done.ResultSum == "" || (kept != "" && done.ResultPath != kept) {
+			t.Fatalf("result not shared: %+v", done)
+		}
+		kept = done.ResultPath
+		ids = append(ids, j.ID)
+	}
+	if saved.Load() != 8 {
+		t.Errorf("OnDedup saw %d bytes, want 8", saved.Load())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, id := range ids {
+		for {
+			if _, err := m.Get(id); errors.Is(err, jobs.ErrNotFound) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("job was not expired")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Error("shared result left after every job expired")
+	}
+}
+
+func TestNewManager_RecountsResults(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "results")
+	results, err := jobs.NewResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, sum, _, err := results.Add(writeResult(t, "kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan, _, _, err := results.Add(writeResult(t, "orphan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first result belongs to a stored job, e.g. one persisted
+	// across a restart.
+	store := jobs.NewMemoryStore()
+	_ = store.Put(jobs.Job{ID: "a", State: jobs.StateSucceeded, ResultPath: kept, ResultSum: sum, UpdatedAt: time.Now()})
+	m := jobs.NewManager(jobs.Config{Store: store, Results: results})
+	defer m.Close()
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("unreferenced result not removed")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("referenced result removed: %v", err)
+	}
+	if n := results.Refs(sum); n != 1 {
+		t.Errorf("Refs = %d, want 1", n)
+	}
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when no job has the requested ID.
+var ErrNotFound = errors.New("job not found")
+
+// Store persists job records. Implementations must be safe for concurrent use
+// and must store and return copies, never shared pointers.
+type Store interface {
+	// Put creates or replaces the job with j.ID.
+	Put(j Job) error
+	// Get returns the job with the given ID, or ErrNotFound.
+	Get(id string) (Job, error)
+	// Delete removes the job. Deleting an unknown ID is not an error.
+	Delete(id string) error
+	// List returns every stored job, oldest first.
+	List() ([]Job, error)
+}
+
+// MemoryStore is an in-process Store. Jobs are lost on restart.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = j
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List() ([]Job, error) {
+	s.mu.RLock()
+	out := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(a, b int) bool { return out[a].CreatedAt.Before(out[b].CreatedAt) })
+	return out, nil
+}
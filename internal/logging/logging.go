@@ -0,0 +1,111 @@
+// Package logging builds the server's log/slog logger: JSON or text lines at
+// or above a configured level, written to stderr or any io.Writer. Log lines
+// keep the shape the server has always written, with the time in UTC and
+// lowercase level names, so log pipelines parsing them need no change.
+//
+// The Logging middleware puts a child logger carrying the request ID in each
+// request's context; code handling a request logs through FromContext so its
+// lines can be matched to the request's.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// LevelFatal is the level of the message logged before the server exits on
+// an unrecoverable error.
+const LevelFatal = slog.Level(12)
+
+// Output formats.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Config configures a logger.
+type Config struct {
+	// Level is the lowest level written. The zero value is slog.LevelInfo.
+	Level slog.Level
+	// Format is FormatJSON (the default) or FormatText.
+	Format string
+	// Writer receives the log lines. Default os.Stderr.
+	Writer io.Writer
+}
+
+// New returns a logger configured by cfg.
+func New(cfg Config) *slog.Logger {
+	w := cfg.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+	opts := &slog.HandlerOptions{Level: cfg.Level, ReplaceAttr: replaceAttr}
+	if cfg.Format == FormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// replaceAttr writes times in UTC and levels in lowercase, with LevelFatal
+// as "fatal".
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		if a.Value.Kind() == slog.KindTime {
+			a.Value = slog.TimeValue(a.Value.Time().UTC())
+		}
+	case slog.LevelKey:
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(LevelName(level))
+		}
+	}
+	return a
+}
+
+// LevelName returns the name level is logged as: "debug", "info", "warn",
+// "error" or "fatal", with an offset for levels in between (e.g. "info+2").
+func LevelName(level slog.Level) string {
+	if level >= LevelFatal {
+		return "fatal"
+	}
+	return strings.ToLower(level.String())
+}
+
+// ParseLevel parses a level name as accepted by LOG_LEVEL: debug, info, warn
+// or error, in any case.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q: want debug, info, warn or error", s)
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying l, for FromContext.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger in ctx, the request's own in a request
+// context, or slog.Default when there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,80 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/logging"
+)
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := logging.New(logging.Config{Writer: &buf})
+	l.Warn("could not load stats file", "error", "permission denied")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, buf.String())
+	}
+	if line["level"] != "warn" || line["msg"] != "could not load stats file" || line["error"] != "permission denied" {
+		t.Errorf("unexpected line %v", line)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, line["time"].(string))
+	if err != nil || ts.Location() != time.UTC {
+		t.Errorf("time %v is not RFC 3339 in UTC", line["time"])
+	}
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	l := logging.New(logging.Config{Writer: &buf, Format: logging.FormatText})
+	l.Log(context.Background(), logging.LevelFatal, "server error")
+
+	if got := buf.String(); !strings.Contains(got, "level=fatal") || !strings.Contains(got, `msg="server error"`) {
+		t.Errorf("unexpected line %q", got)
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	l := logging.New(logging.Config{Writer: &buf, Level: slog.LevelWarn})
+	l.Info("dropped")
+	l.Debug("dropped")
+	l.Error("kept")
+
+	if got := strings.Count(buf.String(), "\n"); got != 1 || !strings.Contains(buf.String(), "kept") {
+		t.Errorf("expected only the error line, got %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"":      slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"Error": slog.LevelError,
+	} {
+		if got, err := logging.ParseLevel(in); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if logging.FromContext(context.Background()) != slog.Default() {
+		t.Error("expected slog.Default without a logger in the context")
+	}
+	l := logging.New(logging.Config{Writer: &bytes.Buffer{}})
+	if logging.FromContext(logging.NewContext(context.Background(), l)) != l {
+		t.Error("expected the logger in the context")
+	}
+}
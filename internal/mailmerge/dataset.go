@@ -0,0 +1,211 @@
+package mailmerge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Dataset formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Errors returned by ReadDataset.
+var (
+	// ErrInvalidDataset is returned, wrapped with the line at fault, for a
+	// dataset that cannot be parsed.
+	ErrInvalidDataset = errors.New("mailmerge: invalid dataset")
+	// ErrEmptyDataset is returned for a dataset without records.
+	ErrEmptyDataset = errors.New("mailmerge: dataset has no records")
+	// ErrTooManyRecords is returned for a dataset with more records than
+	// allowed.
+	ErrTooManyRecords = errors.New("mailmerge: dataset has too many records")
+)
+
+// maxLine bounds one JSONL line, in bytes.
+const maxLine = 1 << 20
+
+// Dataset is the records a template is merged with.
+type Dataset struct {
+	// Columns are the field names: the CSV header, or the keys of the JSONL
+	// objects in the order first seen.
+	Columns []string
+	Records []map[string]string
+}
+
+// DetectFormat returns the format of a dataset from its file name (.csv,
+// .jsonl or .ndjson), else from its first non-blank byte: '{' for JSONL and
+// anything else for CSV.
+func DetectFormat(filename string, head []byte) string {
+	switch name := strings.ToLower(filename); {
+	case strings.HasSuffix(name, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".ndjson"):
+		return FormatJSONL
+	}
+	if b := bytes.TrimLeft(head, " \t\r\n\ufeff"); len(b) > 0 && b[0] == '{' {
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// ReadDataset reads a dataset in format, of at most maxRecords records.
+// A CSV dataset has a header row naming the columns; a JSONL dataset has one
+// object per line, whose values must be strings, numbers, booleans or null
+// (the empty string). Blank lines are skipped.
+func ReadDataset(r io.Reader, format string, maxRecords int) (*Dataset, error) {
+	var (
+		d   *Dataset
+		err error
+	)
+	switch format {
+	case FormatCSV:
+		d, err = readCSV(r, maxRecords)
+	case FormatJSONL:
+		d, err = readJSONL(r, maxRecords)
+	default:
+		return nil, fmt.Errorf("mailmerge: unknown dataset format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Records) == 0 {
+		return nil, ErrEmptyDataset
+	}
+	return d, nil
+}
+
+func readCSV(r io.Reader, maxRecords int) (*Dataset, error) {
+	cr := csv.NewReader(skipBOM(r))
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, ErrEmptyDataset
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+	}
+	d := &Dataset{}
+	seen := make(map[string]bool, len(header))
+	for _, col := range header {
+		col = strings.TrimSpace(col)
+		if col == "" || seen[col] {
+			return nil, fmt.Errorf("%w: line 1: empty or repeated column %q", ErrInvalidDataset, col)
+		}
+		seen[col] = true
+		d.Columns = append(d.Columns, col)
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+		}
+		if len(d.Records) == maxRecords {
+			return nil, ErrTooManyRecords
+		}
+		rec := make(map[string]string, len(row))
+		for i, v := range row {
+			rec[d.Columns[i]] = v
+		}
+		d.Records = append(d.Records, rec)
+	}
+}
+
+func readJSONL(r io.Reader, maxRecords int) (*Dataset, error) {
+	sc := bufio.NewScanner(skipBOM(r))
+	sc.Buffer(nil, maxLine)
+	d := &Dataset{}
+	seen := make(map[string]bool)
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		if len(d.Records) == maxRecords {
+			return nil, ErrTooManyRecords
+		}
+		var obj map[string]any
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&obj); err != nil || obj == nil || dec.More() {
+			return nil, fmt.Errorf("%w: line %d: not a JSON object", ErrInvalidDataset, line)
+		}
+		rec := make(map[string]string, len(obj))
+		for k, v := range obj {
+			s, ok := scalar(v)
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: %q is not a string, number or boolean", ErrInvalidDataset, line, k)
+			}
+			rec[k] = s
+		}
+		// Map order is random; keep new keys in the order the line has them.
+		for _, k := range keyOrder(b) {
+			if _, ok := rec[k]; ok && !seen[k] {
+				seen[k] = true
+				d.Columns = append(d.Columns, k)
+			}
+		}
+		d.Records = append(d.Records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+	}
+	return d, nil
+}
+
+// scalar formats a JSON value as the text it is merged as.
+func scalar(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// keyOrder returns the top-level keys of the JSON object in b, in order.
+func keyOrder(b []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		if k, ok := tok.(string); ok {
+			keys = append(keys, k)
+		}
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// skipBOM drops a UTF-8 byte order mark, which spreadsheet exports add.
+func skipBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(3); err == nil && bytes.Equal(b, []byte{0xef, 0xbb, 0xbf}) {
+		_, _ = br.Discard(3)
+	}
+	return br
+}
@@ -0,0 +1,88 @@
+package mailmerge_test
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/mailmerge"
+)
+
+func TestDetectFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name, head, want string
+	}{
+		{"people.csv", `{"a":1}`, mailmerge.FormatCSV},
+		{"people.JSONL", "a,b", mailmerge.FormatJSONL},
+		{"people.ndjson", "a,b", mailmerge.FormatJSONL},
+		{"blob", "\ufeff\n {\"a\":1}", mailmerge.FormatJSONL},
+		{"blob", "name,amount", mailmerge.FormatCSV},
+	} {
+		if got := mailmerge.DetectFormat(tc.name, []byte(tc.head)); got != tc.want {
+			t.Errorf("DetectFormat(%q, %q) = %s, want %s", tc.name, tc.head, got, tc.want)
+		}
+	}
+}
+
+func TestReadDataset_CSV(t *testing.T) {
+	in := "\ufeffname, amount\nAda,\"1,200\"\n\"Grace \"\"G\"\" Hopper\",7\n"
+	d, err := mailmerge.ReadDataset(strings.NewReader(in), mailmerge.FormatCSV, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(d.Columns, []string{"name", "amount"}) {
+		t.Errorf("Columns = %v", d.Columns)
+	}
+	want := []map[string]string{
+		{"name": "Ada", "amount": "1,200"},
+		{"name": `Grace "G" Hopper`, "amount": "7"},
+	}
+	if !slices.EqualFunc(d.Records, want, maps.Equal) {
+		t.Errorf("Records = %v", d.Records)
+	}
+}
+
+func TestReadDataset_JSONL(t *testing.T) {
+	in := `{"name":"Ada","amount":1200.5,"vip":true}` + "\n\n" + `{"note":null,"name":"Grace"}` + "\n"
+	d, err := mailmerge.ReadDataset(strings.NewReader(in), mailmerge.FormatJSONL, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(d.Columns, []string{"name", "amount", "vip", "note"}) {
+		t.Errorf("Columns = %v", d.Columns)
+	}
+	want := []map[string]string{
+		{"name": "Ada", "amount": "1200.5", "vip": "true"},
+		{"name": "Grace", "note": ""},
+	}
+	if !slices.EqualFunc(d.Records, want, maps.Equal) {
+		t.Errorf("Records = %v", d.Records)
+	}
+}
+
+func TestReadDataset_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name, format, in string
+		want             error
+	}{
+		{"empty csv", mailmerge.FormatCSV, "", mailmerge.ErrEmptyDataset},
+		{"header only", mailmerge.FormatCSV, "name,amount\n", mailmerge.ErrEmptyDataset},
+		{"repeated column", mailmerge.FormatCSV, "name,name\na,b\n", mailmerge.ErrInvalidDataset},
+		{"ragged row", mailmerge.FormatCSV, "name,amount\na\n", mailmerge.ErrInvalidDataset},
+		{"too many csv", mailmerge.FormatCSV, "n\n1\n2\n3\n", mailmerge.ErrTooManyRecords},
+		{"empty jsonl", mailmerge.FormatJSONL, "\n\n", mailmerge.ErrEmptyDataset},
+		{"not an object", mailmerge.FormatJSONL, "[1,2]\n", mailmerge.ErrInvalidDataset},
+		{"two values", mailmerge.FormatJSONL, `{"a":1} {"a":2}` + "\n", mailmerge.ErrInvalidDataset},
+		{"nested value", mailmerge.FormatJSONL, `{"a":{"b":1}}` + "\n", mailmerge.ErrInvalidDataset},
+		{"too many jsonl", mailmerge.FormatJSONL, "{}\n{}\n{}\n", mailmerge.ErrTooManyRecords},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := mailmerge.ReadDataset(strings.NewReader(tc.in), tc.format, 2)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
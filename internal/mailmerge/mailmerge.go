@@ -0,0 +1,196 @@
+// Package mailmerge fills the {{field}} placeholders of a DOCX template with
+// the values of a dataset record, the mail-merge step of bulk rendering.
+//
+// Word splits the text of a paragraph into runs wherever formatting, spell
+// checking or editing history changes, so a placeholder typed as {{name}} is
+// often stored across several <w:t> elements. Placeholders are therefore
+// found in the joined text of each paragraph, and the value is written into
+// the run the placeholder starts in, keeping that run's formatting.
+package mailmerge
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrNotDocx is returned for a template that is not a DOCX package.
+var ErrNotDocx = errors.New("mailmerge: not a DOCX package")
+
+// MissingFieldsError is returned by Merge when the record has no value for
+// some of the template's placeholders.
+type MissingFieldsError struct {
+	// Fields are the placeholders without a value, sorted.
+	Fields []string
+}
+
+func (e *MissingFieldsError) Error() string {
+	return "mailmerge: no value for " + strings.Join(e.Fields, ", ")
+}
+
+var (
+	// placeholder matches {{name}}, with optional spaces inside the braces.
+	placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+	// textParts are the parts of a Word package that hold body text.
+	textParts = regexp.MustCompile(`^word/(document|header[0-9]*|footer[0-9]*|footnotes|endnotes)\.xml$`)
+	paragraph = regexp.MustCompile(`(?s)<w:p[ >].*?</w:p>`)
+	// text matches a <w:t> element with its content; the open tag is not
+	// self-closing.
+	text = regexp.MustCompile(`(?s)(<w:t(?:\s[^>]*[^/])?>)(.*?)</w:t>`)
+)
+
+// Fields returns the distinct placeholder names in the template, sorted.
+func Fields(docx []byte) ([]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	if err != nil {
+		return nil, ErrNotDocx
+	}
+	seen := make(map[string]bool)
+	for _, f := range zr.File {
+		if !textParts.MatchString(f.Name) {
+			continue
+		}
+		b, err := readEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		fill(b, func(name string) (string, bool) {
+			seen[name] = true
+			return "", true
+		})
+	}
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+// Merge returns a copy of the template with every placeholder replaced by
+// its value in values, inserted as plain text. Entries other than the text
+// parts are copied byte for byte. If a placeholder has no value, Merge
+// returns a *MissingFieldsError.
+func Merge(docx []byte, values map[string]string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	if err != nil {
+		return nil, ErrNotDocx
+	}
+	missing := make(map[string]bool)
+	value := func(name string) (string, bool) {
+		v, ok := values[name]
+		if !ok {
+			missing[name] = true
+		}
+		return v, ok
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		if !textParts.MatchString(f.Name) {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b, err := readEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(fill(b, value)); err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingFieldsError{Fields: slices.Sorted(maps.Keys(missing))}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fill replaces the placeholders in each paragraph of part with value(name);
+// placeholders value has no value for are dropped.
+func fill(part []byte, value func(name string) (string, bool)) []byte {
+	return paragraph.ReplaceAllFunc(part, func(p []byte) []byte {
+		locs := text.FindAllSubmatchIndex(p, -1)
+		if len(locs) == 0 {
+			return p
+		}
+		var joined strings.Builder
+		starts := make([]int, len(locs))
+		for i, loc := range locs {
+			starts[i] = joined.Len()
+			joined.WriteString(html.UnescapeString(string(p[loc[4]:loc[5]])))
+		}
+		s := joined.String()
+		matches := placeholder.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			return p
+		}
+
+		// Text outside placeholders stays in its run; each value goes into
+		// the run its placeholder starts in.
+		out := make([]strings.Builder, len(locs))
+		node, pos := 0, 0
+		advance := func(off int) {
+			for node+1 < len(starts) && starts[node+1] <= off {
+				node++
+			}
+		}
+		emit := func(to int) {
+			for pos < to {
+				advance(pos)
+				end := to
+				if node+1 < len(starts) && starts[node+1] < end {
+					end = starts[node+1]
+				}
+				out[node].WriteString(s[pos:end])
+				pos = end
+			}
+		}
+		for _, m := range matches {
+			emit(m[0])
+			advance(m[0])
+			if v, ok := value(s[m[2]:m[3]]); ok {
+				out[node].WriteString(v)
+			}
+			pos = m[1]
+		}
+		emit(len(s))
+
+		var b bytes.Buffer
+		last := 0
+		for i, loc := range locs {
+			b.Write(p[last:loc[0]])
+			open := p[loc[2]:loc[3]]
+			if !bytes.Contains(open, []byte("xml:space")) {
+				// Keep the spaces around values.
+				open = append([]byte(`<w:t xml:space="preserve"`), open[len("<w:t"):]...)
+			}
+			b.Write(open)
+			_ = xml.EscapeText(&b, []byte(out[i].String()))
+			b.WriteString("</w:t>")
+			last = loc[1]
+		}
+		b.Write(p[last:])
+		return b.Bytes()
+	})
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,127 @@
+package mailmerge_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/mailmerge"
+)
+
+// docx returns a Word package whose document.xml body is body, plus a footer
+// and a styles part.
+func docx(t *testing.T, body, footer string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml":   `<w:document><w:body>` + body + `</w:body></w:document>`,
+		"word/footer1.xml":    `<w:ftr>` + footer + `</w:ftr>`,
+		"word/styles.xml":     `<w:styles>{{untouched}}</w:styles>`,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func part(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			return string(b)
+		}
+	}
+	t.Fatalf("no %s", name)
+	return ""
+}
+
+const splitBody = `<w:p><w:r><w:t>Dear </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>{{</w:t></w:r>` +
+	`<w:proofErr w:type="spellStart"/><w:r><w:t>first_</w:t></w:r><w:r><w:t>name }}</w:t></w:r><w:r><w:t>,</w:t></w:r></w:p>` +
+	`<w:p w:rsidR="00A1"><w:pPr><w:pStyle w:val="Body"/></w:pPr><w:r><w:t xml:space="preserve">You owe {{amount}} to {{company}}.</w:t></w:r></w:p>`
+
+func TestFields(t *testing.T) {
+	got, err := mailmerge.Fields(docx(t, splitBody, `<w:p><w:r><w:t>Page {{page_label}}</w:t></w:r></w:p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"amount", "company", "first_name", "page_label"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Fields = %v, want %v", got, want)
+	}
+	if _, err := mailmerge.Fields([]byte("not a zip")); !errors.Is(err, mailmerge.ErrNotDocx) {
+		t.Errorf("non-package: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tmpl := docx(t, splitBody, `<w:p><w:r><w:t>Page {{page_label}}</w:t></w:r></w:p>`)
+	out, err := mailmerge.Merge(tmpl, map[string]string{
+		"first_name": "Ada & Co",
+		"amount":     "€1,200",
+		"company":    "<Globex>",
+		"page_label": "A",
+		"unused":     "x",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := part(t, out, "word/document.xml")
+	// The value lands in the bold run the placeholder started in; the runs
+	// that held the rest of it are left empty.
+	for _, want := range []string{
+		`<w:t xml:space="preserve">Dear </w:t>`,
+		`<w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Ada &amp; Co</w:t>`,
+		`<w:proofErr w:type="spellStart"/><w:r><w:t xml:space="preserve"></w:t></w:r><w:r><w:t xml:space="preserve"></w:t></w:r>`,
+		`<w:t xml:space="preserve">,</w:t>`,
+		`<w:pPr><w:pStyle w:val="Body"/></w:pPr><w:r><w:t xml:space="preserve">You owe €1,200 to &lt;Globex&gt;.</w:t>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("document.xml lacks %s:\n%s", want, doc)
+		}
+	}
+	if ftr := part(t, out, "word/footer1.xml"); !strings.Contains(ftr, ">Page A</w:t>") {
+		t.Errorf("footer %s", ftr)
+	}
+	if styles := part(t, out, "word/styles.xml"); styles != `<w:styles>{{untouched}}</w:styles>` {
+		t.Errorf("styles rewritten: %s", styles)
+	}
+}
+
+func TestMerge_LeavesOtherParagraphsAlone(t *testing.T) {
+	body := `<w:p><w:r><w:t>No fields &amp; here</w:t></w:r><w:r><w:tab/></w:r></w:p>`
+	out, err := mailmerge.Merge(docx(t, body, ""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := part(t, out, "word/document.xml"); !strings.Contains(doc, body) {
+		t.Errorf("paragraph without placeholders changed: %s", doc)
+	}
+}
+
+func TestMerge_MissingFields(t *testing.T) {
+	_, err := mailmerge.Merge(docx(t, splitBody, ""), map[string]string{"amount": "1"})
+	var missing *mailmerge.MissingFieldsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected *MissingFieldsError, got %v", err)
+	}
+	if want := []string{"company", "first_name"}; !slices.Equal(missing.Fields, want) {
+		t.Errorf("Fields = %v, want %v", missing.Fields, want)
+	}
+}
@@ -3,21 +3,107 @@ package metrics
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/buildinfo"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Outcomes lists every value of the "outcome" label.
+var Outcomes = []string{"success", "timeout", "failed", "rejected", "slow_client", "bad_upload"}
+
+// DocTypes lists every value of the "type" label. Requests rejected before
+// their document type is known are counted as "unknown".
+var DocTypes = []string{"docx", "odt", "rtf", "txt", "xlsx", "ods", "pptx", "odp", "unknown"}
+
+// MacroActions lists every value of the "action" label on macro uploads.
+var MacroActions = []string{"allowed", "stripped", "rejected"}
+
+// ProtectionActions lists every value of the "action" label on protected
+// uploads.
+var ProtectionActions = []string{"ignored", "warned", "rejected"}
+
+// Stages lists every value of the "stage" label, in request order.
+var Stages = []string{"parse", "validate", "stage", "convert", "postprocess", "respond"}
+
+// Directions lists every value of the "direction" label on slow clients.
+var Directions = []string{"upload", "download"}
+
+// BadUploadReasons lists every value of the "reason" label on malformed
+// uploads.
+var BadUploadReasons = []string{"empty", "truncated", "aborted", "invalid_package", "package_too_large"}
+
+// LimitResources lists every value of the "resource" label on conversions
+// stopped by a resource limit.
+var LimitResources = []string{"cpu", "rss", "output"}
+
+// ScratchFallbackReasons lists every value of the "reason" label on scratch
+// directories made on or moved to disk.
+var ScratchFallbackReasons = []string{"full", "limit"}
+
+// CacheResults lists every value of the "result" label on cache lookups.
+var CacheResults = []string{"hit", "miss"}
+
 // Registry holds all metrics for the service.
 type Registry struct {
 	conversions *prometheus.CounterVec
+	byType      *prometheus.CounterVec
 	inFlight    prometheus.Gauge
 	duration    prometheus.Histogram
+	jobsHeld    *prometheus.GaugeVec
+	jobsDone    *prometheus.CounterVec
+	feedback    *prometheus.CounterVec
+	wdKills     prometheus.Counter
+	outPending  prometheus.Gauge
+	outLag      prometheus.Gauge
+	outDropped  prometheus.Counter
+	macros      *prometheus.CounterVec
+	protected   *prometheus.CounterVec
+	byClient    *prometheus.CounterVec
+	rateLimited *prometheus.CounterVec
+	denied      *prometheus.CounterVec
+	rateStore   prometheus.Counter
+	stages      *prometheus.HistogramVec
+	cache       *prometheus.CounterVec
+	slowClients *prometheus.CounterVec
+	deprecated  *prometheus.CounterVec
+	badUploads  *prometheus.CounterVec
+	limits      *prometheus.CounterVec
+	retries     prometheus.Counter
+	backends    *prometheus.CounterVec
+	fallbacks   *prometheus.CounterVec
+	backendUp   *prometheus.GaugeVec
+	reclaimed   prometheus.Gauge
+	orphans     prometheus.Counter
+	scratch     *prometheus.CounterVec
+	dedup       prometheus.Counter
+	dedupBytes  prometheus.Counter
+	templates   prometheus.Counter
+	fonts       prometheus.Counter
+	buildInfo   *prometheus.GaugeVec
+	inputBytes  *prometheus.HistogramVec
+	outputBytes *prometheus.HistogramVec
+	sizeRatio   *prometheus.SummaryVec
+	workers     prometheus.Gauge
+	workersBusy prometheus.Gauge
+	queueDepth  prometheus.Gauge
+	queueWait   prometheus.Histogram
+	httpTotal   *prometheus.CounterVec
+	httpLatency *prometheus.HistogramVec
+	taskRuns    *prometheus.CounterVec
+	taskTime    *prometheus.HistogramVec
+	taskLastOK  *prometheus.GaugeVec
+	registry    *prometheus.Registry
 	handler     http.Handler
 }
 
 // New returns a Registry backed by a fresh prometheus.Registry (never the
-// default global registry, to avoid auto-registering Go runtime metrics).
+// default global registry, to avoid auto-registering Go runtime metrics;
+// RegisterRuntime adds them on request).
 func New() *Registry {
 	reg := prometheus.NewRegistry()
 
@@ -26,6 +112,11 @@ func New() *Registry {
 		Help: "Total conversion attempts by outcome.",
 	}, []string{"outcome"})
 
+	byType := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_conversions_by_type_total",
+		Help: "Total conversion attempts by detected input type and outcome.",
+	}, []string{"type", "outcome"})
+
 	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "docpdf_conversions_in_flight",
 		Help: "Current number of conversions in progress.",
@@ -37,22 +128,352 @@ func New() *Registry {
 		Buckets: []float64{100, 250, 500, 1000, 2500, 5000, 10000, 30000},
 	})
 
-	reg.MustRegister(conversions, inFlight, duration)
+	jobsHeld := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "docpdf_jobs",
+		Help: "Async jobs currently held, by state.",
+	}, []string{"state"})
+
+	jobsDone := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_jobs_completed_total",
+		Help: "Async jobs that reached a terminal state.",
+	}, []string{"state"})
+
+	feedback := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_job_feedback_total",
+		Help: "Quality ratings (1-5) given on async job results, by LibreOffice version, input type and output format.",
+	}, []string{"libreoffice", "doc_type", "format", "rating"})
+
+	wdKills := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_watchdog_kills_total",
+		Help: "Conversions cancelled by the memory watchdog.",
+	})
+
+	outPending := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "docpdf_outbox_pending",
+		Help: "Events waiting in the outbox to be published.",
+	})
+
+	outLag := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "docpdf_outbox_lag_seconds",
+		Help: "Age of the oldest unpublished outbox event.",
+	})
+
+	outDropped := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_outbox_dropped_total",
+		Help: "Outbox events given up on after the maximum attempts.",
+	})
+
+	macros := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_macro_documents_total",
+		Help: "Documents carrying macros, by the action the macro policy took.",
+	}, []string{"action"})
+
+	protected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_protected_uploads_total",
+		Help: "Uploads marked read-only or restricting editing, by the action the protection policy took.",
+	}, []string{"action"})
+
+	byClient := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_conversions_by_client_total",
+		Help: "Total conversion attempts by authenticated API key name and outcome.",
+	}, []string{"client", "outcome"})
+
+	rateLimited := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_rate_limited_total",
+		Help: "Requests rejected by the rate limiter, by how the client was identified (key or ip).",
+	}, []string{"by"})
+
+	denied := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_access_denied_total",
+		Help: "Requests refused by an access policy (API keys, admin token, rate limit, document type policy), by policy and reason.",
+	}, []string{"policy", "reason"})
+
+	rateStore := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_rate_limit_store_errors_total",
+		Help: "Rate limit checks the shared bucket store failed, limited by the replica's own buckets instead.",
+	})
+
+	stages := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docpdf_stage_duration_seconds",
+		Help:    "Time spent in each stage of a synchronous conversion request.",
+		Buckets: []float64{.001, .005, .025, .1, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"stage"})
+
+	cacheLookups := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_cache_lookups_total",
+		Help: "Result cache lookups, by whether a cached result was served.",
+	}, []string{"result"})
+
+	slowClients := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_slow_clients_total",
+		Help: "Transfers aborted for falling below the minimum throughput, by direction.",
+	}, []string{"direction"})
+
+	// Deprecated features are configured at startup, so there are no label
+	// values to pre-initialize.
+	deprecated := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_deprecated_requests_total",
+		Help: "Requests using a deprecated endpoint, parameter or API version, by feature.",
+	}, []string{"feature"})
+
+	badUploads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_bad_uploads_total",
+		Help: "Uploads rejected as empty, truncated, aborted mid-transfer or not a sound package, by reason.",
+	}, []string{"reason"})
+
+	resourceLimits := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_resource_limit_total",
+		Help: "Conversions stopped for exceeding a per-process resource limit, by resource: cpu, rss or output.",
+	}, []string{"resource"})
+
+	conversionRetries := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_conversion_retries_total",
+		Help: "Conversions run again after failing with an error CONVERT_RETRY_ON retries.",
+	})
+
+	// Per-backend series, set when CONVERTER_BACKENDS routes conversions
+	// over several converters.
+	backendConversions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_backend_conversions_total",
+		Help: "Conversions given to each converter backend, by backend and outcome: success, failed, timeout, unsupported, resource_limit or canceled.",
+	}, []string{"backend", "outcome"})
+	backendFallbacks := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_backend_fallbacks_total",
+		Help: "Conversions tried on the next backend after failing on one, by the backend failed on and the one tried.",
+	}, []string{"from", "to"})
+	backendUp := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "docpdf_backend_up",
+		Help: "1 while a converter backend is in rotation, 0 while it is out after failing repeatedly.",
+	}, []string{"backend"})
+
+	tempReclaimed := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "docpdf_temp_reclaimed_bytes",
+		Help: "Bytes of orphaned docpdf-* temp directories removed by the latest sweep.",
+	})
+	tempOrphans := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_temp_orphan_dirs_total",
+		Help: "docpdf-* temp directories of processes no longer running removed by temp sweeps.",
+	})
+
+	scratchFallbacks := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_scratch_fallbacks_total",
+		Help: "Conversions staged on disk instead of the scratch tmpfs, by reason: full, or over the per-conversion limit.",
+	}, []string{"reason"})
+
+	resultDedup := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_job_results_deduplicated_total",
+		Help: "Async job results identical to one already kept, stored as a reference to it.",
+	})
+	resultDedupBytes := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_job_result_bytes_deduplicated_total",
+		Help: "Bytes of async job results not stored again because an identical result was kept.",
+	})
+
+	templates := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_external_templates_stripped_total",
+		Help: "Word uploads whose external attached-template reference was removed before conversion.",
+	})
+
+	missingFonts := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "docpdf_missing_font_uploads_total",
+		Help: "Word uploads using fonts neither installed nor substituted with an installed font.",
+	})
+
+	// Set once at startup, so dashboards can join any series on the build
+	// that produced it.
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "docpdf_build_info",
+		Help: "Always 1, labelled with the service version, commit, Go version and LibreOffice version.",
+	}, []string{"version", "commit", "go_version", "libreoffice"})
+
+	// Document sizes, 1 KiB to 64 MiB in powers of 4, for right-sizing
+	// memory limits and spotting anomalous documents.
+	sizeBuckets := prometheus.ExponentialBuckets(1<<10, 4, 9)
+	inputBytes := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docpdf_input_bytes",
+		Help:    "Size of successfully converted input documents, by input type.",
+		Buckets: sizeBuckets,
+	}, []string{"type"})
+
+	outputBytes := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docpdf_output_bytes",
+		Help:    "Size of conversion results, by input type.",
+		Buckets: sizeBuckets,
+	}, []string{"type"})
+
+	sizeRatio := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       "docpdf_compression_ratio",
+		Help:       "Result size divided by input size, by input type.",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	}, []string{"type"})
+
+	// Conversion pool occupancy, for autoscaling on queueing rather than
+	// CPU: utilization is docpdf_workers_busy / docpdf_workers.
+	workers := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "docpdf_workers",
+		Help: "Concurrent conversion slots.",
+	})
+
+	workersBusy := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "docpdf_workers_busy",
+		Help: "Conversion slots currently held.",
+	})
+
+	queueDepth := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "docpdf_queue_depth",
+		Help: "Requests currently waiting for a conversion slot.",
+	})
+
+	queueWait := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "docpdf_queue_wait_ms",
+		Help:    "Time a request waited for a conversion slot in milliseconds; 0 when one was free.",
+		Buckets: []float64{0, 10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000},
+	})
+
+	// Every route, not just the conversion ones. path is the route pattern,
+	// not the request path, so IDs in paths don't multiply series.
+	httpTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"path", "method", "code"})
+
+	httpLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docpdf_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"path", "method"})
+
+	// Scheduled maintenance tasks are configured at startup, so there are
+	// no label values to pre-initialize.
+	taskRuns := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "docpdf_task_runs_total",
+		Help: "Runs of scheduled maintenance tasks, by task and result (success or failure).",
+	}, []string{"task", "result"})
+
+	taskTime := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docpdf_task_duration_seconds",
+		Help:    "Duration of scheduled maintenance task runs.",
+		Buckets: []float64{.001, .01, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"task"})
+
+	taskLastOK := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "docpdf_task_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of each scheduled maintenance task.",
+	}, []string{"task"})
+
+	reg.MustRegister(conversions, byType, inFlight, duration, jobsHeld, jobsDone, feedback, wdKills,
+		outPending, outLag, outDropped, macros, protected, byClient, rateLimited, denied, rateStore, stages, cacheLookups, slowClients,
+		deprecated, badUploads, resourceLimits, conversionRetries, backendConversions, backendFallbacks, backendUp, tempReclaimed, tempOrphans, scratchFallbacks, resultDedup, resultDedupBytes, templates, missingFonts, buildInfo, inputBytes, outputBytes, sizeRatio,
+		workers, workersBusy, queueDepth, queueWait, httpTotal, httpLatency,
+		taskRuns, taskTime, taskLastOK)
 
 	// Pre-initialize all outcome label values so they appear at zero in the
 	// exposition even before any conversions have occurred.
-	for _, outcome := range []string{"success", "timeout", "failed"} {
+	for _, outcome := range Outcomes {
 		conversions.WithLabelValues(outcome)
+		for _, t := range DocTypes {
+			byType.WithLabelValues(t, outcome)
+		}
+	}
+
+	for _, action := range MacroActions {
+		macros.WithLabelValues(action)
+	}
+	for _, action := range ProtectionActions {
+		protected.WithLabelValues(action)
+	}
+	rateLimited.WithLabelValues("key")
+	rateLimited.WithLabelValues("ip")
+	for _, stage := range Stages {
+		stages.WithLabelValues(stage)
+	}
+	for _, result := range CacheResults {
+		cacheLookups.WithLabelValues(result)
+	}
+	for _, direction := range Directions {
+		slowClients.WithLabelValues(direction)
+	}
+	for _, reason := range BadUploadReasons {
+		badUploads.WithLabelValues(reason)
+	}
+	for _, resource := range LimitResources {
+		resourceLimits.WithLabelValues(resource)
+	}
+	for _, reason := range ScratchFallbackReasons {
+		scratchFallbacks.WithLabelValues(reason)
+	}
+
+	for _, state := range jobs.States {
+		jobsHeld.WithLabelValues(string(state))
+		if state.Terminal() {
+			jobsDone.WithLabelValues(string(state))
+		}
 	}
 
 	return &Registry{
 		conversions: conversions,
+		byType:      byType,
 		inFlight:    inFlight,
 		duration:    duration,
+		jobsHeld:    jobsHeld,
+		jobsDone:    jobsDone,
+		feedback:    feedback,
+		wdKills:     wdKills,
+		outPending:  outPending,
+		outLag:      outLag,
+		outDropped:  outDropped,
+		macros:      macros,
+		protected:   protected,
+		byClient:    byClient,
+		rateLimited: rateLimited,
+		denied:      denied,
+		rateStore:   rateStore,
+		stages:      stages,
+		cache:       cacheLookups,
+		slowClients: slowClients,
+		deprecated:  deprecated,
+		badUploads:  badUploads,
+		limits:      resourceLimits,
+		retries:     conversionRetries,
+		backends:    backendConversions,
+		fallbacks:   backendFallbacks,
+		backendUp:   backendUp,
+		reclaimed:   tempReclaimed,
+		orphans:     tempOrphans,
+		scratch:     scratchFallbacks,
+		dedup:       resultDedup,
+		dedupBytes:  resultDedupBytes,
+		templates:   templates,
+		fonts:       missingFonts,
+		buildInfo:   buildInfo,
+		inputBytes:  inputBytes,
+		outputBytes: outputBytes,
+		sizeRatio:   sizeRatio,
+		workers:     workers,
+		workersBusy: workersBusy,
+		queueDepth:  queueDepth,
+		queueWait:   queueWait,
+		httpTotal:   httpTotal,
+		httpLatency: httpLatency,
+		taskRuns:    taskRuns,
+		taskTime:    taskTime,
+		taskLastOK:  taskLastOK,
+		registry:    reg,
 		handler:     promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
 	}
 }
 
+// RegisterRuntime adds the Go runtime and process metrics to the exposition:
+// go_goroutines, the go_memstats_* heap figures, GC pauses in
+// go_gc_duration_seconds, and process_resident_memory_bytes, open file
+// descriptors and CPU time. It must be called at most once.
+func (r *Registry) RegisterRuntime() {
+	r.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
 // IncSuccess increments the successful conversion counter.
 func (r *Registry) IncSuccess() { r.conversions.WithLabelValues("success").Inc() }
 
@@ -62,14 +483,245 @@ func (r *Registry) IncTimeout() { r.conversions.WithLabelValues("timeout").Inc()
 // IncFailed increments the failed conversion counter.
 func (r *Registry) IncFailed() { r.conversions.WithLabelValues("failed").Inc() }
 
+// IncRejected increments the counter for requests turned away because the
+// conversion queue was full.
+func (r *Registry) IncRejected() { r.conversions.WithLabelValues("rejected").Inc() }
+
+// IncSlowClient increments the counter for conversions whose client was cut
+// off for transferring too slowly.
+func (r *Registry) IncSlowClient() { r.conversions.WithLabelValues("slow_client").Inc() }
+
+// IncType increments the per-type conversion counter. An empty docType is
+// recorded as "unknown".
+func (r *Registry) IncType(docType, outcome string) {
+	if docType == "" {
+		docType = "unknown"
+	}
+	r.byType.WithLabelValues(docType, outcome).Inc()
+}
+
+// IncClient increments the per-client conversion counter. client is an API
+// key name, so the label's cardinality is bounded by the keystore.
+func (r *Registry) IncClient(client, outcome string) {
+	r.byClient.WithLabelValues(client, outcome).Inc()
+}
+
 // IncInFlight increments the in-flight conversion gauge.
 func (r *Registry) IncInFlight() { r.inFlight.Inc() }
 
 // DecInFlight decrements the in-flight conversion gauge.
 func (r *Registry) DecInFlight() { r.inFlight.Dec() }
 
-// ObserveDuration records a conversion duration in milliseconds.
-func (r *Registry) ObserveDuration(ms int64) { r.duration.Observe(float64(ms)) }
+// ObserveDuration records a conversion duration in milliseconds. A
+// non-empty traceID, the sampled trace of the request, is attached as an
+// exemplar.
+func (r *Registry) ObserveDuration(ms int64, traceID string) {
+	observe(r.duration, float64(ms), traceID)
+}
+
+// JobTransition implements jobs.Observer, keeping the per-state job gauge and
+// the completion counter up to date.
+func (r *Registry) JobTransition(from, to jobs.State) {
+	if from != "" {
+		r.jobsHeld.WithLabelValues(string(from)).Dec()
+	}
+	if to != "" {
+		r.jobsHeld.WithLabelValues(string(to)).Inc()
+		if to.Terminal() {
+			r.jobsDone.WithLabelValues(string(to)).Inc()
+		}
+	}
+}
+
+// ObserveFeedback counts the rating given on a job's result. It has the
+// signature of jobs.Config.OnFeedback.
+func (r *Registry) ObserveFeedback(j jobs.Job) {
+	if j.Feedback == nil {
+		return
+	}
+	r.feedback.WithLabelValues(j.LibreOffice, j.DocType, j.Format, strconv.Itoa(j.Feedback.Rating)).Inc()
+}
+
+// ObserveSizes records the input and result sizes in bytes of a successful
+// conversion, and their ratio. An empty docType is recorded as "unknown".
+func (r *Registry) ObserveSizes(docType string, in, out int64) {
+	if docType == "" {
+		docType = "unknown"
+	}
+	r.inputBytes.WithLabelValues(docType).Observe(float64(in))
+	r.outputBytes.WithLabelValues(docType).Observe(float64(out))
+	if in > 0 {
+		r.sizeRatio.WithLabelValues(docType).Observe(float64(out) / float64(in))
+	}
+}
+
+// BackendConverted implements converter.RouterObserver.
+func (r *Registry) BackendConverted(backend, outcome string) {
+	r.backends.WithLabelValues(backend, outcome).Inc()
+}
+
+// BackendFellBack implements converter.RouterObserver.
+func (r *Registry) BackendFellBack(from, to string) {
+	r.fallbacks.WithLabelValues(from, to).Inc()
+}
+
+// BackendHealthChanged implements converter.RouterObserver.
+func (r *Registry) BackendHealthChanged(backend string, healthy bool) {
+	v := 0.0
+	if healthy {
+		v = 1
+	}
+	r.backendUp.WithLabelValues(backend).Set(v)
+}
+
+// SetWorkers records the number of concurrent conversion slots.
+func (r *Registry) SetWorkers(n int) { r.workers.Set(float64(n)) }
+
+// PoolChanged implements pool.Observer.
+func (r *Registry) PoolChanged(busy, waiting int) {
+	r.workersBusy.Set(float64(busy))
+	r.queueDepth.Set(float64(waiting))
+}
+
+// PoolWaited implements pool.Observer.
+func (r *Registry) PoolWaited(d time.Duration) {
+	r.queueWait.Observe(float64(d.Milliseconds()))
+}
+
+// ObserveHTTP counts a request to the route path and records its latency,
+// with traceID as an exemplar as for ObserveDuration.
+func (r *Registry) ObserveHTTP(path, method string, code int, d time.Duration, traceID string) {
+	r.httpTotal.WithLabelValues(path, method, strconv.Itoa(code)).Inc()
+	observe(r.httpLatency.WithLabelValues(path, method), d.Seconds(), traceID)
+}
+
+// observe records v in o, with a trace_id exemplar when traceID is set, so
+// a dashboard can go from a bucket to an example trace.
+func observe(o prometheus.Observer, v float64, traceID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && traceID != "" {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	o.Observe(v)
+}
+
+// TaskRan implements schedule.Observer.
+func (r *Registry) TaskRan(task string, d time.Duration, err error) {
+	r.taskTime.WithLabelValues(task).Observe(d.Seconds())
+	if err != nil {
+		r.taskRuns.WithLabelValues(task, "failure").Inc()
+		return
+	}
+	r.taskRuns.WithLabelValues(task, "success").Inc()
+	r.taskLastOK.WithLabelValues(task).SetToCurrentTime()
+}
+
+// IncWatchdogKill increments the counter of conversions cancelled by the
+// memory watchdog.
+func (r *Registry) IncWatchdogKill() { r.wdKills.Inc() }
+
+// OutboxLag implements outbox.Observer.
+func (r *Registry) OutboxLag(pending int, oldest time.Duration) {
+	r.outPending.Set(float64(pending))
+	r.outLag.Set(oldest.Seconds())
+}
+
+// OutboxDropped implements outbox.Observer.
+func (r *Registry) OutboxDropped() { r.outDropped.Inc() }
+
+// IncMacroDocument counts a document carrying macros and the action the macro
+// policy took on it.
+func (r *Registry) IncMacroDocument(action string) { r.macros.WithLabelValues(action).Inc() }
+
+// IncRateLimited counts a request rejected by the rate limiter. by is "key"
+// for clients identified by API key, "ip" otherwise.
+func (r *Registry) IncRateLimited(by string) { r.rateLimited.WithLabelValues(by).Inc() }
+
+// IncDenied counts a request refused by an access policy, with the reason
+// it gave (see package audit).
+func (r *Registry) IncDenied(policy, reason string) { r.denied.WithLabelValues(policy, reason).Inc() }
+
+// IncRateLimitStoreError counts a rate limit check the shared bucket store
+// failed.
+func (r *Registry) IncRateLimitStoreError() { r.rateStore.Inc() }
+
+// ObserveStage records how long one stage of a conversion request took.
+func (r *Registry) ObserveStage(stage string, d time.Duration) {
+	r.stages.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// IncSlowTransfer counts a transfer aborted by the minimum-throughput check;
+// direction is "upload" or "download".
+func (r *Registry) IncSlowTransfer(direction string) {
+	r.slowClients.WithLabelValues(direction).Inc()
+}
+
+// IncCacheLookup counts a result cache lookup; result is "hit" or "miss".
+func (r *Registry) IncCacheLookup(result string) { r.cache.WithLabelValues(result).Inc() }
+
+// IncBadUpload increments the conversion counter for malformed uploads.
+func (r *Registry) IncBadUpload() { r.conversions.WithLabelValues("bad_upload").Inc() }
+
+// IncBadUploadReason counts an upload rejected as malformed, by reason
+// ("empty", "truncated", "aborted", "invalid_package" or
+// "package_too_large").
+func (r *Registry) IncBadUploadReason(reason string) { r.badUploads.WithLabelValues(reason).Inc() }
+
+// IncResourceLimit counts a conversion stopped by a resource limit;
+// resource is "cpu", "rss" or "output".
+func (r *Registry) IncResourceLimit(resource string) { r.limits.WithLabelValues(resource).Inc() }
+
+// IncConversionRetry counts a conversion run again after a transient
+// failure.
+func (r *Registry) IncConversionRetry() { r.retries.Inc() }
+
+// SetTempReclaimed records the bytes of orphaned temp directories the latest
+// sweep removed.
+func (r *Registry) SetTempReclaimed(bytes int64) { r.reclaimed.Set(float64(bytes)) }
+
+// AddTempOrphans counts temp directories of processes no longer running
+// that a sweep removed.
+func (r *Registry) AddTempOrphans(n int) { r.orphans.Add(float64(n)) }
+
+// IncScratchFallback counts a conversion staged on disk instead of the
+// scratch filesystem; reason is "full" or "limit".
+func (r *Registry) IncScratchFallback(reason string) { r.scratch.WithLabelValues(reason).Inc() }
+
+// AddResultDedup counts an async job result of size bytes found identical
+// to one already kept.
+func (r *Registry) AddResultDedup(size int64) {
+	r.dedup.Inc()
+	r.dedupBytes.Add(float64(size))
+}
+
+// IncProtectedUpload counts an upload marked read-only or restricting
+// editing and the action the protection policy took.
+func (r *Registry) IncProtectedUpload(action string) { r.protected.WithLabelValues(action).Inc() }
+
+// IncTemplateStripped counts an upload whose external template reference
+// was removed.
+func (r *Registry) IncTemplateStripped() { r.templates.Inc() }
+
+// IncMissingFonts counts an upload using fonts the host does not have.
+func (r *Registry) IncMissingFonts() { r.fonts.Inc() }
+
+// IncDeprecated counts a request using the deprecated feature.
+func (r *Registry) IncDeprecated(feature string) { r.deprecated.WithLabelValues(feature).Inc() }
+
+// SetBuildInfo publishes docpdf_build_info for the running build and the
+// detected LibreOffice version, replacing any earlier value.
+func (r *Registry) SetBuildInfo(info buildinfo.Info, libreoffice string) {
+	r.buildInfo.Reset()
+	r.buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion, libreoffice).Set(1)
+}
+
+// EnableOpenMetrics serves the OpenMetrics exposition to scrapers that ask
+// for it in Accept, as Prometheus does with exemplar storage enabled. Only
+// OpenMetrics carries exemplars; others still get the Prometheus text
+// format. It must be called before the Registry serves.
+func (r *Registry) EnableOpenMetrics() {
+	r.handler = promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
 
 // ServeHTTP serves the Prometheus text exposition (with content negotiation).
 func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -1,11 +1,15 @@
 package metrics_test
 
 import (
+	"errors"
 	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/buildinfo"
+	"github.com/BRO3886/go-docpdf/internal/jobs"
 	"github.com/BRO3886/go-docpdf/internal/metrics"
 )
 
@@ -23,10 +27,12 @@ func TestCounters(t *testing.T) {
 	reg.IncSuccess()
 	reg.IncTimeout()
 	reg.IncFailed()
+	reg.IncRejected()
 
 	body := scrape(t, reg)
 	cases := []string{
 		`docpdf_conversions_total{outcome="failed"} 1`,
+		`docpdf_conversions_total{outcome="rejected"} 1`,
 		`docpdf_conversions_total{outcome="success"} 2`,
 		`docpdf_conversions_total{outcome="timeout"} 1`,
 	}
@@ -37,6 +43,46 @@ func TestCounters(t *testing.T) {
 	}
 }
 
+func TestTypeCounters(t *testing.T) {
+	reg := metrics.New()
+	reg.IncType("pptx", "success")
+	reg.IncType("", "failed")
+
+	body := scrape(t, reg)
+	cases := []string{
+		`docpdf_conversions_by_type_total{outcome="success",type="pptx"} 1`,
+		`docpdf_conversions_by_type_total{outcome="failed",type="unknown"} 1`,
+		`docpdf_conversions_by_type_total{outcome="success",type="docx"} 0`,
+	}
+	for _, want := range cases {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestJobTransitions(t *testing.T) {
+	reg := metrics.New()
+	reg.JobTransition("", jobs.StateQueued)
+	reg.JobTransition(jobs.StateQueued, jobs.StateRunning)
+	reg.JobTransition(jobs.StateRunning, jobs.StateSucceeded)
+	reg.JobTransition("", jobs.StateQueued)
+
+	body := scrape(t, reg)
+	cases := []string{
+		`docpdf_jobs{state="queued"} 1`,
+		`docpdf_jobs{state="running"} 0`,
+		`docpdf_jobs{state="succeeded"} 1`,
+		`docpdf_jobs_completed_total{state="succeeded"} 1`,
+		`docpdf_jobs_completed_total{state="failed"} 0`,
+	}
+	for _, want := range cases {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+}
+
 func TestInFlight(t *testing.T) {
 	reg := metrics.New()
 	reg.IncInFlight()
@@ -49,12 +95,391 @@ func TestInFlight(t *testing.T) {
 	}
 }
 
+func TestWatchdogKills(t *testing.T) {
+	reg := metrics.New()
+	if !strings.Contains(scrape(t, reg), "docpdf_watchdog_kills_total 0") {
+		t.Error("expected watchdog kills pre-registered at zero")
+	}
+	reg.IncWatchdogKill()
+	if body := scrape(t, reg); !strings.Contains(body, "docpdf_watchdog_kills_total 1") {
+		t.Errorf("expected watchdog kills=1, got:\n%s", body)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	reg := metrics.New()
+	reg.OutboxLag(3, 90*time.Second)
+	reg.OutboxDropped()
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		"docpdf_outbox_pending 3",
+		"docpdf_outbox_lag_seconds 90",
+		"docpdf_outbox_dropped_total 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestMacroDocuments(t *testing.T) {
+	reg := metrics.New()
+	reg.IncMacroDocument("rejected")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_macro_documents_total{action="rejected"} 1`,
+		`docpdf_macro_documents_total{action="stripped"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestClientCounters(t *testing.T) {
+	reg := metrics.New()
+	reg.IncClient("team-a", "success")
+
+	body := scrape(t, reg)
+	want := `docpdf_conversions_by_client_total{client="team-a",outcome="success"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("missing %q in output:\n%s", want, body)
+	}
+}
+
+func TestCacheLookups(t *testing.T) {
+	reg := metrics.New()
+	reg.IncCacheLookup("hit")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_cache_lookups_total{result="hit"} 1`,
+		`docpdf_cache_lookups_total{result="miss"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	reg := metrics.New()
+	reg.IncDeprecated("v1")
+	reg.IncDeprecated("v1")
+
+	body := scrape(t, reg)
+	want := `docpdf_deprecated_requests_total{feature="v1"} 2`
+	if !strings.Contains(body, want) {
+		t.Errorf("missing %q in output:\n%s", want, body)
+	}
+}
+
+func TestBadUploads(t *testing.T) {
+	reg := metrics.New()
+	reg.IncBadUpload()
+	reg.IncBadUploadReason("truncated")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_conversions_total{outcome="bad_upload"} 1`,
+		`docpdf_bad_uploads_total{reason="truncated"} 1`,
+		`docpdf_bad_uploads_total{reason="empty"} 0`,
+		`docpdf_bad_uploads_total{reason="aborted"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	reg := metrics.New()
+	reg.IncResourceLimit("rss")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_resource_limit_total{resource="rss"} 1`,
+		`docpdf_resource_limit_total{resource="cpu"} 0`,
+		`docpdf_resource_limit_total{resource="output"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestConversionRetries(t *testing.T) {
+	reg := metrics.New()
+	if body := scrape(t, reg); !strings.Contains(body, "docpdf_conversion_retries_total 0") {
+		t.Errorf("retries not exported before the first:\n%s", body)
+	}
+	reg.IncConversionRetry()
+	reg.IncConversionRetry()
+	if body := scrape(t, reg); !strings.Contains(body, "docpdf_conversion_retries_total 2") {
+		t.Errorf("missing retry count in output:\n%s", body)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	reg := metrics.New()
+	reg.BackendHealthChanged("unoserver", true)
+	reg.BackendHealthChanged("gotenberg", true)
+	reg.BackendConverted("unoserver", "failed")
+	reg.BackendFellBack("unoserver", "gotenberg")
+	reg.BackendConverted("gotenberg", "success")
+	reg.BackendHealthChanged("unoserver", false)
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_backend_conversions_total{backend="unoserver",outcome="failed"} 1`,
+		`docpdf_backend_conversions_total{backend="gotenberg",outcome="success"} 1`,
+		`docpdf_backend_fallbacks_total{from="unoserver",to="gotenberg"} 1`,
+		`docpdf_backend_up{backend="unoserver"} 0`,
+		`docpdf_backend_up{backend="gotenberg"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in:\n%s", want, body)
+		}
+	}
+}
+
+func TestTempReclaimed(t *testing.T) {
+	reg := metrics.New()
+	reg.SetTempReclaimed(4096)
+	reg.AddTempOrphans(2)
+	body := scrape(t, reg)
+	if !strings.Contains(body, "docpdf_temp_reclaimed_bytes 4096") {
+		t.Errorf("missing docpdf_temp_reclaimed_bytes in:\n%s", body)
+	}
+	if !strings.Contains(body, "docpdf_temp_orphan_dirs_total 2") {
+		t.Errorf("missing docpdf_temp_orphan_dirs_total in:\n%s", body)
+	}
+}
+
+func TestScratchFallbacks(t *testing.T) {
+	reg := metrics.New()
+	reg.IncScratchFallback("limit")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_scratch_fallbacks_total{reason="limit"} 1`,
+		`docpdf_scratch_fallbacks_total{reason="full"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestResultDedup(t *testing.T) {
+	reg := metrics.New()
+	reg.AddResultDedup(2048)
+	reg.AddResultDedup(1024)
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		"docpdf_job_results_deduplicated_total 2",
+		"docpdf_job_result_bytes_deduplicated_total 3072",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestRateLimitStoreErrors(t *testing.T) {
+	reg := metrics.New()
+	reg.IncRateLimitStoreError()
+
+	if body := scrape(t, reg); !strings.Contains(body, "docpdf_rate_limit_store_errors_total 1") {
+		t.Errorf("missing store error count in output:\n%s", body)
+	}
+}
+
+func TestAccessDenied(t *testing.T) {
+	reg := metrics.New()
+	reg.IncDenied("api_key", "api_key_expired")
+	reg.IncDenied("api_key", "api_key_expired")
+
+	if body := scrape(t, reg); !strings.Contains(body, `docpdf_access_denied_total{policy="api_key",reason="api_key_expired"} 2`) {
+		t.Errorf("missing denial count in output:\n%s", body)
+	}
+}
+
+func TestJobFeedback(t *testing.T) {
+	reg := metrics.New()
+	j := jobs.Job{LibreOffice: "24.2.1.2", DocType: "docx", Format: "pdf", Feedback: &jobs.Feedback{Rating: 2}}
+	reg.ObserveFeedback(j)
+	reg.ObserveFeedback(j)
+	reg.ObserveFeedback(jobs.Job{DocType: "docx", Format: "pdf"})
+
+	want := `docpdf_job_feedback_total{doc_type="docx",format="pdf",libreoffice="24.2.1.2",rating="2"} 2`
+	if body := scrape(t, reg); !strings.Contains(body, want) {
+		t.Errorf("missing feedback count in output:\n%s", body)
+	}
+}
+
+func TestProtectedUploads(t *testing.T) {
+	reg := metrics.New()
+	reg.IncProtectedUpload("warned")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_protected_uploads_total{action="warned"} 1`,
+		`docpdf_protected_uploads_total{action="rejected"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestTemplatesStripped(t *testing.T) {
+	reg := metrics.New()
+	reg.IncTemplateStripped()
+
+	body := scrape(t, reg)
+	want := `docpdf_external_templates_stripped_total 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("missing %q in output:\n%s", want, body)
+	}
+}
+
+func TestMissingFonts(t *testing.T) {
+	reg := metrics.New()
+	reg.IncMissingFonts()
+
+	body := scrape(t, reg)
+	want := `docpdf_missing_font_uploads_total 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("missing %q in output:\n%s", want, body)
+	}
+}
+
+func TestStageDurations(t *testing.T) {
+	reg := metrics.New()
+	reg.ObserveStage("convert", 300*time.Millisecond)
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_stage_duration_seconds_bucket{stage="convert",le="0.5"} 1`,
+		`docpdf_stage_duration_seconds_bucket{stage="convert",le="0.1"} 0`,
+		`docpdf_stage_duration_seconds_count{stage="parse"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestSizes(t *testing.T) {
+	reg := metrics.New()
+	reg.ObserveSizes("docx", 20<<10, 80<<10)
+	reg.ObserveSizes("", 0, 2<<10)
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_input_bytes_bucket{type="docx",le="65536"} 1`,
+		`docpdf_input_bytes_bucket{type="docx",le="16384"} 0`,
+		`docpdf_output_bytes_sum{type="docx"} 81920`,
+		`docpdf_compression_ratio{type="docx",quantile="0.5"} 4`,
+		`docpdf_output_bytes_count{type="unknown"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+	// An empty input has no ratio.
+	if strings.Contains(body, `docpdf_compression_ratio_count{type="unknown"}`) {
+		t.Errorf("ratio recorded for an empty input:\n%s", body)
+	}
+}
+
+func TestPool(t *testing.T) {
+	reg := metrics.New()
+	reg.SetWorkers(4)
+	reg.PoolChanged(4, 3)
+	reg.PoolWaited(0)
+	reg.PoolWaited(300 * time.Millisecond)
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		"docpdf_workers 4",
+		"docpdf_workers_busy 4",
+		"docpdf_queue_depth 3",
+		`docpdf_queue_wait_ms_bucket{le="0"} 1`,
+		`docpdf_queue_wait_ms_bucket{le="250"} 1`,
+		`docpdf_queue_wait_ms_bucket{le="500"} 2`,
+		"docpdf_queue_wait_ms_sum 300",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	reg := metrics.New()
+	reg.ObserveHTTP("/health", "GET", 200, 2*time.Millisecond, "")
+	reg.ObserveHTTP("/health", "GET", 200, 3*time.Millisecond, "")
+	reg.ObserveHTTP("/jobs/{id}", "GET", 404, 40*time.Millisecond, "")
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_http_requests_total{code="200",method="GET",path="/health"} 2`,
+		`docpdf_http_requests_total{code="404",method="GET",path="/jobs/{id}"} 1`,
+		`docpdf_http_request_duration_seconds_bucket{method="GET",path="/health",le="0.005"} 2`,
+		`docpdf_http_request_duration_seconds_bucket{method="GET",path="/jobs/{id}",le="0.025"} 0`,
+		`docpdf_http_request_duration_seconds_count{method="GET",path="/jobs/{id}"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestTasks(t *testing.T) {
+	reg := metrics.New()
+	reg.TaskRan("stats_save", 20*time.Millisecond, nil)
+	reg.TaskRan("self_test", 2*time.Second, errors.New("conversion failed"))
+
+	body := scrape(t, reg)
+	for _, want := range []string{
+		`docpdf_task_runs_total{result="success",task="stats_save"} 1`,
+		`docpdf_task_runs_total{result="failure",task="self_test"} 1`,
+		`docpdf_task_duration_seconds_bucket{task="self_test",le="1"} 0`,
+		`docpdf_task_last_success_timestamp_seconds{task="stats_save"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `docpdf_task_last_success_timestamp_seconds{task="self_test"}`) {
+		t.Error("a failed run set the last success time")
+	}
+}
+
+func TestRegisterRuntime(t *testing.T) {
+	reg := metrics.New()
+	if body := scrape(t, reg); strings.Contains(body, "go_goroutines") {
+		t.Fatal("runtime metrics exposed before RegisterRuntime")
+	}
+	reg.RegisterRuntime()
+	body := scrape(t, reg)
+	for _, want := range []string{"go_goroutines ", "go_memstats_heap_inuse_bytes ", "go_gc_duration_seconds{quantile="} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the exposition", want)
+		}
+	}
+}
+
 func TestHistogramBucketPlacement(t *testing.T) {
 	reg := metrics.New()
-	reg.ObserveDuration(50)   // ≤100
-	reg.ObserveDuration(200)  // ≤250
-	reg.ObserveDuration(600)  // ≤1000
-	reg.ObserveDuration(3000) // ≤5000
+	reg.ObserveDuration(50, "")   // ≤100
+	reg.ObserveDuration(200, "")  // ≤250
+	reg.ObserveDuration(600, "")  // ≤1000
+	reg.ObserveDuration(3000, "") // ≤5000
 
 	body := scrape(t, reg)
 	cases := []string{
@@ -82,6 +507,21 @@ func TestContentType(t *testing.T) {
 	}
 }
 
+func TestBuildInfo(t *testing.T) {
+	reg := metrics.New()
+	reg.SetBuildInfo(buildinfo.Info{Version: "1.3.0", Commit: "abc", GoVersion: "go1.24.0"}, "unknown")
+	reg.SetBuildInfo(buildinfo.Info{Version: "1.4.0", Commit: "def", GoVersion: "go1.24.0"}, "LibreOffice 7.6.4.1")
+
+	body := scrape(t, reg)
+	want := `docpdf_build_info{commit="def",go_version="go1.24.0",libreoffice="LibreOffice 7.6.4.1",version="1.4.0"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("missing %q in output:\n%s", want, body)
+	}
+	if strings.Contains(body, `version="1.3.0"`) {
+		t.Errorf("earlier build info not replaced:\n%s", body)
+	}
+}
+
 func TestConcurrentRace(t *testing.T) {
 	reg := metrics.New()
 	var wg sync.WaitGroup
@@ -90,7 +530,7 @@ func TestConcurrentRace(t *testing.T) {
 		go func(n int) {
 			defer wg.Done()
 			reg.IncInFlight()
-			reg.ObserveDuration(int64(n * 10))
+			reg.ObserveDuration(int64(n*10), "")
 			reg.IncSuccess()
 			reg.DecInFlight()
 		}(i)
@@ -102,3 +542,26 @@ func TestConcurrentRace(t *testing.T) {
 		t.Errorf("expected 50 successes after concurrent run, got:\n%s", body)
 	}
 }
+
+func TestExemplars(t *testing.T) {
+	reg := metrics.New()
+	reg.ObserveDuration(120, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	openMetrics := func() string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+		reg.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	// Without EnableOpenMetrics the text format is served, which has no
+	// exemplars.
+	if body := openMetrics(); strings.Contains(body, "trace_id") {
+		t.Errorf("exemplar in the text format:\n%s", body)
+	}
+	reg.EnableOpenMetrics()
+	want := `docpdf_conversion_duration_ms_bucket{le="250.0"} 1 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 120`
+	if body := openMetrics(); !strings.Contains(body, want) {
+		t.Errorf("missing %q in:\n%s", want, body)
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+)
+
+// Middleware is the net/http middleware shape. chi's Router.Use and echo's
+// WrapMiddleware accept it as is; Around adapts it to routers whose
+// middleware drive the chain themselves, such as gin.
+type Middleware func(http.Handler) http.Handler
+
+// Chain composes mws into one Middleware, the first outermost.
+func Chain(mws ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// Observability returns the RequestID → Logging → Metrics stack the server
+// wraps conversions in, so an embedding router produces the same request IDs,
+// log lines and metrics. Log lines go to slog.Default. A nil reg leaves out
+// Metrics.
+func Observability(reg *metrics.Registry) Middleware {
+	mws := []Middleware{RequestID, Logging}
+	if reg != nil {
+		mws = append(mws, func(next http.Handler) http.Handler { return Metrics(reg, next) })
+	}
+	return Chain(mws...)
+}
+
+// Around runs mw around a router's own continuation. next is called with the
+// request carrying the middleware's state and must hand it on (with gin,
+// assign it to c.Request before c.Next()) so handlers can still SetOutcome.
+// Handlers downstream write to w directly; the status is taken from w's
+// Status method when it has one, as gin's ResponseWriter does.
+//
+//	r.Use(func(c *gin.Context) {
+//		middleware.Around(obs, c.Writer, c.Request, func(r *http.Request) {
+//			c.Request = r
+//			c.Next()
+//		})
+//	})
+func Around(mw Middleware, w http.ResponseWriter, r *http.Request, next func(*http.Request)) {
+	mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		next(r)
+	})).ServeHTTP(w, r)
+}
@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	tag := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := middleware.Chain(tag("a"), tag("b"), tag("c"))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if want := []string{"a", "b", "c", "handler"}; !slices.Equal(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+// statusWriter mimics a framework ResponseWriter (gin's) that tracks the
+// status written to it.
+type statusWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w statusWriter) Status() int { return w.Code }
+
+func TestAround_FrameworkContinuation(t *testing.T) {
+	reg := metrics.New()
+	fw := statusWriter{httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+	req.Header.Set("X-Request-ID", "around-id")
+
+	logs := captureLog(t)
+	middleware.Around(middleware.Observability(reg), fw, req, func(r *http.Request) {
+		// The framework's handler writes to its own writer, not the one the
+		// middleware wrapped.
+		middleware.SetOutcome(r.Context(), "rejected")
+		fw.WriteHeader(http.StatusTooManyRequests)
+	})
+	out := logs.String()
+
+	var line map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v\n%s", err, out)
+	}
+	if line["request_id"] != "around-id" {
+		t.Errorf("request_id = %v, want around-id", line["request_id"])
+	}
+	if line["status"] != float64(http.StatusTooManyRequests) {
+		t.Errorf("status = %v, want 429", line["status"])
+	}
+	if fw.Header().Get("X-Request-ID") != "around-id" {
+		t.Error("X-Request-ID not set on the framework's writer")
+	}
+
+	mw := httptest.NewRecorder()
+	reg.ServeHTTP(mw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `docpdf_conversions_total{outcome="rejected"} 1`; !strings.Contains(mw.Body.String(), want) {
+		t.Errorf("missing %q in:\n%s", want, mw.Body.String())
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+)
+
+// Deny records that a policy refused the request, for the Audit middleware
+// to log once it completes. A request can be denied more than once, as when
+// several documents of a batch are. It is a no-op when no state is present.
+func Deny(ctx context.Context, d audit.Denial) {
+	if s, ok := ctx.Value(contextKey{}).(*requestState); ok && s != nil {
+		s.denials = append(s.denials, d)
+	}
+}
+
+// Audit is middleware that adds a record to log, and counts it in reg, for
+// each denial of a request set with Deny. Records name the client set with
+// SetClient, the tenant set with SetTenant or else sent in X-Tenant-ID, and
+// the remote IP. It must run inside RequestID.
+func Audit(log *audit.Log, reg *metrics.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		s, ok := r.Context().Value(contextKey{}).(*requestState)
+		if !ok || s == nil || len(s.denials) == 0 {
+			return
+		}
+		tenant := s.tenant
+		if tenant == "" && s.client == "" {
+			tenant = r.Header.Get("X-Tenant-ID")
+		}
+		now := time.Now()
+		for _, d := range s.denials {
+			reg.IncDenied(d.Policy, d.Reason)
+			log.Add(audit.Record{
+				Time:      now,
+				RequestID: s.id,
+				Client:    s.client,
+				Tenant:    tenant,
+				IP:        remoteIP(r),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Denial:    d,
+			})
+		}
+	})
+}
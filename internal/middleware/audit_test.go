@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func TestAudit_RateLimited(t *testing.T) {
+	log := audit.NewLog(10)
+	reg := metrics.New()
+	h := middleware.RequestID(middleware.Audit(log, reg, middleware.RateLimit(middleware.NewRateLimiter(1, 1), reg,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Request-ID", "req-1")
+		req.Header.Set("X-Tenant-ID", "acme")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recs := log.List(audit.Filter{})
+	if len(recs) != 1 {
+		t.Fatalf("expected one record for the limited request, got %+v", recs)
+	}
+	rec := recs[0]
+	if rec.RequestID != "req-1" || rec.IP != "10.0.0.1" || rec.Tenant != "acme" || rec.Method != "POST" || rec.Path != "/convert" {
+		t.Errorf("who and what: %+v", rec)
+	}
+	if rec.Status != http.StatusTooManyRequests || rec.Policy != audit.PolicyRateLimit || rec.Reason != audit.ReasonRateLimited {
+		t.Errorf("why: %+v", rec.Denial)
+	}
+	if q := rec.Quota; q == nil || q.PerMinute != 1 || q.Burst != 1 || q.Remaining != 0 || q.RetryAfter != 60 || q.By != "ip" {
+		t.Errorf("quota: %+v", q)
+	}
+
+	rr := httptest.NewRecorder()
+	reg.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), `docpdf_access_denied_total{policy="rate_limit",reason="rate_limited"} 1`) {
+		t.Error("denial not counted")
+	}
+}
+
+func TestAudit_AdminToken(t *testing.T) {
+	log := audit.NewLog(10)
+	buf := captureLog(t)
+	h := middleware.RequestID(middleware.Logging(middleware.Audit(log, metrics.New(),
+		middleware.AdminToken("t0ken", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/denials", nil)
+	req.Header.Set("Authorization", "Bearer guess")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	recs := log.List(audit.Filter{Policy: audit.PolicyAdminToken})
+	if len(recs) != 1 || recs[0].Reason != audit.ReasonInvalidAdminToken || recs[0].Status != http.StatusUnauthorized {
+		t.Fatalf("records %+v", recs)
+	}
+	if !strings.Contains(buf.String(), `"denial_reason":"invalid_admin_token"`) {
+		t.Errorf("log line does not name the denial: %s", buf)
+	}
+}
+
+func TestAudit_NothingDenied(t *testing.T) {
+	log := audit.NewLog(10)
+	h := middleware.RequestID(middleware.Audit(log, metrics.New(),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadRequest) })))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/convert", nil))
+	if recs := log.List(audit.Filter{}); len(recs) != 0 {
+		t.Errorf("a failed request that no policy denied was audited: %+v", recs)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/BRO3886/go-docpdf/internal/capture"
+)
+
+// Capture is middleware that keeps, in rec, the requests of the clients an
+// admin armed a capture for: the client set with SetClient, the tenant set
+// with SetTenant or else sent in X-Tenant-ID. Only requests with a body are
+// captured. The request is served as it would be otherwise. It must run
+// inside RequestID and the authentication that sets the client.
+func Capture(rec *capture.Recorder, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s, _ := r.Context().Value(contextKey{}).(*requestState)
+		var id, client, tenant string
+		if s != nil {
+			id, client, tenant = s.id, s.client, s.tenant
+		}
+		if tenant == "" && client == "" {
+			tenant = r.Header.Get("X-Tenant-ID")
+		}
+		body, done, ok := rec.Start(r, id, client, tenant)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rr := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		r.Body = body
+		defer func() { done(rr.finalStatus()) }()
+		next.ServeHTTP(rr, r)
+	})
+}
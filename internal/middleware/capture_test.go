@@ -0,0 +1,60 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/capture"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func TestCapture_KeepsArmedRequest(t *testing.T) {
+	rec, err := capture.New(capture.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Arm(capture.Target{Tenant: "acme"}, 1, time.Now())
+	var seen string
+	h := middleware.RequestID(middleware.Capture(rec, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		seen = string(b)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/convert", strings.NewReader("payload"))
+		req.Header.Set("X-Request-ID", "req-1")
+		req.Header.Set("X-Tenant-ID", "acme")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != "payload" {
+			t.Fatalf("handler read %q", seen)
+		}
+	}
+
+	caps := rec.List(capture.Target{})
+	if len(caps) != 1 {
+		t.Fatalf("expected the armed request only, got %+v", caps)
+	}
+	if c := caps[0]; c.RequestID != "req-1" || c.Tenant != "acme" || c.Status != http.StatusUnprocessableEntity || c.Size != 7 || !c.Complete {
+		t.Errorf("capture %+v", c)
+	}
+}
+
+func TestCapture_SkipsBodiless(t *testing.T) {
+	rec, err := capture.New(capture.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Arm(capture.Target{Tenant: "acme"}, 1, time.Now())
+	h := middleware.Capture(rec, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/jobs/1", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if armed := rec.Armed(time.Now()); len(armed) != 1 || armed[0].Remaining != 1 {
+		t.Errorf("GET used the arming: %+v", armed)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+// unmatchedRoute is the path label of requests no route matched, so probing
+// for arbitrary paths adds no series.
+const unmatchedRoute = "unmatched"
+
+// knownMethods are the method label values; anything else is "OTHER".
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// HTTPMetrics is middleware that counts every request by route, method and
+// status code and records its latency. Unlike Metrics it wraps the whole
+// server, so /health, /metrics and error responses are visible too. The
+// route is the one Route recorded further in, or "unmatched". It must run
+// inside RequestID.
+func HTTPMetrics(reg *metrics.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route, traceID := unmatchedRoute, ""
+		if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil {
+			if s.route != "" {
+				route = s.route
+			}
+			traceID = s.traceID
+		}
+		method := r.Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+		reg.ObserveHTTP(route, method, rec.finalStatus(), time.Since(start), traceID)
+	})
+}
+
+// Route serves requests with mux, recording the pattern of the route that
+// serves each, without its method, for HTTPMetrics. It goes inside any
+// middleware that rewrites the path, so the pattern is that of the path the
+// mux sees, and inside tracing.Middleware: the ID of a sampled trace the
+// request is in is recorded too, as the exemplar of its latency.
+func Route(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil {
+			if sc := tracing.SpanFromContext(r.Context()).Context(); sc.Sampled && sc.IsValid() {
+				s.traceID = sc.TraceID.String()
+			}
+			if _, pattern := mux.Handler(r); pattern != "" {
+				if _, path, ok := strings.Cut(pattern, " "); ok {
+					pattern = path
+				}
+				s.route = pattern
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
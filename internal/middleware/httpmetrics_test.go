@@ -0,0 +1,97 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	reg := metrics.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("ok")) })
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNotFound) })
+	// Like handler.Versions, strip a prefix before the mux sees the path.
+	strip := http.StripPrefix("/v2", middleware.Route(mux))
+	h := middleware.RequestID(middleware.HTTPMetrics(reg, strip))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v2/health", nil),
+		httptest.NewRequest(http.MethodGet, "/v2/jobs/abc", nil),
+		httptest.NewRequest(http.MethodGet, "/v2/jobs/def", nil),
+		httptest.NewRequest(http.MethodGet, "/v2/wp-login.php", nil),
+		httptest.NewRequest("PROPFIND", "/v2/health", nil),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`docpdf_http_requests_total{code="200",method="GET",path="/health"} 1`,
+		`docpdf_http_requests_total{code="404",method="GET",path="/jobs/{id}"} 2`,
+		`docpdf_http_requests_total{code="404",method="GET",path="unmatched"} 1`,
+		`docpdf_http_requests_total{code="200",method="OTHER",path="/health"} 1`,
+		`docpdf_http_request_duration_seconds_count{method="GET",path="/jobs/{id}"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
+
+// nopExporter drops spans.
+type nopExporter struct{}
+
+func (nopExporter) Export(context.Context, []tracing.SpanData) error { return nil }
+
+func TestHTTPMetrics_Exemplars(t *testing.T) {
+	reg := metrics.New()
+	reg.EnableOpenMetrics()
+	tr := tracing.New(tracing.Config{Exporter: nopExporter{}})
+	defer tr.Close(context.Background())
+	mux := http.NewServeMux()
+	mux.Handle("/convert", middleware.Metrics(reg, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})))
+	h := middleware.RequestID(middleware.HTTPMetrics(reg, tracing.Middleware(tr, middleware.Route(mux))))
+
+	// The second trace is not sampled, so it is not exported and must not
+	// be linked.
+	for _, traceparent := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-0af7651916cd43dd8448eb211c80319c-00f067aa0ba902b7-00",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+		req.Header.Set("traceparent", traceparent)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	scrape := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	scrape.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	reg.ServeHTTP(w, scrape)
+	body := w.Body.String()
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("Content-Type %q, want OpenMetrics", w.Header().Get("Content-Type"))
+	}
+	for _, metric := range []string{"docpdf_http_request_duration_seconds_bucket", "docpdf_conversion_duration_ms_bucket"} {
+		found := false
+		for _, line := range strings.Split(body, "\n") {
+			if strings.HasPrefix(line, metric) && strings.Contains(line, `# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no exemplar on %s in:\n%s", metric, body)
+		}
+	}
+	if strings.Contains(body, "0af7651916cd43dd8448eb211c80319c") {
+		t.Error("unsampled trace used as an exemplar")
+	}
+}
@@ -1,16 +1,20 @@
 // Package middleware provides HTTP middleware for request tracing,
-// structured JSON logging, and Prometheus metrics collection.
+// structured logging, and Prometheus metrics collection.
 package middleware
 
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+	"github.com/BRO3886/go-docpdf/internal/logging"
 	"github.com/BRO3886/go-docpdf/internal/metrics"
 )
 
@@ -22,6 +26,12 @@ type requestState struct {
 	id       string
 	logError string
 	outcome  string
+	docType  string
+	client   string
+	tenant   string
+	route    string
+	traceID  string // of the sampled trace the request is in
+	denials  []audit.Denial
 }
 
 // RequestIDFromContext returns the request ID stored by RequestID middleware,
@@ -33,9 +43,9 @@ func RequestIDFromContext(ctx context.Context) string {
 	return ""
 }
 
-// SetOutcome records the conversion outcome ("success", "timeout", "failed")
-// on the context. It is a no-op when no state is present (e.g., in tests that
-// do not use the middleware).
+// SetOutcome records the conversion outcome ("success", "timeout", "failed",
+// "rejected", "slow_client", "bad_upload") on the context. It is a no-op when no state is
+// present (e.g., in tests that do not use the middleware).
 func SetOutcome(ctx context.Context, outcome string) {
 	if s, ok := ctx.Value(contextKey{}).(*requestState); ok && s != nil {
 		s.outcome = outcome
@@ -51,6 +61,33 @@ func SetLogError(ctx context.Context, reason string) {
 	}
 }
 
+// SetDocType records the detected input document type (e.g. "xlsx") so the
+// Logging and Metrics middleware can label the request with it. It is a no-op
+// when no state is present.
+func SetDocType(ctx context.Context, docType string) {
+	if s, ok := ctx.Value(contextKey{}).(*requestState); ok && s != nil {
+		s.docType = docType
+	}
+}
+
+// SetClient records the name of the authenticated client so the Logging and
+// Metrics middleware can label the request with it. It is a no-op when no
+// state is present.
+func SetClient(ctx context.Context, name string) {
+	if s, ok := ctx.Value(contextKey{}).(*requestState); ok && s != nil {
+		s.client = name
+	}
+}
+
+// SetTenant records the tenant an authenticated client's requests are made
+// for, so a denial is audited against it. It is a no-op when no state is
+// present.
+func SetTenant(ctx context.Context, tenant string) {
+	if s, ok := ctx.Value(contextKey{}).(*requestState); ok && s != nil {
+		s.tenant = tenant
+	}
+}
+
 // RequestID is middleware that ensures every request carries an X-Request-ID
 // header. If the incoming request already has one it is reused; otherwise a
 // new UUIDv4 is generated.
@@ -73,42 +110,91 @@ func RequestID(next http.Handler) http.Handler {
 type responseRecorder struct {
 	http.ResponseWriter
 	status int
+	wrote  bool // WriteHeader was called through the recorder
 }
 
 func (rr *responseRecorder) WriteHeader(code int) {
+	// 1xx informational responses (e.g. 103 Early Hints) are not the final
+	// status; pass them through without recording.
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		rr.ResponseWriter.WriteHeader(code)
+		return
+	}
 	rr.status = code
+	rr.wrote = true
 	rr.ResponseWriter.WriteHeader(code)
 }
 
-// Logging is middleware that emits one structured JSON log line to stderr
-// after each request completes, including request ID, method, path, status,
-// duration, and any error set via SetLogError.
-func Logging(next http.Handler) http.Handler {
+// Unwrap lets http.ResponseController reach the connection, for read and
+// write deadlines.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter { return rr.ResponseWriter }
+
+// finalStatus returns the response status. When nothing was written through
+// the recorder, as under Around, a status the wrapped writer tracks itself
+// takes precedence over the default.
+func (rr *responseRecorder) finalStatus() int {
+	if sw, ok := rr.ResponseWriter.(interface{ Status() int }); ok && !rr.wrote && sw.Status() != 0 {
+		return sw.Status()
+	}
+	return rr.status
+}
+
+// Logging is middleware that logs one line through slog.Default after each
+// request completes, with the request ID, method, path, status, duration,
+// and any error set via SetLogError. A 5xx is logged at error level, anything
+// else at info. The request's context carries a child logger with the request
+// ID for logging.FromContext.
+func Logging(next http.Handler) http.Handler { return logRequests(nil, next) }
+
+// LoggingTo returns Logging writing to l instead of slog.Default.
+func LoggingTo(l *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler { return logRequests(l, next) }
+}
+
+func logRequests(l *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		base := l
+		if base == nil {
+			base = slog.Default()
+		}
+		logger := base.With("request_id", RequestIDFromContext(r.Context()))
 		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(rec, r)
+		next.ServeHTTP(rec, r.WithContext(logging.NewContext(r.Context(), logger)))
 
-		durationMs := time.Since(start).Milliseconds()
-		fields := map[string]any{
-			"time":        time.Now().UTC().Format(time.RFC3339),
-			"request_id":  RequestIDFromContext(r.Context()),
-			"method":      r.Method,
-			"path":        r.URL.Path,
-			"status":      rec.status,
-			"duration_ms": durationMs,
+		status := rec.finalStatus()
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
 		}
-		if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil && s.logError != "" {
-			fields["error"] = s.logError
+		if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil {
+			if s.logError != "" {
+				attrs = append(attrs, slog.String("error", s.logError))
+			}
+			if s.docType != "" {
+				attrs = append(attrs, slog.String("doc_type", s.docType))
+			}
+			if s.client != "" {
+				attrs = append(attrs, slog.String("client", s.client))
+			}
+			if len(s.denials) > 0 {
+				d := s.denials[len(s.denials)-1]
+				attrs = append(attrs, slog.String("denied_by", d.Policy), slog.String("denial_reason", d.Reason))
+			}
 		}
-
-		line, _ := json.Marshal(fields)
-		fmt.Fprintf(os.Stderr, "%s\n", line)
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
 	})
 }
 
 // Metrics is middleware that records conversion metrics (in-flight gauge,
-// outcome counters, and duration histogram) for each request.
+// outcome, per-type and per-client counters, and duration histogram, with
+// the trace Route recorded as exemplar) for each request.
 // It should only wrap /convert, not /health or /metrics.
 func Metrics(reg *metrics.Registry, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -119,23 +205,69 @@ func Metrics(reg *metrics.Registry, next http.Handler) http.Handler {
 
 		durationMs := time.Since(start).Milliseconds()
 		reg.DecInFlight()
-		reg.ObserveDuration(durationMs)
 
 		outcome := "failed"
-		if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil && s.outcome != "" {
-			outcome = s.outcome
+		docType, client, traceID := "", "", ""
+		if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil {
+			if s.outcome != "" {
+				outcome = s.outcome
+			}
+			docType, client, traceID = s.docType, s.client, s.traceID
+		}
+		reg.ObserveDuration(durationMs, traceID)
+		reg.IncType(docType, outcome)
+		if client != "" {
+			reg.IncClient(client, outcome)
 		}
 		switch outcome {
 		case "success":
 			reg.IncSuccess()
 		case "timeout":
 			reg.IncTimeout()
+		case "rejected":
+			reg.IncRejected()
+		case "slow_client":
+			reg.IncSlowClient()
+		case "bad_upload":
+			reg.IncBadUpload()
 		default:
 			reg.IncFailed()
 		}
 	})
 }
 
+// Timeout is middleware that gives each request a deadline of d from when it
+// arrives. Handlers pass the request context to the converter, so a
+// conversion still running at the deadline, or when the client disconnects,
+// is aborted and its LibreOffice process killed.
+func Timeout(d time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AdminToken is middleware that only lets through requests carrying
+// "Authorization: Bearer <token>". Others get 401 with a JSON error body.
+func AdminToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			SetLogError(r.Context(), "admin token rejected")
+			Deny(r.Context(), audit.Denial{Status: http.StatusUnauthorized, Policy: audit.PolicyAdminToken, Reason: audit.ReasonInvalidAdminToken})
+			msg := i18n.Localize(w, r, "unauthorized")
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // newUUID generates a random UUIDv4 string.
 func newUUID() string {
 	var b [16]byte
@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/BRO3886/go-docpdf/internal/logging"
 	"github.com/BRO3886/go-docpdf/internal/metrics"
 	"github.com/BRO3886/go-docpdf/internal/middleware"
 )
@@ -72,17 +74,14 @@ func TestRequestIDFromContext_NoState(t *testing.T) {
 // ---------- Logging ----------
 
 func TestLogging_EmitsJSON(t *testing.T) {
-	// Redirect stderr to a buffer by capturing through the recorder pattern.
-	// We use a pipe-based approach: wrap the inner handler so we can inspect
-	// what Logging writes to stderr by capturing the log output indirectly.
-	// Since Logging writes to os.Stderr directly, we verify indirectly that
-	// the handler completes successfully and returns the right status.
+	var buf bytes.Buffer
+	logger := logging.New(logging.Config{Writer: &buf})
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
 	// Chain: RequestID → Logging so request state exists on context.
-	handler := middleware.RequestID(middleware.Logging(inner))
+	handler := middleware.RequestID(middleware.LoggingTo(logger)(inner))
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	req.Header.Set("X-Request-ID", "test-log-id")
 	w := httptest.NewRecorder()
@@ -91,6 +90,38 @@ func TestLogging_EmitsJSON(t *testing.T) {
 	if w.Code != http.StatusNoContent {
 		t.Errorf("expected 204, got %d", w.Code)
 	}
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v\nline: %s", err, buf.String())
+	}
+	if entry["level"] != "info" || entry["msg"] != "request" {
+		t.Errorf("level, msg = %v, %v; want info, request", entry["level"], entry["msg"])
+	}
+}
+
+func TestLogging_RequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(logging.Config{Writer: &buf, Format: logging.FormatText})
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Warn("converter restarted")
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	handler := middleware.RequestID(middleware.LoggingTo(logger)(inner))
+	req := httptest.NewRequest(http.MethodGet, "/convert", nil)
+	req.Header.Set("X-Request-ID", "child-id")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], "level=warn") || !strings.Contains(lines[0], "request_id=child-id") {
+		t.Errorf("handler's line lacks the request ID: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "level=error") || !strings.Contains(lines[1], "status=502") {
+		t.Errorf("a 5xx should be logged at error level: %s", lines[1])
+	}
 }
 
 // ---------- SetOutcome / SetLogError ----------
@@ -128,6 +159,27 @@ func TestMetrics_IncrementsSuccess(t *testing.T) {
 	}
 }
 
+func TestMetrics_LabelsDocType(t *testing.T) {
+	reg := metrics.New()
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetDocType(r.Context(), "xlsx")
+		middleware.SetOutcome(r.Context(), "success")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := middleware.RequestID(middleware.Metrics(reg, inner))
+	req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	mw := httptest.NewRecorder()
+	reg.ServeHTTP(mw, httptest.NewRequest("GET", "/metrics", nil))
+	body := mw.Body.String()
+
+	if !strings.Contains(body, `docpdf_conversions_by_type_total{outcome="success",type="xlsx"} 1`) {
+		t.Errorf("expected xlsx success=1, got:\n%s", body)
+	}
+}
+
 func TestMetrics_IncrementsTimeout(t *testing.T) {
 	reg := metrics.New()
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -226,7 +278,7 @@ type logEntry struct {
 }
 
 func TestLogging_JSONFields(t *testing.T) {
-	old, flush := captureStderr(t)
+	logs := captureLog(t)
 
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		middleware.SetLogError(r.Context(), "test error")
@@ -239,9 +291,7 @@ func TestLogging_JSONFields(t *testing.T) {
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
-	// Restore stderr first, then flush the pipe so the goroutine can drain.
-	restoreStderr(t, old)
-	line := flush()
+	line := logs.String()
 
 	var entry logEntry
 	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &entry); err != nil {
@@ -263,3 +313,55 @@ func TestLogging_JSONFields(t *testing.T) {
 		t.Errorf("expected error field 'test error', got %q", entry.ErrorField)
 	}
 }
+
+// ---------- AdminToken ----------
+
+func TestAdminToken(t *testing.T) {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := middleware.AdminToken("tok", inner)
+
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{"Bearer tok", http.StatusNoContent},
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"tok", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("Authorization %q: expected %d, got %d", tc.auth, tc.want, rr.Code)
+		}
+		if tc.want == http.StatusUnauthorized && !strings.Contains(rr.Body.String(), `"error"`) {
+			t.Errorf("expected JSON error body, got %s", rr.Body.String())
+		}
+	}
+}
+
+// ---------- Timeout ----------
+
+func TestTimeout_SetsDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	h := middleware.Timeout(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/convert", nil))
+
+	if !ok {
+		t.Fatal("expected a deadline on the request context")
+	}
+	if d := deadline.Sub(start); d < 59*time.Second || d > time.Minute+time.Second {
+		t.Errorf("deadline %v from start, want about 1m", d)
+	}
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/audit"
+	"github.com/BRO3886/go-docpdf/internal/i18n"
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+)
+
+// RateLimiter is a set of token buckets, one per client. Each bucket holds up
+// to burst tokens and refills at perMinute tokens a minute; a request spends
+// one token. The buckets are kept in memory, or in a BucketStore shared by
+// every replica (see Share).
+type RateLimiter struct {
+	perMinute int
+	rate      float64 // tokens per second
+	burst     float64
+	now       func() time.Time
+	store     BucketStore
+	onError   func(error)
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// BucketStore keeps token buckets outside the process, such as in Redis, so
+// that replicas sharing it draw from one bucket per client.
+type BucketStore interface {
+	// Take spends a token from key's bucket, which holds up to burst
+	// tokens and refills at rate tokens a second. It reports whether there
+	// was one, and the tokens left.
+	Take(ctx context.Context, key string, rate, burst float64) (bool, float64, error)
+	// Peek returns the tokens in key's bucket without spending any.
+	Peek(ctx context.Context, key string, rate, burst float64) (float64, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing perMinute requests a minute
+// per client, with bursts of up to burst requests (min 1).
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		perMinute: perMinute,
+		rate:      float64(perMinute) / 60,
+		burst:     float64(max(burst, 1)),
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+// Share keeps l's buckets in store, so that a horizontally scaled fleet
+// enforces one limit per client rather than one per replica. When store
+// fails, the request is limited by the replica's own bucket instead and
+// onError, if set, is called with the error.
+func (l *RateLimiter) Share(store BucketStore, onError func(error)) {
+	l.store, l.onError = store, onError
+}
+
+// PerMinute returns the requests a client may make per minute.
+func (l *RateLimiter) PerMinute() int { return l.perMinute }
+
+// Burst returns the requests a client may make in a burst.
+func (l *RateLimiter) Burst() int { return int(l.burst) }
+
+// Remaining returns how many requests r's client, identified as by
+// RateLimit, could make right now without being limited. It spends nothing.
+func (l *RateLimiter) Remaining(r *http.Request) int {
+	key, _ := clientKey(r)
+	if l.store != nil {
+		tokens, err := l.store.Peek(r.Context(), key, l.rate, l.burst)
+		if err == nil {
+			return int(tokens)
+		}
+		l.storeFailed(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		return int(l.burst)
+	}
+	return int(math.Min(l.burst, b.tokens+l.now().Sub(b.last).Seconds()*l.rate))
+}
+
+// Allow spends a token from key's bucket. When the bucket is empty it returns
+// false and how long until a token is available. ctx bounds the call to the
+// shared store, if any.
+func (l *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration) {
+	if l.store != nil {
+		ok, tokens, err := l.store.Take(ctx, key, l.rate, l.burst)
+		if err == nil {
+			if ok {
+				return true, 0
+			}
+			return false, time.Duration((1 - tokens) / l.rate * float64(time.Second))
+		}
+		l.storeFailed(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweepLocked(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// storeFailed reports a failure of the shared store.
+func (l *RateLimiter) storeFailed(err error) {
+	if l.onError != nil {
+		l.onError(err)
+	}
+}
+
+// sweepLocked forgets buckets that have refilled completely, since a new
+// bucket starts full anyway. It runs at most once a minute.
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit is middleware that limits each client to l's rate. Clients are
+// identified by API key name when the request was authenticated (so it must
+// run after auth), otherwise by remote IP. Limited requests get 429 with
+// Retry-After and are counted in reg.
+func RateLimit(l *RateLimiter, reg *metrics.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, by := clientKey(r)
+		if ok, wait := l.Allow(r.Context(), key); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			reg.IncRateLimited(by)
+			SetOutcome(r.Context(), "rejected")
+			SetLogError(r.Context(), "rate limited")
+			Deny(r.Context(), audit.Denial{
+				Status: http.StatusTooManyRequests,
+				Policy: audit.PolicyRateLimit,
+				Reason: audit.ReasonRateLimited,
+				Quota:  &audit.Quota{PerMinute: l.perMinute, Burst: l.Burst(), RetryAfter: retryAfter, By: by},
+			})
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": i18n.Localize(w, r, "rate limit exceeded")})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey returns the bucket key of r's client and how it was identified:
+// by API key name ("key") once authenticated, else by remote IP ("ip").
+func clientKey(r *http.Request) (key, by string) {
+	if s, ok := r.Context().Value(contextKey{}).(*requestState); ok && s != nil && s.client != "" {
+		return "key:" + s.client, "key"
+	}
+	return "ip:" + remoteIP(r), "ip"
+}
+
+// remoteIP returns the host part of r.RemoteAddr.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,221 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+func TestRateLimiter_BurstThenRefill(t *testing.T) {
+	l := middleware.NewRateLimiter(6000, 2) // 100 tokens/s
+	for i := range 2 {
+		if ok, _ := l.Allow(context.Background(), "a"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+	ok, wait := l.Allow(context.Background(), "a")
+	if ok {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if wait <= 0 || wait > 10*time.Millisecond {
+		t.Errorf("unexpected wait %v", wait)
+	}
+	if ok, _ := l.Allow(context.Background(), "b"); !ok {
+		t.Error("other clients must have their own bucket")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if ok, _ := l.Allow(context.Background(), "a"); !ok {
+		t.Error("bucket did not refill")
+	}
+}
+
+func TestRateLimit_Returns429(t *testing.T) {
+	reg := metrics.New()
+	h := middleware.RequestID(middleware.RateLimit(middleware.NewRateLimiter(1, 1), reg,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	send := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := send("10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Fatalf("first request: got %d", rr.Code)
+	}
+	// Same IP, different port: same client.
+	rr := send("10.0.0.1:5678")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if ra := rr.Header().Get("Retry-After"); ra != "60" {
+		t.Errorf("expected Retry-After 60, got %q", ra)
+	}
+	if !strings.Contains(rr.Body.String(), `"error"`) {
+		t.Errorf("expected JSON error, got %s", rr.Body.String())
+	}
+	if rr := send("10.0.0.2:1234"); rr.Code != http.StatusOK {
+		t.Errorf("other IP was limited: %d", rr.Code)
+	}
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `docpdf_rate_limited_total{by="ip"} 1`) {
+		t.Errorf("expected rate limited count, got:\n%s", w.Body.String())
+	}
+}
+
+func TestRateLimit_KeysByClientName(t *testing.T) {
+	reg := metrics.New()
+	limited := middleware.RateLimit(middleware.NewRateLimiter(1, 1), reg,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// Stand-in for the auth middleware, which records the key name.
+	h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetClient(r.Context(), r.Header.Get("X-Client"))
+		limited.ServeHTTP(w, r)
+	}))
+
+	send := func(client string) int {
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/convert", nil)
+		req.Header.Set("X-Client", client)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := send("team-a"); code != http.StatusOK {
+		t.Fatalf("first request: got %d", code)
+	}
+	// Same IP, different key: separate bucket.
+	if code := send("team-b"); code != http.StatusOK {
+		t.Errorf("team-b limited by team-a's usage: %d", code)
+	}
+	if code := send("team-a"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for team-a, got %d", code)
+	}
+}
+
+func TestRateLimiter_Remaining(t *testing.T) {
+	l := middleware.NewRateLimiter(60, 3)
+	if l.PerMinute() != 60 || l.Burst() != 3 {
+		t.Fatalf("PerMinute, Burst = %d, %d", l.PerMinute(), l.Burst())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/limits", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	if got := l.Remaining(req); got != 3 {
+		t.Errorf("new client: Remaining = %d, want 3", got)
+	}
+	h := middleware.RateLimit(l, metrics.New(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 2 {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if got := l.Remaining(req); got != 1 {
+		t.Errorf("after 2 requests: Remaining = %d, want 1", got)
+	}
+	if got := l.Remaining(req); got != 1 {
+		t.Errorf("Remaining spent a token: %d", got)
+	}
+}
+
+// sharedBuckets is a BucketStore standing in for Redis: one bucket per key,
+// shared by every limiter given it, that never refills.
+type sharedBuckets struct {
+	tokens map[string]float64
+	err    error
+	ctx    context.Context // of the last Take
+}
+
+func (s *sharedBuckets) Take(ctx context.Context, key string, _, burst float64) (bool, float64, error) {
+	s.ctx = ctx
+	if s.err != nil {
+		return false, 0, s.err
+	}
+	t, ok := s.tokens[key]
+	if !ok {
+		t = burst
+	}
+	if t < 1 {
+		return false, t, nil
+	}
+	s.tokens[key] = t - 1
+	return true, t - 1, nil
+}
+
+func (s *sharedBuckets) Peek(_ context.Context, key string, _, burst float64) (float64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if t, ok := s.tokens[key]; ok {
+		return t, nil
+	}
+	return burst, nil
+}
+
+func TestRateLimiter_Shared(t *testing.T) {
+	store := &sharedBuckets{tokens: map[string]float64{}}
+	var replicas []*middleware.RateLimiter
+	for range 2 {
+		l := middleware.NewRateLimiter(60, 2)
+		l.Share(store, nil)
+		replicas = append(replicas, l)
+	}
+	// Two replicas allow two requests between them, not two each.
+	for i, l := range replicas {
+		if ok, _ := l.Allow(context.Background(), "key:acme"); !ok {
+			t.Fatalf("request %d within the shared burst was limited", i+1)
+		}
+	}
+	ok, wait := replicas[0].Allow(context.Background(), "key:acme")
+	if ok {
+		t.Fatal("request beyond the shared burst was allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %v, want the 1s to the next token", wait)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/limits", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	store.tokens["ip:10.0.0.1"] = 1
+	if got := replicas[1].Remaining(req); got != 1 {
+		t.Errorf("Remaining = %d, want the shared bucket's 1", got)
+	}
+}
+
+func TestRateLimiter_SharedStoreDown(t *testing.T) {
+	store := &sharedBuckets{err: errors.New("redis: connection refused")}
+	var failures int
+	l := middleware.NewRateLimiter(60, 1)
+	l.Share(store, func(error) { failures++ })
+
+	// The replica's own bucket limits while the store is down.
+	if ok, _ := l.Allow(context.Background(), "key:acme"); !ok {
+		t.Fatal("first request limited")
+	}
+	if ok, _ := l.Allow(context.Background(), "key:acme"); ok {
+		t.Error("local fallback did not limit")
+	}
+	if failures != 2 {
+		t.Errorf("onError called %d times, want 2", failures)
+	}
+}
+
+func TestRateLimit_SharedStoreGetsRequestContext(t *testing.T) {
+	store := &sharedBuckets{tokens: map[string]float64{}}
+	l := middleware.NewRateLimiter(60, 1)
+	l.Share(store, nil)
+	h := middleware.RateLimit(l, metrics.New(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/convert", nil).WithContext(ctx)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if store.ctx == nil || store.ctx.Err() == nil {
+		t.Error("the store was not called with the request's context")
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+)
+
+// slowChunk is the largest piece a response write is split into, so progress
+// on a large result is visible while the client is still reading it.
+const slowChunk = 32 << 10
+
+// MinThroughput is middleware that aborts transfers slower than minRate bytes
+// per second, measured over window. It only judges a direction while the
+// handler is waiting on the client, i.e. blocked reading the upload or
+// writing the response, so time spent converting never counts against the
+// client. A slow upload gets its read deadline expired, which the handler
+// answers with 408; a slow download has its write deadline expired, cutting
+// the connection. Either way the outcome becomes "slow_client" and
+// docpdf_slow_clients_total is incremented.
+func MinThroughput(minRate int, window time.Duration, reg *metrics.Registry, next http.Handler) http.Handler {
+	minBytes := int64(float64(minRate) * window.Seconds())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		up := &transfer{}
+		down := &transfer{}
+		body := &meteredBody{ReadCloser: r.Body, t: up}
+		r.Body = body
+		mw := &meteredWriter{ResponseWriter: w, t: down}
+
+		var tripped string // set by the monitor before it exits
+		done, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			tick := time.NewTicker(window)
+			defer tick.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case now := <-tick.C:
+					switch {
+					case up.stalled(now, window, minBytes):
+						_ = rc.SetReadDeadline(now)
+						tripped = "upload"
+						return
+					case down.stalled(now, window, minBytes):
+						_ = rc.SetWriteDeadline(now)
+						tripped = "download"
+						return
+					}
+				}
+			}
+		}()
+
+		next.ServeHTTP(mw, r)
+		close(done)
+		<-exited
+
+		if tripped != "" {
+			if reg != nil {
+				reg.IncSlowTransfer(tripped)
+			}
+			SetOutcome(r.Context(), "slow_client")
+			SetLogError(r.Context(), tripped+" below minimum throughput")
+		}
+	})
+}
+
+// transfer tracks progress in one direction of a request.
+type transfer struct {
+	mu      sync.Mutex
+	started time.Time // first read or write
+	pending int       // calls currently blocked on the client
+	n       int64     // bytes moved since the last check
+}
+
+func (t *transfer) begin() {
+	t.mu.Lock()
+	if t.started.IsZero() {
+		t.started = time.Now()
+	}
+	t.pending++
+	t.mu.Unlock()
+}
+
+func (t *transfer) end(n int) {
+	t.mu.Lock()
+	t.pending--
+	t.n += int64(n)
+	t.mu.Unlock()
+}
+
+// stalled reports whether the handler is waiting on the client right now and
+// fewer than minBytes moved in the window just ended. Transfers younger than
+// a window are not judged. It resets the byte count for the next window.
+func (t *transfer) stalled(now time.Time, window time.Duration, minBytes int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.n
+	t.n = 0
+	return t.pending > 0 && now.Sub(t.started) >= window && n < minBytes
+}
+
+// meteredBody counts the upload as the handler reads it.
+type meteredBody struct {
+	io.ReadCloser
+	t *transfer
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	b.t.begin()
+	n, err := b.ReadCloser.Read(p)
+	b.t.end(n)
+	return n, err
+}
+
+// meteredWriter counts the response as it is written, in slowChunk pieces.
+type meteredWriter struct {
+	http.ResponseWriter
+	t *transfer
+}
+
+func (w *meteredWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), slowChunk)]
+		w.t.begin()
+		n, err := w.ResponseWriter.Write(chunk)
+		w.t.end(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *meteredWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
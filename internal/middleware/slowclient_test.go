@@ -0,0 +1,130 @@
+package middleware_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/metrics"
+	"github.com/BRO3886/go-docpdf/internal/middleware"
+)
+
+// slowServer serves h behind MinThroughput (1 KB/s over 100ms) and the
+// Metrics middleware, and reports when h returns.
+func slowServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *metrics.Registry, <-chan struct{}) {
+	t.Helper()
+	reg := metrics.New()
+	returned := make(chan struct{}, 1)
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { returned <- struct{}{} }()
+		h(w, r)
+	})
+	srv := httptest.NewServer(middleware.RequestID(middleware.Metrics(reg,
+		middleware.MinThroughput(1024, 100*time.Millisecond, reg, inner))))
+	t.Cleanup(srv.Close)
+	return srv, reg, returned
+}
+
+func metricsBody(reg *metrics.Registry) string {
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestMinThroughput_StalledUpload(t *testing.T) {
+	srv, reg, returned := slowServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		middleware.SetOutcome(r.Context(), "success")
+	})
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() { _, _ = pw.Write([]byte("a few bytes, then nothing")) }()
+
+	resp, err := http.Post(srv.URL, "application/octet-stream", pr)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	<-returned
+
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expected 408, got %d", resp.StatusCode)
+	}
+	body := metricsBody(reg)
+	for _, want := range []string{
+		`docpdf_conversions_total{outcome="slow_client"} 1`,
+		`docpdf_slow_clients_total{direction="upload"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestMinThroughput_IgnoresServerWork(t *testing.T) {
+	srv, reg, returned := slowServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		time.Sleep(350 * time.Millisecond) // converting: not the client's fault
+		middleware.SetOutcome(r.Context(), "success")
+		_, _ = w.Write([]byte("%PDF"))
+	})
+
+	resp, err := http.Post(srv.URL, "application/octet-stream", strings.NewReader("document"))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	<-returned
+
+	if resp.StatusCode != http.StatusOK || string(got) != "%PDF" {
+		t.Errorf("got %d %q, want 200 %%PDF", resp.StatusCode, got)
+	}
+	if want := `docpdf_conversions_total{outcome="success"} 1`; !strings.Contains(metricsBody(reg), want) {
+		t.Errorf("missing %q", want)
+	}
+}
+
+func TestMinThroughput_StalledDownload(t *testing.T) {
+	writeErr := make(chan error, 1)
+	srv, reg, returned := slowServer(t, func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetOutcome(r.Context(), "success")
+		// Far more than the socket buffers hold, so writing blocks once the
+		// client stops reading.
+		_, err := w.Write(bytes.Repeat([]byte("x"), 64<<20))
+		writeErr <- err
+	})
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	// Never read the body.
+	select {
+	case <-returned:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler still writing to a stalled client")
+	}
+
+	if err := <-writeErr; err == nil {
+		t.Error("write to a stalled client succeeded")
+	}
+	body := metricsBody(reg)
+	for _, want := range []string{
+		`docpdf_conversions_total{outcome="slow_client"} 1`,
+		`docpdf_slow_clients_total{direction="download"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package outbox makes event publication reliable: events are written to a
+// Store when they happen and a dispatcher goroutine publishes them, retrying
+// with backoff, so an event is not lost when its destination is down at the
+// moment it is produced.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event is one pending publication.
+type Event struct {
+	ID string `json:"id"`
+	// Kind names the event, e.g. "job.succeeded".
+	Kind string `json:"kind"`
+	// Key identifies the subject, e.g. the job ID.
+	Key string `json:"key"`
+	// Target is the destination, e.g. a webhook callback URL.
+	Target    string    `json:"target"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+	Attempts  int       `json:"attempts"`
+	// NextAt is when the next publish attempt is due.
+	NextAt time.Time `json:"next_at"`
+	// Traceparent is the W3C traceparent of the work that produced the
+	// event, for the publisher to continue its trace.
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// Publisher delivers an event to its destination. A nil error acknowledges
+// the event, removing it from the outbox.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(ctx context.Context, e Event) error
+
+// Publish implements Publisher.
+func (f PublisherFunc) Publish(ctx context.Context, e Event) error { return f(ctx, e) }
+
+// Observer is notified after every dispatch pass.
+type Observer interface {
+	// OutboxLag reports the number of pending events and the age of the
+	// oldest (0 when empty).
+	OutboxLag(pending int, oldest time.Duration)
+	// OutboxDropped is called for each event given up on after MaxAttempts.
+	OutboxDropped()
+}
+
+// Config configures an Outbox.
+type Config struct {
+	// Store persists pending events. Defaults to a MemoryStore.
+	Store Store
+	// Publisher delivers events. Required.
+	Publisher Publisher
+	// Interval is how often due events are retried (default 1s). New events
+	// are dispatched immediately.
+	Interval time.Duration
+	// MaxAttempts before an event is dropped (default 20).
+	MaxAttempts int
+	// Backoff after the first failure, doubled per attempt up to MaxBackoff
+	// (defaults 1s and 5m).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Observer, if set, receives lag and drop notifications (e.g. metrics).
+	Observer Observer
+	// OnDrop, if set, is called with each event that is given up on.
+	OnDrop func(Event)
+}
+
+// FlushResult summarises a Flush.
+type FlushResult struct {
+	Published int `json:"published"`
+	Failed    int `json:"failed"`
+	Pending   int `json:"pending"`
+}
+
+// Outbox stores events and dispatches them in the background.
+type Outbox struct {
+	cfg Config
+
+	// pass serialises dispatch passes so an event is never published twice
+	// concurrently.
+	pass sync.Mutex
+	kick chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New starts an Outbox. Events left in cfg.Store from a previous run are
+// dispatched straight away. Call Close to stop it.
+func New(cfg Config) *Outbox {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 20
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &Outbox{
+		cfg:    cfg,
+		kick:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go o.loop()
+	return o
+}
+
+// Add stores e for publication. ID, CreatedAt and NextAt are assigned when
+// unset. Once Add returns, the event survives as long as the Store does.
+func (o *Outbox) Add(e Event) error {
+	now := time.Now().UTC()
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now
+	}
+	e.NextAt = now
+	if err := o.cfg.Store.Put(e); err != nil {
+		return err
+	}
+	o.wake()
+	return nil
+}
+
+// Flush attempts every pending event now, ignoring backoff, and returns once
+// the pass is complete.
+func (o *Outbox) Flush(ctx context.Context) (FlushResult, error) {
+	return o.dispatch(ctx, true)
+}
+
+// Close stops the dispatcher. Pending events stay in the Store.
+func (o *Outbox) Close() {
+	o.cancel()
+	<-o.done
+}
+
+func (o *Outbox) wake() {
+	select {
+	case o.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) loop() {
+	defer close(o.done)
+	// Events left from a previous run were waiting on a backoff computed
+	// before the restart; try them straight away.
+	_, _ = o.dispatch(o.ctx, true)
+
+	ticker := time.NewTicker(o.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.kick:
+		}
+		_, _ = o.dispatch(o.ctx, false)
+	}
+}
+
+// dispatch publishes due events (all events when force is set), oldest
+// first.
+func (o *Outbox) dispatch(ctx context.Context, force bool) (FlushResult, error) {
+	o.pass.Lock()
+	defer o.pass.Unlock()
+
+	var res FlushResult
+	events, err := o.cfg.Store.List()
+	if err != nil {
+		return res, err
+	}
+	for _, e := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		if !force && time.Now().Before(e.NextAt) {
+			continue
+		}
+		if err := o.cfg.Publisher.Publish(ctx, e); err == nil {
+			_ = o.cfg.Store.Delete(e.ID)
+			res.Published++
+			continue
+		}
+		res.Failed++
+		e.Attempts++
+		if e.Attempts >= o.cfg.MaxAttempts {
+			_ = o.cfg.Store.Delete(e.ID)
+			if o.cfg.Observer != nil {
+				o.cfg.Observer.OutboxDropped()
+			}
+			if o.cfg.OnDrop != nil {
+				o.cfg.OnDrop(e)
+			}
+			continue
+		}
+		e.NextAt = time.Now().UTC().Add(o.backoff(e.Attempts))
+		_ = o.cfg.Store.Put(e)
+	}
+
+	pending, lag := o.lag()
+	res.Pending = pending
+	if o.cfg.Observer != nil {
+		o.cfg.Observer.OutboxLag(pending, lag)
+	}
+	return res, nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.cfg.Backoff
+	for range attempts - 1 {
+		d *= 2
+		if d >= o.cfg.MaxBackoff {
+			return o.cfg.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (o *Outbox) lag() (int, time.Duration) {
+	events, err := o.cfg.Store.List()
+	if err != nil || len(events) == 0 {
+		return 0, 0
+	}
+	return len(events), time.Since(events[0].CreatedAt)
+}
+
+// newID returns a random 128-bit hex event ID.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
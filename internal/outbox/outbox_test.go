@@ -0,0 +1,198 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/outbox"
+)
+
+// recorder is an outbox.Observer that keeps the latest lag report.
+type recorder struct {
+	mu      sync.Mutex
+	pending int
+	dropped int
+}
+
+func (r *recorder) OutboxLag(pending int, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = pending
+}
+
+func (r *recorder) OutboxDropped() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped++
+}
+
+func (r *recorder) snapshot() (pending, dropped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending, r.dropped
+}
+
+// publisher records published event IDs and fails while down is set.
+type publisher struct {
+	down      atomic.Bool
+	attempts  atomic.Int32
+	published chan string
+}
+
+func newPublisher() *publisher { return &publisher{published: make(chan string, 16)} }
+
+func (p *publisher) Publish(_ context.Context, e outbox.Event) error {
+	p.attempts.Add(1)
+	if p.down.Load() {
+		return errors.New("broker down")
+	}
+	p.published <- e.ID
+	return nil
+}
+
+func waitPublished(t *testing.T, p *publisher) string {
+	t.Helper()
+	select {
+	case id := <-p.published:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not published")
+		return ""
+	}
+}
+
+func TestAdd_PublishesImmediately(t *testing.T) {
+	pub := newPublisher()
+	obs := &recorder{}
+	o := outbox.New(outbox.Config{Publisher: pub, Interval: time.Hour, Observer: obs})
+	defer o.Close()
+
+	if err := o.Add(outbox.Event{ID: "e1", Kind: "job.succeeded"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if id := waitPublished(t, pub); id != "e1" {
+		t.Errorf("expected e1, got %q", id)
+	}
+}
+
+func TestRetryUntilPublished(t *testing.T) {
+	pub := newPublisher()
+	pub.down.Store(true)
+	o := outbox.New(outbox.Config{Publisher: pub, Interval: 5 * time.Millisecond, Backoff: time.Millisecond})
+	defer o.Close()
+
+	_ = o.Add(outbox.Event{ID: "e1"})
+	deadline := time.Now().Add(2 * time.Second)
+	for pub.attempts.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("event was not retried")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	pub.down.Store(false)
+	waitPublished(t, pub)
+}
+
+func TestDropAfterMaxAttempts(t *testing.T) {
+	pub := newPublisher()
+	pub.down.Store(true)
+	obs := &recorder{}
+	dropped := make(chan outbox.Event, 1)
+	o := outbox.New(outbox.Config{
+		Publisher:   pub,
+		Interval:    time.Millisecond,
+		Backoff:     time.Millisecond,
+		MaxAttempts: 2,
+		Observer:    obs,
+		OnDrop:      func(e outbox.Event) { dropped <- e },
+	})
+	defer o.Close()
+
+	_ = o.Add(outbox.Event{ID: "e1"})
+	select {
+	case e := <-dropped:
+		if e.ID != "e1" || e.Attempts != 2 {
+			t.Errorf("unexpected dropped event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not dropped")
+	}
+	if _, n := obs.snapshot(); n != 1 {
+		t.Errorf("expected 1 drop observed, got %d", n)
+	}
+}
+
+func TestFlushIgnoresBackoff(t *testing.T) {
+	pub := newPublisher()
+	pub.down.Store(true)
+	obs := &recorder{}
+	o := outbox.New(outbox.Config{Publisher: pub, Interval: time.Hour, Backoff: time.Hour, Observer: obs})
+	defer o.Close()
+	_ = o.Add(outbox.Event{ID: "e1"})
+
+	res, err := o.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if res.Pending != 1 {
+		t.Errorf("expected 1 pending while down, got %+v", res)
+	}
+	if pending, _ := obs.snapshot(); pending != 1 {
+		t.Errorf("expected observer to report 1 pending, got %d", pending)
+	}
+
+	pub.down.Store(false)
+	res, _ = o.Flush(context.Background())
+	if res.Published != 1 || res.Pending != 0 {
+		t.Errorf("expected flush to publish despite backoff, got %+v", res)
+	}
+}
+
+func TestFileStore_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := outbox.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	down := newPublisher()
+	down.down.Store(true)
+	o := outbox.New(outbox.Config{Store: store, Publisher: down, Interval: time.Hour, Backoff: time.Hour})
+	_ = o.Add(outbox.Event{ID: "e1", Kind: "job.failed", Payload: []byte(`{"x":1}`)})
+	_, _ = o.Flush(context.Background())
+	o.Close()
+
+	reopened, err := outbox.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	events, _ := reopened.List()
+	if len(events) != 1 || events[0].Kind != "job.failed" || string(events[0].Payload) != `{"x":1}` {
+		t.Fatalf("expected the pending event on disk, got %+v", events)
+	}
+
+	// Events left over from the previous run are dispatched on start.
+	up := newPublisher()
+	o = outbox.New(outbox.Config{Store: reopened, Publisher: up, Interval: time.Hour})
+	defer o.Close()
+	if id := waitPublished(t, up); id != "e1" {
+		t.Errorf("expected e1, got %q", id)
+	}
+}
+
+func TestMemoryStore_ListOldestFirst(t *testing.T) {
+	s := outbox.NewMemoryStore()
+	base := time.Now()
+	_ = s.Put(outbox.Event{ID: "b", CreatedAt: base.Add(time.Second)})
+	_ = s.Put(outbox.Event{ID: "a", CreatedAt: base})
+	_ = s.Delete("missing")
+
+	events, _ := s.List()
+	if len(events) != 2 || events[0].ID != "a" || events[1].ID != "b" {
+		t.Errorf("expected [a b], got %+v", events)
+	}
+}
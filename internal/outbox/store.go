@@ -0,0 +1,152 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store persists pending events. Implementations must be safe for concurrent
+// use and must store and return copies.
+type Store interface {
+	// Put creates or replaces the event with e.ID.
+	Put(e Event) error
+	// Delete removes the event. Deleting an unknown ID is not an error.
+	Delete(id string) error
+	// List returns every stored event, oldest first.
+	List() ([]Event, error)
+}
+
+// MemoryStore is an in-process Store. Pending events are lost on restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	events map[string]Event
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: make(map[string]Event)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[e.ID] = e
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.events, id)
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List() ([]Event, error) {
+	s.mu.RLock()
+	out := make([]Event, 0, len(s.events))
+	for _, e := range s.events {
+		out = append(out, e)
+	}
+	s.mu.RUnlock()
+	sortOldestFirst(out)
+	return out, nil
+}
+
+// FileStore is a Store keeping one JSON file per event in a directory, so
+// pending events survive restarts. Writes are atomic (temp file + rename).
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a FileStore in dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Put implements Store.
+func (s *FileStore) Put(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".event-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(e.ID))
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List implements Store. Unreadable files are skipped.
+func (s *FileStore) List() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Event
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			continue
+		}
+		var e Event
+		if json.Unmarshal(data, &e) != nil {
+			continue
+		}
+		out = append(out, e)
+	}
+	sortOldestFirst(out)
+	return out, nil
+}
+
+func sortOldestFirst(events []Event) {
+	sort.Slice(events, func(a, b int) bool { return events[a].CreatedAt.Before(events[b].CreatedAt) })
+}
@@ -0,0 +1,559 @@
+package pdfpost
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Document is a PDF open for editing. Objects are read from the original
+// bytes on demand, and may be from several goroutines at once; objects added
+// or replaced are kept aside and written out
+// by Bytes as an incremental update, unless the document is to be saved in
+// full.
+type Document struct {
+	data      []byte
+	xref      map[int]xrefEntry
+	trailer   dict
+	startxref int // offset of the newest cross-reference section
+	size      int // one more than the highest object number
+
+	workers int // pages a step works on at once
+
+	mu      sync.Mutex // guards cache, changed and size
+	cache   map[int]any
+	changed map[int]any
+	full    bool // save in full rather than as an incremental update
+}
+
+type xrefEntry struct {
+	offset int
+	gen    int
+}
+
+// Open reads the cross-reference tables and trailer of the PDF in data.
+// Only classic cross-reference tables are supported; LibreOffice writes
+// nothing else.
+func Open(data []byte) (*Document, error) {
+	d := &Document{
+		data:    data,
+		xref:    make(map[int]xrefEntry),
+		workers: runtime.GOMAXPROCS(0),
+		cache:   make(map[int]any),
+		changed: make(map[int]any),
+	}
+	tail := data[max(0, len(data)-1024):]
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no startxref", ErrUnsupported)
+	}
+	p := &parser{b: tail, pos: i + len("startxref")}
+	off, err := strconv.Atoi(p.keyword())
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad startxref", ErrUnsupported)
+	}
+	d.startxref = off
+
+	// Follow the chain of sections from the newest; an object's first entry
+	// seen is its current one.
+	seen := make(map[int]bool)
+	for {
+		if off < 0 || off >= len(data) || seen[off] {
+			return nil, fmt.Errorf("%w: bad cross-reference offset %d", ErrUnsupported, off)
+		}
+		seen[off] = true
+		trailer, err := d.readSection(off)
+		if err != nil {
+			return nil, err
+		}
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+		prev, ok := trailer["Prev"].(int)
+		if !ok {
+			break
+		}
+		off = prev
+	}
+	if _, ok := d.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+	size, ok := d.trailer["Size"].(int)
+	if !ok || size <= 0 {
+		return nil, fmt.Errorf("%w: trailer has no size", ErrUnsupported)
+	}
+	d.size = size
+	if _, ok := d.trailer["Root"].(ref); !ok {
+		return nil, fmt.Errorf("%w: trailer has no root", ErrUnsupported)
+	}
+	return d, nil
+}
+
+// readSection reads the cross-reference section at off and returns its
+// trailer.
+func (d *Document) readSection(off int) (dict, error) {
+	p := &parser{b: d.data, pos: off}
+	if p.keyword() != "xref" {
+		// A cross-reference stream, from PDF 1.5 on.
+		return nil, fmt.Errorf("%w: no cross-reference table at offset %d", ErrUnsupported, off)
+	}
+	for {
+		kw := p.keyword()
+		if kw == "trailer" {
+			break
+		}
+		first, err1 := strconv.Atoi(kw)
+		count, err2 := strconv.Atoi(p.keyword())
+		if err1 != nil || err2 != nil || first < 0 || count < 0 || count > len(d.data)/20 {
+			return nil, fmt.Errorf("%w: bad cross-reference subsection at offset %d", ErrUnsupported, p.pos)
+		}
+		for n := first; n < first+count; n++ {
+			offset, err1 := strconv.Atoi(p.keyword())
+			gen, err2 := strconv.Atoi(p.keyword())
+			kind := p.keyword()
+			if err1 != nil || err2 != nil || (kind != "n" && kind != "f") {
+				return nil, fmt.Errorf("%w: bad cross-reference entry at offset %d", ErrUnsupported, p.pos)
+			}
+			if _, ok := d.xref[n]; ok {
+				continue
+			}
+			if kind == "f" {
+				offset = -1
+			}
+			d.xref[n] = xrefEntry{offset, gen}
+		}
+	}
+	v, err := p.object(0)
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := v.(dict)
+	if !ok {
+		return nil, fmt.Errorf("%w: trailer is not a dictionary", ErrUnsupported)
+	}
+	return trailer, nil
+}
+
+// get returns object num, nil if it is missing or free.
+func (d *Document) get(num int) (any, error) {
+	return d.load(num, nil)
+}
+
+// load is get for an object needed to read the objects in via, which are
+// being loaded. Objects are parsed outside the lock; should two goroutines
+// parse the same one, the first to finish is kept.
+func (d *Document) load(num int, via []int) (any, error) {
+	d.mu.Lock()
+	if v, ok := d.changed[num]; ok {
+		d.mu.Unlock()
+		return v, nil
+	}
+	if v, ok := d.cache[num]; ok {
+		d.mu.Unlock()
+		return v, nil
+	}
+	d.mu.Unlock()
+	e, ok := d.xref[num]
+	if !ok || e.offset < 0 {
+		return nil, nil
+	}
+	if slices.Contains(via, num) {
+		return nil, fmt.Errorf("%w: object %d refers to itself", ErrUnsupported, num)
+	}
+
+	if e.offset >= len(d.data) {
+		return nil, fmt.Errorf("%w: object %d out of range", ErrUnsupported, num)
+	}
+	p := &parser{b: d.data, pos: e.offset}
+	if n, err := strconv.Atoi(p.keyword()); err != nil || n != num {
+		return nil, fmt.Errorf("%w: object %d not at its offset", ErrUnsupported, num)
+	}
+	p.keyword() // generation
+	if err := p.expect("obj"); err != nil {
+		return nil, err
+	}
+	v, err := p.object(0)
+	if err != nil {
+		return nil, err
+	}
+	if sd, ok := v.(dict); ok {
+		save := p.pos
+		if p.keyword() == "stream" {
+			if v, err = d.readStream(p, sd, append(via, num)); err != nil {
+				return nil, err
+			}
+		} else {
+			p.pos = save
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cached, ok := d.cache[num]; ok {
+		return cached, nil
+	}
+	d.cache[num] = v
+	return v, nil
+}
+
+// readStream reads the data of a stream whose dictionary sd the parser has
+// just read, along with the stream keyword, for the object at the end of
+// via.
+func (d *Document) readStream(p *parser, sd dict, via []int) (*stream, error) {
+	if bytes.HasPrefix(p.b[p.pos:], []byte("\r\n")) {
+		p.pos += 2
+	} else if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+		p.pos++
+	}
+	length := sd["Length"]
+	if r, ok := length.(ref); ok {
+		var err error
+		if length, err = d.load(r.num, via); err != nil {
+			return nil, err
+		}
+	}
+	n, ok := length.(int)
+	if !ok || n < 0 || p.pos+n > len(p.b) {
+		return nil, fmt.Errorf("%w: bad stream length at offset %d", ErrUnsupported, p.pos)
+	}
+	return &stream{dict: sd, data: p.b[p.pos : p.pos+n]}, nil
+}
+
+// resolve returns v, or the object it refers to if it is a reference.
+func (d *Document) resolve(v any) (any, error) {
+	if r, ok := v.(ref); ok {
+		return d.get(r.num)
+	}
+	return v, nil
+}
+
+// resolveDict resolves v and returns it if it is a dictionary.
+func (d *Document) resolveDict(v any) (dict, error) {
+	v, err := d.resolve(v)
+	if err != nil {
+		return nil, err
+	}
+	dv, _ := v.(dict)
+	return dv, nil
+}
+
+// add adds v as a new object and returns a reference to it.
+func (d *Document) add(v any) ref {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	num := d.size
+	d.size++
+	d.changed[num] = v
+	return ref{num, 0}
+}
+
+// set replaces the object r refers to with v.
+func (d *Document) set(r ref, v any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.changed[r.num] = v
+}
+
+// page is a leaf of the page tree, with the attributes it may inherit from
+// its ancestors resolved.
+type page struct {
+	ref       ref
+	dict      dict
+	resources dict
+	mediaBox  [4]float64
+	rotate    int
+}
+
+// pages returns the document's pages in order.
+func (d *Document) pages() ([]page, error) {
+	root, err := d.resolveDict(d.trailer["Root"])
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: no document catalog", ErrUnsupported)
+	}
+	top, ok := root["Pages"].(ref)
+	if !ok {
+		return nil, fmt.Errorf("%w: no page tree", ErrUnsupported)
+	}
+	var pages []page
+	visited := make(map[ref]bool)
+	var walk func(r ref, inherited page) error
+	walk = func(r ref, inherited page) error {
+		if visited[r] {
+			return fmt.Errorf("%w: page tree loops at object %d", ErrUnsupported, r.num)
+		}
+		visited[r] = true
+		node, err := d.resolveDict(r)
+		if err != nil {
+			return err
+		}
+		if node == nil {
+			return fmt.Errorf("%w: page tree node %d missing", ErrUnsupported, r.num)
+		}
+		if res, err := d.resolveDict(node["Resources"]); err != nil {
+			return err
+		} else if res != nil {
+			inherited.resources = res
+		}
+		if box, err := d.resolve(node["MediaBox"]); err != nil {
+			return err
+		} else if arr, ok := box.([]any); ok && len(arr) == 4 {
+			for i, v := range arr {
+				if v, err := d.resolve(v); err == nil {
+					inherited.mediaBox[i], _ = number(v)
+				}
+			}
+		}
+		if rot, err := d.resolve(node["Rotate"]); err != nil {
+			return err
+		} else if rot, ok := rot.(int); ok {
+			inherited.rotate = ((rot % 360) + 360) % 360
+		}
+
+		if node["Type"] != name("Pages") {
+			inherited.ref, inherited.dict = r, node
+			pages = append(pages, inherited)
+			return nil
+		}
+		kids, err := d.resolve(node["Kids"])
+		if err != nil {
+			return err
+		}
+		arr, _ := kids.([]any)
+		for _, kid := range arr {
+			kr, ok := kid.(ref)
+			if !ok {
+				return fmt.Errorf("%w: page tree kid is not a reference", ErrUnsupported)
+			}
+			if err := walk(kr, inherited); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// US Letter, should no node give a media box.
+	if err := walk(top, page{mediaBox: [4]float64{0, 0, 612, 792}}); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// NumPages returns the number of pages in the document.
+func (d *Document) NumPages() (int, error) {
+	pages, err := d.pages()
+	return len(pages), err
+}
+
+// SetWorkers bounds how many pages a step works on at once. n < 1 means
+// runtime.GOMAXPROCS(0), the default.
+func (d *Document) SetWorkers(n int) {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	d.workers = n
+}
+
+// eachPage calls fn for every page, on up to d.workers goroutines, and
+// returns the error for the earliest page that failed. fn must not add or
+// replace objects itself, or their numbers would depend on the order the
+// pages happened to finish in.
+func (d *Document) eachPage(pages []page, fn func(i int, pg page) error) error {
+	errs := make([]error, len(pages))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(d.workers, len(pages)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = fn(i, pages[i])
+			}
+		}()
+	}
+	for i := range pages {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bytes returns the document with the changes made to it appended as an
+// incremental update, or the original bytes if there are none. After a step
+// has asked for it, as stripping metadata does, it is instead saved in full
+// with only the objects still in use, so nothing replaced survives in the
+// file.
+func (d *Document) Bytes() ([]byte, error) {
+	if d.full {
+		return d.rewrite()
+	}
+	if len(d.changed) == 0 {
+		return d.data, nil
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(d.data) + 4096)
+	buf.Write(d.data)
+	if !bytes.HasSuffix(d.data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	nums := slices.Sorted(maps.Keys(d.changed))
+	offsets := make(map[int]int, len(nums))
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", num, d.xref[num].gen)
+		write(&buf, d.changed[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(nums); {
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(&buf, "%d %d\n", nums[i], j-i)
+		for _, num := range nums[i:j] {
+			fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[num], d.xref[num].gen)
+		}
+		i = j
+	}
+
+	trailer := dict{"Size": d.size, "Prev": d.startxref}
+	for _, k := range []name{"Root", "Info", "ID"} {
+		if v, ok := d.trailer[k]; ok {
+			trailer[k] = v
+		}
+	}
+	buf.WriteString("trailer\n")
+	write(&buf, trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes(), nil
+}
+
+// rewrite saves the document in full: the objects reachable from the
+// trailer, renumbered from 1, under a single cross-reference table.
+func (d *Document) rewrite() ([]byte, error) {
+	return d.saveAs(d.trailer, nil)
+}
+
+// saveAs saves in full the objects reachable from the Root, Info and ID of
+// trailer. An object in replace is written instead of the document's own,
+// except that one replaced with nil is left out and references to it are
+// written as null.
+func (d *Document) saveAs(trailer dict, replace map[int]any) ([]byte, error) {
+	renum := make(map[int]int)
+	var order []int
+	var collect func(v any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case ref:
+			if v, ok := replace[v.num]; ok && v == nil {
+				return
+			}
+			if _, ok := renum[v.num]; !ok {
+				order = append(order, v.num)
+				renum[v.num] = len(order)
+			}
+		case []any:
+			for _, e := range v {
+				collect(e)
+			}
+		case dict:
+			for _, e := range v {
+				collect(e)
+			}
+		case *stream:
+			for k, e := range v.dict {
+				// Written out directly; an indirect length is dropped.
+				if k != "Length" {
+					collect(e)
+				}
+			}
+		}
+	}
+	for _, k := range []name{"Root", "Info", "ID"} {
+		collect(trailer[k])
+	}
+	objs := make([]any, 0, len(order))
+	for i := 0; i < len(order); i++ {
+		v, ok := replace[order[i]]
+		if !ok {
+			var err error
+			if v, err = d.get(order[i]); err != nil {
+				return nil, err
+			}
+		}
+		collect(v)
+		objs = append(objs, v)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(d.data))
+	header := "%PDF-1.7"
+	if line, _, _ := bytes.Cut(d.data, []byte("\n")); bytes.HasPrefix(line, []byte("%PDF-")) {
+		header = string(bytes.TrimRight(line, "\r"))
+	}
+	// A comment of high bytes marks the file as binary.
+	buf.WriteString(header + "\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, v := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		write(&buf, renumber(v, renum))
+		buf.WriteString("\nendobj\n")
+	}
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	out := dict{"Size": len(objs) + 1}
+	for _, k := range []name{"Root", "Info", "ID"} {
+		if v, ok := trailer[k]; ok {
+			out[k] = renumber(v, renum)
+		}
+	}
+	buf.WriteString("trailer\n")
+	write(&buf, out)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes(), nil
+}
+
+// renumber returns a copy of v with its references renumbered by renum. A
+// reference to an object not in renum becomes null.
+func renumber(v any, renum map[int]int) any {
+	switch v := v.(type) {
+	case ref:
+		if n, ok := renum[v.num]; ok {
+			return ref{n, 0}
+		}
+		return nil
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = renumber(e, renum)
+		}
+		return out
+	case dict:
+		out := make(dict, len(v))
+		for k, e := range v {
+			out[k] = renumber(e, renum)
+		}
+		return out
+	case *stream:
+		return &stream{dict: renumber(v.dict, renum).(dict), data: v.data}
+	}
+	return v
+}
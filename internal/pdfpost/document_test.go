@@ -0,0 +1,86 @@
+package pdfpost_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+func TestOpen_Unchanged(t *testing.T) {
+	orig := twoPages()
+	doc, err := pdfpost.Open(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := doc.NumPages(); err != nil || n != 2 {
+		t.Errorf("expected 2 pages, got %d (%v)", n, err)
+	}
+	if !bytes.Equal(save(t, doc), orig) {
+		t.Error("unchanged document not returned as it was")
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"not a pdf":     {[]byte("hello"), pdfpost.ErrUnsupported},
+		"encrypted":     {buildPDF("/Encrypt 2 0 R", "<</Type /Catalog>>", "<</Filter /Standard>>"), pdfpost.ErrEncrypted},
+		"no root":       {[]byte("%PDF-1.4\nxref\n0 1\n0000000000 65535 f\r\ntrailer\n<</Size 1>>\nstartxref\n9\n%%EOF\n"), pdfpost.ErrUnsupported},
+		"xref stream":   {[]byte("%PDF-1.5\n1 0 obj\n<</Type /XRef /Size 2>>\nstream\n\nendstream\nendobj\nstartxref\n9\n%%EOF\n"), pdfpost.ErrUnsupported},
+		"bad offset":    {[]byte("%PDF-1.4\nstartxref\n99999\n%%EOF\n"), pdfpost.ErrUnsupported},
+		"looping chain": {[]byte("%PDF-1.4\nxref\n0 1\n0000000000 65535 f\r\ntrailer\n<</Size 1 /Prev 9>>\nstartxref\n9\n%%EOF\n"), pdfpost.ErrUnsupported},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := pdfpost.Open(tc.data); !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestNumPages_Loop(t *testing.T) {
+	data := buildPDF("",
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [2 0 R] /Count 1>>",
+	)
+	doc, err := pdfpost.Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.NumPages(); !errors.Is(err, pdfpost.ErrUnsupported) {
+		t.Errorf("expected a looping page tree to be unsupported, got %v", err)
+	}
+}
+
+func TestBytes_ChainsUpdates(t *testing.T) {
+	orig := twoPages()
+	doc, err := pdfpost.Open(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (pdfpost.Watermark{Text: "one"}).Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	once := save(t, doc)
+	if doc, err = pdfpost.Open(once); err != nil {
+		t.Fatal(err)
+	}
+	if err := (pdfpost.Watermark{Text: "two"}).Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	twice := save(t, doc)
+	if !bytes.HasPrefix(twice, once) {
+		t.Error("second update does not append to the first")
+	}
+	// The second stamp must not replace the first on the page.
+	if !bytes.Contains(twice[len(once):], []byte("/DocPdfStamp2 ")) {
+		t.Error("second stamp not given its own resource name")
+	}
+	if _, err := pdfpost.Open(twice); err != nil {
+		t.Errorf("twice-updated document does not reopen: %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package pdfpost
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrMetadataField is returned for a custom metadata field whose name is
+// not 1 to 64 letters, digits, "-" or "_" starting with a letter, or is one
+// of the standard fields.
+var ErrMetadataField = errors.New("pdfpost: invalid metadata field name")
+
+// maxXMP caps the document XMP packet read back, decompressed.
+const maxXMP = 4 << 20
+
+// standardFields are the fields of the document information dictionary the
+// PDF specification defines. Only Title, Author, Subject and Keywords are
+// set by Metadata; the rest are the producing application's.
+var standardFields = []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer", "CreationDate", "ModDate", "Trapped"}
+
+var fieldName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+
+// Metadata sets the document information dictionary and the document's XMP
+// packet, which carries the same fields for readers that prefer it.
+type Metadata struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	// Custom fields, named as CheckField allows. They are left out of the
+	// XMP of a PDF/A document, which may only use declared schemas.
+	Custom map[string]string
+	// Strip drops the source's information dictionary and XMP first, and
+	// saves the document in full so that none of it remains in the file.
+	// The PDF/A identification is kept.
+	Strip bool
+}
+
+// CheckField returns ErrMetadataField unless name may be used for a custom
+// field.
+func CheckField(name string) error {
+	if !fieldName.MatchString(name) || slices.Contains(standardFields, name) {
+		return fmt.Errorf("%w %q", ErrMetadataField, name)
+	}
+	return nil
+}
+
+// Apply implements Step.
+func (m Metadata) Apply(doc *Document) error {
+	set := map[string]string{"Title": m.Title, "Author": m.Author, "Subject": m.Subject, "Keywords": m.Keywords}
+	maps.DeleteFunc(set, func(_, v string) bool { return v == "" })
+	for k, v := range m.Custom {
+		if err := CheckField(k); err != nil {
+			return err
+		}
+		if v != "" {
+			set[k] = v
+		}
+	}
+	if len(set) == 0 && !m.Strip {
+		return nil
+	}
+
+	rootRef := doc.trailer["Root"].(ref)
+	root, err := doc.resolveDict(rootRef)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return fmt.Errorf("%w: no document catalog", ErrUnsupported)
+	}
+	xmp, err := doc.XMP()
+	if err != nil {
+		return err
+	}
+	part, conformance := pdfaID(xmp)
+
+	info := dict{}
+	if !m.Strip {
+		old, err := doc.resolveDict(doc.trailer["Info"])
+		if err != nil {
+			return err
+		}
+		info = maps.Clone(old)
+		if info == nil {
+			info = dict{}
+		}
+	}
+	for k, v := range set {
+		info[name(k)] = encodeText(v)
+	}
+	if m.Strip {
+		doc.full = true
+	}
+	switch r, ok := doc.trailer["Info"].(ref); {
+	case len(info) == 0:
+		delete(doc.trailer, "Info")
+	case ok && !m.Strip:
+		doc.set(r, info)
+	default:
+		doc.trailer["Info"] = doc.add(info)
+	}
+
+	root = maps.Clone(root)
+	if len(info) == 0 && part == "" {
+		delete(root, "Metadata")
+	} else {
+		packet := xmpPacket(info, part, conformance)
+		root["Metadata"] = doc.add(&stream{dict: dict{"Type": name("Metadata"), "Subtype": name("XML")}, data: packet})
+	}
+	doc.set(rootRef, root)
+	return nil
+}
+
+// Info returns the fields of the document information dictionary that are
+// text strings, decoded.
+func (d *Document) Info() (map[string]string, error) {
+	info, err := d.resolveDict(d.trailer["Info"])
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(info))
+	for k, v := range info {
+		if v, err := d.resolve(v); err != nil {
+			return nil, err
+		} else if s, ok := v.([]byte); ok {
+			fields[string(k)] = decodeText(s)
+		}
+	}
+	return fields, nil
+}
+
+// XMP returns the document's XMP packet, nil if it has none or it is
+// compressed other than with FlateDecode.
+func (d *Document) XMP() ([]byte, error) {
+	root, err := d.resolveDict(d.trailer["Root"])
+	if err != nil {
+		return nil, err
+	}
+	v, err := d.resolve(root["Metadata"])
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(*stream)
+	if !ok {
+		return nil, nil
+	}
+	switch f := s.dict["Filter"]; f {
+	case nil:
+		return s.data, nil
+	case name("FlateDecode"):
+		zr, err := zlib.NewReader(bytes.NewReader(s.data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: metadata stream: %v", ErrUnsupported, err)
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(io.LimitReader(zr, maxXMP+1))
+		if err != nil || len(data) > maxXMP {
+			return nil, fmt.Errorf("%w: metadata stream unreadable or too large", ErrUnsupported)
+		}
+		return data, nil
+	default:
+		return nil, nil
+	}
+}
+
+var (
+	pdfaPart        = regexp.MustCompile(`pdfaid:part(?:\s*=\s*["'](\d)["']|>\s*(\d)\s*<)`)
+	pdfaConformance = regexp.MustCompile(`pdfaid:conformance(?:\s*=\s*["']([A-Za-z])["']|>\s*([A-Za-z])\s*<)`)
+)
+
+// pdfaID returns the PDF/A part and conformance level an XMP packet
+// declares, empty if it declares none.
+func pdfaID(xmp []byte) (part, conformance string) {
+	if m := pdfaPart.FindSubmatch(xmp); m != nil {
+		part = string(m[1]) + string(m[2])
+	}
+	if m := pdfaConformance.FindSubmatch(xmp); m != nil {
+		conformance = string(m[1]) + string(m[2])
+	}
+	return part, conformance
+}
+
+// xmpPacket returns an XMP packet mirroring info, which PDF/A requires the
+// two to agree on, and declaring PDF/A part and conformance if part is set.
+func xmpPacket(info dict, part, conformance string) []byte {
+	text := func(k name) string {
+		s, _ := info[k].([]byte)
+		return xmlEscape(decodeText(s))
+	}
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("<rdf:Description rdf:about=\"\"\n xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\"\n xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"")
+	if part != "" {
+		b.WriteString("\n xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\"")
+	} else {
+		b.WriteString("\n xmlns:pdfx=\"http://ns.adobe.com/pdfx/1.3/\"")
+	}
+	b.WriteString(">\n")
+	if _, ok := info["Title"]; ok {
+		fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", text("Title"))
+	}
+	if _, ok := info["Author"]; ok {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", text("Author"))
+	}
+	if _, ok := info["Subject"]; ok {
+		fmt.Fprintf(&b, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", text("Subject"))
+	}
+	for _, f := range []struct{ key, prop string }{
+		{"Keywords", "pdf:Keywords"},
+		{"Producer", "pdf:Producer"},
+		{"Creator", "xmp:CreatorTool"},
+	} {
+		if _, ok := info[name(f.key)]; ok {
+			fmt.Fprintf(&b, "<%s>%s</%[1]s>\n", f.prop, text(name(f.key)))
+		}
+	}
+	for _, f := range []struct{ key, prop string }{
+		{"CreationDate", "xmp:CreateDate"},
+		{"ModDate", "xmp:ModifyDate"},
+	} {
+		s, _ := info[name(f.key)].([]byte)
+		if date := xmpDate(decodeText(s)); date != "" {
+			fmt.Fprintf(&b, "<%s>%s</%[1]s>\n", f.prop, date)
+		}
+	}
+	if part != "" {
+		fmt.Fprintf(&b, "<pdfaid:part>%s</pdfaid:part>\n", part)
+		if conformance != "" {
+			fmt.Fprintf(&b, "<pdfaid:conformance>%s</pdfaid:conformance>\n", conformance)
+		}
+	} else {
+		for _, k := range slices.Sorted(maps.Keys(info)) {
+			if !slices.Contains(standardFields, string(k)) && fieldName.MatchString(string(k)) {
+				fmt.Fprintf(&b, "<pdfx:%s>%s</pdfx:%[1]s>\n", k, text(k))
+			}
+		}
+	}
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return []byte(b.String())
+}
+
+var pdfDate = regexp.MustCompile(`^D:(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(Z|[+-]\d{2}'?\d{2}'?)?`)
+
+// xmpDate converts a PDF date, D:YYYYMMDDHHmmSSOHH'mm', to the ISO 8601 form
+// XMP uses, empty if it is not one.
+func xmpDate(s string) string {
+	m := pdfDate.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	out := m[1]
+	for i, sep := range []string{"-", "-", "T", ":", ":"} {
+		if m[i+2] == "" {
+			break
+		}
+		out += sep + m[i+2]
+	}
+	if m[4] == "" {
+		// A time zone needs a time.
+		return out
+	}
+	if m[5] == "" {
+		out += ":00"
+	}
+	switch tz := strings.ReplaceAll(m[7], "'", ""); {
+	case tz == "Z":
+		out += "Z"
+	case tz != "":
+		out += tz[:3] + ":" + tz[3:]
+	}
+	return out
+}
+
+// encodeText encodes s as a PDF text string: as it is if it is ASCII,
+// otherwise as UTF-16BE with a byte order mark.
+func encodeText(s string) []byte {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return []byte(s)
+	}
+	out := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// decodeText decodes a PDF text string: UTF-16BE or UTF-8 with a byte order
+// mark, else PDFDocEncoding, taken as Latin-1.
+func decodeText(b []byte) string {
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		u := make([]uint16, 0, len(b)/2-1)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	case bytes.HasPrefix(b, []byte("\xef\xbb\xbf")):
+		return string(b[3:])
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '&':
+			b.WriteString("&amp;")
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r', r == 0xfffe, r == 0xffff:
+			// Not allowed in XML at all.
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,152 @@
+package pdfpost_test
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// reopen applies m to orig and opens the result.
+func reopen(t *testing.T, orig []byte, m pdfpost.Metadata) ([]byte, *pdfpost.Document) {
+	t.Helper()
+	doc, err := pdfpost.Open(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	out := save(t, doc)
+	if doc, err = pdfpost.Open(out); err != nil {
+		t.Fatalf("output does not reopen: %v", err)
+	}
+	return out, doc
+}
+
+func TestMetadata_Set(t *testing.T) {
+	orig := twoPages()
+	out, doc := reopen(t, orig, pdfpost.Metadata{
+		Title:    "Quarterly report",
+		Author:   "Zoë <Finance>",
+		Keywords: "q3, revenue",
+		Custom:   map[string]string{"Department": "Legal"},
+	})
+	if !bytes.HasPrefix(out, orig) {
+		t.Error("metadata not written as an incremental update")
+	}
+	info, err := doc.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Title":      "Quarterly report",
+		"Author":     "Zoë <Finance>",
+		"Keywords":   "q3, revenue",
+		"Department": "Legal",
+		"Producer":   "LibreOffice",
+	}
+	if !maps.Equal(info, want) {
+		t.Errorf("Info() = %v, want %v", info, want)
+	}
+	xmp, err := doc.XMP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<rdf:li xml:lang="x-default">Quarterly report</rdf:li>`,
+		"<rdf:li>Zoë &lt;Finance&gt;</rdf:li>",
+		"<pdf:Keywords>q3, revenue</pdf:Keywords>",
+		"<pdf:Producer>LibreOffice</pdf:Producer>",
+		"<pdfx:Department>Legal</pdfx:Department>",
+	} {
+		if !bytes.Contains(xmp, []byte(want)) {
+			t.Errorf("XMP lacks %q", want)
+		}
+	}
+	if n, err := doc.NumPages(); err != nil || n != 2 {
+		t.Errorf("expected 2 pages, got %d (%v)", n, err)
+	}
+}
+
+func TestMetadata_Strip(t *testing.T) {
+	orig := buildPDF("/Info 3 0 R",
+		"<</Type /Catalog /Pages 2 0 R /Metadata 4 0 R>>",
+		"<</Type /Pages /Kids [5 0 R] /Count 1>>",
+		"<</Author (jdoe) /Producer (LibreOffice) /CreationDate (D:20240102030405+01'00')>>",
+		"<</Type /Metadata /Subtype /XML /Length 80>>\nstream\n<x:xmpmeta><dc:creator>jdoe</dc:creator><pdfaid:part>2</pdfaid:part></x:xmpmeta>\nendstream",
+		"<</Type /Page /Parent 2 0 R /MediaBox [0 0 612 792]>>",
+	)
+	out, doc := reopen(t, orig, pdfpost.Metadata{Title: "Public", Strip: true})
+	if bytes.Contains(out, []byte("jdoe")) || bytes.Contains(out, []byte("LibreOffice")) {
+		t.Error("source metadata left in the file")
+	}
+	if info, err := doc.Info(); err != nil || !maps.Equal(info, map[string]string{"Title": "Public"}) {
+		t.Errorf("Info() = %v, %v", info, err)
+	}
+	xmp, err := doc.XMP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(xmp, []byte("<pdfaid:part>2</pdfaid:part>")) {
+		t.Error("PDF/A identification not kept")
+	}
+	if n, err := doc.NumPages(); err != nil || n != 1 {
+		t.Errorf("expected 1 page, got %d (%v)", n, err)
+	}
+
+	// Stripping alone leaves no information dictionary, and no XMP outside
+	// PDF/A.
+	out, doc = reopen(t, twoPages(), pdfpost.Metadata{Strip: true})
+	if bytes.Contains(out, []byte("/Info")) || bytes.Contains(out, []byte("LibreOffice")) {
+		t.Error("information dictionary not removed")
+	}
+	if xmp, err := doc.XMP(); err != nil || xmp != nil {
+		t.Errorf("XMP() = %q, %v", xmp, err)
+	}
+	// The content streams survive the rewrite, the indirect length resolved.
+	if !bytes.Contains(out, []byte("(Hello, world) Tj")) || !bytes.Contains(out, []byte("<</Length 5>>")) {
+		t.Error("content not carried over")
+	}
+}
+
+func TestMetadata_Dates(t *testing.T) {
+	_, doc := reopen(t, buildPDF("/Info 3 0 R",
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [] /Count 0>>",
+		"<</CreationDate (D:20240102030405+01'00') /ModDate (D:2024)>>",
+	), pdfpost.Metadata{Subject: "s"})
+	xmp, err := doc.XMP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<xmp:CreateDate>2024-01-02T03:04:05+01:00</xmp:CreateDate>", "<xmp:ModifyDate>2024</xmp:ModifyDate>"} {
+		if !bytes.Contains(xmp, []byte(want)) {
+			t.Errorf("XMP lacks %q", want)
+		}
+	}
+}
+
+func TestMetadata_Empty(t *testing.T) {
+	orig := twoPages()
+	out, _ := reopen(t, orig, pdfpost.Metadata{Custom: map[string]string{"Empty": ""}})
+	if !bytes.Equal(out, orig) {
+		t.Error("empty metadata changed the document")
+	}
+}
+
+func TestCheckField(t *testing.T) {
+	for _, ok := range []string{"Department", "x", "Cost-Centre_2"} {
+		if err := pdfpost.CheckField(ok); err != nil {
+			t.Errorf("CheckField(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "2nd", "Title", "Producer", "has space", "a/b", strings.Repeat("x", 65)} {
+		if err := pdfpost.CheckField(bad); !errors.Is(err, pdfpost.ErrMetadataField) {
+			t.Errorf("CheckField(%q) = %v, want ErrMetadataField", bad, err)
+		}
+	}
+}
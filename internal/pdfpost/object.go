@@ -0,0 +1,369 @@
+package pdfpost
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// PDF objects are represented as Go values:
+//
+//	null          nil
+//	boolean       bool
+//	integer       int
+//	real          float64
+//	string        []byte
+//	name          name
+//	array         []any
+//	dictionary    dict
+//	stream        *stream
+//	reference     ref
+type (
+	name string
+	dict map[name]any
+	ref  struct{ num, gen int }
+)
+
+type stream struct {
+	dict dict
+	data []byte // as stored, still encoded by its filters
+}
+
+// parser reads objects from PDF bytes.
+type parser struct {
+	b   []byte
+	pos int
+}
+
+// isWhite and isDelim classify PDF characters (ISO 32000-1 7.2.2).
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// skip moves past whitespace and comments.
+func (p *parser) skip() {
+	for p.pos < len(p.b) {
+		switch c := p.b[p.pos]; {
+		case isWhite(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keyword reads a regular token: a number, keyword or the like.
+func (p *parser) keyword() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.b) && !isWhite(p.b[p.pos]) && !isDelim(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// expect reads keyword kw or fails.
+func (p *parser) expect(kw string) error {
+	if got := p.keyword(); got != kw {
+		return fmt.Errorf("%w: expected %q at offset %d, found %q", ErrUnsupported, kw, p.pos, got)
+	}
+	return nil
+}
+
+// object reads one object. References are recognised by looking ahead for
+// "gen R" after an integer.
+func (p *parser) object(depth int) (any, error) {
+	if depth > 64 {
+		return nil, fmt.Errorf("%w: objects nested too deeply", ErrUnsupported)
+	}
+	p.skip()
+	if p.pos >= len(p.b) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrUnsupported)
+	}
+	switch c := p.b[p.pos]; c {
+	case '/':
+		p.pos++
+		return name(p.name()), nil
+	case '(':
+		return p.literal()
+	case '<':
+		if p.pos+1 < len(p.b) && p.b[p.pos+1] == '<' {
+			p.pos += 2
+			return p.dict(depth)
+		}
+		return p.hex()
+	case '[':
+		p.pos++
+		var arr []any
+		for {
+			p.skip()
+			if p.pos < len(p.b) && p.b[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			v, err := p.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	}
+
+	kw := p.keyword()
+	switch kw {
+	case "":
+		return nil, fmt.Errorf("%w: unexpected %q at offset %d", ErrUnsupported, p.b[p.pos], p.pos)
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	n, err := strconv.Atoi(kw)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(kw, 64)
+		if ferr != nil {
+			return nil, fmt.Errorf("%w: unexpected %q at offset %d", ErrUnsupported, kw, p.pos)
+		}
+		return f, nil
+	}
+	// An integer may start a reference: "12 0 R".
+	save := p.pos
+	if gen, err := strconv.Atoi(p.keyword()); err == nil && p.keyword() == "R" {
+		return ref{n, gen}, nil
+	}
+	p.pos = save
+	return n, nil
+}
+
+// name reads a name after its slash, decoding #xx escapes.
+func (p *parser) name() string {
+	var b []byte
+	for p.pos < len(p.b) && !isWhite(p.b[p.pos]) && !isDelim(p.b[p.pos]) {
+		c := p.b[p.pos]
+		if c == '#' && p.pos+2 < len(p.b) {
+			if v, err := strconv.ParseUint(string(p.b[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		p.pos++
+	}
+	return string(b)
+}
+
+// dict reads a dictionary after its "<<", and the stream following it, if
+// any.
+func (p *parser) dict(depth int) (any, error) {
+	d := make(dict)
+	for {
+		p.skip()
+		if bytes.HasPrefix(p.b[p.pos:], []byte(">>")) {
+			p.pos += 2
+			break
+		}
+		if p.pos >= len(p.b) || p.b[p.pos] != '/' {
+			return nil, fmt.Errorf("%w: dictionary key expected at offset %d", ErrUnsupported, p.pos)
+		}
+		p.pos++
+		key := name(p.name())
+		v, err := p.object(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		d[key] = v
+	}
+	return d, nil
+}
+
+// literal reads a (string), decoding escapes.
+func (p *parser) literal() ([]byte, error) {
+	p.pos++ // (
+	var b []byte
+	nest := 0
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			nest++
+		case ')':
+			if nest == 0 {
+				return b, nil
+			}
+			nest--
+		case '\\':
+			if p.pos >= len(p.b) {
+				break
+			}
+			e := p.b[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.b[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, fmt.Errorf("%w: unterminated string", ErrUnsupported)
+}
+
+// hex reads a <hex string>.
+func (p *parser) hex() ([]byte, error) {
+	p.pos++ // <
+	var digits []byte
+	for p.pos < len(p.b) && p.b[p.pos] != '>' {
+		if c := p.b[p.pos]; !isWhite(c) {
+			digits = append(digits, c)
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.b) {
+		return nil, fmt.Errorf("%w: unterminated hex string", ErrUnsupported)
+	}
+	p.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad hex string", ErrUnsupported)
+		}
+		b[i] = byte(v)
+	}
+	return b, nil
+}
+
+// write appends the PDF syntax for v to buf.
+func write(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case float64:
+		buf.WriteString(formatReal(v))
+	case []byte:
+		writeString(buf, v)
+	case name:
+		buf.WriteByte('/')
+		for _, c := range []byte(v) {
+			if c < '!' || c > '~' || c == '#' || isDelim(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+				continue
+			}
+			buf.WriteByte(c)
+		}
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			write(buf, e)
+		}
+		buf.WriteByte(']')
+	case dict:
+		buf.WriteString("<<")
+		// Sorted, so the same object always serialises the same way.
+		for i, k := range slices.Sorted(maps.Keys(v)) {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			write(buf, k)
+			buf.WriteByte(' ')
+			write(buf, v[k])
+		}
+		buf.WriteString(">>")
+	case ref:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case *stream:
+		d := make(dict, len(v.dict)+1)
+		for k, e := range v.dict {
+			d[k] = e
+		}
+		d["Length"] = len(v.data)
+		write(buf, d)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.data)
+		buf.WriteString("\nendstream")
+	default:
+		panic(fmt.Sprintf("pdfpost: cannot write %T", v))
+	}
+}
+
+// writeString writes s as a literal string, escaping what must be.
+func writeString(buf *bytes.Buffer, s []byte) {
+	buf.WriteByte('(')
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+}
+
+// formatReal formats f as a PDF real, which has no exponent form.
+func formatReal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// number returns v as a float64, if it is a number.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
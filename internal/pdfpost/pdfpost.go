@@ -0,0 +1,61 @@
+// Package pdfpost edits converted PDFs before they are returned: stamping a
+// watermark on every page, or setting the document's metadata. Steps change
+// a Document, which is saved as an incremental update appended to the
+// original file, so LibreOffice's output is kept byte for byte and only the
+// objects a step touched are written again. Stripping metadata is the
+// exception: the document is then written out in full, without what was
+// removed.
+package pdfpost
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// ErrUnsupported is returned for a PDF whose structure pdfpost cannot
+	// edit, such as one with cross-reference streams or a damaged
+	// cross-reference table.
+	ErrUnsupported = errors.New("pdfpost: unsupported pdf structure")
+	// ErrEncrypted is returned for an encrypted PDF, whose objects cannot be
+	// edited without its key.
+	ErrEncrypted = errors.New("pdfpost: pdf is encrypted")
+)
+
+// Step is one edit made to a converted PDF.
+type Step interface {
+	Apply(doc *Document) error
+}
+
+// Process applies steps, in order, to the PDF at path and saves the result
+// in its place. Each step works on up to workers pages at once, as
+// Document.SetWorkers sets. With no steps the file is left untouched.
+func Process(path string, workers int, steps ...Step) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := Open(data)
+	if err != nil {
+		return err
+	}
+	doc.SetWorkers(workers)
+	for _, s := range steps {
+		if err := s.Apply(doc); err != nil {
+			return fmt.Errorf("pdfpost: %T: %w", s, err)
+		}
+	}
+	out, err := doc.Bytes()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".post"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
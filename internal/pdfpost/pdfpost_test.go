@@ -0,0 +1,113 @@
+package pdfpost_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// buildPDF returns a PDF with a classic cross-reference table holding objs
+// as objects 1 to len(objs); object 1 is the catalog.
+func buildPDF(trailer string, objs ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R %s>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+// twoPages is a two-page A4 document, the second page landscape by
+// rotation, its content split across two streams.
+func twoPages() []byte {
+	return buildPDF("/Info 8 0 R",
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 595 842] /Resources <</Font <</F1 7 0 R>>>>>>",
+		"<</Type /Page /Parent 2 0 R /Contents 5 0 R>>",
+		"<</Type /Page /Parent 2 0 R /Rotate 90 /Contents [5 0 R 6 0 R]>>",
+		"<</Length 43>>\nstream\nBT /F1 12 Tf 72 720 Td (Hello, world) Tj ET\nendstream",
+		"<</Length 9 0 R>>\nstream\n0 0 m\nendstream",
+		"<</Type /Font /Subtype /Type1 /BaseFont /Times-Roman>>",
+		"<</Producer (LibreOffice)>>",
+		"5",
+	)
+}
+
+// save returns doc's bytes.
+func save(t *testing.T, doc *pdfpost.Document) []byte {
+	t.Helper()
+	out, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func writeTemp(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out.pdf")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProcess(t *testing.T) {
+	orig := twoPages()
+	path := writeTemp(t, orig)
+	if err := pdfpost.Process(path, 2, pdfpost.Watermark{Text: "CONFIDENTIAL"}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, orig) {
+		t.Error("original bytes not kept as a prefix of the update")
+	}
+	doc, err := pdfpost.Open(out)
+	if err != nil {
+		t.Fatalf("output does not reopen: %v", err)
+	}
+	if n, err := doc.NumPages(); err != nil || n != 2 {
+		t.Errorf("expected 2 pages, got %d (%v)", n, err)
+	}
+	for _, want := range []string{"(CONFIDENTIAL) Tj", "/BaseFont /Helvetica-Bold", "/DocPdfStamp Do", "/Prev "} {
+		if !bytes.Contains(out[len(orig):], []byte(want)) {
+			t.Errorf("update lacks %q", want)
+		}
+	}
+}
+
+func TestProcess_NoSteps(t *testing.T) {
+	orig := twoPages()
+	path := writeTemp(t, orig)
+	if err := pdfpost.Process(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := os.ReadFile(path); !bytes.Equal(out, orig) {
+		t.Error("file changed with no steps")
+	}
+}
+
+func TestProcess_Unsupported(t *testing.T) {
+	path := writeTemp(t, []byte("not a pdf"))
+	if err := pdfpost.Process(path, 0, pdfpost.Watermark{Text: "x"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if out, _ := os.ReadFile(path); string(out) != "not a pdf" {
+		t.Error("file changed despite the error")
+	}
+}
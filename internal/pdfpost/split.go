@@ -0,0 +1,88 @@
+package pdfpost
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// ErrPageRange is returned by Extract for a page the document does not
+// have.
+var ErrPageRange = errors.New("pdfpost: page out of range")
+
+// Extract returns a new PDF holding the given pages of the document,
+// numbered from 1, in the order given; a page asked for twice is included
+// once. Only the objects those pages use are written, along with the
+// document information dictionary. The outline, forms and structure tree,
+// which describe the whole document, are left out, and links to pages not
+// extracted lose their destination.
+func (d *Document) Extract(pages []int) ([]byte, error) {
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages", ErrPageRange)
+	}
+	all, err := d.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave out every page, and the page tree above them, but those
+	// extracted, which are hung from a new tree.
+	replace := make(map[int]any)
+	for _, pg := range all {
+		replace[pg.ref.num] = nil
+		for parent := pg.dict["Parent"]; ; {
+			r, ok := parent.(ref)
+			if !ok {
+				break
+			}
+			if v, done := replace[r.num]; done && v == nil {
+				break
+			}
+			replace[r.num] = nil
+			node, err := d.resolveDict(r)
+			if err != nil {
+				return nil, err
+			}
+			parent = node["Parent"]
+		}
+	}
+	tree := ref{d.size, 0}
+	kids := make([]any, 0, len(pages))
+	for _, n := range pages {
+		if n < 1 || n > len(all) {
+			return nil, fmt.Errorf("%w: page %d of %d", ErrPageRange, n, len(all))
+		}
+		pg := all[n-1]
+		if replace[pg.ref.num] != nil {
+			continue
+		}
+		// The attributes it inherited go with it.
+		pd := maps.Clone(pg.dict)
+		pd["Parent"] = tree
+		if _, ok := pd["Resources"]; !ok && pg.resources != nil {
+			pd["Resources"] = pg.resources
+		}
+		if _, ok := pd["MediaBox"]; !ok {
+			pd["MediaBox"] = []any{pg.mediaBox[0], pg.mediaBox[1], pg.mediaBox[2], pg.mediaBox[3]}
+		}
+		if _, ok := pd["Rotate"]; !ok && pg.rotate != 0 {
+			pd["Rotate"] = pg.rotate
+		}
+		replace[pg.ref.num] = pd
+		kids = append(kids, pg.ref)
+	}
+	replace[tree.num] = dict{"Type": name("Pages"), "Kids": kids, "Count": len(kids)}
+
+	catalog := dict{"Type": name("Catalog"), "Pages": tree}
+	if root, err := d.resolveDict(d.trailer["Root"]); err != nil {
+		return nil, err
+	} else if lang, ok := root["Lang"]; ok {
+		catalog["Lang"] = lang
+	}
+	replace[tree.num+1] = catalog
+	trailer := dict{"Root": ref{tree.num + 1, 0}}
+	if info, ok := d.trailer["Info"]; ok {
+		trailer["Info"] = info
+	}
+	return d.saveAs(trailer, replace)
+}
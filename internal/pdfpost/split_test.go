@@ -0,0 +1,89 @@
+package pdfpost_test
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// extract extracts pages from orig and opens the result.
+func extract(t *testing.T, orig []byte, pages ...int) ([]byte, *pdfpost.Document) {
+	t.Helper()
+	doc, err := pdfpost.Open(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := doc.Extract(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc, err = pdfpost.Open(out); err != nil {
+		t.Fatalf("output does not reopen: %v", err)
+	}
+	return out, doc
+}
+
+func TestExtract(t *testing.T) {
+	out, doc := extract(t, twoPages(), 2)
+	if n, err := doc.NumPages(); err != nil || n != 1 {
+		t.Fatalf("expected 1 page, got %d (%v)", n, err)
+	}
+	// The page keeps what it inherited from the tree it was cut from.
+	for _, want := range []string{"/Rotate 90", "/MediaBox [0 0 595 842]", "/BaseFont /Times-Roman", "0 0 m", "(Hello, world) Tj"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+	if info, err := doc.Info(); err != nil || !maps.Equal(info, map[string]string{"Producer": "LibreOffice"}) {
+		t.Errorf("Info() = %v, %v", info, err)
+	}
+
+	// The first page alone leaves the second's own content behind.
+	out, _ = extract(t, twoPages(), 1)
+	if bytes.Contains(out, []byte("0 0 m")) || bytes.Contains(out, []byte("/Rotate")) {
+		t.Error("content of a page not extracted written out")
+	}
+
+	// Pages come in the order asked for, each once.
+	_, doc = extract(t, twoPages(), 2, 1, 2)
+	if n, err := doc.NumPages(); err != nil || n != 2 {
+		t.Errorf("expected 2 pages, got %d (%v)", n, err)
+	}
+}
+
+func TestExtract_DropsOtherPages(t *testing.T) {
+	// The first page links to the second, which must not be pulled in
+	// through the link.
+	orig := buildPDF("",
+		"<</Type /Catalog /Pages 2 0 R /Outlines 5 0 R /Lang (en-GB)>>",
+		"<</Type /Pages /Kids [3 0 R 4 0 R] /Count 2>>",
+		"<</Type /Page /Parent 2 0 R /Annots [<</Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest [4 0 R /Fit]>>]>>",
+		"<</Type /Page /Parent 2 0 R /UserUnit 2>>",
+		"<</Type /Outlines /First 4 0 R>>",
+	)
+	out, doc := extract(t, orig, 1)
+	if bytes.Contains(out, []byte("/UserUnit")) || bytes.Contains(out, []byte("/Outlines")) {
+		t.Error("page not extracted written out")
+	}
+	if !bytes.Contains(out, []byte("/Dest [null /Fit]")) || !bytes.Contains(out, []byte("/Lang (en-GB)")) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if n, err := doc.NumPages(); err != nil || n != 1 {
+		t.Errorf("expected 1 page, got %d (%v)", n, err)
+	}
+}
+
+func TestExtract_OutOfRange(t *testing.T) {
+	doc, err := pdfpost.Open(twoPages())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pages := range [][]int{nil, {3}, {0}, {1, 3}} {
+		if _, err := doc.Extract(pages); !errors.Is(err, pdfpost.ErrPageRange) {
+			t.Errorf("Extract(%v) = %v, want ErrPageRange", pages, err)
+		}
+	}
+}
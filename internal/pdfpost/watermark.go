@@ -0,0 +1,433 @@
+package pdfpost
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"maps"
+	"math"
+	"strings"
+)
+
+// ErrWatermarkImage is returned for a watermark image that is neither a PNG
+// of at most 4096x4096 pixels nor an RGB or greyscale JPEG.
+var ErrWatermarkImage = errors.New("pdfpost: watermark image must be a png or jpeg")
+
+// Position is where a Watermark is placed on the page.
+type Position string
+
+// Watermark positions.
+const (
+	// PositionDiagonal runs text corner to corner across the page. Images
+	// are centred.
+	PositionDiagonal Position = "diagonal"
+	// PositionCenter centres the watermark on the page.
+	PositionCenter Position = "center"
+	// PositionTop places the watermark along the top edge.
+	PositionTop Position = "top"
+	// PositionBottom places the watermark along the bottom edge.
+	PositionBottom Position = "bottom"
+)
+
+// ParsePosition parses "diagonal", "center", "top" or "bottom". Empty means
+// PositionDiagonal.
+func ParsePosition(s string) (Position, error) {
+	switch p := Position(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return PositionDiagonal, nil
+	case PositionDiagonal, PositionCenter, PositionTop, PositionBottom:
+		return p, nil
+	default:
+		return "", fmt.Errorf("pdfpost: unknown watermark position %q", s)
+	}
+}
+
+// DefaultOpacity is the opacity of a Watermark that does not set one.
+const DefaultOpacity = 0.3
+
+// Watermark stamps text, an image or both on every page, over the page's
+// content, the same way up as the page is displayed.
+type Watermark struct {
+	// Text is set in Helvetica Bold; characters outside Latin-1 are
+	// replaced with "?".
+	Text string
+	// Image is a PNG or JPEG. PNG transparency is kept.
+	Image []byte
+	// Position defaults to PositionDiagonal.
+	Position Position
+	// Opacity is from 0 to 1; 0 means DefaultOpacity.
+	Opacity float64
+}
+
+// stampName is the page resource name the stamp is drawn under.
+const stampName = "DocPdfStamp"
+
+// Apply implements Step.
+func (w Watermark) Apply(doc *Document) error {
+	text := winAnsi(w.Text)
+	if len(text) == 0 && len(w.Image) == 0 {
+		return nil
+	}
+	pages, err := doc.pages()
+	if err != nil {
+		return err
+	}
+	res := dict{}
+	var img *placedImage
+	if len(w.Image) > 0 {
+		if img, err = addImage(doc, w.Image); err != nil {
+			return err
+		}
+		res["XObject"] = dict{"Im1": img.ref}
+	}
+	if len(text) > 0 {
+		res["Font"] = dict{"F1": doc.add(dict{
+			"Type":     name("Font"),
+			"Subtype":  name("Type1"),
+			"BaseFont": name("Helvetica-Bold"),
+			"Encoding": name("WinAnsiEncoding"),
+		})}
+	}
+	opacity := w.Opacity
+	if opacity <= 0 {
+		opacity = DefaultOpacity
+	}
+	res["ExtGState"] = dict{"GS1": doc.add(dict{
+		"Type": name("ExtGState"),
+		"ca":   min(opacity, 1),
+		"CA":   min(opacity, 1),
+	})}
+
+	// Pages of the same size and rotation share one stamp.
+	type layout struct {
+		box    [4]float64
+		rotate int
+	}
+	stamps := make(map[layout]ref)
+	forms := make([]ref, len(pages))
+	open := doc.add(&stream{dict: dict{}, data: []byte("q\n")})
+	for i, pg := range pages {
+		l := layout{pg.mediaBox, pg.rotate}
+		form, ok := stamps[l]
+		if !ok {
+			content := w.content(text, img, pg.mediaBox, pg.rotate)
+			form = doc.add(&stream{
+				dict: dict{
+					"Type":      name("XObject"),
+					"Subtype":   name("Form"),
+					"BBox":      []any{pg.mediaBox[0], pg.mediaBox[1], pg.mediaBox[2], pg.mediaBox[3]},
+					"Resources": res,
+				},
+				data: content,
+			})
+			stamps[l] = form
+		}
+		forms[i] = form
+	}
+
+	// Pages are prepared in parallel, then added in order, so the output
+	// is the same however the work was scheduled.
+	stamped := make([]stampedPage, len(pages))
+	err = doc.eachPage(pages, func(i int, pg page) error {
+		var err error
+		stamped[i], err = stampPage(doc, pg, open, forms[i])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i, sp := range stamped {
+		sp.dict["Contents"] = append(sp.contents, doc.add(&stream{dict: dict{}, data: sp.draw}))
+		doc.set(pages[i].ref, sp.dict)
+	}
+	return nil
+}
+
+// stampedPage is a page prepared by stampPage, still to be given the stream
+// drawing its stamp.
+type stampedPage struct {
+	dict     dict  // the page, with its new resources
+	contents []any // the page's content streams, after open
+	draw     []byte
+}
+
+// stampPage prepares the page's content to be wrapped in open and a stream
+// drawing form, and adds form to the page's resources.
+func stampPage(doc *Document, pg page, open, form ref) (stampedPage, error) {
+	res := maps.Clone(pg.resources)
+	if res == nil {
+		res = dict{}
+	}
+	xobjects, err := doc.resolveDict(res["XObject"])
+	if err != nil {
+		return stampedPage{}, err
+	}
+	xobjects = maps.Clone(xobjects)
+	if xobjects == nil {
+		xobjects = dict{}
+	}
+	key := name(stampName)
+	for i := 2; xobjects[key] != nil; i++ {
+		key = name(fmt.Sprintf("%s%d", stampName, i))
+	}
+	xobjects[key] = form
+	res["XObject"] = xobjects
+
+	var draw bytes.Buffer
+	draw.WriteString("\nQ\nq ")
+	write(&draw, key)
+	draw.WriteString(" Do Q\n")
+
+	contents := []any{open}
+	orig, err := doc.resolve(pg.dict["Contents"])
+	if err != nil {
+		return stampedPage{}, err
+	}
+	switch orig := orig.(type) {
+	case *stream:
+		contents = append(contents, pg.dict["Contents"])
+	case []any:
+		contents = append(contents, orig...)
+	}
+
+	pd := maps.Clone(pg.dict)
+	pd["Resources"] = res
+	return stampedPage{dict: pd, contents: contents, draw: draw.Bytes()}, nil
+}
+
+// placedImage is an image XObject added to the document.
+type placedImage struct {
+	ref           ref
+	width, height int
+}
+
+// CheckImage returns ErrWatermarkImage if data cannot be a Watermark's
+// image, without decoding all of it.
+func CheckImage(data []byte) error {
+	if _, ok := jpegColorSpace(data); ok {
+		return nil
+	}
+	// A small PNG can decode to a huge image.
+	if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err == nil && cfg.Width*cfg.Height <= maxImagePixels {
+		return nil
+	}
+	return ErrWatermarkImage
+}
+
+// jpegColorSpace returns the PDF colour space of a JPEG, if data is one
+// pdfpost can embed.
+func jpegColorSpace(data []byte) (name, bool) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	switch {
+	case err != nil:
+		return "", false
+	case cfg.ColorModel == color.GrayModel:
+		return "DeviceGray", true
+	case cfg.ColorModel == color.YCbCrModel:
+		return "DeviceRGB", true
+	}
+	return "", false
+}
+
+// addImage adds a PNG or JPEG as an image XObject.
+func addImage(doc *Document, data []byte) (*placedImage, error) {
+	if err := CheckImage(data); err != nil {
+		return nil, err
+	}
+	if cs, ok := jpegColorSpace(data); ok {
+		// JPEG data is embedded as it is; PDF readers decode it.
+		cfg, _ := jpeg.DecodeConfig(bytes.NewReader(data))
+		r := doc.add(&stream{dict: dict{
+			"Type":             name("XObject"),
+			"Subtype":          name("Image"),
+			"Width":            cfg.Width,
+			"Height":           cfg.Height,
+			"ColorSpace":       cs,
+			"BitsPerComponent": 8,
+			"Filter":           name("DCTDecode"),
+		}, data: data})
+		return &placedImage{r, cfg.Width, cfg.Height}, nil
+	}
+
+	m, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrWatermarkImage
+	}
+	b := m.Bounds()
+	rgb := make([]byte, 0, 3*b.Dx()*b.Dy())
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+	d := dict{
+		"Type":             name("XObject"),
+		"Subtype":          name("Image"),
+		"Width":            b.Dx(),
+		"Height":           b.Dy(),
+		"ColorSpace":       name("DeviceRGB"),
+		"BitsPerComponent": 8,
+		"Filter":           name("FlateDecode"),
+	}
+	if !opaque {
+		d["SMask"] = doc.add(&stream{dict: dict{
+			"Type":             name("XObject"),
+			"Subtype":          name("Image"),
+			"Width":            b.Dx(),
+			"Height":           b.Dy(),
+			"ColorSpace":       name("DeviceGray"),
+			"BitsPerComponent": 8,
+			"Filter":           name("FlateDecode"),
+		}, data: deflate(alpha)})
+	}
+	r := doc.add(&stream{dict: d, data: deflate(rgb)})
+	return &placedImage{r, b.Dx(), b.Dy()}, nil
+}
+
+// maxImagePixels bounds the size of a PNG watermark once decoded.
+const maxImagePixels = 4096 * 4096
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// content returns the content stream of the stamp for a page with media box
+// box displayed rotated by rotate degrees.
+func (w Watermark) content(text []byte, img *placedImage, box [4]float64, rotate int) []byte {
+	llx, lly, urx, ury := box[0], box[1], box[2], box[3]
+	width, height := urx-llx, ury-lly
+	var b bytes.Buffer
+	b.WriteString("q\n")
+	// Draw in the coordinates of the page as displayed: origin at its
+	// bottom left, whichever way up the page is stored.
+	switch rotate {
+	case 90:
+		fmt.Fprintf(&b, "0 1 -1 0 %s %s cm\n", formatReal(urx), formatReal(lly))
+		width, height = height, width
+	case 180:
+		fmt.Fprintf(&b, "-1 0 0 -1 %s %s cm\n", formatReal(urx), formatReal(ury))
+	case 270:
+		fmt.Fprintf(&b, "0 -1 1 0 %s %s cm\n", formatReal(llx), formatReal(ury))
+		width, height = height, width
+	default:
+		fmt.Fprintf(&b, "1 0 0 1 %s %s cm\n", formatReal(llx), formatReal(lly))
+	}
+	b.WriteString("/GS1 gs\n")
+
+	if img != nil {
+		// Fit the image in half the page, or in a band along the edge.
+		maxW, maxH := width/2, height/2
+		if w.Position == PositionTop || w.Position == PositionBottom {
+			maxH = min(maxH, 48)
+		}
+		scale := min(maxW/float64(img.width), maxH/float64(img.height))
+		iw, ih := float64(img.width)*scale, float64(img.height)*scale
+		x, y := (width-iw)/2, (height-ih)/2
+		switch w.Position {
+		case PositionTop:
+			y = height - edgeMargin - ih
+		case PositionBottom:
+			y = edgeMargin
+		}
+		fmt.Fprintf(&b, "q %s 0 0 %s %s %s cm /Im1 Do Q\n", formatReal(round(iw)), formatReal(round(ih)), formatReal(round(x)), formatReal(round(y)))
+	}
+
+	if len(text) > 0 {
+		units := textWidth(text) // per point of font size
+		var size, cos, sin, x, y float64
+		switch w.Position {
+		case PositionTop, PositionBottom:
+			size = min(12, 0.9*width/units)
+			cos, x = 1, (width-size*units)/2
+			y = edgeMargin
+			if w.Position == PositionTop {
+				y = height - edgeMargin - size
+			}
+		case PositionCenter:
+			size = min(96, 0.8*width/units)
+			cos, x, y = 1, (width-size*units)/2, (height-capHeight*size)/2
+		default:
+			diag := math.Hypot(width, height)
+			size = min(144, 0.7*diag/units)
+			cos, sin = width/diag, height/diag
+			// Start so the text's middle lands on the page's.
+			dx, dy := -size*units/2, -capHeight*size/2
+			x = width/2 + dx*cos - dy*sin
+			y = height/2 + dx*sin + dy*cos
+		}
+		b.WriteString("BT\n0.5 g\n")
+		fmt.Fprintf(&b, "/F1 %s Tf\n", formatReal(round(size)))
+		fmt.Fprintf(&b, "%s %s %s %s %s %s Tm\n", formatReal(round(cos)), formatReal(round(sin)), formatReal(round(-sin)), formatReal(round(cos)), formatReal(round(x)), formatReal(round(y)))
+		write(&b, text)
+		b.WriteString(" Tj\nET\n")
+	}
+	b.WriteString("Q\n")
+	return b.Bytes()
+}
+
+// edgeMargin is the distance in points of a top or bottom watermark from
+// the edge of the page.
+const edgeMargin = 24
+
+// capHeight is Helvetica Bold's cap height as a fraction of its size.
+const capHeight = 0.718
+
+// round rounds f to three decimals, which is as precise as content streams
+// need be, and never to negative zero.
+func round(f float64) float64 {
+	return math.Round(f*1000)/1000 + 0
+}
+
+// winAnsi encodes s for a font with WinAnsiEncoding, which agrees with
+// Latin-1 on the characters kept.
+func winAnsi(s string) []byte {
+	var b []byte
+	for _, r := range s {
+		switch {
+		case r < ' ':
+			b = append(b, ' ')
+		case r < 0x7f || (r >= 0xa0 && r <= 0xff):
+			b = append(b, byte(r))
+		default:
+			b = append(b, '?')
+		}
+	}
+	return bytes.TrimSpace(b)
+}
+
+// textWidth returns the width of text set in Helvetica Bold at size 1.
+func textWidth(text []byte) float64 {
+	var units int
+	for _, c := range text {
+		if c >= ' ' && c <= '~' {
+			units += helveticaBoldWidths[c-' ']
+		} else {
+			units += 611 // Latin-1 letters are about as wide as "n"
+		}
+	}
+	return float64(units) / 1000
+}
+
+// helveticaBoldWidths are the glyph widths of Helvetica Bold, in thousandths
+// of the font size, for the characters from space to tilde.
+var helveticaBoldWidths = [...]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611, // 0 to ?
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556, // P to _
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611, // ` to o
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584, // p to ~
+}
@@ -0,0 +1,176 @@
+package pdfpost_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/pdfpost"
+)
+
+// stamp applies w to twoPages and returns the update it appended.
+func stamp(t *testing.T, w pdfpost.Watermark) []byte {
+	t.Helper()
+	orig := twoPages()
+	doc, err := pdfpost.Open(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	out := save(t, doc)
+	if _, err := pdfpost.Open(out); err != nil {
+		t.Fatalf("output does not reopen: %v", err)
+	}
+	return out[len(orig):]
+}
+
+func TestWatermark_Text(t *testing.T) {
+	update := stamp(t, pdfpost.Watermark{Text: "Acme – draft", Opacity: 0.5})
+	for _, want := range []string{
+		"(Acme ? draft) Tj", // the en dash is outside Latin-1
+		"/CA 0.5",
+		"/ca 0.5",
+		// Page 1 keeps its content, wrapped between the stamp's streams.
+		"/Contents [12 0 R 5 0 R ",
+		// Page 2 is drawn the way it is displayed, a quarter turn round.
+		"0 1 -1 0 595 0 cm",
+		// Both pages keep the resources they inherited.
+		"/F1 7 0 R",
+	} {
+		if !bytes.Contains(update, []byte(want)) {
+			t.Errorf("update lacks %q", want)
+		}
+	}
+	if n := bytes.Count(update, []byte("/Subtype /Form")); n != 2 {
+		t.Errorf("expected a stamp per page layout, got %d", n)
+	}
+}
+
+func TestWatermark_Positions(t *testing.T) {
+	diagonal := stamp(t, pdfpost.Watermark{Text: "X"})
+	top := stamp(t, pdfpost.Watermark{Text: "X", Position: pdfpost.PositionTop})
+	if bytes.Equal(diagonal, top) {
+		t.Error("position made no difference")
+	}
+	// A diagonal on an A4 portrait page rises at atan(842/595).
+	if !bytes.Contains(diagonal, []byte("0.577 0.817 -0.817 0.577 ")) {
+		t.Error("diagonal text not rotated corner to corner")
+	}
+	if !bytes.Contains(top, []byte("/F1 12 Tf\n1 0 0 1 ")) {
+		t.Error("top text not set upright at 12pt")
+	}
+}
+
+func TestWatermark_Image(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	m.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, m, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	update := stamp(t, pdfpost.Watermark{Image: pngData.Bytes()})
+	for _, want := range []string{"/Filter /FlateDecode", "/SMask ", "/Im1 Do"} {
+		if !bytes.Contains(update, []byte(want)) {
+			t.Errorf("png update lacks %q", want)
+		}
+	}
+	// Half the page's width, keeping the 2:1 aspect.
+	if !bytes.Contains(update, []byte("q 297.5 0 0 148.75 ")) {
+		t.Error("png not scaled to half the page")
+	}
+
+	update = stamp(t, pdfpost.Watermark{Image: jpegData.Bytes()})
+	if !bytes.Contains(update, []byte("/Filter /DCTDecode")) || !bytes.Contains(update, jpegData.Bytes()) {
+		t.Error("jpeg not embedded as it is")
+	}
+
+	doc, err := pdfpost.Open(twoPages())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (pdfpost.Watermark{Image: []byte("GIF89a")}).Apply(doc); !errors.Is(err, pdfpost.ErrWatermarkImage) {
+		t.Errorf("expected ErrWatermarkImage, got %v", err)
+	}
+}
+
+func TestWatermark_Parallel(t *testing.T) {
+	// Pages of three sizes, each with its own content stream.
+	const n = 60
+	objs := []string{"<</Type /Catalog /Pages 2 0 R>>", ""}
+	kids := ""
+	for i := range n {
+		page, content := len(objs)+1, len(objs)+2
+		kids += fmt.Sprintf("%d 0 R ", page)
+		objs = append(objs,
+			fmt.Sprintf("<</Type /Page /Parent 2 0 R /MediaBox [0 0 %d 842] /Contents %d 0 R>>", 595+i%3, content),
+			"<</Length 3>>\nstream\n0 g\nendstream",
+		)
+	}
+	objs[1] = fmt.Sprintf("<</Type /Pages /Kids [%s] /Count %d>>", kids, n)
+	orig := buildPDF("", objs...)
+
+	var outs [][]byte
+	for _, workers := range []int{1, 8} {
+		doc, err := pdfpost.Open(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.SetWorkers(workers)
+		if err := (pdfpost.Watermark{Text: "DRAFT"}).Apply(doc); err != nil {
+			t.Fatal(err)
+		}
+		outs = append(outs, save(t, doc))
+	}
+	if !bytes.Equal(outs[0], outs[1]) {
+		t.Error("output depends on the number of workers")
+	}
+	update := outs[1][len(orig):]
+	if got := bytes.Count(update, []byte("/DocPdfStamp Do")); got != n {
+		t.Errorf("%d pages stamped, want %d", got, n)
+	}
+	if got := bytes.Count(update, []byte("/Subtype /Form")); got != 3 {
+		t.Errorf("%d stamps, want one per page size", got)
+	}
+}
+
+func TestWatermark_Empty(t *testing.T) {
+	orig := twoPages()
+	doc, err := pdfpost.Open(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (pdfpost.Watermark{Text: "   "}).Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(save(t, doc), orig) {
+		t.Error("blank watermark changed the document")
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	for in, want := range map[string]pdfpost.Position{
+		"":         pdfpost.PositionDiagonal,
+		"Center":   pdfpost.PositionCenter,
+		" top ":    pdfpost.PositionTop,
+		"bottom":   pdfpost.PositionBottom,
+		"diagonal": pdfpost.PositionDiagonal,
+	} {
+		if got, err := pdfpost.ParsePosition(in); err != nil || got != want {
+			t.Errorf("ParsePosition(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := pdfpost.ParsePosition("left"); err == nil {
+		t.Error("expected an error for an unknown position")
+	}
+}
@@ -0,0 +1,170 @@
+// Package pool bounds the number of concurrent conversions and the number of
+// requests allowed to wait for a free slot.
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueueFull is returned by Acquire when the wait queue is already at
+// capacity. Callers should reject the request (503) rather than block.
+var ErrQueueFull = errors.New("conversion queue full")
+
+// Observer is notified of the pool's occupancy, e.g. for metrics.
+type Observer interface {
+	// PoolChanged is called with the number of held slots and of queued
+	// requests each time either changes.
+	PoolChanged(busy, waiting int)
+	// PoolWaited is called with how long each successful Acquire waited
+	// for its slot; 0 when one was free.
+	PoolWaited(d time.Duration)
+}
+
+// Pool is a counting semaphore with a bounded wait queue. The zero value is
+// not usable; construct one with New.
+type Pool struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	waiting  int
+	maxQueue int
+	obs      Observer
+
+	// changed is when a slot was last taken or given back, in Unix
+	// nanoseconds.
+	changed atomic.Int64
+}
+
+// New returns a Pool that allows workers concurrent conversions and up to
+// maxQueue requests waiting for a slot.
+func New(workers, maxQueue int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	p := &Pool{
+		slots:    make(chan struct{}, workers),
+		maxQueue: maxQueue,
+	}
+	p.changed.Store(time.Now().UnixNano())
+	return p
+}
+
+// SetObserver makes p report its occupancy to o. It must be called before p
+// is used.
+func (p *Pool) SetObserver(o Observer) {
+	p.obs = o
+	p.notify()
+}
+
+// notify reports the current occupancy to the observer. Reading it under
+// p.mu orders the reports, so the last one always holds the latest values.
+func (p *Pool) notify() {
+	if p.obs == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.obs.PoolChanged(len(p.slots), p.waiting)
+}
+
+// Workers returns the number of concurrent conversion slots.
+func (p *Pool) Workers() int { return cap(p.slots) }
+
+// Busy returns the number of slots currently held.
+func (p *Pool) Busy() int { return len(p.slots) }
+
+// Waiting returns the number of requests currently queued for a slot.
+func (p *Pool) Waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.waiting
+}
+
+// Stalled reports whether every slot has been held, with none taken or given
+// back, for longer than after. Conversions are bounded by their timeouts, so
+// a pool that stays full past the longest of them has leaked slots and will
+// never serve another request.
+func (p *Pool) Stalled(after time.Duration) bool {
+	if len(p.slots) < cap(p.slots) {
+		return false
+	}
+	return time.Since(time.Unix(0, p.changed.Load())) > after
+}
+
+// Position reports where a request arriving now would land: 0 means a slot is
+// free and it would start immediately, n > 0 means it would be n-th in the
+// queue. full is true when the queue is at capacity and the request would be
+// rejected.
+func (p *Pool) Position() (pos int, full bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.slots) < cap(p.slots) && p.waiting == 0 {
+		return 0, false
+	}
+	if p.waiting >= p.maxQueue {
+		return p.waiting + 1, true
+	}
+	return p.waiting + 1, false
+}
+
+// Acquire blocks until a slot is free, ctx is done, or the queue is full.
+// On success the returned release func must be called exactly once.
+func (p *Pool) Acquire(ctx context.Context) (release func(), err error) {
+	// Fast path: take a free slot without queueing.
+	select {
+	case p.slots <- struct{}{}:
+		p.acquired(0)
+		return p.release, nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.waiting >= p.maxQueue {
+		p.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	p.waiting++
+	p.mu.Unlock()
+	p.notify()
+
+	start := time.Now()
+	select {
+	case p.slots <- struct{}{}:
+		p.dequeue()
+		p.acquired(time.Since(start))
+		return p.release, nil
+	case <-ctx.Done():
+		p.dequeue()
+		p.notify()
+		return nil, ctx.Err()
+	}
+}
+
+// dequeue takes a request that stopped waiting off the queue.
+func (p *Pool) dequeue() {
+	p.mu.Lock()
+	p.waiting--
+	p.mu.Unlock()
+}
+
+// acquired records a slot taken after waiting waited.
+func (p *Pool) acquired(waited time.Duration) {
+	p.changed.Store(time.Now().UnixNano())
+	p.notify()
+	if p.obs != nil {
+		p.obs.PoolWaited(waited)
+	}
+}
+
+func (p *Pool) release() {
+	<-p.slots
+	p.changed.Store(time.Now().UnixNano())
+	p.notify()
+}
@@ -0,0 +1,179 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/pool"
+)
+
+func TestAcquire_FreeSlot(t *testing.T) {
+	p := pool.New(1, 0)
+	if pos, full := p.Position(); pos != 0 || full {
+		t.Fatalf("expected free slot, got pos=%d full=%v", pos, full)
+	}
+	release, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Busy() != 1 {
+		t.Errorf("expected 1 busy, got %d", p.Busy())
+	}
+	release()
+	if p.Busy() != 0 {
+		t.Errorf("expected 0 busy after release, got %d", p.Busy())
+	}
+}
+
+func TestAcquire_QueueFull(t *testing.T) {
+	p := pool.New(1, 0)
+	release, _ := p.Acquire(context.Background())
+	defer release()
+
+	if _, full := p.Position(); !full {
+		t.Fatal("expected queue to report full")
+	}
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, pool.ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestAcquire_WaitsForRelease(t *testing.T) {
+	p := pool.New(1, 1)
+	release, _ := p.Acquire(context.Background())
+
+	acquired := make(chan struct{})
+	go func() {
+		r, err := p.Acquire(context.Background())
+		if err == nil {
+			r()
+		}
+		close(acquired)
+	}()
+
+	// Wait until the second caller is queued.
+	deadline := time.Now().Add(time.Second)
+	for p.Waiting() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second caller never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if pos, full := p.Position(); pos != 2 || !full {
+		t.Errorf("expected pos=2 full=true, got pos=%d full=%v", pos, full)
+	}
+
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("queued caller did not acquire after release")
+	}
+}
+
+func TestAcquire_ContextCancelled(t *testing.T) {
+	p := pool.New(1, 1)
+	release, _ := p.Acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if p.Waiting() != 0 {
+		t.Errorf("expected queue to drain after cancel, got %d waiting", p.Waiting())
+	}
+}
+
+func TestStalled(t *testing.T) {
+	p := pool.New(2, 0)
+	if p.Stalled(0) {
+		t.Fatal("an idle pool is not stalled")
+	}
+	r1, _ := p.Acquire(context.Background())
+	time.Sleep(5 * time.Millisecond)
+	if p.Stalled(time.Millisecond) {
+		t.Fatal("a pool with a free slot is not stalled")
+	}
+	r2, _ := p.Acquire(context.Background())
+	if p.Stalled(time.Hour) {
+		t.Fatal("a pool that just filled up is not stalled")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !p.Stalled(time.Millisecond) {
+		t.Fatal("expected a full pool without progress to be stalled")
+	}
+	r1()
+	r2()
+	if p.Stalled(0) {
+		t.Fatal("releasing slots should clear the stall")
+	}
+}
+
+type recorder struct {
+	mu      sync.Mutex
+	busy    int
+	waiting int
+	waits   []time.Duration
+}
+
+func (r *recorder) PoolChanged(busy, waiting int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.busy, r.waiting = busy, waiting
+}
+
+func (r *recorder) PoolWaited(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waits = append(r.waits, d)
+}
+
+func (r *recorder) state() (busy, waiting, waits int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.busy, r.waiting, len(r.waits)
+}
+
+func TestObserver(t *testing.T) {
+	p := pool.New(1, 1)
+	rec := &recorder{}
+	p.SetObserver(rec)
+
+	release, _ := p.Acquire(context.Background())
+	if busy, waiting, waits := rec.state(); busy != 1 || waiting != 0 || waits != 1 || rec.waits[0] != 0 {
+		t.Fatalf("after a free acquire: busy=%d waiting=%d waits=%v", busy, waiting, rec.waits)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		r, _ := p.Acquire(context.Background())
+		acquired <- r
+	}()
+	deadline := time.Now().Add(time.Second)
+	for _, waiting, _ := rec.state(); waiting != 1; _, waiting, _ = rec.state() {
+		if time.Now().After(deadline) {
+			t.Fatal("observer never saw the queued request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	release()
+	release = <-acquired
+
+	busy, waiting, waits := rec.state()
+	if busy != 1 || waiting != 0 || waits != 2 {
+		t.Fatalf("after a queued acquire: busy=%d waiting=%d waits=%d", busy, waiting, waits)
+	}
+	if rec.waits[1] < 5*time.Millisecond {
+		t.Errorf("expected the queued wait to be recorded, got %v", rec.waits[1])
+	}
+	release()
+	if busy, _, _ := rec.state(); busy != 0 {
+		t.Errorf("expected 0 busy after release, got %d", busy)
+	}
+}
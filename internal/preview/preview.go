@@ -0,0 +1,146 @@
+// Package preview renders a page of a PDF to an image, for document preview
+// thumbnails.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+)
+
+// Image formats accepted in Options.Format.
+const (
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+)
+
+// Bounds of Options.DPI and Options.Width.
+const (
+	MinDPI   = 10
+	MaxDPI   = 600
+	MinWidth = 16
+	MaxWidth = 4096
+)
+
+// DefaultDPI is the resolution used when Options sets neither DPI nor Width:
+// a pixel per point.
+const DefaultDPI = 72
+
+// ErrInvalidOptions is returned for Options out of bounds.
+var ErrInvalidOptions = errors.New("invalid preview options")
+
+// Options controls the image rendered. The zero value renders a PNG at
+// DefaultDPI.
+type Options struct {
+	// Format is FormatPNG or FormatJPEG. Empty means PNG.
+	Format string
+	// DPI is the rendering resolution, from MinDPI to MaxDPI.
+	DPI int
+	// Width scales the page to this many pixels wide, keeping its aspect
+	// ratio, from MinWidth to MaxWidth. It cannot be combined with DPI.
+	Width int
+}
+
+// Validate checks o against the bounds.
+func (o Options) Validate() error {
+	switch {
+	case o.Format != "" && o.Format != FormatPNG && o.Format != FormatJPEG:
+		return fmt.Errorf("%w: format %q", ErrInvalidOptions, o.Format)
+	case o.DPI != 0 && o.Width != 0:
+		return fmt.Errorf("%w: both dpi and width", ErrInvalidOptions)
+	case o.DPI != 0 && (o.DPI < MinDPI || o.DPI > MaxDPI):
+		return fmt.Errorf("%w: dpi %d", ErrInvalidOptions, o.DPI)
+	case o.Width != 0 && (o.Width < MinWidth || o.Width > MaxWidth):
+		return fmt.Errorf("%w: width %d", ErrInvalidOptions, o.Width)
+	}
+	return nil
+}
+
+// ParseFormat parses an image format name; "jpg" is taken for JPEG.
+func ParseFormat(s string) (string, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case FormatPNG, FormatJPEG:
+		return s, nil
+	case "jpg":
+		return FormatJPEG, nil
+	}
+	return "", fmt.Errorf("%w: format %q", ErrInvalidOptions, s)
+}
+
+// ContentType returns the media type of images in format.
+func ContentType(format string) string {
+	if format == FormatJPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Renderer renders one page of a PDF, numbered from 1.
+type Renderer interface {
+	Render(ctx context.Context, pdfPath string, page int, opts Options) ([]byte, error)
+}
+
+// Pdftoppm renders with poppler's pdftoppm.
+type Pdftoppm struct {
+	// Path is the pdftoppm executable. Default "pdftoppm".
+	Path string
+}
+
+// Render renders the page into a temp dir and returns the image.
+func (p Pdftoppm) Render(ctx context.Context, pdfPath string, page int, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	bin := p.Path
+	if bin == "" {
+		bin = "pdftoppm"
+	}
+	dir, err := os.MkdirTemp("", tempclean.Pattern("preview", ""))
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, bin, append(args(page, opts), pdfPath, root)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	// With -singlefile the image is named for the root alone.
+	ext := ".png"
+	if opts.Format == FormatJPEG {
+		ext = ".jpg"
+	}
+	data, err := os.ReadFile(root + ext)
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm rendered no page %d", page)
+	}
+	return data, nil
+}
+
+// args are the pdftoppm options rendering page with opts.
+func args(page int, opts Options) []string {
+	n := strconv.Itoa(page)
+	a := []string{"-f", n, "-l", n, "-singlefile"}
+	if opts.Format == FormatJPEG {
+		a = append(a, "-jpeg")
+	} else {
+		a = append(a, "-png")
+	}
+	switch {
+	case opts.Width != 0:
+		a = append(a, "-scale-to-x", strconv.Itoa(opts.Width), "-scale-to-y", "-1")
+	case opts.DPI != 0:
+		a = append(a, "-r", strconv.Itoa(opts.DPI))
+	default:
+		a = append(a, "-r", strconv.Itoa(DefaultDPI))
+	}
+	return a
+}
@@ -0,0 +1,84 @@
+package preview_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/preview"
+)
+
+// fakePdftoppm writes a script that records its arguments in argFile and,
+// like pdftoppm -singlefile, writes the image to <root>.<ext>.
+func fakePdftoppm(t *testing.T, ext string) (path, argFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	argFile = filepath.Join(dir, "args")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\nfor last; do :; done\nprintf image > \"$last.%s\"\n", argFile, ext)
+	path = filepath.Join(dir, "pdftoppm")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, argFile
+}
+
+func TestPdftoppm_Render(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts preview.Options
+		ext  string
+		args string
+	}{
+		"default": {preview.Options{}, "png", "-f 3 -l 3 -singlefile -png -r 72 doc.pdf"},
+		"dpi":     {preview.Options{DPI: 150}, "png", "-f 3 -l 3 -singlefile -png -r 150 doc.pdf"},
+		"width":   {preview.Options{Format: preview.FormatJPEG, Width: 320}, "jpg", "-f 3 -l 3 -singlefile -jpeg -scale-to-x 320 -scale-to-y -1 doc.pdf"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bin, argFile := fakePdftoppm(t, tc.ext)
+			img, err := preview.Pdftoppm{Path: bin}.Render(context.Background(), "doc.pdf", 3, tc.opts)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if string(img) != "image" {
+				t.Errorf("image = %q", img)
+			}
+			args, _ := os.ReadFile(argFile)
+			if got := strings.TrimSpace(string(args)); !strings.HasPrefix(got, tc.args+" ") {
+				t.Errorf("args = %q, want %q followed by the output root", got, tc.args)
+			}
+		})
+	}
+}
+
+func TestPdftoppm_Failure(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "pdftoppm")
+	_ = os.WriteFile(script, []byte("#!/bin/sh\necho 'Wrong page range given' >&2\nexit 99\n"), 0755)
+	_, err := preview.Pdftoppm{Path: script}.Render(context.Background(), "doc.pdf", 9, preview.Options{})
+	if err == nil || !strings.Contains(err.Error(), "Wrong page range given") {
+		t.Fatalf("expected pdftoppm's message, got %v", err)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	for _, o := range []preview.Options{
+		{Format: "gif"},
+		{DPI: 5},
+		{DPI: 601},
+		{Width: 8},
+		{Width: 5000},
+		{DPI: 96, Width: 200},
+	} {
+		if err := o.Validate(); !errors.Is(err, preview.ErrInvalidOptions) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidOptions", o, err)
+		}
+	}
+	if err := (preview.Options{Format: preview.FormatJPEG, Width: 256}).Validate(); err != nil {
+		t.Errorf("valid options rejected: %v", err)
+	}
+	if f, err := preview.ParseFormat("JPG"); err != nil || f != preview.FormatJPEG {
+		t.Errorf("ParseFormat(JPG) = %q, %v", f, err)
+	}
+}
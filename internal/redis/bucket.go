@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// bucketScript refills the bucket at KEYS[1] to the server's clock, then
+// spends a token from it when ARGV[3] is 1. It returns whether a token was
+// spent and the tokens left, as a string since Lua numbers are truncated to
+// integers in replies. The bucket expires once it would have refilled, as a
+// missing bucket is a full one.
+const bucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(b[1]) or burst
+local last = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+if ARGV[3] ~= '1' then
+  return {0, tostring(tokens)}
+end
+local ok = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  ok = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {ok, tostring(tokens)}
+`
+
+var bucketSHA = func() string {
+	sum := sha1.Sum([]byte(bucketScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// Buckets is a set of token buckets kept in Redis, so every replica using
+// the same server and prefix draws from the same bucket for a key. The
+// buckets refill on the server's clock, not the replicas'.
+type Buckets struct {
+	client *Client
+	prefix string
+}
+
+// NewBuckets returns Buckets stored under keys starting with prefix.
+func NewBuckets(client *Client, prefix string) *Buckets {
+	return &Buckets{client: client, prefix: prefix}
+}
+
+// Take spends a token from key's bucket, which holds up to burst tokens and
+// refills at rate tokens a second. It reports whether there was one, and the
+// tokens left.
+func (b *Buckets) Take(ctx context.Context, key string, rate, burst float64) (bool, float64, error) {
+	return b.eval(ctx, key, rate, burst, true)
+}
+
+// Peek returns the tokens in key's bucket without spending any.
+func (b *Buckets) Peek(ctx context.Context, key string, rate, burst float64) (float64, error) {
+	_, tokens, err := b.eval(ctx, key, rate, burst, false)
+	return tokens, err
+}
+
+// eval runs bucketScript, by its SHA1 once the server has it cached.
+func (b *Buckets) eval(ctx context.Context, key string, rate, burst float64, take bool) (bool, float64, error) {
+	args := []string{"1", b.prefix + key,
+		strconv.FormatFloat(rate, 'g', -1, 64), strconv.FormatFloat(burst, 'g', -1, 64), "0"}
+	if take {
+		args[4] = "1"
+	}
+	reply, err := b.client.Do(ctx, append([]string{"EVALSHA", bucketSHA}, args...)...)
+	if rerr := Error(""); errors.As(err, &rerr) && rerr.Prefix() == "NOSCRIPT" {
+		reply, err = b.client.Do(ctx, append([]string{"EVAL", bucketScript}, args...)...)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	r, ok := reply.([]any)
+	if !ok || len(r) != 2 {
+		return false, 0, fmt.Errorf("redis: unexpected bucket reply %v", reply)
+	}
+	spent, _ := r[0].(int64)
+	s, _ := r[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("redis: unexpected bucket reply %v", reply)
+	}
+	return spent == 1, tokens, nil
+}
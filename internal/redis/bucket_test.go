@@ -0,0 +1,59 @@
+package redis_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/redis"
+)
+
+func TestBuckets_LoadsScriptOnce(t *testing.T) {
+	loaded := false
+	srv := newFakeServer(t, func(args []string) string {
+		switch {
+		case args[0] == "EVALSHA" && !loaded:
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		case args[0] == "EVAL":
+			loaded = true
+		}
+		if args[len(args)-1] == "1" {
+			return "*2\r\n:1\r\n$3\r\n1.5\r\n"
+		}
+		return "*2\r\n:0\r\n$4\r\n0.25\r\n"
+	})
+	c := redis.New(redis.Options{Addr: srv.addr})
+	defer c.Close()
+	b := redis.NewBuckets(c, "docpdf:ratelimit:")
+	ctx := context.Background()
+
+	ok, tokens, err := b.Take(ctx, "key:acme", 0.5, 3)
+	if err != nil || !ok || tokens != 1.5 {
+		t.Fatalf("Take = %v, %v, %v", ok, tokens, err)
+	}
+	if tokens, err := b.Peek(ctx, "key:acme", 0.5, 3); err != nil || tokens != 0.25 {
+		t.Fatalf("Peek = %v, %v", tokens, err)
+	}
+
+	cmds := srv.commands()
+	var names []string
+	for _, cmd := range cmds {
+		names = append(names, cmd[0])
+	}
+	if got := strings.Join(names, " "); got != "EVALSHA EVAL EVALSHA" {
+		t.Fatalf("commands %s, want the script sent once", got)
+	}
+	if got := strings.Join(cmds[2][2:], " "); got != "1 docpdf:ratelimit:key:acme 0.5 3 0" {
+		t.Errorf("EVALSHA args %q", got)
+	}
+}
+
+func TestBuckets_Empty(t *testing.T) {
+	srv := newFakeServer(t, func([]string) string { return "*2\r\n:0\r\n$4\r\n0.75\r\n" })
+	c := redis.New(redis.Options{Addr: srv.addr})
+	defer c.Close()
+	ok, tokens, err := redis.NewBuckets(c, "").Take(context.Background(), "ip:10.0.0.1", 1, 1)
+	if err != nil || ok || tokens != 0.75 {
+		t.Errorf("Take = %v, %v, %v; want refused with 0.75 left", ok, tokens, err)
+	}
+}
@@ -0,0 +1,289 @@
+// Package redis is a minimal Redis client speaking RESP2 over TCP (or TLS),
+// with just enough of the protocol for the shared rate limiter's token
+// buckets: commands, scripts and a small connection pool.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned by Do for a nil reply.
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply from the server, such as "NOSCRIPT No matching
+// script".
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Prefix returns the error code, the first word of the reply.
+func (e Error) Prefix() string {
+	code, _, _ := strings.Cut(string(e), " ")
+	return code
+}
+
+// Options configures a Client.
+type Options struct {
+	// Addr is the server's host:port.
+	Addr string
+	// Username and Password authenticate each connection with AUTH when
+	// Password is set; Username needs Redis 6 ACLs.
+	Username string
+	Password string
+	// DB is the database selected on each connection.
+	DB int
+	// TLS, if set, connects with TLS.
+	TLS *tls.Config
+	// Timeout bounds dialling and each command's round trip, as well as
+	// the context does. Default 2s.
+	Timeout time.Duration
+	// PoolSize is the number of idle connections kept. Default 8.
+	PoolSize int
+}
+
+// ParseURL parses a redis://[[user]:password@]host[:port][/db] URL, or
+// rediss:// for TLS. The port defaults to 6379.
+func ParseURL(s string) (Options, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		// The error quotes the URL, password and all.
+		return Options{}, errors.New("redis: malformed URL")
+	}
+	var o Options
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		o.TLS = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return Options{}, fmt.Errorf("redis: unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return Options{}, fmt.Errorf("redis: no host in %q", u.Redacted())
+	}
+	o.Addr = u.Host
+	if u.Port() == "" {
+		o.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		o.Username = u.User.Username()
+		o.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if o.DB, err = strconv.Atoi(db); err != nil || o.DB < 0 {
+			return Options{}, fmt.Errorf("redis: invalid database %q", db)
+		}
+	}
+	return o, nil
+}
+
+// Client sends commands to one Redis server. It is safe for concurrent use;
+// each command takes a connection from the pool, or dials one.
+type Client struct {
+	opts Options
+	idle chan *conn
+	once sync.Once
+	done chan struct{}
+}
+
+// New returns a Client for opts. Nothing is dialled until the first command.
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 8
+	}
+	return &Client{opts: opts, idle: make(chan *conn, opts.PoolSize), done: make(chan struct{})}
+}
+
+// Close closes the idle connections; those in use are closed when returned.
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.done) })
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Do sends a command and returns its reply: a string for simple strings and
+// bulk strings, an int64 for integers, []any for arrays (nil elements for
+// nil replies), ErrNil for a nil reply and Error for an error reply.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, c.opts.Timeout, args)
+	var rerr Error
+	if err != nil && !errors.Is(err, ErrNil) && !errors.As(err, &rerr) {
+		// The connection is in an unknown state.
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// get takes an idle connection or dials a new one.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	d := net.Dialer{Timeout: c.opts.Timeout}
+	var nc net.Conn
+	var err error
+	if c.opts.TLS != nil {
+		nc, err = (&tls.Dialer{NetDialer: &d, Config: c.opts.TLS}).DialContext(ctx, "tcp", c.opts.Addr)
+	} else {
+		nc, err = d.DialContext(ctx, "tcp", c.opts.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	if c.opts.Password != "" {
+		auth := []string{"AUTH", c.opts.Password}
+		if c.opts.Username != "" {
+			auth = []string{"AUTH", c.opts.Username, c.opts.Password}
+		}
+		if _, err := cn.do(ctx, c.opts.Timeout, auth); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.do(ctx, c.opts.Timeout, []string{"SELECT", strconv.Itoa(c.opts.DB)}); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// put returns a connection to the pool, or closes it when the pool is full
+// or the client closed.
+func (c *Client) put(cn *conn) {
+	select {
+	case <-c.done:
+		cn.Close()
+		return
+	default:
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// conn is one connection and its reader.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do writes a command and reads its reply, within timeout and ctx.
+func (cn *conn) do(ctx context.Context, timeout time.Duration, args []string) (reply any, err error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// Cancelling ctx expires the deadline, failing the read or write in
+	// progress.
+	stop := context.AfterFunc(ctx, func() { cn.SetDeadline(time.Unix(1, 0)) })
+	defer func() {
+		if !stop() && ctx.Err() != nil {
+			reply, err = nil, fmt.Errorf("redis: %w", ctx.Err())
+		}
+	}()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(cn, b.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readReply(cn.r)
+}
+
+// readReply reads one RESP2 reply.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer %q", body)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		case n < 0:
+			return nil, ErrNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		case n < 0:
+			return nil, ErrNil
+		}
+		elems := make([]any, n)
+		for i := range elems {
+			v, err := readReply(r)
+			var rerr Error
+			switch {
+			case errors.Is(err, ErrNil):
+			case errors.As(err, &rerr):
+				elems[i] = rerr
+			case err != nil:
+				return nil, err
+			default:
+				elems[i] = v
+			}
+		}
+		return elems, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
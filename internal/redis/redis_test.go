@@ -0,0 +1,202 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/redis"
+)
+
+// fakeServer answers each command with the raw RESP reply reply returns,
+// recording the commands in order.
+type fakeServer struct {
+	addr  string
+	reply func(args []string) string
+
+	mu    sync.Mutex
+	cmds  [][]string
+	conns int
+}
+
+func newFakeServer(t *testing.T, reply func(args []string) string) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &fakeServer{addr: ln.Addr().String(), reply: reply}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.cmds = append(s.cmds, args)
+		s.mu.Unlock()
+		if _, err := io.WriteString(c, s.reply(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) commands() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cmds
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestClient_Replies(t *testing.T) {
+	srv := newFakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "AUTH", "SELECT":
+			return "+OK\r\n"
+		case "PING":
+			return "+PONG\r\n"
+		case "INCR":
+			return ":42\r\n"
+		case "GET":
+			if args[1] == "missing" {
+				return "$-1\r\n"
+			}
+			return "$5\r\nhe\r\no\r\n"
+		case "HMGET":
+			return "*3\r\n$1\r\na\r\n$-1\r\n:7\r\n"
+		}
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	})
+	c := redis.New(redis.Options{Addr: srv.addr, Username: "svc", Password: "s3cret", DB: 2})
+	defer c.Close()
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		args []string
+		want any
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"INCR", "n"}, int64(42)},
+		{[]string{"GET", "k"}, "he\r\no"},
+	} {
+		got, err := c.Do(ctx, tc.args...)
+		if err != nil || got != tc.want {
+			t.Errorf("%v = %#v, %v; want %#v", tc.args, got, err, tc.want)
+		}
+	}
+	arr, err := c.Do(ctx, "HMGET", "h", "a", "b", "c")
+	if a, ok := arr.([]any); err != nil || !ok || len(a) != 3 || a[0] != "a" || a[1] != nil || a[2] != int64(7) {
+		t.Errorf("HMGET = %#v, %v", arr, err)
+	}
+	if _, err := c.Do(ctx, "GET", "missing"); !errors.Is(err, redis.ErrNil) {
+		t.Errorf("nil reply = %v, want ErrNil", err)
+	}
+	var rerr redis.Error
+	if _, err := c.Do(ctx, "FLY"); !errors.As(err, &rerr) || rerr.Prefix() != "ERR" {
+		t.Errorf("error reply = %v", err)
+	}
+
+	// One connection, authenticated and on the database, served them all.
+	cmds := srv.commands()
+	if strings.Join(cmds[0], " ") != "AUTH svc s3cret" || strings.Join(cmds[1], " ") != "SELECT 2" {
+		t.Errorf("connection set up with %v", cmds[:2])
+	}
+	if srv.conns != 1 {
+		t.Errorf("dialled %d connections, want 1", srv.conns)
+	}
+}
+
+func TestClient_Cancelled(t *testing.T) {
+	hang := make(chan struct{})
+	t.Cleanup(func() { close(hang) })
+	srv := newFakeServer(t, func([]string) string { <-hang; return "+PONG\r\n" })
+	c := redis.New(redis.Options{Addr: srv.addr, Timeout: time.Minute})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := c.Do(ctx, "PING"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Do returned %v after its context was cancelled", d)
+	}
+}
+
+func TestClient_AuthFailure(t *testing.T) {
+	srv := newFakeServer(t, func([]string) string { return "-WRONGPASS invalid username-password pair\r\n" })
+	c := redis.New(redis.Options{Addr: srv.addr, Password: "wrong"})
+	defer c.Close()
+	var rerr redis.Error
+	if _, err := c.Do(context.Background(), "PING"); !errors.As(err, &rerr) || rerr.Prefix() != "WRONGPASS" {
+		t.Fatalf("expected WRONGPASS, got %v", err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	o, err := redis.ParseURL("rediss://:p%40ss@cache.internal/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Addr != "cache.internal:6379" || o.Password != "p@ss" || o.Username != "" || o.DB != 3 || o.TLS == nil {
+		t.Errorf("ParseURL = %+v", o)
+	}
+	if o, err = redis.ParseURL("redis://cache:6380"); err != nil || o.Addr != "cache:6380" || o.TLS != nil {
+		t.Errorf("ParseURL = %+v, %v", o, err)
+	}
+	for _, bad := range []string{"http://cache", "redis://", "redis://cache/db", "redis://:secret@cache:port"} {
+		_, err := redis.ParseURL(bad)
+		if err == nil {
+			t.Errorf("ParseURL(%q) accepted", bad)
+		} else if strings.Contains(err.Error(), "secret") {
+			t.Errorf("error %q leaks the password", err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package schedule runs recurring maintenance tasks in the background, each
+// at its own interval, and reports how their last runs went.
+//
+// Runs of one task never overlap: the next run is due an interval after the
+// previous one finished. A failed run is reported and the task keeps its
+// schedule; a panicking run is recovered and counted as failed.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Task is a recurring maintenance task.
+type Task struct {
+	// Name identifies the task in Status and metrics, e.g. "stats_save".
+	Name string
+	// Interval is the time between the end of one run and the start of the
+	// next. The first run is one Interval after the Scheduler starts.
+	Interval time.Duration
+	// Timeout bounds one run through its context. Default Interval.
+	Timeout time.Duration
+	// Run does the work.
+	Run func(ctx context.Context) error
+}
+
+// Observer is notified after every run, e.g. for metrics.
+type Observer interface {
+	TaskRan(name string, d time.Duration, err error)
+}
+
+// Config configures a Scheduler.
+type Config struct {
+	// Tasks are run at their intervals. Tasks with a zero Interval are
+	// left out, so a disabled task can be listed unconditionally.
+	Tasks []Task
+	// Observer, if set, receives the outcome of every run.
+	Observer Observer
+}
+
+// Status is the reported state of one task.
+type Status struct {
+	Name           string     `json:"name"`
+	Interval       string     `json:"interval"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+	LastRun        *time.Time `json:"last_run,omitempty"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRun        time.Time  `json:"next_run"`
+}
+
+// Scheduler runs tasks in the background.
+type Scheduler struct {
+	obs   Observer
+	tasks []*task
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// task is a Task with its run history.
+type task struct {
+	Task
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New starts a Scheduler running cfg.Tasks. Call Close to stop it.
+func New(cfg Config) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{obs: cfg.Observer, cancel: cancel}
+	now := time.Now()
+	for _, t := range cfg.Tasks {
+		if t.Interval <= 0 {
+			continue
+		}
+		if t.Timeout <= 0 {
+			t.Timeout = t.Interval
+		}
+		tk := &task{Task: t, status: Status{
+			Name:     t.Name,
+			Interval: t.Interval.String(),
+			NextRun:  now.Add(t.Interval).UTC(),
+		}}
+		s.tasks = append(s.tasks, tk)
+		s.wg.Add(1)
+		go s.loop(ctx, tk)
+	}
+	return s
+}
+
+func (s *Scheduler) loop(ctx context.Context, t *task) {
+	defer s.wg.Done()
+	timer := time.NewTimer(t.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, t)
+		timer.Reset(t.Interval)
+	}
+}
+
+// run runs t once and records the outcome.
+func (s *Scheduler) run(ctx context.Context, t *task) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := runRecovered(ctx, t.Run)
+	d := time.Since(start)
+
+	t.mu.Lock()
+	t.status.Runs++
+	started := start.UTC()
+	t.status.LastRun = &started
+	t.status.LastDurationMs = d.Milliseconds()
+	t.status.LastError = ""
+	if err != nil {
+		t.status.Failures++
+		t.status.LastError = err.Error()
+	}
+	t.status.NextRun = time.Now().Add(t.Interval).UTC()
+	t.mu.Unlock()
+
+	if s.obs != nil {
+		s.obs.TaskRan(t.Name, d, err)
+	}
+}
+
+func runRecovered(ctx context.Context, run func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+// Status returns the state of every scheduled task, in the order given.
+func (s *Scheduler) Status() []Status {
+	out := make([]Status, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		t.mu.Lock()
+		out = append(out, t.status)
+		t.mu.Unlock()
+	}
+	return out
+}
+
+// ServeHTTP serves GET /status: the state of every scheduled task.
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"tasks": s.Status()})
+}
+
+// Close stops the tasks, waiting for runs in progress, whose contexts are
+// cancelled, to return.
+func (s *Scheduler) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
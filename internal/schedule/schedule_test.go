@@ -0,0 +1,131 @@
+package schedule_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/schedule"
+)
+
+type observer struct {
+	mu   sync.Mutex
+	runs map[string][]error
+}
+
+func (o *observer) TaskRan(name string, _ time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.runs == nil {
+		o.runs = make(map[string][]error)
+	}
+	o.runs[name] = append(o.runs[name], err)
+}
+
+func (o *observer) count(name string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.runs[name])
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_RunsTasks(t *testing.T) {
+	obs := &observer{}
+	s := schedule.New(schedule.Config{
+		Observer: obs,
+		Tasks: []schedule.Task{
+			{Name: "ok", Interval: 5 * time.Millisecond, Run: func(context.Context) error { return nil }},
+			{Name: "broken", Interval: 5 * time.Millisecond, Run: func(context.Context) error { return errors.New("disk full") }},
+			{Name: "panics", Interval: 5 * time.Millisecond, Run: func(context.Context) error { panic("boom") }},
+			{Name: "disabled", Run: func(context.Context) error { t.Error("disabled task ran"); return nil }},
+		},
+	})
+	defer s.Close()
+	waitFor(t, func() bool { return obs.count("ok") >= 2 && obs.count("broken") >= 2 && obs.count("panics") >= 1 })
+	s.Close()
+
+	status := s.Status()
+	if len(status) != 3 {
+		t.Fatalf("expected the disabled task to be left out, got %+v", status)
+	}
+	byName := make(map[string]schedule.Status)
+	for _, st := range status {
+		byName[st.Name] = st
+	}
+	if st := byName["ok"]; st.Runs < 2 || st.Failures != 0 || st.LastRun == nil || st.LastError != "" {
+		t.Errorf("ok: %+v", st)
+	}
+	if st := byName["broken"]; st.Failures != st.Runs || st.LastError != "disk full" {
+		t.Errorf("broken: %+v", st)
+	}
+	if st := byName["panics"]; st.Failures == 0 || st.LastError != "panic: boom" {
+		t.Errorf("panics: %+v", st)
+	}
+}
+
+func TestScheduler_TimeoutAndClose(t *testing.T) {
+	ran := make(chan error, 1)
+	s := schedule.New(schedule.Config{Tasks: []schedule.Task{{
+		Name:     "slow",
+		Interval: time.Millisecond,
+		Timeout:  10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			select {
+			case ran <- ctx.Err():
+			default:
+			}
+			return ctx.Err()
+		},
+	}}})
+	if err := <-ran; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the run to time out, got %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not cancel the run in progress")
+	}
+}
+
+func TestScheduler_ServeHTTP(t *testing.T) {
+	s := schedule.New(schedule.Config{Tasks: []schedule.Task{
+		{Name: "stats_save", Interval: time.Hour, Run: func(context.Context) error { return nil }},
+	}})
+	defer s.Close()
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var body struct {
+		Tasks []map[string]any `json:"tasks"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Tasks) != 1 || body.Tasks[0]["name"] != "stats_save" || body.Tasks[0]["interval"] != "1h0m0s" || body.Tasks[0]["runs"] != 0.0 {
+		t.Errorf("unexpected body %s", rr.Body.String())
+	}
+	if _, ok := body.Tasks[0]["last_run"]; ok {
+		t.Error("expected no last_run before the first run")
+	}
+}
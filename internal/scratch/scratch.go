@@ -0,0 +1,295 @@
+// Package scratch hands out per-conversion working directories on a
+// memory-backed filesystem, such as a tmpfs, so that LibreOffice reads its
+// input and writes its output without touching the disk.
+//
+// Each directory reserves a fixed share of the filesystem, the per-conversion
+// limit. When every share is taken, or a conversion is known to need more,
+// the directory is made in the regular temp directory instead; a directory
+// that outgrows its share while in use is moved there.
+package scratch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLimit is the cancellation cause given to a conversion whose directory
+// outgrew the per-conversion limit.
+var ErrLimit = errors.New("scratch: conversion outgrew its scratch space")
+
+// Fallback reasons, as passed to Config.OnFallback.
+const (
+	// FallbackFull is a directory made on disk because every share of the
+	// scratch filesystem was taken.
+	FallbackFull = "full"
+	// FallbackLimit is a directory made on, or moved to, disk because its
+	// contents exceeded the per-conversion limit.
+	FallbackLimit = "limit"
+)
+
+// Config configures a Space.
+type Config struct {
+	// Dir is a directory on the memory-backed filesystem. It is created if
+	// it does not exist.
+	Dir string
+	// Capacity is how much of the filesystem may be reserved at once, in
+	// bytes. It should not exceed the filesystem's size.
+	Capacity int64
+	// Limit is the space reserved for, and allowed to, each directory.
+	Limit int64
+	// Interval is how often a watched directory's size is measured.
+	// Defaults to 250ms.
+	Interval time.Duration
+	// OnFallback, if set, is called with FallbackFull or FallbackLimit each
+	// time a directory is made on or moved to disk (e.g. for metrics).
+	OnFallback func(reason string)
+}
+
+// Space hands out directories on the scratch filesystem. A nil *Space makes
+// every directory on disk.
+type Space struct {
+	cfg Config
+
+	mu       sync.Mutex
+	reserved int64
+}
+
+// New returns a Space for cfg.
+func New(cfg Config) (*Space, error) {
+	if cfg.Limit <= 0 || cfg.Capacity < cfg.Limit {
+		return nil, fmt.Errorf("scratch: capacity %d cannot hold a limit of %d", cfg.Capacity, cfg.Limit)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 250 * time.Millisecond
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("scratch: %w", err)
+	}
+	probe, err := os.MkdirTemp(cfg.Dir, "docpdf-probe-*")
+	if err != nil {
+		return nil, fmt.Errorf("scratch: %w", err)
+	}
+	os.Remove(probe)
+	return &Space{cfg: cfg}, nil
+}
+
+// MkdirTemp makes a directory named after pattern, as os.MkdirTemp does.
+// size is how much the conversion is known to need, -1 if unknown; a size
+// over the limit puts the directory on disk from the start.
+func (s *Space) MkdirTemp(pattern string, size int64) (*Dir, error) {
+	d := &Dir{space: s, pattern: pattern}
+	if s != nil {
+		var reason string
+		s.mu.Lock()
+		switch {
+		case size > s.cfg.Limit:
+			reason = FallbackLimit
+		case s.reserved+s.cfg.Limit > s.cfg.Capacity:
+			reason = FallbackFull
+		default:
+			s.reserved += s.cfg.Limit
+			d.memory = true
+		}
+		s.mu.Unlock()
+		if d.memory {
+			path, err := os.MkdirTemp(s.cfg.Dir, pattern)
+			if err == nil {
+				d.path = path
+				return d, nil
+			}
+			d.release()
+			reason = FallbackFull
+		}
+		s.fellBack(reason)
+	}
+	path, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	d.path = path
+	return d, nil
+}
+
+func (s *Space) fellBack(reason string) {
+	if s.cfg.OnFallback != nil {
+		s.cfg.OnFallback(reason)
+	}
+}
+
+// Reserved returns how much of the scratch filesystem is reserved, in
+// bytes.
+func (s *Space) Reserved() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reserved
+}
+
+// Dir is a working directory made by a Space. Its methods must not be
+// called concurrently, except that Watch's check runs alongside the caller.
+type Dir struct {
+	space   *Space
+	pattern string
+	path    string
+	memory  bool // on the scratch filesystem, holding a reservation
+}
+
+// Path returns the directory's current path. It changes when the directory
+// is moved to disk.
+func (d *Dir) Path() string { return d.path }
+
+// InMemory reports whether the directory is on the scratch filesystem.
+func (d *Dir) InMemory() bool { return d.memory }
+
+// Size returns the total size of the files in the directory.
+func (d *Dir) Size() (int64, error) {
+	var total int64
+	err := filepath.WalkDir(d.path, func(_ string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// Removed while being walked, e.g. a converter's temp file.
+				return nil
+			}
+			return err
+		}
+		if e.Type().IsRegular() {
+			if info, err := e.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// Fit moves the directory to disk if it holds more than the limit.
+func (d *Dir) Fit() error {
+	if !d.memory {
+		return nil
+	}
+	if size, err := d.Size(); err != nil || size <= d.space.cfg.Limit {
+		return err
+	}
+	return d.ToDisk()
+}
+
+// Watch returns a context cancelled with cause ErrLimit once the directory
+// holds more than the limit, and a func to stop watching. A directory on
+// disk is not watched.
+func (d *Dir) Watch(ctx context.Context) (context.Context, context.CancelFunc) {
+	if !d.memory {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(d.space.cfg.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if size, err := d.Size(); err == nil && size > d.space.cfg.Limit {
+					cancel(ErrLimit)
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() { close(done) })
+		cancel(nil)
+	}
+}
+
+// ToDisk moves the directory and its contents to the regular temp
+// directory, releasing its reservation.
+func (d *Dir) ToDisk() error {
+	if !d.memory {
+		return nil
+	}
+	path, err := os.MkdirTemp("", d.pattern)
+	if err != nil {
+		return err
+	}
+	if err := copyTree(d.path, path); err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	os.RemoveAll(d.path)
+	d.path = path
+	d.release()
+	d.space.fellBack(FallbackLimit)
+	return nil
+}
+
+// Remove removes the directory and releases its reservation.
+func (d *Dir) Remove() error {
+	err := os.RemoveAll(d.path)
+	d.release()
+	return err
+}
+
+func (d *Dir) release() {
+	if !d.memory {
+		return
+	}
+	d.memory = false
+	d.space.mu.Lock()
+	d.space.reserved -= d.space.cfg.Limit
+	d.space.mu.Unlock()
+}
+
+// copyTree copies the directories and regular files under src into dst,
+// which exists. The scratch filesystem is another device, so they cannot be
+// renamed across.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case e.IsDir():
+			return os.Mkdir(target, 0700)
+		case e.Type().IsRegular():
+			return copyFile(path, target)
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,191 @@
+package scratch_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/scratch"
+)
+
+func newSpace(t *testing.T, capacity, limit int64, fallbacks *[]string) (*scratch.Space, string) {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "tmpfs")
+	s, err := scratch.New(scratch.Config{
+		Dir:        root,
+		Capacity:   capacity,
+		Limit:      limit,
+		Interval:   5 * time.Millisecond,
+		OnFallback: func(reason string) { *fallbacks = append(*fallbacks, reason) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, root
+}
+
+func TestMkdirTemp(t *testing.T) {
+	var fallbacks []string
+	s, root := newSpace(t, 200, 100, &fallbacks)
+
+	a, err := s.MkdirTemp("docpdf-*", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Remove()
+	b, err := s.MkdirTemp("docpdf-*", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*scratch.Dir{a, b} {
+		if !d.InMemory() || !strings.HasPrefix(d.Path(), root) {
+			t.Errorf("%s not on the scratch filesystem", d.Path())
+		}
+	}
+	if got := s.Reserved(); got != 200 {
+		t.Errorf("reserved %d, want 200", got)
+	}
+
+	// Every share is taken.
+	c, err := s.MkdirTemp("docpdf-*", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Remove()
+	if c.InMemory() || strings.HasPrefix(c.Path(), root) {
+		t.Errorf("%s made on the full scratch filesystem", c.Path())
+	}
+
+	// A share comes back when its directory is removed.
+	if err := b.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(b.Path()); !os.IsNotExist(err) {
+		t.Error("directory not removed")
+	}
+	if got := s.Reserved(); got != 100 {
+		t.Errorf("reserved %d after removal, want 100", got)
+	}
+
+	// Known to need more than a share.
+	d, err := s.MkdirTemp("docpdf-*", 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Remove()
+	if d.InMemory() {
+		t.Error("oversized conversion put on the scratch filesystem")
+	}
+	if want := []string{scratch.FallbackFull, scratch.FallbackLimit}; strings.Join(fallbacks, ",") != strings.Join(want, ",") {
+		t.Errorf("fallbacks %v, want %v", fallbacks, want)
+	}
+}
+
+func TestNilSpace(t *testing.T) {
+	var s *scratch.Space
+	d, err := s.MkdirTemp("docpdf-*", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Remove()
+	if d.InMemory() {
+		t.Error("nil space made a directory in memory")
+	}
+	if ctx, stop := d.Watch(context.Background()); ctx != context.Background() {
+		t.Error("directory on disk watched")
+	} else {
+		stop()
+	}
+}
+
+func TestFit(t *testing.T) {
+	var fallbacks []string
+	s, root := newSpace(t, 100, 100, &fallbacks)
+	d, err := s.MkdirTemp("docpdf-*", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Remove()
+	if err := os.WriteFile(filepath.Join(d.Path(), "small"), make([]byte, 100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Fit(); err != nil || !d.InMemory() {
+		t.Fatalf("directory within its limit moved: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(d.Path(), "out"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d.Path(), "out", "big"), make([]byte, 1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := d.Path()
+	if err := d.Fit(); err != nil {
+		t.Fatal(err)
+	}
+	if d.InMemory() || strings.HasPrefix(d.Path(), root) {
+		t.Fatal("directory over its limit not moved to disk")
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("scratch copy left behind")
+	}
+	for _, name := range []string{"small", filepath.Join("out", "big")} {
+		if _, err := os.Stat(filepath.Join(d.Path(), name)); err != nil {
+			t.Errorf("%s not moved: %v", name, err)
+		}
+	}
+	if s.Reserved() != 0 {
+		t.Error("share not released by the move")
+	}
+	if len(fallbacks) != 1 || fallbacks[0] != scratch.FallbackLimit {
+		t.Errorf("fallbacks %v", fallbacks)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var fallbacks []string
+	s, _ := newSpace(t, 100, 100, &fallbacks)
+	d, err := s.MkdirTemp("docpdf-*", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Remove()
+
+	ctx, stop := d.Watch(context.Background())
+	defer stop()
+	if err := os.WriteFile(filepath.Join(d.Path(), "out"), make([]byte, 101), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("growth past the limit not noticed")
+	}
+	if !errors.Is(context.Cause(ctx), scratch.ErrLimit) {
+		t.Errorf("cause %v, want ErrLimit", context.Cause(ctx))
+	}
+
+	// Stopping a watch does not report the limit.
+	ctx, stop = d.Watch(context.Background())
+	stop()
+	if errors.Is(context.Cause(ctx), scratch.ErrLimit) {
+		t.Error("stopped watch reported ErrLimit")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := scratch.New(scratch.Config{Dir: t.TempDir(), Capacity: 10, Limit: 20}); err == nil {
+		t.Error("expected an error for a limit over the capacity")
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scratch.New(scratch.Config{Dir: file, Capacity: 10, Limit: 10}); err == nil {
+		t.Error("expected an error for a directory that is a file")
+	}
+}
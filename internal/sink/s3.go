@@ -0,0 +1,216 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPresignExpiry is the longest validity SigV4 allows a presigned URL.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// S3Config configures an S3 sink.
+type S3Config struct {
+	// Endpoint is the service URL, e.g. "https://s3.eu-west-1.amazonaws.com",
+	// "https://storage.googleapis.com" for GCS, or a MinIO server. Empty means
+	// AWS S3 in Region.
+	Endpoint string
+	// Region signs requests. GCS accepts "auto".
+	Region string
+	Bucket string
+	// AccessKey and SecretKey are the AWS access key, or a GCS HMAC key.
+	AccessKey string
+	SecretKey string
+	// Prefix is prepended to every key, e.g. "docpdf/".
+	Prefix string
+	// PathStyle addresses the bucket as endpoint/bucket/key rather than
+	// bucket.endpoint/key, as MinIO and most self-hosted stores need.
+	PathStyle bool
+	// URLExpiry is how long presigned result URLs stay valid. Default 1h; at
+	// most 7 days.
+	URLExpiry time.Duration
+	// Client sends the uploads. Default http.DefaultClient.
+	Client *http.Client
+}
+
+// S3 is a Sink uploading to an S3-compatible bucket with AWS Signature
+// Version 4. Locations carry a presigned GET URL.
+type S3 struct {
+	cfg  S3Config
+	base *url.URL // endpoint, with the bucket in the host unless PathStyle
+}
+
+// NewS3 returns an S3 sink for cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" || cfg.Region == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("sink: S3 needs a bucket, region and credentials")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	switch {
+	case cfg.URLExpiry <= 0:
+		cfg.URLExpiry = time.Hour
+	case cfg.URLExpiry > maxPresignExpiry:
+		cfg.URLExpiry = maxPresignExpiry
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("sink: invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.PathStyle {
+		base.Path += "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+	}
+	return &S3{cfg: cfg, base: base}, nil
+}
+
+// Put implements Sink.
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) (Location, error) {
+	if !validKey(key) {
+		return Location{}, ErrInvalidKey
+	}
+	key = s.cfg.Prefix + key
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return Location{}, err
+	}
+	sum := sha256.Sum256(data)
+	payload := hex.EncodeToString(sum[:])
+	now := time.Now().UTC()
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	req.Header.Set("X-Amz-Date", now.Format(amzTime))
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	headers := map[string]string{
+		"content-type":         contentType,
+		"host":                 u.Host,
+		"x-amz-content-sha256": payload,
+		"x-amz-date":           now.Format(amzTime),
+	}
+	sig := s.sign(now, http.MethodPut, u.EscapedPath(), "", headers, signed, payload)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, s.scope(now), strings.Join(signed, ";"), sig))
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return Location{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Location{}, fmt.Errorf("sink: upload of %s: %s: %s", key, resp.Status, bytes.TrimSpace(body))
+	}
+	return Location{Key: key, URL: s.Presign(key, now)}, nil
+}
+
+// Presign returns a GET URL for key, which must include the prefix, valid for
+// URLExpiry from now.
+func (s *S3) Presign(key string, now time.Time) string {
+	now = now.UTC()
+	u := s.objectURL(key)
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.cfg.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(amzTime)},
+		"X-Amz-Expires":       {strconv.Itoa(int(s.cfg.URLExpiry.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	query := canonicalQuery(q)
+	sig := s.sign(now, http.MethodGet, u.EscapedPath(), query,
+		map[string]string{"host": u.Host}, []string{"host"}, "UNSIGNED-PAYLOAD")
+	u.RawQuery = query + "&X-Amz-Signature=" + sig
+	return u.String()
+}
+
+// objectURL returns the URL of key in the bucket.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.base
+	u.Path = s.base.Path + "/" + key
+	u.RawPath = s.base.EscapedPath() + "/" + awsEscape(key, false)
+	return &u
+}
+
+// amzTime is the SigV4 timestamp layout.
+const amzTime = "20060102T150405Z"
+
+// scope is the SigV4 credential scope for requests made at t.
+func (s *S3) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// sign returns the SigV4 signature of a request. headers holds the lowercased
+// signed headers, named in sorted order by signed.
+func (s *S3) sign(t time.Time, method, path, query string, headers map[string]string, signed []string, payload string) string {
+	var canon strings.Builder
+	canon.WriteString(method + "\n" + path + "\n" + query + "\n")
+	for _, h := range signed {
+		canon.WriteString(h + ":" + strings.TrimSpace(headers[h]) + "\n")
+	}
+	canon.WriteString("\n" + strings.Join(signed, ";") + "\n" + payload)
+	hash := sha256.Sum256([]byte(canon.String()))
+
+	toSign := "AWS4-HMAC-SHA256\n" + t.Format(amzTime) + "\n" + s.scope(t) + "\n" + hex.EncodeToString(hash[:])
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// canonicalQuery encodes q sorted by key, as SigV4 requires.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, and
+// '/' too when encodeSlash is set (query components), per SigV4.
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
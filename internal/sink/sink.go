@@ -0,0 +1,108 @@
+// Package sink stores conversion results outside the HTTP response: in an
+// S3-compatible bucket (AWS S3, or GCS through its XML API) or in anything
+// that can be written through an io.Writer, such as a local directory.
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sink stores a result under a key and reports where it went.
+type Sink interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) (Location, error)
+}
+
+// Location identifies a stored result.
+type Location struct {
+	// Key is the object key the result was stored under, including any
+	// prefix the sink adds.
+	Key string `json:"key"`
+	// URL fetches the result: a presigned URL for buckets, or one built from
+	// the configured base URL. Empty when the sink has no way to link to it.
+	URL string `json:"url,omitempty"`
+}
+
+// ErrInvalidKey is returned for keys that are empty or escape the sink's
+// root with "..".
+var ErrInvalidKey = errors.New("sink: invalid key")
+
+// Writer adapts any io.Writer-backed store into a Sink.
+type Writer struct {
+	// Open returns the writer for key. The result is committed when Close
+	// returns nil.
+	Open func(ctx context.Context, key string) (io.WriteCloser, error)
+	// URL, if set, returns the URL a stored key can be fetched from.
+	URL func(key string) string
+}
+
+// Put implements Sink.
+func (s *Writer) Put(ctx context.Context, key string, data []byte, _ string) (Location, error) {
+	if !validKey(key) {
+		return Location{}, ErrInvalidKey
+	}
+	w, err := s.Open(ctx, key)
+	if err != nil {
+		return Location{}, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return Location{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Location{}, err
+	}
+	loc := Location{Key: key}
+	if s.URL != nil {
+		loc.URL = s.URL(key)
+	}
+	return loc, nil
+}
+
+// NewDir returns a Sink writing results under dir, for a directory shared
+// with the consumer (e.g. a mounted volume). When baseURL is non-empty,
+// locations link to baseURL plus the key.
+func NewDir(dir, baseURL string) *Writer {
+	s := &Writer{
+		Open: func(_ context.Context, key string) (io.WriteCloser, error) {
+			path := filepath.Join(dir, filepath.FromSlash(key))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return nil, err
+			}
+			return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		},
+	}
+	if baseURL != "" {
+		base := strings.TrimSuffix(baseURL, "/")
+		s.URL = func(key string) string { return base + "/" + escapePath(key) }
+	}
+	return s
+}
+
+// validKey rejects keys that could address something outside the sink.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// escapePath escapes each segment of a slash-separated key for use in a URL
+// path.
+func escapePath(key string) string {
+	segs := strings.Split(key, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
@@ -0,0 +1,37 @@
+package sink_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/sink"
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	s := sink.NewDir(dir, "https://files.example.com/out/")
+
+	loc, err := s.Put(context.Background(), "req-1/my report.pdf", []byte("%PDF"), "application/pdf")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if loc.Key != "req-1/my report.pdf" || loc.URL != "https://files.example.com/out/req-1/my%20report.pdf" {
+		t.Errorf("Location = %+v", loc)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "req-1", "my report.pdf"))
+	if err != nil || string(got) != "%PDF" {
+		t.Errorf("stored %q, %v", got, err)
+	}
+}
+
+func TestRejectsUnsafeKeys(t *testing.T) {
+	s := sink.NewDir(t.TempDir(), "")
+	for _, key := range []string{"", "/abs.pdf", "../escape.pdf", "a/../../b.pdf", `a\b.pdf`, "a//b.pdf"} {
+		if _, err := s.Put(context.Background(), key, []byte("x"), "application/pdf"); !errors.Is(err, sink.ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package spool stages an upload on disk in fixed-size chunks, each
+// checksummed with SHA-256 as it is written.
+//
+// Any byte range can be read back while the upload is still arriving, so
+// validation can start on the first bytes instead of waiting for the last.
+// Verify re-reads the chunks against their checksums, so a later step can be
+// retried from disk rather than from the network. Truncate and Open let an
+// interrupted upload resume from the last good byte.
+package spool
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultChunkSize is the chunk size used when none is given.
+const DefaultChunkSize = 1 << 20
+
+// ErrCorrupt is returned by Verify when a chunk no longer matches its
+// checksum.
+var ErrCorrupt = errors.New("spool: chunk checksum mismatch")
+
+// Chunk is a checksummed range of the spool.
+type Chunk struct {
+	Offset int64
+	Size   int64
+	SHA256 [sha256.Size]byte
+}
+
+// Spool is a file written in checksummed chunks. Writes append; ReadAt may
+// run concurrently with them and sees every byte written so far.
+type Spool struct {
+	f         *os.File
+	chunkSize int64
+
+	mu     sync.Mutex
+	size   int64
+	sealed []Chunk   // full chunks
+	open   hash.Hash // of the bytes after the last full chunk
+}
+
+// Create creates a new, empty spool file at path. It fails if the file
+// exists. A chunkSize of 0 means DefaultChunkSize.
+func Create(path string, chunkSize int64) (*Spool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return newSpool(f, chunkSize), nil
+}
+
+// Open reopens the spool file at path, say after a restart, checksumming
+// what it already holds; writes continue at its end. A chunkSize of 0 means
+// DefaultChunkSize.
+func Open(path string, chunkSize int64) (*Spool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := newSpool(f, chunkSize)
+	s.size = info.Size()
+	if err := s.rehash(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSpool(f *os.File, chunkSize int64) *Spool {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &Spool{f: f, chunkSize: chunkSize, open: sha256.New()}
+}
+
+// Name returns the path of the spool file.
+func (s *Spool) Name() string { return s.f.Name() }
+
+// Size returns the number of bytes written.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Write appends p, checksumming each chunk as it fills.
+func (s *Spool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var written int
+	for len(p) > 0 {
+		room := s.chunkSize - s.size%s.chunkSize
+		n, err := s.f.WriteAt(p[:min(int64(len(p)), room)], s.size)
+		s.open.Write(p[:n])
+		s.size += int64(n)
+		written += n
+		if s.size%s.chunkSize == 0 {
+			s.seal(s.size)
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// seal closes the full chunk ending at end.
+func (s *Spool) seal(end int64) {
+	c := Chunk{Offset: end - s.chunkSize, Size: s.chunkSize}
+	s.open.Sum(c.SHA256[:0])
+	s.sealed = append(s.sealed, c)
+	s.open.Reset()
+}
+
+// ReadAt implements io.ReaderAt over the bytes written so far.
+func (s *Spool) ReadAt(p []byte, off int64) (int, error) {
+	size := s.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	if rest := size - off; int64(len(p)) > rest {
+		n, err := s.f.ReadAt(p[:rest], off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return s.f.ReadAt(p, off)
+}
+
+// Section returns a reader for n bytes starting at off.
+func (s *Spool) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(s, off, n)
+}
+
+// Chunks returns the checksummed chunks covering the bytes written so far;
+// the last one is shorter than the chunk size unless the size is a multiple
+// of it.
+func (s *Spool) Chunks() []Chunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chunks := append([]Chunk(nil), s.sealed...)
+	if rest := s.size % s.chunkSize; rest > 0 {
+		c := Chunk{Offset: s.size - rest, Size: rest}
+		s.open.Sum(c.SHA256[:0])
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+// Verify re-reads every chunk from disk and checks it against its checksum,
+// returning ErrCorrupt for the first one that no longer matches.
+func (s *Spool) Verify() error {
+	h := sha256.New()
+	for _, c := range s.Chunks() {
+		h.Reset()
+		if _, err := io.Copy(h, s.Section(c.Offset, c.Size)); err != nil {
+			return err
+		}
+		if [sha256.Size]byte(h.Sum(nil)) != c.SHA256 {
+			return fmt.Errorf("%w at offset %d", ErrCorrupt, c.Offset)
+		}
+	}
+	return nil
+}
+
+// Truncate discards everything from size on, so an interrupted upload can be
+// resumed from there. It fails if size is beyond what was written.
+func (s *Spool) Truncate(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size < 0 || size > s.size {
+		return fmt.Errorf("spool: truncate to %d, size is %d", size, s.size)
+	}
+	if err := s.f.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	s.sealed = s.sealed[:size/s.chunkSize]
+	return s.rehash(size / s.chunkSize * s.chunkSize)
+}
+
+// rehash checksums the file from from, a chunk boundary, to s.size. Callers
+// hold s.mu or own s exclusively.
+func (s *Spool) rehash(from int64) error {
+	s.open.Reset()
+	for off := from; off < s.size; {
+		n := min(s.chunkSize-off%s.chunkSize, s.size-off)
+		if _, err := io.Copy(s.open, io.NewSectionReader(s.f, off, n)); err != nil {
+			return err
+		}
+		off += n
+		if off%s.chunkSize == 0 {
+			s.seal(off)
+		}
+	}
+	return nil
+}
+
+// Close closes the spool file, leaving it on disk.
+func (s *Spool) Close() error { return s.f.Close() }
@@ -0,0 +1,138 @@
+package spool_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/spool"
+)
+
+func create(t *testing.T, chunkSize int64) *spool.Spool {
+	t.Helper()
+	s, err := spool.Create(filepath.Join(t.TempDir(), "upload"), chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSpool_Chunks(t *testing.T) {
+	s := create(t, 4)
+	data := []byte("0123456789")
+	// Writes that straddle chunk boundaries are split between chunks.
+	for _, p := range [][]byte{data[:3], data[3:9], data[9:]} {
+		if _, err := s.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunks := s.Chunks()
+	if len(chunks) != 3 || s.Size() != 10 {
+		t.Fatalf("expected 3 chunks of 10 bytes, got %+v (size %d)", chunks, s.Size())
+	}
+	for i, want := range []string{"0123", "4567", "89"} {
+		c := chunks[i]
+		if c.Offset != int64(4*i) || c.Size != int64(len(want)) || c.SHA256 != sha256.Sum256([]byte(want)) {
+			t.Errorf("chunk %d = %+v, want %q", i, c, want)
+		}
+	}
+	if err := s.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestSpool_ReadAt(t *testing.T) {
+	s := create(t, 4)
+	s.Write([]byte("hello, world"))
+
+	got, err := io.ReadAll(s.Section(7, 5))
+	if err != nil || string(got) != "world" {
+		t.Errorf("Section(7, 5) = %q, %v", got, err)
+	}
+	// Reads stop at what has been written so far.
+	p := make([]byte, 8)
+	n, err := s.ReadAt(p, 10)
+	if n != 2 || err != io.EOF || string(p[:n]) != "ld" {
+		t.Errorf("ReadAt past the end = %d, %v", n, err)
+	}
+	s.Write([]byte("!"))
+	if n, _ := s.ReadAt(p, 10); string(p[:n]) != "ld!" {
+		t.Errorf("expected the appended byte to be readable, got %q", p[:n])
+	}
+}
+
+func TestSpool_VerifyDetectsCorruption(t *testing.T) {
+	s := create(t, 4)
+	s.Write([]byte("0123456789"))
+
+	f, err := os.OpenFile(s.Name(), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("X"), 5)
+	f.Close()
+
+	err = s.Verify()
+	if !errors.Is(err, spool.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "at offset 4") {
+		t.Errorf("error %q does not name the chunk", err)
+	}
+}
+
+func TestSpool_TruncateAndResume(t *testing.T) {
+	s := create(t, 4)
+	s.Write([]byte("0123456xxx"))
+
+	if err := s.Truncate(11); err == nil {
+		t.Error("expected an error truncating past the end")
+	}
+	if err := s.Truncate(7); err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("789"))
+
+	want := create(t, 4)
+	want.Write([]byte("0123456789"))
+	if got := s.Chunks(); len(got) != 3 || got[1] != want.Chunks()[1] || got[2] != want.Chunks()[2] {
+		t.Errorf("chunks after resuming = %+v, want %+v", got, want.Chunks())
+	}
+	if err := s.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload")
+	s, err := spool.Create(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("012345"))
+	before := s.Chunks()
+	s.Close()
+
+	if _, err := spool.Create(path, 4); err == nil {
+		t.Error("Create should not overwrite an existing spool")
+	}
+	s, err = spool.Open(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.Chunks(); len(got) != 2 || got[0] != before[0] || got[1] != before[1] {
+		t.Errorf("reopened chunks = %+v, want %+v", got, before)
+	}
+	s.Write([]byte("6789"))
+	data, _ := os.ReadFile(path)
+	if string(data) != "0123456789" || s.Size() != 10 {
+		t.Errorf("expected writes to continue at the end, file is %q", data)
+	}
+}
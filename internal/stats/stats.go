@@ -0,0 +1,209 @@
+// Package stats keeps rolling conversion duration statistics per input type
+// and persists them to disk, so they survive restarts and deploys.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the number of recent durations kept per type when
+// Config.Window is unset.
+const DefaultWindow = 500
+
+// Config configures a Recorder.
+type Config struct {
+	// Path is the JSON file statistics are loaded from and saved to. Empty
+	// keeps statistics in memory only.
+	Path string
+	// Window is how many recent durations per type feed the percentiles.
+	Window int
+	// FlushInterval is how often statistics are saved to Path. Zero disables
+	// periodic saves; Close still saves.
+	FlushInterval time.Duration
+}
+
+// Summary is the reported view of one input type.
+type Summary struct {
+	Count int64 `json:"count"`
+	P50Ms int64 `json:"p50_ms"`
+	P95Ms int64 `json:"p95_ms"`
+}
+
+// series is the persisted state of one input type.
+type series struct {
+	Count    int64   `json:"count"`
+	RecentMs []int64 `json:"recent_ms"`
+}
+
+// Recorder collects successful conversion durations.
+type Recorder struct {
+	cfg Config
+
+	mu    sync.Mutex
+	types map[string]*series
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a Recorder, loading previously saved statistics from cfg.Path
+// when it exists. A file that cannot be parsed is reported as an error along
+// with a usable, empty Recorder. Call Close to stop periodic saves.
+func New(cfg Config) (*Recorder, error) {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	r := &Recorder{
+		cfg:   cfg,
+		types: make(map[string]*series),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	err := r.load()
+
+	if cfg.Path != "" && cfg.FlushInterval > 0 {
+		go r.flushLoop()
+	} else {
+		close(r.done)
+	}
+	return r, err
+}
+
+// Observe records the duration of a successful conversion of docType.
+func (r *Recorder) Observe(docType string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.types[docType]
+	if !ok {
+		s = &series{}
+		r.types[docType] = s
+	}
+	s.Count++
+	s.RecentMs = append(s.RecentMs, d.Milliseconds())
+	if n := len(s.RecentMs) - r.cfg.Window; n > 0 {
+		s.RecentMs = slices.Delete(s.RecentMs, 0, n)
+	}
+}
+
+// Snapshot returns the current summary for every type observed.
+func (r *Recorder) Snapshot() map[string]Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]Summary, len(r.types))
+	for t, s := range r.types {
+		sorted := slices.Clone(s.RecentMs)
+		slices.Sort(sorted)
+		out[t] = Summary{
+			Count: s.Count,
+			P50Ms: percentile(sorted, 50),
+			P95Ms: percentile(sorted, 95),
+		}
+	}
+	return out
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// Save writes the statistics to Config.Path. The file is replaced atomically
+// so a crash mid-save never leaves a truncated file behind.
+func (r *Recorder) Save() error {
+	if r.cfg.Path == "" {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.Marshal(r.types)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.cfg.Path), ".stats-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.cfg.Path)
+}
+
+// Close stops periodic saves and saves a final time.
+func (r *Recorder) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	<-r.done
+	return r.Save()
+}
+
+// ServeHTTP serves GET /stats: a JSON object keyed by input type.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"types": r.Snapshot()})
+}
+
+func (r *Recorder) load() error {
+	if r.cfg.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.cfg.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var types map[string]*series
+	if err := json.Unmarshal(data, &types); err != nil {
+		return err
+	}
+	for t, s := range types {
+		if s == nil {
+			continue
+		}
+		if n := len(s.RecentMs) - r.cfg.Window; n > 0 {
+			s.RecentMs = s.RecentMs[n:]
+		}
+		r.types[t] = s
+	}
+	return nil
+}
+
+func (r *Recorder) flushLoop() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			_ = r.Save()
+		}
+	}
+}
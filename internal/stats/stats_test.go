@@ -0,0 +1,123 @@
+package stats_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/stats"
+)
+
+func newRecorder(t *testing.T, cfg stats.Config) *stats.Recorder {
+	t.Helper()
+	r, err := stats.New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+func TestPercentiles(t *testing.T) {
+	r := newRecorder(t, stats.Config{})
+	for i := 1; i <= 100; i++ {
+		r.Observe("docx", time.Duration(i)*time.Millisecond)
+	}
+
+	got := r.Snapshot()["docx"]
+	want := stats.Summary{Count: 100, P50Ms: 50, P95Ms: 95}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWindowKeepsRecentDurations(t *testing.T) {
+	r := newRecorder(t, stats.Config{Window: 10})
+	for i := 0; i < 100; i++ {
+		r.Observe("odt", time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		r.Observe("odt", 10*time.Millisecond)
+	}
+
+	got := r.Snapshot()["odt"]
+	if got.Count != 110 {
+		t.Errorf("expected lifetime count 110, got %d", got.Count)
+	}
+	if got.P95Ms != 10 {
+		t.Errorf("expected only the last 10 durations in the window, got p95=%d", got.P95Ms)
+	}
+}
+
+func TestPersistAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+
+	r := newRecorder(t, stats.Config{Path: path})
+	r.Observe("xlsx", 200*time.Millisecond)
+	r.Observe("xlsx", 400*time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reloaded := newRecorder(t, stats.Config{Path: path})
+	defer reloaded.Close()
+	got := reloaded.Snapshot()["xlsx"]
+	if got.Count != 2 || got.P95Ms != 400 {
+		t.Errorf("expected reloaded stats, got %+v", got)
+	}
+}
+
+func TestPeriodicFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	r := newRecorder(t, stats.Config{Path: path, FlushInterval: 10 * time.Millisecond})
+	defer r.Close()
+	r.Observe("rtf", time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("stats were not flushed to disk")
+}
+
+func TestCorruptFileStartsEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := stats.New(stats.Config{Path: path})
+	if err == nil {
+		t.Fatal("expected a load error")
+	}
+	if len(r.Snapshot()) != 0 {
+		t.Error("expected empty stats after a failed load")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := newRecorder(t, stats.Config{})
+	r.Observe("pptx", 1500*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	var body struct {
+		Types map[string]stats.Summary `json:"types"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Types["pptx"].P50Ms != 1500 {
+		t.Errorf("unexpected body: %+v", body)
+	}
+}
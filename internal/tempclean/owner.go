@@ -0,0 +1,111 @@
+package tempclean
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxRequestID bounds the request ID kept in a directory name: a UUID.
+const maxRequestID = 36
+
+// bootIDFile holds the kernel's ID of the current boot on Linux.
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// ownerPattern finds the owner tag in a directory name. It is the first
+// match: the tag comes before the request ID, which may look like one.
+var ownerPattern = regexp.MustCompile(`-p(\d+)b([0-9a-f]{8})s([0-9a-f]{4})-`)
+
+// self is the owner tag of this process.
+var self = owner{pid: os.Getpid(), boot: bootID(), start: startID()}
+
+// owner is the process a working directory was made by.
+type owner struct {
+	pid  int
+	boot string // first 8 hex digits of the kernel boot ID; "00000000" if unknown
+	// start tells this process from an earlier one with the same PID, as
+	// a restarted container's usually has.
+	start string
+}
+
+func (o owner) String() string { return "p" + strconv.Itoa(o.pid) + "b" + o.boot + "s" + o.start }
+
+// Pattern returns the os.MkdirTemp pattern of a working directory of kind
+// ("" for a conversion's, else e.g. "batch") made for the request with ID
+// requestID (empty when there is none), such as
+// docpdf-batch-p4242b1f3a9c2es9d0e-<request ID>-*. The PID, kernel boot ID
+// and a start token name the process that owns the directory, so
+// SweepOrphans can tell the directories of a crashed process from those of
+// a running one; the request ID ties a directory left behind to its
+// request's logs. Only the letters, digits and dashes of requestID are
+// kept.
+func Pattern(kind, requestID string) string {
+	var b strings.Builder
+	b.WriteString(Prefix)
+	if kind != "" {
+		b.WriteString(kind + "-")
+	}
+	b.WriteString(self.String() + "-")
+	n := 0
+	for _, c := range requestID {
+		if n == maxRequestID {
+			break
+		}
+		if c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			b.WriteRune(c)
+			n++
+		}
+	}
+	if n > 0 {
+		b.WriteString("-")
+	}
+	b.WriteString("*")
+	return b.String()
+}
+
+// ownerOf returns the owner tag in a directory name, if it has one.
+func ownerOf(name string) (owner, bool) {
+	m := ownerPattern.FindStringSubmatch(name)
+	if m == nil {
+		return owner{}, false
+	}
+	pid, err := strconv.Atoi(m[1])
+	if err != nil {
+		return owner{}, false
+	}
+	return owner{pid: pid, boot: m[2], start: m[3]}, true
+}
+
+// gone reports whether the process o is certainly no longer running: it
+// ran before the machine last booted, it had this process's PID before
+// it, or it is not among this boot's processes.
+func (o owner) gone() bool {
+	switch {
+	case o == self:
+		return false
+	case o.boot != self.boot, o.pid == self.pid:
+		return true
+	}
+	return !running(o.pid)
+}
+
+// bootID returns the first 8 hex digits of the kernel boot ID, or
+// "00000000" where there is none to read.
+func bootID() string {
+	data, err := os.ReadFile(bootIDFile)
+	id := strings.ReplaceAll(strings.TrimSpace(string(data)), "-", "")
+	if err != nil || len(id) < 8 {
+		return "00000000"
+	}
+	return strings.ToLower(id[:8])
+}
+
+// startID returns 4 random hex digits.
+func startID() string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
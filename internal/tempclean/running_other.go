@@ -0,0 +1,7 @@
+//go:build !unix
+
+package tempclean
+
+// running cannot tell a process is gone on this platform, so it reports
+// every process as running and only TEMP_MAX_AGE removes directories.
+func running(int) bool { return true }
@@ -0,0 +1,15 @@
+//go:build unix
+
+package tempclean
+
+import (
+	"errors"
+	"syscall"
+)
+
+// running reports whether a process with ID pid exists. One signalled
+// without permission exists too.
+func running(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
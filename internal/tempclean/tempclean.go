@@ -0,0 +1,144 @@
+// Package tempclean removes the working directories a crashed process left
+// behind. Every conversion works in a docpdf-* directory that it removes
+// when done; one killed mid-request never gets to, and its upload and
+// LibreOffice profile stay on disk for good.
+//
+// A directory counts as orphaned once nothing in it has been modified for
+// the maximum age, or, when its name says it belongs to a process that is
+// no longer running (see Pattern), for the shorter orphan age. Directories
+// still in use, such as those of async jobs waiting to be collected, are
+// kept however old they are.
+package tempclean
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Prefix starts the name of every working directory the service makes.
+const Prefix = "docpdf-"
+
+// Config configures a Janitor.
+type Config struct {
+	// Dirs are the directories whose Prefix subdirectories are swept.
+	// Default os.TempDir().
+	Dirs []string
+	// MaxAge is how long a directory must go unmodified to be removed.
+	MaxAge time.Duration
+	// OrphanAge is how long a directory of a process no longer running
+	// must go unmodified to be removed; 0 leaves it to MaxAge. It keeps
+	// the directory of a process that only looks gone from here, such as
+	// one in another PID namespace sharing the directory, until it has
+	// been idle that long.
+	OrphanAge time.Duration
+	// InUse, if set, returns the directories to keep whatever their age.
+	// Nothing is removed when it fails.
+	InUse func() ([]string, error)
+}
+
+// Result is what one sweep removed.
+type Result struct {
+	Dirs  int
+	Bytes int64
+	// Orphans counts the Dirs removed as belonging to a process no longer
+	// running.
+	Orphans int
+}
+
+// Janitor sweeps orphaned working directories.
+type Janitor struct {
+	cfg Config
+}
+
+// New returns a Janitor for cfg.
+func New(cfg Config) *Janitor {
+	if len(cfg.Dirs) == 0 {
+		cfg.Dirs = []string{os.TempDir()}
+	}
+	return &Janitor{cfg: cfg}
+}
+
+// Sweep removes every Prefix directory not in use whose newest entry was
+// modified more than MaxAge before now, or more than OrphanAge before now
+// when its owner is no longer running. A directory that cannot be removed
+// entirely is reported in the error, and the bytes freed from it are still
+// counted.
+func (j *Janitor) Sweep(now time.Time) (Result, error) {
+	keep := make(map[string]bool)
+	if j.cfg.InUse != nil {
+		inUse, err := j.cfg.InUse()
+		if err != nil {
+			return Result{}, err
+		}
+		for _, dir := range inUse {
+			keep[filepath.Clean(dir)] = true
+		}
+	}
+	cutoff := now.Add(-j.cfg.MaxAge)
+	orphanCutoff := now.Add(-j.cfg.OrphanAge)
+	var res Result
+	var errs []error
+	for _, parent := range j.cfg.Dirs {
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for _, ent := range entries {
+			if !ent.IsDir() || !strings.HasPrefix(ent.Name(), Prefix) {
+				continue
+			}
+			dir := filepath.Join(parent, ent.Name())
+			if keep[dir] {
+				continue
+			}
+			newest, size := scan(dir)
+			o, tagged := ownerOf(ent.Name())
+			orphan := j.cfg.OrphanAge > 0 && tagged && !newest.After(orphanCutoff) && o.gone()
+			if newest.After(cutoff) && !orphan {
+				continue
+			}
+			err := os.RemoveAll(dir)
+			if err != nil {
+				errs = append(errs, err)
+				_, left := scan(dir)
+				size -= left
+			} else {
+				res.Dirs++
+				if orphan {
+					res.Orphans++
+				}
+			}
+			res.Bytes += size
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+// scan returns the newest modification time in the tree at dir, its own
+// included, and the total size of its files.
+func scan(dir string) (newest time.Time, size int64) {
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if t := info.ModTime(); t.After(newest) {
+			newest = t
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return newest, size
+}
@@ -0,0 +1,151 @@
+package tempclean_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+)
+
+// mkdir makes dir/name holding a file of size bytes, everything in it last
+// modified at mtime.
+func mkdir(t *testing.T, dir, name string, size int, mtime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Join(path, "lo-profile"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(path, "lo-profile", "input.docx")
+	if err := os.WriteFile(file, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{file, filepath.Join(path, "lo-profile"), path} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestSweep(t *testing.T) {
+	tmp, scratch := t.TempDir(), t.TempDir()
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	orphan := mkdir(t, tmp, "docpdf-123", 100, old)
+	orphanScratch := mkdir(t, scratch, "docpdf-batch-9", 50, old)
+	recent := mkdir(t, tmp, "docpdf-456", 10, now.Add(-time.Minute))
+	job := mkdir(t, tmp, "docpdf-789", 10, old)
+	other := mkdir(t, tmp, "someone-else", 10, old)
+	// An old directory with one file still being written is in use.
+	busy := mkdir(t, tmp, "docpdf-busy", 10, old)
+	if err := os.WriteFile(filepath.Join(busy, "input.pdf"), []byte("%PDF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j := tempclean.New(tempclean.Config{
+		Dirs:   []string{tmp, scratch, filepath.Join(tmp, "missing")},
+		MaxAge: time.Hour,
+		InUse:  func() ([]string, error) { return []string{job + "/"}, nil },
+	})
+	res, err := j.Sweep(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Dirs != 2 || res.Bytes != 150 {
+		t.Errorf("Sweep = %+v, want 2 dirs, 150 bytes", res)
+	}
+	for _, gone := range []string{orphan, orphanScratch} {
+		if exists(gone) {
+			t.Errorf("%s was kept", gone)
+		}
+	}
+	for _, kept := range []string{recent, job, other, busy} {
+		if !exists(kept) {
+			t.Errorf("%s was removed", kept)
+		}
+	}
+}
+
+func TestSweep_InUseFails(t *testing.T) {
+	tmp := t.TempDir()
+	orphan := mkdir(t, tmp, "docpdf-123", 10, time.Now().Add(-2*time.Hour))
+	j := tempclean.New(tempclean.Config{
+		Dirs:   []string{tmp},
+		MaxAge: time.Hour,
+		InUse:  func() ([]string, error) { return nil, errors.New("store down") },
+	})
+	if _, err := j.Sweep(time.Now()); err == nil {
+		t.Error("expected the InUse error")
+	}
+	if !exists(orphan) {
+		t.Error("a directory was removed without knowing which are in use")
+	}
+}
+
+func TestPattern(t *testing.T) {
+	dir, err := os.MkdirTemp(t.TempDir(), tempclean.Pattern("batch", "9b1e/../x y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Base(dir)
+	if !regexp.MustCompile(`^docpdf-batch-p\d+b[0-9a-f]{8}s[0-9a-f]{4}-9b1exy-\d+$`).MatchString(name) {
+		t.Errorf("name %q", name)
+	}
+	if got := tempclean.Pattern("", ""); !regexp.MustCompile(`^docpdf-p\d+b[0-9a-f]{8}s[0-9a-f]{4}-\*$`).MatchString(got) {
+		t.Errorf("pattern %q", got)
+	}
+}
+
+func TestSweep_DeadOwners(t *testing.T) {
+	tmp := t.TempDir()
+	now := time.Now()
+	idle := now.Add(-10 * time.Minute)
+	// This process's own tag, and the same with another start token: an
+	// earlier process that had this PID, as a restarted container's does.
+	self := regexp.MustCompile(`p(\d+)b([0-9a-f]{8})s([0-9a-f]{4})`).FindStringSubmatch(tempclean.Pattern("", ""))
+	pid, boot, start := self[1], self[2], self[3]
+	other := "0000"
+	if start == other {
+		other = "0001"
+	}
+	earlierBoot := "ffffffff"
+	if boot == earlierBoot {
+		earlierBoot = "fffffffe"
+	}
+	samePID := mkdir(t, tmp, "docpdf-p"+pid+"b"+boot+"s"+other+"-req1-1", 100, idle)
+	rebooted := mkdir(t, tmp, "docpdf-batch-p"+pid+"b"+earlierBoot+"s"+start+"-2", 50, idle)
+	mine := mkdir(t, tmp, "docpdf-p"+pid+"b"+boot+"s"+start+"-req3-3", 10, idle)
+	parent := mkdir(t, tmp, "docpdf-p"+strconv.Itoa(os.Getppid())+"b"+boot+"s"+other+"-4", 10, idle)
+	recent := mkdir(t, tmp, "docpdf-p"+pid+"b"+earlierBoot+"s"+start+"-5", 10, now.Add(-time.Minute))
+	untagged := mkdir(t, tmp, "docpdf-6", 10, idle)
+
+	j := tempclean.New(tempclean.Config{Dirs: []string{tmp}, MaxAge: time.Hour, OrphanAge: 5 * time.Minute})
+	res, err := j.Sweep(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Dirs != 2 || res.Orphans != 2 || res.Bytes != 150 {
+		t.Errorf("Sweep = %+v, want 2 orphans, 150 bytes", res)
+	}
+	for _, gone := range []string{samePID, rebooted} {
+		if exists(gone) {
+			t.Errorf("%s was kept", gone)
+		}
+	}
+	for _, kept := range []string{mine, parent, recent, untagged} {
+		if !exists(kept) {
+			t.Errorf("%s was removed", kept)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package templates keeps a server-side library of reusable DOCX templates,
+// so render requests can name a template_id instead of uploading the same
+// document every time. Each template belongs to one tenant and keeps every
+// version uploaded to it.
+package templates
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for a template, or template version, that does not
+// exist or belongs to another tenant.
+var ErrNotFound = errors.New("template not found")
+
+// Template is a named document and its versions.
+type Template struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+	Name   string `json:"name"`
+	// Versions are oldest first; the last is the one used by default.
+	Versions  []Version `json:"versions"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Latest returns the newest version of t.
+func (t Template) Latest() Version { return t.Versions[len(t.Versions)-1] }
+
+// Version is one uploaded revision of a template.
+type Version struct {
+	// Version counts up from 1.
+	Version   int       `json:"version"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Library stores templates in a directory: one subdirectory per template
+// holding template.json and a file per version. Writes are atomic (temp file
+// + rename). It is safe for concurrent use.
+type Library struct {
+	dir string
+
+	mu        sync.RWMutex
+	templates map[string]Template // by ID
+}
+
+// Open returns the Library in dir, creating dir if needed and loading the
+// templates already there. Unreadable templates are skipped.
+func Open(dir string) (*Library, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	l := &Library{dir: dir, templates: make(map[string]Template)}
+	for _, ent := range entries {
+		if !ent.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, ent.Name(), "template.json"))
+		if err != nil {
+			continue
+		}
+		var t Template
+		if json.Unmarshal(data, &t) != nil || t.ID != ent.Name() || len(t.Versions) == 0 {
+			continue
+		}
+		l.templates[t.ID] = t
+	}
+	return l, nil
+}
+
+// Create stores data as version 1 of a new template named name, owned by
+// tenant.
+func (l *Library) Create(tenant, name string, data []byte) (Template, error) {
+	now := time.Now().UTC()
+	t := Template{ID: newID(), Tenant: tenant, Name: name, CreatedAt: now, UpdatedAt: now}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.Mkdir(filepath.Join(l.dir, t.ID), 0700); err != nil {
+		return Template{}, fmt.Errorf("templates: %w", err)
+	}
+	created, err := l.addVersion(t, data, now)
+	if err != nil {
+		os.RemoveAll(filepath.Join(l.dir, t.ID))
+		return Template{}, err
+	}
+	return created, nil
+}
+
+// AddVersion stores data as the next version of tenant's template id.
+func (l *Library) AddVersion(tenant, id string, data []byte) (Template, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.templates[id]
+	if !ok || t.Tenant != tenant {
+		return Template{}, ErrNotFound
+	}
+	return l.addVersion(t, data, time.Now().UTC())
+}
+
+// addVersion writes data as t's next version and saves t. l.mu must be held.
+func (l *Library) addVersion(t Template, data []byte, now time.Time) (Template, error) {
+	sum := sha256.Sum256(data)
+	v := Version{Version: len(t.Versions) + 1, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:]), CreatedAt: now}
+	if err := writeFile(l.versionPath(t.ID, v.Version), data); err != nil {
+		return Template{}, err
+	}
+	t.Versions = append(append([]Version(nil), t.Versions...), v)
+	t.UpdatedAt = now
+	meta, err := json.Marshal(t)
+	if err != nil {
+		return Template{}, err
+	}
+	if err := writeFile(filepath.Join(l.dir, t.ID, "template.json"), meta); err != nil {
+		os.Remove(l.versionPath(t.ID, v.Version))
+		return Template{}, err
+	}
+	l.templates[t.ID] = t
+	return t, nil
+}
+
+// Get returns tenant's template id.
+func (l *Library) Get(tenant, id string) (Template, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	t, ok := l.templates[id]
+	if !ok || t.Tenant != tenant {
+		return Template{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// List returns tenant's templates, most recently updated first.
+func (l *Library) List(tenant string) []Template {
+	l.mu.RLock()
+	var out []Template
+	for _, t := range l.templates {
+		if t.Tenant == tenant {
+			out = append(out, t)
+		}
+	}
+	l.mu.RUnlock()
+	sort.Slice(out, func(a, b int) bool { return out[a].UpdatedAt.After(out[b].UpdatedAt) })
+	return out
+}
+
+// File returns the path of version of tenant's template id, and the version
+// itself; version 0 is the latest. The file must not be modified.
+func (l *Library) File(tenant, id string, version int) (string, Version, error) {
+	t, err := l.Get(tenant, id)
+	if err != nil {
+		return "", Version{}, err
+	}
+	if version == 0 {
+		version = t.Latest().Version
+	}
+	if version < 1 || version > len(t.Versions) {
+		return "", Version{}, ErrNotFound
+	}
+	return l.versionPath(id, version), t.Versions[version-1], nil
+}
+
+// Delete removes tenant's template id with every version.
+func (l *Library) Delete(tenant, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.templates[id]
+	if !ok || t.Tenant != tenant {
+		return ErrNotFound
+	}
+	delete(l.templates, id)
+	if err := os.RemoveAll(filepath.Join(l.dir, id)); err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	return nil
+}
+
+func (l *Library) versionPath(id string, version int) string {
+	return filepath.Join(l.dir, id, "v"+strconv.Itoa(version)+".docx")
+}
+
+// writeFile writes data to path atomically.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("templates: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random 128-bit hex template ID.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,89 @@
+package templates_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/templates"
+)
+
+func TestLibrary_Versions(t *testing.T) {
+	lib, err := templates.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := lib.Create("acme", "invoice", []byte("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.ID == "" || tpl.Name != "invoice" || len(tpl.Versions) != 1 || tpl.Latest().Version != 1 || tpl.Latest().Size != 2 {
+		t.Fatalf("created %+v", tpl)
+	}
+	tpl, err = lib.AddVersion("acme", tpl.ID, []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpl.Versions) != 2 || tpl.Latest().Version != 2 || tpl.Versions[0].SHA256 == tpl.Versions[1].SHA256 {
+		t.Fatalf("versions %+v", tpl.Versions)
+	}
+
+	for version, want := range map[int]string{0: "second", 1: "v1", 2: "second"} {
+		path, v, err := lib.File("acme", tpl.ID, version)
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != want || v.Size != int64(len(want)) {
+			t.Errorf("version %d: %q, %+v", version, data, v)
+		}
+	}
+	if _, _, err := lib.File("acme", tpl.ID, 3); !errors.Is(err, templates.ErrNotFound) {
+		t.Errorf("version 3: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestLibrary_TenantScope(t *testing.T) {
+	lib, _ := templates.Open(t.TempDir())
+	mine, _ := lib.Create("acme", "invoice", []byte("a"))
+	lib.Create("globex", "letter", []byte("b"))
+	lib.Create("", "shared", []byte("c"))
+
+	if list := lib.List("acme"); len(list) != 1 || list[0].ID != mine.ID {
+		t.Errorf("acme lists %+v", list)
+	}
+	if _, err := lib.Get("globex", mine.ID); !errors.Is(err, templates.ErrNotFound) {
+		t.Errorf("another tenant's get: %v", err)
+	}
+	if _, err := lib.AddVersion("globex", mine.ID, []byte("x")); !errors.Is(err, templates.ErrNotFound) {
+		t.Errorf("another tenant's update: %v", err)
+	}
+	if err := lib.Delete("", mine.ID); !errors.Is(err, templates.ErrNotFound) {
+		t.Errorf("another tenant's delete: %v", err)
+	}
+	if err := lib.Delete("acme", mine.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Get("acme", mine.ID); !errors.Is(err, templates.ErrNotFound) {
+		t.Errorf("deleted template: %v", err)
+	}
+}
+
+func TestLibrary_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	lib, _ := templates.Open(dir)
+	tpl, _ := lib.Create("acme", "invoice", []byte("v1"))
+	lib.AddVersion("acme", tpl.ID, []byte("v2"))
+	_ = os.Mkdir(dir+"/junk", 0700)
+
+	lib, err := templates.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := lib.Get("acme", tpl.ID)
+	if err != nil || len(got.Versions) != 2 || got.Name != "invoice" {
+		t.Fatalf("reopened %+v, %v", got, err)
+	}
+	if n := len(lib.List("acme")); n != 1 {
+		t.Errorf("listed %d templates", n)
+	}
+}
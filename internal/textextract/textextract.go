@@ -0,0 +1,239 @@
+// Package textextract turns LibreOffice's text and HTML exports into the
+// blocks of text a search indexer wants: headings, paragraphs, list items
+// and table rows, in document order.
+package textextract
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Kinds of Block.
+const (
+	KindHeading   = "heading"
+	KindParagraph = "paragraph"
+	KindListItem  = "list_item"
+	KindRow       = "row"
+)
+
+// Block is one block of text.
+type Block struct {
+	Kind string `json:"kind"`
+	// Level is the heading level, 1 to 6.
+	Level int `json:"level,omitempty"`
+	// Text is the block's text, its whitespace collapsed. Empty for rows.
+	Text string `json:"text,omitempty"`
+	// Cells are a row's cells.
+	Cells []string `json:"cells,omitempty"`
+}
+
+// String returns the block as a line of text; a row's cells are separated by
+// tabs.
+func (b Block) String() string {
+	if b.Kind == KindRow {
+		return strings.Join(b.Cells, "\t")
+	}
+	return b.Text
+}
+
+// Text joins blocks into plain text, a line each.
+func Text(blocks []Block) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		sb.WriteString(b.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// ParseText splits a plain text export, a paragraph per line, into
+// paragraphs. Blank lines are dropped.
+func ParseText(r io.Reader) ([]Block, error) {
+	var blocks []Block
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+	for first := true; sc.Scan(); first = false {
+		line := sc.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if text := collapse(line); text != "" {
+			blocks = append(blocks, Block{Kind: KindParagraph, Text: text})
+		}
+	}
+	return blocks, sc.Err()
+}
+
+// blockKinds maps the HTML elements that start a block to its kind.
+var blockKinds = map[string]string{
+	"h1": KindHeading, "h2": KindHeading, "h3": KindHeading,
+	"h4": KindHeading, "h5": KindHeading, "h6": KindHeading,
+	"p": KindParagraph, "div": KindParagraph, "pre": KindParagraph,
+	"blockquote": KindParagraph, "caption": KindParagraph,
+	"dt": KindParagraph, "dd": KindParagraph,
+	"li": KindListItem,
+}
+
+// skipped are the elements whose content is not document text.
+var skipped = map[string]bool{"head": true, "script": true, "style": true}
+
+// ParseHTML extracts the blocks of an HTML export, XHTML or the looser HTML
+// the spreadsheet filter writes. A table row is one block, its cells holding
+// the text of every block inside them; empty rows are dropped.
+func ParseHTML(r io.Reader) ([]Block, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	p := &htmlParser{}
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			p.start(strings.ToLower(t.Name.Local))
+		case xml.EndElement:
+			p.end(strings.ToLower(t.Name.Local))
+		case xml.CharData:
+			if p.skip == 0 {
+				p.text.Write(t)
+			}
+		}
+	}
+	p.flush()
+	return p.blocks, nil
+}
+
+// htmlParser accumulates blocks from a stream of HTML tokens.
+type htmlParser struct {
+	blocks []Block
+	skip   int // depth inside skipped elements
+
+	kind  string // of the block being read, "" outside one
+	level int
+	text  strings.Builder
+
+	inRow  bool
+	inCell bool
+	cells  []string
+}
+
+func (p *htmlParser) start(name string) {
+	switch {
+	case skipped[name]:
+		p.skip++
+	case p.skip > 0:
+	case name == "tr":
+		p.flush()
+		p.inRow, p.cells = true, nil
+	case name == "td" || name == "th":
+		if p.inRow {
+			p.endCell()
+			// Whatever came between the cells is not in either.
+			p.text.Reset()
+			p.inCell = true
+		}
+	case name == "br":
+		p.text.WriteByte(' ')
+	case blockKinds[name] != "":
+		if p.inRow {
+			// A block inside a cell is part of the cell.
+			p.text.WriteByte(' ')
+			return
+		}
+		kind := blockKinds[name]
+		if p.kind != "" && kind == KindParagraph && collapse(p.text.String()) == "" {
+			// A paragraph opening an empty block, as in <li><p>, is that
+			// block.
+			return
+		}
+		p.flush()
+		p.kind = kind
+		if p.kind == KindHeading {
+			p.level = int(name[1] - '0')
+		}
+	}
+}
+
+func (p *htmlParser) end(name string) {
+	switch {
+	case skipped[name]:
+		if p.skip > 0 {
+			p.skip--
+		}
+	case p.skip > 0:
+	case name == "tr" || name == "table":
+		p.endRow()
+	case name == "td" || name == "th":
+		if p.inRow {
+			p.endCell()
+		}
+	case blockKinds[name] != "" && !p.inRow:
+		p.flush()
+	}
+}
+
+// endCell closes the cell being read, if one is.
+func (p *htmlParser) endCell() {
+	if !p.inCell {
+		return
+	}
+	p.cells = append(p.cells, collapse(p.text.String()))
+	p.text.Reset()
+	p.inCell = false
+}
+
+// endRow emits the row being read, less its trailing empty cells, unless
+// all its cells are empty.
+func (p *htmlParser) endRow() {
+	if !p.inRow {
+		return
+	}
+	p.endCell()
+	p.text.Reset()
+	cells := p.cells
+	p.inRow, p.cells = false, nil
+	for len(cells) > 0 && cells[len(cells)-1] == "" {
+		cells = cells[:len(cells)-1]
+	}
+	if len(cells) > 0 {
+		p.blocks = append(p.blocks, Block{Kind: KindRow, Cells: cells})
+	}
+}
+
+// flush emits the text read outside a row as a block, a paragraph if no
+// block element started it.
+func (p *htmlParser) flush() {
+	p.endRow()
+	text := collapse(p.text.String())
+	p.text.Reset()
+	if text != "" {
+		kind := p.kind
+		if kind == "" {
+			kind = KindParagraph
+		}
+		b := Block{Kind: kind, Text: text}
+		if kind == KindHeading {
+			b.Level = p.level
+		}
+		p.blocks = append(p.blocks, b)
+	}
+	p.kind, p.level = "", 0
+}
+
+// collapse trims s and collapses its runs of whitespace, including
+// non-breaking spaces, to single spaces.
+func collapse(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\u00a0'
+	}), " ")
+}
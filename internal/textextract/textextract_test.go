@@ -0,0 +1,92 @@
+package textextract_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/textextract"
+)
+
+func TestParseText(t *testing.T) {
+	blocks, err := textextract.ParseText(strings.NewReader("\ufeffQuarterly report\r\n\r\n  Revenue   grew.\nMargins held.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []textextract.Block{
+		{Kind: textextract.KindParagraph, Text: "Quarterly report"},
+		{Kind: textextract.KindParagraph, Text: "Revenue grew."},
+		{Kind: textextract.KindParagraph, Text: "Margins held."},
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("ParseText = %+v", blocks)
+	}
+}
+
+// writerXHTML is the shape of the Writer XHTML export.
+const writerXHTML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.1//EN" "http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>input</title><style type="text/css">p { margin: 0 }</style></head>
+<body dir="ltr">
+<h1 class="Heading_20_1">Quarterly&nbsp;report</h1>
+<p class="P1">Revenue <span class="T1">grew</span>.<br/>Margins held.</p>
+<ul><li><p class="P2">First point</p></li><li><p class="P2">Second</p></li></ul>
+<table border="0"><tr><td><p class="P3">Region</p></td><td><p>Q1</p></td></tr>
+<tr><td><p>EMEA</p></td><td><p>1 200</p></td><td><p></p></td></tr></table>
+<p class="P1"> </p>
+</body></html>`
+
+// calcHTML is the shape of the spreadsheet export: HTML 4, upper case, with
+// unclosed cells.
+const calcHTML = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.0 Transitional//EN">
+<HTML><HEAD><META HTTP-EQUIV="CONTENT-TYPE" CONTENT="text/html; charset=utf-8"><TITLE></TITLE></HEAD>
+<BODY TEXT="#000000">
+<A NAME="table0"></A><H1>Sheet1</H1>
+<TABLE CELLSPACING=0 BORDER=0>
+	<TR><TD HEIGHT=17 ALIGN=LEFT>Name<TD ALIGN=RIGHT>Qty</TR>
+	<TR><TD></TD><TD ALIGN=RIGHT SDVAL="3" SDNUM="1033;">3</TD></TR>
+	<TR><TD></TD><TD></TD></TR>
+</TABLE>
+<BR><HR>
+</BODY></HTML>`
+
+func TestParseHTML(t *testing.T) {
+	for name, tc := range map[string]struct {
+		html string
+		want []textextract.Block
+	}{
+		"writer": {writerXHTML, []textextract.Block{
+			{Kind: textextract.KindHeading, Level: 1, Text: "Quarterly report"},
+			{Kind: textextract.KindParagraph, Text: "Revenue grew. Margins held."},
+			{Kind: textextract.KindListItem, Text: "First point"},
+			{Kind: textextract.KindListItem, Text: "Second"},
+			{Kind: textextract.KindRow, Cells: []string{"Region", "Q1"}},
+			{Kind: textextract.KindRow, Cells: []string{"EMEA", "1 200"}},
+		}},
+		"calc": {calcHTML, []textextract.Block{
+			{Kind: textextract.KindHeading, Level: 1, Text: "Sheet1"},
+			{Kind: textextract.KindRow, Cells: []string{"Name", "Qty"}},
+			{Kind: textextract.KindRow, Cells: []string{"", "3"}},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			blocks, err := textextract.ParseHTML(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(blocks, tc.want) {
+				t.Errorf("ParseHTML =\n%#v\nwant\n%#v", blocks, tc.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	got := textextract.Text([]textextract.Block{
+		{Kind: textextract.KindHeading, Level: 2, Text: "Totals"},
+		{Kind: textextract.KindRow, Cells: []string{"", "3"}},
+	})
+	if got != "Totals\n\t3\n" {
+		t.Errorf("Text = %q", got)
+	}
+}
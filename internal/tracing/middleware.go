@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// TraceparentHeader is the W3C trace context header.
+const TraceparentHeader = "traceparent"
+
+// Middleware starts a server span for each request, continuing the trace of
+// an incoming traceparent header or starting a new one, and ends it with the
+// response status; a 5xx marks the span as failed. The span is in the
+// request context for Start. A nil t returns next unchanged.
+func Middleware(t *Tracer, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := ParseTraceparent(r.Header.Get(TraceparentHeader))
+		ctx, span := t.Start(r.Context(), r.Method, KindServer, parent,
+			String("http.request.method", r.Method),
+			String("url.path", r.URL.Path),
+		)
+		defer span.End()
+		if id := w.Header().Get("X-Request-ID"); id != "" {
+			span.SetAttributes(String("docpdf.request_id", id))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(Int64("http.response.status_code", int64(rec.status)))
+		if rec.status >= 500 {
+			span.SetError(errors.New(strconv.Itoa(rec.status) + " " + http.StatusText(rec.status)))
+		}
+	})
+}
+
+// statusRecorder captures the response status.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if code >= 200 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter { return rec.ResponseWriter }
@@ -0,0 +1,60 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tr, rec := newTracer(t)
+	h := tracing.Middleware(tr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "work")
+		span.End()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	_ = tr.Flush(context.Background())
+
+	spans := rec.recorded()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	work, server := spans[0], spans[1]
+	if server.Name != "POST" || server.Kind != tracing.KindServer {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	if server.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("server span does not continue the incoming trace: %+v", server)
+	}
+	if work.Parent != server.Context.SpanID {
+		t.Errorf("work span is not a child of the server span")
+	}
+	if server.Error != "502 Bad Gateway" {
+		t.Errorf("Error = %q, want the 5xx status", server.Error)
+	}
+	var status any
+	for _, a := range server.Attributes {
+		if a.Key == "http.response.status_code" {
+			status = a.Value
+		}
+	}
+	if status != int64(http.StatusBadGateway) {
+		t.Errorf("status attribute = %v", status)
+	}
+}
+
+func TestMiddleware_NilTracer(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracing.SpanFromContext(r.Context()) != nil {
+			t.Error("unexpected span without a tracer")
+		}
+	})
+	tracing.Middleware(nil, next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,106 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+func TestOTLP_Export(t *testing.T) {
+	var path, auth string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("decode %s: %v", data, err)
+		}
+	}))
+	defer srv.Close()
+
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := tracing.SpanData{
+		Name:    "libreoffice.convert",
+		Kind:    tracing.KindInternal,
+		Context: tracing.SpanContext{TraceID: parent.TraceID, SpanID: tracing.SpanID{1, 2, 3, 4, 5, 6, 7, 8}, Sampled: true},
+		Parent:  parent.SpanID,
+		Start:   time.Unix(1700000000, 0),
+		End:     time.Unix(1700000001, 500),
+		Attributes: []tracing.Attribute{
+			tracing.Int64("docpdf.input_bytes", 1234),
+			tracing.Bool("b", true),
+		},
+		Error: "conversion failed",
+	}
+	exp := tracing.OTLP{
+		Endpoint: srv.URL + "/",
+		Headers:  map[string]string{"Authorization": "Bearer t0ken"},
+		Resource: []tracing.Attribute{tracing.String("service.name", "docpdf")},
+	}
+	if err := exp.Export(context.Background(), []tracing.SpanData{span}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/traces" || auth != "Bearer t0ken" {
+		t.Errorf("posted to %q with Authorization %q", path, auth)
+	}
+
+	rs := body["resourceSpans"].([]any)[0].(map[string]any)
+	res := rs["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if res["key"] != "service.name" || res["value"].(map[string]any)["stringValue"] != "docpdf" {
+		t.Errorf("unexpected resource %v", res)
+	}
+	got := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	want := map[string]any{
+		"traceId":           "4bf92f3577b34da6a3ce929d0e0e4736",
+		"spanId":            "0102030405060708",
+		"parentSpanId":      "00f067aa0ba902b7",
+		"name":              "libreoffice.convert",
+		"kind":              float64(1),
+		"startTimeUnixNano": "1700000000000000000",
+		"endTimeUnixNano":   "1700000001000000500",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	attr := got["attributes"].([]any)[0].(map[string]any)
+	if attr["value"].(map[string]any)["intValue"] != "1234" {
+		t.Errorf("int attribute not encoded as a string: %v", attr)
+	}
+	if status := got["status"].(map[string]any); status["code"] != float64(2) || status["message"] != "conversion failed" {
+		t.Errorf("unexpected status %v", status)
+	}
+}
+
+func TestOTLP_ExportFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := tracing.OTLP{Endpoint: srv.URL}.Export(context.Background(), []tracing.SpanData{{Name: "x"}})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected a 503 error, got %v", err)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	h, err := tracing.ParseHeaders("api-key=abc%3D%3D, x-tenant = acme ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h["api-key"] != "abc==" || h["x-tenant"] != "acme" {
+		t.Errorf("unexpected headers %v", h)
+	}
+	if _, err := tracing.ParseHeaders("novalue"); err == nil {
+		t.Error("expected an error for a pair without =")
+	}
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Exporter delivers finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Config configures a Tracer.
+type Config struct {
+	Exporter Exporter
+	// FlushInterval is how often queued spans are exported. Default 5s.
+	FlushInterval time.Duration
+	// BatchSize is how many queued spans trigger an export before the
+	// interval is up. Default 512.
+	BatchSize int
+	// MaxQueue caps the spans waiting for export; spans ended while it is
+	// full are dropped, so a collector outage cannot exhaust memory.
+	// Default 4096.
+	MaxQueue int
+	// OnError, if set, is told about failed exports and dropped spans.
+	// Tracing is best effort: spans that failed to export are not retried.
+	OnError func(error)
+}
+
+// Tracer starts spans and exports them in batches.
+type Tracer struct {
+	cfg Config
+
+	mu      sync.Mutex
+	queue   []SpanData
+	dropped int
+
+	full chan struct{} // signalled when the queue reaches BatchSize
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a Tracer exporting to cfg.Exporter. Call Close to stop it and
+// export what is queued.
+func New(cfg Config) *Tracer {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = 4096
+	}
+	t := &Tracer{
+		cfg:  cfg,
+		full: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go t.exportLoop()
+	return t
+}
+
+// enqueue queues a finished span for export.
+func (t *Tracer) enqueue(span SpanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.queue) >= t.cfg.MaxQueue {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, span)
+	if len(t.queue) >= t.cfg.BatchSize {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush exports every queued span, in batches of at most BatchSize.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans, dropped := t.queue, t.dropped
+	t.queue, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	var err error
+	if dropped > 0 {
+		err = fmt.Errorf("tracing: dropped %d spans, export queue full", dropped)
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), t.cfg.BatchSize)
+		if exportErr := t.cfg.Exporter.Export(ctx, spans[:n]); exportErr != nil {
+			err = fmt.Errorf("tracing: exporting %d spans: %w", n, exportErr)
+		}
+		spans = spans[n:]
+	}
+	return err
+}
+
+// Close stops periodic exports and exports what is still queued.
+func (t *Tracer) Close(ctx context.Context) error {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	<-t.done
+	return t.Flush(ctx)
+}
+
+func (t *Tracer) exportLoop() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		case <-t.full:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.cfg.FlushInterval)
+		if err := t.Flush(ctx); err != nil && t.cfg.OnError != nil {
+			t.cfg.OnError(err)
+		}
+		cancel()
+	}
+}
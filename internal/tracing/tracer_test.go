@@ -0,0 +1,79 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+func endSpans(tr *tracing.Tracer, n int) {
+	for range n {
+		_, span := tr.Start(context.Background(), "span", tracing.KindInternal, tracing.SpanContext{})
+		span.End()
+	}
+}
+
+func TestTracer_ExportsFullBatch(t *testing.T) {
+	rec := &recorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour, BatchSize: 3})
+	defer tr.Close(context.Background())
+
+	endSpans(tr, 3)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.recorded()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("a full batch was not exported before the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTracer_CloseFlushes(t *testing.T) {
+	rec := &recorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour})
+	endSpans(tr, 2)
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rec.recorded()); n != 2 {
+		t.Errorf("expected 2 spans exported on Close, got %d", n)
+	}
+}
+
+func TestTracer_DropsWhenQueueFull(t *testing.T) {
+	rec := &recorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour, BatchSize: 10, MaxQueue: 2})
+	endSpans(tr, 5)
+	err := tr.Close(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "dropped 3 spans") {
+		t.Errorf("expected dropped spans to be reported, got %v", err)
+	}
+	if n := len(rec.recorded()); n != 2 {
+		t.Errorf("expected 2 spans exported, got %d", n)
+	}
+}
+
+func TestTracer_ReportsExportErrors(t *testing.T) {
+	rec := &recorder{err: errors.New("collector down")}
+	errs := make(chan error, 1)
+	tr := tracing.New(tracing.Config{
+		Exporter:      rec,
+		FlushInterval: 10 * time.Millisecond,
+		OnError:       func(err error) { errs <- err },
+	})
+	defer tr.Close(context.Background())
+
+	endSpans(tr, 1)
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "collector down") {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("export error not reported")
+	}
+}
@@ -0,0 +1,257 @@
+// Package tracing records OpenTelemetry-compatible traces: a server span per
+// request, continuing the trace of an incoming W3C traceparent header, with
+// child spans for the work done on its behalf, such as the LibreOffice
+// subprocess. Finished spans are batched and exported, over OTLP/HTTP when
+// an OpenTelemetry collector is configured.
+//
+// Code that wants a span calls Start with the request's context; without a
+// traced request in the context it gets a nil *Span, whose methods do
+// nothing, so tracing costs nothing when it is off.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the ID in lowercase hex.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the ID in lowercase hex.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that is propagated between services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled is the traceparent sampled flag: whether the trace is being
+	// recorded. Spans of an unsampled trace are propagated but not exported.
+	Sampled bool
+}
+
+// IsValid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a version 00 W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value. Versions after 00
+// are accepted as long as they start with the version 00 fields, as the
+// specification asks.
+func ParseTraceparent(h string) (SpanContext, bool) {
+	h = strings.TrimSpace(h)
+	const size = 55 // 00-<32 hex>-<16 hex>-<2 hex>
+	if len(h) < size || h[2] != '-' || h[35] != '-' || h[52] != '-' {
+		return SpanContext{}, false
+	}
+	version := h[:2]
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(h) != size) || (len(h) > size && h[size] != '-') {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], h[3:35]) || !decodeHex(sc.SpanID[:], h[36:52]) || !decodeHex(flags[:], h[53:55]) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if !isLowerHex(s) {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Kind is the OpenTelemetry span kind.
+type Kind int
+
+// Span kinds, numbered as in OTLP.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attribute is a key/value pair describing a span. Value is a string,
+// int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+// Int64 returns an integer attribute.
+func Int64(key string, value int64) Attribute { return Attribute{key, value} }
+
+// Float64 returns a floating-point attribute.
+func Float64(key string, value float64) Attribute { return Attribute{key, value} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// SpanData is a finished span, as handed to an Exporter.
+type SpanData struct {
+	Name    string
+	Kind    Kind
+	Context SpanContext
+	// Parent is the parent span's ID; zero for the root of a trace.
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	// Error, if set, marks the span as failed with this message.
+	Error string
+}
+
+// Span is a span in progress. All methods are safe on a nil *Span and do
+// nothing.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Context returns the span's SpanContext, or the zero SpanContext for a nil
+// span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// SetAttributes adds attrs to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export if its trace is sampled.
+// Only the first call has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.Context.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Traceparent returns the traceparent header value of the span in ctx, so
+// work that outlives it, or runs elsewhere, can continue its trace; "" when
+// ctx has no span.
+func Traceparent(ctx context.Context) string {
+	sc := SpanFromContext(ctx).Context()
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.Traceparent()
+}
+
+// ContextWithSpan returns ctx carrying span, so work done in the background
+// on behalf of a request is traced under the request's span even after that
+// has ended. A nil span returns ctx.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start starts a span named name as a child of the span in ctx, returning a
+// context carrying the new span. Without a span in ctx it returns ctx and a
+// nil span. The caller must End the span.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, KindInternal, parent.Context(), attrs...)
+}
+
+// Start starts a span of kind in the trace of parent, a span of another
+// service, or the root span of a new trace when parent is not valid. It
+// returns a context carrying the new span; the caller must End it.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, parent SpanContext, attrs ...Attribute) (context.Context, *Span) {
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+	if !parent.IsValid() {
+		parent = SpanContext{}
+		_, _ = rand.Read(sc.TraceID[:])
+		sc.Sampled = true
+	}
+	_, _ = rand.Read(sc.SpanID[:])
+	s := &Span{tracer: t, data: SpanData{
+		Name:       name,
+		Kind:       kind,
+		Context:    sc,
+		Parent:     parent.SpanID,
+		Start:      time.Now(),
+		Attributes: attrs,
+	}}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
@@ -0,0 +1,172 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+// recorder is an Exporter that keeps what it is given.
+type recorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+	err   error
+}
+
+func (r *recorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return r.err
+}
+
+func (r *recorder) recorded() []tracing.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]tracing.SpanData(nil), r.spans...)
+}
+
+// newTracer returns a tracer exporting to a recorder, closed with the test.
+func newTracer(t *testing.T) (*tracing.Tracer, *recorder) {
+	t.Helper()
+	rec := &recorder{}
+	tr := tracing.New(tracing.Config{Exporter: rec})
+	t.Cleanup(func() { _ = tr.Close(context.Background()) })
+	return tr, rec
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := tracing.ParseTraceparent(tp)
+	if !ok {
+		t.Fatalf("ParseTraceparent(%q) failed", tp)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Errorf("Traceparent() = %q, want %q", got, tp)
+	}
+
+	if sc, ok := tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok || sc.Sampled {
+		t.Errorf("future version: got %+v, %v", sc, ok)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+	} {
+		if _, ok := tracing.ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent(%q) accepted", bad)
+		}
+	}
+}
+
+func TestStart_NoSpanInContext(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), "child")
+	if span != nil || tracing.SpanFromContext(ctx) != nil {
+		t.Fatal("expected no span without a parent")
+	}
+	// A nil span is usable.
+	span.SetAttributes(tracing.String("k", "v"))
+	span.SetError(errors.New("boom"))
+	span.End()
+}
+
+func TestStart_Child(t *testing.T) {
+	tr, rec := newTracer(t)
+	ctx, root := tr.Start(context.Background(), "root", tracing.KindServer, tracing.SpanContext{})
+	_, child := tracing.Start(ctx, "child", tracing.String("k", "v"))
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := rec.recorded()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "child" || c.Kind != tracing.KindInternal || c.Error != "boom" {
+		t.Errorf("unexpected child %+v", c)
+	}
+	if c.Context.TraceID != r.Context.TraceID || c.Parent != r.Context.SpanID {
+		t.Errorf("child not in the root's trace: %+v, root %+v", c, r)
+	}
+	if r.Parent != (tracing.SpanID{}) || !r.Context.Sampled {
+		t.Errorf("root should be a sampled root span: %+v", r)
+	}
+	if len(c.Attributes) != 1 || c.Attributes[0] != tracing.String("k", "v") {
+		t.Errorf("unexpected child attributes %v", c.Attributes)
+	}
+}
+
+func TestStart_RemoteParent(t *testing.T) {
+	tr, rec := newTracer(t)
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := tr.Start(context.Background(), "server", tracing.KindServer, parent)
+	span.End()
+
+	unsampled := parent
+	unsampled.Sampled = false
+	_, span = tr.Start(context.Background(), "unsampled", tracing.KindServer, unsampled)
+	if span.Context().TraceID != parent.TraceID {
+		t.Error("unsampled span should still continue the trace")
+	}
+	span.End()
+	_ = tr.Flush(context.Background())
+
+	spans := rec.recorded()
+	if len(spans) != 1 {
+		t.Fatalf("expected only the sampled span, got %d", len(spans))
+	}
+	if spans[0].Context.TraceID != parent.TraceID || spans[0].Parent != parent.SpanID {
+		t.Errorf("span does not continue the remote trace: %+v", spans[0])
+	}
+}
+
+func TestContextWithSpan(t *testing.T) {
+	tr, rec := newTracer(t)
+	_, root := tr.Start(context.Background(), "request", tracing.KindServer, tracing.SpanContext{})
+	root.End()
+
+	// Background work started after the request finished.
+	ctx := tracing.ContextWithSpan(context.Background(), root)
+	_, span := tracing.Start(ctx, "job")
+	span.End()
+	_ = tr.Flush(context.Background())
+
+	spans := rec.recorded()
+	if len(spans) != 2 || spans[1].Parent != root.Context().SpanID {
+		t.Errorf("job span not traced under the request: %+v", spans)
+	}
+	if ctx := tracing.ContextWithSpan(context.Background(), nil); tracing.SpanFromContext(ctx) != nil {
+		t.Error("a nil span should leave the context alone")
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	tr, _ := newTracer(t)
+	if got := tracing.Traceparent(context.Background()); got != "" {
+		t.Errorf("expected no traceparent without a span, got %q", got)
+	}
+	ctx, span := tr.Start(context.Background(), "request", tracing.KindServer, tracing.SpanContext{})
+	defer span.End()
+
+	sc, ok := tracing.ParseTraceparent(tracing.Traceparent(ctx))
+	if !ok || sc != span.Context() {
+		t.Errorf("traceparent does not carry the span: %+v", sc)
+	}
+}
@@ -0,0 +1,167 @@
+package visualdiff
+
+import (
+	"image"
+	"slices"
+)
+
+// Options tunes Compare.
+type Options struct {
+	// Threshold is the SSIM below which a page, or a block of one, counts
+	// as changed. Default 0.98.
+	Threshold float64
+	// Block is the side in pixels of the squares changed regions are built
+	// from. Default 32.
+	Block int
+	// MaxRegions caps the regions reported per page, largest first.
+	// Default 10.
+	MaxRegions int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Threshold <= 0 {
+		o.Threshold = 0.98
+	}
+	if o.Block <= 0 {
+		o.Block = 32
+	}
+	if o.MaxRegions <= 0 {
+		o.MaxRegions = 10
+	}
+	return o
+}
+
+// Page is the comparison of one page.
+type Page struct {
+	// Number is the 1-based page number.
+	Number int `json:"page"`
+	// SSIM is the page's structural similarity; 0 when the page is missing
+	// from one rendering or changed size.
+	SSIM float64 `json:"ssim"`
+	// Changed is true when SSIM, or that of any block of the page, is
+	// below the threshold: a changed word barely moves the page's score.
+	Changed bool `json:"changed"`
+	// Note explains a page that could not be compared pixel by pixel.
+	Note string `json:"note,omitempty"`
+	// Regions are the changed areas, largest first.
+	Regions []Region `json:"regions,omitempty"`
+	// Thumbnails are the files Report.Write saved for the regions, or for
+	// the whole page when it could not be compared, relative to the report.
+	Thumbnails []string `json:"thumbnails,omitempty"`
+
+	a, b image.Image
+}
+
+// Region is a rectangle of a page, in pixels of its rendering.
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Rect returns r as an image.Rectangle.
+func (r Region) Rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+func regionOf(r image.Rectangle) Region {
+	return Region{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Compare scores each pair of pages of a and b, the renderings of the same
+// document by two converters. A page present in only one of them, or whose
+// size changed, is reported as changed without a score.
+func Compare(a, b []image.Image, opts Options) []Page {
+	opts = opts.withDefaults()
+	pages := make([]Page, max(len(a), len(b)))
+	for i := range pages {
+		p := Page{Number: i + 1}
+		switch {
+		case i >= len(a):
+			p.Changed, p.Note, p.b = true, "only in B", b[i]
+		case i >= len(b):
+			p.Changed, p.Note, p.a = true, "only in A", a[i]
+		case a[i].Bounds().Size() != b[i].Bounds().Size():
+			p.Changed, p.Note, p.a, p.b = true, "page size changed", a[i], b[i]
+		default:
+			p.a, p.b = a[i], b[i]
+			p.SSIM, p.Regions = comparePage(a[i], b[i], opts)
+			p.Changed = p.SSIM < opts.Threshold || len(p.Regions) > 0
+		}
+		pages[i] = p
+	}
+	return pages
+}
+
+// comparePage returns the SSIM of two same-sized pages and the regions
+// whose blocks score below the threshold.
+func comparePage(a, b image.Image, opts Options) (float64, []Region) {
+	ga, gb := toGray(a), toGray(b)
+	if ga.w == 0 || ga.h == 0 {
+		return 1, nil
+	}
+	m := newMoments(ga, gb)
+	score := clamp(m.meanSSIM(0, 0, ga.w, ga.h))
+
+	cols := (ga.w + opts.Block - 1) / opts.Block
+	rows := (ga.h + opts.Block - 1) / opts.Block
+	changed := make([]bool, cols*rows)
+	for r := range rows {
+		for c := range cols {
+			x0, y0 := c*opts.Block, r*opts.Block
+			x1, y1 := min(x0+opts.Block, ga.w), min(y0+opts.Block, ga.h)
+			changed[r*cols+c] = m.meanSSIM(x0, y0, x1, y1) < opts.Threshold
+		}
+	}
+	rects := mergeBlocks(changed, cols, rows, opts.Block, image.Rect(0, 0, ga.w, ga.h))
+	if len(rects) > opts.MaxRegions {
+		rects = rects[:opts.MaxRegions]
+	}
+	var regions []Region
+	for _, r := range rects {
+		regions = append(regions, regionOf(r.Add(a.Bounds().Min)))
+	}
+	return score, regions
+}
+
+// mergeBlocks joins edge-adjacent changed blocks into regions, returned as
+// bounding rectangles clipped to bounds, largest first.
+func mergeBlocks(changed []bool, cols, rows, block int, bounds image.Rectangle) []image.Rectangle {
+	seen := make([]bool, len(changed))
+	var regions []image.Rectangle
+	for start := range changed {
+		if !changed[start] || seen[start] {
+			continue
+		}
+		var r image.Rectangle
+		stack := []int{start}
+		seen[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c, row := i%cols, i/cols
+			cell := image.Rect(c*block, row*block, (c+1)*block, (row+1)*block)
+			if r.Empty() {
+				r = cell
+			} else {
+				r = r.Union(cell)
+			}
+			for _, n := range [][2]int{{c - 1, row}, {c + 1, row}, {c, row - 1}, {c, row + 1}} {
+				if n[0] < 0 || n[0] >= cols || n[1] < 0 || n[1] >= rows {
+					continue
+				}
+				if j := n[1]*cols + n[0]; changed[j] && !seen[j] {
+					seen[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		regions = append(regions, r.Intersect(bounds))
+	}
+	// Largest first, keeping reading order among equals.
+	slices.SortStableFunc(regions, func(a, b image.Rectangle) int {
+		return b.Dx()*b.Dy() - a.Dx()*a.Dy()
+	})
+	return regions
+}
@@ -0,0 +1,62 @@
+package visualdiff_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/visualdiff"
+)
+
+func TestCompare(t *testing.T) {
+	same := page(320, 320, [2]int{20, 200}, [2]int{40, 200})
+	// Page 2 gains a line at the bottom.
+	before := page(320, 320, [2]int{20, 200})
+	after := page(320, 320, [2]int{20, 200}, [2]int{250, 100})
+
+	pages := visualdiff.Compare(
+		[]image.Image{same, before, same},
+		[]image.Image{same, after, same, page(320, 320)},
+		visualdiff.Options{},
+	)
+	if len(pages) != 4 {
+		t.Fatalf("expected 4 pages, got %d", len(pages))
+	}
+	if p := pages[0]; p.Changed || p.SSIM != 1 || len(p.Regions) != 0 {
+		t.Errorf("page 1 should be unchanged: %+v", p)
+	}
+	p := pages[1]
+	if !p.Changed || len(p.Regions) != 1 {
+		t.Fatalf("page 2 should have one changed region: %+v", p)
+	}
+	// The new line is at y 250–256, x 20–120; the region covers it in
+	// whole 32px blocks.
+	if r := p.Regions[0].Rect(); !image.Rect(20, 250, 120, 256).In(r) || r.Min.Y < 200 {
+		t.Errorf("region %v does not frame the added line", r)
+	}
+	if p := pages[3]; !p.Changed || p.Note != "only in B" {
+		t.Errorf("page 4 should be reported missing from A: %+v", p)
+	}
+
+	report := visualdiff.NewReport("doc.docx", "old", "new", pages, visualdiff.Options{})
+	if report.Changed != 2 || report.MinSSIM != 0 {
+		t.Errorf("unexpected summary: %d changed, min %v", report.Changed, report.MinSSIM)
+	}
+}
+
+func TestCompare_PageSizeChanged(t *testing.T) {
+	pages := visualdiff.Compare([]image.Image{page(100, 140)}, []image.Image{page(140, 100)}, visualdiff.Options{})
+	if p := pages[0]; !p.Changed || p.Note != "page size changed" || p.SSIM != 0 {
+		t.Errorf("unexpected result %+v", p)
+	}
+}
+
+func TestCompare_MaxRegions(t *testing.T) {
+	var lines [][2]int
+	for y := 10; y < 300; y += 64 {
+		lines = append(lines, [2]int{y, 100})
+	}
+	pages := visualdiff.Compare([]image.Image{page(320, 320)}, []image.Image{page(320, 320, lines...)}, visualdiff.Options{MaxRegions: 2})
+	if n := len(pages[0].Regions); n != 2 {
+		t.Errorf("expected regions capped at 2, got %d", n)
+	}
+}
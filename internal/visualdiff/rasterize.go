@@ -0,0 +1,84 @@
+package visualdiff
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BRO3886/go-docpdf/internal/tempclean"
+)
+
+// Rasterizer renders every page of a PDF to an image.
+type Rasterizer interface {
+	Rasterize(ctx context.Context, pdfPath string) ([]image.Image, error)
+}
+
+// Pdftoppm rasterizes with poppler's pdftoppm.
+type Pdftoppm struct {
+	// Path is the pdftoppm executable. Default "pdftoppm".
+	Path string
+	// DPI is the rendering resolution. Default 72, a pixel per point.
+	DPI int
+}
+
+// Rasterize renders pdfPath into a temp dir and loads the pages in order.
+func (p Pdftoppm) Rasterize(ctx context.Context, pdfPath string) ([]image.Image, error) {
+	bin, dpi := p.Path, p.DPI
+	if bin == "" {
+		bin = "pdftoppm"
+	}
+	if dpi <= 0 {
+		dpi = 72
+	}
+	dir, err := os.MkdirTemp("", tempclean.Pattern("raster", ""))
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.CommandContext(ctx, bin, "-r", strconv.Itoa(dpi), "-png", pdfPath, filepath.Join(dir, "page"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return loadPages(dir)
+}
+
+// loadPages decodes the page-N.png files in dir in page order. pdftoppm pads
+// N to the width of the page count, so the numbers are compared, not the
+// names.
+func loadPages(dir string) ([]image.Image, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	number := func(path string) int {
+		n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "page-"), ".png"))
+		return n
+	}
+	slices.SortFunc(paths, func(a, b string) int { return number(a) - number(b) })
+
+	pages := make([]image.Image, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		pages = append(pages, img)
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("pdftoppm rendered no pages")
+	}
+	return pages, nil
+}
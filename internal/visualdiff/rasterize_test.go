@@ -0,0 +1,68 @@
+package visualdiff_test
+
+import (
+	"context"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/visualdiff"
+)
+
+// fakePdftoppm writes a script that, like pdftoppm, renders pages named
+// <prefix>-NN.png, here copies of the given pages.
+func fakePdftoppm(t *testing.T, pageHeights ...int) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\n"
+	for i, h := range pageHeights {
+		src := filepath.Join(dir, fmt.Sprintf("src-%d.png", i+1))
+		f, err := os.Create(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = png.Encode(f, page(10, h))
+		f.Close()
+		script += fmt.Sprintf("cp %s \"$last-%02d.png\"\n", src, i+1)
+	}
+	path := filepath.Join(dir, "pdftoppm")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPdftoppm_LoadsPagesInOrder(t *testing.T) {
+	heights := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	r := visualdiff.Pdftoppm{Path: fakePdftoppm(t, heights...)}
+	pages, err := r.Rasterize(context.Background(), "doc.pdf")
+	if err != nil {
+		t.Fatalf("Rasterize: %v", err)
+	}
+	if len(pages) != len(heights) {
+		t.Fatalf("expected %d pages, got %d", len(heights), len(pages))
+	}
+	for i, p := range pages {
+		if p.Bounds().Dy() != heights[i] {
+			t.Errorf("page %d has height %d, want %d", i+1, p.Bounds().Dy(), heights[i])
+		}
+	}
+}
+
+func TestPdftoppm_Failure(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "pdftoppm")
+	_ = os.WriteFile(script, []byte("#!/bin/sh\necho 'Syntax Error: broken PDF' >&2\nexit 1\n"), 0755)
+	_, err := visualdiff.Pdftoppm{Path: script}.Rasterize(context.Background(), "doc.pdf")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if want := "broken PDF"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not carry pdftoppm's output", err)
+	}
+	if _, err := (visualdiff.Pdftoppm{Path: fakePdftoppm(t)}).Rasterize(context.Background(), "doc.pdf"); err == nil {
+		t.Error("expected an error when no pages are rendered")
+	}
+}
@@ -0,0 +1,205 @@
+package visualdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// Report is the outcome of comparing one document rendered by converters A
+// and B.
+type Report struct {
+	Document  string  `json:"document"`
+	A         string  `json:"a"`
+	B         string  `json:"b"`
+	Threshold float64 `json:"threshold"`
+	Pages     []Page  `json:"pages"`
+	// Changed is the number of changed pages.
+	Changed int `json:"changed"`
+	// MinSSIM is the lowest page score.
+	MinSSIM float64 `json:"min_ssim"`
+}
+
+// NewReport summarizes pages compared with opts.
+func NewReport(document, a, b string, pages []Page, opts Options) *Report {
+	r := &Report{Document: document, A: a, B: b, Threshold: opts.withDefaults().Threshold, Pages: pages, MinSSIM: 1}
+	for _, p := range pages {
+		if p.Changed {
+			r.Changed++
+		}
+		r.MinSSIM = min(r.MinSSIM, p.SSIM)
+	}
+	return r
+}
+
+// Thumbnail geometry: context kept around a region, the gap between the A
+// and B sides, and the widest a thumbnail may be.
+const (
+	thumbPadding  = 16
+	thumbGap      = 8
+	thumbMaxWidth = 800
+	pageThumbW    = 240
+)
+
+var (
+	highlight = color.RGBA{R: 0xe0, A: 0xff}
+	backdrop  = color.RGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+)
+
+// Write saves the report in dir: report.json, index.html, and a PNG per
+// changed region showing A on the left and B on the right with the region
+// outlined. Pages that could not be compared get a side-by-side of the
+// whole pages instead.
+func (r *Report) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i := range r.Pages {
+		p := &r.Pages[i]
+		p.Thumbnails = nil
+		if !p.Changed {
+			continue
+		}
+		if len(p.Regions) == 0 {
+			name := fmt.Sprintf("page-%d.png", p.Number)
+			if err := savePNG(filepath.Join(dir, name), sideBySide(p.a, p.b, image.Rectangle{}, pageThumbW*2+thumbGap)); err != nil {
+				return err
+			}
+			p.Thumbnails = append(p.Thumbnails, name)
+			continue
+		}
+		for j, region := range p.Regions {
+			name := fmt.Sprintf("page-%d-region-%d.png", p.Number, j+1)
+			if err := savePNG(filepath.Join(dir, name), sideBySide(p.a, p.b, region.Rect(), thumbMaxWidth)); err != nil {
+				return err
+			}
+			p.Thumbnails = append(p.Thumbnails, name)
+		}
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	if err := reportHTML.Execute(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sideBySide crops region (grown by thumbPadding) out of a and b and places
+// the crops next to each other with the region outlined, scaled down to at
+// most maxWidth. An empty region takes the whole pages; a nil page is left
+// blank.
+func sideBySide(a, b image.Image, region image.Rectangle, maxWidth int) image.Image {
+	crop := region.Inset(-thumbPadding)
+	if region.Empty() {
+		for _, img := range []image.Image{a, b} {
+			if img != nil {
+				crop = crop.Union(img.Bounds())
+			}
+		}
+	}
+	w, h := crop.Dx(), crop.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, 2*w+thumbGap, h))
+	draw.Draw(out, out.Bounds(), image.NewUniform(backdrop), image.Point{}, draw.Src)
+	for i, img := range []image.Image{a, b} {
+		dst := image.Rect(i*(w+thumbGap), 0, i*(w+thumbGap)+w, h)
+		if img == nil {
+			continue
+		}
+		draw.Draw(out, dst, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(out, dst, img, crop.Min, draw.Src)
+		if !region.Empty() {
+			outline(out, region.Sub(crop.Min).Add(dst.Min))
+		}
+	}
+	return shrink(out, maxWidth)
+}
+
+// outline draws a 2-pixel highlight border just inside r.
+func outline(img *image.RGBA, r image.Rectangle) {
+	r = r.Intersect(img.Bounds())
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+2),
+		image.Rect(r.Min.X, r.Max.Y-2, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+2, r.Max.Y),
+		image.Rect(r.Max.X-2, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, edge.Intersect(r), image.NewUniform(highlight), image.Point{}, draw.Src)
+	}
+}
+
+// shrink scales img down by an integer factor, averaging the pixels of each
+// box, until it is at most maxWidth wide.
+func shrink(img *image.RGBA, maxWidth int) image.Image {
+	b := img.Bounds()
+	f := (b.Dx() + maxWidth - 1) / maxWidth
+	if f <= 1 {
+		return img
+	}
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()/f, b.Dy()/f))
+	for y := range out.Bounds().Dy() {
+		for x := range out.Bounds().Dx() {
+			var r, g, bl, a, n uint32
+			for dy := range f {
+				for dx := range f {
+					c := img.RGBAAt(b.Min.X+x*f+dx, b.Min.Y+y*f+dy)
+					r, g, bl, a, n = r+uint32(c.R), g+uint32(c.G), bl+uint32(c.B), a+uint32(c.A), n+1
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)})
+		}
+	}
+	return out
+}
+
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var reportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Document}}: {{.A}} vs {{.B}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: .4em .8em; vertical-align: top; text-align: left; }
+.changed { background: #fdecea; }
+img { display: block; max-width: 800px; margin-bottom: .5em; border: 1px solid #999; }
+</style></head>
+<body>
+<h1>{{.Document}}</h1>
+<p>A: <code>{{.A}}</code> (left) &middot; B: <code>{{.B}}</code> (right)</p>
+<p>{{.Changed}} of {{len .Pages}} pages changed; lowest SSIM {{printf "%.4f" .MinSSIM}}, threshold {{printf "%.4f" .Threshold}}.</p>
+<table>
+<tr><th>Page</th><th>SSIM</th><th>Changes</th></tr>
+{{range .Pages}}<tr{{if .Changed}} class="changed"{{end}}>
+<td>{{.Number}}</td>
+<td>{{if .Note}}{{.Note}}{{else}}{{printf "%.4f" .SSIM}}{{end}}</td>
+<td>{{range .Thumbnails}}<img src="{{.}}" alt="{{.}}">{{else}}{{if .Changed}}changed{{else}}&ndash;{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body></html>
+`))
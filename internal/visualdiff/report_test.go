@@ -0,0 +1,64 @@
+package visualdiff_test
+
+import (
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/visualdiff"
+)
+
+func TestReport_Write(t *testing.T) {
+	pages := visualdiff.Compare(
+		[]image.Image{page(320, 320, [2]int{20, 200}), page(320, 320)},
+		[]image.Image{page(320, 320, [2]int{20, 200}, [2]int{250, 100})},
+		visualdiff.Options{},
+	)
+	dir := t.TempDir()
+	if err := visualdiff.NewReport("doc.docx", "old", "new", pages, visualdiff.Options{}).Write(dir); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got visualdiff.Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode report.json: %v", err)
+	}
+	want := [][]string{{"page-1-region-1.png"}, {"page-2.png"}}
+	for i, p := range got.Pages {
+		if strings.Join(p.Thumbnails, ",") != strings.Join(want[i], ",") {
+			t.Errorf("page %d thumbnails = %v, want %v", p.Number, p.Thumbnails, want[i])
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, "page-1-region-1.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	thumb, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode thumbnail: %v", err)
+	}
+	region := got.Pages[0].Regions[0]
+	if w := thumb.Bounds().Dx(); w != 2*(region.Width+32)+8 {
+		t.Errorf("thumbnail is %d wide, want both padded crops side by side", w)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<img src="page-1-region-1.png"`, "only in A", "2 of 2 pages changed"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("index.html lacks %q", want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package visualdiff compares two renderings of the same document page by
+// page. It scores each page with SSIM (structural similarity), locates the
+// regions that changed and writes a report with thumbnails of them, so a
+// converter upgrade can be judged on what it actually renders.
+package visualdiff
+
+import (
+	"image"
+	"math"
+)
+
+// SSIM constants for 8-bit samples (Wang et al. 2004).
+const (
+	c1 = (0.01 * 255) * (0.01 * 255)
+	c2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// window is the side of the square SSIM is computed over, and stride the
+// step between windows.
+const (
+	window = 8
+	stride = 4
+)
+
+// gray is an image as luma samples.
+type gray struct {
+	w, h int
+	pix  []float64
+}
+
+// toGray converts img to luma, with (0, 0) at its top left corner.
+func toGray(img image.Image) *gray {
+	b := img.Bounds()
+	g := &gray{w: b.Dx(), h: b.Dy(), pix: make([]float64, b.Dx()*b.Dy())}
+	for y := range g.h {
+		for x := range g.w {
+			r, gr, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			// Composite onto white: a transparent PNG page is a white page.
+			white := float64(0xffff - a)
+			luma := 0.299*(float64(r)+white) + 0.587*(float64(gr)+white) + 0.114*(float64(bl)+white)
+			g.pix[y*g.w+x] = luma / 0xffff * 255
+		}
+	}
+	return g
+}
+
+// moments holds integral images of a, b, a², b² and ab, so the statistics
+// of any rectangle take constant time.
+type moments struct {
+	w, h                  int
+	sa, sb, saa, sbb, sab []float64
+}
+
+func newMoments(a, b *gray) *moments {
+	w, h := a.w+1, a.h+1
+	m := &moments{w: w, h: h}
+	for _, s := range []*[]float64{&m.sa, &m.sb, &m.saa, &m.sbb, &m.sab} {
+		*s = make([]float64, w*h)
+	}
+	for y := 1; y < h; y++ {
+		for x := 1; x < w; x++ {
+			va, vb := a.pix[(y-1)*a.w+x-1], b.pix[(y-1)*b.w+x-1]
+			i := y*w + x
+			up, left, diag := i-w, i-1, i-w-1
+			m.sa[i] = va + m.sa[up] + m.sa[left] - m.sa[diag]
+			m.sb[i] = vb + m.sb[up] + m.sb[left] - m.sb[diag]
+			m.saa[i] = va*va + m.saa[up] + m.saa[left] - m.saa[diag]
+			m.sbb[i] = vb*vb + m.sbb[up] + m.sbb[left] - m.sbb[diag]
+			m.sab[i] = va*vb + m.sab[up] + m.sab[left] - m.sab[diag]
+		}
+	}
+	return m
+}
+
+// rect returns the sum of s over the pixels [x0, x1) × [y0, y1).
+func (m *moments) rect(s []float64, x0, y0, x1, y1 int) float64 {
+	return s[y1*m.w+x1] - s[y0*m.w+x1] - s[y1*m.w+x0] + s[y0*m.w+x0]
+}
+
+// ssim returns the SSIM of the rectangle [x0, x1) × [y0, y1).
+func (m *moments) ssim(x0, y0, x1, y1 int) float64 {
+	n := float64((x1 - x0) * (y1 - y0))
+	ma := m.rect(m.sa, x0, y0, x1, y1) / n
+	mb := m.rect(m.sb, x0, y0, x1, y1) / n
+	va := m.rect(m.saa, x0, y0, x1, y1)/n - ma*ma
+	vb := m.rect(m.sbb, x0, y0, x1, y1)/n - mb*mb
+	cov := m.rect(m.sab, x0, y0, x1, y1)/n - ma*mb
+	return ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+}
+
+// meanSSIM averages the SSIM of every window of the region [x0, x1) ×
+// [y0, y1); a region smaller than a window is scored as a whole.
+func (m *moments) meanSSIM(x0, y0, x1, y1 int) float64 {
+	if x1-x0 < window || y1-y0 < window {
+		return m.ssim(x0, y0, x1, y1)
+	}
+	var sum float64
+	var n int
+	for y := y0; y+window <= y1; y += stride {
+		for x := x0; x+window <= x1; x += stride {
+			sum += m.ssim(x, y, x+window, y+window)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// SSIM returns the mean structural similarity of a and b, from 1 for
+// identical images down to 0 (or slightly below) for unrelated ones. Images
+// of different sizes score 0.
+func SSIM(a, b image.Image) float64 {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return 0
+	}
+	ga, gb := toGray(a), toGray(b)
+	if ga.w == 0 || ga.h == 0 {
+		return 1
+	}
+	return clamp(newMoments(ga, gb).meanSSIM(0, 0, ga.w, ga.h))
+}
+
+// clamp rounds away float noise that puts identical images a hair above 1.
+func clamp(s float64) float64 {
+	return math.Min(s, 1)
+}
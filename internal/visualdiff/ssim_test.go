@@ -0,0 +1,37 @@
+package visualdiff_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/BRO3886/go-docpdf/internal/visualdiff"
+)
+
+// page returns a white w×h page with black "text" bars, one per entry of
+// lines giving the bar's y and width.
+func page(w, h int, lines ...[2]int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for _, l := range lines {
+		draw.Draw(img, image.Rect(20, l[0], 20+l[1], l[0]+6), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestSSIM(t *testing.T) {
+	a := page(200, 300, [2]int{20, 150}, [2]int{40, 120}, [2]int{60, 160})
+
+	if s := visualdiff.SSIM(a, page(200, 300, [2]int{20, 150}, [2]int{40, 120}, [2]int{60, 160})); s != 1 {
+		t.Errorf("identical pages scored %v", s)
+	}
+	moved := visualdiff.SSIM(a, page(200, 300, [2]int{22, 150}, [2]int{42, 120}, [2]int{62, 160}))
+	reflowed := visualdiff.SSIM(a, page(200, 300, [2]int{20, 100}, [2]int{120, 170}, [2]int{220, 60}))
+	if !(moved < 1 && reflowed < moved) {
+		t.Errorf("expected 1 > shifted (%v) > reflowed (%v)", moved, reflowed)
+	}
+	if s := visualdiff.SSIM(a, page(200, 301)); s != 0 {
+		t.Errorf("pages of different sizes scored %v", s)
+	}
+}
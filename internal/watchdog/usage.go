@@ -0,0 +1,106 @@
+package watchdog
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errNoSource is returned when no memory accounting source is readable.
+var errNoSource = errors.New("no memory usage source available")
+
+// SystemUsage reports the working set of the enclosing cgroup (v2, then v1)
+// when it has a limit, falling back to host-wide usage from /proc/meminfo.
+func SystemUsage() (used, limit uint64, err error) {
+	if used, limit, ok := cgroupUsage("/sys/fs/cgroup",
+		"memory.current", "memory.max", "inactive_file"); ok {
+		return used, limit, nil
+	}
+	if used, limit, ok := cgroupUsage("/sys/fs/cgroup/memory",
+		"memory.usage_in_bytes", "memory.limit_in_bytes", "total_inactive_file"); ok {
+		return used, limit, nil
+	}
+	return meminfoUsage("/proc/meminfo")
+}
+
+// cgroupUsage reads usage and limit from a cgroup directory. Reclaimable page
+// cache (the inactiveKey entry of memory.stat) is subtracted from usage, as
+// the kernel drops it before invoking the OOM killer. An unlimited cgroup
+// ("max", or the v1 sentinel near MaxInt64) is reported as not ok.
+func cgroupUsage(dir, usageFile, limitFile, inactiveKey string) (used, limit uint64, ok bool) {
+	used, err := readUint(filepath.Join(dir, usageFile))
+	if err != nil {
+		return 0, 0, false
+	}
+	limit, err = readUint(filepath.Join(dir, limitFile))
+	if err != nil || limit == 0 || limit >= 1<<62 {
+		return 0, 0, false
+	}
+	if inactive, ok := statValue(filepath.Join(dir, "memory.stat"), inactiveKey); ok && inactive < used {
+		used -= inactive
+	}
+	return used, limit, true
+}
+
+// statValue returns the value of key in a "key value" per-line file.
+func statValue(path, key string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, found := strings.Cut(sc.Text(), " ")
+		if !found || k != key {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func readUint(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// meminfoUsage derives used memory as MemTotal - MemAvailable.
+func meminfoUsage(path string) (used, limit uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, errNoSource
+	}
+	defer f.Close()
+
+	var total, avail uint64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			avail = kb * 1024
+		}
+	}
+	if total == 0 || avail > total {
+		return 0, 0, errNoSource
+	}
+	return total - avail, total, nil
+}
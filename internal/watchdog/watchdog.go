@@ -0,0 +1,137 @@
+// Package watchdog cancels the longest-running conversion when memory usage
+// crosses a threshold, so one oversized document gets a 503 instead of the
+// kernel OOM-killing the whole server.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrMemoryPressure is the cancellation cause given to a conversion stopped by
+// the watchdog.
+var ErrMemoryPressure = errors.New("cancelled under memory pressure")
+
+// UsageFunc reports current memory usage and the limit it is measured against.
+type UsageFunc func() (used, limit uint64, err error)
+
+// Config configures a Watchdog.
+type Config struct {
+	// Threshold is the fraction of the limit (0–1) at which the watchdog
+	// starts cancelling conversions.
+	Threshold float64
+	// Interval is how often usage is sampled. At most one conversion is
+	// cancelled per interval, giving the kernel time to reclaim its memory.
+	Interval time.Duration
+	// Usage samples memory. Defaults to SystemUsage.
+	Usage UsageFunc
+	// OnKill, if set, is called after each cancellation (e.g. for metrics).
+	OnKill func()
+}
+
+type tracked struct {
+	start  time.Time
+	cancel context.CancelCauseFunc
+}
+
+// Watchdog tracks running conversions and cancels the oldest under pressure.
+type Watchdog struct {
+	cfg Config
+
+	mu      sync.Mutex
+	nextID  uint64
+	running map[uint64]tracked
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New starts a Watchdog. Call Close to stop it.
+func New(cfg Config) *Watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+	if cfg.Usage == nil {
+		cfg.Usage = SystemUsage
+	}
+	w := &Watchdog{
+		cfg:     cfg,
+		running: make(map[uint64]tracked),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Track registers a running conversion. cancel is called with
+// ErrMemoryPressure if the watchdog picks this conversion. The returned func
+// must be called when the conversion finishes.
+func (w *Watchdog) Track(cancel context.CancelCauseFunc) (untrack func()) {
+	w.mu.Lock()
+	id := w.nextID
+	w.nextID++
+	w.running[id] = tracked{start: time.Now(), cancel: cancel}
+	w.mu.Unlock()
+
+	return func() {
+		w.mu.Lock()
+		delete(w.running, id)
+		w.mu.Unlock()
+	}
+}
+
+// Close stops the watchdog.
+func (w *Watchdog) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Watchdog) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check samples usage and cancels the longest-running conversion when over
+// the threshold.
+func (w *Watchdog) check() {
+	used, limit, err := w.cfg.Usage()
+	if err != nil || limit == 0 || float64(used) < w.cfg.Threshold*float64(limit) {
+		return
+	}
+
+	w.mu.Lock()
+	var (
+		victimID uint64
+		victim   tracked
+		found    bool
+	)
+	for id, t := range w.running {
+		if !found || t.start.Before(victim.start) {
+			victimID, victim, found = id, t, true
+		}
+	}
+	if found {
+		delete(w.running, victimID)
+	}
+	w.mu.Unlock()
+
+	if !found {
+		return
+	}
+	victim.cancel(ErrMemoryPressure)
+	if w.cfg.OnKill != nil {
+		w.cfg.OnKill()
+	}
+}
@@ -0,0 +1,117 @@
+package watchdog_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/watchdog"
+)
+
+// pressure returns a UsageFunc reporting 95% usage while on is true and 10%
+// otherwise.
+func pressure(on *atomic.Bool) watchdog.UsageFunc {
+	return func() (uint64, uint64, error) {
+		if on.Load() {
+			return 95, 100, nil
+		}
+		return 10, 100, nil
+	}
+}
+
+func waitDone(t *testing.T, ctx context.Context) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("conversion was not cancelled")
+	}
+}
+
+func TestWatchdog_CancelsOldestFirst(t *testing.T) {
+	var on atomic.Bool
+	var kills atomic.Int32
+	wd := watchdog.New(watchdog.Config{
+		Threshold: 0.9,
+		Interval:  10 * time.Millisecond,
+		Usage:     pressure(&on),
+		OnKill:    func() { kills.Add(1) },
+	})
+	defer wd.Close()
+
+	oldCtx, oldCancel := context.WithCancelCause(context.Background())
+	defer wd.Track(oldCancel)()
+	time.Sleep(time.Millisecond)
+	newCtx, newCancel := context.WithCancelCause(context.Background())
+	defer wd.Track(newCancel)()
+
+	on.Store(true)
+	waitDone(t, oldCtx)
+	if !errors.Is(context.Cause(oldCtx), watchdog.ErrMemoryPressure) {
+		t.Errorf("expected ErrMemoryPressure cause, got %v", context.Cause(oldCtx))
+	}
+
+	// Pressure persists, so the next tick takes the remaining conversion.
+	waitDone(t, newCtx)
+	if kills.Load() != 2 {
+		t.Errorf("expected 2 kills, got %d", kills.Load())
+	}
+}
+
+func TestWatchdog_BelowThresholdLeavesConversions(t *testing.T) {
+	var on atomic.Bool
+	wd := watchdog.New(watchdog.Config{
+		Threshold: 0.9,
+		Interval:  5 * time.Millisecond,
+		Usage:     pressure(&on),
+	})
+	defer wd.Close()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer wd.Track(cancel)()
+
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("conversion cancelled below threshold")
+	}
+}
+
+func TestWatchdog_UntrackedNotCancelled(t *testing.T) {
+	var on atomic.Bool
+	on.Store(true)
+	wd := watchdog.New(watchdog.Config{
+		Threshold: 0.9,
+		Interval:  5 * time.Millisecond,
+		Usage:     pressure(&on),
+	})
+	defer wd.Close()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	wd.Track(cancel)()
+
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("finished conversion was cancelled")
+	}
+}
+
+func TestWatchdog_UsageErrorIgnored(t *testing.T) {
+	wd := watchdog.New(watchdog.Config{
+		Threshold: 0.9,
+		Interval:  5 * time.Millisecond,
+		Usage: func() (uint64, uint64, error) {
+			return 0, 0, errors.New("unavailable")
+		},
+	})
+	defer wd.Close()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer wd.Track(cancel)()
+
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("conversion cancelled without a usage reading")
+	}
+}
@@ -0,0 +1,42 @@
+package webhook_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/webhook"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"event":"job.succeeded"}`)
+	now := time.Unix(1_700_000_000, 0)
+	sig := webhook.Sign(secret, now, body)
+
+	if err := webhook.Verify(secret, sig, body, 5*time.Minute, now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		header string
+		body   []byte
+		now    time.Time
+		want   error
+	}{
+		{"wrong secret", []byte("other"), sig, body, now, webhook.ErrBadSignature},
+		{"tampered body", secret, sig, []byte(`{"event":"job.failed"}`), now, webhook.ErrBadSignature},
+		{"malformed header", secret, "v1=abc", body, now, webhook.ErrBadSignature},
+		{"replayed later", secret, sig, body, now.Add(10 * time.Minute), webhook.ErrStale},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := webhook.Verify(tc.secret, tc.header, tc.body, 5*time.Minute, tc.now)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
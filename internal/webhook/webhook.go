@@ -0,0 +1,390 @@
+// Package webhook delivers signed event notifications to client-supplied
+// callback URLs, retrying failures and keeping a bounded delivery log that
+// can be listed and redelivered from.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/outbox"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+)
+
+// Status is the state of a delivery.
+type Status string
+
+// Delivery states.
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+var (
+	// ErrNotFound is returned for an unknown or evicted delivery ID.
+	ErrNotFound = errors.New("delivery not found")
+	// ErrInProgress is returned when redelivering a delivery that is still
+	// being attempted.
+	ErrInProgress = errors.New("delivery in progress")
+	// ErrInvalidURL is returned by CheckURL for unusable callback URLs.
+	ErrInvalidURL = errors.New("invalid callback url")
+	// ErrNotAcknowledged is returned by Publish when the receiver did not
+	// answer with a 2xx.
+	ErrNotAcknowledged = errors.New("webhook not acknowledged")
+)
+
+// Delivery is one event sent (or being sent) to one callback URL.
+type Delivery struct {
+	ID       string
+	JobID    string
+	URL      string
+	Event    string
+	Status   Status
+	Attempts int
+	// LastStatusCode is the receiver's HTTP status on the latest attempt, or
+	// 0 if no response was received.
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	payload     []byte
+	traceparent string // of the event's trace, sent on with each attempt
+}
+
+// Config configures a Dispatcher.
+type Config struct {
+	// Secret signs every payload (see Sign). Required.
+	Secret []byte
+	// Client sends the requests. Defaults to a client with a 10s timeout.
+	Client *http.Client
+	// MaxAttempts per delivery or redelivery (default 3).
+	MaxAttempts int
+	// Backoff before the second attempt; doubled after each failure
+	// (default 1s).
+	Backoff time.Duration
+	// Retain is the number of deliveries kept for listing and redelivery
+	// (default 1000). The oldest finished deliveries are evicted first.
+	Retain int
+	// AllowedHosts, if non-empty, restricts callback URLs to these hosts.
+	AllowedHosts []string
+	// Tracer, if set, records a client span for each attempt to deliver an
+	// event with a Traceparent, in the event's trace.
+	Tracer *tracing.Tracer
+}
+
+// Dispatcher sends webhooks and records their delivery status.
+type Dispatcher struct {
+	cfg Config
+
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+	order      []string // delivery IDs, oldest first
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a Dispatcher. Call Close to stop pending retries.
+func New(cfg Config) *Dispatcher {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.Retain < 1 {
+		cfg.Retain = 1000
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		cfg:        cfg,
+		deliveries: make(map[string]*Delivery),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// CheckURL reports whether raw is acceptable as a callback URL: absolute
+// http or https, and on the allowlist when one is configured.
+func (d *Dispatcher) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	if len(d.cfg.AllowedHosts) > 0 && !slices.Contains(d.cfg.AllowedHosts, strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("%w: host not allowed", ErrInvalidURL)
+	}
+	return nil
+}
+
+// Publish implements outbox.Publisher: it makes one synchronous attempt to
+// deliver e, recording it under the event ID so the delivery ID stays the same
+// across the outbox's retries. The outbox owns retrying; call MarkFailed when
+// it gives up.
+func (d *Dispatcher) Publish(ctx context.Context, e outbox.Event) error {
+	d.mu.Lock()
+	if _, ok := d.deliveries[e.ID]; !ok {
+		d.deliveries[e.ID] = &Delivery{
+			ID:          e.ID,
+			JobID:       e.Key,
+			URL:         e.Target,
+			Event:       e.Kind,
+			Status:      StatusPending,
+			CreatedAt:   e.CreatedAt,
+			UpdatedAt:   time.Now().UTC(),
+			payload:     e.Payload,
+			traceparent: e.Traceparent,
+		}
+		d.order = append(d.order, e.ID)
+		d.evictLocked()
+	}
+	d.mu.Unlock()
+
+	if !d.attempt(ctx, e.ID) {
+		return ErrNotAcknowledged
+	}
+	return nil
+}
+
+// MarkFailed records that delivery id will not be attempted again.
+func (d *Dispatcher) MarkFailed(id string) {
+	d.update(id, func(dl *Delivery) { dl.Status = StatusFailed })
+}
+
+// Send records a new delivery of payload to callbackURL and attempts it in
+// the background.
+func (d *Dispatcher) Send(jobID, callbackURL, event string, payload []byte) Delivery {
+	now := time.Now().UTC()
+	dl := &Delivery{
+		ID:        newID(),
+		JobID:     jobID,
+		URL:       callbackURL,
+		Event:     event,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		payload:   payload,
+	}
+
+	d.mu.Lock()
+	d.deliveries[dl.ID] = dl
+	d.order = append(d.order, dl.ID)
+	d.evictLocked()
+	snapshot := *dl
+	d.mu.Unlock()
+
+	d.start(dl.ID)
+	return snapshot
+}
+
+// Redeliver attempts a finished delivery again with the same delivery ID and
+// payload, freshly signed.
+func (d *Dispatcher) Redeliver(id string) (Delivery, error) {
+	d.mu.Lock()
+	dl, ok := d.deliveries[id]
+	if !ok {
+		d.mu.Unlock()
+		return Delivery{}, ErrNotFound
+	}
+	if dl.Status == StatusPending {
+		d.mu.Unlock()
+		return Delivery{}, ErrInProgress
+	}
+	dl.Status = StatusPending
+	dl.UpdatedAt = time.Now().UTC()
+	snapshot := *dl
+	d.mu.Unlock()
+
+	d.start(id)
+	return snapshot, nil
+}
+
+// Get returns the delivery with the given ID.
+func (d *Dispatcher) Get(id string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dl, ok := d.deliveries[id]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	return *dl, nil
+}
+
+// List returns retained deliveries, newest first. A non-empty jobID limits
+// the result to that job's deliveries.
+func (d *Dispatcher) List(jobID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []Delivery
+	for i := len(d.order) - 1; i >= 0; i-- {
+		dl := d.deliveries[d.order[i]]
+		if jobID == "" || dl.JobID == jobID {
+			out = append(out, *dl)
+		}
+	}
+	return out
+}
+
+// Close abandons pending retries and waits for in-flight attempts to return.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) start(id string) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(id)
+	}()
+}
+
+// deliver makes up to MaxAttempts attempts, backing off between failures.
+func (d *Dispatcher) deliver(id string) {
+	backoff := d.cfg.Backoff
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		if d.attempt(d.ctx, id) {
+			return
+		}
+		if attempt < d.cfg.MaxAttempts && !d.sleep(backoff) {
+			break
+		}
+		backoff *= 2
+	}
+	d.update(id, func(dl *Delivery) { dl.Status = StatusFailed })
+}
+
+// sleep waits for dur, returning false if the Dispatcher is closed first.
+func (d *Dispatcher) sleep(dur time.Duration) bool {
+	t := time.NewTimer(dur)
+	defer t.Stop()
+	select {
+	case <-d.ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// attempt sends one request and records its outcome. It reports whether the
+// receiver acknowledged the delivery with a 2xx.
+func (d *Dispatcher) attempt(ctx context.Context, id string) bool {
+	dl, err := d.Get(id)
+	if err != nil {
+		return true // evicted; nothing left to record
+	}
+
+	ctx, span := d.startSpan(ctx, dl)
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.payload))
+	if err != nil {
+		d.update(id, func(dl *Delivery) { dl.Attempts++; dl.LastError = "invalid request" })
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, dl.ID)
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, time.Now(), dl.payload))
+	// The receiver continues the trace under the attempt's span, or under
+	// the event's own when it is not recorded here.
+	if tp := tracing.Traceparent(ctx); tp != "" {
+		req.Header.Set(tracing.TraceparentHeader, tp)
+	} else if dl.traceparent != "" {
+		req.Header.Set(tracing.TraceparentHeader, dl.traceparent)
+	}
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		span.SetError(err)
+		d.update(id, func(dl *Delivery) {
+			dl.Attempts++
+			dl.LastStatusCode = 0
+			dl.LastError = "request failed"
+		})
+		return false
+	}
+	resp.Body.Close()
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	span.SetAttributes(tracing.Int64("http.response.status_code", int64(resp.StatusCode)))
+	if !ok {
+		span.SetError(ErrNotAcknowledged)
+	}
+	d.update(id, func(dl *Delivery) {
+		dl.Attempts++
+		dl.LastStatusCode = resp.StatusCode
+		dl.LastError = ""
+		if ok {
+			dl.Status = StatusDelivered
+		} else {
+			dl.LastError = "non-2xx response"
+		}
+	})
+	return ok
+}
+
+// startSpan starts the client span of an attempt to deliver dl, in the trace
+// of its event. Without a Tracer or a traceparent it returns ctx and a nil
+// span.
+func (d *Dispatcher) startSpan(ctx context.Context, dl Delivery) (context.Context, *tracing.Span) {
+	parent, ok := tracing.ParseTraceparent(dl.traceparent)
+	if d.cfg.Tracer == nil || !ok {
+		return ctx, nil
+	}
+	attrs := []tracing.Attribute{
+		tracing.String("http.request.method", http.MethodPost),
+		tracing.String("docpdf.delivery_id", dl.ID),
+		tracing.String("docpdf.event", dl.Event),
+	}
+	// The host only: a callback URL may carry a token in its path or query.
+	if u, err := url.Parse(dl.URL); err == nil {
+		attrs = append(attrs, tracing.String("server.address", u.Hostname()))
+	}
+	return d.cfg.Tracer.Start(ctx, "webhook.deliver", tracing.KindClient, parent, attrs...)
+}
+
+func (d *Dispatcher) update(id string, fn func(*Delivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dl, ok := d.deliveries[id]; ok {
+		fn(dl)
+		dl.UpdatedAt = time.Now().UTC()
+	}
+}
+
+// evictLocked drops the oldest finished deliveries beyond the retention
+// limit. Pending deliveries are never evicted.
+func (d *Dispatcher) evictLocked() {
+	for i := 0; len(d.order) > d.cfg.Retain && i < len(d.order); {
+		id := d.order[i]
+		if d.deliveries[id].Status == StatusPending {
+			i++
+			continue
+		}
+		delete(d.deliveries, id)
+		d.order = slices.Delete(d.order, i, i+1)
+	}
+}
+
+// newID returns a random 128-bit hex delivery ID.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
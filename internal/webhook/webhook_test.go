@@ -0,0 +1,279 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/internal/outbox"
+	"github.com/BRO3886/go-docpdf/internal/tracing"
+	"github.com/BRO3886/go-docpdf/internal/webhook"
+)
+
+var secret = []byte("test-secret")
+
+// waitStatus polls until the delivery reaches want.
+func waitStatus(t *testing.T, d *webhook.Dispatcher, id string, want webhook.Status) webhook.Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		dl, err := d.Get(id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if dl.Status == want {
+			return dl
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("delivery did not reach %s", want)
+	return webhook.Delivery{}
+}
+
+func TestSend_SignedDelivery(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Clone(), body}
+	}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{Secret: secret})
+	defer d.Close()
+	dl := d.Send("job1", srv.URL, "job.succeeded", []byte(`{"ok":true}`))
+
+	rcv := <-got
+	if rcv.header.Get(webhook.DeliveryHeader) != dl.ID {
+		t.Errorf("expected delivery ID %q, got %q", dl.ID, rcv.header.Get(webhook.DeliveryHeader))
+	}
+	if rcv.header.Get(webhook.EventHeader) != "job.succeeded" {
+		t.Errorf("unexpected event header %q", rcv.header.Get(webhook.EventHeader))
+	}
+	sig := rcv.header.Get(webhook.SignatureHeader)
+	if err := webhook.Verify(secret, sig, rcv.body, time.Minute, time.Now()); err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+
+	final := waitStatus(t, d, dl.ID, webhook.StatusDelivered)
+	if final.Attempts != 1 || final.LastStatusCode != http.StatusOK {
+		t.Errorf("unexpected delivery record: %+v", final)
+	}
+}
+
+func TestSend_RetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{Secret: secret, Backoff: time.Millisecond})
+	defer d.Close()
+	dl := d.Send("job1", srv.URL, "job.failed", []byte(`{}`))
+
+	final := waitStatus(t, d, dl.ID, webhook.StatusDelivered)
+	if final.Attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", final.Attempts)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	var up atomic.Bool
+	var lastID atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastID.Store(r.Header.Get(webhook.DeliveryHeader))
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{Secret: secret, MaxAttempts: 2, Backoff: time.Millisecond})
+	defer d.Close()
+	dl := d.Send("job1", srv.URL, "job.succeeded", []byte(`{}`))
+
+	failed := waitStatus(t, d, dl.ID, webhook.StatusFailed)
+	if failed.LastStatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected last status 503, got %d", failed.LastStatusCode)
+	}
+
+	up.Store(true)
+	if _, err := d.Redeliver(dl.ID); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	final := waitStatus(t, d, dl.ID, webhook.StatusDelivered)
+	if final.Attempts != 3 {
+		t.Errorf("expected attempts to accumulate to 3, got %d", final.Attempts)
+	}
+	if lastID.Load() != dl.ID {
+		t.Error("redelivery must reuse the delivery ID")
+	}
+
+	if _, err := d.Redeliver("missing"); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRedeliver_InProgress(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	d := webhook.New(webhook.Config{Secret: secret})
+	defer d.Close()
+	dl := d.Send("job1", srv.URL, "job.succeeded", []byte(`{}`))
+
+	if _, err := d.Redeliver(dl.ID); !errors.Is(err, webhook.ErrInProgress) {
+		t.Errorf("expected ErrInProgress, got %v", err)
+	}
+}
+
+func TestList_NewestFirstAndFiltered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{Secret: secret, Retain: 2})
+	defer d.Close()
+	first := d.Send("a", srv.URL, "job.succeeded", []byte(`{}`))
+	waitStatus(t, d, first.ID, webhook.StatusDelivered)
+	second := d.Send("b", srv.URL, "job.succeeded", []byte(`{}`))
+	third := d.Send("b", srv.URL, "job.failed", []byte(`{}`))
+
+	all := d.List("")
+	if len(all) != 2 || all[0].ID != third.ID || all[1].ID != second.ID {
+		t.Fatalf("expected the two newest deliveries, newest first; got %+v", all)
+	}
+	if _, err := d.Get(first.ID); !errors.Is(err, webhook.ErrNotFound) {
+		t.Error("expected the oldest finished delivery to be evicted")
+	}
+	if got := d.List("a"); len(got) != 0 {
+		t.Errorf("expected no deliveries for job a, got %d", len(got))
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	d := webhook.New(webhook.Config{Secret: secret, AllowedHosts: []string{"hooks.example.com"}})
+	defer d.Close()
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/docpdf", true},
+		{"http://HOOKS.example.com:8443/x", true},
+		{"https://evil.example.com/", false},
+		{"ftp://hooks.example.com/", false},
+		{"/relative", false},
+		{"https://", false},
+	}
+	for _, tc := range tests {
+		err := d.CheckURL(tc.url)
+		if (err == nil) != tc.ok {
+			t.Errorf("CheckURL(%q) = %v, want ok=%v", tc.url, err, tc.ok)
+		}
+	}
+}
+
+func TestPublish_SingleAttemptUnderEventID(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	var gotID atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID.Store(r.Header.Get(webhook.DeliveryHeader))
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	d := webhook.New(webhook.Config{Secret: secret})
+	defer d.Close()
+	e := outbox.Event{ID: "evt-1", Kind: "job.succeeded", Key: "job1", Target: srv.URL, Payload: []byte(`{}`)}
+
+	if err := d.Publish(context.Background(), e); !errors.Is(err, webhook.ErrNotAcknowledged) {
+		t.Fatalf("expected ErrNotAcknowledged, got %v", err)
+	}
+	dl, err := d.Get("evt-1")
+	if err != nil || dl.Status != webhook.StatusPending || dl.Attempts != 1 {
+		t.Fatalf("expected a pending delivery after one attempt, got %+v (%v)", dl, err)
+	}
+
+	status.Store(http.StatusOK)
+	if err := d.Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if gotID.Load() != "evt-1" {
+		t.Errorf("expected delivery ID evt-1, got %v", gotID.Load())
+	}
+	if dl, _ := d.Get("evt-1"); dl.Status != webhook.StatusDelivered || dl.Attempts != 2 {
+		t.Errorf("expected delivered after 2 attempts, got %+v", dl)
+	}
+
+	d.MarkFailed("evt-1")
+	if dl, _ := d.Get("evt-1"); dl.Status != webhook.StatusFailed {
+		t.Errorf("expected failed after MarkFailed, got %s", dl.Status)
+	}
+}
+
+// spanRecorder is a tracing.Exporter that keeps what it is given.
+type spanRecorder struct{ spans []tracing.SpanData }
+
+func (r *spanRecorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestPublish_ContinuesTrace(t *testing.T) {
+	var got atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Header.Get(tracing.TraceparentHeader))
+	}))
+	defer srv.Close()
+	parent := tracing.SpanContext{TraceID: tracing.TraceID{1}, SpanID: tracing.SpanID{2}, Sampled: true}
+	e := outbox.Event{ID: "evt-1", Kind: "job.succeeded", Key: "job1", Target: srv.URL, Payload: []byte(`{}`), Traceparent: parent.Traceparent()}
+
+	t.Run("untraced", func(t *testing.T) {
+		d := webhook.New(webhook.Config{Secret: secret})
+		defer d.Close()
+		if err := d.Publish(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+		if got.Load() != parent.Traceparent() {
+			t.Errorf("expected the event's traceparent, got %v", got.Load())
+		}
+	})
+
+	t.Run("traced", func(t *testing.T) {
+		rec := &spanRecorder{}
+		tr := tracing.New(tracing.Config{Exporter: rec, FlushInterval: time.Hour})
+		d := webhook.New(webhook.Config{Secret: secret, Tracer: tr})
+		defer d.Close()
+		if err := d.Publish(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+		_ = tr.Close(context.Background())
+
+		if len(rec.spans) != 1 {
+			t.Fatalf("expected one span, got %+v", rec.spans)
+		}
+		span := rec.spans[0]
+		if span.Name != "webhook.deliver" || span.Kind != tracing.KindClient || span.Parent != parent.SpanID || span.Context.TraceID != parent.TraceID {
+			t.Errorf("unexpected span %+v", span)
+		}
+		if got.Load() != span.Context.Traceparent() {
+			t.Errorf("receiver should continue under the attempt's span, got %v", got.Load())
+		}
+	})
+}
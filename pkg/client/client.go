@@ -0,0 +1,443 @@
+// Package client is a Go client for the docpdf conversion service.
+//
+//	c := client.New("https://docpdf.example.com", client.WithAPIKey(key))
+//	pdf, err := c.Convert(ctx, f, client.ConvertOptions{Filename: "report.docx"})
+//	if err != nil {
+//		return err
+//	}
+//	defer pdf.Close()
+//
+// Requests that fail with a 5xx status or time out are retried with
+// exponential backoff, honouring Retry-After. Every attempt of a call carries
+// the same X-Request-ID, taken from the context (see WithRequestID) or
+// generated, so it can be traced in the server logs. Conversions also carry
+// the document's X-Affinity-Key, for load balancers that route each document
+// to the replica caching its results. Errors reported by the service are
+// returned as *Error, which matches ErrTooLarge, ErrUnsupportedType,
+// ErrTimeout or ErrQuotaExceeded with errors.Is:
+//
+//	if errors.Is(err, client.ErrUnsupportedType) {
+//		// tell the user to upload a different file
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the API version the client speaks; its error bodies always
+// carry a code and the request ID.
+const apiVersion = "/v2"
+
+// Client talks to one docpdf server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	hc         *http.Client
+	maxRetries int
+	backoff    time.Duration
+	poll       time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIKey authenticates every request with key.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithHTTPClient sends requests through hc instead of http.DefaultClient. Its
+// Timeout, if set, bounds each attempt rather than the whole call.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.hc = hc }
+}
+
+// WithRetries sets how many times a failed request is retried (default 3)
+// and the wait before the first retry (default 500ms), which doubles on each
+// further attempt. A Retry-After from the server takes precedence.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+		c.backoff = backoff
+	}
+}
+
+// WithPollInterval sets how often Wait checks on a job (default 1s).
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) { c.poll = d }
+}
+
+// New returns a Client for the server at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		hc:         http.DefaultClient,
+		maxRetries: 3,
+		backoff:    500 * time.Millisecond,
+		poll:       time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ConvertOptions are the parameters of a conversion. The zero value converts
+// to PDF.
+type ConvertOptions struct {
+	// Filename names the upload; the server derives the result's download
+	// name from it. It defaults to "document".
+	Filename string
+	// Output is the result format: "pdf" (default), "png", "html", "txt" or
+	// "docx".
+	Output string
+	// PDFVersion is the version of a PDF result: "1.5", "1.6", "1.7",
+	// "pdfa-1b", "pdfa-2b" or "pdfa-3b". Empty leaves it to the server.
+	PDFVersion string
+	// ImageDPI caps the resolution of images in a PDF result, e.g. "300",
+	// or is "original" to keep them as they are.
+	ImageDPI string
+	// Pages selects the pages of a PDF result, e.g. "1-3,7".
+	Pages string
+	// Orientation is "portrait" or "landscape" to turn every page.
+	Orientation string
+	// NamedDestinations exports bookmarks as PDF named destinations, so
+	// links can point into a PDF result (manual.pdf#chapter-2).
+	NamedDestinations bool
+	// ConvertLinks points links to other documents at their PDF and keeps
+	// relative links relative.
+	ConvertLinks bool
+	// DocumentPassword opens a password-protected DOCX, XLSX or PPTX upload.
+	DocumentPassword string
+	// UserPassword encrypts a PDF result so it opens only with it.
+	UserPassword string
+	// OwnerPassword restricts printing, changing and copying a PDF result
+	// until it is given.
+	OwnerPassword string
+	// Watermark is text stamped on every page of a PDF result. It may use
+	// the placeholders {client}, {tenant}, {date} and {time}.
+	Watermark string
+	// WatermarkImage is a PNG or JPEG stamped on every page of a PDF
+	// result.
+	WatermarkImage []byte
+	// WatermarkPosition is "diagonal" (default), "center", "top" or
+	// "bottom".
+	WatermarkPosition string
+	// WatermarkOpacity is from 0 to 1, e.g. "0.3".
+	WatermarkOpacity string
+	// Title, Author, Subject and Keywords are written into a PDF result's
+	// document information and XMP metadata.
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	// CustomMetadata adds fields of its own to a PDF result's document
+	// information, e.g. {"Department": "Legal"}.
+	CustomMetadata map[string]string
+	// StripMetadata removes the metadata the source document and the
+	// converter put in a PDF result.
+	StripMetadata bool
+	// Disposition is "inline" or "attachment" to have the server send a
+	// Content-Disposition header.
+	Disposition string
+	// ContentType overrides the result's Content-Type.
+	ContentType string
+	// CallbackURL, for Submit only, is notified when the job finishes.
+	CallbackURL string
+}
+
+// Kinds of error response, matched by *Error with errors.Is.
+var (
+	// ErrTooLarge is a document, batch or form too large for the service
+	// (413).
+	ErrTooLarge = errors.New("docpdf: too large")
+	// ErrUnsupportedType is a document of a type the service cannot
+	// convert, or that is not allowed for the tenant (415).
+	ErrUnsupportedType = errors.New("docpdf: unsupported document type")
+	// ErrTimeout is a conversion or request that timed out on the service
+	// (504), or an upload the service gave up waiting for (408).
+	ErrTimeout = errors.New("docpdf: timed out")
+	// ErrQuotaExceeded is a request refused by the client's rate limit
+	// (429); Error.RetryAfter says when to try again.
+	ErrQuotaExceeded = errors.New("docpdf: quota exceeded")
+)
+
+// Error is an error response from the service.
+type Error struct {
+	StatusCode int
+	// Code is the machine-readable error code, e.g. "type_not_allowed".
+	Code string
+	// Message is the human-readable error.
+	Message string
+	// RequestID identifies the request in the server logs.
+	RequestID string
+	// RetryAfter is the wait the service asked for in Retry-After, if any.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("docpdf: %d %s", e.StatusCode, e.Message)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.RequestID != "" {
+		msg += " [request " + e.RequestID + "]"
+	}
+	return msg
+}
+
+// Is reports whether e is of the kind target names: ErrTooLarge,
+// ErrUnsupportedType, ErrTimeout or ErrQuotaExceeded.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrTooLarge:
+		return e.StatusCode == http.StatusRequestEntityTooLarge
+	case ErrUnsupportedType:
+		return e.StatusCode == http.StatusUnsupportedMediaType
+	case ErrTimeout:
+		return e.StatusCode == http.StatusGatewayTimeout || e.StatusCode == http.StatusRequestTimeout
+	case ErrQuotaExceeded:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Temporary reports whether retrying the request later may succeed.
+func (e *Error) Temporary() bool {
+	return e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose requests carry id as X-Request-ID,
+// e.g. to propagate the ID of the request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+type affinityKey struct{}
+
+// Convert uploads the document read from r and returns the converted result.
+// The caller must close it. r is read to the end before the first attempt, so
+// it can be sent again on retries.
+func (c *Client) Convert(ctx context.Context, r io.Reader, opts ConvertOptions) (io.ReadCloser, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("docpdf: reading document: %w", err)
+	}
+	ctx = context.WithValue(ctx, affinityKey{}, affinity(data))
+	resp, err := c.do(ctx, http.MethodPost, "/convert", uploadBody(data, opts))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// affinity is the affinity key of a document, as the server computes it: the
+// first 16 bytes of its SHA-256, in hex.
+func affinity(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// formatBool is the form value of a flag: "true", or empty to leave it out.
+func formatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
+
+// formatMetadata encodes custom metadata fields as the server expects them,
+// a JSON object, or returns "" if there are none.
+func formatMetadata(fields map[string]string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
+
+// body builds a fresh request body and its Content-Type for each attempt.
+type body func() (io.Reader, string)
+
+// uploadBody is the multipart form for a conversion of data.
+func uploadBody(data []byte, opts ConvertOptions) body {
+	return func() (io.Reader, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, f := range [][2]string{
+			{"output", opts.Output},
+			{"target_pdf_version", opts.PDFVersion},
+			{"image_dpi", opts.ImageDPI},
+			{"pages", opts.Pages},
+			{"orientation", opts.Orientation},
+			{"named_destinations", formatBool(opts.NamedDestinations)},
+			{"convert_links", formatBool(opts.ConvertLinks)},
+			{"document_password", opts.DocumentPassword},
+			{"user_password", opts.UserPassword},
+			{"owner_password", opts.OwnerPassword},
+			{"watermark", opts.Watermark},
+			{"watermark_position", opts.WatermarkPosition},
+			{"watermark_opacity", opts.WatermarkOpacity},
+			{"title", opts.Title},
+			{"author", opts.Author},
+			{"subject", opts.Subject},
+			{"keywords", opts.Keywords},
+			{"custom_metadata", formatMetadata(opts.CustomMetadata)},
+			{"strip_metadata", formatBool(opts.StripMetadata)},
+			{"disposition", opts.Disposition},
+			{"content_type", opts.ContentType},
+			{"callback_url", opts.CallbackURL},
+		} {
+			if f[1] != "" {
+				_ = mw.WriteField(f[0], f[1])
+			}
+		}
+		if opts.WatermarkImage != nil {
+			part, _ := mw.CreateFormFile("watermark_image", "watermark")
+			_, _ = part.Write(opts.WatermarkImage)
+		}
+		name := opts.Filename
+		if name == "" {
+			name = "document"
+		}
+		part, _ := mw.CreateFormFile("file", name)
+		_, _ = part.Write(data)
+		_ = mw.Close()
+		return &buf, mw.FormDataContentType()
+	}
+}
+
+// do sends a request to path, retrying failures, and returns the successful
+// response. Any other response is returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, b body) (*http.Response, error) {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	if id == "" {
+		id = newRequestID()
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, id, b)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		wait := c.backoff << attempt
+		if err == nil {
+			if d, ok := retryAfter(resp); ok {
+				wait = d
+			}
+			err = readError(resp, id)
+		}
+		if attempt >= c.maxRetries || !retryable(ctx, err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send makes one attempt.
+func (c *Client) send(ctx context.Context, method, path, id string, b body) (*http.Response, error) {
+	var (
+		rd          io.Reader
+		contentType string
+	)
+	if b != nil {
+		rd, contentType = b()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiVersion+path, rd)
+	if err != nil {
+		return nil, fmt.Errorf("docpdf: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Request-ID", id)
+	if key, _ := ctx.Value(affinityKey{}).(string); key != "" {
+		req.Header.Set("X-Affinity-Key", key)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docpdf: %w", err)
+	}
+	return resp, nil
+}
+
+// retryable reports whether err is worth another attempt: a 5xx response, or
+// a timeout that is not the caller's own context expiring.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// readError consumes an error response.
+func readError(resp *http.Response, id string) *Error {
+	defer resp.Body.Close()
+	var body struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(raw, &body) != nil || body.Error == "" {
+		body.Error = strings.ToLower(http.StatusText(resp.StatusCode))
+	}
+	e := &Error{StatusCode: resp.StatusCode, Code: body.Code, Message: body.Error, RequestID: body.RequestID}
+	e.RetryAfter, _ = retryAfter(resp)
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if e.RequestID == "" {
+		e.RequestID = id
+	}
+	return e
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// jobPath is the path of job id, or of one of its sub-resources.
+func jobPath(id string, sub ...string) string {
+	return "/jobs/" + strings.Join(append([]string{url.PathEscape(id)}, sub...), "/")
+}
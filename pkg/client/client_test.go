@@ -0,0 +1,243 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/pkg/client"
+)
+
+// newClient returns a client for h that retries without waiting.
+func newClient(t *testing.T, h http.HandlerFunc, opts ...client.Option) *client.Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return client.New(srv.URL+"/", append([]client.Option{client.WithRetries(3, time.Millisecond)}, opts...)...)
+}
+
+func TestConvert(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/convert" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("X-Request-ID"); got != "req-1" {
+			t.Errorf("X-Request-ID = %q", got)
+		}
+		// The first 16 bytes of sha256("doc").
+		if got := r.Header.Get("X-Affinity-Key"); got != "139d544b821b13ebea14f1b0fe185772" {
+			t.Errorf("X-Affinity-Key = %q", got)
+		}
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("file: %v", err)
+		}
+		data, _ := io.ReadAll(f)
+		if string(data) != "doc" || fh.Filename != "report.docx" || r.FormValue("output") != "png" {
+			t.Errorf("upload %q named %q, output %q", data, fh.Filename, r.FormValue("output"))
+		}
+		if r.FormValue("disposition") != "" || r.FormValue("named_destinations") != "" {
+			t.Error("unset option sent")
+		}
+		if r.FormValue("convert_links") != "true" {
+			t.Errorf("convert_links = %q", r.FormValue("convert_links"))
+		}
+		_, _ = w.Write([]byte("PNG"))
+	}, client.WithAPIKey("secret"))
+
+	ctx := client.WithRequestID(context.Background(), "req-1")
+	rc, err := c.Convert(ctx, strings.NewReader("doc"), client.ConvertOptions{Filename: "report.docx", Output: "png", ConvertLinks: true})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); string(got) != "PNG" {
+		t.Errorf("result %q", got)
+	}
+}
+
+func TestConvert_Watermark(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("watermark") != "DRAFT {date}" || r.FormValue("watermark_position") != "top" {
+			t.Errorf("watermark %q at %q", r.FormValue("watermark"), r.FormValue("watermark_position"))
+		}
+		f, _, err := r.FormFile("watermark_image")
+		if err != nil {
+			t.Errorf("no watermark_image: %v", err)
+		} else if data, _ := io.ReadAll(f); string(data) != "PNG" {
+			t.Errorf("watermark_image %q", data)
+		}
+		_, _ = w.Write([]byte("%PDF"))
+	})
+
+	rc, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{
+		Watermark:         "DRAFT {date}",
+		WatermarkImage:    []byte("PNG"),
+		WatermarkPosition: "top",
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	rc.Close()
+}
+
+func TestConvert_Metadata(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		for k, want := range map[string]string{
+			"title":           "Report",
+			"custom_metadata": `{"Department":"Legal"}`,
+			"strip_metadata":  "true",
+			"author":          "",
+		} {
+			if got := r.FormValue(k); got != want {
+				t.Errorf("%s = %q, want %q", k, got, want)
+			}
+		}
+		_, _ = w.Write([]byte("%PDF"))
+	})
+
+	rc, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{
+		Title:          "Report",
+		CustomMetadata: map[string]string{"Department": "Legal"},
+		StripMetadata:  true,
+	})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	rc.Close()
+}
+
+func TestConvert_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	ids := make(chan string, 3)
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ids <- r.Header.Get("X-Request-ID")
+		if f, _, err := r.FormFile("file"); err != nil {
+			t.Errorf("attempt without the upload: %v", err)
+		} else if data, _ := io.ReadAll(f); string(data) != "doc" {
+			t.Errorf("attempt sent %q", data)
+		}
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":"server busy"}`, http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("%PDF"))
+	})
+
+	rc, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	rc.Close()
+	if calls.Load() != 3 {
+		t.Errorf("%d attempts, want 3", calls.Load())
+	}
+	first := <-ids
+	if first == "" || <-ids != first || <-ids != first {
+		t.Error("attempts did not share one generated request ID")
+	}
+}
+
+func TestConvert_RetriesTimeouts(t *testing.T) {
+	var calls atomic.Int32
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("%PDF"))
+	}, client.WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+
+	rc, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	rc.Close()
+	if calls.Load() != 2 {
+		t.Errorf("%d attempts, want 2", calls.Load())
+	}
+}
+
+func TestConvert_ClientErrorNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		_, _ = w.Write([]byte(`{"error":"document type not allowed","code":"type_not_allowed","request_id":"req-9"}`))
+	})
+
+	_, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error %v is not *client.Error", err)
+	}
+	if apiErr.StatusCode != 415 || apiErr.Code != "type_not_allowed" || apiErr.RequestID != "req-9" || apiErr.Temporary() {
+		t.Errorf("error = %+v", apiErr)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d attempts, want 1", calls.Load())
+	}
+}
+
+func TestConvert_TypedErrors(t *testing.T) {
+	kinds := []error{client.ErrTooLarge, client.ErrUnsupportedType, client.ErrTimeout, client.ErrQuotaExceeded}
+	for _, tc := range []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusRequestEntityTooLarge, `{"error":"file too large","code":"request_entity_too_large","request_id":"req-1"}`, client.ErrTooLarge},
+		{http.StatusUnsupportedMediaType, `{"error":"documents with macros are not allowed","code":"macros_not_allowed","request_id":"req-1"}`, client.ErrUnsupportedType},
+		{http.StatusGatewayTimeout, `{"error":"conversion timed out","code":"gateway_timeout","request_id":"req-1"}`, client.ErrTimeout},
+		{http.StatusRequestTimeout, `{"error":"upload timed out","code":"request_timeout","request_id":"req-1"}`, client.ErrTimeout},
+		{http.StatusTooManyRequests, `{"error":"rate limit exceeded"}`, client.ErrQuotaExceeded},
+		{http.StatusUnprocessableEntity, `{"error":"conversion exceeded a resource limit","code":"resource_limit","request_id":"req-1"}`, nil},
+	} {
+		c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "7")
+			w.Header().Set("X-Request-ID", "req-1")
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}, client.WithRetries(0, 0))
+		_, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{})
+		for _, kind := range kinds {
+			if got := errors.Is(err, kind); got != (kind == tc.want) {
+				t.Errorf("%d: errors.Is(err, %v) = %v", tc.status, kind, got)
+			}
+		}
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.RequestID != "req-1" || !strings.Contains(err.Error(), "req-1") {
+			t.Errorf("%d: request ID missing from %v", tc.status, err)
+		}
+		if tc.status == http.StatusTooManyRequests && apiErr.RetryAfter != 7*time.Second {
+			t.Errorf("retry after %v", apiErr.RetryAfter)
+		}
+	}
+}
+
+func TestConvert_GivesUp(t *testing.T) {
+	var calls atomic.Int32
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, err := c.Convert(context.Background(), strings.NewReader("doc"), client.ConvertOptions{})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.RequestID == "" {
+		t.Fatalf("error = %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("%d attempts, want 4", calls.Load())
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Job states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ErrJobFailed is returned by Wait for a job that finished unsuccessfully.
+var ErrJobFailed = errors.New("docpdf: job failed")
+
+// Job is an asynchronous conversion.
+type Job struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Error says why a failed job failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Submit uploads the document read from r for asynchronous conversion and
+// returns the queued job. Use Wait and Result to collect it.
+func (c *Client) Submit(ctx context.Context, r io.Reader, opts ConvertOptions) (*Job, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("docpdf: reading document: %w", err)
+	}
+	return c.job(ctx, http.MethodPost, "/convert/async", uploadBody(data, opts))
+}
+
+// Job returns the current state of job id.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	return c.job(ctx, http.MethodGet, jobPath(id), nil)
+}
+
+// Wait polls job id until it finishes. A failed job is returned along with an
+// error wrapping ErrJobFailed.
+func (c *Client) Wait(ctx context.Context, id string) (*Job, error) {
+	tick := time.NewTicker(c.poll)
+	defer tick.Stop()
+	for {
+		j, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch j.Status {
+		case StatusSucceeded:
+			return j, nil
+		case StatusFailed:
+			return j, fmt.Errorf("%w: %s", ErrJobFailed, j.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// Result returns the converted document of a succeeded job. The caller must
+// close it.
+func (c *Client) Result(ctx context.Context, id string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, jobPath(id, "result"), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// job makes a request answered with a job.
+func (c *Client) job(ctx context.Context, method, path string, b body) (*Job, error) {
+	resp, err := c.do(ctx, method, path, b)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var j Job
+	if err := json.NewDecoder(resp.Body).Decode(&j); err != nil {
+		return nil, fmt.Errorf("docpdf: decoding job: %w", err)
+	}
+	return &j, nil
+}
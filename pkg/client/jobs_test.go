@@ -0,0 +1,73 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BRO3886/go-docpdf/pkg/client"
+)
+
+func TestJobs(t *testing.T) {
+	var polls atomic.Int32
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v2/convert/async":
+			if r.FormValue("callback_url") != "https://hooks.example.com" {
+				t.Errorf("callback_url = %q", r.FormValue("callback_url"))
+			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"id":"j1","status":"queued"}`)
+		case "GET /v2/jobs/j1":
+			status := "running"
+			if polls.Add(1) == 3 {
+				status = "succeeded"
+			}
+			fmt.Fprintf(w, `{"id":"j1","status":%q}`, status)
+		case "GET /v2/jobs/j1/result":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF")
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}, client.WithPollInterval(time.Millisecond))
+
+	ctx := context.Background()
+	j, err := c.Submit(ctx, strings.NewReader("doc"), client.ConvertOptions{CallbackURL: "https://hooks.example.com"})
+	if err != nil || j.ID != "j1" || j.Status != client.StatusQueued || j.Done() {
+		t.Fatalf("submit: %+v, %v", j, err)
+	}
+	if j, err = c.Wait(ctx, j.ID); err != nil || j.Status != client.StatusSucceeded {
+		t.Fatalf("wait: %+v, %v", j, err)
+	}
+	rc, err := c.Result(ctx, j.ID)
+	if err != nil {
+		t.Fatalf("result: %v", err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); string(got) != "%PDF" {
+		t.Errorf("result %q", got)
+	}
+}
+
+func TestWait_Failed(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"j2","status":"failed","error":"conversion timed out"}`)
+	})
+
+	j, err := c.Wait(context.Background(), "j2")
+	if !errors.Is(err, client.ErrJobFailed) || !strings.Contains(err.Error(), "conversion timed out") {
+		t.Errorf("error = %v", err)
+	}
+	if j == nil || !j.Done() {
+		t.Errorf("job = %+v", j)
+	}
+}